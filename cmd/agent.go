@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/agent"
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+)
+
+var agentConfigFile string
+
+func init() {
+	agentCmd.Flags().StringVar(&agentConfigFile, "agent-config", "/etc/pathvector/agent.yml", "Agent configuration file")
+	rootCmd.AddCommand(agentCmd)
+}
+
+// agentApply validates and applies a bundle
+func agentApply(a *config.Agent, b *agent.Bundle) error {
+	if err := b.WriteFiles(a.CacheDirectory); err != nil {
+		return err
+	}
+	if err := bird.Check(a.BIRDBinary, a.CacheDirectory); err != nil {
+		return err
+	}
+	log.Infof("BIRD config validation passed")
+	if !dryRun {
+		if err := bird.MoveCacheAndReconfigure(a.BIRDDirectory, a.CacheDirectory, a.BIRDSocket, noConfigure); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Pull and apply config from a fleet controller",
+	Run: func(cmd *cobra.Command, args []string) {
+		agentBlob, err := ioutil.ReadFile(agentConfigFile)
+		if err != nil {
+			log.Fatal("Reading agent config file: " + err.Error())
+		}
+		a, err := config.LoadAgent(agentBlob)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := agent.NewClient(a.Controller, a.TLSCert, a.TLSKey, a.CA, a.SigningPublicKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Starting agent for controller %s", a.Controller)
+		lastApplied := ""
+		for ; ; time.Sleep(time.Duration(a.Interval) * time.Second) {
+			b, err := client.Fetch()
+			if err != nil {
+				log.Warnf("[agent] fetching bundle: %v", err)
+				continue
+			}
+			if b.Serial == lastApplied {
+				log.Debugf("[agent] bundle %s already applied", b.Serial)
+				continue
+			}
+
+			log.Infof("[agent] applying bundle %s generated at %s", b.Serial, b.Generated)
+			status := agent.Status{Serial: b.Serial, Applied: true, Time: time.Now()}
+			if err := agentApply(a, b); err != nil {
+				log.Warnf("[agent] applying bundle: %v", err)
+				status.Applied = false
+				status.Error = err.Error()
+			} else {
+				lastApplied = b.Serial
+			}
+			if err := client.Report(status); err != nil {
+				log.Warnf("[agent] reporting status: %v", err)
+			}
+		}
+	},
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/api"
+	"github.com/natesales/pathvector/internal/auth"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/logging"
+)
+
+func init() {
+	rootCmd.AddCommand(apiCmd)
+}
+
+// apiRun loads a config (the config file if configBlob is nil) and runs a single generate cycle for an API request
+func apiRun(configBlob []byte, dryRunRequest bool) (*config.Config, error) {
+	if configBlob == nil {
+		var err error
+		configBlob, err = ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c, err := config.Load(configBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	// API runs are serialized by the server's run lock
+	defer func(previous bool) { dryRun = previous }(dryRun)
+	dryRun = dryRun || dryRunRequest
+	return c, run(c)
+}
+
+var apiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Serve control API",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+
+		if c.API.Listen == "" && c.API.Socket == "" && c.API.GRPCListen == "" && c.API.GRPCSocket == "" {
+			log.Fatal("api.listen, api.socket, api.grpc-listen or api.grpc-socket must be set to serve the API")
+		}
+
+		authenticator, err := auth.New(&c.Auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !authenticator.Enabled() && c.API.Listen != "" {
+			log.Warnf("No authentication is configured, the API is accessible to anyone who can reach %s", c.API.Listen)
+		}
+		if !authenticator.Enabled() && c.API.GRPCListen != "" {
+			log.Warnf("No authentication is configured, the gRPC API is accessible to anyone who can reach %s", c.API.GRPCListen)
+		}
+		server := api.New(c, apiRun, noConfigure)
+		handler := server.Handler(authenticator)
+		grpcServer := server.GRPCServer(authenticator)
+
+		if c.API.Socket != "" {
+			l, err := api.ListenUnix(c.API.Socket)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("Serving API on %s", c.API.Socket)
+			go func() {
+				log.Fatal(http.Serve(l, handler))
+			}()
+		}
+		if c.API.Listen != "" {
+			log.Infof("Serving API on %s", c.API.Listen)
+			go func() {
+				log.Fatal(http.ListenAndServe(c.API.Listen, handler))
+			}()
+		}
+		if c.API.GRPCSocket != "" {
+			l, err := api.ListenUnix(c.API.GRPCSocket)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("Serving gRPC API on %s", c.API.GRPCSocket)
+			go func() {
+				log.Fatal(grpcServer.Serve(l))
+			}()
+		}
+		if c.API.GRPCListen != "" {
+			l, err := net.Listen("tcp", c.API.GRPCListen)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("Serving gRPC API on %s", c.API.GRPCListen)
+			go func() {
+				log.Fatal(grpcServer.Serve(l))
+			}()
+		}
+		select {}
+	},
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/natesales/pathvector/internal/api"
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestAPIRunFailure(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "pathvector.yml")
+	defer func(previous string) { configFile = previous }(configFile)
+	configFile = file
+
+	c, err := config.Load([]byte("asn: 34553\nrouter-id: 192.0.2.1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := api.New(c, apiRun, true)
+
+	for _, tc := range []struct {
+		config string
+		err    string
+	}{
+		{fmt.Sprintf("asn: 34553\nrouter-id: 192.0.2.1\ncache-directory: %s\nbird-binary: /bin/false\n", dir), "BIRD config validation"},
+		{"asn: 34553\n", "Validation"},
+	} {
+		if err := ioutil.WriteFile(file, []byte(tc.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/run", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected HTTP %d for %s error, got %d", http.StatusInternalServerError, tc.err, rec.Code)
+		}
+		var run api.Run
+		if err := json.NewDecoder(rec.Body).Decode(&run); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(run.Error, tc.err) {
+			t.Errorf("expected %s error, got %s", tc.err, run.Error)
+		}
+	}
+}
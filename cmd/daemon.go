@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/logging"
+)
+
+var daemonNoHealthchecks bool
+
+func init() {
+	daemonCmd.Flags().BoolVar(&daemonNoHealthchecks, "no-healthchecks", false, "Don't run healthchecks and conditional prefix probes (when run by the healthcheck command instead)")
+	rootCmd.AddCommand(daemonCmd)
+}
+
+// daemonDelay returns the time to wait before the next run, backing off exponentially from retry after consecutive failures up to interval
+func daemonDelay(interval time.Duration, retry time.Duration, failures int) time.Duration {
+	if failures == 0 {
+		return interval
+	}
+	delay := retry
+	for i := 1; i < failures && delay < interval; i++ {
+		delay *= 2
+	}
+	if delay > interval {
+		delay = interval
+	}
+	return delay
+}
+
+// daemonRun loads the config file and runs a single generate cycle
+func daemonRun() (*config.Config, error) {
+	configBlob, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	c, err := config.Load(configBlob)
+	if err != nil {
+		return nil, err
+	}
+	return c, run(c)
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Periodically update data sources, regenerate router configuration and run healthchecks",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configBlob, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configBlob)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Starting daemon with an update interval of %d seconds", c.UpdateInterval)
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		healthchecks := &healthcheckRunner{}
+		failures := 0
+		for {
+			// Keep the previous config's timers if the config file can't be loaded
+			if loaded, err := daemonRun(); err != nil {
+				failures++
+				log.Warnf("[daemon] run failed (%d consecutive): %v", failures, err)
+				if loaded != nil {
+					c = loaded
+				}
+			} else {
+				failures = 0
+				c = loaded
+				log.Infof("[daemon] run completed")
+				// Healthchecks are only restarted once BIRD has the config's healthcheck protocols
+				if !daemonNoHealthchecks {
+					healthchecks.update(c)
+				}
+			}
+
+			delay := daemonDelay(time.Duration(c.UpdateInterval)*time.Second, time.Duration(c.UpdateRetry)*time.Second, failures)
+			if c.UpdateJitter > 0 {
+				delay += time.Duration(random.Int63n(int64(time.Duration(c.UpdateJitter) * time.Second)))
+			}
+			log.Infof("[daemon] next run in %s", delay.Round(time.Second))
+			time.Sleep(delay)
+		}
+	},
+}
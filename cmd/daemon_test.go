@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestDaemonDelay(t *testing.T) {
+	interval, retry := time.Hour, time.Minute
+	for _, tc := range []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, time.Hour},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	} {
+		assert.Equal(t, tc.delay, daemonDelay(interval, retry, tc.failures), "%d failures", tc.failures)
+	}
+}
+
+func TestHealthcheckRunner(t *testing.T) {
+	noConfigure = true
+	defer func() { noConfigure = false }()
+
+	c := &config.Config{ConfigHash: "a", Healthchecks: map[string]*config.Healthcheck{
+		"web": {Type: "script", Target: "exit 0", Interval: 1, Timeout: 1, Rise: 1, Fall: 1, ProtocolName: "HEALTHCHECK_web"},
+	}}
+	r := &healthcheckRunner{}
+	r.update(c)
+	assert.NotNil(t, r.stop)
+	stop := r.stop
+	r.update(c)
+	assert.Equal(t, stop, r.stop, "unchanged config restarted healthchecks")
+
+	r.update(&config.Config{ConfigHash: "b"})
+	assert.Nil(t, r.stop)
+	_, open := <-stop
+	assert.False(t, open)
+}
+
+func TestHealthcheckAlert(t *testing.T) {
+	dir := t.TempDir()
+	script := path.Join(dir, "alert.sh")
+	assert.Nil(t, ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$1\" >> "+path.Join(dir, "alerts")+"\n"), 0755))
+
+	alert := healthcheckAlert(&config.Optimizer{AlertScript: script})
+	hc := &config.Healthcheck{Prefixes: []string{"192.0.2.0/24"}}
+	alert("web", hc, false, errors.New("connection refused"))
+	alert("web", hc, true, nil)
+
+	alerts, err := ioutil.ReadFile(path.Join(dir, "alerts"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Healthcheck web failing (connection refused), withdrawing [192.0.2.0/24]\nHealthcheck web passing, announcing [192.0.2.0/24]\n", string(alerts))
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/export"
+	"github.com/natesales/pathvector/internal/provenance"
+)
+
+var exportFormat string
+
+func init() {
+	exportStateCmd.Flags().StringVar(&exportFormat, "format", "json", "Output format (json or yaml)")
+	exportCmd.AddCommand(exportStateCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export pathvector data",
+}
+
+var exportStateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Export resolved peers, filters, limits, and protocol names",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+
+		// Exporting doesn't provision peers, so peers from NetBox, IXP Manager, and the portal aren't included
+		if c.NetBox.URL != "" || c.IXPManager.URL != "" || (c.PortalHost != "" && c.PortalProvision.Enabled) {
+			log.Warn("Peers provisioned from NetBox, IXP Manager, and the peering portal aren't exported")
+		}
+
+		// Prefix sets are resolved with the configured IRR and PeeringDB caches
+		header := provenance.New(version, c.ConfigHash)
+		peerHeaders, err := resolve(c, header)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Protocol names are generated while rendering, so render into a scratch directory
+		c.CacheDirectory, err = ioutil.TempDir("", "pathvector-export")
+		if err != nil {
+			log.Fatal(err)
+		}
+		//noinspection GoUnhandledErrorResult
+		defer os.RemoveAll(c.CacheDirectory)
+		if err := renderTemplates(c, header, peerHeaders); err != nil {
+			log.Fatal(err)
+		}
+
+		out, err := export.Marshal(export.Build(c), exportFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(out))
+	},
+}
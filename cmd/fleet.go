@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/agent"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/fleet"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+var fleetFile string
+
+func init() {
+	fleetCmd.PersistentFlags().StringVar(&fleetFile, "fleet", "/etc/pathvector/fleet.yml", "Fleet file listing the routers to manage")
+	fleetCmd.AddCommand(fleetDiffCmd)
+	fleetCmd.AddCommand(fleetPushCmd)
+	fleetCmd.AddCommand(fleetServeCmd)
+	rootCmd.AddCommand(fleetCmd)
+}
+
+// fleetRouters loads the fleet file and returns the names of the selected routers
+func fleetRouters(args []string) (*config.Fleet, []string) {
+	fleetBlob, err := ioutil.ReadFile(fleetFile)
+	if err != nil {
+		log.Fatal("Reading fleet file: " + err.Error())
+	}
+	f, err := config.LoadFleet(fleetBlob)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 {
+		for _, name := range args {
+			if f.Routers[name] == nil {
+				log.Fatalf("Router %s is not in the fleet", name)
+			}
+		}
+		return f, args
+	}
+	var names []string
+	for name := range f.Routers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return f, names
+}
+
+// fleetRender loads a router's config and renders it into the fleet cache directory
+func fleetRender(f *config.Fleet, name string) (*config.Config, map[string][]byte, error) {
+	router := f.Routers[name]
+
+	// Router config paths are relative to the fleet file
+	configPath := router.Config
+	if !filepath.IsAbs(configPath) {
+		configPath = path.Join(path.Dir(fleetFile), configPath)
+	}
+	configBlob, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading config file: %v", err)
+	}
+	c, err := config.Load(configBlob)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.CacheDirectory = path.Join(f.CacheDirectory, *util.Sanitize(name))
+
+	log.Infof("[%s] Rendering config", name)
+	if _, err := render(c); err != nil {
+		return nil, nil, err
+	}
+	local, err := fleet.LocalFiles(c.CacheDirectory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading rendered config: %v", err)
+	}
+	return c, local, nil // nil error
+}
+
+// fleetSync renders a router's config locally, compares it to the router, and optionally pushes it
+func fleetSync(f *config.Fleet, name string, push bool) error {
+	router := f.Routers[name]
+	if router.Agent {
+		log.Infof("[%s] Skipping agent router", name)
+		return nil // nil error
+	}
+	c, local, err := fleetRender(f, name)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("[%s] Connecting to %s", name, router.Host)
+	remote, err := fleet.Dial(f, router)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer remote.Close()
+
+	remoteFiles, err := fleet.RemoteFiles(remote, c.BIRDDirectory)
+	if err != nil {
+		return err
+	}
+	changes := fleet.Diff(local, remoteFiles)
+	if len(changes) == 0 {
+		log.Infof("[%s] No changes", name)
+		return nil // nil error
+	}
+	for _, change := range changes {
+		fmt.Print(change.Diff)
+	}
+	log.Infof("[%s] %d files changed", name, len(changes))
+
+	if !push || dryRun {
+		return nil // nil error
+	}
+	log.Infof("[%s] Pushing config", name)
+	if err := fleet.Push(remote, local, c.BIRDDirectory, c.BIRDBinary, f.BIRDCBinary, c.BIRDSocket); err != nil {
+		return err
+	}
+	log.Infof("[%s] Reconfigured BIRD", name)
+	return nil // nil error
+}
+
+// fleetRun syncs each selected router, continuing past failures
+func fleetRun(args []string, push bool) {
+	f, names := fleetRouters(args)
+	failed := 0
+	for _, name := range names {
+		if err := fleetSync(f, name, push); err != nil {
+			log.Errorf("[%s] %v", name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d routers failed", failed, len(names))
+	}
+}
+
+var fleetServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve signed configs to agent routers over mTLS",
+	Run: func(cmd *cobra.Command, args []string) {
+		f, _ := fleetRouters(nil)
+		if f.Controller.TLSCert == "" || f.Controller.TLSKey == "" || f.Controller.ClientCA == "" || f.Controller.SigningKey == "" {
+			log.Fatal("controller tls-cert, tls-key, client-ca, and signing-key must be set to serve agents")
+		}
+		key, err := agent.LoadSigningKey(f.Controller.SigningKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Rendering uses shared template state, so only render one router at a time
+		var renderLock sync.Mutex
+		server := agent.NewServer(key, func(name string) (*agent.Bundle, error) {
+			router := f.Routers[name]
+			if router == nil || !router.Agent {
+				return nil, fmt.Errorf("%s is not an agent router in the fleet", name)
+			}
+			renderLock.Lock()
+			defer renderLock.Unlock()
+			_, local, err := fleetRender(f, name)
+			if err != nil {
+				return nil, err
+			}
+			return &agent.Bundle{
+				Router:    name,
+				Serial:    agent.Serial(local),
+				Generated: time.Now(),
+				Files:     local,
+			}, nil // nil error
+		})
+		server.OnStatus = func(status agent.Status) {
+			if status.Applied {
+				log.Infof("[%s] Agent applied %s", status.Router, status.Serial)
+			} else {
+				log.Warnf("[%s] Agent failed to apply %s: %s", status.Router, status.Serial, status.Error)
+			}
+		}
+
+		log.Infof("Serving agents on %s", f.Controller.Listen)
+		log.Fatal(agent.ListenAndServe(f.Controller.Listen, f.Controller.TLSCert, f.Controller.TLSKey, f.Controller.ClientCA, server))
+	},
+}
+
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Manage a fleet of routers",
+}
+
+var fleetDiffCmd = &cobra.Command{
+	Use:   "diff [router...]",
+	Short: "Show config changes for fleet routers",
+	Run: func(cmd *cobra.Command, args []string) {
+		fleetRun(args, false)
+	},
+}
+
+var fleetPushCmd = &cobra.Command{
+	Use:   "push [router...]",
+	Short: "Push configs to fleet routers and reconfigure BIRD",
+	Run: func(cmd *cobra.Command, args []string) {
+		fleetRun(args, true)
+	},
+}
@@ -1,23 +1,37 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/carp"
 	"github.com/natesales/pathvector/internal/config"
 	"github.com/natesales/pathvector/internal/embed"
+	"github.com/natesales/pathvector/internal/frr"
 	"github.com/natesales/pathvector/internal/irr"
+	"github.com/natesales/pathvector/internal/ixpmanager"
+	"github.com/natesales/pathvector/internal/keepalived"
+	"github.com/natesales/pathvector/internal/logging"
+	"github.com/natesales/pathvector/internal/netbox"
+	"github.com/natesales/pathvector/internal/openbgpd"
 	"github.com/natesales/pathvector/internal/peeringdb"
 	"github.com/natesales/pathvector/internal/portal"
+	"github.com/natesales/pathvector/internal/provenance"
+	"github.com/natesales/pathvector/internal/slurm"
 	"github.com/natesales/pathvector/internal/templating"
 	"github.com/natesales/pathvector/internal/util"
+	"github.com/natesales/pathvector/internal/visibility"
+	"github.com/natesales/pathvector/pkg/birdc"
 )
 
 func init() {
@@ -57,127 +71,412 @@ var generateCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 		log.Debugln("Finished loading config")
-
-		// Run NVRS query
-		if c.QueryNVRS {
-			var err error
-			c.NVRSASNs, err = peeringdb.NeverViaRouteServers(c.PeeringDBQueryTimeout)
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+		// Start the run before the run log so it is named after the run ID
+		logging.NewRun()
+		if c.Logging.RunDirectory != "" {
+			runLog, err := logging.StartRunLog(c.Logging.RunDirectory, c.Logging.RunLogs, c.Logging.Format)
 			if err != nil {
-				log.Fatalf("PeeringDB NVRS query: %s", err)
+				log.Fatal(err)
 			}
+			//noinspection GoUnhandledErrorResult
+			defer runLog.Close()
 		}
 
-		// Load templates from embedded filesystem
-		log.Debugln("Loading templates from embedded filesystem")
-		err = templating.Load(embed.FS)
-		if err != nil {
+		if err := runCycle(c); err != nil {
 			log.Fatal(err)
 		}
-		log.Debugln("Finished loading templates")
 
-		// Create cache directory
-		log.Debugf("Making cache directory %s", c.CacheDirectory)
-		if err := os.MkdirAll(c.CacheDirectory, os.FileMode(0755)); err != nil {
-			log.Fatal(err)
+		// Delete lockfile
+		if lockFile != "" {
+			if err := os.Remove(lockFile); err != nil {
+				log.Fatalf("Removing lockfile: %v", err)
+			}
 		}
+	},
+}
 
-		// Create the global output file
-		log.Debug("Creating global config")
-		globalFile, err := os.Create(path.Join(c.CacheDirectory, "bird.conf"))
-		if err != nil {
-			log.Fatalf("Create global BIRD output file: %v", err)
+// render updates external data sources and renders the configuration into the cache directory, returning the provenance header of the rendered files or an error if a data source fails
+func render(c *config.Config) (*provenance.Header, error) {
+	header := provenance.New(version, c.ConfigHash)
+	logging.SetStage("sources")
+	if err := provision(c, header); err != nil {
+		return nil, err
+	}
+	peerHeaders, err := resolve(c, header)
+	if err != nil {
+		return nil, err
+	}
+	if err := renderTemplates(c, header, peerHeaders); err != nil {
+		return nil, err
+	}
+	return header, nil // nil error
+}
+
+// provision adds peers and prefixes from NetBox, IXP Manager, and the peering portal to the config
+func provision(c *config.Config, header *provenance.Header) error {
+	// Pull peers and prefixes from NetBox
+	if c.NetBox.URL != "" {
+		log.Infoln("Updating peers from NetBox")
+		if err := netbox.Update(c); err != nil {
+			return fmt.Errorf("NetBox: %v", err)
 		}
-		log.Debug("Finished creating global config file")
+		header.Fetched("netbox")
+	}
+
+	// Pull route server clients from IXP Manager
+	if c.IXPManager.URL != "" {
+		log.Infoln("Updating route server clients from IXP Manager")
+		if err := ixpmanager.Update(c); err != nil {
+			return fmt.Errorf("IXP Manager: %v", err)
+		}
+		header.Fetched("ixp-manager")
+	}
+
+	// Pull approved peering requests from the portal
+	if c.PortalHost != "" && c.PortalProvision.Enabled {
+		log.Infoln("Provisioning peers from portal requests")
+		if err := portal.Provision(c); err != nil {
+			return fmt.Errorf("portal provisioning: %v", err)
+		}
+		header.Fetched("portal")
+	}
+	return nil // nil error
+}
 
-		// Render the global template and write to buffer
-		log.Debug("Writing global config file")
-		err = templating.GlobalTemplate.ExecuteTemplate(globalFile, "global.tmpl", c)
+// resolve queries PeeringDB and IRR data for the config's peers, only writing to their caches in the cache directory, and returns each peer's provenance header
+func resolve(c *config.Config, header *provenance.Header) (map[string]*provenance.Header, error) {
+	peeringdb.SetAPIKey(c.PeeringDBAPIKey)
+
+	// Cache PeeringDB responses if they're reused within a TTL or the only data source when offline
+	var pdbCache *peeringdb.Cache
+	if c.PeeringDBCacheTTL > 0 || offline {
+		pdbCache = &peeringdb.Cache{Directory: path.Join(c.CacheDirectory, "peeringdb"), TTL: time.Duration(c.PeeringDBCacheTTL) * time.Second, Offline: offline}
+	}
+
+	// Run NVRS query
+	if c.QueryNVRS {
+		var err error
+		c.NVRSASNs, err = peeringdb.NeverViaRouteServers(c.PeeringDBQueryTimeout, pdbCache)
 		if err != nil {
-			log.Fatalf("Execute global template: %v", err)
+			return nil, fmt.Errorf("PeeringDB NVRS query: %s", err)
 		}
-		log.Debug("Finished writing global config file")
+		header.Fetched("peeringdb-nvrs")
+	}
 
-		// Remove old peer-specific configs
-		if err := util.RemoveFileGlob(path.Join(c.CacheDirectory, "AS*.conf")); err != nil {
-			log.Fatalf("Removing old config files: %v", err)
+	// Load local RPKI exceptions
+	if c.RPKISLURMFile != "" {
+		if !c.RPKIEnable {
+			log.Warnf("rpki-slurm-file is set and rpki-enable is disabled, ignoring %s", c.RPKISLURMFile)
+		} else {
+			var err error
+			c.SLURM, err = slurm.Load(c.RPKISLURMFile)
+			if err != nil {
+				return nil, fmt.Errorf("SLURM file %s: %v", c.RPKISLURMFile, err)
+			}
 		}
+	}
+
+	// Print global config
+	util.PrintStructInfo("pathvector.global", c)
 
-		// Print global config
-		util.PrintStructInfo("pathvector.global", c)
+	peerHeaders := map[string]*provenance.Header{}
+	for peerName := range c.Peers {
+		peerHeaders[peerName] = header.Copy()
+	}
+	irrQuery := irr.NewQuery(c)
 
-		// Iterate over peers
-		for peerName, peerData := range c.Peers {
-			log.Printf("Processing AS%d %s", *peerData.ASN, peerName)
+	// Cache IRR prefix lists if they're reused within a TTL, served when stale, or the only data source when offline
+	var irrCache *irr.Cache
+	if c.IRRCacheTTL > 0 || serveStale || offline {
+		irrCache = &irr.Cache{Directory: path.Join(c.CacheDirectory, "irr"), TTL: time.Duration(c.IRRCacheTTL) * time.Second, ServeStale: serveStale, Offline: offline}
+	}
+
+	// Query external data for all peers at once with at most c.MaxConcurrentQueries PeeringDB and IRR queries running at a time.
+	// A peer's IRR queries wait for its PeeringDB query as the as-set may come from PeeringDB, and its IPv4, IPv6 and origin ASN IRR queries run concurrently.
+	sem := make(chan struct{}, c.MaxConcurrentQueries)
+	var wg sync.WaitGroup
+	var queryLock sync.Mutex
+	var queryErr error // First PeeringDB or IRR query error
+	for peerName, peerData := range c.Peers {
+		wg.Add(1)
+		go func(peerName string, peerData *config.Peer, peerHeader *provenance.Header) {
+			defer wg.Done()
+			logging.Peer(peerName).Printf("Processing AS%d", *peerData.ASN)
 
 			// If a PeeringDB query is required
 			if *peerData.AutoImportLimits || *peerData.AutoASSet {
-				log.Debugf("[%s] has auto-import-limits or auto-as-set, querying PeeringDB", peerName)
+				logging.Peer(peerName).Debug("Peer has auto-import-limits or auto-as-set, querying PeeringDB")
 
-				peeringdb.Update(peerData, c.PeeringDBQueryTimeout)
+				sem <- struct{}{}
+				err := peeringdb.Update(peerData, c.PeeringDBQueryTimeout, pdbCache)
+				<-sem
+				if err != nil {
+					// IRR queries are skipped as the as-set may come from PeeringDB
+					queryLock.Lock()
+					if queryErr == nil {
+						queryErr = fmt.Errorf("%s: %v", peerName, err)
+					}
+					queryLock.Unlock()
+					return
+				}
+				peerHeader.Fetched("peeringdb")
 			} // end peeringdb query enabled
 
-			// Build IRR prefix sets
+			// Build IRR prefix sets and origin ASN sets
+			var irrJobs []func() error
 			if *peerData.FilterIRR {
-				if err := irr.Update(peerData, c.IRRServer, c.IRRQueryTimeout, c.BGPQArgs); err != nil {
-					log.Fatal(err)
+				for _, family := range []uint8{4, 6} {
+					family := family
+					irrJobs = append(irrJobs, func() error { return irr.UpdateFamily(peerData, family, irrQuery, irrCache) })
 				}
 			}
+			if *peerData.FilterASPath {
+				irrJobs = append(irrJobs, func() error { return irr.UpdateOriginASNs(peerData, irrQuery, irrCache) })
+			}
+			var irrWG sync.WaitGroup
+			failed := false
+			for _, job := range irrJobs {
+				irrWG.Add(1)
+				go func(job func() error) {
+					defer irrWG.Done()
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					if err := job(); err != nil {
+						queryLock.Lock()
+						failed = true
+						if queryErr == nil {
+							queryErr = fmt.Errorf("%s: %v", peerName, err)
+						}
+						queryLock.Unlock()
+					}
+				}(job)
+			}
+			irrWG.Wait()
+			if len(irrJobs) > 0 && !failed {
+				peerHeader.Fetched("irr")
+			}
+		}(peerName, peerData, peerHeaders[peerName])
+	}
+	wg.Wait()
+	if queryErr != nil {
+		return nil, queryErr
+	}
 
-			util.PrintStructInfo(peerName, peerData)
+	for peerName, peerData := range c.Peers {
+		util.PrintStructInfo(peerName, peerData)
 
-			// Create peer file
-			peerFileName := path.Join(c.CacheDirectory, fmt.Sprintf("AS%d_%s.conf", *peerData.ASN, *util.Sanitize(peerName)))
-			peerSpecificFile, err := os.Create(peerFileName)
-			if err != nil {
-				log.Fatalf("Create peer specific output file: %v", err)
-			}
+		if *peerData.AggregatePrefixes {
+			before4, before6 := peerData.PrefixSet4.Len(), peerData.PrefixSet6.Len()
+			peerData.PrefixSet4.Aggregate()
+			peerData.PrefixSet6.Aggregate()
+			logging.Peer(peerName).Debugf("Aggregated prefix sets from %d to %d IPv4 and %d to %d IPv6 patterns", before4, peerData.PrefixSet4.Len(), before6, peerData.PrefixSet6.Len())
+		}
+	}
 
-			// Render the template and write to buffer
-			var b bytes.Buffer
-			log.Debugf("[%s] Writing config", peerName)
-			err = templating.PeerTemplate.ExecuteTemplate(&b, "peer.tmpl", &templating.Wrapper{Name: peerName, Peer: *peerData, Config: *c})
-			if err != nil {
-				log.Fatalf("Execute template: %v", err)
-			}
+	return peerHeaders, nil // nil error
+}
 
-			// Reformat config and write template to file
-			if _, err := peerSpecificFile.Write([]byte(bird.Reformat(b.String()))); err != nil {
-				log.Fatalf("Write template to file: %v", err)
-			}
+// renderTemplates renders the config for the configured daemon into the cache directory
+func renderTemplates(c *config.Config, header *provenance.Header, peerHeaders map[string]*provenance.Header) error {
+	// Load templates from embedded filesystem
+	logging.SetStage("render")
+	log.Debugln("Loading templates from embedded filesystem")
+	if err := templating.Load(embed.FS); err != nil {
+		return fmt.Errorf("loading templates: %v", err)
+	}
+	log.Debugln("Finished loading templates")
 
-			log.Debugf("[%s] Wrote config", peerName)
+	// Create cache directory
+	log.Debugf("Making cache directory %s", c.CacheDirectory)
+	if err := os.MkdirAll(c.CacheDirectory, os.FileMode(0755)); err != nil {
+		return fmt.Errorf("making cache directory: %v", err)
+	}
 
-		} // end peer loop
+	// Render the config for the configured daemon
+	log.Debugf("Rendering %s config", c.Daemon)
+	peerHeaderStrings := map[string]string{}
+	for peerName, peerHeader := range peerHeaders {
+		peerHeaderStrings[peerName] = peerHeader.String()
+	}
+	if err := templating.Renderers[c.Daemon].Render(c, header.String(), peerHeaderStrings); err != nil {
+		return fmt.Errorf("rendering %s config: %v", c.Daemon, err)
+	}
+	log.Debugf("Finished rendering %s config", c.Daemon)
 
-		// Run BIRD config validation
-		bird.Validate(c.BIRDBinary, c.CacheDirectory)
+	// Add the hash of each rendered file to its provenance header
+	files, err := templating.Renderers[c.Daemon].CacheFiles(c)
+	if err != nil {
+		return fmt.Errorf("listing rendered files: %v", err)
+	}
+	for _, file := range files {
+		if err := provenance.SealFile(file); err != nil {
+			return fmt.Errorf("sealing rendered file: %v", err)
+		}
+	}
 
-		if !dryRun {
-			// Write VRRP config
-			templating.WriteVRRPConfig(c.VRRPInstances, c.KeepalivedConfig)
+	return nil // nil error
+}
 
-			if c.WebUIFile != "" {
-				templating.WriteUIFile(c)
-			} else {
-				log.Infof("Web UI is not defined, NOT writing UI")
+// roleMismatches returns the last errors of BGP sessions that failed on an RFC 9234 role mismatch, keyed by protocol name
+func roleMismatches(output string) map[string]string {
+	mismatches := map[string]string{}
+	for name, protocol := range birdc.ParseProtocols(output) {
+		if protocol.Proto == "BGP" && strings.Contains(protocol.LastError, "Role mismatch") {
+			mismatches[name] = protocol.LastError
+		}
+	}
+	return mismatches
+}
+
+// warnRoleMismatches warns about BGP sessions whose neighbors announce a conflicting BGP role
+func warnRoleMismatches(birdSocket string) {
+	out, err := bird.RunCommand("show protocols all", birdSocket)
+	if err != nil {
+		log.Warnf("Checking BGP roles: %v", err)
+		return
+	}
+	mismatches := roleMismatches(out)
+	var names []string
+	for name := range mismatches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Warnf("BGP role mismatch on %s (%s), check the role of the peer", name, mismatches[name])
+	}
+}
+
+// run starts a new run ID and runs a single generate cycle
+func run(c *config.Config) error {
+	logging.NewRun()
+	return runCycle(c)
+}
+
+// runCycle renders the configuration and applies it to the routing daemon, returning an error if a data source, validation or apply step fails
+func runCycle(c *config.Config) error {
+	header, err := render(c)
+	if err != nil {
+		return err
+	}
+
+	// Run daemon config validation
+	logging.SetStage("validate")
+	switch c.Daemon {
+	case "frr":
+		if err := frr.Check(c.VtyshBinary, path.Join(c.CacheDirectory, "frr.conf")); err != nil {
+			return fmt.Errorf("FRR config validation: %v", err)
+		}
+		log.Infof("FRR config validation passed")
+	case "openbgpd":
+		if err := openbgpd.Check(c.OpenBGPDBinary, path.Join(c.CacheDirectory, "bgpd.conf")); err != nil {
+			return fmt.Errorf("OpenBGPD config validation: %v", err)
+		}
+		log.Infof("OpenBGPD config validation passed")
+	default:
+		if err := bird.Check(c.BIRDBinary, c.CacheDirectory); err != nil {
+			return fmt.Errorf("BIRD config validation: %v", err)
+		}
+		log.Infof("BIRD config validation passed")
+	}
+
+	if !dryRun {
+		logging.SetStage("apply")
+
+		// Write VRRP config
+		newKeepalivedConfig := c.KeepalivedConfig + ".new"
+		if err := os.Remove(newKeepalivedConfig); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := templating.WriteVRRPConfig(c.VRRPInstances, c.VRRPSyncGroups, vrrpNotifyCommand(), header.String(), newKeepalivedConfig); err != nil {
+			return fmt.Errorf("VRRP config: %v", err)
+		}
+		if _, err := os.Stat(newKeepalivedConfig); err == nil {
+			if err := provenance.SealFile(newKeepalivedConfig); err != nil {
+				return fmt.Errorf("VRRP config: %v", err)
 			}
+		}
+		if err := keepalived.Apply(newKeepalivedConfig, c.KeepalivedConfig, c.KeepalivedBinary, c.KeepalivedReload, c.KeepalivedPIDFile, noConfigure); err != nil {
+			return err
+		}
+		if err := carp.Apply(c.VRRPInstances, noConfigure); err != nil {
+			return err
+		}
 
-			bird.MoveCacheAndReconfigure(c.BIRDDirectory, c.CacheDirectory, c.BIRDSocket, noConfigure)
-		} // end dry run check
+		if c.WebUIFile != "" {
+			if err := templating.WriteUIFile(c); err != nil {
+				return err
+			}
+		} else {
+			log.Infof("Web UI is not defined, NOT writing UI")
+		}
 
-		// Update portal
-		if c.PortalHost != "" {
-			log.Infoln("Updating peering portal")
-			if err := portal.Record(c.PortalHost, c.PortalKey, c.Hostname, c.Peers, c.BIRDSocket); err != nil {
-				log.Fatal(err)
+		if c.NeighborsFile != "" {
+			if err := templating.WriteNeighborsFile(c); err != nil {
+				return err
 			}
 		}
 
-		// Delete lockfile
-		if lockFile != "" {
-			if err := os.Remove(lockFile); err != nil {
-				log.Fatalf("Removing lockfile: %v", err)
+		if c.BirdLG.FrontendFile != "" || c.BirdLG.ProxyFile != "" {
+			if err := templating.WriteBirdLGConfig(c, header.String()); err != nil {
+				return fmt.Errorf("bird-lg config: %v", err)
 			}
 		}
-	},
+
+		// Rotate the BIRD log file before reconfiguring so BIRD reopens it
+		if c.LogFile != "syslog" && c.LogFileMaxAge > 0 && !noConfigure {
+			rotated, err := logging.RotateFile(c.LogFile, time.Duration(c.LogFileMaxAge)*time.Hour, c.LogFileBackups, time.Now())
+			if err != nil {
+				log.Warnf("Rotating log file: %v", err)
+			} else if rotated {
+				log.Infof("Rotated log file %s", c.LogFile)
+			}
+		}
+
+		switch c.Daemon {
+		case "frr":
+			if err := frr.Apply(path.Join(c.CacheDirectory, "frr.conf"), c.FRRConfig, c.FRRReload, noConfigure); err != nil {
+				return err
+			}
+		case "openbgpd":
+			if err := openbgpd.Apply(path.Join(c.CacheDirectory, "bgpd.conf"), c.OpenBGPDConfig, c.BgpctlBinary, noConfigure); err != nil {
+				return err
+			}
+		default:
+			if err := bird.MoveCacheAndReconfigure(c.BIRDDirectory, c.CacheDirectory, c.BIRDSocket, noConfigure); err != nil {
+				return err
+			}
+			if c.RolesEnable && !noConfigure {
+				warnRoleMismatches(c.BIRDSocket)
+			}
+		}
+
+		// Check that originated prefixes are still visible externally
+		if c.Visibility.Enabled && !noConfigure {
+			logging.SetStage("visibility")
+			log.Infof("Waiting %d seconds to check prefix visibility", c.Visibility.Delay)
+			time.Sleep(time.Duration(c.Visibility.Delay) * time.Second)
+			problems, err := visibility.Check(c)
+			if err != nil {
+				log.Warnf("Visibility check: %v", err)
+			} else if len(problems) == 0 {
+				log.Infof("All %d originated prefixes are visible", len(c.Prefixes))
+			}
+		}
+	} // end dry run check
+
+	// Update portal
+	if c.PortalHost != "" && c.Daemon != "bird" {
+		log.Warnln("Peering portal session state is read from BIRD, not updating portal")
+	} else if c.PortalHost != "" {
+		logging.SetStage("portal")
+		log.Infoln("Updating peering portal")
+		if err := portal.Record(c.PortalHost, c.PortalKey, c.Hostname, c.Peers, c.BIRDSocket); err != nil {
+			return fmt.Errorf("portal: %v", err)
+		}
+	}
+
+	return nil // nil error
 }
@@ -1,9 +1,17 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
 )
 
 func TestGenerate(t *testing.T) {
@@ -35,3 +43,119 @@ func TestGenerate(t *testing.T) {
 		}
 	}
 }
+
+func TestRoleMismatches(t *testing.T) {
+	output := `2002-Name       Proto      Table      State  Since         Info
+1002-UPSTREAMv4 BGP        ---        start  2021-06-11 02:00:00  Idle          Received: Role mismatch
+1006-  BGP state:          Idle
+     Neighbor address: 192.0.2.2
+     Neighbor AS:      65510
+     Last error:       Received: Role mismatch
+1002-MEMBERv4   BGP        ---        start  2021-06-11 02:00:00  Active        Socket: Connection refused
+1006-  BGP state:          Active
+     Neighbor address: 192.0.2.3
+     Neighbor AS:      65520
+     Last error:       Socket: Connection refused
+0000
+`
+	mismatches := roleMismatches(output)
+	if len(mismatches) != 1 || mismatches["UPSTREAMv4"] != "Received: Role mismatch" {
+		t.Errorf("unexpected role mismatches %v", mismatches)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	// PeeringDB failures are returned instead of exiting
+	c, err := config.Load([]byte("asn: 34553\nrouter-id: 192.0.2.1\npeers:\n  Example:\n    asn: 65530\n    auto-import-limits: true\n    neighbors: [192.0.2.2]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CacheDirectory = t.TempDir()
+	offline = true
+	err = run(c)
+	offline = false
+	if err == nil || !strings.Contains(err.Error(), "Example: unable to get PeeringDB data") {
+		t.Errorf("expected PeeringDB error, got %+v", err)
+	}
+
+	// Invalid BIRD configs are returned instead of exiting
+	c, err = config.Load([]byte("asn: 34553\nrouter-id: 192.0.2.1\nbird-binary: /bin/false\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CacheDirectory = t.TempDir()
+	if err := run(c); err == nil || !strings.Contains(err.Error(), "BIRD config validation") {
+		t.Errorf("expected BIRD config validation error, got %+v", err)
+	}
+}
+
+func TestRenderConcurrentQueries(t *testing.T) {
+	var configFile strings.Builder
+	configFile.WriteString("asn: 34553\nrouter-id: 192.0.2.1\nmax-concurrent-queries: 3\nirr-server: irr.invalid\npeers:\n")
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&configFile, "  Peer %d:\n    asn: %d\n    as-set: AS-PEER%d\n    filter-irr: true\n    neighbors: [192.0.2.%d, 2001:db8::%d]\n", i, 65000+i, i, i+10, i+10)
+	}
+	c, err := config.Load([]byte(configFile.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CacheDirectory = t.TempDir()
+
+	// Queries to the invalid IRR server fail, so each peer's prefix sets come from its stale cached prefix lists
+	if err := os.MkdirAll(path.Join(c.CacheDirectory, "irr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		for family, prefix := range map[int]string{4: fmt.Sprintf("198.51.100.%d/32", i), 6: fmt.Sprintf("2001:db8:%x::/48", i+1)} {
+			entry := fmt.Sprintf(`{"as-set":"AS-PEER%d","family":%d,"resolver":"bgpq4","server":"irr.invalid","args":"","time":"2020-01-01T00:00:00Z","prefixes":["%s"]}`, i, family, prefix)
+			if err := ioutil.WriteFile(path.Join(c.CacheDirectory, "irr", fmt.Sprintf("AS-PEER%d_%d.json", i, family)), []byte(entry), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	serveStale = true
+	defer func() { serveStale = false }()
+
+	if _, err := render(c); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		peer := c.Peers[fmt.Sprintf("Peer %d", i)]
+		if got := peer.PrefixSet4.Strings(); len(got) != 1 || got[0] != fmt.Sprintf("198.51.100.%d/32", i) {
+			t.Errorf("Peer %d IPv4 prefix set: %v", i, got)
+		}
+		if got := peer.PrefixSet6.Strings(); len(got) != 1 || got[0] != fmt.Sprintf("2001:db8:%x::/48", i+1) {
+			t.Errorf("Peer %d IPv6 prefix set: %v", i, got)
+		}
+	}
+}
+
+func BenchmarkRenderRouteServer(b *testing.B) {
+	var configFile strings.Builder
+	configFile.WriteString(`
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24, 2001:db8::/48]
+templates:
+  rs-client:
+    rs-client: true
+peers:
+`)
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&configFile, "  Client %d:\n    asn: %d\n    template: rs-client\n    neighbors: [10.%d.%d.1, 2001:db8:%x::1]\n", i, 4200000000+i, i/256, i%256, i)
+	}
+	c, err := config.Load([]byte(configFile.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	c.CacheDirectory = b.TempDir()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := render(c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/healthcheck"
+	"github.com/natesales/pathvector/internal/logging"
+	"github.com/natesales/pathvector/internal/optimizer"
+)
+
+func init() {
+	rootCmd.AddCommand(healthcheckCmd)
+}
+
+// healthcheckAlert returns a healthcheck state change hook that calls the optimizer alert script
+func healthcheckAlert(o *config.Optimizer) func(string, *config.Healthcheck, bool, error) {
+	return func(name string, hc *config.Healthcheck, healthy bool, err error) {
+		if healthy {
+			optimizer.RunAlertScript(o, fmt.Sprintf("Healthcheck %s passing, announcing %v", name, hc.Prefixes))
+		} else {
+			optimizer.RunAlertScript(o, fmt.Sprintf("Healthcheck %s failing (%v), withdrawing %v", name, err, hc.Prefixes))
+		}
+	}
+}
+
+// healthcheckRunner runs the healthchecks of the latest config, restarting them when the config changes
+type healthcheckRunner struct {
+	hash string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// update stops the running healthchecks and starts the healthchecks of c if the config has changed
+func (r *healthcheckRunner) update(c *config.Config) {
+	if c.ConfigHash == r.hash {
+		return
+	}
+	r.hash = c.ConfigHash
+	r.close()
+
+	healthchecks := c.AllHealthchecks()
+	if len(healthchecks) == 0 {
+		return
+	}
+	log.Infof("[daemon] starting %d healthchecks", len(healthchecks))
+	healthcheck.OnChange = healthcheckAlert(&c.Optimizer)
+	stop, done := make(chan struct{}), make(chan struct{})
+	r.stop, r.done = stop, done
+	go func() {
+		healthcheck.Run(healthchecks, c.BIRDSocket, noConfigure || dryRun, stop)
+		close(done)
+	}()
+}
+
+// close stops the running healthchecks and waits for them to exit
+func (r *healthcheckRunner) close() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.stop, r.done = nil, nil
+}
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Run service healthchecks and conditional prefix probes and withdraw their prefixes when failing",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+		healthchecks := c.AllHealthchecks()
+		if len(healthchecks) == 0 {
+			log.Fatal("No healthchecks or conditional prefixes are defined, exiting now")
+		}
+
+		healthcheck.OnChange = healthcheckAlert(&c.Optimizer)
+		stop := make(chan struct{})
+		go func() {
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			<-sig
+			log.Infof("Stopping healthchecks")
+			close(stop)
+		}()
+		healthcheck.Run(healthchecks, c.BIRDSocket, noConfigure || dryRun, stop)
+	},
+}
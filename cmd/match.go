@@ -10,6 +10,7 @@ import (
 
 	"github.com/natesales/pathvector/internal/config"
 	"github.com/natesales/pathvector/internal/match"
+	"github.com/natesales/pathvector/internal/peeringdb"
 )
 
 var (
@@ -43,6 +44,9 @@ var matchCmd = &cobra.Command{
 			log.Debugln("Finished loading config")
 			matchLocalASN = uint(c.ASN)
 			peeringDbTimeout = c.PeeringDBQueryTimeout
+			peeringdb.SetAPIKey(c.PeeringDBAPIKey)
+		} else {
+			peeringdb.SetAPIKey("")
 		}
 
 		if len(args) != 1 {
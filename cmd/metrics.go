@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/logging"
+	"github.com/natesales/pathvector/internal/metrics"
+)
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+}
+
+// metricsHandler returns the metrics endpoint with BIRD session, route and reload metrics collected on each scrape
+func metricsHandler(c *config.Config) http.Handler {
+	metrics.Register(metrics.BIRD(c.BIRDSocket))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	return mux
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Serve Prometheus metrics",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+
+		if c.MetricsListen == "" {
+			log.Fatal("metrics-listen isn't set, exiting now")
+		}
+		log.Infof("Serving metrics on %s", c.MetricsListen)
+		log.Fatal(http.ListenAndServe(c.MetricsListen, metricsHandler(c)))
+	},
+}
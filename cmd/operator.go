@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/kubernetes"
+)
+
+var (
+	operatorRouterConfig string
+	operatorDebounce     time.Duration
+)
+
+func init() {
+	operatorCmd.Flags().StringVar(&operatorRouterConfig, "router-config", "", "Name of the RouterConfig resource to apply (default system hostname)")
+	operatorCmd.Flags().DurationVar(&operatorDebounce, "debounce", 5*time.Second, "Time to wait for further changes before applying")
+	rootCmd.AddCommand(operatorCmd)
+}
+
+// watchResource watches a CRD forever, signalling changes on the channel
+func watchResource(ctx context.Context, client *kubernetes.Client, resource string, labelSelector string, changes chan<- struct{}) {
+	for {
+		_, resourceVersion, err := client.List(ctx, resource, labelSelector)
+		if err == nil {
+			err = client.Watch(ctx, resource, resourceVersion, func(eventType string, o kubernetes.Object) {
+				select {
+				case changes <- struct{}{}:
+				default: // A change is already pending
+				}
+			})
+		}
+		if err != nil {
+			log.Warnf("[operator] watching %s: %v", resource, err)
+		}
+		// Resync after the watch ends, as changes may have been missed
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// reconcile renders the RouterConfig and its Peers and applies the config if it changed, returning the last successfully applied config
+func reconcile(ctx context.Context, client *kubernetes.Client, routerConfigName string, lastApplied []byte) ([]byte, error) {
+	routerConfigs, _, err := client.List(ctx, "routerconfigs", "")
+	if err != nil {
+		return lastApplied, err
+	}
+	var routerConfig *kubernetes.Object
+	for i := range routerConfigs {
+		if routerConfigs[i].Metadata.Name == routerConfigName {
+			routerConfig = &routerConfigs[i]
+		}
+	}
+	if routerConfig == nil {
+		return lastApplied, fmt.Errorf("RouterConfig %s not found in namespace %s", routerConfigName, client.Namespace)
+	}
+
+	peers, _, err := client.List(ctx, "peers", kubernetes.RouterLabel+"="+routerConfigName)
+	if err != nil {
+		return lastApplied, err
+	}
+
+	rendered, err := kubernetes.RenderConfig(*routerConfig, peers)
+	if err != nil {
+		return lastApplied, err
+	}
+	if bytes.Equal(rendered, lastApplied) {
+		log.Debugln("[operator] config unchanged, not applying")
+		return lastApplied, nil
+	}
+
+	c, err := config.Load(rendered)
+	if err != nil {
+		return lastApplied, fmt.Errorf("loading RouterConfig %s: %v", routerConfigName, err)
+	}
+	log.Infof("[operator] applying RouterConfig %s with %d peers", routerConfigName, len(c.Peers))
+	if err := run(c); err != nil {
+		return lastApplied, err
+	}
+	return rendered, nil // nil error
+}
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Start Kubernetes operator",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := kubernetes.InCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if operatorRouterConfig == "" {
+			operatorRouterConfig, err = os.Hostname()
+			if err != nil {
+				log.Fatalf("Unable to get system hostname: %s", err)
+			}
+		}
+		log.Infof("Starting operator for RouterConfig %s in namespace %s", operatorRouterConfig, client.Namespace)
+
+		ctx := context.Background()
+		changes := make(chan struct{}, 1)
+		go watchResource(ctx, client, "routerconfigs", "", changes)
+		go watchResource(ctx, client, "peers", kubernetes.RouterLabel+"="+operatorRouterConfig, changes)
+
+		var lastApplied []byte
+		var lastStatus kubernetes.Status
+		for range changes {
+			// Wait for related changes (such as a RouterConfig and its Peers applied together) to settle
+			time.Sleep(operatorDebounce)
+			select {
+			case <-changes:
+			default:
+			}
+
+			lastApplied, err = reconcile(ctx, client, operatorRouterConfig, lastApplied)
+			status := kubernetes.Status{Phase: "Applied"}
+			if err != nil {
+				log.Warnf("[operator] %v, keeping the last applied config", err)
+				status = kubernetes.Status{Phase: "Failed", Message: err.Error()}
+			}
+
+			// Only report changes, as each status update triggers another reconcile
+			if status != lastStatus {
+				if err := client.UpdateStatus(ctx, "routerconfigs", operatorRouterConfig, status); err != nil {
+					log.Warnf("[operator] updating RouterConfig %s status: %v", operatorRouterConfig, err)
+				} else {
+					lastStatus = status
+				}
+			}
+		}
+	},
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/natesales/pathvector/internal/kubernetes"
+)
+
+func TestReconcileFailure(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apis/pathvector.io/v1alpha1/namespaces/default/routerconfigs":
+			fmt.Fprintf(w, `{"items": [{"metadata": {"name": "edge1"}, "spec": {"asn": 65530, "router-id": "192.0.2.1", "bird-binary": "/bin/false", "cache-directory": "%s"}}]}`, dir)
+		case "/apis/pathvector.io/v1alpha1/namespaces/default/peers":
+			fmt.Fprint(w, `{"items": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// A config that fails to apply is returned as an error, keeping the last applied config
+	client := &kubernetes.Client{Host: server.URL, Token: "example", Namespace: "default"}
+	applied, err := reconcile(context.Background(), client, "edge1", []byte("previous"))
+	if err == nil || !strings.Contains(err.Error(), "BIRD config validation") {
+		t.Errorf("expected BIRD config validation error, got %+v", err)
+	}
+	if string(applied) != "previous" {
+		t.Errorf("expected the last applied config to be kept, got %s", applied)
+	}
+}
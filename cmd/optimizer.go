@@ -2,14 +2,26 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/natesales/pathvector/internal/auth"
 	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/history"
+	"github.com/natesales/pathvector/internal/logging"
 	"github.com/natesales/pathvector/internal/optimizer"
+	"github.com/natesales/pathvector/internal/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+var optimizerStatusLimit int
+
 func init() {
+	optimizerStatusCmd.Flags().IntVar(&optimizerStatusLimit, "limit", 10, "Number of recent decisions to show (all if 0)")
+	optimizerCmd.AddCommand(optimizerStatusCmd)
 	rootCmd.AddCommand(optimizerCmd)
 }
 
@@ -27,20 +39,151 @@ var optimizerCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
 
 		log.Infof("Starting optimizer")
-		sourceMap := map[string][]string{} // Peer name to list of source addresses
-		for peerName, peerData := range c.Peers {
-			if peerData.OptimizerProbeSources != nil && len(*peerData.OptimizerProbeSources) > 0 {
-				sourceMap[fmt.Sprintf("%d%s%s", *peerData.ASN, optimizer.Delimiter, peerName)] = *peerData.OptimizerProbeSources
-			}
-		}
+		sourceMap := optimizerSourceMap(c)
 		log.Debugf("Optimizer probe sources: %v", sourceMap)
 		if len(sourceMap) == 0 {
 			log.Fatal("No peers have optimization enabled, exiting now")
 		}
+		if c.History.Listen != "" || c.History.InfluxDB.URL != "" || c.History.ClickHouse.URL != "" {
+			startHistory(c)
+		}
+		if c.MetricsListen != "" {
+			log.Infof("Serving metrics on %s", c.MetricsListen)
+			go func() {
+				log.Fatal(http.ListenAndServe(c.MetricsListen, metricsHandler(c)))
+			}()
+		}
 		if err := optimizer.StartProbe(&c.Optimizer, sourceMap, c, noConfigure, dryRun); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
+
+var optimizerStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show optimizer measurements, depreferred peers and recent decisions",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+
+		status, err := optimizer.GetStatus(&c.Optimizer, optimizerSourceMap(c), c)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var peers [][]string
+		for _, p := range status.Peers {
+			since := ""
+			if p.Depreferred {
+				since = p.Since.Format(time.RFC3339)
+			}
+			peers = append(peers, []string{
+				p.Peer,
+				p.ASN,
+				"IPv" + p.Family,
+				strconv.Itoa(p.Probes),
+				p.Latency.Round(time.Microsecond).String(),
+				p.Jitter.Round(time.Microsecond).String(),
+				fmt.Sprintf("%.2f%%", p.PacketLoss),
+				strconv.FormatBool(p.Depreferred),
+				since,
+				strings.Join(p.Reasons, "\n"),
+			})
+		}
+		util.PrintTable([]string{"Peer", "ASN", "AF", "Probes", "Latency", "Jitter", "Loss", "Depreferred", "Since", "Reason"}, peers)
+
+		decisions := status.Decisions
+		if optimizerStatusLimit > 0 && len(decisions) > optimizerStatusLimit {
+			decisions = decisions[len(decisions)-optimizerStatusLimit:]
+		}
+		var history [][]string
+		for i := len(decisions) - 1; i >= 0; i-- {
+			d := decisions[i]
+			var targets []string
+			for _, t := range d.Targets {
+				targets = append(targets, t.Target)
+			}
+			history = append(history, []string{
+				d.Time.Format(time.RFC3339),
+				d.Peer,
+				d.ASN,
+				"IPv" + d.Family,
+				d.Action,
+				strconv.FormatBool(d.ReportOnly),
+				strings.Join(targets, ", "),
+			})
+		}
+		fmt.Println()
+		util.PrintTable([]string{"Time", "Peer", "ASN", "AF", "Action", "Report Only", "Targets"}, history)
+	},
+}
+
+// optimizerSourceMap returns a map of optimizer peer keys to their probe source addresses
+func optimizerSourceMap(c *config.Config) map[string][]string {
+	sourceMap := map[string][]string{} // Peer name to list of source addresses
+	for peerName, peerData := range c.Peers {
+		if peerData.OptimizerProbeSources != nil && len(*peerData.OptimizerProbeSources) > 0 {
+			sourceMap[fmt.Sprintf("%d%s%s", *peerData.ASN, optimizer.Delimiter, peerName)] = *peerData.OptimizerProbeSources
+		}
+	}
+	return sourceMap
+}
+
+// startHistory records probe results and session changes and serves the history API
+func startHistory(c *config.Config) {
+	var writers []history.Writer
+	if c.History.InfluxDB.URL != "" {
+		writers = append(writers, history.NewInfluxDB(&c.History.InfluxDB))
+	}
+	if c.History.ClickHouse.URL != "" {
+		clickhouse := history.NewClickHouse(&c.History.ClickHouse)
+		if c.History.ClickHouse.CreateTables {
+			if err := clickhouse.CreateTables(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		writers = append(writers, clickhouse)
+	}
+	store := history.New(c.History.MaxEntries, writers...)
+
+	optimizer.OnProbe = func(peerASN string, peerName string, source string, target string, result config.ProbeResult) {
+		asn, _ := strconv.Atoi(peerASN)
+		store.AddProbe(history.Probe{
+			Time:       time.Unix(0, result.Time),
+			Peer:       peerName,
+			ASN:        asn,
+			Source:     source,
+			Target:     target,
+			LatencyMs:  float64(result.Stats.AvgRtt) / float64(time.Millisecond),
+			JitterMs:   float64(result.Stats.StdDevRtt) / float64(time.Millisecond),
+			PacketLoss: result.Stats.PacketLoss,
+		})
+	}
+	go store.WatchSessions(c.BIRDSocket, time.Duration(c.History.SessionInterval)*time.Second)
+
+	if c.History.Listen != "" {
+		authenticator, err := auth.New(&c.Auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/history/", authenticator.Middleware(auth.RoleReadOnly, store))
+		log.Infof("Serving history API on %s", c.History.Listen)
+		go func() {
+			log.Fatal(http.ListenAndServe(c.History.Listen, mux))
+		}()
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/portal"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+var portalConfirm []int
+
+func init() {
+	portalRequestsCmd.Flags().IntSliceVar(&portalConfirm, "confirm", []int{}, "Request IDs to confirm for provisioning")
+	rootCmd.AddCommand(portalRequestsCmd)
+}
+
+var portalRequestsCmd = &cobra.Command{
+	Use:   "portal-requests",
+	Short: "List and confirm approved portal peering requests",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+
+		if c.PortalHost == "" {
+			log.Fatal("portal-host must be set to use portal requests")
+		}
+
+		if len(portalConfirm) > 0 {
+			if err := portal.Confirm(c.PortalProvision.StateFile, portalConfirm); err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("Confirmed %d requests, they will be provisioned on the next run", len(portalConfirm))
+		}
+
+		requests, err := portal.Requests(c.PortalHost, c.PortalKey, c.Hostname, c.PortalProvision.InsecureSkipVerify)
+		if err != nil {
+			log.Fatal(err)
+		}
+		confirmed, err := portal.Confirmed(c.PortalProvision.StateFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var data [][]string
+		for _, r := range requests {
+			status := "pending"
+			if _, exists := c.Peers[r.Name]; exists {
+				status = "configured"
+			} else if confirmed[r.ID] || !c.PortalProvision.RequireConfirmation {
+				status = "confirmed"
+			}
+			data = append(data, []string{
+				fmt.Sprintf("%d", r.ID),
+				r.Name,
+				fmt.Sprintf("%d", r.ASN),
+				strings.Join(r.NeighborIPs, ", "),
+				r.Template,
+				status,
+			})
+		}
+		util.PrintTable([]string{"ID", "Name", "ASN", "Neighbors", "Template", "Status"}, data)
+	},
+}
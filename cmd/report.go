@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/report"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+var (
+	reportFormat string
+	reportStrict bool
+)
+
+func init() {
+	reportPolicyCmd.Flags().StringVar(&reportFormat, "format", "table", "Output format (table, json, or yaml)")
+	reportPolicyCmd.Flags().BoolVar(&reportStrict, "strict", false, "Exit with an error if any enabled peer accepts or announces any route")
+	reportCmd.AddCommand(reportPolicyCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report on the configured policy",
+}
+
+var reportPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Summarize each peer's effective import and export policy and list peers without default-deny (RFC 8212) filtering",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+
+		policies := report.Build(c)
+		if reportFormat == "table" {
+			var data [][]string
+			for _, p := range policies {
+				data = append(data, []string{
+					p.Peer,
+					fmt.Sprintf("%d", p.ASN),
+					strings.Join(p.Import, ", "),
+					strings.Join(p.Export, ", "),
+					p.Status(),
+				})
+			}
+			util.PrintTable([]string{"Peer", "ASN", "Import", "Export", "Status"}, data)
+		} else {
+			out, err := report.Marshal(policies, reportFormat)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(out))
+		}
+
+		nonCompliant := 0
+		for _, p := range policies {
+			if !p.Compliant() {
+				nonCompliant++
+				log.Warnf("%s: %s", p.Peer, strings.Join(p.Findings, ", "))
+			}
+		}
+		if nonCompliant > 0 {
+			if reportStrict {
+				log.Fatalf("%d of %d peers don't have default-deny policy", nonCompliant, len(policies))
+			}
+			log.Warnf("%d of %d peers don't have default-deny policy", nonCompliant, len(policies))
+		}
+	},
+}
@@ -20,6 +20,8 @@ var (
 	verbose     bool
 	dryRun      bool
 	noConfigure bool
+	serveStale  bool
+	offline     bool
 )
 
 // CLI Commands
@@ -39,6 +41,8 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show verbose log messages")
 	rootCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "d", false, "Don't modify configuration")
 	rootCmd.PersistentFlags().BoolVarP(&noConfigure, "no-configure", "n", false, "Don't configure BIRD")
+	rootCmd.PersistentFlags().BoolVar(&serveStale, "serve-stale", false, "Use the last cached IRR prefix lists if the IRR server is unreachable")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Only use cached IRR prefix lists and PeeringDB responses, never querying IRR servers or PeeringDB")
 }
 
 func Execute(v string, c string, d string) error {
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/harness"
+)
+
+var (
+	testRuntime string
+	testImage   string
+	testKeep    bool
+)
+
+func init() {
+	testCmd.Flags().StringVar(&testRuntime, "runtime", "netns", "How to run BIRD (netns to run the local BIRD binary in network namespaces, or docker)")
+	testCmd.Flags().StringVar(&testImage, "image", "", "Docker image with BIRD for the docker runtime")
+	testCmd.Flags().BoolVar(&testKeep, "keep", false, "Keep the test directory with the rendered configs and BIRD logs")
+	rootCmd.AddCommand(testCmd)
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test [spec]",
+	Short: "Test the config in a disposable BIRD, optionally announcing routes from a test peer",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if testRuntime != "netns" && testRuntime != "docker" {
+			log.Fatalf("Unknown runtime %s (must be netns or docker)", testRuntime)
+		}
+		if testRuntime == "docker" && testImage == "" {
+			log.Fatal("The docker runtime requires --image")
+		}
+
+		// Without a spec, only check that BIRD starts with the config
+		var specBlob []byte
+		if len(args) == 1 {
+			var err error
+			specBlob, err = ioutil.ReadFile(args[0])
+			if err != nil {
+				log.Fatal("Reading test spec: " + err.Error())
+			}
+		}
+		spec, err := config.LoadTestSpec(specBlob)
+		if err != nil {
+			log.Fatalf("Test spec: %v", err)
+		}
+
+		log.Debugf("Loading config from %s", configFile)
+		configBlob, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configBlob)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+
+		dir, err := ioutil.TempDir("", "pathvector-test-")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Render into the test directory, keeping filtered routes so rejected test routes can be told apart from missing ones
+		birdDirectory := c.BIRDDirectory
+		c.CacheDirectory = path.Join(dir, "router")
+		c.LogFile = path.Join(c.CacheDirectory, "bird.log")
+		c.LogFileMaxSize = 0
+		c.KeepFiltered = true
+		if _, err := render(c); err != nil {
+			log.Fatal(err)
+		}
+
+		// Include manual config files from the running config
+		manualFiles, err := filepath.Glob(path.Join(birdDirectory, "manual*.conf"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, manualFile := range manualFiles {
+			contents, err := ioutil.ReadFile(manualFile)
+			if err != nil {
+				log.Fatalf("Reading manual config: %v", err)
+			}
+			if err := ioutil.WriteFile(path.Join(c.CacheDirectory, path.Base(manualFile)), contents, 0644); err != nil {
+				log.Fatalf("Writing manual config: %v", err)
+			}
+		}
+
+		if testRuntime == "netns" {
+			if err := bird.Check(c.BIRDBinary, c.CacheDirectory); err != nil {
+				log.Fatalf("BIRD config validation: %v", err)
+			}
+		}
+
+		results, err := harness.Run(c, spec, &harness.Options{
+			Runtime:    testRuntime,
+			BIRDBinary: c.BIRDBinary,
+			Image:      testImage,
+			Name:       fmt.Sprintf("pvt%d", os.Getpid()%100000),
+		})
+		if testKeep {
+			log.Infof("Kept test directory %s", dir)
+		} else if err := os.RemoveAll(dir); err != nil {
+			log.Warnf("Removing test directory: %v", err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Passed() {
+				log.Infof("PASS %s on %s", result.Prefix, result.Protocol)
+			} else {
+				failed++
+				log.Errorf("FAIL %s on %s: %s", result.Prefix, result.Protocol, strings.Join(result.Problems, ", "))
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("%d of %d test routes failed", failed, len(results))
+		}
+		log.Infof("All %d test routes passed", len(results))
+	},
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/auth"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/logging"
+)
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+}
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Serve web UI",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+
+		if c.WebUIFile == "" || c.WebUIListen == "" {
+			log.Fatal("web-ui-file and web-ui-listen must be set to serve the web UI")
+		}
+
+		authenticator, err := auth.New(&c.Auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !authenticator.Enabled() {
+			log.Warnf("No authentication is configured, the web UI is accessible to anyone who can reach %s", c.WebUIListen)
+		}
+
+		mux := http.NewServeMux()
+		authenticator.RegisterHandlers(mux)
+		mux.Handle("/", authenticator.Middleware(auth.RoleReadOnly, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, c.WebUIFile)
+		})))
+
+		log.Infof("Serving web UI on %s", c.WebUIListen)
+		log.Fatal(http.ListenAndServe(c.WebUIListen, mux))
+	},
+}
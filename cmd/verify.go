@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/provenance"
+	"github.com/natesales/pathvector/internal/templating"
+)
+
+var verifyMaxAge time.Duration
+
+func init() {
+	verifyCmd.Flags().DurationVar(&verifyMaxAge, "max-age", 0, "Maximum age of external data before it's reported as stale (unchecked if zero)")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the provenance of the running config",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+
+		names, err := templating.Renderers[c.Daemon].RunningFiles(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		global := names[0]
+		for _, instance := range c.VRRPInstances {
+			if instance.Implementation != "builtin" && instance.Implementation != "carp" {
+				names = append(names, c.KeepalivedConfig)
+				break
+			}
+		}
+
+		files := map[string][]byte{}
+		for _, name := range names {
+			files[name], err = ioutil.ReadFile(name)
+			if err != nil {
+				log.Fatalf("Reading running config: %v", err)
+			}
+		}
+
+		if h, err := provenance.Parse(files[global]); err == nil {
+			log.Infof("Running config generated at %s by pathvector %s from config %s", h.Generated.Format(time.RFC3339), h.Version, h.ConfigHash)
+			if h.Version != version {
+				log.Infof("Running config was generated by pathvector %s, this is %s", h.Version, version)
+			}
+		}
+
+		problems := provenance.Verify(files, c.ConfigHash, verifyMaxAge, time.Now())
+		for _, problem := range problems {
+			log.Warn(problem)
+		}
+		if len(problems) > 0 {
+			log.Fatalf("Running config failed provenance verification with %d problem(s)", len(problems))
+		}
+		log.Infof("Verified provenance of %d running config files", len(files))
+	},
+}
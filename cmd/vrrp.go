@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/logging"
+	"github.com/natesales/pathvector/internal/vrrp"
+)
+
+func init() {
+	vrrpCmd.AddCommand(vrrpNotifyCmd)
+	rootCmd.AddCommand(vrrpCmd)
+}
+
+// vrrpNotifyCommand returns the keepalived notify command that runs vrrp notify with the current binary and config file
+func vrrpNotifyCommand() string {
+	binary, err := os.Executable()
+	if err != nil {
+		binary = "pathvector"
+	}
+	file, err := filepath.Abs(configFile)
+	if err != nil {
+		file = configFile
+	}
+	return fmt.Sprintf("%s --config %s vrrp notify", binary, file)
+}
+
+// setVRRPOrigination enables or disables the BIRD protocols that originate an instance's conditional prefixes
+func setVRRPOrigination(instance *config.VRRPInstance, primary bool, birdSocket string) error {
+	if len(instance.Originate) == 0 {
+		return nil
+	}
+	action := "disable"
+	if primary {
+		action = "enable"
+	}
+	if dryRun || noConfigure {
+		log.Infof("[VRRP] Not running %s %s origination (dry run or no configure)", action, instance.ProtocolName)
+		return nil
+	}
+	resp, err := bird.RunCommand(fmt.Sprintf(`%s "%sv?"`, action, instance.ProtocolName), birdSocket)
+	if err != nil {
+		return err
+	}
+	log.Infof("[VRRP] Ran %s for %s origination: %s", action, instance.ProtocolName, strings.TrimSpace(resp))
+	return nil // nil error
+}
+
+// startVRRPRouter starts a builtin VRRP router for one address family of an instance
+func startVRRPRouter(name string, instance *config.VRRPInstance, vrid uint, vips []string, birdSocket string, stop <-chan struct{}, wg *sync.WaitGroup) error {
+	transport, addresses, err := vrrp.NewIPTransport(instance.Interface, uint8(vrid), vips)
+	if err != nil {
+		return err
+	}
+	router := vrrp.NewRouter(name, uint8(vrid), uint8(instance.Priority), time.Duration(instance.AdvertInterval)*time.Second, !instance.NoPreempt, addresses, transport)
+	router.PreemptDelay = time.Duration(instance.PreemptDelay) * time.Second
+	router.GARPRepeat = int(instance.GARPMasterRepeat)
+	router.GARPDelay = time.Duration(instance.GARPMasterDelay) * time.Second
+	router.GARPRefresh = time.Duration(instance.GARPMasterRefresh) * time.Second
+	router.OnState = func(state vrrp.State) {
+		if err := setVRRPOrigination(instance, state == vrrp.Master, birdSocket); err != nil {
+			log.Warnf("[VRRP %s] Updating origination: %v", name, err)
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		router.Run(stop)
+		if err := transport.Close(); err != nil {
+			log.Warnf("[VRRP %s] Closing transport: %v", name, err)
+		}
+	}()
+	return nil // nil error
+}
+
+var vrrpCmd = &cobra.Command{
+	Use:   "vrrp",
+	Short: "Run VRRP instances that use the builtin implementation",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Debugf("Loading config from %s", configFile)
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugln("Finished loading config")
+		if err := logging.Setup(&c.Logging); err != nil {
+			log.Fatal(err)
+		}
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		routers := 0
+		for name, instance := range c.VRRPInstances {
+			if instance.Implementation != "builtin" {
+				continue
+			}
+			// VRRPv3 runs a separate virtual router per address family (RFC 5798 section 4.1)
+			for af, vips := range map[string][]string{"v4": instance.VIPs4, "v6": instance.VIPs6} {
+				if len(vips) == 0 {
+					continue
+				}
+				vrid := instance.VRID
+				if af == "v6" && len(instance.VIPs4) > 0 {
+					vrid += instance.VRID6Offset
+				}
+				log.Infof("[VRRP %s] Starting %s virtual router %d on %s", name, af, vrid, instance.Interface)
+				if err := startVRRPRouter(name+" "+af, instance, vrid, vips, c.BIRDSocket, stop, &wg); err != nil {
+					log.Fatalf("[VRRP %s] Starting %s virtual router: %v", name, af, err)
+				}
+				routers++
+			}
+		}
+
+		if routers == 0 {
+			log.Fatal("No VRRP instances use the builtin implementation, exiting now")
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Infof("Stopping VRRP instances")
+		close(stop)
+		wg.Wait()
+	},
+}
+
+var vrrpNotifyCmd = &cobra.Command{
+	Use:   "notify <instance> <primary|backup|fault>",
+	Short: "Update conditional origination on a VRRP state change (run by keepalived)",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal("Reading config file: " + err.Error())
+		}
+		c, err := config.Load(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, instance := range c.VRRPInstances {
+			if instance.ProtocolName == args[0] {
+				if err := setVRRPOrigination(instance, args[1] == "primary", c.BIRDSocket); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
+		log.Fatalf("VRRP instance %s not found", args[0])
+	},
+}
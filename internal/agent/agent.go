@@ -0,0 +1,363 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Bundle stores a router's generated config
+type Bundle struct {
+	Router    string            `json:"router"`
+	Serial    string            `json:"serial"`
+	Generated time.Time         `json:"generated"`
+	Files     map[string][]byte `json:"files"`
+}
+
+// SignedBundle stores a JSON encoded bundle and its signature
+type SignedBundle struct {
+	Bundle    []byte `json:"bundle"`
+	Signature []byte `json:"signature"`
+}
+
+// Status stores the result of an agent applying a bundle
+type Status struct {
+	Router  string    `json:"router"`
+	Serial  string    `json:"serial"`
+	Applied bool      `json:"applied"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Serial computes a stable hash of a set of files
+func Serial(files map[string][]byte) string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(files[name]))
+		h.Write(files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign encodes and signs a bundle
+func Sign(b *Bundle, key ed25519.PrivateKey) (*SignedBundle, error) {
+	encoded, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedBundle{Bundle: encoded, Signature: ed25519.Sign(key, encoded)}, nil // nil error
+}
+
+// Verify checks a signed bundle's signature and decodes it
+func Verify(s *SignedBundle, key ed25519.PublicKey) (*Bundle, error) {
+	if !ed25519.Verify(key, s.Bundle, s.Signature) {
+		return nil, errors.New("invalid bundle signature")
+	}
+	var b Bundle
+	if err := json.Unmarshal(s.Bundle, &b); err != nil {
+		return nil, errors.New("bundle JSON unmarshal: " + err.Error())
+	}
+	if b.Serial != Serial(b.Files) {
+		return nil, errors.New("bundle serial doesn't match its files")
+	}
+	return &b, nil // nil error
+}
+
+// WriteFiles replaces the config files in a directory with the bundle's files
+func (b *Bundle) WriteFiles(dir string) error {
+	for name := range b.Files {
+		if (name != "bird.conf" && !(strings.HasPrefix(name, "AS") && strings.HasSuffix(name, ".conf"))) || strings.ContainsAny(name, "/\\") {
+			return fmt.Errorf("bundle contains unexpected file %s", name)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := util.RemoveFileGlob(path.Join(dir, "*.conf")); err != nil {
+		return err
+	}
+	for name, contents := range b.Files {
+		if err := ioutil.WriteFile(path.Join(dir, name), contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
+
+// pemBlock reads the first PEM block from a file
+func pemBlock(file string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("%s doesn't contain a PEM block", file)
+	}
+	return block.Bytes, nil // nil error
+}
+
+// LoadSigningKey loads an Ed25519 private key from a PKCS #8 PEM file
+func LoadSigningKey(file string) (ed25519.PrivateKey, error) {
+	der, err := pemBlock(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an Ed25519 key")
+	}
+	return edKey, nil // nil error
+}
+
+// LoadPublicKey loads an Ed25519 public key from a PKIX PEM file
+func LoadPublicKey(file string) (ed25519.PublicKey, error) {
+	der, err := pemBlock(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+	return edKey, nil // nil error
+}
+
+// certPool loads a CA certificate file into a pool
+func certPool(file string) (*x509.CertPool, error) {
+	ca, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil // nil error
+}
+
+// Server serves signed bundles to agents identified by their client certificate
+type Server struct {
+	// Render builds the bundle for a router
+	Render func(router string) (*Bundle, error)
+	// OnStatus is called when an agent reports a status
+	OnStatus func(Status)
+
+	key ed25519.PrivateKey
+
+	lock     sync.Mutex
+	statuses map[string]Status
+}
+
+// NewServer creates a new bundle server
+func NewServer(key ed25519.PrivateKey, render func(router string) (*Bundle, error)) *Server {
+	return &Server{Render: render, key: key, statuses: map[string]Status{}}
+}
+
+// router returns the router name from the request's client certificate
+func router(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", errors.New("no client certificate")
+	}
+	name := r.TLS.PeerCertificates[0].Subject.CommonName
+	if name == "" {
+		return "", errors.New("client certificate has no common name")
+	}
+	return name, nil // nil error
+}
+
+// Statuses returns the last status reported by each agent
+func (s *Server) Statuses() map[string]Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	out := map[string]Status{}
+	for k, v := range s.statuses {
+		out[k] = v
+	}
+	return out
+}
+
+// ServeHTTP handles bundle and status requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := router(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/bundle" && r.Method == http.MethodGet:
+		b, err := s.Render(name)
+		if err != nil {
+			log.Warnf("[agent] rendering bundle for %s: %v", name, err)
+			http.Error(w, "rendering bundle: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		signed, err := Sign(b, s.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(signed)
+	case r.URL.Path == "/v1/status" && r.Method == http.MethodPost:
+		var status Status
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			http.Error(w, "invalid status: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Agents can only report their own status
+		status.Router = name
+		s.lock.Lock()
+		s.statuses[name] = status
+		s.lock.Unlock()
+		if s.OnStatus != nil {
+			s.OnStatus(status)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ListenAndServe serves a handler over TLS, requiring client certificates signed by the client CA
+func ListenAndServe(listen string, certFile string, keyFile string, clientCAFile string, handler http.Handler) error {
+	pool, err := certPool(clientCAFile)
+	if err != nil {
+		return fmt.Errorf("loading client CA: %v", err)
+	}
+	server := &http.Server{
+		Addr:    listen,
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+// Client fetches bundles from a controller
+type Client struct {
+	controller string
+	router     string
+	publicKey  ed25519.PublicKey
+	httpClient *http.Client
+}
+
+// NewClient creates a new mTLS controller client
+func NewClient(controller string, certFile string, keyFile string, caFile string, publicKeyFile string) (*Client, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing client certificate: %v", err)
+	}
+	if leaf.Subject.CommonName == "" {
+		return nil, errors.New("client certificate has no common name")
+	}
+	pool, err := certPool(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading CA: %v", err)
+	}
+	publicKey, err := LoadPublicKey(publicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		controller: strings.TrimSuffix(controller, "/"),
+		router:     leaf.Subject.CommonName,
+		publicKey:  publicKey,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Minute, // Rendering may query PeeringDB and IRR servers
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				RootCAs:      pool,
+				MinVersion:   tls.VersionTLS12,
+			}},
+		},
+	}, nil // nil error
+}
+
+// Fetch gets and verifies the latest bundle for the client certificate's router
+func (c *Client) Fetch() (*Bundle, error) {
+	resp, err := c.httpClient.Get(c.controller + "/v1/bundle")
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("controller returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var signed SignedBundle
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return nil, errors.New("signed bundle JSON unmarshal: " + err.Error())
+	}
+	b, err := Verify(&signed, c.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	// Only apply bundles rendered for this router's identity
+	if b.Router != c.router {
+		return nil, fmt.Errorf("bundle is for router %s, not %s", b.Router, c.router)
+	}
+	return b, nil // nil error
+}
+
+// Report sends an apply status to the controller
+func (c *Client) Report(status Status) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Post(c.controller+"/v1/status", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("controller returned HTTP %d", resp.StatusCode)
+	}
+	return nil // nil error
+}
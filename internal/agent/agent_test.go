@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writePEM writes a PEM block to a file in dir
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	file := path.Join(dir, name)
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// issue creates a certificate signed by the CA and writes it and its key to dir
+func issue(t *testing.T, dir string, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, template *x509.Certificate) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, dir, name+".crt", "CERTIFICATE", der), writePEM(t, dir, name+".key", "PRIVATE KEY", keyDER)
+}
+
+func TestSignVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	files := map[string][]byte{"bird.conf": []byte("router id 192.0.2.1;\n")}
+	signed, err := Sign(&Bundle{Router: "edge1", Serial: Serial(files), Files: files}, private)
+	assert.Nil(t, err)
+
+	b, err := Verify(signed, public)
+	assert.Nil(t, err)
+	assert.Equal(t, "edge1", b.Router)
+	assert.Equal(t, files, b.Files)
+
+	// Tampered bundle
+	signed.Bundle[len(signed.Bundle)-2] ^= 1
+	_, err = Verify(signed, public)
+	assert.NotNil(t, err)
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "AS65520_Old.conf"), []byte("old"), 0644))
+
+	b := &Bundle{Files: map[string][]byte{"bird.conf": []byte("new"), "AS65510_Example.conf": []byte("peer")}}
+	assert.Nil(t, b.WriteFiles(dir))
+	files, err := filepath.Glob(path.Join(dir, "*.conf"))
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+
+	b = &Bundle{Files: map[string][]byte{"AS../../etc/passwd.conf": []byte("")}}
+	assert.NotNil(t, b.WriteFiles(dir))
+}
+
+func TestFetchAndReport(t *testing.T) {
+	dir := t.TempDir()
+
+	// Certificate authority
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pathvector test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.Nil(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	assert.Nil(t, err)
+	caFile := writePEM(t, dir, "ca.crt", "CERTIFICATE", caDER)
+
+	serverCert, serverKey := issue(t, dir, "server", ca, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "controller"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert, clientKey := issue(t, dir, "client", ca, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "edge1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	// Bundle signing key
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	assert.Nil(t, err)
+	publicFile := writePEM(t, dir, "signing.pub", "PUBLIC KEY", publicDER)
+
+	bundleRouter := ""
+	server := NewServer(private, func(router string) (*Bundle, error) {
+		files := map[string][]byte{"bird.conf": []byte("# " + router + "\n")}
+		if bundleRouter != "" {
+			router = bundleRouter
+		}
+		return &Bundle{Router: router, Serial: Serial(files), Files: files}, nil
+	})
+
+	ts := httptest.NewUnstartedServer(server)
+	pool, err := certPool(caFile)
+	assert.Nil(t, err)
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	assert.Nil(t, err)
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, clientCert, clientKey, caFile, publicFile)
+	assert.Nil(t, err)
+
+	b, err := client.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, "edge1", b.Router)
+	assert.Equal(t, "# edge1\n", string(b.Files["bird.conf"]))
+
+	// Bundles for another router are rejected
+	bundleRouter = "edge2"
+	_, err = client.Fetch()
+	assert.NotNil(t, err)
+	bundleRouter = ""
+
+	// The reported router name comes from the client certificate
+	assert.Nil(t, client.Report(Status{Router: "edge2", Serial: b.Serial, Applied: true}))
+	statuses := server.Statuses()
+	assert.True(t, statuses["edge1"].Applied)
+	assert.NotContains(t, statuses, "edge2")
+}
@@ -0,0 +1,366 @@
+// Package api serves a local HTTP and gRPC API to trigger config runs, query peer status, fetch the rendered BIRD config, and enable or disable peers
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/auth"
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+// duplicateSuffixRegex matches the suffix added to a protocol name when a peer has more than one neighbor per address family
+var duplicateSuffixRegex = regexp.MustCompile(`^_\d+$`)
+
+// RunFunc loads a config (the router's config file if configBlob is nil) and runs a single generate cycle, only rendering and validating if dryRun is set.
+// It returns the loaded config (nil if it couldn't be loaded).
+type RunFunc func(configBlob []byte, dryRun bool) (*config.Config, error)
+
+// API errors
+var (
+	errRunInProgress = errors.New("a run is already in progress")
+	errPeerNotFound  = errors.New("peer not found")
+)
+
+// Run stores the outcome of a config run
+type Run struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Peer stores a peer's config and the state of its BIRD protocols
+type Peer struct {
+	Name        string            `json:"name"`
+	ASN         int               `json:"asn"`
+	Description string            `json:"description"`
+	Disabled    bool              `json:"disabled"` // Disabled in the config
+	Protocols   []*birdc.Protocol `json:"protocols"`
+}
+
+// Server serves the control API
+type Server struct {
+	lock        sync.Mutex
+	c           *config.Config
+	run         RunFunc
+	running     bool
+	lastRun     *Run
+	noConfigure bool
+}
+
+// New creates a new API server for a loaded config, triggering runs with run and only logging enable and disable commands if noConfigure is set
+func New(c *config.Config, run RunFunc, noConfigure bool) *Server {
+	return &Server{c: c, run: run, noConfigure: noConfigure}
+}
+
+// config returns the most recently loaded config
+func (s *Server) config() *config.Config {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.c
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// isPeerProtocol checks if a BIRD protocol name belongs to a peer, matching the family protocol names and their numbered duplicates
+func isPeerProtocol(peer *config.Peer, name string) bool {
+	if peer.Protocols != nil && len(*peer.Protocols) > 0 {
+		return util.Contains(*peer.Protocols, name)
+	}
+	for _, af := range []string{"4", "6"} {
+		base := peer.FamilyProtocolName(af)
+		if name == base || (strings.HasPrefix(name, base) && duplicateSuffixRegex.MatchString(name[len(base):])) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerStatus builds a peer's status from the output of show protocols all
+func peerStatus(name string, peer *config.Peer, protocols map[string]*birdc.Protocol) *Peer {
+	p := &Peer{
+		Name:        name,
+		ASN:         *peer.ASN,
+		Description: util.StrDeref(peer.Description),
+		Disabled:    peer.Disabled != nil && *peer.Disabled,
+		Protocols:   []*birdc.Protocol{},
+	}
+	var names []string
+	for protocolName := range protocols {
+		if isPeerProtocol(peer, protocolName) {
+			names = append(names, protocolName)
+		}
+	}
+	sort.Strings(names)
+	for _, protocolName := range names {
+		p.Protocols = append(p.Protocols, protocols[protocolName])
+	}
+	return p
+}
+
+// peers returns the status of all peers sorted by name, or of a single peer if name isn't empty
+func (s *Server) peers(name string) ([]*Peer, error) {
+	c := s.config()
+	if name != "" && c.Peers[name] == nil {
+		return nil, errPeerNotFound
+	}
+	out, err := bird.RunCommand("show protocols all", c.BIRDSocket)
+	if err != nil {
+		return nil, fmt.Errorf("querying BIRD: %v", err)
+	}
+	protocols := birdc.ParseProtocols(out)
+
+	if name != "" {
+		return []*Peer{peerStatus(name, c.Peers[name], protocols)}, nil
+	}
+	var names []string
+	for peerName := range c.Peers {
+		names = append(names, peerName)
+	}
+	sort.Strings(names)
+	peers := []*Peer{}
+	for _, peerName := range names {
+		peers = append(peers, peerStatus(peerName, c.Peers[peerName], protocols))
+	}
+	return peers, nil // nil error
+}
+
+// handlePeers serves the status of all peers, or a single peer if name isn't empty
+func (s *Server) handlePeers(w http.ResponseWriter, name string) {
+	peers, err := s.peers(name)
+	if err == errPeerNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if name != "" {
+		writeJSON(w, http.StatusOK, peers[0])
+		return
+	}
+	writeJSON(w, http.StatusOK, peers)
+}
+
+// handlePeerAction enables or disables a peer's BIRD protocols until the next reconfiguration that changes them
+func (s *Server) handlePeerAction(w http.ResponseWriter, r *http.Request, name string, action string) {
+	c := s.config()
+	peer := c.Peers[name]
+	if peer == nil {
+		http.Error(w, "peer not found", http.StatusNotFound)
+		return
+	}
+	out, err := bird.RunCommand("show protocols", c.BIRDSocket)
+	if err != nil {
+		http.Error(w, "querying BIRD: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	status := peerStatus(name, peer, birdc.ParseProtocols(out))
+	if len(status.Protocols) == 0 {
+		http.Error(w, "peer has no BIRD protocols", http.StatusNotFound)
+		return
+	}
+
+	identity := "anonymous"
+	if id := auth.FromContext(r.Context()); id != nil {
+		identity = id.Name
+	}
+	replies := map[string]string{}
+	for _, protocol := range status.Protocols {
+		if s.noConfigure {
+			log.Infof("[api] Not running %s %s for %s (no configure)", action, protocol.Name, identity)
+			replies[protocol.Name] = "not run (no configure)"
+			continue
+		}
+		resp, err := bird.RunCommand(fmt.Sprintf(`%s "%s"`, action, protocol.Name), c.BIRDSocket)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("running %s %s: %v", action, protocol.Name, err), http.StatusBadGateway)
+			return
+		}
+		log.Infof("[api] %s ran %s %s: %s", identity, action, protocol.Name, strings.TrimSpace(resp))
+		replies[protocol.Name] = strings.TrimSpace(resp)
+	}
+	writeJSON(w, http.StatusOK, replies)
+}
+
+// lockRun marks a run as in progress, returning errRunInProgress if one already is
+func (s *Server) lockRun() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running {
+		return errRunInProgress
+	}
+	s.running = true
+	return nil // nil error
+}
+
+// runConfig runs a config (the router's config file if configBlob is nil) synchronously, returning errRunInProgress if a run is already in progress.
+// Dry runs don't replace the loaded config.
+func (s *Server) runConfig(configBlob []byte, dryRun bool) (*Run, error) {
+	if err := s.lockRun(); err != nil {
+		return nil, err
+	}
+
+	result := &Run{Start: time.Now()}
+	c, err := s.run(configBlob, dryRun)
+	result.End = time.Now()
+	if err != nil {
+		log.Warnf("[api] run failed: %v", err)
+		result.Error = err.Error()
+	}
+
+	s.lock.Lock()
+	if c != nil && !dryRun {
+		s.c = c
+	}
+	s.running = false
+	s.lastRun = result
+	s.lock.Unlock()
+	return result, nil // nil error
+}
+
+// reload reconfigures BIRD with the applied config and returns its reply, returning errRunInProgress if a run is in progress
+func (s *Server) reload() (string, error) {
+	c := s.config()
+	if c.Daemon != "bird" {
+		return "", fmt.Errorf("reloading %s isn't supported", c.Daemon)
+	}
+	if s.noConfigure {
+		log.Infof("[api] Not running configure (no configure)")
+		return "not run (no configure)", nil
+	}
+	if err := s.lockRun(); err != nil {
+		return "", err
+	}
+	defer func() {
+		s.lock.Lock()
+		s.running = false
+		s.lock.Unlock()
+	}()
+	resp, err := bird.RunCommand("configure", c.BIRDSocket)
+	if err != nil {
+		return "", fmt.Errorf("reconfiguring BIRD: %v", err)
+	}
+	return strings.TrimSpace(resp), nil // nil error
+}
+
+// handleRun runs the config synchronously, rejecting the request if a run is already in progress
+func (s *Server) handleRun(w http.ResponseWriter) {
+	result, err := s.runConfig(nil, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	code := http.StatusOK
+	if result.Error != "" {
+		code = http.StatusInternalServerError
+	}
+	writeJSON(w, code, result)
+}
+
+// handleLastRun serves the outcome of the most recent run
+func (s *Server) handleLastRun(w http.ResponseWriter) {
+	s.lock.Lock()
+	lastRun := s.lastRun
+	s.lock.Unlock()
+	if lastRun == nil {
+		http.Error(w, "no runs since the API started", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, lastRun)
+}
+
+// handleConfig serves the applied global BIRD config, or a peer's config if the peer query parameter is set
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	c := s.config()
+	file := "bird.conf"
+	if name := r.URL.Query().Get("peer"); name != "" {
+		peer := c.Peers[name]
+		if peer == nil {
+			http.Error(w, "peer not found", http.StatusNotFound)
+			return
+		}
+		file = fmt.Sprintf("AS%d_%s.conf", *peer.ASN, *util.Sanitize(name))
+	}
+	contents, err := ioutil.ReadFile(path.Join(c.BIRDDirectory, file))
+	if err != nil {
+		http.Error(w, "reading config: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(contents)
+}
+
+// ServeHTTP serves the API routes
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+	parts := strings.Split(route, "/")
+	switch {
+	case route == "run" && r.Method == http.MethodPost:
+		s.handleRun(w)
+	case route == "run" && r.Method == http.MethodGet:
+		s.handleLastRun(w)
+	case route == "config" && r.Method == http.MethodGet:
+		s.handleConfig(w, r)
+	case route == "peers" && r.Method == http.MethodGet:
+		s.handlePeers(w, "")
+	case len(parts) == 2 && parts[0] == "peers" && r.Method == http.MethodGet:
+		s.handlePeers(w, parts[1])
+	case len(parts) == 3 && parts[0] == "peers" && (parts[2] == "enable" || parts[2] == "disable") && r.Method == http.MethodPost:
+		s.handlePeerAction(w, r, parts[1], parts[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Handler returns the API handler, requiring the read-only role for GET requests and the operator role for all others
+func (s *Server) Handler(a *auth.Authenticator) http.Handler {
+	readOnly := a.Middleware(auth.RoleReadOnly, s)
+	operator := a.Middleware(auth.RoleOperator, s)
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			readOnly.ServeHTTP(w, r)
+		} else {
+			operator.ServeHTTP(w, r)
+		}
+	}))
+	return mux
+}
+
+// ListenUnix listens on a UNIX socket, replacing a stale socket file and restricting access to the owner and group
+func ListenUnix(socket string) (net.Listener, error) {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("removing old API socket: %v", err)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listening on API socket: %v", err)
+	}
+	if err := os.Chmod(socket, 0660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("setting API socket permissions: %v", err)
+	}
+	return l, nil // nil error
+}
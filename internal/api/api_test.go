@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/auth"
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// fakeBIRD serves a fake BIRD control socket, replying to commands from replies
+func fakeBIRD(t *testing.T, replies map[string]string) string {
+	socket := path.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := conn.Write([]byte("0001 BIRD 2.0.8 ready.\n")); err != nil {
+					return
+				}
+				reader := bufio.NewReader(conn)
+				for {
+					command, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					reply, found := replies[strings.TrimSpace(command)]
+					if !found {
+						reply = "9001 syntax error\n"
+					}
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return socket
+}
+
+const protocols = `2002-Name       Proto      Table      State  Since         Info
+1002-EXAMPLEv4  BGP        ---        up     2021-06-11 02:00:00  Established
+1002-EXAMPLEv4_1  BGP        ---        up     2021-06-11 02:00:00  Established
+1002-EXAMPLEv6  BGP        ---        start  2021-06-11 02:00:00  Active
+1002-EXAMPLE_2v4  BGP        ---        up     2021-06-11 02:00:00  Established
+0000
+`
+
+func testConfig(t *testing.T) *config.Config {
+	c, err := config.Load([]byte(`
+asn: 65510
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2, 192.0.2.3, 2001:db8::2]
+  Example 2:
+    asn: 65531
+    neighbors: [192.0.2.4]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BIRDDirectory = t.TempDir()
+	c.BIRDSocket = fakeBIRD(t, map[string]string{
+		"show protocols":        protocols,
+		"show protocols all":    protocols,
+		`disable "EXAMPLEv4"`:   "0009 EXAMPLEv4: disabled\n",
+		`disable "EXAMPLEv4_1"`: "0009 EXAMPLEv4_1: disabled\n",
+		`disable "EXAMPLEv6"`:   "0009 EXAMPLEv6: disabled\n",
+		`enable "EXAMPLE_2v4"`:  "0011 EXAMPLE_2v4: enabled\n",
+		"configure":             "0003 Reconfigured\n",
+	})
+	return c
+}
+
+func request(h http.Handler, method string, target string, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPeers(t *testing.T) {
+	s := New(testConfig(t), nil, false)
+
+	rec := request(s, http.MethodGet, "/api/peers", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var peers []*Peer
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&peers))
+	assert.Len(t, peers, 2)
+	assert.Equal(t, "Example", peers[0].Name)
+	assert.Equal(t, 65530, peers[0].ASN)
+	assert.Len(t, peers[0].Protocols, 3)
+	assert.Equal(t, "EXAMPLEv4_1", peers[0].Protocols[1].Name)
+	assert.Len(t, peers[1].Protocols, 1)
+
+	rec = request(s, http.MethodGet, "/api/peers/Example%202", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var peer Peer
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&peer))
+	assert.Equal(t, "up", peer.Protocols[0].State)
+
+	assert.Equal(t, http.StatusNotFound, request(s, http.MethodGet, "/api/peers/Missing", "").Code)
+}
+
+func TestPeerAction(t *testing.T) {
+	s := New(testConfig(t), nil, false)
+	rec := request(s, http.MethodPost, "/api/peers/Example/disable", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var replies map[string]string
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&replies))
+	assert.Equal(t, map[string]string{
+		"EXAMPLEv4":   "0009 EXAMPLEv4: disabled",
+		"EXAMPLEv4_1": "0009 EXAMPLEv4_1: disabled",
+		"EXAMPLEv6":   "0009 EXAMPLEv6: disabled",
+	}, replies)
+
+	// BIRD isn't configured with no configure
+	s.noConfigure = true
+	rec = request(s, http.MethodPost, "/api/peers/Example%202/enable", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "not run")
+}
+
+func TestRun(t *testing.T) {
+	c := testConfig(t)
+	runs := 0
+	s := New(c, func([]byte, bool) (*config.Config, error) {
+		runs++
+		if runs > 1 {
+			return c, errors.New("IRR query failed")
+		}
+		return c, nil
+	}, false)
+
+	assert.Equal(t, http.StatusNotFound, request(s, http.MethodGet, "/api/run", "").Code)
+	assert.Equal(t, http.StatusOK, request(s, http.MethodPost, "/api/run", "").Code)
+	rec := request(s, http.MethodPost, "/api/run", "")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "IRR query failed")
+
+	rec = request(s, http.MethodGet, "/api/run", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var run Run
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&run))
+	assert.Equal(t, "IRR query failed", run.Error)
+}
+
+func TestConfig(t *testing.T) {
+	c := testConfig(t)
+	assert.Nil(t, ioutil.WriteFile(path.Join(c.BIRDDirectory, "bird.conf"), []byte("router id 192.0.2.1;\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(path.Join(c.BIRDDirectory, "AS65531_EXAMPLE_2.conf"), []byte("protocol bgp EXAMPLE_2v4 {}\n"), 0644))
+	s := New(c, nil, false)
+
+	rec := request(s, http.MethodGet, "/api/config", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "router id 192.0.2.1;\n", rec.Body.String())
+	rec = request(s, http.MethodGet, "/api/config?peer=Example+2", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "EXAMPLE_2v4")
+	assert.Equal(t, http.StatusNotFound, request(s, http.MethodGet, "/api/config?peer=Example", "").Code)
+}
+
+func TestHandlerAuth(t *testing.T) {
+	c := testConfig(t)
+	c.Auth.Tokens = map[string]*config.AuthToken{
+		"monitoring": {Token: "read", Role: auth.RoleReadOnly},
+		"automation": {Token: "write", Role: auth.RoleOperator},
+	}
+	a, err := auth.New(&c.Auth)
+	assert.Nil(t, err)
+	h := New(c, func([]byte, bool) (*config.Config, error) { return c, nil }, false).Handler(a)
+
+	assert.Equal(t, http.StatusUnauthorized, request(h, http.MethodGet, "/api/peers", "").Code)
+	assert.Equal(t, http.StatusOK, request(h, http.MethodGet, "/api/peers", "read").Code)
+	assert.Equal(t, http.StatusForbidden, request(h, http.MethodPost, "/api/run", "read").Code)
+	assert.Equal(t, http.StatusOK, request(h, http.MethodPost, "/api/run", "write").Code)
+}
+
+func TestListenUnix(t *testing.T) {
+	socket := path.Join(t.TempDir(), "api.sock")
+	assert.Nil(t, ioutil.WriteFile(socket, nil, 0644))
+	l, err := ListenUnix(socket)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	s := New(testConfig(t), nil, false)
+	go func() {
+		_ = http.Serve(l, s)
+	}()
+	client := http.Client{Transport: &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://unix/api/peers")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/natesales/pathvector/internal/auth"
+	"github.com/natesales/pathvector/proto"
+)
+
+// grpcOperatorMethods are the gRPC methods that require the operator role, all others require the read-only role
+var grpcOperatorMethods = map[string]bool{
+	"/pathvector.v1.Pathvector/ApplyConfig":  true,
+	"/pathvector.v1.Pathvector/ReloadDaemon": true,
+}
+
+// grpcService implements the Pathvector gRPC service on top of the API server
+type grpcService struct {
+	pathvector.UnimplementedPathvectorServer
+	s *Server
+}
+
+// identityStream overrides the context of a server stream to hold the authenticated identity
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context holding the authenticated identity
+func (i *identityStream) Context() context.Context {
+	return i.ctx
+}
+
+// authorize authenticates a gRPC call from its authorization metadata, returning a context holding the identity
+func authorize(ctx context.Context, a *auth.Authenticator, method string) (context.Context, error) {
+	r := &http.Request{Header: http.Header{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			r.Header.Add("Authorization", value)
+		}
+	}
+	role := auth.RoleReadOnly
+	if grpcOperatorMethods[method] {
+		role = auth.RoleOperator
+	}
+	identity, err := a.Authorize(r, role, method)
+	if err == auth.ErrUnauthorized {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	} else if err == auth.ErrForbidden {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if identity != nil {
+		ctx = auth.NewContext(ctx, identity)
+	}
+	return ctx, nil // nil error
+}
+
+// GRPCServer returns a gRPC server for the Pathvector service, with the same authentication, roles, and run lock as the HTTP API
+func (s *Server) GRPCServer(a *auth.Authenticator) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authorize(ctx, a, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authorize(ss.Context(), a, info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+	pathvector.RegisterPathvectorServer(server, &grpcService{s: s})
+	reflection.Register(server)
+	return server
+}
+
+// identityName returns the name of the authenticated identity of a call
+func identityName(ctx context.Context) string {
+	if id := auth.FromContext(ctx); id != nil {
+		return id.Name
+	}
+	return "anonymous"
+}
+
+// ApplyConfig runs a config from the request, or the router's config file if the request config is empty
+func (g *grpcService) ApplyConfig(ctx context.Context, req *pathvector.ApplyConfigRequest) (*pathvector.ApplyConfigResponse, error) {
+	var configBlob []byte
+	if len(req.Config) > 0 {
+		configBlob = req.Config
+	}
+	log.Infof("[api] %s applying config (dry run: %v)", identityName(ctx), req.DryRun)
+	result, err := g.s.runConfig(configBlob, req.DryRun)
+	if err != nil {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return &pathvector.ApplyConfigResponse{Start: result.Start.Unix(), End: result.End.Unix(), Error: result.Error}, nil
+}
+
+// peerStatusMessage converts a peer's status to a gRPC message
+func peerStatusMessage(p *Peer) *pathvector.PeerStatus {
+	message := &pathvector.PeerStatus{Name: p.Name, Asn: uint32(p.ASN), Description: p.Description, Disabled: p.Disabled}
+	for _, protocol := range p.Protocols {
+		m := &pathvector.Protocol{
+			Name:            protocol.Name,
+			State:           protocol.State,
+			Since:           protocol.Since,
+			Info:            protocol.Info,
+			BgpState:        protocol.BGPState,
+			NeighborAddress: protocol.NeighborAddress,
+			LastError:       protocol.LastError,
+		}
+		for _, channel := range protocol.Channels {
+			m.Channels = append(m.Channels, &pathvector.Channel{
+				Name:      channel.Name,
+				State:     channel.State,
+				Imported:  uint32(channel.Routes.Imported),
+				Filtered:  uint32(channel.Routes.Filtered),
+				Exported:  uint32(channel.Routes.Exported),
+				Preferred: uint32(channel.Routes.Preferred),
+			})
+		}
+		message.Protocols = append(message.Protocols, m)
+	}
+	return message
+}
+
+// GetPeerStatus streams the status of a peer, or all peers if the request peer is empty, every interval
+func (g *grpcService) GetPeerStatus(req *pathvector.GetPeerStatusRequest, stream pathvector.Pathvector_GetPeerStatusServer) error {
+	for {
+		peers, err := g.s.peers(req.Peer)
+		if err == errPeerNotFound {
+			return status.Error(codes.NotFound, err.Error())
+		} else if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		for _, p := range peers {
+			if err := stream.Send(peerStatusMessage(p)); err != nil {
+				return err
+			}
+		}
+
+		if req.IntervalSeconds == 0 {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-time.After(time.Duration(req.IntervalSeconds) * time.Second):
+		}
+	}
+}
+
+// ReloadDaemon reconfigures the routing daemon with the applied config
+func (g *grpcService) ReloadDaemon(ctx context.Context, req *pathvector.ReloadDaemonRequest) (*pathvector.ReloadDaemonResponse, error) {
+	reply, err := g.s.reload()
+	if err == errRunInProgress {
+		return nil, status.Error(codes.Aborted, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	log.Infof("[api] %s reloaded the routing daemon: %s", identityName(ctx), reply)
+	return &pathvector.ReloadDaemonResponse{Reply: reply}, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/natesales/pathvector/internal/auth"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/proto"
+)
+
+// grpcClient serves s over an in-memory connection and returns a client for it
+func grpcClient(t *testing.T, s *Server, a *auth.Authenticator) pathvector.PathvectorClient {
+	l := bufconn.Listen(1024 * 1024)
+	server := s.GRPCServer(a)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return l.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pathvector.NewPathvectorClient(conn)
+}
+
+// withToken returns a context sending token as a bearer token
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPC(t *testing.T) {
+	c := testConfig(t)
+	c.Auth.Tokens = map[string]*config.AuthToken{
+		"monitoring": {Token: "read", Role: auth.RoleReadOnly},
+		"automation": {Token: "write", Role: auth.RoleOperator},
+	}
+	a, err := auth.New(&c.Auth)
+	assert.Nil(t, err)
+	var dryRuns []bool
+	client := grpcClient(t, New(c, func(configBlob []byte, dryRun bool) (*config.Config, error) {
+		dryRuns = append(dryRuns, dryRun)
+		if string(configBlob) == "invalid" {
+			return nil, errors.New("invalid config")
+		}
+		return c, nil
+	}, false), a)
+
+	// Authentication and roles
+	_, err = client.ReloadDaemon(context.Background(), &pathvector.ReloadDaemonRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ReloadDaemon(withToken("invalid"), &pathvector.ReloadDaemonRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ApplyConfig(withToken("read"), &pathvector.ApplyConfigRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	stream, err := client.GetPeerStatus(context.Background(), &pathvector.GetPeerStatusRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// ApplyConfig
+	resp, err := client.ApplyConfig(withToken("write"), &pathvector.ApplyConfigRequest{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "", resp.Error)
+	resp, err = client.ApplyConfig(withToken("write"), &pathvector.ApplyConfigRequest{Config: []byte("invalid")})
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid config", resp.Error)
+	assert.Equal(t, []bool{true, false}, dryRuns)
+
+	// GetPeerStatus
+	stream, err = client.GetPeerStatus(withToken("read"), &pathvector.GetPeerStatusRequest{Peer: "Example"})
+	assert.Nil(t, err)
+	peer, err := stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, "Example", peer.Name)
+	assert.Equal(t, uint32(65530), peer.Asn)
+	assert.Len(t, peer.Protocols, 3)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	stream, err = client.GetPeerStatus(withToken("read"), &pathvector.GetPeerStatusRequest{Peer: "Unknown"})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// ReloadDaemon
+	reload, err := client.ReloadDaemon(withToken("write"), &pathvector.ReloadDaemonRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "0003 Reconfigured", reload.Reply)
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// Roles
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+)
+
+// sessionCookie is the name of the cookie that holds a signed OIDC login session
+const sessionCookie = "pathvector_session"
+
+// sessionLifetime is how long an OIDC login session is valid for
+const sessionLifetime = 12 * time.Hour
+
+type contextKey string
+
+// identityKey is the request context key of the authenticated Identity
+const identityKey contextKey = "identity"
+
+// Authorization errors
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Identity stores an authenticated principal
+type Identity struct {
+	Name string
+	Role string
+}
+
+// Authenticator authenticates HTTP requests against the configured users, tokens, and OIDC provider
+type Authenticator struct {
+	c          *config.Auth
+	sessionKey []byte
+	oidc       *oidcProvider
+}
+
+// New creates a new Authenticator from an auth config
+func New(c *config.Auth) (*Authenticator, error) {
+	a := &Authenticator{c: c}
+
+	if c.SessionKey != "" {
+		a.sessionKey = []byte(c.SessionKey)
+	} else {
+		a.sessionKey = make([]byte, 32)
+		if _, err := rand.Read(a.sessionKey); err != nil {
+			return nil, fmt.Errorf("generating session key: %v", err)
+		}
+	}
+
+	if c.OIDC.Issuer != "" {
+		var err error
+		a.oidc, err = newOIDCProvider(&c.OIDC)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil // nil error
+}
+
+// Enabled returns true if any authentication method is configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.c.Users) > 0 || len(a.c.Tokens) > 0 || a.oidc != nil
+}
+
+// authenticate returns the identity of a request, or nil if the request isn't authenticated
+func (a *Authenticator) authenticate(r *http.Request) *Identity {
+	// Bearer token
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		provided := strings.TrimPrefix(header, "Bearer ")
+		if provided == "" {
+			return nil
+		}
+		for name, token := range a.c.Tokens {
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token.Token)) == 1 {
+				return &Identity{Name: "token:" + name, Role: token.Role}
+			}
+		}
+		return nil
+	}
+
+	// HTTP basic auth
+	if username, password, ok := r.BasicAuth(); ok {
+		user, found := a.c.Users[username]
+		if !found {
+			return nil
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+			return nil
+		}
+		return &Identity{Name: username, Role: user.Role}
+	}
+
+	// OIDC session cookie
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return a.verifySession(cookie.Value)
+	}
+
+	return nil
+}
+
+// Authorize authenticates a request and checks that its identity has at least the given role, returning a nil identity if authentication is disabled.
+// action describes the request in the log message when access is denied.
+func (a *Authenticator) Authorize(r *http.Request, role string, action string) (*Identity, error) {
+	if !a.Enabled() {
+		return nil, nil
+	}
+	identity := a.authenticate(r)
+	if identity == nil {
+		return nil, ErrUnauthorized
+	}
+	if role == RoleOperator && identity.Role != RoleOperator {
+		log.Warnf("[auth] %s (%s) denied access to %s", identity.Name, identity.Role, action)
+		return nil, ErrForbidden
+	}
+	return identity, nil // nil error
+}
+
+// Middleware wraps a handler to require an identity with at least the given role
+func (a *Authenticator) Middleware(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.Authorize(r, role, r.Method+" "+r.URL.Path)
+		if err == ErrUnauthorized {
+			if a.oidc != nil && r.Header.Get("Authorization") == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/auth/login", http.StatusFound)
+				return
+			}
+			if len(a.c.Users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="pathvector"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		} else if err == ErrForbidden {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if identity == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), identity)))
+	})
+}
+
+// NewContext returns a copy of ctx holding an authenticated identity
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// FromContext returns the authenticated identity of a request, or nil if authentication is disabled
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey).(*Identity)
+	return identity
+}
+
+// RegisterHandlers adds the OIDC login and callback handlers to a mux
+func (a *Authenticator) RegisterHandlers(mux *http.ServeMux) {
+	if a.oidc == nil {
+		return
+	}
+	mux.HandleFunc("/auth/login", a.handleLogin)
+	mux.HandleFunc("/auth/callback", a.handleCallback)
+	mux.HandleFunc("/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleLogin redirects the client to the OIDC provider
+func (a *Authenticator) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state := a.sign("state", strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10))
+	http.SetCookie(w, &http.Cookie{Name: "pathvector_state", Value: state, Path: "/auth", HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, a.oidc.authURL(state), http.StatusFound)
+}
+
+// handleCallback exchanges an authorization code for an ID token and starts a session
+func (a *Authenticator) handleCallback(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie("pathvector_state")
+	if err != nil || stateCookie.Value != r.URL.Query().Get("state") || a.verify("state", stateCookie.Value) == "" {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := a.oidc.exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		log.Warnf("[auth] OIDC callback: %v", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+
+	identity := &Identity{Name: claims.subject(), Role: RoleReadOnly}
+	for _, group := range claims.groups(a.c.OIDC.RoleClaim) {
+		for _, operatorGroup := range a.c.OIDC.OperatorGroups {
+			if group == operatorGroup {
+				identity.Role = RoleOperator
+			}
+		}
+	}
+	log.Infof("[auth] OIDC login from %s (%s)", identity.Name, identity.Role)
+
+	expiry := strconv.FormatInt(time.Now().Add(sessionLifetime).Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    a.sign("session", strings.Join([]string{identity.Name, identity.Role, expiry}, "|")),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// sign returns a payload with an appended HMAC signature for the given purpose
+func (a *Authenticator) sign(purpose string, payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write([]byte(purpose + "." + encoded))
+	return encoded + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a signed value and returns the payload, or an empty string if invalid or expired
+func (a *Authenticator) verify(purpose string, value string) string {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write([]byte(purpose + "." + parts[0]))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(parts[1])) != 1 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ""
+	}
+
+	// The expiry is always the final element of the payload
+	fields := strings.Split(string(payload), "|")
+	expiry, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return ""
+	}
+	return string(payload)
+}
+
+// verifySession returns the identity stored in a session cookie
+func (a *Authenticator) verifySession(value string) *Identity {
+	payload := a.verify("session", value)
+	if payload == "" {
+		return nil
+	}
+	fields := strings.Split(payload, "|")
+	if len(fields) != 3 {
+		return nil
+	}
+	return &Identity{Name: fields[0], Role: fields[1]}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestMiddleware(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(&config.Auth{
+		Users: map[string]*config.AuthUser{
+			"viewer": {Password: string(hash), Role: RoleReadOnly},
+			"admin":  {Password: string(hash), Role: RoleOperator},
+		},
+		Tokens: map[string]*config.AuthToken{
+			"automation": {Token: "example-token", Role: RoleOperator},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		role     string
+		user     string
+		password string
+		token    string
+		expected int
+	}{
+		{RoleReadOnly, "", "", "", http.StatusUnauthorized},
+		{RoleReadOnly, "viewer", "secret", "", http.StatusOK},
+		{RoleReadOnly, "viewer", "wrong", "", http.StatusUnauthorized},
+		{RoleOperator, "viewer", "secret", "", http.StatusForbidden},
+		{RoleOperator, "admin", "secret", "", http.StatusOK},
+		{RoleOperator, "", "", "example-token", http.StatusOK},
+		{RoleOperator, "", "", "wrong-token", http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.user != "" {
+			req.SetBasicAuth(tc.user, tc.password)
+		}
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		a.Middleware(tc.role, ok).ServeHTTP(rec, req)
+		if rec.Code != tc.expected {
+			t.Errorf("role %s user %s token %s: expected HTTP %d got %d", tc.role, tc.user, tc.token, tc.expected, rec.Code)
+		}
+	}
+
+	// An empty bearer token never matches, even against a token without a value
+	a.c.Tokens["empty"] = &config.AuthToken{Role: RoleOperator}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	a.Middleware(RoleOperator, ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("empty bearer token: expected HTTP %d got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestSession(t *testing.T) {
+	a, err := New(&config.Auth{SessionKey: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := a.sign("session", "user|operator|99999999999")
+	identity := a.verifySession(signed)
+	if identity == nil || identity.Name != "user" || identity.Role != RoleOperator {
+		t.Errorf("expected valid operator session, got %+v", identity)
+	}
+	if a.verifySession(signed+"0") != nil {
+		t.Errorf("expected tampered session to be rejected")
+	}
+	if a.verifySession(a.sign("session", "user|operator|1")) != nil {
+		t.Errorf("expected expired session to be rejected")
+	}
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// oidcDiscovery stores the relevant fields of an OIDC discovery document
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// jsonWebKey stores a single RSA JSON web key
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// idTokenClaims stores the decoded claims of an ID token
+type idTokenClaims map[string]interface{}
+
+// oidcProvider stores a discovered OIDC provider
+type oidcProvider struct {
+	c          *config.OIDC
+	discovery  oidcDiscovery
+	httpClient *http.Client
+}
+
+// newOIDCProvider fetches the discovery document for an issuer
+func newOIDCProvider(c *config.OIDC) (*oidcProvider, error) {
+	p := &oidcProvider{c: c, httpClient: &http.Client{Timeout: 10 * time.Second}}
+	if err := p.getJSON(strings.TrimSuffix(c.Issuer, "/")+"/.well-known/openid-configuration", &p.discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %v", err)
+	}
+	if strings.TrimSuffix(p.discovery.Issuer, "/") != strings.TrimSuffix(c.Issuer, "/") {
+		return nil, fmt.Errorf("OIDC discovery: issuer mismatch, expected %s got %s", c.Issuer, p.discovery.Issuer)
+	}
+	return p, nil // nil error
+}
+
+// getJSON GETs a URL and decodes the JSON response into v
+func (p *oidcProvider) getJSON(u string, v interface{}) error {
+	resp, err := p.httpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: HTTP %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// authURL returns the authorization endpoint URL to redirect a client to
+func (p *oidcProvider) authURL(state string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.c.ClientID)
+	v.Set("redirect_uri", p.c.RedirectURL)
+	v.Set("scope", "openid profile email "+p.c.RoleClaim)
+	v.Set("state", state)
+	sep := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// exchange exchanges an authorization code for a verified set of ID token claims
+func (p *oidcProvider) exchange(ctx context.Context, code string) (idTokenClaims, error) {
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.c.RedirectURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.c.ClientID), url.QueryEscape(p.c.ClientSecret))
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned HTTP %d: %s", resp.StatusCode, body)
+	}
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("token response JSON unmarshal: %v", err)
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("token response doesn't contain an id_token")
+	}
+
+	return p.verifyIDToken(tokenResponse.IDToken)
+}
+
+// verifyIDToken checks an RS256 signed ID token against the provider's JWKS and returns its claims
+func (p *oidcProvider) verifyIDToken(token string) (idTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("ID token header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm %s", header.Alg)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(p.discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %v", err)
+	}
+	var key *rsa.PublicKey
+	for _, k := range jwks.Keys {
+		if k.Kty == "RSA" && (header.Kid == "" || k.Kid == header.Kid) {
+			var err error
+			key, err = k.rsaKey()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no RSA key found for kid %s", header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("ID token signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("ID token signature verification: %v", err)
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("ID token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(p.c.Issuer, "/") {
+		return nil, fmt.Errorf("ID token issuer mismatch: %s", iss)
+	}
+	if !claims.hasAudience(p.c.ClientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().Unix() > int64(exp) {
+		return nil, errors.New("ID token expired")
+	}
+
+	return claims, nil // nil error
+}
+
+// rsaKey converts a JSON web key to an RSA public key
+func (k jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("JWK modulus: %v", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("JWK exponent: %v", err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// decodeSegment decodes a base64url JWT segment into v
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// hasAudience checks if the token's aud claim contains the client ID
+func (c idTokenClaims) hasAudience(clientID string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subject returns the most human readable subject identifier of the token
+func (c idTokenClaims) subject() string {
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if v, ok := c[claim].(string); ok && v != "" {
+			return v
+		}
+	}
+	return "unknown"
+}
+
+// groups returns the list of groups in a claim
+func (c idTokenClaims) groups(claim string) []string {
+	var groups []string
+	switch v := c[claim].(type) {
+	case string:
+		groups = append(groups, v)
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	return groups
+}
@@ -1,54 +1,123 @@
 package bird
 
 import (
+	"bufio"
+	"fmt"
 	"net"
-	"os"
+	"path"
 	"strings"
 	"testing"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestBirdConn(t *testing.T) {
-	unixSocket := "test.sock"
-
-	// Delete socket
-	_ = os.Remove(unixSocket)
+// fakeBIRD serves a fake BIRD control socket, replying to commands from replies and dropping the first drop connections
+func fakeBIRD(t *testing.T, banner string, replies map[string]string, drop int) string {
+	socket := path.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
 
 	go func() {
-		time.Sleep(time.Millisecond * 10) // Wait for the server to start
-		resp, err := RunCommand("bird command test\n", unixSocket)
-		assert.Nil(t, err)
-
-		// Print bird output as multiple lines
-		for _, line := range strings.Split(strings.Trim(resp, "\n"), "\n") {
-			log.Printf("BIRD response (multiline): %s", line)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if drop > 0 {
+				drop--
+				conn.Close()
+				continue
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := conn.Write([]byte(banner)); err != nil {
+					return
+				}
+				reader := bufio.NewReader(conn)
+				for {
+					command, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					reply, found := replies[strings.TrimSpace(command)]
+					if !found {
+						reply = "9001 syntax error, unexpected CF_SYM_UNDEFINED\n"
+					}
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}(conn)
 		}
 	}()
+	return socket
+}
+
+func TestBirdConn(t *testing.T) {
+	var longReply strings.Builder
+	longReply.WriteString("1007-Table master4:\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&longReply, " 10.%d.%d.0/24 unicast [EXAMPLE 2021-01-01] * (100) [AS65510i]\n", i/256, i%256)
+	}
+	longReply.WriteString("0000 \n")
 
-	log.Println("Starting fake BIRD socket server")
-	l, err := net.Listen("unix", unixSocket)
+	socket := fakeBIRD(t, "0001 BIRD 2.0.8 ready.\n", map[string]string{
+		"show route":  longReply.String(),
+		"configure":   "0002-Reading configuration from /etc/bird/bird.conf\n0003 Reconfigured\n",
+		"bad command": "8002 /etc/bird/bird.conf:12:1 syntax error\n",
+	}, 0)
+
+	client := NewClient(socket)
+	defer client.Close()
+	version, err := client.Version()
 	assert.Nil(t, err)
+	assert.Equal(t, Version{2, 0, 8}, version)
+	assert.True(t, version.AtLeast(2, 0, 7))
+	assert.False(t, version.AtLeast(2, 1, 0))
 
-	defer l.Close()
-	conn, err := l.Accept()
-	if err != nil {
-		return
+	reply, err := client.Run("show route\n")
+	assert.Nil(t, err)
+	assert.Equal(t, longReply.String(), reply)
+	assert.Greater(t, len(reply), 16384)
+
+	reply, err = client.Run("configure")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(reply, "0003 Reconfigured\n"))
+
+	_, err = client.Run("bad command")
+	birdErr, ok := err.(*Error)
+	if assert.True(t, ok, "expected *Error, got %v", err) {
+		assert.Equal(t, 8002, birdErr.Code)
+		assert.Equal(t, "/etc/bird/bird.conf:12:1 syntax error", birdErr.Message)
 	}
-	defer conn.Close()
 
-	_, err = conn.Write([]byte("0001 Fake BIRD response 1"))
+	// The connection is still usable after an error reply
+	reply, err = client.Run("configure")
 	assert.Nil(t, err)
+	assert.Contains(t, reply, "Reconfigured")
 
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf[:])
+	reply, err = RunCommand("configure", socket)
 	assert.Nil(t, err)
-	if string(buf[:n]) != "bird command test\n" {
-		t.Errorf("expected 'bird command test' got %s", string(buf[:n]))
-	}
+	assert.Contains(t, reply, "Reconfigured")
+}
 
-	_, err = conn.Write([]byte("0001 Fake BIRD response 2"))
+func TestBirdConnRetry(t *testing.T) {
+	socket := fakeBIRD(t, "0001 BIRD 2.0.8 ready.\n", map[string]string{"configure": "0003 Reconfigured\n"}, 2)
+	client := NewClient(socket)
+	client.Backoff = time.Millisecond
+	defer client.Close()
+	reply, err := client.Run("configure")
 	assert.Nil(t, err)
+	assert.Equal(t, "0003 Reconfigured\n", reply)
+
+	client = NewClient(path.Join(t.TempDir(), "missing.ctl"))
+	client.Retries, client.Backoff = 1, time.Millisecond
+	_, err = client.Run("configure")
+	assert.NotNil(t, err)
+	_, ok := err.(*Error)
+	assert.False(t, ok)
 }
@@ -0,0 +1,218 @@
+package bird
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from BIRD, with an 8xxx code for runtime errors or a 9xxx code for command parse errors
+type Error struct {
+	Command string
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("BIRD %s: %s (%04d)", e.Command, e.Message, e.Code)
+}
+
+// Version is a BIRD version
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast checks if the version is at least major.minor.patch
+func (v Version) AtLeast(major int, minor int, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// versionRegex matches the version in the BIRD welcome banner (0001 BIRD 2.0.8 ready.)
+var versionRegex = regexp.MustCompile(`BIRD v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Client is a BIRD control socket client that reconnects with exponential backoff when the socket fails
+type Client struct {
+	Socket  string
+	Retries int           // Reconnect attempts after a socket failure
+	Backoff time.Duration // Delay before the first reconnect, doubled after each attempt
+	Timeout time.Duration // Maximum time to wait for each reply line (unlimited if zero)
+
+	lock    sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	version Version
+}
+
+// NewClient creates a BIRD control socket client with the default retry settings
+func NewClient(socket string) *Client {
+	return &Client{
+		Socket:  socket,
+		Retries: 3,
+		Backoff: 500 * time.Millisecond,
+		Timeout: 2 * time.Minute,
+	}
+}
+
+// readReply reads a full reply, returning the raw reply text and the code and text of its final line
+func (c *Client) readReply() (string, int, string, error) {
+	var raw strings.Builder
+	for {
+		if c.Timeout > 0 {
+			if err := c.conn.SetReadDeadline(time.Now().Add(c.Timeout)); err != nil {
+				return "", 0, "", err
+			}
+		}
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", 0, "", fmt.Errorf("read: %v", err)
+		}
+		raw.WriteString(line)
+		line = strings.TrimRight(line, "\r\n")
+
+		// Lines starting with a space continue the previous line, and lines starting with + are asynchronous messages
+		if len(line) < 4 || line[0] == ' ' || line[0] == '+' {
+			continue
+		}
+		code, err := strconv.Atoi(line[:4])
+		if err != nil {
+			continue
+		}
+		// A space after the code marks the last line of the reply, a dash means more lines follow
+		if len(line) == 4 {
+			return raw.String(), code, "", nil // nil error
+		}
+		if line[4] == ' ' {
+			return raw.String(), code, line[5:], nil // nil error
+		}
+	}
+}
+
+// connect dials the socket and reads the version from the welcome banner
+func (c *Client) connect() error {
+	logger.Debugf("Connecting to BIRD socket %s", c.Socket)
+	conn, err := net.Dial("unix", c.Socket)
+	if err != nil {
+		return err
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+
+	banner, _, _, err := c.readReply()
+	if err != nil {
+		c.close()
+		return err
+	}
+	c.version = Version{}
+	if match := versionRegex.FindStringSubmatch(banner); match != nil {
+		c.version.Major, _ = strconv.Atoi(match[1])
+		c.version.Minor, _ = strconv.Atoi(match[2])
+		c.version.Patch, _ = strconv.Atoi(match[3])
+	} else {
+		logger.Warnf("Unable to parse BIRD version from %s", strings.TrimSpace(banner))
+	}
+	logger.Debugf("Connected to BIRD %s", c.version)
+	return nil // nil error
+}
+
+// close closes the connection so the next command reconnects
+func (c *Client) close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn, c.reader = nil, nil
+	}
+}
+
+// retry runs f with a connection, reconnecting with exponential backoff if the socket fails
+func (c *Client) retry(f func() error) error {
+	backoff := c.Backoff
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			logger.Debugf("Retrying BIRD socket in %s: %v", backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if c.conn == nil {
+			if err = c.connect(); err != nil {
+				continue
+			}
+		}
+		err = f()
+		if _, ok := err.(*Error); ok || err == nil {
+			// BIRD replied, so the socket is working
+			return err
+		}
+		c.close()
+	}
+	return fmt.Errorf("BIRD socket %s: %v", c.Socket, err)
+}
+
+// Version returns the version of the connected BIRD daemon
+func (c *Client) Version() (Version, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.retry(func() error { return nil }); err != nil {
+		return Version{}, err
+	}
+	return c.version, nil // nil error
+}
+
+// Run runs a command and returns the raw reply, or an *Error if BIRD replies with an error
+func (c *Client) Run(command string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	command = strings.Trim(command, "\n")
+
+	var reply string
+	err := c.retry(func() error {
+		logger.Debugf("Sending BIRD command: %s", command)
+		if c.Timeout > 0 {
+			if err := c.conn.SetWriteDeadline(time.Now().Add(c.Timeout)); err != nil {
+				return err
+			}
+		}
+		if _, err := c.conn.Write([]byte(command + "\n")); err != nil {
+			return fmt.Errorf("write: %v", err)
+		}
+		raw, code, message, err := c.readReply()
+		if err != nil {
+			return err
+		}
+		reply = raw
+		if code >= 8000 {
+			return &Error{Command: command, Code: code, Message: message}
+		}
+		return nil // nil error
+	})
+	return reply, err
+}
+
+// Close closes the connection to BIRD
+func (c *Client) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.close()
+}
+
+// RunCommand runs a single BIRD command on a new connection
+func RunCommand(command string, socket string) (string, error) {
+	client := NewClient(socket)
+	defer client.Close()
+	return client.Run(command)
+}
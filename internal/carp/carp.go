@@ -0,0 +1,144 @@
+package carp
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// advSkew converts a VRRP priority to a CARP advertisement skew, where a lower skew is preferred
+func advSkew(priority uint) int {
+	skew := 255 - int(priority)
+	if skew < 0 {
+		return 0
+	}
+	if skew > 254 {
+		return 254
+	}
+	return skew
+}
+
+// interfaceAddresses returns the IP addresses assigned to an interface
+func interfaceAddresses(name string) (map[string]bool, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	assigned := map[string]bool{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			assigned[ipNet.IP.String()] = true
+		}
+	}
+	return assigned, nil // nil error
+}
+
+// Commands returns the ifconfig commands that configure the carp implementation VRRP instances on goos (freebsd or openbsd), skipping VIPs that are already assigned
+func Commands(instances map[string]*config.VRRPInstance, goos string, addresses func(iface string) (map[string]bool, error)) ([][]string, error) {
+	var names []string
+	for name, instance := range instances {
+		if instance.Implementation == "carp" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var commands [][]string
+	for _, name := range names {
+		instance := instances[name]
+		vhid := strconv.Itoa(int(instance.VRID))
+
+		// FreeBSD attaches vhids to the parent interface, OpenBSD uses a carp pseudo-interface per vhid
+		iface := instance.Interface
+		params := []string{"vhid", vhid}
+		if goos == "openbsd" {
+			iface = "carp" + vhid
+			params = append(params, "carpdev", instance.Interface)
+		}
+		params = append(params, "advbase", strconv.Itoa(int(instance.AdvertInterval)), "advskew", strconv.Itoa(advSkew(instance.Priority)))
+		if instance.AuthType != "" {
+			params = append(params, "pass", instance.AuthPassword)
+		}
+
+		assigned, err := addresses(iface)
+		if err != nil {
+			if goos != "openbsd" {
+				return nil, fmt.Errorf("VRRP instance %s: %v", name, err)
+			}
+			commands = append(commands, []string{"ifconfig", iface, "create"})
+		}
+		commands = append(commands, append([]string{"ifconfig", iface}, params...))
+
+		for _, vip := range instance.VIPs {
+			ip, _, err := net.ParseCIDR(vip)
+			if err != nil {
+				return nil, fmt.Errorf("VRRP instance %s: invalid VIP %s", name, vip)
+			}
+			if assigned[ip.String()] {
+				continue
+			}
+			family := "inet"
+			if ip.To4() == nil {
+				family = "inet6"
+			}
+			command := []string{"ifconfig", iface, family, vip, "alias"}
+			if goos != "openbsd" {
+				command = append(command, "vhid", vhid)
+			}
+			commands = append(commands, command)
+		}
+	}
+	return commands, nil // nil error
+}
+
+// redact formats a command for logging without its CARP password
+func redact(command []string) string {
+	redacted := make([]string, len(command))
+	copy(redacted, command)
+	for i := range redacted {
+		if i > 0 && redacted[i-1] == "pass" {
+			redacted[i] = "<redacted>"
+		}
+	}
+	return strings.Join(redacted, " ")
+}
+
+// Apply configures CARP for the carp implementation VRRP instances
+func Apply(instances map[string]*config.VRRPInstance, noConfigure bool) error {
+	if runtime.GOOS != "freebsd" && runtime.GOOS != "openbsd" {
+		for name, instance := range instances {
+			if instance.Implementation == "carp" {
+				return fmt.Errorf("VRRP instance %s: CARP is only supported on FreeBSD and OpenBSD", name)
+			}
+		}
+		return nil // nil error
+	}
+
+	commands, err := Commands(instances, runtime.GOOS, interfaceAddresses)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if noConfigure {
+			log.Infof("[CARP] Not running %s (no configure)", redact(command))
+			continue
+		}
+		log.Debugf("[CARP] Running %s", redact(command))
+		if out, err := exec.Command(command[0], command[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("ifconfig %s: %v: %s", command[1], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil // nil error
+}
@@ -0,0 +1,68 @@
+package carp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestCommands(t *testing.T) {
+	instances := map[string]*config.VRRPInstance{
+		"VRRP 1": {
+			Implementation: "carp",
+			Interface:      "em0",
+			VRID:           1,
+			Priority:       255,
+			AdvertInterval: 1,
+			AuthType:       "PASS",
+			AuthPassword:   "secret",
+			VIPs:           []string{"192.0.2.1/24", "2001:db8::1/64"},
+		},
+		"VRRP 2": {
+			Implementation: "carp",
+			Interface:      "em1",
+			VRID:           2,
+			Priority:       100,
+			AdvertInterval: 2,
+			VIPs:           []string{"198.51.100.1/24"},
+		},
+		"VRRP 3": {Implementation: "keepalived", Interface: "em2", VRID: 3, VIPs: []string{"203.0.113.1/24"}},
+	}
+	addresses := func(iface string) (map[string]bool, error) {
+		switch iface {
+		case "em0", "em1", "carp1":
+			return map[string]bool{"2001:db8::1": true}, nil
+		}
+		return nil, errors.New("no such interface")
+	}
+
+	commands, err := Commands(instances, "freebsd", addresses)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		{"ifconfig", "em0", "vhid", "1", "advbase", "1", "advskew", "0", "pass", "secret"},
+		{"ifconfig", "em0", "inet", "192.0.2.1/24", "alias", "vhid", "1"},
+		{"ifconfig", "em1", "vhid", "2", "advbase", "2", "advskew", "155"},
+		{"ifconfig", "em1", "inet", "198.51.100.1/24", "alias", "vhid", "2"},
+	}, commands)
+
+	commands, err = Commands(instances, "openbsd", addresses)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		{"ifconfig", "carp1", "vhid", "1", "carpdev", "em0", "advbase", "1", "advskew", "0", "pass", "secret"},
+		{"ifconfig", "carp1", "inet", "192.0.2.1/24", "alias"},
+		{"ifconfig", "carp2", "create"},
+		{"ifconfig", "carp2", "vhid", "2", "carpdev", "em1", "advbase", "2", "advskew", "155"},
+		{"ifconfig", "carp2", "inet", "198.51.100.1/24", "alias"},
+	}, commands)
+
+	instances["VRRP 2"].Interface = "em9"
+	_, err = Commands(instances, "freebsd", addresses)
+	assert.NotNil(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "ifconfig em0 vhid 1 pass <redacted>", redact([]string{"ifconfig", "em0", "vhid", "1", "pass", "secret"}))
+}
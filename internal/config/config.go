@@ -1,13 +1,18 @@
 package config
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/creasty/defaults"
 	"github.com/go-ping/ping"
@@ -15,24 +20,33 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
+	"github.com/natesales/pathvector/internal/prefixset"
+	"github.com/natesales/pathvector/internal/slurm"
 	"github.com/natesales/pathvector/internal/util"
 )
 
+// logger tags log entries from this package so its log level can be set separately
+var logger = log.WithField("module", "config")
+
 // Peer stores a single peer config
 type Peer struct {
 	Template *string `yaml:"template" description:"Configuration template" default:"-"`
 
-	Description *string `yaml:"description" description:"Peer description" default:"-"`
-	Disabled    *bool   `yaml:"disabled" description:"Should the sessions be disabled?" default:"false"`
+	Description *string   `yaml:"description" description:"Peer description ({{name}}, {{asn}}, {{ix}} and {{class}} are replaced with the peer name, peer ASN, IX name, and sanitized peer template name or PEER)" default:"-"`
+	IX          *string   `yaml:"ix" description:"Name of the internet exchange the peer is connected over" default:"-"`
+	Disabled    *bool     `yaml:"disabled" description:"Should the sessions be disabled?" default:"false"`
+	Debug       *[]string `yaml:"debug" description:"BIRD debug categories to log for this peer's sessions (all, or any of states, routes, filters, interfaces, events and packets)" default:"-"`
 
 	// BGP Attributes
 	ASN                 *int      `yaml:"asn" description:"Local ASN" validate:"required" default:"0"`
 	NeighborIPs         *[]string `yaml:"neighbors" description:"List of neighbor IPs" validate:"required,ip" default:"-"`
 	Prepends            *int      `yaml:"prepends" description:"Number of times to prepend local AS on export" default:"0"`
+	ActionCommunities   *bool     `yaml:"action-communities" description:"Should action communities be applied to routes exported to this peer and removed before export? Disable for internal peers that should receive them unchanged" default:"true"`
 	LocalPref           *int      `yaml:"local-pref" description:"BGP local preference" default:"100"`
 	Multihop            *bool     `yaml:"multihop" description:"Should BGP multihop be enabled? (255 max hops)" default:"false"`
 	Listen4             *string   `yaml:"listen4" description:"IPv4 BGP listen address" default:"-"`
 	Listen6             *string   `yaml:"listen6" description:"IPv6 BGP listen address" default:"-"`
+	ListenInterface     *string   `yaml:"listen-interface" description:"Interface to source BGP sessions from when listen4 or listen6 aren't set, resolved by the daemon on the router (BIRD and FRR only)" default:"-"`
 	LocalASN            *int      `yaml:"local-asn" description:"Local ASN as defined in the global ASN field" default:"-"`
 	LocalPort           *int      `yaml:"local-port" description:"Local TCP port" default:"179"`
 	NeighborPort        *int      `yaml:"neighbor-port" description:"Neighbor TCP port" default:"179"`
@@ -40,30 +54,49 @@ type Peer struct {
 	Direct              *bool     `yaml:"direct" description:"Specify that the neighbor is directly connected" default:"false"`
 	NextHopSelf         *bool     `yaml:"next-hop-self" description:"Should BGP next-hop-self be enabled?" default:"false"`
 	BFD                 *bool     `yaml:"bfd" description:"Should BFD be enabled?" default:"false"`
+	BFDStrict           *bool     `yaml:"bfd-strict" description:"Should the BGP session only be brought up once its BFD session is up? Implies bfd (FRR 10.0 or later only)" default:"false"`
+	GracefulRestart     *bool     `yaml:"graceful-restart" description:"Should graceful restart be enabled, keeping the peer's routes while its session restarts?" default:"false"`
+	GracefulRestartTime *int      `yaml:"graceful-restart-time" description:"Graceful restart time in seconds (max 4095)" default:"120"`
+	LLGR                *bool     `yaml:"llgr" description:"Should long-lived graceful restart be enabled, keeping the peer's routes as stale routes after the graceful restart time? Implies graceful-restart" default:"false"`
+	LLGRStaleTime       *int      `yaml:"llgr-stale-time" description:"Long-lived graceful restart stale time in seconds (max 16777215)" default:"3600"`
+	HoldTime            *int      `yaml:"hold-time" description:"BGP hold time in seconds (0 or 3-65535, 0 disables keepalives)" default:"240"`
+	KeepaliveTime       *int      `yaml:"keepalive-time" description:"BGP keepalive time in seconds (a third of the hold time if not set)" default:"-"`
+	ConnectRetryTime    *int      `yaml:"connect-retry-time" description:"Seconds to wait between attempts to connect to the neighbor" default:"120"`
+	StartupHoldTime     *int      `yaml:"startup-hold-time" description:"BGP hold time in seconds until the session is established (0 or 3-65535)" default:"240"`
 	Password            *string   `yaml:"password" description:"BGP MD5 password" default:"-"`
+	TCPAOKeyChain       *string   `yaml:"tcp-ao-key-chain" description:"Name of the key chain from tcp-ao-key-chains to authenticate the session with TCP-AO instead of an MD5 password" default:"-"`
+	TCPMSS              *int      `yaml:"tcp-mss" description:"TCP maximum segment size of the session (88-65535)" default:"-"`
+	Interface           *string   `yaml:"interface" description:"Interface to bind the session to, for directly connected neighbors reached over tunnels and L2 stretches" default:"-"`
 	RSClient            *bool     `yaml:"rs-client" description:"Should this peer be a route server client?" default:"false"`
 	RRClient            *bool     `yaml:"rr-client" description:"Should this peer be a route reflector client?" default:"false"`
-	RemovePrivateASNs   *bool     `yaml:"remove-private-asns" description:"Should private ASNs be removed from path before exporting?" default:"true"`
+	Role                *string   `yaml:"role" description:"Local RFC 9234 BGP role on the session ('provider' for customers, 'customer' for transit providers, 'peer', 'rs-server' for route server clients or 'rs-client' for route servers), rejecting route leaks with the Only-to-Customer attribute" default:"-"`
+	RequireRole         *bool     `yaml:"require-role" description:"Should the session be refused unless the neighbor announces a matching BGP role?" default:"false"`
+	RemovePrivateASNs   *bool     `yaml:"remove-private-asns" description:"Should private ASNs be removed from path before exporting? OpenBGPD can't remove them, so it doesn't export routes with private ASNs instead" default:"true"`
 	MPUnicast46         *bool     `yaml:"mp-unicast-46" description:"Should this peer be configured with multiprotocol IPv4 and IPv6 unicast?" default:"false"`
 	AllowLocalAS        *bool     `yaml:"allow-local-as" description:"Should routes originated by the local ASN be accepted?" default:"false"`
+	ASOverride          *bool     `yaml:"as-override" description:"Should the peer's ASN be replaced with the local ASN in the AS path of exported routes? For customers reusing the same ASN at multiple sites" default:"false"`
 	AddPathTx           *bool     `yaml:"add-path-tx" description:"Enable BGP additional paths on export?" default:"false"`
 	AddPathRx           *bool     `yaml:"add-path-rx" description:"Enable BGP additional paths on import?" default:"false"`
+	FlowSpec            *bool     `yaml:"flowspec" description:"Should the flowspec address families be enabled, announcing flowspec-rules to this peer? Flowspec rules received from the peer are ignored" default:"false"`
+	AFISAFI             *[]string `yaml:"afi-safi" description:"Additional address families to enable on the session (vpn4-unicast, vpn6-unicast, and l2vpn-evpn), exchanging all VPN and EVPN routes without filtering" default:"-"`
+	VRF                 *string   `yaml:"vrf" description:"Name of the VRF from vrfs to run this session in, importing into and announcing from its tables instead of the master tables" default:"-"`
 	ImportNextHop       *string   `yaml:"import-next-hop" description:"Rewrite the BGP next hop before importing routes learned from this peer" default:"-"`
 	ExportNextHop       *string   `yaml:"export-next-hop" description:"Rewrite the BGP next hop before announcing routes to this peer" default:"-"`
 	Confederation       *int      `yaml:"confederation" description:"BGP confederation (RFC 5065)" default:"-"`
 	ConfederationMember *bool     `yaml:"confederation-member" description:"Should this peer be a member of the local confederation?" default:"false"`
 	TTLSecurity         *bool     `yaml:"ttl-security" description:"RFC 5082 Generalized TTL Security Mechanism" default:"false"`
 
-	ImportCommunities    *[]string `yaml:"import-communities" description:"List of communities to add to all imported routes" default:"-"`
-	ExportCommunities    *[]string `yaml:"export-communities" description:"List of communities to add to all exported routes" default:"-"`
-	AnnounceCommunities  *[]string `yaml:"announce-communities" description:"Announce all routes matching these communities to the peer" default:"-"`
-	RemoveCommunities    *[]string `yaml:"remove-communities" description:"List of communities to remove before from routes announced by this peer" default:"-"`
+	ImportCommunities    *[]string `yaml:"import-communities" description:"List of communities to add to all imported routes (standard, large, or rt/ro extended communities)" default:"-"`
+	ExportCommunities    *[]string `yaml:"export-communities" description:"List of communities to add to all exported routes (standard, large, or rt/ro extended communities)" default:"-"`
+	AnnounceCommunities  *[]string `yaml:"announce-communities" description:"Announce all routes matching these communities to the peer (standard, large, or rt/ro extended communities)" default:"-"`
+	RemoveCommunities    *[]string `yaml:"remove-communities" description:"List of communities to remove before from routes announced by this peer (standard, large, or rt/ro extended communities)" default:"-"`
 	RemoveAllCommunities *int      `yaml:"remove-all-communities" description:"Remove all standard and large communities beginning with this value" default:"-"`
 
 	ASPrefs *map[uint32]uint32 `yaml:"as-prefs" description:"Map of ASN to import local pref (not included in optimizer)" default:"-"`
 
 	// Filtering
 	ASSet                   *string `yaml:"as-set" description:"Peer's as-set for filtering" default:"-"`
+	IRRServer               *string `yaml:"irr-server" description:"Internet routing registry server to query for this peer instead of the global IRR servers" default:"-"`
 	ImportLimit4            *int    `yaml:"import-limit4" description:"Maximum number of IPv4 prefixes to import" default:"1000000"`
 	ImportLimit6            *int    `yaml:"import-limit6" description:"Maximum number of IPv6 prefixes to import" default:"200000"`
 	EnforceFirstAS          *bool   `yaml:"enforce-first-as" description:"Should we only accept routes who's first AS is equal to the configured peer address?" default:"true"`
@@ -73,7 +106,9 @@ type Peer struct {
 	AllowBlackholeCommunity *bool   `yaml:"allow-blackhole-community" description:"Should this peer be allowed to send routes with the blackhole community?" default:"false"`
 
 	FilterIRR                  *bool `yaml:"filter-irr" description:"Should IRR filtering be applied?" default:"false"`
+	FilterASPath               *bool `yaml:"filter-as-path" description:"Should routes whose origin AS isn't a member of the peer's as-set be rejected?" default:"false"`
 	FilterRPKI                 *bool `yaml:"filter-rpki" description:"Should RPKI invalids be rejected?" default:"true"`
+	FilterASPA                 *bool `yaml:"filter-aspa" description:"Should routes that fail RPKI ASPA upstream verification be rejected? Only for customer and peer sessions, requires BIRD 3.1 or later or OpenBGPD 8.0 or later (not supported by FRR)" default:"false"`
 	FilterMaxPrefix            *bool `yaml:"filter-max-prefix" description:"Should max prefix filtering be applied?" default:"true"`
 	FilterBogonRoutes          *bool `yaml:"filter-bogon-routes" description:"Should bogon prefixes be rejected?" default:"true"`
 	FilterBogonASNs            *bool `yaml:"filter-bogon-asns" description:"Should paths containing a bogon ASN be rejected?" default:"true"`
@@ -86,11 +121,17 @@ type Peer struct {
 
 	HonorGracefulShutdown *bool `yaml:"honor-graceful-shutdown" description:"Should RFC8326 graceful shutdown be enabled?" default:"true"`
 
-	Prefixes *[]string `yaml:"prefixes" description:"Prefixes to accept" default:"-"`
+	Prefixes          *[]string `yaml:"prefixes" description:"Prefixes to accept" default:"-"`
+	AggregatePrefixes *bool     `yaml:"aggregate-prefixes" description:"Should adjacent and covered prefixes in prefix filters be aggregated to shrink the generated filter?" default:"false"`
 
 	// Export options
-	AnnounceDefault    *bool `yaml:"announce-default" description:"Should a default route be exported to this peer?" default:"false"`
-	AnnounceOriginated *bool `yaml:"announce-originated" description:"Should locally originated routes be announced to this peer?" default:"true"`
+	AnnounceDefault    *bool     `yaml:"announce-default" description:"Should a default route be exported to this peer?" default:"false"`
+	AnnounceOriginated *bool     `yaml:"announce-originated" description:"Should locally originated routes be announced to this peer?" default:"true"`
+	AnnounceOSPF       *bool     `yaml:"announce-ospf" description:"Should routes learned from OSPF be announced to this peer?" default:"false"`
+	AnnounceBabel      *bool     `yaml:"announce-babel" description:"Should routes learned from Babel be announced to this peer?" default:"false"`
+	AnnounceISIS       *bool     `yaml:"announce-isis" description:"Should routes learned from IS-IS be announced to this peer?" default:"false"`
+	AnnouncePrefixes   *[]string `yaml:"announce-prefixes" description:"Originated prefixes or prefix group names to announce to this peer instead of all originated prefixes" default:"-"`
+	Tags               *[]string `yaml:"tags" description:"Site or region tags of this peer, matched against tagged prefix groups (defaults to the router's tags)" default:"-"`
 
 	// Custom daemon configuration
 	SessionGlobal  *string `yaml:"session-global" description:"Configuration to add to each session before any defined BGP protocols" default:"-"`
@@ -100,22 +141,64 @@ type Peer struct {
 	PreExportFinal *string `yaml:"pre-export-final" description:"Configuration to add immediately before the final accept/reject on export" default:"-"`
 
 	// Optimizer
-	OptimizerProbeSources *[]string `yaml:"probe-sources" description:"Optimizer probe source addresses" default:"-"`
-	OptimizeInbound       *bool     `yaml:"optimize-inbound" description:"Should the optimizer modify inbound policy?" default:"false"`
-
-	ProtocolName                *string   `yaml:"-" description:"-" default:"-"`
-	Protocols                   *[]string `yaml:"-" description:"-" default:"-"`
-	PrefixSet4                  *[]string `yaml:"-" description:"-" default:"-"`
-	PrefixSet6                  *[]string `yaml:"-" description:"-" default:"-"`
-	ImportStandardCommunities   *[]string `yaml:"-" description:"-" default:"-"`
-	ImportLargeCommunities      *[]string `yaml:"-" description:"-" default:"-"`
-	ExportStandardCommunities   *[]string `yaml:"-" description:"-" default:"-"`
-	ExportLargeCommunities      *[]string `yaml:"-" description:"-" default:"-"`
-	AnnounceStandardCommunities *[]string `yaml:"-" description:"-" default:"-"`
-	AnnounceLargeCommunities    *[]string `yaml:"-" description:"-" default:"-"`
-	RemoveStandardCommunities   *[]string `yaml:"-" description:"-" default:"-"`
-	RemoveLargeCommunities      *[]string `yaml:"-" description:"-" default:"-"`
-	BooleanOptions              *[]string `yaml:"-" description:"-" default:"-"`
+	OptimizerProbeSources        *[]string          `yaml:"probe-sources" description:"Optimizer probe source addresses" default:"-"`
+	OptimizerProbeInterfaces     *map[string]string `yaml:"probe-interfaces" description:"Map of optimizer probe source address to outgoing interface (uses the system ping binary for ICMP)" default:"-"`
+	OptimizeInbound              *bool              `yaml:"optimize-inbound" description:"Should the optimizer modify inbound policy?" default:"false"`
+	OptimizeOutbound             *bool              `yaml:"optimize-outbound" description:"Should the optimizer modify outbound policy?" default:"false"`
+	OptimizerPrepends            *int               `yaml:"optimizer-prepends" description:"Number of times to prepend the local ASN on export while depreferred by the optimizer" default:"3"`
+	OptimizerMED                 *int               `yaml:"optimizer-med" description:"MED to set on export while depreferred by the optimizer (unchanged if unset)" default:"-"`
+	OptimizerModifier            *uint              `yaml:"optimizer-modifier" description:"Amount to lower local pref by while depreferred (overrides the global optimizer modifier)" default:"-"`
+	OptimizerLocalPrefFloor      *uint              `yaml:"optimizer-local-pref-floor" description:"Minimum local pref the optimizer can lower this peer to" default:"-"`
+	OptimizerLatencyThreshold    *uint              `yaml:"optimizer-latency-threshold" description:"Maximum allowable latency in milliseconds (overrides the global optimizer threshold)" default:"-"`
+	OptimizerPacketLossThreshold *float64           `yaml:"optimizer-packet-loss-threshold" description:"Maximum allowable packet loss in percent (overrides the global optimizer threshold)" default:"-"`
+	OptimizerJitterThreshold     *uint              `yaml:"optimizer-jitter-threshold" description:"Maximum allowable jitter in milliseconds (overrides the global optimizer threshold)" default:"-"`
+
+	ProtocolName                *string            `yaml:"-" description:"-" default:"-"`
+	ProtocolName4               *string            `yaml:"-" description:"-" default:"-"`
+	ProtocolName6               *string            `yaml:"-" description:"-" default:"-"`
+	Protocols                   *[]string          `yaml:"-" description:"-" default:"-"`
+	NeighborProtocols           *map[string]string `yaml:"-" description:"-" default:"-"`
+	PrefixSet4                  *prefixset.Set     `yaml:"-" description:"-" default:"-"`
+	PrefixSet6                  *prefixset.Set     `yaml:"-" description:"-" default:"-"`
+	OriginASNs                  *[]uint32          `yaml:"-" description:"-" default:"-"`
+	VPNFamilies                 *[]string          `yaml:"-" description:"-" default:"-"`
+	EVPN                        *bool              `yaml:"-" description:"-" default:"-"`
+	VRFInterface                *string            `yaml:"-" description:"-" default:"-"`
+	VRFTableName                *string            `yaml:"-" description:"-" default:"-"`
+	TCPAOKeys                   *[]*TCPAOKey       `yaml:"-" description:"-" default:"-"`
+	BIRDRole                    *string            `yaml:"-" description:"-" default:"-"`
+	ImportStandardCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	ImportLargeCommunities      *[]string          `yaml:"-" description:"-" default:"-"`
+	ImportExtendedCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	ExportStandardCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	ExportLargeCommunities      *[]string          `yaml:"-" description:"-" default:"-"`
+	ExportExtendedCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnounceStandardCommunities *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnounceLargeCommunities    *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnounceExtendedCommunities *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnouncePrefixes4           *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnouncePrefixes6           *[]string          `yaml:"-" description:"-" default:"-"`
+	RemoveStandardCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	RemoveLargeCommunities      *[]string          `yaml:"-" description:"-" default:"-"`
+	RemoveExtendedCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	BooleanOptions              *[]string          `yaml:"-" description:"-" default:"-"`
+}
+
+// VRRPTrackInterface stores an interface whose state changes a VRRP instance's priority
+type VRRPTrackInterface struct {
+	Interface string `yaml:"interface" description:"Interface to track" validate:"required"`
+	Weight    int    `yaml:"weight" description:"Priority change when the interface is down (instance faults if 0)"`
+}
+
+// VRRPTrackScript stores a health check script whose result changes a VRRP instance's priority
+type VRRPTrackScript struct {
+	Script   string `yaml:"script" description:"Command to run, a non-zero exit code marks the check as failed" validate:"required"`
+	Interval uint   `yaml:"interval" description:"Interval in seconds between script runs" default:"2"`
+	Weight   int    `yaml:"weight" description:"Priority change, applied when failing if negative or when succeeding if positive (instance faults on failure if 0)"`
+	Fall     uint   `yaml:"fall" description:"Number of failures before the check is marked as failed" default:"1"`
+	Rise     uint   `yaml:"rise" description:"Number of successes before the check is marked as succeeded" default:"1"`
+
+	Name string `yaml:"-" description:"-"`
 }
 
 // VRRPInstance stores a single VRRP instance
@@ -126,8 +209,39 @@ type VRRPInstance struct {
 	Priority  uint     `yaml:"priority" description:"RFC3768 VRRP Priority" validate:"required"`
 	VIPs      []string `yaml:"vips" description:"List of virtual IPs" validate:"required,cidr"`
 
-	VIPs4 []string `yaml:"-" description:"-"`
-	VIPs6 []string `yaml:"-" description:"-"`
+	Implementation string   `yaml:"implementation" description:"VRRP implementation ('keepalived', 'carp' on FreeBSD and OpenBSD, or 'builtin' to run the instance with pathvector vrrp), defaults to carp on the BSDs and keepalived elsewhere"`
+	Originate      []string `yaml:"originate" description:"List of prefixes to originate only while this instance is primary"`
+
+	AdvertInterval uint     `yaml:"advert-interval" description:"VRRP advertisement interval in seconds" default:"1"`
+	VRID6Offset    uint     `yaml:"vrid6-offset" description:"Offset added to the VRID of the IPv6 instance when the instance has both IPv4 and IPv6 VIPs" default:"0"`
+	UnicastSource  string   `yaml:"unicast-source" description:"Source address for unicast VRRP advertisements"`
+	UnicastPeers   []string `yaml:"unicast-peers" description:"List of unicast peer addresses to send VRRP advertisements to instead of multicast"`
+	AuthType       string   `yaml:"auth-type" description:"VRRP authentication type ('pass' or 'ah', disabled if empty)"`
+	AuthPassword   string   `yaml:"auth-password" description:"VRRP authentication password (up to 8 characters)"`
+	NoPreempt      bool     `yaml:"nopreempt" description:"Don't preempt a lower priority primary (requires backup state)"`
+	PreemptDelay   uint     `yaml:"preempt-delay" description:"Seconds to wait after startup before preempting a lower priority primary"`
+
+	GARPMasterDelay   uint `yaml:"garp-master-delay" description:"Seconds to wait before sending a second set of gratuitous ARPs (or unsolicited neighbor advertisements for IPv6) after becoming primary"`
+	GARPMasterRepeat  uint `yaml:"garp-master-repeat" description:"Number of gratuitous ARP (or unsolicited neighbor advertisement) messages to send at a time after becoming primary"`
+	GARPMasterRefresh uint `yaml:"garp-master-refresh" description:"Interval in seconds to refresh gratuitous ARPs (or unsolicited neighbor advertisements) while primary (disabled if 0)"`
+
+	TrackInterfaces []VRRPTrackInterface `yaml:"track-interfaces" description:"List of interfaces to track"`
+	TrackScripts    []VRRPTrackScript    `yaml:"track-scripts" description:"List of health check scripts to track"`
+
+	VIPs4        []string `yaml:"-" description:"-"`
+	VIPs6        []string `yaml:"-" description:"-"`
+	Originate4   []string `yaml:"-" description:"-"`
+	Originate6   []string `yaml:"-" description:"-"`
+	ProtocolName string   `yaml:"-" description:"-"`
+}
+
+// VRRPSyncGroup stores a group of VRRP instances that change state together
+type VRRPSyncGroup struct {
+	Instances    []string `yaml:"instances" description:"List of VRRP instance names in the group" validate:"required"`
+	NotifyMaster string   `yaml:"notify-primary" description:"Script to run when the group becomes primary"`
+	NotifyBackup string   `yaml:"notify-backup" description:"Script to run when the group becomes backup"`
+	NotifyFault  string   `yaml:"notify-fault" description:"Script to run when the group faults"`
+	Notify       string   `yaml:"notify" description:"Script to run on any state change (with the group name and new state as arguments)"`
 }
 
 // BFDInstance stores a single BFD instance
@@ -137,22 +251,150 @@ type BFDInstance struct {
 	Interval   *uint   `yaml:"interval" description:"RX and TX interval" default:"200"`
 	Multiplier *uint   `yaml:"multiplier" description:"Number of missed packets for the state to be declared down" default:"10"`
 
+	Passive  *bool   `yaml:"passive" description:"Wait for the neighbor to send the first BFD packet" default:"false"`
+	Multihop *bool   `yaml:"multihop" description:"Use a multihop BFD session (RFC5883) instead of a single hop session on an interface" default:"false"`
+	Local    *string `yaml:"local" description:"Local IP address for multihop sessions" default:"-"`
+
+	AuthType   *string `yaml:"auth-type" description:"BFD authentication type ('simple', 'md5' or 'sha1', disabled if empty)" default:"-"`
+	Password   *string `yaml:"password" description:"BFD authentication password" default:"-"`
+	Meticulous *bool   `yaml:"meticulous" description:"Increment the authentication sequence number on every packet (meticulous keyed md5/sha1)" default:"false"`
+
 	ProtocolName *string `yaml:"-" description:"-" default:"-"`
 }
 
+// OriginPrefix stores a locally originated prefix and the attributes of its route
+type OriginPrefix struct {
+	Prefix      string   `yaml:"prefix" description:"Prefix to announce"`
+	Communities []string `yaml:"communities" description:"List of standard or large communities to add to the route"`
+	LocalPref   *uint    `yaml:"local-pref" description:"BGP local preference for the route" default:"-"`
+	NoExport    bool     `yaml:"no-export" description:"Add the well-known NO_EXPORT community so the route isn't announced outside of the AS" default:"false"`
+
+	StandardCommunities []string `yaml:"-" description:"-"`
+	LargeCommunities    []string `yaml:"-" description:"-"`
+}
+
+// UnmarshalYAML parses an origin prefix from either a prefix string or an object with route attributes
+func (o *OriginPrefix) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&o.Prefix); err == nil {
+		return nil // nil error
+	}
+	type plain OriginPrefix
+	return unmarshal((*plain)(o))
+}
+
+// MarshalYAML encodes an origin prefix without attributes as a prefix string
+func (o *OriginPrefix) MarshalYAML() (interface{}, error) {
+	if len(o.Communities) == 0 && o.LocalPref == nil && !o.NoExport {
+		return o.Prefix, nil
+	}
+	type plain OriginPrefix
+	return (*plain)(o), nil
+}
+
+// hasAttributes returns true if the route has any attributes set
+func (o *OriginPrefix) hasAttributes() bool {
+	return len(o.StandardCommunities) > 0 || len(o.LargeCommunities) > 0 || o.LocalPref != nil
+}
+
+// StaticNexthop stores a next hop of a static route
+type StaticNexthop struct {
+	Address string `yaml:"address" description:"Next hop address" validate:"required,ip"`
+	Weight  uint   `yaml:"weight" description:"ECMP weight relative to the route's other next hops (1 if 0)" validate:"max=256"`
+	OnLink  bool   `yaml:"onlink" description:"Should the next hop be used even if it isn't in a directly connected subnet?"`
+	BFD     bool   `yaml:"bfd" description:"Should the next hop be withdrawn when a BFD session to it goes down? Requires a matching bfd instance"`
+}
+
+// Static stores a static route and its attributes
+type Static struct {
+	Nexthop    string           `yaml:"nexthop" description:"Next hop address, or blackhole, reject, unreachable, or prohibit to discard matching traffic"`
+	Nexthops   []*StaticNexthop `yaml:"nexthops" description:"List of ECMP next hops with their attributes, instead of nexthop"`
+	Recursive  bool             `yaml:"recursive" description:"Should the next hop be resolved through the routing table instead of being directly connected?"`
+	Preference uint             `yaml:"preference" description:"Route preference (administrative distance with FRR), protocol default if 0" validate:"max=65535"`
+}
+
+// UnmarshalYAML parses a static route from either a next hop string or an object with route attributes
+func (s *Static) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&s.Nexthop); err == nil {
+		return nil // nil error
+	}
+	type plain Static
+	return unmarshal((*plain)(s))
+}
+
+// MarshalYAML encodes a static route without attributes as a next hop string
+func (s *Static) MarshalYAML() (interface{}, error) {
+	if len(s.Nexthops) == 0 && !s.Recursive && s.Preference == 0 {
+		return s.Nexthop, nil
+	}
+	type plain Static
+	return (*plain)(s), nil
+}
+
+// PrefixGroup stores a named group of originated prefixes
+type PrefixGroup struct {
+	Prefixes []string `yaml:"prefixes" description:"Originated prefixes in the group"`
+	Tags     []string `yaml:"tags" description:"Only announce the group to peers with one of these tags, unless a peer lists it in announce-prefixes (announced to all peers if empty)"`
+}
+
+// UnmarshalYAML parses a prefix group from either a list of prefixes or an object with tags
+func (g *PrefixGroup) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&g.Prefixes); err == nil {
+		return nil // nil error
+	}
+	type plain PrefixGroup
+	return unmarshal((*plain)(g))
+}
+
+// Healthcheck stores a service healthcheck that conditionally originates prefixes
+type Healthcheck struct {
+	Type         string   `yaml:"type" description:"Healthcheck type ('http', 'tcp', 'icmp' or 'script')" validate:"required,oneof=http tcp icmp script"`
+	Target       string   `yaml:"target" description:"URL for http checks, host:port for tcp checks, address for icmp checks or command for script checks" validate:"required"`
+	Prefixes     []string `yaml:"prefixes" description:"List of prefixes to originate only while the check is passing" validate:"required"`
+	Interval     uint     `yaml:"interval" description:"Seconds between checks" default:"5"`
+	Timeout      uint     `yaml:"timeout" description:"Check timeout in seconds" default:"2"`
+	Rise         uint     `yaml:"rise" description:"Number of consecutive passing checks before the prefixes are announced" default:"2"`
+	Fall         uint     `yaml:"fall" description:"Number of consecutive failed checks before the prefixes are withdrawn" default:"3"`
+	ExpectStatus int      `yaml:"expect-status" description:"Expected HTTP status code for http checks" default:"200"`
+
+	Prefixes4    []string `yaml:"-" description:"-"`
+	Prefixes6    []string `yaml:"-" description:"-"`
+	ProtocolName string   `yaml:"-" description:"-"`
+}
+
+// ConditionalPrefix stores a prefix that's only originated while a probe target is reachable
+type ConditionalPrefix struct {
+	Probe    string `yaml:"probe" description:"Probe type ('icmp' or 'tcp')" default:"icmp" validate:"oneof=icmp tcp"`
+	Target   string `yaml:"target" description:"Address for icmp probes or host:port for tcp probes" validate:"required"`
+	Interval uint   `yaml:"interval" description:"Seconds between probes" default:"5"`
+	Timeout  uint   `yaml:"timeout" description:"Probe timeout in seconds" default:"2"`
+	Rise     uint   `yaml:"rise" description:"Number of consecutive successful probes before the prefix is announced" default:"2"`
+	Fall     uint   `yaml:"fall" description:"Number of consecutive failed probes before the prefix is withdrawn" default:"3"`
+}
+
+// LinkPrefixes stores announced prefixes that are withdrawn when an interface loses carrier
+type LinkPrefixes struct {
+	ProtocolName string
+	Prefixes4    []string
+	Prefixes6    []string
+}
+
 // Augments store BIRD specific options
 type Augments struct {
-	Accept4        []string          `yaml:"accept4" description:"List of BIRD protocols to import into the IPv4 table"`
-	Accept6        []string          `yaml:"accept6" description:"List of BIRD protocols to import into the IPv6 table"`
-	Reject4        []string          `yaml:"reject4" description:"List of BIRD protocols to not import into the IPv4 table"`
-	Reject6        []string          `yaml:"reject6" description:"List of BIRD protocols to not import into the IPv6 table"`
-	Statics        map[string]string `yaml:"statics" description:"List of static routes to include in BIRD"`
-	SRDCommunities []string          `yaml:"srd-communities" description:"List of communities to filter routes exported to kernel (if list is not empty, all other prefixes will not be exported)"`
-
-	SRDStandardCommunities []string          `yaml:"-" description:"-"`
-	SRDLargeCommunities    []string          `yaml:"-" description:"-"`
-	Statics4               map[string]string `yaml:"-" description:"-"`
-	Statics6               map[string]string `yaml:"-" description:"-"`
+	Accept4          []string           `yaml:"accept4" description:"List of BIRD protocols to import into the IPv4 table"`
+	Accept6          []string           `yaml:"accept6" description:"List of BIRD protocols to import into the IPv6 table"`
+	Reject4          []string           `yaml:"reject4" description:"List of BIRD protocols to not import into the IPv4 table"`
+	Reject6          []string           `yaml:"reject6" description:"List of BIRD protocols to not import into the IPv6 table"`
+	Statics          map[string]*Static `yaml:"statics" description:"Map of prefixes to static routes to include in BIRD, either a next hop string (an address or blackhole, reject, unreachable, or prohibit) or an object with route attributes"`
+	StaticInterfaces map[string]string  `yaml:"static-interfaces" description:"Map of static route prefixes to interfaces, withdrawing the route when the interface loses carrier"`
+	SRDCommunities   []string           `yaml:"srd-communities" description:"List of communities to filter routes exported to kernel (if list is not empty, all other prefixes will not be exported)"`
+	VXLAN            map[string]*VXLAN  `yaml:"vxlan" description:"Map of names to VXLAN segments advertised to peers with l2vpn-evpn enabled, overriding their automatic route distinguisher and route targets (FRR only)"`
+
+	SRDStandardCommunities []string           `yaml:"-" description:"-"`
+	SRDLargeCommunities    []string           `yaml:"-" description:"-"`
+	Statics4               map[string]*Static `yaml:"-" description:"-"`
+	Statics6               map[string]*Static `yaml:"-" description:"-"`
+	Blackholes4            map[string]*Static `yaml:"-" description:"-"`
+	Blackholes6            map[string]*Static `yaml:"-" description:"-"`
 }
 
 // ProbeResult stores a single probe result
@@ -161,143 +403,879 @@ type ProbeResult struct {
 	Stats ping.Statistics
 }
 
+// ProbeTarget stores an optimizer probe target
+type ProbeTarget struct {
+	Type               string `yaml:"type" description:"Probe type (icmp, tcp, http, or https)" default:"tcp" validate:"oneof=icmp tcp http https"`
+	Address            string `yaml:"address" description:"Target IP address" validate:"required,ip"`
+	Port               int    `yaml:"port" description:"Target port (80 for http and 443 for https if unset)" default:"0"`
+	Path               string `yaml:"path" description:"HTTP request path" default:"/"`
+	Host               string `yaml:"host" description:"HTTP host header and TLS SNI (target address if empty)" default:""`
+	ExpectedStatus     int    `yaml:"expected-status" description:"Expected HTTP response status code" default:"200"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify" description:"Don't verify the target's TLS certificate" default:"false"`
+
+	LatencyThreshold    uint    `yaml:"latency-threshold" description:"Maximum allowable latency in milliseconds for this target (peer or global threshold if 0)" default:"0"`
+	PacketLossThreshold float64 `yaml:"packet-loss-threshold" description:"Maximum allowable packet loss (percent) for this target (peer or global threshold if 0)" default:"0"`
+	JitterThreshold     uint    `yaml:"jitter-threshold" description:"Maximum allowable jitter in milliseconds for this target (peer or global threshold if 0)" default:"0"`
+}
+
+// BlackoutWindow stores a maintenance window during which the optimizer doesn't modify policy or alert
+type BlackoutWindow struct {
+	Start       string   `yaml:"start" description:"Window start (RFC3339 timestamp for a one-off window, or HH:MM local time for a recurring window)" validate:"required"`
+	End         string   `yaml:"end" description:"Window end (same format as start, recurring windows may end on the next day)" validate:"required"`
+	Days        []string `yaml:"days" description:"Days of the week a recurring window starts on (mon, tue, ..., every day if empty)"`
+	Description string   `yaml:"description" description:"Description of the maintenance"`
+}
+
 // Optimizer stores route optimizer configuration
 type Optimizer struct {
-	Targets             []string `yaml:"targets" description:"List of probe targets"`
-	LatencyThreshold    uint     `yaml:"latency-threshold" description:"Maximum allowable latency in milliseconds" default:"100"`
-	PacketLossThreshold float64  `yaml:"packet-loss-threshold" description:"Maximum allowable packet loss (percent)" default:"0.5"`
-	LocalPrefModifier   uint     `yaml:"modifier" description:"Amount to lower local pref by for depreferred peers" default:"20"`
+	Targets             []string      `yaml:"targets" description:"List of ICMP/UDP probe targets"`
+	AutoTargets         int           `yaml:"auto-targets" description:"Number of ICMP/UDP probe targets per address family to derive from each peer's learned prefixes (disabled if 0)" default:"0"`
+	AutoTargetOffset    int           `yaml:"auto-target-offset" description:"Host offset inside each learned prefix for derived probe targets" default:"1"`
+	AutoTargetRefresh   int           `yaml:"auto-target-refresh" description:"Number of seconds to reuse derived probe targets before querying BIRD for the peer's learned prefixes again (every run if 0)" default:"3600"`
+	VerifyRoutes        bool          `yaml:"verify-routes" description:"Only probe targets that are covered by a route learned from the peer" default:"false"`
+	ProbeTargets        []ProbeTarget `yaml:"probe-targets" description:"List of TCP and HTTP probe targets" validate:"dive"`
+	LatencyThreshold    uint          `yaml:"latency-threshold" description:"Maximum allowable latency in milliseconds" default:"100"`
+	PacketLossThreshold float64       `yaml:"packet-loss-threshold" description:"Maximum allowable packet loss (percent)" default:"0.5"`
+	JitterThreshold     uint          `yaml:"jitter-threshold" description:"Maximum allowable jitter (RTT standard deviation) in milliseconds (disabled if 0)" default:"0"`
+	LocalPrefModifier   uint          `yaml:"modifier" description:"Amount to lower local pref by for depreferred peers" default:"20"`
+
+	RestoreLatencyThreshold    uint    `yaml:"restore-latency-threshold" description:"Latency in milliseconds below which a depreferred peer is restored (trip threshold if 0)" default:"0"`
+	RestorePacketLossThreshold float64 `yaml:"restore-packet-loss-threshold" description:"Packet loss (percent) below which a depreferred peer is restored (trip threshold if 0)" default:"0"`
+	RestoreJitterThreshold     uint    `yaml:"restore-jitter-threshold" description:"Jitter in milliseconds below which a depreferred peer is restored (trip threshold if 0)" default:"0"`
+	HoldTime                   uint    `yaml:"hold-time" description:"Minimum number of seconds a peer stays depreferred before it can be restored" default:"600"`
+	EWMAAlpha                  float64 `yaml:"ewma-alpha" description:"Exponential moving average smoothing factor for probe results (0-1, simple mean if 0)" default:"0" validate:"min=0,max=1"`
 
 	PingCount   int `yaml:"probe-count" description:"Number of pings to send in each run" default:"5"`
 	PingTimeout int `yaml:"probe-timeout" description:"Number of seconds to wait before considering the ICMP message unanswered" default:"1"`
+	ProbePacing int `yaml:"probe-pacing" description:"Number of milliseconds to wait between each probe packet sent to a target" default:"1000"`
 	Interval    int `yaml:"probe-interval" description:"Number of seconds wait between each optimizer run" default:"120"`
 	CacheSize   int `yaml:"cache-size" description:"Number of probe results to store per peer" default:"15"`
 
+	ProbeConcurrency int `yaml:"probe-concurrency" description:"Maximum number of source/target pairs to probe at once" default:"1" validate:"min=1"`
+
 	ProbeUDPMode bool `yaml:"probe-udp" description:"Use UDP probe (else ICMP)" default:"false"`
 
-	AlertScript string `yaml:"alert-script" description:"Script to call on optimizer event"`
+	AlertScript     string `yaml:"alert-script" description:"Script to call on optimizer events and healthcheck state changes (with the alert and, if captured, the path to the target as arguments)"`
+	WebhookURL      string `yaml:"webhook-url" description:"URL to POST optimizer events to as JSON"`
+	AlertmanagerURL string `yaml:"alertmanager-url" description:"Prometheus Alertmanager base URL to send optimizer alerts to"`
+	AlertTimeout    int    `yaml:"alert-timeout" description:"Webhook and Alertmanager request timeout in seconds" default:"10"`
 
+	Traceroute        bool   `yaml:"traceroute" description:"Capture the path to affected targets when a peer is depreferred" default:"false"`
+	TracerouteBinary  string `yaml:"traceroute-binary" description:"Path capture binary (mtr or traceroute)" default:"mtr"`
+	TracerouteCycles  int    `yaml:"traceroute-cycles" description:"Number of mtr report cycles" default:"5"`
+	TracerouteTimeout int    `yaml:"traceroute-timeout" description:"Path capture timeout in seconds" default:"60"`
+
+	DecisionHistory int `yaml:"decision-history" description:"Number of depreference and restore decisions to keep for optimizer status" default:"100"`
+
+	BlackoutWindows []BlackoutWindow `yaml:"blackout-windows" description:"Maintenance windows during which probes are collected but policy changes and alerts are suppressed" validate:"dive"`
+
+	ReportOnly      bool `yaml:"report-only" description:"Measure and alert on threshold violations without modifying BIRD policy" default:"false"`
 	ExitOnCacheFull bool `yaml:"exit-on-cache-full" description:"Exit optimizer on cache full" default:"false"`
 
-	Db map[string][]ProbeResult `yaml:"-" description:"-"`
+	Db          map[string][]ProbeResult `yaml:"-" description:"-"`
+	Depreferred map[string]int64         `yaml:"-" description:"-"` // Peer to UNIX time when it was depreferred
+}
+
+// InfluxDB stores the InfluxDB history writer configuration
+type InfluxDB struct {
+	URL         string `yaml:"url" description:"InfluxDB URL (disabled if empty)" default:""`
+	Token       string `yaml:"token" description:"InfluxDB v2 API token" default:""`
+	Org         string `yaml:"org" description:"InfluxDB v2 organization" default:""`
+	Bucket      string `yaml:"bucket" description:"InfluxDB v2 bucket" default:""`
+	Database    string `yaml:"database" description:"InfluxDB v1 database (uses the v1 write API if set)" default:""`
+	Measurement string `yaml:"measurement" description:"Measurement name prefix" default:"pathvector"`
+	Timeout     uint   `yaml:"timeout" description:"InfluxDB write timeout in seconds" default:"5"`
+}
+
+// ClickHouse stores the ClickHouse history writer configuration
+type ClickHouse struct {
+	URL          string `yaml:"url" description:"ClickHouse HTTP interface URL (disabled if empty)" default:""`
+	Username     string `yaml:"username" description:"ClickHouse username" default:""`
+	Password     string `yaml:"password" description:"ClickHouse password" default:""`
+	Database     string `yaml:"database" description:"ClickHouse database" default:"default"`
+	ProbeTable   string `yaml:"probe-table" description:"Table to insert probe results into" default:"pathvector_probes"`
+	SessionTable string `yaml:"session-table" description:"Table to insert session changes into" default:"pathvector_sessions"`
+	CreateTables bool   `yaml:"create-tables" description:"Create the tables if they don't exist" default:"false"`
+	Timeout      uint   `yaml:"timeout" description:"ClickHouse write timeout in seconds" default:"5"`
+}
+
+// History stores the optimizer and session history configuration
+type History struct {
+	Listen          string     `yaml:"listen" description:"Address to serve the history API on while the optimizer is running (disabled if empty)" default:""`
+	MaxEntries      int        `yaml:"max-entries" description:"Maximum number of probe results and session changes to keep in memory" default:"10000"`
+	SessionInterval uint       `yaml:"session-interval" description:"Interval in seconds to poll BIRD for session state changes" default:"10"`
+	InfluxDB        InfluxDB   `yaml:"influxdb" description:"InfluxDB writer"`
+	ClickHouse      ClickHouse `yaml:"clickhouse" description:"ClickHouse writer"`
+}
+
+// RemoteLog stores a remote log endpoint
+type RemoteLog struct {
+	Address string `yaml:"address" description:"Remote host:port (disabled if empty)" default:""`
+	Network string `yaml:"network" description:"Transport protocol (udp or tcp)" default:"udp" validate:"oneof=udp tcp"`
+}
+
+// Logging stores the pathvector log output configuration
+type Logging struct {
+	Format      string            `yaml:"format" description:"Log format (text or json)" default:"text" validate:"oneof=text json"`
+	SyslogTag   string            `yaml:"syslog-tag" description:"Syslog tag" default:"pathvector"`
+	Levels      map[string]string `yaml:"levels" description:"Log levels (trace, debug, info, warning or error) for individual subsystems (config, irr, peeringdb, optimizer, bird and harness), overriding the global verbosity once the config is loaded"`
+	Syslog      RemoteLog         `yaml:"syslog" description:"Remote syslog endpoint"`
+	SyslogLocal bool              `yaml:"syslog-local" description:"Send logs to the local syslog daemon (/dev/log, or /var/run/log on FreeBSD)" default:"false"`
+	GELF        RemoteLog         `yaml:"gelf" description:"GELF endpoint"`
+
+	RunDirectory string `yaml:"run-directory" description:"Directory to write a log file for each generate run to (disabled if empty)" default:""`
+	RunLogs      uint   `yaml:"run-logs" description:"Number of per-run log files to keep (unlimited if zero)" default:"100"`
+}
+
+// AuthUser stores a single web UI and API user
+type AuthUser struct {
+	Password string `yaml:"password" description:"bcrypt hash of the user's password" validate:"required"`
+	Role     string `yaml:"role" description:"User role ('read-only' or 'operator')" default:"read-only"`
+}
+
+// AuthToken stores a single static API token
+type AuthToken struct {
+	Token string `yaml:"token" description:"Bearer token value" validate:"required"`
+	Role  string `yaml:"role" description:"Token role ('read-only' or 'operator')" default:"read-only"`
+}
+
+// OIDC stores OpenID Connect login configuration
+type OIDC struct {
+	Issuer         string   `yaml:"issuer" description:"OIDC issuer URL (disabled if empty)" default:""`
+	ClientID       string   `yaml:"client-id" description:"OIDC client ID" default:""`
+	ClientSecret   string   `yaml:"client-secret" description:"OIDC client secret" default:""`
+	RedirectURL    string   `yaml:"redirect-url" description:"OIDC redirect URL (ending in /auth/callback)" default:""`
+	RoleClaim      string   `yaml:"role-claim" description:"ID token claim containing the user's groups" default:"groups"`
+	OperatorGroups []string `yaml:"operator-groups" description:"Groups granted the operator role (all other users are read-only)"`
+}
+
+// Auth stores web UI and API authentication configuration
+type Auth struct {
+	Users      map[string]*AuthUser  `yaml:"users" description:"Map of username to user"`
+	Tokens     map[string]*AuthToken `yaml:"tokens" description:"Map of token name to API token"`
+	OIDC       OIDC                  `yaml:"oidc" description:"OpenID Connect login options"`
+	SessionKey string                `yaml:"session-key" description:"Key used to sign login session cookies (random if empty)" default:""`
+}
+
+// API stores control API listener configuration
+type API struct {
+	Listen string `yaml:"listen" description:"TCP address to serve the control API on (disabled if empty)" default:""`
+	Socket string `yaml:"socket" description:"UNIX socket to serve the control API on (disabled if empty)" default:""`
+
+	GRPCListen string `yaml:"grpc-listen" description:"TCP address to serve the gRPC control API on (disabled if empty)" default:""`
+	GRPCSocket string `yaml:"grpc-socket" description:"UNIX socket to serve the gRPC control API on (disabled if empty)" default:""`
+}
+
+// NetBox stores NetBox data source configuration
+type NetBox struct {
+	URL          string `yaml:"url" description:"NetBox URL (disabled if empty)" default:""`
+	Token        string `yaml:"token" description:"NetBox API token" default:""`
+	Device       string `yaml:"device" description:"NetBox device name to pull BGP sessions for (default hostname)" default:""`
+	Template     string `yaml:"template" description:"Peer template for sessions without a peer group matching a template name" default:""`
+	PrefixTag    string `yaml:"prefix-tag" description:"Originate NetBox prefixes with this tag (disabled if empty)" default:""`
+	QueryTimeout uint   `yaml:"query-timeout" description:"NetBox query timeout in seconds" default:"10"`
+}
+
+// IXPManager stores IXP Manager route server client source configuration
+type IXPManager struct {
+	URL          string `yaml:"url" description:"IXP Manager URL (disabled if empty)" default:""`
+	Key          string `yaml:"key" description:"IXP Manager API key" default:""`
+	IXPID        int    `yaml:"ixp-id" description:"IX-F IXP ID to generate clients for (all if zero)" default:"0"`
+	VLANID       int    `yaml:"vlan-id" description:"IX-F VLAN ID to generate clients for (all if zero)" default:"0"`
+	Template     string `yaml:"template" description:"Peer template to apply to route server clients (rs-client and filter-irr default to true unless the template sets them)" default:""`
+	ExcludeASNs  []int  `yaml:"exclude-asns" description:"List of member ASNs to not generate route server clients for"`
+	QueryTimeout uint   `yaml:"query-timeout" description:"IXP Manager query timeout in seconds" default:"10"`
+}
+
+// BirdLG stores bird-lg-go looking glass configuration
+type BirdLG struct {
+	FrontendFile   string   `yaml:"frontend-file" description:"File to write the bird-lg-go frontend config to (disabled if empty)" default:""`
+	ProxyFile      string   `yaml:"proxy-file" description:"File to write the bird-lg-go proxy config to (disabled if empty)" default:""`
+	Servers        []string `yaml:"servers" description:"Additional looking glass nodes (this router's hostname is always included)"`
+	Domain         string   `yaml:"domain" description:"Domain appended to node names to reach their proxies" default:""`
+	Listen         string   `yaml:"listen" description:"Frontend listen address" default:":5000"`
+	ProxyListen    string   `yaml:"proxy-listen" description:"Proxy listen address" default:":8000"`
+	ProxyPort      int      `yaml:"proxy-port" description:"Port the frontend uses to reach proxies" default:"8000"`
+	AllowedIPs     []string `yaml:"allowed-ips" description:"List of frontend IPs allowed to query the proxy (all if empty)"`
+	ProtocolFilter []string `yaml:"protocol-filter" description:"List of protocol types to show in the summary table (all if empty)"`
+	Title          string   `yaml:"title" description:"Looking glass title" default:""`
+	Traceroute     bool     `yaml:"traceroute" description:"Should the traceroute command be allowed?" default:"true"`
+}
+
+// PortalProvision stores the peering portal peer provisioning configuration
+type PortalProvision struct {
+	Enabled             bool     `yaml:"enabled" description:"Should approved peer requests be pulled from the peering portal?" default:"false"`
+	Template            string   `yaml:"template" description:"Template to apply to provisioned peers if the request doesn't set one" default:""`
+	Templates           []string `yaml:"templates" description:"Templates that requests may select, skipping requests for any other template (the template of a request is ignored if empty)"`
+	RequireConfirmation bool     `yaml:"require-confirmation" description:"Should approved requests be held until confirmed with pathvector portal-requests --confirm?" default:"false"`
+	StateFile           string   `yaml:"state-file" description:"File to store confirmed request IDs in" default:"/var/lib/pathvector/portal-confirmed.json"`
+	InsecureSkipVerify  bool     `yaml:"insecure-skip-verify" description:"Don't verify the portal server's TLS certificate when pulling requests" default:"false"`
+}
+
+// Visibility stores the post-apply external visibility check configuration
+type Visibility struct {
+	Enabled      bool   `yaml:"enabled" description:"Should originated prefix visibility be checked after applying?" default:"false"`
+	Source       string `yaml:"source" description:"Visibility data source (ripestat, bgp.tools, or routeviews for IPv4 prefixes only)" default:"ripestat" validate:"oneof=ripestat bgp.tools routeviews"`
+	Delay        uint   `yaml:"delay" description:"Seconds to wait for propagation after applying before checking" default:"60"`
+	MinPeers     int    `yaml:"min-peers" description:"Minimum number of RIS peers that must see each prefix (ripestat only)" default:"10"`
+	StateFile    string `yaml:"state-file" description:"File to store the last results in to detect disappeared announcements" default:"/var/run/pathvector/visibility.json"`
+	WebhookURL   string `yaml:"webhook-url" description:"URL to POST visibility regressions to as JSON (disabled if empty)" default:""`
+	QueryTimeout uint   `yaml:"query-timeout" description:"Visibility query timeout in seconds" default:"10"`
+}
+
+// TCPAOKey stores a TCP-AO master key
+type TCPAOKey struct {
+	SendID    uint8  `yaml:"send-id" description:"Key ID sent to the neighbor"`
+	RecvID    uint8  `yaml:"recv-id" description:"Key ID expected from the neighbor"`
+	Secret    string `yaml:"secret" description:"Master key secret" validate:"required"`
+	Algorithm string `yaml:"algorithm" description:"MAC algorithm ('hmac-md5', 'hmac-sha1', 'hmac-sha224', 'hmac-sha256', 'hmac-sha384', 'hmac-sha512' or 'cmac-aes128')" default:"hmac-sha1" validate:"oneof=hmac-md5 hmac-sha1 hmac-sha224 hmac-sha256 hmac-sha384 hmac-sha512 cmac-aes128"`
+	Preferred bool   `yaml:"preferred" description:"Should this key be used to send segments? (the first key if none are preferred)"`
+
+	BIRDAlgorithm string `yaml:"-" description:"-"`
+}
+
+// TCPAOKeyChain stores the TCP-AO keys of a session, which can be rotated by adding a key and marking it preferred
+type TCPAOKeyChain struct {
+	Keys []*TCPAOKey `yaml:"keys" description:"List of TCP-AO master keys" validate:"required,min=1"`
+}
+
+// VXLAN stores the EVPN route distinguisher and route targets of a VXLAN segment
+type VXLAN struct {
+	VNI                uint32   `yaml:"vni" description:"VXLAN network identifier of the segment's kernel VXLAN interface" validate:"required,max=16777215"`
+	RouteDistinguisher string   `yaml:"route-distinguisher" description:"Route distinguisher (ASN:value or IPv4:value) of the segment's EVPN routes (router-id:VNI if empty)"`
+	ImportTargets      []string `yaml:"import-targets" description:"Route targets (ASN:value or IPv4:value) of EVPN routes to import into the segment (ASN:VNI if empty)"`
+	ExportTargets      []string `yaml:"export-targets" description:"Route targets (ASN:value or IPv4:value) to add to the segment's EVPN routes (ASN:VNI if empty)"`
+}
+
+// VRF stores a Linux VRF with its own routing tables, originated prefixes, and peers, optionally exchanging routes with MPLS L3VPN peers
+type VRF struct {
+	Interface          string   `yaml:"interface" description:"Linux VRF interface" validate:"required"`
+	KernelTable        uint     `yaml:"kernel-table" description:"Kernel routing table of the VRF interface to export the VRF's routes to" validate:"required"`
+	Source4            string   `yaml:"source4" description:"Source IPv4 address of BGP routes exported to the VRF's kernel table" validate:"omitempty,ipv4"`
+	Source6            string   `yaml:"source6" description:"Source IPv6 address of BGP routes exported to the VRF's kernel table" validate:"omitempty,ipv6"`
+	Prefixes           []string `yaml:"prefixes" description:"List of prefixes to originate in the VRF and announce to its peers" validate:"dive,cidr"`
+	ImportMaster       bool     `yaml:"import-master" description:"Should routes from the master tables be piped into the VRF's tables?"`
+	RouteDistinguisher string   `yaml:"route-distinguisher" description:"Route distinguisher (ASN:value or IPv4:value) of routes exported from the VRF to L3VPN peers (no L3VPN if empty)"`
+	ImportTargets      []string `yaml:"import-targets" description:"Route targets (ASN:value or IPv4:value) of VPN routes to import into the VRF" validate:"required_with=RouteDistinguisher"`
+	ExportTargets      []string `yaml:"export-targets" description:"Route targets (ASN:value or IPv4:value) to add to routes exported from the VRF" validate:"required_with=RouteDistinguisher"`
+
+	ProtocolName            string   `yaml:"-" description:"-"`
+	TableName               string   `yaml:"-" description:"-"`
+	Prefixes4               []string `yaml:"-" description:"-"`
+	Prefixes6               []string `yaml:"-" description:"-"`
+	ImportTargetCommunities []string `yaml:"-" description:"-"`
+	ExportTargetCommunities []string `yaml:"-" description:"-"`
+}
+
+// FlowSpecRule stores an RFC 8955 flowspec rule matching traffic to a destination prefix
+type FlowSpecRule struct {
+	Destination      string   `yaml:"destination" description:"Destination prefix to match" validate:"required,cidr"`
+	Source           string   `yaml:"source" description:"Source prefix to match (any source if empty)" validate:"omitempty,cidr"`
+	Protocols        []uint8  `yaml:"protocols" description:"IP protocols (IPv6 next headers) to match, such as 6 for TCP and 17 for UDP"`
+	SourcePorts      []string `yaml:"source-ports" description:"Source ports or port ranges such as 1024-65535 to match"`
+	DestinationPorts []string `yaml:"destination-ports" description:"Destination ports or port ranges such as 1024-65535 to match"`
+	Action           string   `yaml:"action" description:"Action for matching traffic ('discard', 'rate-limit' or 'redirect')" default:"discard" validate:"oneof=discard rate-limit redirect"`
+	RateLimit        uint32   `yaml:"rate-limit" description:"Maximum rate in bytes per second of matching traffic for the rate-limit action"`
+	Redirect         string   `yaml:"redirect" description:"Route target (ASN:value) of the VRF to redirect matching traffic to for the redirect action"`
+
+	AF        string `yaml:"-" description:"-"`
+	Match     string `yaml:"-" description:"-"`
+	Community string `yaml:"-" description:"-"`
+}
+
+// ActionCommunities stores the large communities that control how routes are exported, as (asn, action, peer ASN) to act on a single peer or (asn, action, 0) to act on all peers
+type ActionCommunities struct {
+	Enabled    bool   `yaml:"enabled" description:"Should routes be exported according to their action communities?" default:"false"`
+	ASN        uint32 `yaml:"asn" description:"First part of the action communities (router ASN if 0)" default:"0"`
+	NoAnnounce uint32 `yaml:"no-announce" description:"Second part of the action communities to not announce the route to the peer" default:"1000" validate:"min=1"`
+	Prepend1   uint32 `yaml:"prepend-1" description:"Second part of the action communities to prepend the local ASN once when announcing the route to the peer" default:"2000" validate:"min=1"`
+	Prepend2   uint32 `yaml:"prepend-2" description:"Second part of the action communities to prepend the local ASN twice when announcing the route to the peer" default:"3000" validate:"min=1"`
+	Prepend3   uint32 `yaml:"prepend-3" description:"Second part of the action communities to prepend the local ASN three times when announcing the route to the peer" default:"4000" validate:"min=1"`
+	NoExport   uint32 `yaml:"no-export" description:"Second part of the action communities to add the well-known NO_EXPORT community when announcing the route to the peer" default:"5000" validate:"min=1"`
+}
+
+// OSPFInterface stores the options of an interface in an OSPF area
+type OSPFInterface struct {
+	Cost           uint   `yaml:"cost" description:"Interface cost (BIRD default of 10 if 0)" default:"0" validate:"max=65535"`
+	Type           string `yaml:"type" description:"Network type (broadcast, ptp, ptmp, or nbma), detected from the interface if empty" validate:"omitempty,oneof=broadcast ptp ptmp nbma"`
+	Passive        bool   `yaml:"passive" description:"Should the interface's prefixes be advertised without sending hellos or forming adjacencies?" default:"false"`
+	Hello          uint   `yaml:"hello" description:"Hello interval in seconds (BIRD default of 10 if 0)" default:"0"`
+	Dead           uint   `yaml:"dead" description:"Router dead interval in seconds (4 hello intervals if 0)" default:"0"`
+	Authentication string `yaml:"authentication" description:"Authentication (none, simple for OSPFv2 only, or cryptographic)" default:"none" validate:"oneof=none simple cryptographic"`
+	Password       string `yaml:"password" description:"Authentication password" validate:"required_unless=Authentication none"`
+}
+
+// OSPFArea stores an OSPF area
+type OSPFArea struct {
+	Stub       bool                      `yaml:"stub" description:"Is this a stub area, which receives no external routes?"`
+	Interfaces map[string]*OSPFInterface `yaml:"interfaces" description:"Map of interface names or patterns (such as eth*) to their options" validate:"required"`
+}
+
+// OSPF stores the OSPFv2 and OSPFv3 IGPs, which run on the same areas and interfaces and use the master tables
+type OSPF struct {
+	OSPFv2       bool                 `yaml:"ospfv2" description:"Should OSPFv2 be run for IPv4?" default:"true"`
+	OSPFv3       bool                 `yaml:"ospfv3" description:"Should OSPFv3 be run for IPv6?" default:"true"`
+	Areas        map[string]*OSPFArea `yaml:"areas" description:"Map of area IDs (such as 0 or 0.0.0.1) to areas (OSPF is disabled if empty)"`
+	Redistribute []string             `yaml:"redistribute" description:"Route sources to redistribute into OSPF as external routes (static, direct, kernel, or bgp)" validate:"dive,oneof=static direct kernel bgp"`
+
+	RedistributeSources []string `yaml:"-" description:"-"`
+}
+
+// BabelInterface stores the options of a Babel interface
+type BabelInterface struct {
+	Type          string `yaml:"type" description:"Interface type (wired or wireless), which sets the link quality estimation and default costs" default:"wired" validate:"oneof=wired wireless"`
+	RxCost        uint   `yaml:"rxcost" description:"Cost of receiving on the interface (BIRD default for the type if 0)" default:"0" validate:"max=65535"`
+	HelloInterval uint   `yaml:"hello-interval" description:"Hello interval in seconds (BIRD default for the type if 0)" default:"0"`
+}
+
+// Babel stores the Babel IGP, which runs on the master tables (BIRD only)
+type Babel struct {
+	Interfaces   map[string]*BabelInterface `yaml:"interfaces" description:"Map of interface names or patterns (such as wg*) to their options (Babel is disabled if empty)"`
+	Redistribute []string                   `yaml:"redistribute" description:"Route sources to redistribute into Babel (static, direct, kernel, or bgp)" validate:"dive,oneof=static direct kernel bgp"`
+
+	RedistributeSources []string `yaml:"-" description:"-"`
+}
+
+// ISISInterface stores the options of an IS-IS interface
+type ISISInterface struct {
+	Metric       uint `yaml:"metric" description:"Interface metric (FRR default of 10 if 0)" default:"0" validate:"max=16777215"`
+	Passive      bool `yaml:"passive" description:"Should the interface's prefixes be advertised without sending hellos or forming adjacencies?" default:"false"`
+	PointToPoint bool `yaml:"point-to-point" description:"Should the interface be a point-to-point circuit instead of a broadcast circuit?" default:"false"`
+}
+
+// ISIS stores the IS-IS IGP for IPv4 and IPv6 (FRR only)
+type ISIS struct {
+	NET          string                    `yaml:"net" description:"Network entity title, such as 49.0001.1920.0000.2001.00" validate:"required_with=Interfaces"`
+	Level        string                    `yaml:"level" description:"Routing level (level-1, level-1-2, or level-2-only)" default:"level-2-only" validate:"oneof=level-1 level-1-2 level-2-only"`
+	Interfaces   map[string]*ISISInterface `yaml:"interfaces" description:"Map of interface names to their options (IS-IS is disabled if empty)"`
+	Redistribute []string                  `yaml:"redistribute" description:"Route sources to redistribute into IS-IS (static, direct, kernel, or bgp)" validate:"dive,oneof=static direct kernel bgp"`
+
+	RedistributeLevel     string   `yaml:"-" description:"-"`
+	RedistributeProtocols []string `yaml:"-" description:"-"`
+}
+
+// FleetRouter stores a router managed by fleet mode
+type FleetRouter struct {
+	Host   string `yaml:"host" description:"SSH address of the router, optionally with a port" default:""`
+	User   string `yaml:"user" description:"SSH username" default:"root"`
+	Config string `yaml:"config" description:"Pathvector config file for this router, relative to the fleet file" validate:"required"`
+	SSHKey string `yaml:"ssh-key" description:"SSH private key file (overrides the fleet ssh-key)" default:""`
+	Agent  bool   `yaml:"agent" description:"Should this router pull its config with pathvector agent instead of being pushed to over SSH?" default:"false"`
+}
+
+// FleetController stores the server configuration for agents pulling config from the fleet controller
+type FleetController struct {
+	Listen     string `yaml:"listen" description:"Address to serve config bundles to agents on" default:":8443"`
+	TLSCert    string `yaml:"tls-cert" description:"Controller TLS certificate file" default:""`
+	TLSKey     string `yaml:"tls-key" description:"Controller TLS private key file" default:""`
+	ClientCA   string `yaml:"client-ca" description:"CA certificate file to verify agent client certificates against" default:""`
+	SigningKey string `yaml:"signing-key" description:"Ed25519 private key file (PKCS #8 PEM) to sign config bundles with" default:""`
+}
+
+// Fleet stores the fleet mode configuration
+type Fleet struct {
+	SSHKey         string `yaml:"ssh-key" description:"SSH private key file" default:"~/.ssh/id_ed25519"`
+	KnownHosts     string `yaml:"known-hosts" description:"SSH known hosts file to verify routers against" default:"~/.ssh/known_hosts"`
+	CacheDirectory string `yaml:"cache-directory" description:"Directory to render router configs into before pushing" default:"/var/run/pathvector/fleet"`
+	BIRDCBinary    string `yaml:"birdc-binary" description:"Path to birdc on the routers" default:"birdc"`
+	ConnectTimeout uint   `yaml:"connect-timeout" description:"SSH connect timeout in seconds" default:"10"`
+
+	Controller FleetController         `yaml:"controller" description:"Controller server for agents"`
+	Routers    map[string]*FleetRouter `yaml:"routers" description:"Routers managed by this fleet"`
+}
+
+// Agent stores the agent mode configuration
+type Agent struct {
+	Controller       string `yaml:"controller" description:"Fleet controller URL" validate:"required"`
+	TLSCert          string `yaml:"tls-cert" description:"Agent client TLS certificate file, with the router name as the common name" validate:"required"`
+	TLSKey           string `yaml:"tls-key" description:"Agent client TLS private key file" validate:"required"`
+	CA               string `yaml:"ca" description:"CA certificate file to verify the controller against" validate:"required"`
+	SigningPublicKey string `yaml:"signing-public-key" description:"Ed25519 public key file (PEM) to verify config bundles with" validate:"required"`
+	Interval         uint   `yaml:"interval" description:"Seconds between config fetches" default:"60"`
+	CacheDirectory   string `yaml:"cache-directory" description:"Directory to store bundles in before validating and applying them" default:"/var/run/pathvector/agent"`
+	BIRDDirectory    string `yaml:"bird-directory" description:"Directory to store BIRD configs" default:"/etc/bird/"`
+	BIRDBinary       string `yaml:"bird-binary" description:"Path to BIRD binary" default:"/usr/sbin/bird"`
+	BIRDSocket       string `yaml:"bird-socket" description:"UNIX control socket for BIRD" default:"/run/bird/bird.ctl"`
+}
+
+// TestRoute stores a route for the test peer to announce and the expected result
+type TestRoute struct {
+	Prefix            string   `yaml:"prefix" description:"Prefix to announce" validate:"required,cidr"`
+	ASPath            []uint32 `yaml:"as-path" description:"ASNs to add to the AS path after the peer's ASN" default:"-"`
+	Communities       []string `yaml:"communities" description:"Standard and large communities to announce the route with" default:"-"`
+	Expect            string   `yaml:"expect" description:"Expected import result (accept or reject)" default:"accept" validate:"oneof=accept reject"`
+	ExpectCommunities []string `yaml:"expect-communities" description:"Standard and large communities the imported route must have" default:"-"`
+	ExpectLocalPref   uint     `yaml:"expect-local-pref" description:"Local preference the imported route must have (unchecked if zero)" default:"0"`
+
+	StandardCommunities       []string `yaml:"-" description:"-"`
+	LargeCommunities          []string `yaml:"-" description:"-"`
+	ExpectStandardCommunities []string `yaml:"-" description:"-"`
+	ExpectLargeCommunities    []string `yaml:"-" description:"-"`
+}
+
+// TestSpec stores an end-to-end test of a config
+type TestSpec struct {
+	Peer    string       `yaml:"peer" description:"Peer to run a test peer for (only the config is loaded if empty)"`
+	Timeout uint         `yaml:"timeout" description:"Seconds to wait for sessions to establish and routes to be received" default:"60"`
+	Routes  []*TestRoute `yaml:"routes" description:"Routes for the test peer to announce"`
+}
+
+// RTRServer stores an RPKI-to-router cache server
+type RTRServer struct {
+	Server        string `yaml:"server" description:"RTR server as host:port" validate:"required"`
+	Preference    uint   `yaml:"preference" description:"Cache preference from 1 to 255, lower values are preferred (FRR only, BIRD and OpenBGPD use all servers at once)" default:"1" validate:"min=1,max=255"`
+	Transport     string `yaml:"transport" description:"RTR transport ('tcp' or 'ssh')" default:"tcp" validate:"oneof=tcp ssh"`
+	SSHUser       string `yaml:"ssh-user" description:"SSH username for the ssh transport"`
+	SSHPrivateKey string `yaml:"ssh-private-key" description:"Path to the router's SSH private key for the ssh transport"`
+	SSHKnownHosts string `yaml:"ssh-known-hosts" description:"Path to a known hosts file with the RTR server's SSH public key (the daemon's default if empty)"`
+
+	Host string `yaml:"-" description:"-"`
+	Port int    `yaml:"-" description:"-"`
 }
 
 // Config stores the global configuration
 type Config struct {
 	PeeringDBQueryTimeout uint   `yaml:"peeringdb-query-timeout" description:"PeeringDB query timeout in seconds" default:"10"`
+	PeeringDBCacheTTL     uint   `yaml:"peeringdb-cache-ttl" description:"Seconds to reuse PeeringDB responses cached in the cache directory before querying again (disabled if 0)" default:"0"`
+	PeeringDBAPIKey       string `yaml:"peeringdb-api-key" description:"PeeringDB API key for authenticated queries with a higher rate limit (PEERINGDB_API_KEY environment variable if empty)" default:""`
 	IRRQueryTimeout       uint   `yaml:"irr-query-timeout" description:"IRR query timeout in seconds" default:"30"`
+	IRRCacheTTL           uint   `yaml:"irr-cache-ttl" description:"Seconds to reuse IRR prefix lists cached in the cache directory before querying again (disabled if 0)" default:"0"`
+	MaxConcurrentQueries  int    `yaml:"max-concurrent-queries" description:"Maximum number of PeeringDB and IRR queries to run at once" default:"1" validate:"min=1"`
+	UpdateInterval        uint   `yaml:"update-interval" description:"Interval in seconds between runs of the pathvector daemon command" default:"3600" validate:"min=1"`
+	UpdateJitter          uint   `yaml:"update-jitter" description:"Maximum random delay in seconds added to each pathvector daemon run" default:"300"`
+	UpdateRetry           uint   `yaml:"update-retry" description:"Delay in seconds before retrying a failed pathvector daemon run, doubling on each consecutive failure up to update-interval" default:"60" validate:"min=1"`
 	BIRDDirectory         string `yaml:"bird-directory" description:"Directory to store BIRD configs" default:"/etc/bird/"`
 	BIRDBinary            string `yaml:"bird-binary" description:"Path to BIRD binary" default:"/usr/sbin/bird"`
 	BIRDSocket            string `yaml:"bird-socket" description:"UNIX control socket for BIRD" default:"/run/bird/bird.ctl"`
+	Daemon                string `yaml:"daemon" description:"Routing daemon to render configuration for ('bird', 'frr' or 'openbgpd')" default:"bird" validate:"oneof=bird frr openbgpd"`
+	FRRConfig             string `yaml:"frr-config" description:"Configuration file for FRRouting" default:"/etc/frr/frr.conf"`
+	VtyshBinary           string `yaml:"vtysh-binary" description:"Path to vtysh binary, used to validate the FRRouting config" default:"vtysh"`
+	FRRReload             string `yaml:"frr-reload" description:"How to reload FRRouting after writing the config ('systemd', 'rc' for the BSD rc system or 'none')" default:"systemd" validate:"oneof=systemd rc none"`
+	OpenBGPDConfig        string `yaml:"openbgpd-config" description:"Configuration file for OpenBGPD" default:"/etc/bgpd.conf"`
+	OpenBGPDBinary        string `yaml:"openbgpd-binary" description:"Path to bgpd binary, used to validate the OpenBGPD config" default:"bgpd"`
+	BgpctlBinary          string `yaml:"bgpctl-binary" description:"Path to bgpctl binary, used to reload OpenBGPD" default:"bgpctl"`
 	CacheDirectory        string `yaml:"cache-directory" description:"Directory to store runtime configuration cache" default:"/var/run/pathvector/cache/"`
 	KeepalivedConfig      string `yaml:"keepalived-config" description:"Configuration file for keepalived" default:"/etc/keepalived.conf"`
+	KeepalivedBinary      string `yaml:"keepalived-binary" description:"Path to keepalived binary, used to validate the config" default:"keepalived"`
+	KeepalivedReload      string `yaml:"keepalived-reload" description:"How to reload keepalived after writing the config ('systemd', 'rc' for the BSD rc system, 'signal' or 'none')" default:"systemd" validate:"oneof=systemd rc signal none"`
+	KeepalivedPIDFile     string `yaml:"keepalived-pid-file" description:"keepalived PID file to signal when keepalived-reload is 'signal'" default:"/run/keepalived.pid"`
 	WebUIFile             string `yaml:"web-ui-file" description:"File to write web UI to (disabled if empty)" default:""`
+	WebUIListen           string `yaml:"web-ui-listen" description:"Address to serve the web UI on (disabled if empty)" default:""`
+	MetricsListen         string `yaml:"metrics-listen" description:"Address to serve Prometheus metrics on with the metrics command or while the optimizer is running, such as :9877 (disabled if empty)" default:""`
+	NeighborsFile         string `yaml:"neighbors-file" description:"File to write birdwatcher/Alice-LG compatible neighbor metadata JSON to (disabled if empty)" default:""`
 	LogFile               string `yaml:"log-file" description:"Log file location" default:"syslog"`
+	LogFileMaxSize        uint   `yaml:"log-file-max-size" description:"Size in bytes at which BIRD moves the log file to log-file.1 and starts a new one (disabled if zero)" default:"0"`
+	LogFileMaxAge         uint   `yaml:"log-file-max-age" description:"Age in hours after which the log file is rotated on the next run (disabled if zero)" default:"0"`
+	LogFileBackups        uint   `yaml:"log-file-backups" description:"Number of log files rotated by age to keep" default:"1"`
 
 	PortalHost string `yaml:"portal-host" description:"Peering portal host (disabled if empty)" default:""`
 	PortalKey  string `yaml:"portal-key" description:"Peering portal API key" default:""`
 	Hostname   string `yaml:"hostname" description:"Router hostname (default system hostname)" default:""`
 
-	ASN              int      `yaml:"asn" description:"Autonomous System Number" validate:"required" default:"0"`
-	Prefixes         []string `yaml:"prefixes" description:"List of prefixes to announce"`
-	Communities      []string `yaml:"communities" description:"List of RFC1997 BGP communities"`
-	LargeCommunities []string `yaml:"large-communities" description:"List of RFC8092 large BGP communities"`
-
-	RouterID      string `yaml:"router-id" description:"Router ID (dotted quad notation)" validate:"required"`
-	IRRServer     string `yaml:"irr-server" description:"Internet routing registry server" default:"rr.ntt.net"`
-	RTRServer     string `yaml:"rtr-server" description:"RPKI-to-router server" default:"rtr.rpki.cloudflare.com:8282"`
-	BGPQArgs      string `yaml:"bgpq-args" description:"Additional command line arguments to pass to bgpq4" default:""`
-	KeepFiltered  bool   `yaml:"keep-filtered" description:"Should filtered routes be kept in memory?" default:"false"`
-	KernelLearn   bool   `yaml:"kernel-learn" description:"Should routes from the kernel be learned into BIRD?" default:"false"`
-	KernelExport  bool   `yaml:"kernel-export" description:"Export routes to kernel routing table" default:"true"`
-	MergePaths    bool   `yaml:"merge-paths" description:"Should best and equivalent non-best routes be imported to build ECMP routes?" default:"false"`
-	Source4       string `yaml:"source4" description:"Source IPv4 address"`
-	Source6       string `yaml:"source6" description:"Source IPv6 address"`
-	DefaultRoute  bool   `yaml:"default-route" description:"Add a default route" default:"true"`
-	AcceptDefault bool   `yaml:"accept-default" description:"Should default routes be added to the bogon list?" default:"false"`
-	KernelTable   int    `yaml:"kernel-table" description:"Kernel table"`
-	RPKIEnable    bool   `yaml:"rpki-enable" description:"Enable RPKI RTR session" default:"true"`
-
-	Peers         map[string]*Peer         `yaml:"peers" description:"BGP peer configuration"`
-	Templates     map[string]*Peer         `yaml:"templates" description:"BGP peer templates"`
-	VRRPInstances map[string]*VRRPInstance `yaml:"vrrp" description:"List of VRRP instances"`
-	BFDInstances  map[string]*BFDInstance  `yaml:"bfd" description:"BFD instances"`
-	Augments      Augments                 `yaml:"augments" description:"Custom configuration options"`
-	Optimizer     Optimizer                `yaml:"optimizer" description:"Route optimizer options"`
-
-	RTRServerHost string   `yaml:"-" description:"-"`
-	RTRServerPort int      `yaml:"-" description:"-"`
-	Prefixes4     []string `yaml:"-" description:"-"`
-	Prefixes6     []string `yaml:"-" description:"-"`
-	QueryNVRS     bool     `yaml:"-" description:"-"`
-	NVRSASNs      []uint32 `yaml:"-" description:"-"`
-}
-
-// categorizeCommunity checks if the community is in standard or large form, or an empty string if invalid
-func categorizeCommunity(input string) string {
-	// Test if it fits the criteria for a standard community
-	standardSplit := strings.Split(input, ",")
-	if len(standardSplit) == 2 {
-		firstPart, err := strconv.Atoi(standardSplit[0])
+	DescriptionTemplate  string `yaml:"description-template" description:"Description template for peers without a description (same variables as the peer description option)" default:"AS{{asn}} {{name}}"`
+	ProtocolNameTemplate string `yaml:"protocol-name-template" description:"BGP protocol name template ({{name}}, {{asn}}, {{class}} and {{af}} are replaced with the sanitized peer name, peer ASN, sanitized peer template name or PEER, and address family)" default:"{{name}}v{{af}}"`
+
+	ASN              int                     `yaml:"asn" description:"Autonomous System Number" validate:"required" default:"0"`
+	OriginPrefixes   []*OriginPrefix         `yaml:"prefixes" description:"List of prefixes to announce, as prefix strings or objects with route attributes"`
+	PrefixInterfaces map[string]string       `yaml:"prefix-interfaces" description:"Map of announced prefixes to interfaces, withdrawing the prefix when the interface loses carrier"`
+	PrefixGroups     map[string]*PrefixGroup `yaml:"prefix-groups" description:"Named groups of originated prefixes that peers can reference in announce-prefixes, as prefix lists or objects with tags"`
+	Tags             []string                `yaml:"tags" description:"Site or region tags of this router, used as the default tags of its peers"`
+	Communities      []string                `yaml:"communities" description:"List of RFC1997 BGP communities"`
+	LargeCommunities []string                `yaml:"large-communities" description:"List of RFC8092 large BGP communities"`
+
+	CommunityDefinitions map[string]string `yaml:"community-definitions" description:"Map of community names to standard or large communities, usable in place of community values in any community list"`
+
+	RouterID      string      `yaml:"router-id" description:"Router ID (dotted quad notation)" validate:"required"`
+	IRRServer     string      `yaml:"irr-server" description:"Internet routing registry server" default:"rr.ntt.net"`
+	IRRServers    []string    `yaml:"irr-servers" description:"Internet routing registry servers to query in order, falling back to the next server if a query fails (overrides irr-server)"`
+	IRRResolver   string      `yaml:"irr-resolver" description:"How to build IRR prefix lists ('native' to query the IRR server directly or 'bgpq4')" default:"bgpq4" validate:"oneof=native bgpq4"`
+	RTRServer     string      `yaml:"rtr-server" description:"RPKI-to-router server" default:"rtr.rpki.cloudflare.com:8282"`
+	RTRServers    []RTRServer `yaml:"rtr-servers" description:"Redundant RPKI-to-router servers with transport options (overrides rtr-server)" validate:"dive"`
+	BGPQArgs      string      `yaml:"bgpq-args" description:"Additional command line arguments to pass to bgpq4" default:""`
+	KeepFiltered  bool        `yaml:"keep-filtered" description:"Should filtered routes be kept in memory?" default:"false"`
+	KernelLearn   bool        `yaml:"kernel-learn" description:"Should routes from the kernel be learned into BIRD?" default:"false"`
+	KernelExport  bool        `yaml:"kernel-export" description:"Export routes to kernel routing table" default:"true"`
+	MergePaths    bool        `yaml:"merge-paths" description:"Should best and equivalent non-best routes be imported to build ECMP routes?" default:"false"`
+	Source4       string      `yaml:"source4" description:"Source IPv4 address"`
+	Source6       string      `yaml:"source6" description:"Source IPv6 address"`
+	DefaultRoute  bool        `yaml:"default-route" description:"Add a default route" default:"true"`
+	AcceptDefault bool        `yaml:"accept-default" description:"Should default routes be added to the bogon list?" default:"false"`
+	KernelTable   int         `yaml:"kernel-table" description:"Kernel table"`
+	RPKIEnable    bool        `yaml:"rpki-enable" description:"Enable RPKI RTR session" default:"true"`
+	RPKISLURMFile string      `yaml:"rpki-slurm-file" description:"RFC 8416 SLURM file of local filters and assertions to apply to ROAs from the RTR servers (disabled if empty)" default:""`
+
+	Peers               map[string]*Peer              `yaml:"peers" description:"BGP peer configuration"`
+	Templates           map[string]*Peer              `yaml:"templates" description:"BGP peer templates"`
+	VRRPInstances       map[string]*VRRPInstance      `yaml:"vrrp" description:"List of VRRP instances"`
+	VRRPSyncGroups      map[string]*VRRPSyncGroup     `yaml:"vrrp-sync-groups" description:"VRRP sync groups"`
+	BFDInstances        map[string]*BFDInstance       `yaml:"bfd" description:"BFD instances"`
+	TCPAOKeyChains      map[string]*TCPAOKeyChain     `yaml:"tcp-ao-key-chains" description:"Map of names to TCP-AO key chains for peers with tcp-ao-key-chain set"`
+	Healthchecks        map[string]*Healthcheck       `yaml:"healthchecks" description:"Service healthchecks that withdraw prefixes when failing"`
+	ConditionalPrefixes map[string]*ConditionalPrefix `yaml:"conditional-prefixes" description:"Map of prefixes to probes, originating each prefix only while its probe target is reachable"`
+	VRFs                map[string]*VRF               `yaml:"vrfs" description:"Map of names to VRFs with their own kernel tables and peers, whose routes can also be exchanged as L3VPN routes with peers that have vpn4-unicast or vpn6-unicast enabled"`
+	FlowSpecRules       map[string]*FlowSpecRule      `yaml:"flowspec-rules" description:"Map of names to RFC 8955 flowspec rules to announce to peers with flowspec enabled"`
+	Augments            Augments                      `yaml:"augments" description:"Custom configuration options"`
+	Optimizer           Optimizer                     `yaml:"optimizer" description:"Route optimizer options"`
+	History             History                       `yaml:"history" description:"Optimizer and session history export"`
+	Logging             Logging                       `yaml:"logging" description:"Log output options"`
+	Auth                Auth                          `yaml:"auth" description:"Web UI and API authentication"`
+	API                 API                           `yaml:"api" description:"Control API to trigger runs, query peer status, fetch config and enable or disable peers"`
+	NetBox              NetBox                        `yaml:"netbox" description:"NetBox peer and prefix source"`
+	IXPManager          IXPManager                    `yaml:"ixp-manager" description:"IXP Manager route server client source"`
+	BirdLG              BirdLG                        `yaml:"bird-lg" description:"bird-lg-go looking glass config generation"`
+	Visibility          Visibility                    `yaml:"visibility" description:"Post-apply external visibility check"`
+	PortalProvision     PortalProvision               `yaml:"portal-provision" description:"Peering portal peer provisioning"`
+	ActionCommunities   ActionCommunities             `yaml:"action-communities" description:"Large communities that customers can add to routes to control how they're exported to each peer"`
+	OSPF                OSPF                          `yaml:"ospf" description:"OSPFv2 and OSPFv3 IGP"`
+	Babel               Babel                         `yaml:"babel" description:"Babel IGP (BIRD only)"`
+	ISIS                ISIS                          `yaml:"isis" description:"IS-IS IGP (FRR only)"`
+
+	Prefixes                []string                 `yaml:"-" description:"-"`
+	OriginAttributes        map[string]*OriginPrefix `yaml:"-" description:"-"`
+	Prefixes4               []string                 `yaml:"-" description:"-"`
+	Prefixes6               []string                 `yaml:"-" description:"-"`
+	ConditionalPrefixes4    []string                 `yaml:"-" description:"-"`
+	ConditionalPrefixes6    []string                 `yaml:"-" description:"-"`
+	LinkPrefixes            map[string]*LinkPrefixes `yaml:"-" description:"-"`
+	ConfigHash              string                   `yaml:"-" description:"-"`
+	QueryNVRS               bool                     `yaml:"-" description:"-"`
+	ASPAEnable              bool                     `yaml:"-" description:"-"`
+	ASOverrideEnable        bool                     `yaml:"-" description:"-"`
+	RolesEnable             bool                     `yaml:"-" description:"-"`
+	FlowSpecEnable          bool                     `yaml:"-" description:"-"`
+	L3VPNEnable             bool                     `yaml:"-" description:"-"`
+	EVPNEnable              bool                     `yaml:"-" description:"-"`
+	IGPSources              []string                 `yaml:"-" description:"-"`
+	ISISAnnounced           bool                     `yaml:"-" description:"-"`
+	ConditionalHealthchecks map[string]*Healthcheck  `yaml:"-" description:"-"`
+	SLURM                   *slurm.File              `yaml:"-" description:"-"`
+	NVRSASNs                []uint32                 `yaml:"-" description:"-"`
+}
+
+// isisNETRegex matches an IS-IS network entity title with a 1 to 13 byte area, 6 byte system ID, and 00 selector
+var isisNETRegex = regexp.MustCompile(`^[0-9A-Fa-f]{2}(\.[0-9A-Fa-f]{4}){0,6}(\.[0-9A-Fa-f]{4}){3}\.00$`)
+
+// communitySeparator matches the separator between community parts, which may be either , or :
+var communitySeparator = regexp.MustCompile(`[,:]`)
+
+// parseExtendedCommunity parses the administrator and value of an RFC 4360 route target or route origin extended community, returning it in BIRD's comma notation
+func parseExtendedCommunity(kind string, parts []string) (string, error) {
+	if len(parts) != 2 {
+		return "", errors.New("extended communities must have a type (rt or ro), administrator, and value")
+	}
+	value, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return "", errors.New("parts must be numbers between 0 and 4294967295")
+	}
+
+	// The administrator is an IPv4 address or a 2 or 4 byte ASN, and the value fills the rest of the 6 bytes
+	if strings.Contains(parts[0], ".") {
+		ip := net.ParseIP(parts[0])
+		if ip == nil || ip.To4() == nil {
+			return "", fmt.Errorf("invalid IPv4 administrator %s", parts[0])
+		}
+		if value > 65535 {
+			return "", errors.New("extended communities with an IPv4 administrator must have a value between 0 and 65535")
+		}
+		return fmt.Sprintf("%s,%s,%d", kind, ip.To4(), value), nil // nil error
+	}
+	admin, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return "", errors.New("administrator must be an IPv4 address or a number between 0 and 4294967295")
+	}
+	if admin > 65535 && value > 65535 {
+		return "", errors.New("extended communities with a 32-bit ASN administrator must have a value between 0 and 65535")
+	}
+	return fmt.Sprintf("%s,%d,%d", kind, admin, value), nil // nil error
+}
+
+// birdRouteSources returns the BIRD route sources of the static, direct, kernel, and bgp redistribution options
+func birdRouteSources(redistribute []string) []string {
+	var sources []string
+	for _, source := range redistribute {
+		sources = append(sources, map[string]string{
+			"static": "RTS_STATIC",
+			"direct": "RTS_DEVICE",
+			"kernel": "RTS_INHERIT",
+			"bgp":    "RTS_BGP",
+		}[source])
+	}
+	return sources
+}
+
+// parseRouteTarget parses an ASN:value or IPv4:value route target or route distinguisher, which have the same formats as route target extended communities, returning it in : notation
+func parseRouteTarget(input string) (string, error) {
+	community, err := parseExtendedCommunity("rt", communitySeparator.Split(input, -1))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Split(community, ",")[1:], ":"), nil // nil error
+}
+
+// parseCommunity parses a standard, large, or extended (rt or ro prefixed) community in , or : notation, returning its type ("standard", "large", or "extended") and the community in BIRD's comma notation
+func parseCommunity(input string) (string, string, error) {
+	parts := communitySeparator.Split(input, -1)
+	if kind := strings.ToLower(parts[0]); kind == "rt" || kind == "ro" {
+		normalized, err := parseExtendedCommunity(kind, parts[1:])
 		if err != nil {
-			return ""
+			return "", "", err
 		}
-		secondPart, err := strconv.Atoi(standardSplit[1])
+		return "extended", normalized, nil // nil error
+	}
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 32)
 		if err != nil {
-			return ""
+			return "", "", errors.New("parts must be numbers between 0 and 4294967295")
 		}
+		values[i] = value
+	}
 
-		if firstPart < 0 || firstPart > 65535 {
-			return ""
+	switch len(values) {
+	case 2:
+		if values[0] > 65535 {
+			return "", "", fmt.Errorf("AS%d is a 32-bit ASN, which doesn't fit in a standard community, use a large community instead (%d:%d:0)", values[0], values[0], values[1])
 		}
-		if secondPart < 0 || secondPart > 65535 {
-			return ""
+		if values[1] > 65535 {
+			return "", "", errors.New("standard community parts must be between 0 and 65535")
 		}
-		return "standard"
+		return "standard", fmt.Sprintf("%d,%d", values[0], values[1]), nil // nil error
+	case 3:
+		return "large", fmt.Sprintf("%d,%d,%d", values[0], values[1], values[2]), nil // nil error
 	}
+	return "", "", errors.New("communities must have 2 (standard) or 3 (large) parts")
+}
 
-	// Test if it fits the criteria for a large community
-	largeSplit := strings.Split(input, ":")
-	if len(largeSplit) == 3 {
-		firstPart, err := strconv.Atoi(largeSplit[0])
-		if err != nil {
-			return ""
+// communityNameRegex matches a community name from community-definitions, which can't be confused with a community value
+var communityNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// categorizeCommunities splits a list of communities, which may be names from definitions, into standard and large communities in BIRD's comma notation
+func categorizeCommunities(field string, communities []string, definitions map[string]string) ([]string, []string, error) {
+	standard, large, extended, err := categorizeAllCommunities(field, communities, definitions)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(extended) > 0 {
+		return nil, nil, fmt.Errorf("Invalid %s community %s: extended communities are only supported in peer community lists", field, strings.ReplaceAll(extended[0], ",", ":"))
+	}
+	return standard, large, nil // nil error
+}
+
+// categorizeAllCommunities splits a list of communities, which may be names from definitions, into standard, large, and extended communities in BIRD's comma notation
+func categorizeAllCommunities(field string, communities []string, definitions map[string]string) ([]string, []string, []string, error) {
+	var standard, large, extended []string
+	for _, community := range communities {
+		value, defined := definitions[community]
+		if !defined {
+			if communityNameRegex.MatchString(community) {
+				return nil, nil, nil, fmt.Errorf("Invalid %s community %s: not defined in community-definitions", field, community)
+			}
+			value = community
 		}
-		secondPart, err := strconv.Atoi(largeSplit[1])
+		communityType, normalized, err := parseCommunity(value)
 		if err != nil {
-			return ""
+			return nil, nil, nil, fmt.Errorf("Invalid %s community %s: %v", field, community, err)
 		}
-		thirdPart, err := strconv.Atoi(largeSplit[2])
-		if err != nil {
-			return ""
+		switch communityType {
+		case "standard":
+			standard = append(standard, normalized)
+		case "large":
+			large = append(large, normalized)
+		default:
+			extended = append(extended, normalized)
+		}
+	}
+	return standard, large, extended, nil // nil error
+}
+
+// flowSpecPorts converts a list of ports and port ranges to a BIRD flowspec numbers match
+func flowSpecPorts(ports []string) (string, error) {
+	var matches []string
+	for _, port := range ports {
+		bounds := strings.SplitN(port, "-", 2)
+		var values []uint64
+		for _, bound := range bounds {
+			value, err := strconv.ParseUint(strings.TrimSpace(bound), 10, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid port %s", port)
+			}
+			values = append(values, value)
 		}
+		if len(values) == 1 {
+			matches = append(matches, fmt.Sprintf("%d", values[0]))
+		} else if values[0] > values[1] {
+			return "", fmt.Errorf("invalid port range %s", port)
+		} else {
+			matches = append(matches, fmt.Sprintf("%d..%d", values[0], values[1]))
+		}
+	}
+	return strings.Join(matches, ","), nil // nil error
+}
 
-		if firstPart < 0 || firstPart > 4294967295 {
-			return ""
+// parse builds the BIRD flowspec match of a rule and the extended community of its action
+func (r *FlowSpecRule) parse() error {
+	r.AF = "4"
+	if strings.Contains(r.Destination, ":") {
+		r.AF = "6"
+	}
+	match := []string{"dst " + r.Destination}
+	if r.Source != "" {
+		if strings.Contains(r.Source, ":") != (r.AF == "6") {
+			return fmt.Errorf("source %s and destination %s must be the same address family", r.Source, r.Destination)
+		}
+		match = append(match, "src "+r.Source)
+	}
+	if len(r.Protocols) > 0 {
+		var protocols []string
+		for _, protocol := range r.Protocols {
+			protocols = append(protocols, fmt.Sprintf("%d", protocol))
+		}
+		keyword := "proto"
+		if r.AF == "6" {
+			keyword = "next header"
+		}
+		match = append(match, keyword+" "+strings.Join(protocols, ","))
+	}
+	for _, ports := range []struct {
+		keyword string
+		ports   []string
+	}{
+		{"sport", r.SourcePorts},
+		{"dport", r.DestinationPorts},
+	} {
+		if len(ports.ports) == 0 {
+			continue
+		}
+		numbers, err := flowSpecPorts(ports.ports)
+		if err != nil {
+			return err
 		}
-		if secondPart < 0 || secondPart > 4294967295 {
-			return ""
+		match = append(match, ports.keyword+" "+numbers)
+	}
+	r.Match = strings.Join(match, "; ") + ";"
+
+	// Actions are RFC 8955 traffic filtering action extended communities, where discard is a traffic-rate of 0
+	switch r.Action {
+	case "discard":
+		r.Community = "generic, 0x80060000, 0x0"
+	case "rate-limit":
+		if r.RateLimit == 0 {
+			return errors.New("rate-limit action requires a rate-limit above 0 (use the discard action to drop all traffic)")
+		}
+		r.Community = fmt.Sprintf("generic, 0x80060000, 0x%x", math.Float32bits(float32(r.RateLimit)))
+	case "redirect":
+		parts := strings.Split(r.Redirect, ":")
+		if len(parts) != 2 {
+			return fmt.Errorf("redirect action requires a redirect route target as ASN:value, got %q", r.Redirect)
+		}
+		asn, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid redirect ASN %s", parts[0])
 		}
-		if thirdPart < 0 || thirdPart > 4294967295 {
-			return ""
+		value, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid redirect value %s", parts[1])
+		}
+		if asn <= 65535 {
+			r.Community = fmt.Sprintf("generic, 0x8008%04x, 0x%x", asn, value)
+		} else if value <= 65535 {
+			r.Community = fmt.Sprintf("generic, 0x8208%04x, 0x%08x", asn>>16, (asn&0xffff)<<16|value)
+		} else {
+			return errors.New("redirect route targets with a 32-bit ASN must have a value between 0 and 65535")
 		}
-		return "large"
 	}
+	return nil // nil error
+}
 
-	return ""
+// maxConfigSize is the largest config Load accepts, bounding the memory used to parse untrusted input
+const maxConfigSize = 16 << 20
+
+// nilEntry returns the first key, in sorted order, of a map of pointers with a nil value
+func nilEntry(m interface{}) (string, bool) {
+	value := reflect.ValueOf(m)
+	var keys []string
+	for _, key := range value.MapKeys() {
+		if value.MapIndex(key).IsNil() {
+			keys = append(keys, key.String())
+		}
+	}
+	if len(keys) == 0 {
+		return "", false
+	}
+	sort.Strings(keys)
+	return keys[0], true
 }
 
 // Load loads a configuration file from a YAML file
-func Load(configBlob []byte) (*Config, error) {
+func Load(configBlob []byte) (loaded *Config, err error) {
+	// Report bugs in config processing as errors, so bad input can't crash a long-running process
+	defer func() {
+		if r := recover(); r != nil {
+			loaded, err = nil, fmt.Errorf("internal error loading config: %v", r)
+		}
+	}()
+
+	if len(configBlob) > maxConfigSize {
+		return nil, fmt.Errorf("config is %d bytes, larger than the %d byte limit", len(configBlob), maxConfigSize)
+	}
+
 	var c Config
 	// Set global config defaults
 	if err := defaults.Set(&c); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	setPlatformDefaults(&c)
 
 	if err := yaml.UnmarshalStrict(configBlob, &c); err != nil {
 		return nil, errors.New("YAML unmarshal: " + err.Error())
 	}
+	c.ConfigHash = fmt.Sprintf("%x", sha256.Sum256(configBlob))
+
+	// Entries with nothing under them unmarshal to nil
+	for _, section := range []struct {
+		name    string
+		entries interface{}
+	}{
+		{"peer", c.Peers},
+		{"template", c.Templates},
+		{"VRRP instance", c.VRRPInstances},
+		{"VRRP sync group", c.VRRPSyncGroups},
+		{"BFD instance", c.BFDInstances},
+		{"TCP-AO key chain", c.TCPAOKeyChains},
+		{"healthcheck", c.Healthchecks},
+		{"conditional prefix", c.ConditionalPrefixes},
+		{"flowspec rule", c.FlowSpecRules},
+		{"VRF", c.VRFs},
+		{"VXLAN segment", c.Augments.VXLAN},
+		{"static", c.Augments.Statics},
+		{"OSPF area", c.OSPF.Areas},
+		{"Babel interface", c.Babel.Interfaces},
+		{"IS-IS interface", c.ISIS.Interfaces},
+		{"auth user", c.Auth.Users},
+		{"auth token", c.Auth.Tokens},
+		{"prefix group", c.PrefixGroups},
+	} {
+		if name, found := nilEntry(section.entries); found {
+			return nil, fmt.Errorf("%s %s is empty", section.name, name)
+		}
+	}
+
+	// Set probe target defaults
+	for i := range c.Optimizer.ProbeTargets {
+		if err := defaults.Set(&c.Optimizer.ProbeTargets[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set RTR server defaults, using rtr-server over TCP if no rtr-servers are defined
+	if len(c.RTRServers) == 0 && c.RTRServer != "" {
+		c.RTRServers = []RTRServer{{Server: c.RTRServer}}
+	}
+	for i := range c.RTRServers {
+		if err := defaults.Set(&c.RTRServers[i]); err != nil {
+			return nil, err
+		}
+	}
 
 	validate := validator.New()
 	if err := validate.Struct(&c); err != nil {
@@ -307,7 +1285,7 @@ func Load(configBlob []byte) (*Config, error) {
 	// Check for invalid templates
 	for templateName, templateData := range c.Templates {
 		if templateData.Template != nil && *templateData.Template != "" {
-			log.Fatalf("Templates must not have a template field set, but %s does", templateName)
+			return nil, fmt.Errorf("Templates must not have a template field set, but %s does", templateName)
 		}
 	}
 
@@ -315,168 +1293,222 @@ func Load(configBlob []byte) (*Config, error) {
 	if c.Hostname == "" {
 		hostname, err := os.Hostname()
 		if err != nil {
-			log.Fatalf("Hostname is not defined and unable to get system hostname: %s", err)
+			return nil, fmt.Errorf("Hostname is not defined and unable to get system hostname: %s", err)
 		}
 		c.Hostname = hostname
 	}
 
-	for peerName, peerData := range c.Peers {
-		// Set sanitized peer name
-		peerData.ProtocolName = util.Sanitize(peerName)
-
-		// If any peer has NVRS filtering enabled, mark it for querying.
-		if peerData.FilterNeverViaRouteServers != nil {
-			c.QueryNVRS = true
+	// Validate community definitions before any community list references them
+	var communityNames []string
+	for name := range c.CommunityDefinitions {
+		communityNames = append(communityNames, name)
+	}
+	sort.Strings(communityNames)
+	for _, name := range communityNames {
+		if !communityNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("Invalid community definition name %s: must start with a letter and contain only letters, numbers, - and _", name)
 		}
-
-		if peerData.NeighborIPs == nil || len(*peerData.NeighborIPs) < 1 {
-			log.Fatalf("[%s] has no neighbors defined", peerName)
+		if _, _, err := parseCommunity(c.CommunityDefinitions[name]); err != nil {
+			return nil, fmt.Errorf("Invalid community definition %s (%s): %v", name, c.CommunityDefinitions[name], err)
 		}
+	}
 
-		peerData.BooleanOptions = &[]string{}
-
-		// Assign values from template
-		if peerData.Template != nil && *peerData.Template != "" {
-			template := c.Templates[*peerData.Template]
-			if template == nil {
-				log.Fatalf("Template %s not found", *peerData.Template)
-			}
-			templateValue := reflect.ValueOf(*template)
-			peerValue := reflect.ValueOf(c.Peers[peerName]).Elem()
-
-			templateValueType := templateValue.Type()
-			for i := 0; i < templateValueType.NumField(); i++ {
-				fieldName := templateValueType.Field(i).Name
-				peerFieldValue := peerValue.FieldByName(fieldName)
-				if fieldName != "Template" { // Ignore the template field
-					pVal := reflect.Indirect(peerFieldValue)
-					peerHasValueConfigured := pVal.IsValid()
-					tValue := templateValue.Field(i)
-					templateHasValueConfigured := !tValue.IsNil()
-					if templateHasValueConfigured && !peerHasValueConfigured {
-						// Use the template's value
-						peerFieldValue.Set(templateValue.Field(i))
-					}
-
-					log.Debugf("[%s] field: %s template's value: %+v kind: %T templateHasValueConfigured: %v", peerName, fieldName, reflect.Indirect(tValue), tValue.Kind().String(), templateHasValueConfigured)
-				}
-			}
-		} // end peer template processor
-
-		// Set default values
-		peerValue := reflect.ValueOf(c.Peers[peerName]).Elem()
-		templateValueType := peerValue.Type()
-		for i := 0; i < templateValueType.NumField(); i++ {
-			fieldName := templateValueType.Field(i).Name
-			fieldValue := peerValue.FieldByName(fieldName)
-			defaultString := templateValueType.Field(i).Tag.Get("default")
-			if defaultString == "" {
-				log.Fatalf("Code error: field %s has no default value", fieldName)
-			} else if defaultString != "-" {
-				log.Debugf("[%s] (before defaulting, after templating) field %s value %+v", peerName, fieldName, reflect.Indirect(fieldValue))
-				if fieldValue.IsNil() {
-					elemToSwitch := templateValueType.Field(i).Type.Elem().Kind()
-					switch elemToSwitch {
-					case reflect.String:
-						log.Debugf("[%s] setting field %s to value %+v", peerName, fieldName, defaultString)
-						fieldValue.Set(reflect.ValueOf(&defaultString))
-					case reflect.Int:
-						defaultValueInt, err := strconv.Atoi(defaultString)
-						if err != nil {
-							log.Fatalf("Can't convert '%s' to uint", defaultString)
-						}
-						log.Debugf("[%s] setting field %s to value %+v", peerName, fieldName, defaultValueInt)
-						fieldValue.Set(reflect.ValueOf(&defaultValueInt))
-					case reflect.Bool:
-						var err error // explicit declaration used to avoid scope issues of defaultValue
-						defaultBool, err := strconv.ParseBool(defaultString)
-						if err != nil {
-							log.Fatalf("Can't parse bool %s", defaultString)
-						}
-						log.Debugf("[%s] setting field %s to value %+v", peerName, fieldName, defaultBool)
-						fieldValue.Set(reflect.ValueOf(&defaultBool))
-					case reflect.Struct, reflect.Slice:
-						// Ignore structs and slices
-					default:
-						log.Fatalf("Unknown kind %+v for field %s", elemToSwitch, fieldName)
-					}
-				} else {
-					// Add boolean values to the peer's config
-					if templateValueType.Field(i).Type.Elem().Kind() == reflect.Bool {
-						*peerData.BooleanOptions = append(*peerData.BooleanOptions, templateValueType.Field(i).Tag.Get("yaml"))
-					}
-				}
-			} else {
-				log.Debugf("[%s] skipping field %s with ignored default (-)", peerName, fieldName)
+	// Action communities default to the router ASN and each action must be unique to know which one a community requests
+	if c.ActionCommunities.Enabled {
+		if c.ActionCommunities.ASN == 0 {
+			c.ActionCommunities.ASN = uint32(c.ASN)
+		}
+		actions := map[uint32]string{}
+		for _, action := range []struct {
+			name  string
+			value uint32
+		}{
+			{"no-announce", c.ActionCommunities.NoAnnounce},
+			{"prepend-1", c.ActionCommunities.Prepend1},
+			{"prepend-2", c.ActionCommunities.Prepend2},
+			{"prepend-3", c.ActionCommunities.Prepend3},
+			{"no-export", c.ActionCommunities.NoExport},
+		} {
+			if other, found := actions[action.value]; found {
+				return nil, fmt.Errorf("Action communities %s and %s both use %d", other, action.name, action.value)
 			}
+			actions[action.value] = action.name
 		}
 	}
 
 	// Parse origin routes by assembling OriginIPv{4,6} lists by address family
-	for _, prefix := range c.Prefixes {
-		pfx, _, err := net.ParseCIDR(prefix)
+	c.OriginAttributes = map[string]*OriginPrefix{}
+	for i, origin := range c.OriginPrefixes {
+		if origin == nil {
+			return nil, fmt.Errorf("prefix %d is empty", i)
+		}
+		if util.Contains(c.Prefixes, origin.Prefix) {
+			return nil, errors.New("Duplicate origin prefix: " + origin.Prefix)
+		}
+		if err := c.categorizePrefix(origin.Prefix); err != nil {
+			return nil, err
+		}
+		c.Prefixes = append(c.Prefixes, origin.Prefix)
+
+		standard, large, err := categorizeCommunities("prefix "+origin.Prefix, origin.Communities, c.CommunityDefinitions)
 		if err != nil {
-			return nil, errors.New("Invalid origin prefix: " + prefix)
+			return nil, err
+		}
+		if origin.NoExport {
+			standard = append(standard, "65535,65281")
+		}
+		origin.StandardCommunities, origin.LargeCommunities = standard, large
+		if origin.hasAttributes() {
+			c.OriginAttributes[origin.Prefix] = origin
 		}
+	}
 
-		if pfx.To4() == nil { // If IPv6
-			c.Prefixes6 = append(c.Prefixes6, prefix)
+	// Move prefixes bound to an interface from the unconditional to the conditional origin lists
+	c.LinkPrefixes = map[string]*LinkPrefixes{}
+	for prefix, iface := range c.PrefixInterfaces {
+		if !util.Contains(c.Prefixes, prefix) {
+			return nil, errors.New("Prefix interface binding for " + prefix + " isn't in prefixes")
+		}
+		if c.LinkPrefixes[iface] == nil {
+			c.LinkPrefixes[iface] = &LinkPrefixes{ProtocolName: "INTERFACE_" + *util.Sanitize(iface)}
+		}
+		if strings.Contains(prefix, ":") { // If IPv6
+			c.Prefixes6 = removeString(c.Prefixes6, prefix)
+			c.ConditionalPrefixes6 = append(c.ConditionalPrefixes6, prefix)
+			c.LinkPrefixes[iface].Prefixes6 = append(c.LinkPrefixes[iface].Prefixes6, prefix)
 		} else { // If IPv4
-			c.Prefixes4 = append(c.Prefixes4, prefix)
+			c.Prefixes4 = removeString(c.Prefixes4, prefix)
+			c.ConditionalPrefixes4 = append(c.ConditionalPrefixes4, prefix)
+			c.LinkPrefixes[iface].Prefixes4 = append(c.LinkPrefixes[iface].Prefixes4, prefix)
 		}
 	}
 
 	// Initialize static maps
-	c.Augments.Statics4 = map[string]string{}
-	c.Augments.Statics6 = map[string]string{}
+	c.Augments.Statics4 = map[string]*Static{}
+	c.Augments.Statics6 = map[string]*Static{}
+	c.Augments.Blackholes4 = map[string]*Static{}
+	c.Augments.Blackholes6 = map[string]*Static{}
 
 	// Categorize communities
-	if c.Augments.SRDCommunities != nil {
-		for _, community := range c.Augments.SRDCommunities {
-			communityType := categorizeCommunity(community)
-			if communityType == "standard" {
-				if c.Augments.SRDStandardCommunities == nil {
-					c.Augments.SRDStandardCommunities = []string{}
-				}
-				c.Augments.SRDStandardCommunities = append(c.Augments.SRDStandardCommunities, community)
-			} else if communityType == "large" {
-				if c.Augments.SRDLargeCommunities == nil {
-					c.Augments.SRDLargeCommunities = []string{}
-				}
-				c.Augments.SRDLargeCommunities = append(c.Augments.SRDLargeCommunities, strings.ReplaceAll(community, ":", ","))
-			} else {
-				return nil, errors.New("Invalid SRD community: " + community)
-			}
-		}
+	standard, large, err := categorizeCommunities("SRD", c.Augments.SRDCommunities, c.CommunityDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	c.Augments.SRDStandardCommunities, c.Augments.SRDLargeCommunities = standard, large
+
+	// Normalize global communities
+	standard, large, err = categorizeCommunities("global", c.Communities, c.CommunityDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	if len(large) > 0 {
+		return nil, fmt.Errorf("Invalid global community %s: large communities belong in large-communities", strings.ReplaceAll(large[0], ",", ":"))
 	}
+	c.Communities = standard
+	standard, large, err = categorizeCommunities("global large", c.LargeCommunities, c.CommunityDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	if len(standard) > 0 {
+		return nil, fmt.Errorf("Invalid global large community %s: standard communities belong in communities", standard[0])
+	}
+	c.LargeCommunities = large
 
 	// Parse static routes
-	for prefix, nexthop := range c.Augments.Statics {
+	for prefix, static := range c.Augments.Statics {
 		pfx, _, err := net.ParseCIDR(prefix)
 		if err != nil {
 			return nil, errors.New("Invalid static prefix: " + prefix)
 		}
-		if net.ParseIP(nexthop) == nil {
-			return nil, errors.New("Invalid static nexthop: " + nexthop)
+		if err := validate.Struct(static); err != nil {
+			return nil, fmt.Errorf("static %s validation: %v", prefix, err)
+		}
+
+		// Discard routes don't have a next hop
+		if static.Nexthop == "blackhole" || static.Nexthop == "reject" || static.Nexthop == "unreachable" || static.Nexthop == "prohibit" {
+			if _, found := c.Augments.StaticInterfaces[prefix]; found {
+				return nil, errors.New("Static interface binding for " + prefix + " can't be used with a " + static.Nexthop + " static")
+			}
+			if len(static.Nexthops) > 0 || static.Recursive {
+				return nil, fmt.Errorf("static %s: %s statics can't have nexthops or be recursive", prefix, static.Nexthop)
+			}
+			if pfx.To4() == nil { // If IPv6
+				c.Augments.Blackholes6[prefix] = static
+			} else { // If IPv4
+				c.Augments.Blackholes4[prefix] = static
+			}
+			continue
+		}
+
+		if len(static.Nexthops) == 0 {
+			if net.ParseIP(static.Nexthop) == nil {
+				return nil, errors.New("Invalid static nexthop: " + static.Nexthop)
+			}
+			static.Nexthops = []*StaticNexthop{{Address: static.Nexthop}}
+		} else if static.Nexthop != "" {
+			return nil, fmt.Errorf("static %s can't have both nexthop and nexthops", prefix)
+		}
+		if _, found := c.Augments.StaticInterfaces[prefix]; found && (len(static.Nexthops) > 1 || static.Recursive) {
+			return nil, errors.New("Static interface binding for " + prefix + " can't be used with multiple nexthops or a recursive static")
+		}
+		for _, nexthop := range static.Nexthops {
+			if nexthop == nil {
+				return nil, fmt.Errorf("static %s has an empty nexthop", prefix)
+			}
+			if err := validate.Struct(nexthop); err != nil {
+				return nil, fmt.Errorf("static %s nexthop validation: %v", prefix, err)
+			}
+			if static.Recursive && (len(static.Nexthops) > 1 || nexthop.Weight != 0 || nexthop.OnLink || nexthop.BFD) {
+				return nil, fmt.Errorf("static %s: recursive statics can only have a single nexthop without weight, onlink, or bfd", prefix)
+			}
 		}
 
 		if pfx.To4() == nil { // If IPv6
-			c.Augments.Statics6[prefix] = nexthop
+			c.Augments.Statics6[prefix] = static
 		} else { // If IPv4
-			c.Augments.Statics4[prefix] = nexthop
+			c.Augments.Statics4[prefix] = static
+		}
+	}
+	for prefix := range c.Augments.StaticInterfaces {
+		if _, found := c.Augments.Statics[prefix]; !found {
+			return nil, errors.New("Static interface binding for " + prefix + " isn't in statics")
 		}
 	}
 
 	// Parse BFD configs
 	for instanceName, bfdInstance := range c.BFDInstances {
-		if net.ParseIP(*bfdInstance.Neighbor) == nil {
-			return nil, fmt.Errorf("invalid BFD neighbor %s", *bfdInstance.Neighbor)
+		if err := defaults.Set(bfdInstance); err != nil {
+			return nil, err
+		}
+		if bfdInstance.Neighbor == nil || util.ValidateNeighbor(*bfdInstance.Neighbor) != nil {
+			return nil, fmt.Errorf("invalid BFD neighbor %s", util.StrDeref(bfdInstance.Neighbor))
+		}
+		// Use the zone of a link-local neighbor as the interface if not set
+		if _, zone := util.SplitZone(*bfdInstance.Neighbor); zone != "" && bfdInstance.Interface == nil {
+			bfdInstance.Interface = &zone
+		}
+		if bfdInstance.Local != nil && net.ParseIP(*bfdInstance.Local) == nil {
+			return nil, fmt.Errorf("invalid BFD local address %s", *bfdInstance.Local)
+		}
+		if bfdInstance.AuthType != nil {
+			switch *bfdInstance.AuthType {
+			case "simple":
+				if *bfdInstance.Meticulous {
+					return nil, fmt.Errorf("BFD instance %s meticulous authentication requires md5 or sha1", instanceName)
+				}
+			case "md5", "sha1":
+			default:
+				return nil, fmt.Errorf("BFD auth type must be 'simple', 'md5' or 'sha1', unexpected %s", *bfdInstance.AuthType)
+			}
+			if bfdInstance.Password == nil {
+				return nil, fmt.Errorf("BFD instance %s authentication requires a password", instanceName)
+			}
 		}
 		bfdInstance.ProtocolName = util.Sanitize(instanceName)
 	}
 
 	// Parse VRRP configs
-	for _, vrrpInstance := range c.VRRPInstances {
+	for instanceName, vrrpInstance := range c.VRRPInstances {
 		// Sort VIPs by address family
 		for _, vip := range vrrpInstance.VIPs {
 			ip, _, err := net.ParseCIDR(vip)
@@ -499,132 +1531,1135 @@ func Load(configBlob []byte) (*Config, error) {
 		} else {
 			return nil, errors.New("VRRP state must be 'primary' or 'backup', unexpected " + vrrpInstance.State)
 		}
+
+		if vrrpInstance.AdvertInterval == 0 {
+			vrrpInstance.AdvertInterval = 1
+		}
+		if vrrpInstance.Implementation == "" {
+			vrrpInstance.Implementation = defaultVRRPImplementation
+		}
+		if vrrpInstance.VRID+vrrpInstance.VRID6Offset > 255 {
+			return nil, errors.New("VRRP instance " + instanceName + " IPv6 VRID (VRID plus vrid6-offset) must be at most 255")
+		}
+		if vrrpInstance.Implementation == "builtin" {
+			if vrrpInstance.VRID > 255 || vrrpInstance.Priority > 255 {
+				return nil, errors.New("VRRP instance " + instanceName + " VRID and priority must be between 1 and 255")
+			}
+			if vrrpInstance.AdvertInterval > 40 {
+				return nil, errors.New("VRRP instance " + instanceName + " advert interval must be at most 40 seconds with the builtin implementation")
+			}
+			if len(vrrpInstance.UnicastPeers) > 0 || vrrpInstance.AuthType != "" || len(vrrpInstance.TrackInterfaces) > 0 || len(vrrpInstance.TrackScripts) > 0 {
+				return nil, errors.New("VRRP instance " + instanceName + " uses options that aren't supported by the builtin implementation (unicast, auth, tracking)")
+			}
+		} else if vrrpInstance.Implementation == "carp" {
+			if vrrpInstance.Priority > 255 {
+				return nil, errors.New("VRRP instance " + instanceName + " priority must be between 1 and 255")
+			}
+			if vrrpInstance.AdvertInterval > 255 {
+				return nil, errors.New("VRRP instance " + instanceName + " advert interval must be at most 255 seconds with the carp implementation")
+			}
+			if len(vrrpInstance.UnicastPeers) > 0 || strings.EqualFold(vrrpInstance.AuthType, "ah") || len(vrrpInstance.TrackInterfaces) > 0 || len(vrrpInstance.TrackScripts) > 0 || len(vrrpInstance.Originate) > 0 || vrrpInstance.NoPreempt || vrrpInstance.PreemptDelay > 0 ||
+				vrrpInstance.GARPMasterDelay > 0 || vrrpInstance.GARPMasterRepeat > 0 || vrrpInstance.GARPMasterRefresh > 0 {
+				return nil, errors.New("VRRP instance " + instanceName + " uses options that aren't supported by the carp implementation (unicast, ah auth, tracking, originate, preemption, gratuitous ARP)")
+			}
+		} else if vrrpInstance.Implementation != "keepalived" {
+			return nil, errors.New("VRRP implementation must be 'keepalived', 'carp' or 'builtin', unexpected " + vrrpInstance.Implementation)
+		}
+		if vrrpInstance.NoPreempt && vrrpInstance.State != "BACKUP" {
+			return nil, errors.New("VRRP nopreempt requires backup state")
+		}
+		for _, peer := range vrrpInstance.UnicastPeers {
+			if net.ParseIP(peer) == nil {
+				return nil, errors.New("Invalid VRRP unicast peer: " + peer)
+			}
+		}
+		if vrrpInstance.UnicastSource != "" && net.ParseIP(vrrpInstance.UnicastSource) == nil {
+			return nil, errors.New("Invalid VRRP unicast source: " + vrrpInstance.UnicastSource)
+		}
+		if vrrpInstance.AuthType != "" {
+			vrrpInstance.AuthType = strings.ToUpper(vrrpInstance.AuthType)
+			if vrrpInstance.AuthType != "PASS" && vrrpInstance.AuthType != "AH" {
+				return nil, errors.New("VRRP auth type must be 'pass' or 'ah', unexpected " + vrrpInstance.AuthType)
+			}
+			if vrrpInstance.AuthPassword == "" || len(vrrpInstance.AuthPassword) > 8 {
+				return nil, errors.New("VRRP auth password must be 1 to 8 characters")
+			}
+		}
+
+		for _, track := range vrrpInstance.TrackInterfaces {
+			if track.Weight < -254 || track.Weight > 254 {
+				return nil, fmt.Errorf("VRRP track interface %s weight must be between -254 and 254", track.Interface)
+			}
+		}
+		for i := range vrrpInstance.TrackScripts {
+			track := &vrrpInstance.TrackScripts[i]
+			if track.Weight < -253 || track.Weight > 253 {
+				return nil, fmt.Errorf("VRRP track script %s weight must be between -253 and 253", track.Script)
+			}
+			if track.Interval == 0 {
+				track.Interval = 2
+			}
+			if track.Fall == 0 {
+				track.Fall = 1
+			}
+			if track.Rise == 0 {
+				track.Rise = 1
+			}
+			track.Name = fmt.Sprintf("%s_%d", *util.Sanitize(instanceName), i)
+		}
+
+		// Sort VRRP conditional origin prefixes by address family
+		vrrpInstance.ProtocolName = "VRRP_" + *util.Sanitize(instanceName)
+		for _, prefix := range vrrpInstance.Originate {
+			ipv6, err := c.categorizeConditionalPrefix(prefix)
+			if err != nil {
+				return nil, err
+			}
+			if ipv6 {
+				vrrpInstance.Originate6 = append(vrrpInstance.Originate6, prefix)
+			} else {
+				vrrpInstance.Originate4 = append(vrrpInstance.Originate4, prefix)
+			}
+		}
 	}
 
-	// Parse RTR server
-	if c.RTRServer != "" {
-		rtrServerParts := strings.Split(c.RTRServer, ":")
-		if len(rtrServerParts) != 2 {
-			log.Fatalf("Invalid rtr-server '%s' format should be host:port", rtrServerParts)
+	// Parse healthchecks
+	for name, healthcheck := range c.Healthchecks {
+		if err := defaults.Set(healthcheck); err != nil {
+			return nil, err
 		}
-		c.RTRServerHost = rtrServerParts[0]
-		rtrServerPort, err := strconv.Atoi(rtrServerParts[1])
-		if err != nil {
-			log.Fatalf("Invalid RTR server port %s", rtrServerParts[1])
+		if err := validate.Struct(healthcheck); err != nil {
+			return nil, fmt.Errorf("healthcheck %s validation: %v", name, err)
+		}
+		if err := c.parseHealthcheck(name, "HEALTHCHECK_"+*util.Sanitize(name), healthcheck); err != nil {
+			return nil, err
+		}
+	}
+
+	// Build healthchecks from the probes of conditional prefixes
+	c.ConditionalHealthchecks = map[string]*Healthcheck{}
+	for prefix, conditional := range c.ConditionalPrefixes {
+		if err := defaults.Set(conditional); err != nil {
+			return nil, err
+		}
+		if err := validate.Struct(conditional); err != nil {
+			return nil, fmt.Errorf("conditional prefix %s validation: %v", prefix, err)
+		}
+		healthcheck := &Healthcheck{
+			Type:     conditional.Probe,
+			Target:   conditional.Target,
+			Prefixes: []string{prefix},
+			Interval: conditional.Interval,
+			Timeout:  conditional.Timeout,
+			Rise:     conditional.Rise,
+			Fall:     conditional.Fall,
 		}
-		c.RTRServerPort = rtrServerPort
+		name := "conditional prefix " + prefix
+		protocolName := "HEALTHCHECK_CONDITIONAL_" + strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(prefix)
+		if err := c.parseHealthcheck(name, protocolName, healthcheck); err != nil {
+			return nil, err
+		}
+		c.ConditionalHealthchecks[name] = healthcheck
 	}
 
-	for _, peerData := range c.Peers {
-		// Build static prefix filters
-		if peerData.Prefixes != nil {
-			for _, prefix := range *peerData.Prefixes {
-				pfx, _, err := net.ParseCIDR(prefix)
+	// Parse VRFs
+	vrfInterfaces := map[string]string{} // Interface to VRF name
+	for name, vrf := range c.VRFs {
+		if err := validate.Struct(vrf); err != nil {
+			return nil, fmt.Errorf("VRF %s validation: %v", name, err)
+		}
+		if other, found := vrfInterfaces[vrf.Interface]; found {
+			return nil, fmt.Errorf("VRFs %s and %s both use interface %s", other, name, vrf.Interface)
+		}
+		vrfInterfaces[vrf.Interface] = name
+		for _, prefix := range vrf.Prefixes {
+			if strings.Contains(prefix, ":") {
+				vrf.Prefixes6 = append(vrf.Prefixes6, prefix)
+			} else {
+				vrf.Prefixes4 = append(vrf.Prefixes4, prefix)
+			}
+		}
+		vrf.ProtocolName = "VRF_" + *util.Sanitize(name)
+		vrf.TableName = "vrf_" + strings.ToLower(*util.Sanitize(name))
+		if vrf.RouteDistinguisher == "" {
+			continue
+		}
+
+		rd, err := parseRouteTarget(vrf.RouteDistinguisher)
+		if err != nil {
+			return nil, fmt.Errorf("VRF %s route distinguisher %s: %v", name, vrf.RouteDistinguisher, err)
+		}
+		vrf.RouteDistinguisher = rd
+		for _, targets := range []struct {
+			name        string
+			targets     []string
+			communities *[]string
+		}{
+			{"import", vrf.ImportTargets, &vrf.ImportTargetCommunities},
+			{"export", vrf.ExportTargets, &vrf.ExportTargetCommunities},
+		} {
+			for _, target := range targets.targets {
+				community, err := parseExtendedCommunity("rt", communitySeparator.Split(target, -1))
 				if err != nil {
-					return nil, errors.New("Invalid prefix: " + prefix)
+					return nil, fmt.Errorf("VRF %s %s target %s: %v", name, targets.name, target, err)
 				}
+				*targets.communities = append(*targets.communities, community)
+			}
+		}
+		c.L3VPNEnable = true
+	}
 
-				if pfx.To4() == nil { // If IPv6
-					if peerData.PrefixSet6 == nil {
-						peerData.PrefixSet6 = &[]string{}
-					}
-					pfxSet6 := append(*peerData.PrefixSet6, prefix)
-					peerData.PrefixSet6 = &pfxSet6
-				} else { // If IPv4
-					if peerData.PrefixSet4 == nil {
-						peerData.PrefixSet4 = &[]string{}
-					}
-					pfxSet4 := append(*peerData.PrefixSet4, prefix)
-					peerData.PrefixSet4 = &pfxSet4
+	// Parse VXLAN segments
+	vnis := map[uint32]string{} // VNI to segment name
+	for name, vxlan := range c.Augments.VXLAN {
+		if err := validate.Struct(vxlan); err != nil {
+			return nil, fmt.Errorf("VXLAN segment %s validation: %v", name, err)
+		}
+		if other, found := vnis[vxlan.VNI]; found {
+			return nil, fmt.Errorf("VXLAN segments %s and %s both use VNI %d", other, name, vxlan.VNI)
+		}
+		vnis[vxlan.VNI] = name
+		if vxlan.RouteDistinguisher != "" {
+			rd, err := parseRouteTarget(vxlan.RouteDistinguisher)
+			if err != nil {
+				return nil, fmt.Errorf("VXLAN segment %s route distinguisher %s: %v", name, vxlan.RouteDistinguisher, err)
+			}
+			vxlan.RouteDistinguisher = rd
+		}
+		for _, targets := range []struct {
+			name    string
+			targets []string
+		}{
+			{"import", vxlan.ImportTargets},
+			{"export", vxlan.ExportTargets},
+		} {
+			for i, target := range targets.targets {
+				rt, err := parseRouteTarget(target)
+				if err != nil {
+					return nil, fmt.Errorf("VXLAN segment %s %s target %s: %v", name, targets.name, target, err)
 				}
+				targets.targets[i] = rt
+			}
+		}
+	}
+
+	// Parse TCP-AO key chains
+	for name, chain := range c.TCPAOKeyChains {
+		if err := validate.Struct(chain); err != nil {
+			return nil, fmt.Errorf("TCP-AO key chain %s validation: %v", name, err)
+		}
+		sendIDs, recvIDs := map[uint8]bool{}, map[uint8]bool{}
+		preferred := 0
+		for i, key := range chain.Keys {
+			if key == nil {
+				return nil, fmt.Errorf("TCP-AO key chain %s key %d is empty", name, i)
+			}
+			if err := defaults.Set(key); err != nil {
+				return nil, err
+			}
+			if err := validate.Struct(key); err != nil {
+				return nil, fmt.Errorf("TCP-AO key chain %s key %d validation: %v", name, i, err)
+			}
+			if sendIDs[key.SendID] || recvIDs[key.RecvID] {
+				return nil, fmt.Errorf("TCP-AO key chain %s key %d reuses send-id %d or recv-id %d", name, i, key.SendID, key.RecvID)
+			}
+			sendIDs[key.SendID], recvIDs[key.RecvID] = true, true
+			if key.Preferred {
+				preferred++
+			}
+			key.BIRDAlgorithm = strings.Replace(key.Algorithm, "-", " ", 1)
+		}
+		if preferred > 1 {
+			return nil, fmt.Errorf("TCP-AO key chain %s has more than one preferred key", name)
+		} else if preferred == 0 {
+			chain.Keys[0].Preferred = true
+		}
+	}
+
+	// Parse OSPF areas
+	for areaID, area := range c.OSPF.Areas {
+		if _, err := strconv.ParseUint(areaID, 10, 32); err != nil && net.ParseIP(areaID).To4() == nil {
+			return nil, fmt.Errorf("invalid OSPF area ID %s (expected a number or IPv4 address)", areaID)
+		}
+		if err := validate.Struct(area); err != nil {
+			return nil, fmt.Errorf("OSPF area %s validation: %v", areaID, err)
+		}
+		if name, found := nilEntry(area.Interfaces); found {
+			return nil, fmt.Errorf("OSPF area %s interface %s is empty", areaID, name)
+		}
+		for name, iface := range area.Interfaces {
+			if err := defaults.Set(iface); err != nil {
+				return nil, err
+			}
+			if err := validate.Struct(iface); err != nil {
+				return nil, fmt.Errorf("OSPF area %s interface %s validation: %v", areaID, name, err)
+			}
+			if iface.Authentication == "simple" && c.OSPF.OSPFv3 {
+				return nil, fmt.Errorf("OSPF area %s interface %s: simple authentication isn't supported by OSPFv3, use cryptographic or disable ospfv3", areaID, name)
+			}
+		}
+	}
+	c.OSPF.RedistributeSources = birdRouteSources(c.OSPF.Redistribute)
+	if len(c.OSPF.Areas) > 0 {
+		c.IGPSources = append(c.IGPSources, "RTS_OSPF", "RTS_OSPF_IA", "RTS_OSPF_EXT1", "RTS_OSPF_EXT2")
+	}
+
+	// Parse Babel interfaces
+	for name, iface := range c.Babel.Interfaces {
+		if err := defaults.Set(iface); err != nil {
+			return nil, err
+		}
+		if err := validate.Struct(iface); err != nil {
+			return nil, fmt.Errorf("Babel interface %s validation: %v", name, err)
+		}
+	}
+	c.Babel.RedistributeSources = birdRouteSources(c.Babel.Redistribute)
+	if len(c.Babel.Interfaces) > 0 {
+		c.IGPSources = append(c.IGPSources, "RTS_BABEL")
+	}
+
+	// Parse IS-IS interfaces
+	if len(c.ISIS.Interfaces) > 0 && !isisNETRegex.MatchString(c.ISIS.NET) {
+		return nil, fmt.Errorf("invalid IS-IS net %s (expected an area, 6 byte system ID, and 00 selector such as 49.0001.1920.0000.2001.00)", c.ISIS.NET)
+	}
+	for name, iface := range c.ISIS.Interfaces {
+		if err := defaults.Set(iface); err != nil {
+			return nil, err
+		}
+		if err := validate.Struct(iface); err != nil {
+			return nil, fmt.Errorf("IS-IS interface %s validation: %v", name, err)
+		}
+	}
+	c.ISIS.RedistributeLevel = "level-2"
+	if c.ISIS.Level == "level-1" {
+		c.ISIS.RedistributeLevel = "level-1"
+	}
+	for _, source := range c.ISIS.Redistribute {
+		if source == "direct" {
+			source = "connected"
+		}
+		c.ISIS.RedistributeProtocols = append(c.ISIS.RedistributeProtocols, source)
+	}
+
+	// Parse flowspec rules
+	for name, rule := range c.FlowSpecRules {
+		if err := defaults.Set(rule); err != nil {
+			return nil, err
+		}
+		if err := validate.Struct(rule); err != nil {
+			return nil, fmt.Errorf("flowspec rule %s validation: %v", name, err)
+		}
+		if err := rule.parse(); err != nil {
+			return nil, fmt.Errorf("flowspec rule %s: %v", name, err)
+		}
+		c.FlowSpecEnable = true
+	}
+
+	// Validate prefix groups
+	for groupName, group := range c.PrefixGroups {
+		for _, prefix := range group.Prefixes {
+			if !c.originated(prefix) {
+				return nil, fmt.Errorf("prefix %s in prefix group %s isn't originated", prefix, groupName)
+			}
+		}
+	}
+
+	// Validate VRRP sync groups
+	grouped := map[string]string{} // Instance name to sync group name
+	for groupName, group := range c.VRRPSyncGroups {
+		for _, instanceName := range group.Instances {
+			if c.VRRPInstances[instanceName] == nil {
+				return nil, errors.New("VRRP sync group " + groupName + " references undefined VRRP instance " + instanceName)
+			}
+			if c.VRRPInstances[instanceName].Implementation != "keepalived" {
+				return nil, errors.New("VRRP sync group " + groupName + " can't contain " + c.VRRPInstances[instanceName].Implementation + " VRRP instance " + instanceName)
 			}
+			if other, found := grouped[instanceName]; found {
+				return nil, errors.New("VRRP instance " + instanceName + " is in sync groups " + other + " and " + groupName)
+			}
+			grouped[instanceName] = groupName
+		}
+	}
+
+	// Validate auth roles
+	for username, user := range c.Auth.Users {
+		if user.Password == "" {
+			return nil, errors.New("Auth user " + username + " requires a password")
+		}
+		if user.Role == "" {
+			user.Role = "read-only"
+		}
+		if user.Role != "read-only" && user.Role != "operator" {
+			return nil, errors.New("Auth user " + username + " role must be 'read-only' or 'operator', unexpected " + user.Role)
+		}
+	}
+	for tokenName, token := range c.Auth.Tokens {
+		if token.Token == "" {
+			return nil, errors.New("Auth token " + tokenName + " requires a token")
+		}
+		if token.Role == "" {
+			token.Role = "read-only"
+		}
+		if token.Role != "read-only" && token.Role != "operator" {
+			return nil, errors.New("Auth token " + tokenName + " role must be 'read-only' or 'operator', unexpected " + token.Role)
+		}
+	}
+	if c.Auth.OIDC.Issuer != "" && (c.Auth.OIDC.ClientID == "" || c.Auth.OIDC.RedirectURL == "") {
+		return nil, errors.New("OIDC requires client-id and redirect-url to be set")
+	}
+
+	// Parse RTR servers
+	for i := range c.RTRServers {
+		rtrServer := &c.RTRServers[i]
+		rtrServerParts := strings.Split(rtrServer.Server, ":")
+		if len(rtrServerParts) != 2 {
+			return nil, fmt.Errorf("Invalid rtr-server '%s' format should be host:port", rtrServer.Server)
+		}
+		rtrServer.Host = rtrServerParts[0]
+		rtrServerPort, err := strconv.Atoi(rtrServerParts[1])
+		if err != nil || rtrServerPort < 1 || rtrServerPort > 65535 {
+			return nil, fmt.Errorf("Invalid RTR server port %s", rtrServerParts[1])
+		}
+		rtrServer.Port = rtrServerPort
+		if rtrServer.Transport == "ssh" && (rtrServer.SSHUser == "" || rtrServer.SSHPrivateKey == "") {
+			return nil, fmt.Errorf("RTR server %s ssh transport requires ssh-user and ssh-private-key", rtrServer.Server)
+		}
+	}
+
+	// Process peers in a stable order so the first error is deterministic
+	var peerNames []string
+	for peerName := range c.Peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+	for _, peerName := range peerNames {
+		if err := c.processPeer(peerName, c.Peers[peerName]); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ResolveAnnouncements(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil // nil error
+}
+
+// parseHealthcheck checks the intervals of a validated healthcheck and categorizes its conditional prefixes
+func (c *Config) parseHealthcheck(name string, protocolName string, healthcheck *Healthcheck) error {
+	if healthcheck.Rise == 0 || healthcheck.Fall == 0 || healthcheck.Interval == 0 {
+		return fmt.Errorf("healthcheck %s interval, rise and fall must be at least 1", name)
+	}
+	healthcheck.ProtocolName = protocolName
+	for _, prefix := range healthcheck.Prefixes {
+		ipv6, err := c.categorizeConditionalPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		if ipv6 {
+			healthcheck.Prefixes6 = append(healthcheck.Prefixes6, prefix)
+		} else {
+			healthcheck.Prefixes4 = append(healthcheck.Prefixes4, prefix)
 		}
+	}
+	return nil // nil error
+}
 
-		// Categorize communities
-		if peerData.ImportCommunities != nil {
-			for _, community := range *peerData.ImportCommunities {
-				communityType := categorizeCommunity(community)
-				if communityType == "standard" {
-					if peerData.ImportStandardCommunities == nil {
-						peerData.ImportStandardCommunities = &[]string{}
+// AllHealthchecks returns the healthchecks and the healthchecks built from conditional prefixes
+func (c *Config) AllHealthchecks() map[string]*Healthcheck {
+	healthchecks := map[string]*Healthcheck{}
+	for name, healthcheck := range c.Healthchecks {
+		healthchecks[name] = healthcheck
+	}
+	for name, healthcheck := range c.ConditionalHealthchecks {
+		healthchecks[name] = healthcheck
+	}
+	return healthchecks
+}
+
+// categorizePrefix adds an origin prefix to the per address family prefix lists
+func (c *Config) categorizePrefix(prefix string) error {
+	pfx, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return errors.New("Invalid origin prefix: " + prefix)
+	}
+
+	if pfx.To4() == nil { // If IPv6
+		c.Prefixes6 = append(c.Prefixes6, prefix)
+	} else { // If IPv4
+		c.Prefixes4 = append(c.Prefixes4, prefix)
+	}
+	return nil // nil error
+}
+
+// originated returns true if a prefix is unconditionally or conditionally originated
+func (c *Config) originated(prefix string) bool {
+	return util.Contains(c.Prefixes, prefix) || util.Contains(c.ConditionalPrefixes4, prefix) || util.Contains(c.ConditionalPrefixes6, prefix)
+}
+
+// hasTag returns true if any of the tags are in the other list of tags
+func hasTag(tags []string, others []string) bool {
+	for _, tag := range tags {
+		if util.Contains(others, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns a slice without any occurrences of a string
+func removeString(a []string, x string) []string {
+	var out []string
+	for _, n := range a {
+		if n != x {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// categorizeConditionalPrefix adds a conditionally originated prefix to the per address family conditional prefix lists and returns if it's IPv6
+func (c *Config) categorizeConditionalPrefix(prefix string) (bool, error) {
+	pfx, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false, errors.New("Invalid conditional origin prefix: " + prefix)
+	}
+	if util.Contains(c.Prefixes, prefix) {
+		return false, errors.New("Conditional origin prefix " + prefix + " is already unconditionally originated")
+	}
+	if util.Contains(c.ConditionalPrefixes4, prefix) || util.Contains(c.ConditionalPrefixes6, prefix) {
+		return false, errors.New("Conditional origin prefix " + prefix + " is bound to more than one condition")
+	}
+
+	if pfx.To4() == nil { // If IPv6
+		c.ConditionalPrefixes6 = append(c.ConditionalPrefixes6, prefix)
+		return true, nil
+	}
+	c.ConditionalPrefixes4 = append(c.ConditionalPrefixes4, prefix)
+	return false, nil // nil error
+}
+
+// AddPrefix adds a locally originated prefix to the config, call ResolveAnnouncements after adding prefixes to a loaded config
+func (c *Config) AddPrefix(prefix string) error {
+	if util.Contains(c.Prefixes, prefix) {
+		return nil
+	}
+	if err := c.categorizePrefix(prefix); err != nil {
+		return err
+	}
+	c.Prefixes = append(c.Prefixes, prefix)
+	c.OriginPrefixes = append(c.OriginPrefixes, &OriginPrefix{Prefix: prefix})
+	return nil // nil error
+}
+
+// AddPeer adds a peer to the config, applying templates and defaults as if it was defined in the config file
+func (c *Config) AddPeer(peerName string, peerData *Peer) error {
+	if c.Peers == nil {
+		c.Peers = map[string]*Peer{}
+	}
+	if _, exists := c.Peers[peerName]; exists {
+		return fmt.Errorf("peer %s is already defined", peerName)
+	}
+	if err := c.processPeer(peerName, peerData); err != nil {
+		return err
+	}
+	if err := c.resolveAnnouncements(peerName, peerData); err != nil {
+		return err
+	}
+	c.Peers[peerName] = peerData
+	return nil // nil error
+}
+
+// LoadFleet loads a fleet configuration from YAML
+func LoadFleet(fleetBlob []byte) (*Fleet, error) {
+	var f Fleet
+	if err := defaults.Set(&f); err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(fleetBlob, &f); err != nil {
+		return nil, errors.New("YAML unmarshal: " + err.Error())
+	}
+	if len(f.Routers) == 0 {
+		return nil, errors.New("fleet must contain at least one router")
+	}
+	validate := validator.New()
+	for name, router := range f.Routers {
+		if router == nil {
+			return nil, fmt.Errorf("fleet router %s is empty", name)
+		}
+		if err := defaults.Set(router); err != nil {
+			return nil, err
+		}
+		if err := validate.Struct(router); err != nil {
+			return nil, fmt.Errorf("fleet router %s validation: %v", name, err)
+		}
+		if !router.Agent && router.Host == "" {
+			return nil, fmt.Errorf("fleet router %s must have a host or be an agent", name)
+		}
+	}
+	return &f, nil // nil error
+}
+
+// LoadAgent loads an agent configuration from YAML
+func LoadAgent(agentBlob []byte) (*Agent, error) {
+	var a Agent
+	if err := defaults.Set(&a); err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(agentBlob, &a); err != nil {
+		return nil, errors.New("YAML unmarshal: " + err.Error())
+	}
+	if err := validator.New().Struct(&a); err != nil {
+		return nil, errors.New("Validation: " + err.Error())
+	}
+	return &a, nil // nil error
+}
+
+// LoadTestSpec loads an end-to-end test specification from YAML
+func LoadTestSpec(specBlob []byte) (*TestSpec, error) {
+	var t TestSpec
+	if err := defaults.Set(&t); err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(specBlob, &t); err != nil {
+		return nil, errors.New("YAML unmarshal: " + err.Error())
+	}
+	if len(t.Routes) > 0 && t.Peer == "" {
+		return nil, errors.New("test routes require a peer")
+	}
+	validate := validator.New()
+	for i, route := range t.Routes {
+		if route == nil {
+			return nil, fmt.Errorf("test route %d is empty", i)
+		}
+		if err := defaults.Set(route); err != nil {
+			return nil, err
+		}
+		if err := validate.Struct(route); err != nil {
+			return nil, fmt.Errorf("test route %s validation: %v", route.Prefix, err)
+		}
+		var err error
+		route.StandardCommunities, route.LargeCommunities, err = categorizeCommunities("test route "+route.Prefix, route.Communities, nil)
+		if err != nil {
+			return nil, err
+		}
+		route.ExpectStandardCommunities, route.ExpectLargeCommunities, err = categorizeCommunities("test route "+route.Prefix+" expected", route.ExpectCommunities, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil // nil error
+}
+
+// debugCategories lists the BIRD protocol debug categories
+var debugCategories = map[string]bool{
+	"states":     true,
+	"routes":     true,
+	"filters":    true,
+	"interfaces": true,
+	"events":     true,
+	"packets":    true,
+}
+
+// protocolNameRegex matches valid BIRD protocol names
+var protocolNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// protocolName renders the protocol name template for a peer and address family
+func (c *Config) protocolName(peerData *Peer, af string) (string, error) {
+	name := c.ProtocolNameTemplate
+	name = strings.ReplaceAll(name, "{{name}}", *peerData.ProtocolName)
+	name = strings.ReplaceAll(name, "{{asn}}", strconv.Itoa(*peerData.ASN))
+	name = strings.ReplaceAll(name, "{{class}}", peerClass(peerData))
+	name = strings.ReplaceAll(name, "{{af}}", af)
+	if !protocolNameRegex.MatchString(name) {
+		return "", fmt.Errorf("protocol name template %s renders invalid protocol name %s", c.ProtocolNameTemplate, name)
+	}
+	return name, nil // nil error
+}
+
+// peerClass returns the sanitized template name of a peer, or PEER if it has no template
+func peerClass(peerData *Peer) string {
+	if peerData.Template != nil && *peerData.Template != "" {
+		return *util.Sanitize(*peerData.Template)
+	}
+	return "PEER"
+}
+
+// description renders a peer's description, or the global description template if the peer doesn't have one
+func (c *Config) description(peerName string, peerData *Peer) (string, error) {
+	description := c.DescriptionTemplate
+	if peerData.Description != nil && *peerData.Description != "" {
+		description = *peerData.Description
+	}
+	description = strings.ReplaceAll(description, "{{name}}", peerName)
+	description = strings.ReplaceAll(description, "{{asn}}", strconv.Itoa(*peerData.ASN))
+	description = strings.ReplaceAll(description, "{{ix}}", util.StrDeref(peerData.IX))
+	description = strings.ReplaceAll(description, "{{class}}", peerClass(peerData))
+	if strings.Contains(description, "{{") {
+		return "", fmt.Errorf("unknown variable in description %s", description)
+	}
+	return description, nil // nil error
+}
+
+// FamilyProtocolName returns the base BGP protocol name of a peer for an address family
+func (p Peer) FamilyProtocolName(af string) string {
+	if af == "4" && p.ProtocolName4 != nil {
+		return *p.ProtocolName4
+	} else if af == "6" && p.ProtocolName6 != nil {
+		return *p.ProtocolName6
+	}
+	return *p.ProtocolName + "v" + af
+}
+
+// peerField stores the parsed default value of a peer field
+type peerField struct {
+	name  string
+	yaml  string
+	value reflect.Value // Invalid if the field isn't defaulted
+}
+
+var (
+	peerFieldsOnce  sync.Once
+	peerFieldsCache []peerField
+)
+
+// peerFields returns the fields of the peer struct with their parsed defaults, in field order
+func peerFields() []peerField {
+	peerFieldsOnce.Do(func() {
+		peerType := reflect.TypeOf(Peer{})
+		for i := 0; i < peerType.NumField(); i++ {
+			structField := peerType.Field(i)
+			field := peerField{name: structField.Name, yaml: structField.Tag.Get("yaml")}
+			defaultString := structField.Tag.Get("default")
+			if defaultString == "" {
+				logger.Fatalf("Code error: field %s has no default value", field.name)
+			} else if defaultString != "-" {
+				switch elemToSwitch := structField.Type.Elem().Kind(); elemToSwitch {
+				case reflect.String:
+					field.value = reflect.ValueOf(defaultString)
+				case reflect.Int:
+					defaultValueInt, err := strconv.Atoi(defaultString)
+					if err != nil {
+						logger.Fatalf("Can't convert '%s' to uint", defaultString)
 					}
-					*peerData.ImportStandardCommunities = append(*peerData.ImportStandardCommunities, community)
-				} else if communityType == "large" {
-					if peerData.ImportLargeCommunities == nil {
-						peerData.ImportLargeCommunities = &[]string{}
+					field.value = reflect.ValueOf(defaultValueInt)
+				case reflect.Bool:
+					defaultBool, err := strconv.ParseBool(defaultString)
+					if err != nil {
+						logger.Fatalf("Can't parse bool %s", defaultString)
 					}
-					*peerData.ImportLargeCommunities = append(*peerData.ImportLargeCommunities, strings.ReplaceAll(community, ":", ","))
-				} else {
-					return nil, errors.New("Invalid import community: " + community)
+					field.value = reflect.ValueOf(defaultBool)
+				case reflect.Struct, reflect.Slice:
+					// Ignore structs and slices
+				default:
+					logger.Fatalf("Unknown kind %+v for field %s", elemToSwitch, field.name)
 				}
 			}
+			peerFieldsCache = append(peerFieldsCache, field)
+		}
+	})
+	return peerFieldsCache
+}
+
+// processPeer applies templates and defaults to a peer and builds its prefix sets and community lists
+func (c *Config) processPeer(peerName string, peerData *Peer) error {
+	// Set sanitized peer name
+	peerData.ProtocolName = util.Sanitize(peerName)
+
+	// If any peer has NVRS filtering enabled, mark it for querying.
+	if peerData.FilterNeverViaRouteServers != nil {
+		c.QueryNVRS = true
+	}
+
+	if peerData.NeighborIPs == nil || len(*peerData.NeighborIPs) < 1 {
+		return fmt.Errorf("peer %s has no neighbors defined", peerName)
+	}
+	for _, neighbor := range *peerData.NeighborIPs {
+		if err := util.ValidateNeighbor(neighbor); err != nil {
+			return fmt.Errorf("peer %s: %v", peerName, err)
 		}
+	}
 
-		if peerData.ExportCommunities != nil {
-			for _, community := range *peerData.ExportCommunities {
-				communityType := categorizeCommunity(community)
-				if communityType == "standard" {
-					if peerData.ExportStandardCommunities == nil {
-						peerData.ExportStandardCommunities = &[]string{}
-					}
-					*peerData.ExportStandardCommunities = append(*peerData.ExportStandardCommunities, community)
-				} else if communityType == "large" {
-					if peerData.ExportLargeCommunities == nil {
-						peerData.ExportLargeCommunities = &[]string{}
-					}
-					*peerData.ExportLargeCommunities = append(*peerData.ExportLargeCommunities, strings.ReplaceAll(community, ":", ","))
+	peerData.BooleanOptions = &[]string{}
+
+	// Assign values from template
+	debug := log.IsLevelEnabled(log.DebugLevel)
+	peerValue := reflect.ValueOf(peerData).Elem()
+	if peerData.Template != nil && *peerData.Template != "" {
+		template := c.Templates[*peerData.Template]
+		if template == nil {
+			return fmt.Errorf("peer %s: template %s not found", peerName, *peerData.Template)
+		}
+		templateValue := reflect.ValueOf(template).Elem()
+		for i, field := range peerFields() {
+			if field.name == "Template" { // Ignore the template field
+				continue
+			}
+			tValue := templateValue.Field(i)
+			templateHasValueConfigured := !tValue.IsNil()
+			if templateHasValueConfigured && peerValue.Field(i).IsNil() {
+				// Use a copy of the template's value so changes to the peer don't change the template
+				if tValue.Kind() == reflect.Ptr {
+					value := reflect.New(tValue.Elem().Type())
+					value.Elem().Set(tValue.Elem())
+					peerValue.Field(i).Set(value)
 				} else {
-					return nil, errors.New("Invalid export community: " + community)
+					peerValue.Field(i).Set(tValue)
 				}
 			}
+			if debug {
+				logger.WithField("peer", peerName).Debugf("field: %s template's value: %+v kind: %T templateHasValueConfigured: %v", field.name, reflect.Indirect(tValue), tValue.Kind().String(), templateHasValueConfigured)
+			}
 		}
-		if peerData.AnnounceCommunities != nil {
-			for _, community := range *peerData.AnnounceCommunities {
-				communityType := categorizeCommunity(community)
+	} // end peer template processor
 
-				if communityType == "standard" {
-					if peerData.AnnounceStandardCommunities == nil {
-						peerData.AnnounceStandardCommunities = &[]string{}
-					}
-					*peerData.AnnounceStandardCommunities = append(*peerData.AnnounceStandardCommunities, community)
-				} else if communityType == "large" {
-					if peerData.AnnounceLargeCommunities == nil {
-						peerData.AnnounceLargeCommunities = &[]string{}
-					}
-					*peerData.AnnounceLargeCommunities = append(*peerData.AnnounceLargeCommunities, strings.ReplaceAll(community, ":", ","))
-				} else {
-					return nil, errors.New("Invalid announce community: " + community)
+	// Set default values
+	for i, field := range peerFields() {
+		if !field.value.IsValid() {
+			if debug {
+				logger.WithField("peer", peerName).Debugf("skipping field %s with ignored default (-)", field.name)
+			}
+			continue
+		}
+		fieldValue := peerValue.Field(i)
+		if debug {
+			logger.WithField("peer", peerName).Debugf("(before defaulting, after templating) field %s value %+v", field.name, reflect.Indirect(fieldValue))
+		}
+		if fieldValue.IsNil() {
+			// Each peer gets its own copy of the default value
+			defaultValue := reflect.New(field.value.Type())
+			defaultValue.Elem().Set(field.value)
+			if debug {
+				logger.WithField("peer", peerName).Debugf("setting field %s to value %+v", field.name, field.value)
+			}
+			fieldValue.Set(defaultValue)
+		} else if field.value.Kind() == reflect.Bool {
+			// Add boolean values to the peer's config
+			*peerData.BooleanOptions = append(*peerData.BooleanOptions, field.yaml)
+		}
+	}
+
+	// BIRD and OpenBGPD can't hold a BGP session down until BFD is up
+	if *peerData.BFDStrict && c.Daemon != "frr" {
+		return fmt.Errorf("peer %s: bfd-strict isn't supported by %s", peerName, c.Daemon)
+	}
+
+	// ASPA verification uses the ASPA table from the RTR session, so it's only defined if a peer needs it
+	if *peerData.FilterASPA {
+		if !c.RPKIEnable {
+			return fmt.Errorf("peer %s has filter-aspa enabled and rpki-enable disabled", peerName)
+		}
+		c.ASPAEnable = true
+	}
+
+	// IS-IS routes are only redistributed into BGP for peers that announce them
+	if *peerData.AnnounceISIS {
+		c.ISISAnnounced = true
+	}
+
+	// Flowspec channels use the flowspec tables, so they're defined even without rules to announce
+	if *peerData.FlowSpec {
+		c.FlowSpecEnable = true
+	}
+
+	// Render protocol names
+	for _, af := range []string{"4", "6"} {
+		name, err := c.protocolName(peerData, af)
+		if err != nil {
+			return fmt.Errorf("peer %s: %v", peerName, err)
+		}
+		if af == "4" {
+			peerData.ProtocolName4 = &name
+		} else {
+			peerData.ProtocolName6 = &name
+		}
+	}
+
+	// Render description
+	description, err := c.description(peerName, peerData)
+	if err != nil {
+		return fmt.Errorf("peer %s: %v", peerName, err)
+	}
+	peerData.Description = &description
+
+	// Validate debug categories
+	if peerData.Debug != nil {
+		for _, category := range *peerData.Debug {
+			if category == "all" && len(*peerData.Debug) > 1 {
+				return fmt.Errorf("peer %s: debug category all can't be combined with other categories", peerName)
+			}
+			if category != "all" && !debugCategories[category] {
+				return fmt.Errorf("peer %s: unknown debug category %s", peerName, category)
+			}
+		}
+	}
+
+	// Validate graceful restart timers
+	if peerData.GracefulRestartTime != nil && (*peerData.GracefulRestartTime < 0 || *peerData.GracefulRestartTime > 4095) {
+		return fmt.Errorf("peer %s: graceful-restart-time must be between 0 and 4095 seconds", peerName)
+	}
+	if peerData.LLGRStaleTime != nil && (*peerData.LLGRStaleTime < 0 || *peerData.LLGRStaleTime > 16777215) {
+		return fmt.Errorf("peer %s: llgr-stale-time must be between 0 and 16777215 seconds", peerName)
+	}
+	if peerData.LLGR != nil && *peerData.LLGR {
+		peerData.GracefulRestart = util.BoolPtr(true)
+	}
+
+	// Validate BGP timers, deriving the keepalive time from the hold time if not set
+	if peerData.HoldTime != nil {
+		hold := *peerData.HoldTime
+		if hold != 0 && (hold < 3 || hold > 65535) {
+			return fmt.Errorf("peer %s: hold-time must be 0 or between 3 and 65535 seconds", peerName)
+		}
+		if peerData.KeepaliveTime == nil {
+			peerData.KeepaliveTime = util.IntPtr(hold / 3)
+		} else if hold != 0 && (*peerData.KeepaliveTime < 1 || hold < 3**peerData.KeepaliveTime) {
+			return fmt.Errorf("peer %s: hold-time %d must be at least 3 times keepalive-time %d", peerName, hold, *peerData.KeepaliveTime)
+		}
+	}
+	if peerData.ConnectRetryTime != nil && (*peerData.ConnectRetryTime < 1 || *peerData.ConnectRetryTime > 65535) {
+		return fmt.Errorf("peer %s: connect-retry-time must be between 1 and 65535 seconds", peerName)
+	}
+	if peerData.StartupHoldTime != nil && *peerData.StartupHoldTime != 0 && (*peerData.StartupHoldTime < 3 || *peerData.StartupHoldTime > 65535) {
+		return fmt.Errorf("peer %s: startup-hold-time must be 0 or between 3 and 65535 seconds", peerName)
+	}
+
+	if peerData.ASOverride != nil && *peerData.ASOverride {
+		c.ASOverrideEnable = true
+	}
+
+	// Validate the BGP role
+	if peerData.Role != nil {
+		switch *peerData.Role {
+		case "provider", "customer", "peer", "rs-server", "rs-client":
+		default:
+			return fmt.Errorf("peer %s: unknown role %s (expected provider, customer, peer, rs-server, or rs-client)", peerName, *peerData.Role)
+		}
+		if peerData.RSClient != nil && *peerData.RSClient && *peerData.Role != "rs-server" {
+			return fmt.Errorf("peer %s: rs-client sessions must have role rs-server, not %s", peerName, *peerData.Role)
+		}
+		peerData.BIRDRole = util.StrPtr(strings.Replace(*peerData.Role, "-", "_", 1))
+		c.RolesEnable = true
+	} else if peerData.RequireRole != nil && *peerData.RequireRole {
+		return fmt.Errorf("peer %s: require-role requires role", peerName)
+	}
+
+	// Resolve the TCP-AO key chain
+	if peerData.TCPAOKeyChain != nil {
+		chain, found := c.TCPAOKeyChains[*peerData.TCPAOKeyChain]
+		if !found {
+			return fmt.Errorf("peer %s: tcp-ao-key-chain %s not defined in tcp-ao-key-chains", peerName, *peerData.TCPAOKeyChain)
+		}
+		if peerData.Password != nil {
+			return fmt.Errorf("peer %s: tcp-ao-key-chain and password can't both be set", peerName)
+		}
+		peerData.TCPAOKeys = &chain.Keys
+	}
+	if peerData.TCPMSS != nil && (*peerData.TCPMSS < 88 || *peerData.TCPMSS > 65535) {
+		return fmt.Errorf("peer %s: tcp-mss must be between 88 and 65535", peerName)
+	}
+
+	// Bind the session to an interface
+	if peerData.Interface != nil {
+		if peerData.Multihop != nil && *peerData.Multihop {
+			return fmt.Errorf("peer %s: interface can't be set on a multihop session", peerName)
+		}
+		for _, neighbor := range *peerData.NeighborIPs {
+			if _, zone := util.SplitZone(neighbor); zone != "" && zone != *peerData.Interface {
+				return fmt.Errorf("peer %s: neighbor %s is scoped to %s, not interface %s", peerName, neighbor, zone, *peerData.Interface)
+			}
+		}
+	}
+
+	// Source the session from an interface, resolved by the daemon on the router
+	if peerData.ListenInterface != nil {
+		if c.Daemon == "bird" && peerData.Multihop != nil && *peerData.Multihop {
+			return fmt.Errorf("peer %s: listen-interface can't be set on a multihop session with bird", peerName)
+		}
+		if peerData.Interface != nil && *peerData.Interface != *peerData.ListenInterface {
+			return fmt.Errorf("peer %s: listen-interface %s doesn't match interface %s", peerName, *peerData.ListenInterface, *peerData.Interface)
+		}
+		for _, neighbor := range *peerData.NeighborIPs {
+			if _, zone := util.SplitZone(neighbor); zone != "" && zone != *peerData.ListenInterface {
+				return fmt.Errorf("peer %s: neighbor %s is scoped to %s, not listen-interface %s", peerName, neighbor, zone, *peerData.ListenInterface)
+			}
+		}
+	}
+
+	// Validate additional address families
+	if peerData.AFISAFI != nil {
+		var families []string
+		for _, afiSAFI := range *peerData.AFISAFI {
+			switch afiSAFI {
+			case "vpn4-unicast":
+				families = append(families, "4")
+			case "vpn6-unicast":
+				families = append(families, "6")
+			case "l2vpn-evpn":
+				peerData.EVPN = util.BoolPtr(true)
+				c.EVPNEnable = true
+			default:
+				return fmt.Errorf("peer %s: unknown afi-safi %s (expected vpn4-unicast, vpn6-unicast, or l2vpn-evpn)", peerName, afiSAFI)
+			}
+		}
+		if len(families) > 0 {
+			peerData.VPNFamilies = &families
+			c.L3VPNEnable = true
+		}
+	}
+
+	// Run the session in a VRF
+	if peerData.VRF != nil {
+		vrf, found := c.VRFs[*peerData.VRF]
+		if !found {
+			return fmt.Errorf("peer %s: vrf %s not defined in vrfs", peerName, *peerData.VRF)
+		}
+		if peerData.VPNFamilies != nil {
+			return fmt.Errorf("peer %s: afi-safi vpn4-unicast and vpn6-unicast can't be enabled on a session in a VRF", peerName)
+		}
+		peerData.VRFInterface = &vrf.Interface
+		peerData.VRFTableName = &vrf.TableName
+	}
+
+	// Build static prefix filters
+	if peerData.Prefixes != nil {
+		for _, prefix := range *peerData.Prefixes {
+			pfx, _, err := net.ParseCIDR(prefix)
+			if err != nil {
+				return errors.New("Invalid prefix: " + prefix)
+			}
+
+			if pfx.To4() == nil { // If IPv6
+				if peerData.PrefixSet6 == nil {
+					peerData.PrefixSet6 = &prefixset.Set{}
+				}
+				err = peerData.PrefixSet6.Add(prefix)
+			} else { // If IPv4
+				if peerData.PrefixSet4 == nil {
+					peerData.PrefixSet4 = &prefixset.Set{}
 				}
+				err = peerData.PrefixSet4.Add(prefix)
+			}
+			if err != nil {
+				return err
 			}
 		}
-		if peerData.RemoveCommunities != nil {
-			for _, community := range *peerData.RemoveCommunities {
-				communityType := categorizeCommunity(community)
+	}
 
-				if communityType == "standard" {
-					if peerData.RemoveStandardCommunities == nil {
-						peerData.RemoveStandardCommunities = &[]string{}
-					}
-					*peerData.RemoveStandardCommunities = append(*peerData.RemoveStandardCommunities, community)
-				} else if communityType == "large" {
-					if peerData.RemoveLargeCommunities == nil {
-						peerData.RemoveLargeCommunities = &[]string{}
-					}
-					*peerData.RemoveLargeCommunities = append(*peerData.RemoveLargeCommunities, strings.ReplaceAll(community, ":", ","))
+	// Categorize communities
+	for _, field := range []struct {
+		name        string
+		communities *[]string
+		standard    **[]string
+		large       **[]string
+		extended    **[]string
+	}{
+		{"import", peerData.ImportCommunities, &peerData.ImportStandardCommunities, &peerData.ImportLargeCommunities, &peerData.ImportExtendedCommunities},
+		{"export", peerData.ExportCommunities, &peerData.ExportStandardCommunities, &peerData.ExportLargeCommunities, &peerData.ExportExtendedCommunities},
+		{"announce", peerData.AnnounceCommunities, &peerData.AnnounceStandardCommunities, &peerData.AnnounceLargeCommunities, &peerData.AnnounceExtendedCommunities},
+		{"remove", peerData.RemoveCommunities, &peerData.RemoveStandardCommunities, &peerData.RemoveLargeCommunities, &peerData.RemoveExtendedCommunities},
+	} {
+		if field.communities == nil {
+			continue
+		}
+		standard, large, extended, err := categorizeAllCommunities(field.name, *field.communities, c.CommunityDefinitions)
+		if err != nil {
+			return err
+		}
+		if len(standard) > 0 {
+			*field.standard = &standard
+		}
+		if len(large) > 0 {
+			*field.large = &large
+		}
+		if len(extended) > 0 {
+			*field.extended = &extended
+		}
+	}
+
+	return nil // nil error
+}
+
+// ResolveAnnouncements resolves the originated prefixes announced to each peer, and must be called again after adding prefixes to a loaded config
+func (c *Config) ResolveAnnouncements() error {
+	var peerNames []string
+	for peerName := range c.Peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+	for _, peerName := range peerNames {
+		if err := c.resolveAnnouncements(peerName, c.Peers[peerName]); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
+
+// resolveAnnouncements resolves the subset of originated prefixes to announce to a peer
+func (c *Config) resolveAnnouncements(peerName string, peerData *Peer) error {
+	peerData.AnnouncePrefixes4 = nil
+	peerData.AnnouncePrefixes6 = nil
+
+	var announce []string
+	restricted := false
+	if peerData.AnnouncePrefixes != nil {
+		if !*peerData.AnnounceOriginated || len(c.Prefixes) < 1 {
+			return fmt.Errorf("peer %s: announce-prefixes requires announce-originated and originated prefixes", peerName)
+		}
+		restricted = true
+		for _, entry := range *peerData.AnnouncePrefixes {
+			if group, isGroup := c.PrefixGroups[entry]; isGroup {
+				announce = append(announce, group.Prefixes...)
+			} else if c.originated(entry) {
+				announce = append(announce, entry)
+			} else {
+				return fmt.Errorf("peer %s: announce-prefixes entry %s isn't an originated prefix or prefix group", peerName, entry)
+			}
+		}
+	} else if *peerData.AnnounceOriginated {
+		// Tagged prefix groups are only announced to peers with a matching tag
+		tags := c.Tags
+		if peerData.Tags != nil {
+			tags = *peerData.Tags
+		}
+		matched, excluded := map[string]bool{}, map[string]bool{}
+		for _, group := range c.PrefixGroups {
+			if len(group.Tags) == 0 {
+				continue
+			}
+			for _, prefix := range group.Prefixes {
+				if hasTag(tags, group.Tags) {
+					matched[prefix] = true
 				} else {
-					return nil, errors.New("Invalid remove community: " + community)
+					excluded[prefix] = true
 				}
 			}
 		}
-
-		// Check for no originated prefixes but announce-originated enabled
-		if len(c.Prefixes) < 1 && *peerData.AnnounceOriginated {
-			// No locally originated prefixes are defined, so there's nothing to originate
-			*peerData.AnnounceOriginated = false
+		for _, prefixes := range [][]string{c.Prefixes4, c.ConditionalPrefixes4, c.Prefixes6, c.ConditionalPrefixes6} {
+			for _, prefix := range prefixes {
+				if excluded[prefix] && !matched[prefix] {
+					restricted = true
+				} else if !util.Contains(announce, prefix) {
+					announce = append(announce, prefix)
+				}
+			}
 		}
-	} // end peer loop
+	}
+	if restricted {
+		announce4, announce6 := []string{}, []string{}
+		for _, prefix := range announce {
+			if strings.Contains(prefix, ":") { // If IPv6
+				if !util.Contains(announce6, prefix) {
+					announce6 = append(announce6, prefix)
+				}
+			} else if !util.Contains(announce4, prefix) { // If IPv4
+				announce4 = append(announce4, prefix)
+			}
+		}
+		peerData.AnnouncePrefixes4 = &announce4
+		peerData.AnnouncePrefixes6 = &announce6
+	}
 
-	return &c, nil // nil error
+	return nil // nil error
 }
 
 func sanitizeConfigName(s string) string {
@@ -654,7 +2689,7 @@ func documentConfigTypes(t reflect.Type) {
 		}
 
 		if description == "" {
-			log.Fatalf("Code error: %s doesn't have a description", field.Name)
+			logger.Fatalf("Code error: %s doesn't have a description", field.Name)
 		} else if description != "-" { // Ignore descriptions that are -
 			if strings.Contains(field.Type.String(), "config.") { // If the type is a config struct
 				if field.Type.Kind() == reflect.Map || field.Type.Kind() == reflect.Slice { // Extract the element if the type is a map or slice and add to set (reflect.Type to bool map)
@@ -0,0 +1,61 @@
+//go:build go1.18
+// +build go1.18
+
+package config
+
+import "testing"
+
+func FuzzLoad(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"asn: 34553\nrouter-id: 192.0.2.1\n",
+		`asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24, 2001:db8::/48]
+templates:
+  upstream:
+    local-pref: 90
+peers:
+  Example:
+    asn: 65530
+    template: upstream
+    neighbors: [203.0.113.2, 2001:db8::2]
+    prefixes: [198.51.100.0/24]
+    import-communities: ["65530:1", "65530:1:2"]
+    debug: [states]`,
+		`asn: 34553
+router-id: 192.0.2.1
+bfd:
+  Transit:
+    neighbor: 192.0.2.2
+    auth-type: md5
+    password: secret
+vrrp:
+  VIP:
+    state: primary
+    interface: eth0
+    vrid: 1
+    priority: 255
+    vips: [192.0.2.1/24]
+vrrp-sync-groups:
+  GROUP:
+    instances: [VIP]
+healthchecks:
+  web:
+    type: tcp
+    target: 192.0.2.10:80
+    prefixes: [198.51.100.0/24]
+rtr-server: 192.0.2.3:8282`,
+		"asn: 34553\nrouter-id: 192.0.2.1\npeers:\n  Example:\n",
+		"asn: 34553\nrouter-id: 192.0.2.1\nbfd:\n  Transit:\n",
+		"a: &a [*a, *a]\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, configBlob []byte) {
+		c, err := Load(configBlob)
+		if err == nil && c == nil {
+			t.Fatal("Load returned neither a config nor an error")
+		}
+	})
+}
@@ -1,43 +1,467 @@
 package config
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
-func TestCategorizeCommunity(t *testing.T) {
+func TestParseCommunity(t *testing.T) {
 	testCases := []struct {
 		input          string
+		expectedType   string
 		expectedOutput string
-		shouldError    bool
+		expectedError  string
 	}{
-		{"34553,0", "standard", false},
-		{"1,1", "standard", false},
-		{"4242424242:4242424242:0", "large", false},
-		{"1:1:0", "large", false},
-		{":", "", true},
-		{"4242424242,0", "", true},
-		{"0,4242424242", "", true},
-		{"foo,1", "", true},
-		{"1,bar", "", true},
-		{"", "", true},
-		{":1:1", "", true},
-		{"1::1", "", true},
-		{"1:1:", "", true},
-		{"-1:1:1", "", true},
-		{"1:-1:1", "", true},
-		{"1:1:-1", "", true},
+		{"34553,0", "standard", "34553,0", ""},
+		{"1,1", "standard", "1,1", ""},
+		{"34553:100", "standard", "34553,100", ""},
+		{"4242424242:4242424242:0", "large", "4242424242,4242424242,0", ""},
+		{"1:1:0", "large", "1,1,0", ""},
+		{"34553,1:0", "large", "34553,1,0", ""},
+		{":", "", "", "numbers"},
+		{"4242424242,0", "", "", "use a large community instead (4242424242:0:0)"},
+		{"4242424242:100", "", "", "use a large community instead (4242424242:100:0)"},
+		{"0,4242424242", "", "", "between 0 and 65535"},
+		{"foo,1", "", "", "numbers"},
+		{"1,bar", "", "", "numbers"},
+		{"", "", "", "numbers"},
+		{"1", "", "", "2 (standard) or 3 (large) parts"},
+		{"1:1:1:1", "", "", "2 (standard) or 3 (large) parts"},
+		{":1:1", "", "", "numbers"},
+		{"1::1", "", "", "numbers"},
+		{"1:1:", "", "", "numbers"},
+		{"-1:1:1", "", "", "numbers"},
+		{"1:-1:1", "", "", "numbers"},
+		{"1:1:-1", "", "", "numbers"},
+		{"1:1:4294967296", "", "", "numbers"},
+		{"rt:65530:100", "extended", "rt,65530,100", ""},
+		{"RO,65530,4294967295", "extended", "ro,65530,4294967295", ""},
+		{"rt:4200000000:100", "extended", "rt,4200000000,100", ""},
+		{"rt:192.0.2.1:100", "extended", "rt,192.0.2.1,100", ""},
+		{"rt:4200000000:65536", "", "", "32-bit ASN administrator must have a value between 0 and 65535"},
+		{"rt:192.0.2.1:65536", "", "", "IPv4 administrator must have a value between 0 and 65535"},
+		{"rt:2001:db8::1:100", "", "", "type (rt or ro), administrator, and value"},
+		{"rt:192.0.2.256:1", "", "", "invalid IPv4 administrator"},
+		{"rt:foo:1", "", "", "administrator must be an IPv4 address"},
+		{"rt:1", "", "", "type (rt or ro), administrator, and value"},
 	}
 	for _, tc := range testCases {
-		cType := categorizeCommunity(tc.input)
-		if cType != "" && tc.shouldError {
-			t.Errorf("categorizeCommunity should have errored on '%s' but didn't. expected error, got '%s'", tc.input, cType)
-		} else if cType == "" && !tc.shouldError {
-			t.Errorf("categorizeCommunity shouldn't have errored on '%s' but did. expected '%s'", tc.input, tc.expectedOutput)
-		} else if cType != tc.expectedOutput {
-			t.Errorf("categorizeCommunity %s failed. expected '%v' got '%v'", tc.input, tc.expectedOutput, cType)
+		cType, normalized, err := parseCommunity(tc.input)
+		if tc.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("parseCommunity %s: expected error containing '%s', got %v", tc.input, tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCommunity %s: unexpected error %v", tc.input, err)
+		} else if cType != tc.expectedType || normalized != tc.expectedOutput {
+			t.Errorf("parseCommunity %s failed. expected '%s' '%s' got '%s' '%s'", tc.input, tc.expectedType, tc.expectedOutput, cType, normalized)
+		}
+	}
+}
+
+func TestLoadConfigCommunities(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+communities: ["34553:1"]
+large-communities: ["34553,1,1"]
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    import-communities: ["34553:100", "34553,100,1", "rt:34553:10"]
+    announce-communities: ["ro:192.0.2.1:10"]
+    remove-communities: ["65530,1"]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"34553,1"}, c.Communities)
+	assert.Equal(t, []string{"34553,1,1"}, c.LargeCommunities)
+	assert.Equal(t, []string{"34553,100"}, *c.Peers["Example"].ImportStandardCommunities)
+	assert.Equal(t, []string{"34553,100,1"}, *c.Peers["Example"].ImportLargeCommunities)
+	assert.Equal(t, []string{"65530,1"}, *c.Peers["Example"].RemoveStandardCommunities)
+	assert.Nil(t, c.Peers["Example"].RemoveLargeCommunities)
+	assert.Equal(t, []string{"rt,34553,10"}, *c.Peers["Example"].ImportExtendedCommunities)
+	assert.Equal(t, []string{"ro,192.0.2.1,10"}, *c.Peers["Example"].AnnounceExtendedCommunities)
+	assert.Nil(t, c.Peers["Example"].RemoveExtendedCommunities)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`"65530,1"`, `"4200000000,1"`, "Invalid remove community 4200000000,1: AS4200000000 is a 32-bit ASN"},
+		{`communities: ["34553:1"]`, `communities: ["34553:1:1"]`, "large communities belong in large-communities"},
+		{`large-communities: ["34553,1,1"]`, `large-communities: ["34553,1"]`, "standard communities belong in communities"},
+		{`communities: ["34553:1"]`, `communities: ["rt:34553:1"]`, "Invalid global community rt:34553:1: extended communities are only supported in peer community lists"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigCommunityDefinitions(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+community-definitions:
+  learned-from-peer: "34553:100"
+  region-eu: "34553:2:276"
+communities: [learned-from-peer]
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    import-communities: [learned-from-peer, region-eu, "34553:200"]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"34553,100"}, c.Communities)
+	assert.Equal(t, []string{"34553,100", "34553,200"}, *c.Peers["Example"].ImportStandardCommunities)
+	assert.Equal(t, []string{"34553,2,276"}, *c.Peers["Example"].ImportLargeCommunities)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`region-eu, "34553:200"`, `region-us`, "Invalid import community region-us: not defined in community-definitions"},
+		{`region-eu: "34553:2:276"`, `region-eu: "34553"`, "Invalid community definition region-eu (34553)"},
+		{`region-eu: "34553:2:276"`, `1-eu: "34553:2:276"`, "Invalid community definition name 1-eu"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigActionCommunities(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+action-communities:
+  enabled: true
+  prepend-1: 2001
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint32(34553), c.ActionCommunities.ASN)
+	assert.Equal(t, uint32(1000), c.ActionCommunities.NoAnnounce)
+	assert.Equal(t, uint32(2001), c.ActionCommunities.Prepend1)
+	assert.True(t, *c.Peers["Example"].ActionCommunities)
+
+	_, err = Load([]byte(strings.Replace(configFile, "prepend-1: 2001", "prepend-1: 3000", 1)))
+	if err == nil || !strings.Contains(err.Error(), "Action communities prepend-1 and prepend-2 both use 3000") {
+		t.Errorf("expected duplicate action error, got %+v", err)
+	}
+}
+
+func TestLoadConfigFlowSpec(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+flowspec-rules:
+  ntp:
+    destination: 192.0.2.0/24
+    protocols: [17]
+    source-ports: ["123"]
+    action: rate-limit
+    rate-limit: 1000000
+  web:
+    destination: 2001:db8::/48
+    source: 2001:db8:ffff::/48
+    protocols: [6]
+    destination-ports: ["80", "8000-8080"]
+  scrubbing:
+    destination: 192.0.2.10/32
+    action: redirect
+    redirect: "65530:10"
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    flowspec: true`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.FlowSpecEnable)
+	assert.Equal(t, "4", c.FlowSpecRules["ntp"].AF)
+	assert.Equal(t, "dst 192.0.2.0/24; proto 17; sport 123;", c.FlowSpecRules["ntp"].Match)
+	assert.Equal(t, "generic, 0x80060000, 0x49742400", c.FlowSpecRules["ntp"].Community)
+	assert.Equal(t, "6", c.FlowSpecRules["web"].AF)
+	assert.Equal(t, "dst 2001:db8::/48; src 2001:db8:ffff::/48; next header 6; dport 80,8000..8080;", c.FlowSpecRules["web"].Match)
+	assert.Equal(t, "generic, 0x80060000, 0x0", c.FlowSpecRules["web"].Community)
+	assert.Equal(t, "generic, 0x8008fffa, 0xa", c.FlowSpecRules["scrubbing"].Community)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`redirect: "65530:10"`, `redirect: "4200000000:65536"`, "flowspec rule scrubbing: redirect route targets with a 32-bit ASN"},
+		{`redirect: "65530:10"`, `redirect: "65530"`, "flowspec rule scrubbing: redirect action requires a redirect route target"},
+		{`rate-limit: 1000000`, `rate-limit: 0`, "flowspec rule ntp: rate-limit action requires a rate-limit above 0"},
+		{`source-ports: ["123"]`, `source-ports: ["123-100"]`, "flowspec rule ntp: invalid port range 123-100"},
+		{`source-ports: ["123"]`, `source-ports: ["65536"]`, "flowspec rule ntp: invalid port 65536"},
+		{`source: 2001:db8:ffff::/48`, `source: 192.0.2.0/24`, "must be the same address family"},
+		{`action: rate-limit`, `action: accept`, "flowspec rule ntp validation"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigL3VPN(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+vrfs:
+  customer-a:
+    interface: vrf-a
+    kernel-table: 100
+    route-distinguisher: "34553,1"
+    import-targets: ["34553:1", "192.0.2.1:5"]
+    export-targets: ["34553:1"]
+peers:
+  Example:
+    asn: 34553
+    neighbors: [192.0.2.2]
+    afi-safi: [vpn4-unicast]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.L3VPNEnable)
+	vrf := c.VRFs["customer-a"]
+	assert.Equal(t, "VRF_CUSTOMERA", vrf.ProtocolName)
+	assert.Equal(t, "vrf_customera", vrf.TableName)
+	assert.Equal(t, "34553:1", vrf.RouteDistinguisher)
+	assert.Equal(t, []string{"rt,34553,1", "rt,192.0.2.1,5"}, vrf.ImportTargetCommunities)
+	assert.Equal(t, []string{"rt,34553,1"}, vrf.ExportTargetCommunities)
+	assert.Equal(t, []string{"4"}, *c.Peers["Example"].VPNFamilies)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`afi-safi: [vpn4-unicast]`, `afi-safi: [evpn]`, "peer Example: unknown afi-safi evpn"},
+		{`route-distinguisher: "34553,1"`, `route-distinguisher: "34553"`, "VRF customer-a route distinguisher 34553"},
+		{`export-targets: ["34553:1"]`, `export-targets: ["4200000000:65536"]`, "VRF customer-a export target 4200000000:65536"},
+		{`    kernel-table: 100` + "\n", "", "VRF customer-a validation"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigVRFPeers(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+vrfs:
+  customer-a:
+    interface: vrf-a
+    kernel-table: 100
+    source4: 198.51.100.1
+    prefixes: [198.51.100.0/24, 2001:db8:100::/48]
+peers:
+  Example:
+    asn: 65530
+    neighbors: [203.0.113.2]
+    vrf: customer-a`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, c.L3VPNEnable)
+	vrf := c.VRFs["customer-a"]
+	assert.Equal(t, []string{"198.51.100.0/24"}, vrf.Prefixes4)
+	assert.Equal(t, []string{"2001:db8:100::/48"}, vrf.Prefixes6)
+	assert.Equal(t, "vrf-a", *c.Peers["Example"].VRFInterface)
+	assert.Equal(t, "vrf_customera", *c.Peers["Example"].VRFTableName)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`vrf: customer-a`, `vrf: customer-b`, "peer Example: vrf customer-b not defined in vrfs"},
+		{`vrf: customer-a`, "vrf: customer-a\n    afi-safi: [vpn4-unicast]", "can't be enabled on a session in a VRF"},
+		{`source4: 198.51.100.1`, `source4: 2001:db8::1`, "VRF customer-a validation"},
+		{`198.51.100.0/24,`, `198.51.100.0/33,`, "VRF customer-a validation"},
+		{`    prefixes:`, "    route-distinguisher: \"34553:1\"\n    prefixes:", "VRF customer-a validation"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigOSPF(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+ospf:
+  redistribute: [static, bgp]
+  areas:
+    "0":
+      interfaces:
+        eth0:
+          cost: 20
+          authentication: cryptographic
+          password: secret
+    0.0.0.1:
+      stub: true
+      interfaces:
+        "eth1*":
+          passive: true`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.OSPF.OSPFv2)
+	assert.True(t, c.OSPF.OSPFv3)
+	assert.Equal(t, []string{"RTS_STATIC", "RTS_BGP"}, c.OSPF.RedistributeSources)
+	assert.Equal(t, uint(20), c.OSPF.Areas["0"].Interfaces["eth0"].Cost)
+	assert.Equal(t, "none", c.OSPF.Areas["0.0.0.1"].Interfaces["eth1*"].Authentication)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`0.0.0.1:`, `backbone:`, "invalid OSPF area ID backbone"},
+		{`redistribute: [static, bgp]`, `redistribute: [ospf]`, "Config.OSPF.Redistribute[0]"},
+		{`          password: secret` + "\n", "", "OSPF area 0 interface eth0 validation"},
+		{`authentication: cryptographic`, `authentication: simple`, "simple authentication isn't supported by OSPFv3"},
+		{"      stub: true\n      interfaces:\n        \"eth1*\":\n          passive: true", "      stub: true", "OSPF area 0.0.0.1 validation"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+
+	configFile = strings.Replace(configFile, "ospf:\n", "ospf:\n  ospfv3: false\n", 1)
+	if _, err := Load([]byte(strings.Replace(configFile, `authentication: cryptographic`, `authentication: simple`, 1))); err != nil {
+		t.Errorf("expected simple authentication to be allowed without OSPFv3, got %+v", err)
+	}
+}
+
+func TestLoadConfigBabelISIS(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+babel:
+  redistribute: [direct]
+  interfaces:
+    "wg*":
+      type: wireless
+isis:
+  net: 49.0001.1920.0000.2001.00
+  level: level-1
+  redistribute: [static, direct]
+  interfaces:
+    eth0:
+      metric: 20
+peers:
+  Example:
+    asn: 34553
+    neighbors: [192.0.2.2]
+    announce-isis: true`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"RTS_DEVICE"}, c.Babel.RedistributeSources)
+	assert.Equal(t, []string{"RTS_BABEL"}, c.IGPSources)
+	assert.Equal(t, "level-1", c.ISIS.RedistributeLevel)
+	assert.Equal(t, []string{"static", "connected"}, c.ISIS.RedistributeProtocols)
+	assert.True(t, c.ISISAnnounced)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`type: wireless`, `type: tunnel`, "Babel interface wg* validation"},
+		{`net: 49.0001.1920.0000.2001.00`, `net: 49.0001.1920.0000.2001`, "invalid IS-IS net 49.0001.1920.0000.2001"},
+		{`level: level-1`, `level: level-3`, "Config.ISIS.Level"},
+		{`metric: 20`, `metric: 16777216`, "IS-IS interface eth0 validation"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigEVPN(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+augments:
+  vxlan:
+    tenant-a:
+      vni: 10100
+      route-distinguisher: "192.0.2.1,100"
+      export-targets: ["34553:10100", "4200000000:1"]
+    tenant-b:
+      vni: 10200
+peers:
+  Example:
+    asn: 34553
+    neighbors: [192.0.2.2]
+    afi-safi: [l2vpn-evpn]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.EVPNEnable)
+	assert.False(t, c.L3VPNEnable)
+	assert.True(t, *c.Peers["Example"].EVPN)
+	assert.Nil(t, c.Peers["Example"].VPNFamilies)
+	vxlan := c.Augments.VXLAN["tenant-a"]
+	assert.Equal(t, "192.0.2.1:100", vxlan.RouteDistinguisher)
+	assert.Equal(t, []string{"34553:10100", "4200000000:1"}, vxlan.ExportTargets)
+	assert.Equal(t, "", c.Augments.VXLAN["tenant-b"].RouteDistinguisher)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`vni: 10200`, `vni: 10100`, "both use VNI 10100"},
+		{`vni: 10200`, `vni: 16777216`, "VXLAN segment tenant-b validation"},
+		{`route-distinguisher: "192.0.2.1,100"`, `route-distinguisher: "192.0.2.1"`, "VXLAN segment tenant-a route distinguisher 192.0.2.1"},
+		{`"4200000000:1"`, `"4200000000:65536"`, "VXLAN segment tenant-a export target 4200000000:65536"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
 		}
 	}
 }
@@ -134,6 +558,56 @@ vrrp:
 	}
 }
 
+func TestLoadConfigStaticAttributes(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+augments:
+  statics:
+    198.51.101.0/24:
+      nexthops:
+        - address: 192.0.2.11
+          weight: 2
+          bfd: true
+        - address: 192.0.2.12
+          onlink: true
+      preference: 150
+    198.51.102.0/24:
+      nexthop: 10.0.0.1
+      recursive: true
+    203.0.113.0/24:
+      nexthop: prohibit
+      preference: 10
+`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(150), c.Augments.Statics4["198.51.101.0/24"].Preference)
+	assert.Len(t, c.Augments.Statics4["198.51.101.0/24"].Nexthops, 2)
+	assert.Equal(t, []*StaticNexthop{{Address: "10.0.0.1"}}, c.Augments.Statics4["198.51.102.0/24"].Nexthops)
+	assert.Equal(t, uint(10), c.Augments.Blackholes4["203.0.113.0/24"].Preference)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`weight: 2`, `weight: 257`, "static 198.51.101.0/24 nexthop validation"},
+		{`address: 192.0.2.12`, `address: foo`, "static 198.51.101.0/24 nexthop validation"},
+		{`      nexthops:`, "      nexthop: 192.0.2.10\n      nexthops:", "can't have both nexthop and nexthops"},
+		{`nexthop: 10.0.0.1`, "nexthops:\n        - address: 10.0.0.1\n          bfd: true", "recursive statics can only have a single nexthop"},
+		{`      preference: 10`, "      recursive: true", "prohibit statics can't have nexthops or be recursive"},
+		{`preference: 150`, `preference: 65536`, "static 198.51.101.0/24 validation"},
+		{`    198.51.102.0/24:` + "\n", "    198.51.103.0/24:\n    198.51.102.0/24:\n", "static 198.51.103.0/24 is empty"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
 func TestLoadConfigInvalidStaticPrefix(t *testing.T) {
 	configFile := `
 asn: 34553
@@ -149,6 +623,32 @@ augments:
 	}
 }
 
+func TestLoadConfigBlackholeStatics(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+augments:
+  statics:
+    203.0.113.0/24: blackhole
+    198.51.100.0/24: 192.0.2.10
+    2001:db8:9::/48: unreachable
+`
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]*Static{"198.51.100.0/24": {Nexthop: "192.0.2.10", Nexthops: []*StaticNexthop{{Address: "192.0.2.10"}}}}, c.Augments.Statics4)
+	assert.Equal(t, map[string]*Static{"203.0.113.0/24": {Nexthop: "blackhole"}}, c.Augments.Blackholes4)
+	assert.Equal(t, map[string]*Static{"2001:db8:9::/48": {Nexthop: "unreachable"}}, c.Augments.Blackholes6)
+
+	_, err = Load([]byte(configFile + "  static-interfaces:\n    203.0.113.0/24: eth0\n"))
+	if err == nil || !strings.Contains(err.Error(), "can't be used with a blackhole static") {
+		t.Errorf("expected blackhole interface binding error, got %+v", err)
+	}
+	_, err = Load([]byte(strings.Replace(configFile, "blackhole", "discard", 1)))
+	if err == nil || !strings.Contains(err.Error(), "Invalid static nexthop: discard") {
+		t.Errorf("expected invalid static nexthop error, got %+v", err)
+	}
+}
+
 func TestLoadConfigInvalidVIP(t *testing.T) {
 	configFile := `
 asn: 34553
@@ -168,6 +668,961 @@ vrrp:
 	}
 }
 
+func TestLoadConfigVRRPOptions(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+vrrp:
+  VRRP 1:
+    state: backup
+    interface: eth1
+    vrid: 1
+    priority: 100
+    unicast-peers: [192.0.2.3]
+    auth-type: pass
+    auth-password: secret
+    nopreempt: true
+    track-interfaces:
+      - interface: eth0
+        weight: -20
+    track-scripts:
+      - script: /usr/local/bin/check-bird
+        weight: -30
+    vips:
+      - 192.0.2.2/24`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track := c.VRRPInstances["VRRP 1"].TrackScripts[0]; track.Name != "VRRP_1_0" || track.Interval != 2 || track.Fall != 1 {
+		t.Errorf("unexpected track script %+v", track)
+	}
+	if c.VRRPInstances["VRRP 1"].AuthType != "PASS" || c.VRRPInstances["VRRP 1"].AdvertInterval != 1 {
+		t.Errorf("unexpected VRRP instance %+v", c.VRRPInstances["VRRP 1"])
+	}
+
+	for _, tc := range []struct {
+		option string
+		err    string
+	}{
+		{"auth-type: md5", "VRRP auth type must be"},
+		{"auth-type: pass", "VRRP auth password must be"},
+		{"unicast-source: foo", "Invalid VRRP unicast source"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, "    auth-type: pass\n    auth-password: secret\n    nopreempt: true\n", "    "+tc.option+"\n", 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+
+	_, err = Load([]byte(strings.Replace(configFile, "weight: -20", "weight: -300", 1)))
+	if err == nil || !strings.Contains(err.Error(), "weight must be between") {
+		t.Errorf("expected track weight error, got %+v", err)
+	}
+
+	_, err = Load([]byte(strings.Replace(configFile, "state: backup", "state: primary", 1)))
+	if err == nil || !strings.Contains(err.Error(), "nopreempt requires backup state") {
+		t.Errorf("expected nopreempt error, got %+v", err)
+	}
+}
+
+func TestLoadConfigVRRPSyncGroups(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+vrrp:
+  v4:
+    state: primary
+    interface: eth1
+    vrid: 1
+    priority: 255
+    vips: [192.0.2.2/24]
+  v6:
+    state: primary
+    interface: eth1
+    vrid: 2
+    priority: 255
+    vips: [2001:db8::2/64]
+vrrp-sync-groups:
+  GATEWAY:
+    instances: [v4, v6]
+    notify-primary: /usr/local/bin/primary`
+	if _, err := Load([]byte(configFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load([]byte(strings.Replace(configFile, "[v4, v6]", "[v4, v7]", 1)))
+	if err == nil || !strings.Contains(err.Error(), "references undefined VRRP instance v7") {
+		t.Errorf("expected undefined instance error, got %+v", err)
+	}
+}
+
+func TestLoadConfigVRRPImplementation(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+vrrp:
+  VRRP 1:
+    state: primary
+    interface: eth1
+    vrid: 1
+    priority: 255
+    implementation: builtin
+    vips: [192.0.2.2/24]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.VRRPInstances["VRRP 1"].Implementation != "builtin" {
+		t.Errorf("expected builtin implementation, got %s", c.VRRPInstances["VRRP 1"].Implementation)
+	}
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"implementation: builtin", "implementation: bird", "VRRP implementation must be"},
+		{"priority: 255", "priority: 300", "VRID and priority must be between"},
+		{"vrid: 1", "vrid: 200\n    vrid6-offset: 100", "IPv6 VRID (VRID plus vrid6-offset) must be at most 255"},
+		{"implementation: builtin", "implementation: builtin\n    auth-type: pass\n    auth-password: secret", "aren't supported by the builtin implementation"},
+		{"vips: [192.0.2.2/24]", "vips: [192.0.2.2/24]\nvrrp-sync-groups:\n  GATEWAY:\n    instances: [VRRP 1]", "can't contain builtin VRRP instance"},
+		{"implementation: builtin", "implementation: carp\n    originate: [192.0.2.0/24]", "aren't supported by the carp implementation"},
+		{"implementation: builtin", "implementation: carp\n    auth-type: ah\n    auth-password: secret", "aren't supported by the carp implementation"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigVRRPOriginate(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24]
+vrrp:
+  VRRP 1:
+    state: backup
+    interface: eth1
+    vrid: 1
+    priority: 100
+    originate: [198.51.100.0/24, 2001:db8:1::/48]
+    vips: [192.0.2.2/24]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := c.VRRPInstances["VRRP 1"]
+	assert.Equal(t, "VRRP_VRRP_1", instance.ProtocolName)
+	assert.Equal(t, []string{"198.51.100.0/24"}, instance.Originate4)
+	assert.Equal(t, []string{"2001:db8:1::/48"}, c.ConditionalPrefixes6)
+
+	_, err = Load([]byte(strings.Replace(configFile, "198.51.100.0/24", "192.0.2.0/24", 1)))
+	if err == nil || !strings.Contains(err.Error(), "already unconditionally originated") {
+		t.Errorf("expected duplicate origin prefix error, got %+v", err)
+	}
+	_, err = Load([]byte(strings.Replace(configFile, "198.51.100.0/24", "foo", 1)))
+	if err == nil || !strings.Contains(err.Error(), "Invalid conditional origin prefix") {
+		t.Errorf("expected invalid origin prefix error, got %+v", err)
+	}
+}
+
+func TestLoadConfigHealthchecks(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+healthchecks:
+  DNS:
+    type: tcp
+    target: 127.0.0.1:53
+    prefixes: [198.51.100.53/32, 2001:db8:53::/48]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := c.Healthchecks["DNS"]
+	assert.Equal(t, "HEALTHCHECK_DNS", hc.ProtocolName)
+	assert.Equal(t, []string{"198.51.100.53/32"}, hc.Prefixes4)
+	assert.Equal(t, uint(5), hc.Interval)
+	assert.Equal(t, uint(2), hc.Rise)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"type: tcp", "type: udp", "healthcheck DNS validation"},
+		{"asn: 34553", "asn: 34553\nprefixes: [198.51.100.53/32]", "already unconditionally originated"},
+		{"healthchecks:", "vrrp:\n  VRRP 1:\n    state: primary\n    interface: eth0\n    vrid: 1\n    priority: 255\n    originate: [2001:db8:53::/48]\n    vips: [192.0.2.2/24]\nhealthchecks:", "bound to more than one condition"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigConditionalPrefixes(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+healthchecks:
+  DNS:
+    type: tcp
+    target: 127.0.0.1:53
+    prefixes: [198.51.100.53/32]
+conditional-prefixes:
+  203.0.113.0/24:
+    target: 192.0.2.10
+  2001:db8:10::/48:
+    probe: tcp
+    target: "[2001:db8::10]:443"
+    fall: 5`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := c.ConditionalHealthchecks["conditional prefix 203.0.113.0/24"]
+	assert.Equal(t, "HEALTHCHECK_CONDITIONAL_203_0_113_0_24", hc.ProtocolName)
+	assert.Equal(t, "icmp", hc.Type)
+	assert.Equal(t, []string{"203.0.113.0/24"}, hc.Prefixes4)
+	assert.Equal(t, uint(3), hc.Fall)
+	hc = c.ConditionalHealthchecks["conditional prefix 2001:db8:10::/48"]
+	assert.Equal(t, "HEALTHCHECK_CONDITIONAL_2001_db8_10___48", hc.ProtocolName)
+	assert.Equal(t, "tcp", hc.Type)
+	assert.Equal(t, []string{"2001:db8:10::/48"}, hc.Prefixes6)
+	assert.Equal(t, uint(5), hc.Fall)
+	assert.Len(t, c.AllHealthchecks(), 3)
+	assert.Equal(t, []string{"198.51.100.53/32", "203.0.113.0/24"}, c.ConditionalPrefixes4)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"probe: tcp", "probe: http", "conditional prefix 2001:db8:10::/48 validation"},
+		{"    target: 192.0.2.10", "    interval: 10", "conditional prefix 203.0.113.0/24 validation"},
+		{"203.0.113.0/24:", "198.51.100.53/32:", "bound to more than one condition"},
+		{"203.0.113.0/24:", "foo:", "Invalid conditional origin prefix"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigInterfaceBindings(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24, 198.51.100.0/24]
+prefix-interfaces:
+  198.51.100.0/24: eth1
+augments:
+  statics:
+    203.0.113.0/24: 192.0.2.10
+  static-interfaces:
+    203.0.113.0/24: eth2`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"192.0.2.0/24"}, c.Prefixes4)
+	assert.Equal(t, []string{"198.51.100.0/24"}, c.ConditionalPrefixes4)
+	assert.Equal(t, &LinkPrefixes{ProtocolName: "INTERFACE_ETH1", Prefixes4: []string{"198.51.100.0/24"}}, c.LinkPrefixes["eth1"])
+
+	_, err = Load([]byte(strings.Replace(configFile, "  198.51.100.0/24: eth1", "  198.51.100.128/25: eth1", 1)))
+	if err == nil || !strings.Contains(err.Error(), "isn't in prefixes") {
+		t.Errorf("expected unknown prefix binding error, got %+v", err)
+	}
+	_, err = Load([]byte(strings.Replace(configFile, "    203.0.113.0/24: eth2", "    203.0.113.0/25: eth2", 1)))
+	if err == nil || !strings.Contains(err.Error(), "isn't in statics") {
+		t.Errorf("expected unknown static binding error, got %+v", err)
+	}
+}
+
+func TestLoadConfigLinkLocalNeighbors(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+bfd:
+  LL:
+    neighbor: fe80::1%eth0
+peers:
+  Example:
+    asn: 65530
+    neighbors: [fe80::2%eth1]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "eth0", *c.BFDInstances["LL"].Interface)
+
+	_, err = Load([]byte(strings.Replace(configFile, "fe80::2%eth1", "2001:db8::2%eth1", 1)))
+	if err == nil || !strings.Contains(err.Error(), "only allowed on IPv6 link-local") {
+		t.Errorf("expected scoped global address error, got %+v", err)
+	}
+}
+
+func TestLoadConfigProtocolNameTemplate(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+protocol-name-template: "{{class}}_AS{{asn}}_{{name}}_v{{af}}"
+templates:
+  upstream:
+    local-pref: 90
+peers:
+  Transit 1:
+    asn: 65530
+    template: upstream
+    neighbors: [192.0.2.2]
+  Example:
+    asn: 65531
+    neighbors: [2001:db8::2]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "UPSTREAM_AS65530_TRANSIT_1_v4", c.Peers["Transit 1"].FamilyProtocolName("4"))
+	assert.Equal(t, "PEER_AS65531_EXAMPLE_v6", c.Peers["Example"].FamilyProtocolName("6"))
+
+	_, err = Load([]byte(strings.Replace(configFile, "{{class}}_AS{{asn}}", "{{asn}}", 1)))
+	if err == nil || !strings.Contains(err.Error(), "peer Example: protocol name template {{asn}}_{{name}}_v{{af}} renders invalid protocol name 65531_EXAMPLE_v4") {
+		t.Errorf("expected invalid protocol name error, got %+v", err)
+	}
+
+	c, err = Load([]byte(strings.Replace(configFile, "protocol-name-template: \"{{class}}_AS{{asn}}_{{name}}_v{{af}}\"\n", "", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "TRANSIT_1v4", c.Peers["Transit 1"].FamilyProtocolName("4"))
+}
+
+func TestLoadConfigDescriptionTemplate(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+description-template: "{{class}} AS{{asn}} {{name}}"
+templates:
+  ixp:
+    ix: FooIX
+peers:
+  Example:
+    asn: 65530
+    template: ixp
+    description: "{{name}} via {{ix}}"
+    neighbors: [192.0.2.2]
+  Other:
+    asn: 65531
+    neighbors: [192.0.2.3]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Example via FooIX", *c.Peers["Example"].Description)
+	assert.Equal(t, "PEER AS65531 Other", *c.Peers["Other"].Description)
+
+	_, err = Load([]byte(strings.Replace(configFile, "{{ix}}", "{{foo}}", 1)))
+	if err == nil || !strings.Contains(err.Error(), "unknown variable in description") {
+		t.Errorf("expected unknown variable error, got %+v", err)
+	}
+}
+
+func TestLoadConfigListenInterface(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65530
+    listen4: 192.0.2.1
+    listen-interface: pathvector-test0
+    neighbors: [192.0.2.2, fe80::2, fe80::3%pathvector-test0]`
+	// The interface is resolved by the daemon, so it doesn't have to exist where the config is loaded
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := c.Peers["Example"]
+	assert.Equal(t, "192.0.2.1", *peer.Listen4)
+	assert.Nil(t, peer.Listen6)
+	assert.Equal(t, []string{"192.0.2.2", "fe80::2", "fe80::3%pathvector-test0"}, *peer.NeighborIPs)
+
+	_, err = Load([]byte(strings.Replace(configFile, "fe80::3%pathvector-test0", "fe80::3%eth1", 1)))
+	if err == nil || !strings.Contains(err.Error(), "not listen-interface pathvector-test0") {
+		t.Errorf("expected neighbor scope error, got %+v", err)
+	}
+	_, err = Load([]byte(configFile + "\n    multihop: true"))
+	if err == nil || !strings.Contains(err.Error(), "listen-interface can't be set on a multihop session") {
+		t.Errorf("expected multihop error, got %+v", err)
+	}
+}
+
+func TestLoadConfigDebug(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    debug: [states, routes]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"states", "routes"}, *c.Peers["Example"].Debug)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"[states, routes]", "[all]", ""},
+		{"[states, routes]", "[all, states]", "debug category all can't be combined"},
+		{"[states, routes]", "[states, verbose]", "unknown debug category verbose"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if tc.err == "" && err != nil {
+			t.Errorf("unexpected error %v", err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigGracefulRestart(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    llgr: true`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := c.Peers["Example"]
+	assert.True(t, *peer.GracefulRestart)
+	assert.Equal(t, 120, *peer.GracefulRestartTime)
+	assert.Equal(t, 3600, *peer.LLGRStaleTime)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"llgr: true", "graceful-restart-time: 4096", "graceful-restart-time must be between 0 and 4095 seconds"},
+		{"llgr: true", "llgr-stale-time: 16777216", "llgr-stale-time must be between 0 and 16777215 seconds"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigBGPTimers(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    hold-time: 90`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := c.Peers["Example"]
+	assert.Equal(t, 30, *peer.KeepaliveTime)
+	assert.Equal(t, 120, *peer.ConnectRetryTime)
+	assert.Equal(t, 240, *peer.StartupHoldTime)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"hold-time: 90", "hold-time: 90\n    keepalive-time: 10", ""},
+		{"hold-time: 90", "hold-time: 0", ""},
+		{"hold-time: 90", "hold-time: 90\n    keepalive-time: 31", "hold-time 90 must be at least 3 times keepalive-time 31"},
+		{"hold-time: 90", "hold-time: 2", "hold-time must be 0 or between 3 and 65535 seconds"},
+		{"hold-time: 90", "connect-retry-time: 0", "connect-retry-time must be between 1 and 65535 seconds"},
+		{"hold-time: 90", "startup-hold-time: 70000", "startup-hold-time must be 0 or between 3 and 65535 seconds"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if tc.err == "" && err != nil {
+			t.Errorf("unexpected error %v", err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("expected error containing %s, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigTCPOptions(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+tcp-ao-key-chains:
+  transit:
+    keys:
+      - send-id: 1
+        recv-id: 2
+        secret: old
+      - send-id: 3
+        recv-id: 4
+        secret: new
+        algorithm: cmac-aes128
+peers:
+  Example:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    tcp-ao-key-chain: transit
+    tcp-mss: 1400
+    interface: gre1`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := *c.Peers["Example"].TCPAOKeys
+	assert.Len(t, keys, 2)
+	assert.True(t, keys[0].Preferred)
+	assert.Equal(t, "hmac sha1", keys[0].BIRDAlgorithm)
+	assert.Equal(t, "cmac aes128", keys[1].BIRDAlgorithm)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"tcp-ao-key-chain: transit", "tcp-ao-key-chain: customer", "tcp-ao-key-chain customer not defined"},
+		{"tcp-mss: 1400", "password: secret", "tcp-ao-key-chain and password can't both be set"},
+		{"send-id: 3", "send-id: 1", "reuses send-id 1"},
+		{"secret: new", "secret: new\n        preferred: true\n      - secret: newer\n        send-id: 5\n        recv-id: 5\n        preferred: true", "more than one preferred key"},
+		{"algorithm: cmac-aes128", "algorithm: hmac-sha3", "TCP-AO key chain transit key 1 validation"},
+		{"tcp-mss: 1400", "tcp-mss: 80", "tcp-mss must be between 88 and 65535"},
+		{"tcp-mss: 1400", "tcp-mss: 1400\n    bfd-strict: true", "bfd-strict isn't supported by bird"},
+		{"interface: gre1", "interface: gre1\n    multihop: true", "interface can't be set on a multihop session"},
+		{"[192.0.2.2]", "[\"fe80::1%eth0\"]", "neighbor fe80::1%eth0 is scoped to eth0, not interface gre1"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigASOverride(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Site A:
+    asn: 65540
+    neighbors: [192.0.2.2]
+  Site B:
+    asn: 65540
+    neighbors: [192.0.2.3]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, c.ASOverrideEnable)
+	assert.False(t, *c.Peers["Site A"].ASOverride)
+
+	c, err = Load([]byte(configFile + "\n    as-override: true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.ASOverrideEnable)
+	assert.True(t, *c.Peers["Site B"].ASOverride)
+}
+
+func TestLoadConfigRoles(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Upstream:
+    asn: 65510
+    neighbors: [192.0.2.2]
+  Member:
+    asn: 65520
+    neighbors: [192.0.2.3]
+    rs-client: true
+    role: rs-server
+    require-role: true`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.RolesEnable)
+	assert.Nil(t, c.Peers["Upstream"].BIRDRole)
+	assert.Equal(t, "rs_server", *c.Peers["Member"].BIRDRole)
+	assert.True(t, *c.Peers["Member"].RequireRole)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"role: rs-server", "role: transit", "unknown role transit"},
+		{"role: rs-server", "role: peer", "rs-client sessions must have role rs-server"},
+		{"    role: rs-server\n", "", "require-role requires role"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigBFDOptions(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+bfd:
+  Transit 1:
+    neighbor: 198.51.100.20
+    local: 198.51.100.1
+    multihop: true
+    auth-type: md5
+    password: secret`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bfd := c.BFDInstances["Transit 1"]; !*bfd.Multihop || *bfd.Passive || *bfd.Interval != 200 || *bfd.ProtocolName != "TRANSIT_1" {
+		t.Errorf("unexpected BFD instance %+v", bfd)
+	}
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"auth-type: md5", "auth-type: sha256", "BFD auth type must be"},
+		{"    password: secret", "", "authentication requires a password"},
+		{"auth-type: md5", "auth-type: simple\n    meticulous: true", "meticulous authentication requires md5 or sha1"},
+		{"local: 198.51.100.1", "local: foo", "invalid BFD local address"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigASPA(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Customer:
+    asn: 65530
+    neighbors: [192.0.2.2]
+    filter-aspa: true
+  Transit:
+    asn: 65531
+    neighbors: [192.0.2.3]`
+	c, err := Load([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, c.ASPAEnable)
+
+	// The ASPA table isn't defined unless a peer verifies ASPA
+	c, err = Load([]byte(strings.Replace(configFile, "    filter-aspa: true\n", "", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, c.ASPAEnable)
+
+	_, err = Load([]byte("rpki-enable: false" + configFile))
+	if err == nil || !strings.Contains(err.Error(), "rpki-enable disabled") {
+		t.Errorf("expected rpki-enable error, got %+v", err)
+	}
+}
+
+func TestLoadConfigInvalidAuthRole(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+auth:
+  tokens:
+    automation:
+      token: example
+      role: admin`
+
+	_, err := Load([]byte(configFile))
+	if err == nil || !strings.Contains(err.Error(), "role must be") {
+		t.Errorf("expected invalid auth role error, got %+v", err)
+	}
+}
+
+func TestLoadConfigProbeTargets(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+optimizer:
+  probe-targets:
+    - address: 192.0.2.10
+      port: 443
+    - type: https
+      address: 2001:db8::10
+      host: example.com`
+
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp", c.Optimizer.ProbeTargets[0].Type)
+	assert.Equal(t, 200, c.Optimizer.ProbeTargets[1].ExpectedStatus)
+	assert.Equal(t, "/", c.Optimizer.ProbeTargets[1].Path)
+
+	_, err = Load([]byte(configFile + "\n    - type: ftp\n      address: 192.0.2.11"))
+	assert.NotNil(t, err)
+}
+
+func TestLoadConfigUntrusted(t *testing.T) {
+	base := "asn: 34553\nrouter-id: 192.0.2.1\n"
+	for _, tc := range []struct {
+		config string
+		err    string
+	}{
+		{"peers:\n  Example:\n", "peer Example is empty"},
+		{"templates:\n  upstream:\n", "template upstream is empty"},
+		{"bfd:\n  Transit:\n", "BFD instance Transit is empty"},
+		{"vrrp:\n  VIP:\n", "VRRP instance VIP is empty"},
+		{"vrrp-sync-groups:\n  GROUP:\n", "VRRP sync group GROUP is empty"},
+		{"healthchecks:\n  web:\n", "healthcheck web is empty"},
+		{"auth:\n  users:\n    admin:\n", "auth user admin is empty"},
+		{"auth:\n  users:\n    admin:\n      role: operator\n", "Auth user admin requires a password"},
+		{"auth:\n  tokens:\n    ci:\n      role: operator\n", "Auth token ci requires a token"},
+		{"peers:\n  Example:\n    asn: 65530\n", "peer Example has no neighbors defined"},
+		{"peers:\n  Example:\n    asn: 65530\n    template: missing\n    neighbors: [203.0.113.2]\n", "template missing not found"},
+		{"templates:\n  upstream:\n    template: other\n", "Templates must not have a template field set"},
+		{"rtr-server: 192.0.2.3\n", "Invalid rtr-server"},
+		{"rtr-server: 192.0.2.3:99999\n", "Invalid RTR server port"},
+		{"rtr-servers:\n  - server: 192.0.2.3:323\n    transport: ssh\n", "requires ssh-user and ssh-private-key"},
+		{"rtr-servers:\n  - server: 192.0.2.3:8282\n    transport: tls\n", "Validation"},
+		{"prefixes: &a [*a, *a]\n", "YAML unmarshal"},
+		{strings.Repeat("#", maxConfigSize), "larger than the"},
+	} {
+		_, err := Load([]byte(base + tc.config))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigRTRServers(t *testing.T) {
+	c, err := Load([]byte("asn: 34553\nrouter-id: 192.0.2.1\nrtr-server: 192.0.2.3:8282\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []RTRServer{{Server: "192.0.2.3:8282", Preference: 1, Transport: "tcp", Host: "192.0.2.3", Port: 8282}}, c.RTRServers)
+
+	c, err = Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+rtr-servers:
+  - server: 192.0.2.3:8282
+  - server: rtr.example.com:22
+    preference: 2
+    transport: ssh
+    ssh-user: rpki
+    ssh-private-key: /etc/bird/rtr_key`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, c.RTRServers, 2)
+	assert.Equal(t, uint(1), c.RTRServers[0].Preference)
+	assert.Equal(t, "rtr.example.com", c.RTRServers[1].Host)
+	assert.Equal(t, 22, c.RTRServers[1].Port)
+	assert.Equal(t, "ssh", c.RTRServers[1].Transport)
+}
+
+func TestLoadConfigPrefixGroupTags(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+tags: [region=us]
+prefixes: [192.0.2.0/24, 198.51.100.0/24, 203.0.113.0/24, 2001:db8::/48]
+prefix-groups:
+  anycast: [192.0.2.0/24]
+  europe:
+    prefixes: [198.51.100.0/24, 2001:db8::/48]
+    tags: [region=eu]
+  america:
+    prefixes: [203.0.113.0/24]
+    tags: [region=us]
+peers:
+  Local:
+    asn: 65530
+    neighbors: [192.0.2.2]
+  Transatlantic:
+    asn: 65531
+    neighbors: [192.0.2.3]
+    tags: [region=eu]
+  Explicit:
+    asn: 65532
+    neighbors: [192.0.2.4]
+    announce-prefixes: [europe]`
+
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24"}, c.PrefixGroups["anycast"].Prefixes)
+	assert.Equal(t, []string{"192.0.2.0/24", "203.0.113.0/24"}, *c.Peers["Local"].AnnouncePrefixes4)
+	assert.Equal(t, []string{}, *c.Peers["Local"].AnnouncePrefixes6)
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24"}, *c.Peers["Transatlantic"].AnnouncePrefixes4)
+	assert.Equal(t, []string{"2001:db8::/48"}, *c.Peers["Transatlantic"].AnnouncePrefixes6)
+	assert.Equal(t, []string{"198.51.100.0/24"}, *c.Peers["Explicit"].AnnouncePrefixes4)
+
+	// Peers that match every tagged group announce all originated prefixes
+	c, err = Load([]byte(strings.Replace(configFile, "    tags: [region=eu]\n", "", 1)))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Peers["Local"].AnnouncePrefixes4)
+	c, err = Load([]byte(strings.Replace(configFile, "tags: [region=us]\nprefixes", "tags: [region=eu]\nprefixes", 1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24"}, *c.Peers["Local"].AnnouncePrefixes4)
+
+	_, err = Load([]byte(strings.Replace(configFile, "anycast: [192.0.2.0/24]", "anycast:", 1)))
+	assert.EqualError(t, err, "prefix group anycast is empty")
+}
+
+func TestLoadConfigOriginPrefixes(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+prefixes:
+  - 192.0.2.0/24
+  - prefix: 192.0.2.0/25
+    communities: ["34553:100", "34553:1:2"]
+    local-pref: 200
+    no-export: true
+  - prefix: 2001:db8::/48
+    local-pref: 50
+  - prefix: 2001:db8:1::/48`
+
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24", "192.0.2.0/25", "2001:db8::/48", "2001:db8:1::/48"}, c.Prefixes)
+	assert.Equal(t, []string{"192.0.2.0/24", "192.0.2.0/25"}, c.Prefixes4)
+	assert.Len(t, c.OriginAttributes, 2)
+	assert.Equal(t, []string{"34553,100", "65535,65281"}, c.OriginAttributes["192.0.2.0/25"].StandardCommunities)
+	assert.Equal(t, []string{"34553,1,2"}, c.OriginAttributes["192.0.2.0/25"].LargeCommunities)
+	assert.Equal(t, uint(200), *c.OriginAttributes["192.0.2.0/25"].LocalPref)
+	assert.Equal(t, uint(50), *c.OriginAttributes["2001:db8::/48"].LocalPref)
+
+	// Prefixes without attributes are encoded as prefix strings
+	out, err := yaml.Marshal(c.OriginPrefixes)
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "- 192.0.2.0/24\n")
+	assert.Contains(t, string(out), "no-export: true")
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"- 192.0.2.0/24", "- 192.0.2.0/25", "Duplicate origin prefix: 192.0.2.0/25"},
+		{"- prefix: 2001:db8:1::/48", "- prefix: 2001:db8:1::/48\n    med: 10", "YAML unmarshal"},
+		{`"34553:100"`, `"34553:a"`, "Invalid prefix 192.0.2.0/25 community 34553:a"},
+		{"- prefix: 2001:db8:1::/48", "- prefix: example", "Invalid origin prefix: example"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadConfigAnnouncePrefixes(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24, 198.51.100.0/24, 2001:db8::/48]
+prefix-groups:
+  europe: [198.51.100.0/24, 2001:db8::/48]
+peers:
+  Upstream:
+    asn: 65530
+    neighbors: [203.0.113.2]
+    announce-prefixes: [europe, 192.0.2.0/24, 198.51.100.0/24]
+  Other:
+    asn: 65531
+    neighbors: [203.0.113.3]`
+
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"198.51.100.0/24", "192.0.2.0/24"}, *c.Peers["Upstream"].AnnouncePrefixes4)
+	assert.Equal(t, []string{"2001:db8::/48"}, *c.Peers["Upstream"].AnnouncePrefixes6)
+	assert.Nil(t, c.Peers["Other"].AnnouncePrefixes4)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"[europe, 192.0.2.0/24", "[asia, 192.0.2.0/24", "announce-prefixes entry asia isn't an originated prefix or prefix group"},
+		{"europe: [198.51.100.0/24", "europe: [203.0.113.0/24", "prefix 203.0.113.0/24 in prefix group europe isn't originated"},
+		{"announce-prefixes:", "announce-originated: false\n    announce-prefixes:", "announce-prefixes requires announce-originated"},
+	} {
+		_, err := Load([]byte(strings.Replace(configFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoadTestSpec(t *testing.T) {
+	specFile := `
+peer: Example
+routes:
+  - prefix: 198.51.100.0/24
+    as-path: [65520]
+    communities: ["65530:1", "65530:2:3"]
+    expect-communities: ["34553,100"]
+  - prefix: 192.0.2.0/24
+    expect: reject`
+
+	spec, err := LoadTestSpec([]byte(specFile))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(60), spec.Timeout)
+	assert.Equal(t, "accept", spec.Routes[0].Expect)
+	assert.Equal(t, []string{"65530,1"}, spec.Routes[0].StandardCommunities)
+	assert.Equal(t, []string{"65530,2,3"}, spec.Routes[0].LargeCommunities)
+	assert.Equal(t, []string{"34553,100"}, spec.Routes[0].ExpectStandardCommunities)
+	assert.Equal(t, "reject", spec.Routes[1].Expect)
+
+	spec, err = LoadTestSpec(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, spec.Routes)
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{"peer: Example", "", "test routes require a peer"},
+		{"expect: reject", "expect: drop", "test route 192.0.2.0/24 validation"},
+		{"prefix: 192.0.2.0/24", "prefix: example", "test route example validation"},
+		{`"65530:1"`, `"65530:1:a"`, "Invalid test route 198.51.100.0/24 community 65530:1:a"},
+	} {
+		_, err := LoadTestSpec([]byte(strings.Replace(specFile, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
 func TestTemplateInheritance(t *testing.T) {
 	configFile := `
 asn: 34553
@@ -270,3 +1725,33 @@ func TestSanitizeConfigName(t *testing.T) {
 		}
 	}
 }
+
+// routeServerConfig returns a route server config with a number of clients
+func routeServerConfig(clients int) []byte {
+	var b strings.Builder
+	b.WriteString(`
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24, 2001:db8::/48]
+templates:
+  rs-client:
+    rs-client: true
+    import-communities: ["34553,100"]
+    export-communities: ["34553:1:1"]
+peers:
+`)
+	for i := 0; i < clients; i++ {
+		fmt.Fprintf(&b, "  Client %d:\n    asn: %d\n    template: rs-client\n    neighbors: [10.%d.%d.1, 2001:db8:%x::1]\n", i, 4200000000+i, i/256, i%256, i)
+	}
+	return []byte(b.String())
+}
+
+func BenchmarkLoadRouteServer(b *testing.B) {
+	configFile := routeServerConfig(2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Load(configFile); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
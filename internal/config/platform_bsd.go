@@ -0,0 +1,24 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package config
+
+import "runtime"
+
+// defaultVRRPImplementation is used for VRRP instances that don't set an implementation, CARP is built into the BSDs
+const defaultVRRPImplementation = "carp"
+
+// setPlatformDefaults replaces the Linux path and process control defaults with the BSD package locations
+func setPlatformDefaults(c *Config) {
+	c.BIRDBinary = "/usr/local/sbin/bird"
+	c.BIRDSocket = "/var/run/bird.ctl"
+	c.KeepalivedReload = "rc"
+	c.KeepalivedPIDFile = "/var/run/keepalived.pid"
+	if runtime.GOOS == "openbsd" {
+		c.BIRDDirectory = "/etc/bird/"
+		c.KeepalivedConfig = "/etc/keepalived/keepalived.conf"
+	} else {
+		c.BIRDDirectory = "/usr/local/etc/bird/"
+		c.KeepalivedConfig = "/usr/local/etc/keepalived/keepalived.conf"
+	}
+}
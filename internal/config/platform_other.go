@@ -0,0 +1,10 @@
+//go:build !freebsd && !openbsd
+// +build !freebsd,!openbsd
+
+package config
+
+// defaultVRRPImplementation is used for VRRP instances that don't set an implementation
+const defaultVRRPImplementation = "keepalived"
+
+// setPlatformDefaults keeps the Linux defaults from the struct tags
+func setPlatformDefaults(c *Config) {}
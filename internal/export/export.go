@@ -0,0 +1,171 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Filters stores a peer's resolved import filters
+type Filters struct {
+	IRR                  bool     `json:"irr" yaml:"irr"`
+	ASPath               bool     `json:"as-path" yaml:"as-path"`
+	RPKI                 bool     `json:"rpki" yaml:"rpki"`
+	ASPA                 bool     `json:"aspa" yaml:"aspa"`
+	MaxPrefix            bool     `json:"max-prefix" yaml:"max-prefix"`
+	BogonRoutes          bool     `json:"bogon-routes" yaml:"bogon-routes"`
+	BogonASNs            bool     `json:"bogon-asns" yaml:"bogon-asns"`
+	TransitASNs          bool     `json:"transit-asns" yaml:"transit-asns"`
+	PrefixLength         bool     `json:"prefix-length" yaml:"prefix-length"`
+	NeverViaRouteServers bool     `json:"never-via-route-servers" yaml:"never-via-route-servers"`
+	EnforceFirstAS       bool     `json:"enforce-first-as" yaml:"enforce-first-as"`
+	EnforcePeerNexthop   bool     `json:"enforce-peer-nexthop" yaml:"enforce-peer-nexthop"`
+	ASSet                string   `json:"as-set,omitempty" yaml:"as-set,omitempty"`
+	PrefixSet4           []string `json:"prefix-set4" yaml:"prefix-set4"`
+	PrefixSet6           []string `json:"prefix-set6" yaml:"prefix-set6"`
+	OriginASNs           []uint32 `json:"origin-asns,omitempty" yaml:"origin-asns,omitempty"`
+}
+
+// Limits stores a peer's resolved prefix limits
+type Limits struct {
+	Import4 int    `json:"import4" yaml:"import4"`
+	Import6 int    `json:"import6" yaml:"import6"`
+	Action  string `json:"action" yaml:"action"`
+}
+
+// Peer stores the resolved state of a single peer
+type Peer struct {
+	ASN                int      `json:"asn" yaml:"asn"`
+	LocalASN           int      `json:"local-asn" yaml:"local-asn"`
+	Description        string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Template           string   `json:"template,omitempty" yaml:"template,omitempty"`
+	Disabled           bool     `json:"disabled" yaml:"disabled"`
+	Neighbors          []string `json:"neighbors" yaml:"neighbors"`
+	Protocols          []string `json:"protocols" yaml:"protocols"`
+	LocalPref          int      `json:"local-pref" yaml:"local-pref"`
+	Prepends           int      `json:"prepends" yaml:"prepends"`
+	RSClient           bool     `json:"rs-client" yaml:"rs-client"`
+	RRClient           bool     `json:"rr-client" yaml:"rr-client"`
+	AnnounceDefault    bool     `json:"announce-default" yaml:"announce-default"`
+	AnnounceOriginated bool     `json:"announce-originated" yaml:"announce-originated"`
+	ImportCommunities  []string `json:"import-communities" yaml:"import-communities"`
+	ExportCommunities  []string `json:"export-communities" yaml:"export-communities"`
+	Filters            Filters  `json:"filters" yaml:"filters"`
+	Limits             Limits   `json:"limits" yaml:"limits"`
+}
+
+// State stores the resolved state of a router
+type State struct {
+	Hostname  string          `json:"hostname" yaml:"hostname"`
+	ASN       int             `json:"asn" yaml:"asn"`
+	RouterID  string          `json:"router-id" yaml:"router-id"`
+	Prefixes4 []string        `json:"prefixes4" yaml:"prefixes4"`
+	Prefixes6 []string        `json:"prefixes6" yaml:"prefixes6"`
+	Peers     map[string]Peer `json:"peers" yaml:"peers"`
+}
+
+// strSlice returns a string slice pointer's value, or an empty slice if nil
+func strSlice(s *[]string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return *s
+}
+
+// originASNs returns an origin ASN slice pointer's value, or nil if unset
+func originASNs(s *[]uint32) []uint32 {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// intDeref returns an int pointer's value, or a fallback if nil
+func intDeref(i *int, fallback int) int {
+	if i == nil {
+		return fallback
+	}
+	return *i
+}
+
+// boolDeref returns a bool pointer's value, or false if nil
+func boolDeref(b *bool) bool {
+	return b != nil && *b
+}
+
+// Build builds the state of a config, after peers have been processed and rendered
+func Build(c *config.Config) *State {
+	s := &State{
+		Hostname:  c.Hostname,
+		ASN:       c.ASN,
+		RouterID:  c.RouterID,
+		Prefixes4: c.Prefixes4,
+		Prefixes6: c.Prefixes6,
+		Peers:     map[string]Peer{},
+	}
+	if s.Prefixes4 == nil {
+		s.Prefixes4 = []string{}
+	}
+	if s.Prefixes6 == nil {
+		s.Prefixes6 = []string{}
+	}
+
+	for name, p := range c.Peers {
+		s.Peers[name] = Peer{
+			ASN:                intDeref(p.ASN, 0),
+			LocalASN:           intDeref(p.LocalASN, c.ASN),
+			Description:        util.StrDeref(p.Description),
+			Template:           util.StrDeref(p.Template),
+			Disabled:           boolDeref(p.Disabled),
+			Neighbors:          strSlice(p.NeighborIPs),
+			Protocols:          strSlice(p.Protocols),
+			LocalPref:          intDeref(p.LocalPref, 0),
+			Prepends:           intDeref(p.Prepends, 0),
+			RSClient:           boolDeref(p.RSClient),
+			RRClient:           boolDeref(p.RRClient),
+			AnnounceDefault:    boolDeref(p.AnnounceDefault),
+			AnnounceOriginated: boolDeref(p.AnnounceOriginated),
+			ImportCommunities:  strSlice(p.ImportCommunities),
+			ExportCommunities:  strSlice(p.ExportCommunities),
+			Filters: Filters{
+				IRR:                  boolDeref(p.FilterIRR),
+				ASPath:               boolDeref(p.FilterASPath),
+				RPKI:                 boolDeref(p.FilterRPKI),
+				ASPA:                 boolDeref(p.FilterASPA),
+				MaxPrefix:            boolDeref(p.FilterMaxPrefix),
+				BogonRoutes:          boolDeref(p.FilterBogonRoutes),
+				BogonASNs:            boolDeref(p.FilterBogonASNs),
+				TransitASNs:          boolDeref(p.FilterTransitASNs),
+				PrefixLength:         boolDeref(p.FilterPrefixLength),
+				NeverViaRouteServers: boolDeref(p.FilterNeverViaRouteServers),
+				EnforceFirstAS:       boolDeref(p.EnforceFirstAS),
+				EnforcePeerNexthop:   boolDeref(p.EnforcePeerNexthop),
+				ASSet:                util.StrDeref(p.ASSet),
+				PrefixSet4:           p.PrefixSet4.Strings(),
+				PrefixSet6:           p.PrefixSet6.Strings(),
+				OriginASNs:           originASNs(p.OriginASNs),
+			},
+			Limits: Limits{
+				Import4: intDeref(p.ImportLimit4, 0),
+				Import6: intDeref(p.ImportLimit6, 0),
+				Action:  util.StrDeref(p.MaxPrefixTripAction),
+			},
+		}
+	}
+	return s
+}
+
+// Marshal encodes a state as JSON or YAML
+func Marshal(s *State, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(s, "", "  ")
+	case "yaml":
+		return yaml.Marshal(s)
+	}
+	return nil, fmt.Errorf("unsupported format %s, must be json or yaml", format)
+}
@@ -0,0 +1,49 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestBuild(t *testing.T) {
+	c, err := config.Load([]byte(`
+asn: 65530
+router-id: 192.0.2.1
+prefixes:
+  - 192.0.2.0/24
+  - 2001:db8::/48
+peers:
+  Example:
+    asn: 65510
+    neighbors:
+      - 203.0.113.10
+    import-limit4: 50
+    prefixes:
+      - 198.51.100.0/24
+`))
+	assert.Nil(t, err)
+	c.Peers["Example"].Protocols = &[]string{"EXAMPLE_v4"}
+
+	s := Build(c)
+	assert.Equal(t, []string{"192.0.2.0/24"}, s.Prefixes4)
+	peer := s.Peers["Example"]
+	assert.Equal(t, 65530, peer.LocalASN)
+	assert.Equal(t, []string{"EXAMPLE_v4"}, peer.Protocols)
+	assert.Equal(t, 50, peer.Limits.Import4)
+	assert.Equal(t, "disable", peer.Limits.Action)
+	assert.True(t, peer.Filters.RPKI)
+	assert.Equal(t, []string{"198.51.100.0/24"}, peer.Filters.PrefixSet4)
+
+	out, err := Marshal(s, "json")
+	assert.Nil(t, err)
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(out, &decoded))
+	assert.Contains(t, decoded["peers"], "Example")
+
+	_, err = Marshal(s, "toml")
+	assert.NotNil(t, err)
+}
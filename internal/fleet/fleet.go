@@ -0,0 +1,361 @@
+package fleet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/provenance"
+)
+
+// Remote directories relative to the BIRD directory
+const (
+	stagingDir = ".pathvector-staging"
+	backupDir  = ".pathvector-backup"
+)
+
+// Remote runs shell commands on a router
+type Remote interface {
+	Run(command string, stdin []byte) (string, error)
+}
+
+// SSHRemote is a Remote connected over SSH
+type SSHRemote struct {
+	client *ssh.Client
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(p string) string {
+	if strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return path.Join(home, p[2:])
+		}
+	}
+	return p
+}
+
+// Dial opens an SSH connection to a fleet router
+func Dial(f *config.Fleet, router *config.FleetRouter) (*SSHRemote, error) {
+	keyFile := f.SSHKey
+	if router.SSHKey != "" {
+		keyFile = router.SSHKey
+	}
+	key, err := ioutil.ReadFile(expandHome(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading SSH key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SSH key %s: %v", keyFile, err)
+	}
+	hostKeyCallback, err := knownhosts.New(expandHome(f.KnownHosts))
+	if err != nil {
+		return nil, fmt.Errorf("loading known hosts: %v", err)
+	}
+
+	host := router.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	client, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            router.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(f.ConnectTimeout) * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SSH connect to %s: %v", host, err)
+	}
+	return &SSHRemote{client: client}, nil // nil error
+}
+
+// Run runs a command in a new SSH session and returns its combined output
+func (r *SSHRemote) Run(command string, stdin []byte) (string, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer session.Close()
+
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	session.Stdout = &out
+	session.Stderr = &out
+	log.Debugf("[fleet] running %s", command)
+	if err := session.Run(command); err != nil {
+		return out.String(), fmt.Errorf("%s: %v: %s", command, err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil // nil error
+}
+
+// Close closes the SSH connection
+func (r *SSHRemote) Close() error {
+	return r.client.Close()
+}
+
+// quote quotes a string for a POSIX shell
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// LocalFiles reads the rendered BIRD config files from a directory
+func LocalFiles(dir string) (map[string][]byte, error) {
+	matches, err := filepath.Glob(path.Join(dir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, m := range matches {
+		contents, err := ioutil.ReadFile(m)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Base(m)] = contents
+	}
+	return files, nil // nil error
+}
+
+// RemoteFiles reads the BIRD config files managed by pathvector from a router
+func RemoteFiles(r Remote, birdDirectory string) (map[string][]byte, error) {
+	out, err := r.Run("ls -1 "+quote(birdDirectory), nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing remote BIRD directory: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, name := range strings.Split(out, "\n") {
+		name = strings.TrimSpace(name)
+		if !managed(name) {
+			continue
+		}
+		contents, err := r.Run("cat "+quote(path.Join(birdDirectory, name)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("reading remote %s: %v", name, err)
+		}
+		files[name] = []byte(contents)
+	}
+	return files, nil // nil error
+}
+
+// managed checks if a file in the BIRD directory is written by pathvector
+func managed(name string) bool {
+	return name == "bird.conf" || (strings.HasPrefix(name, "AS") && strings.HasSuffix(name, ".conf"))
+}
+
+// Change stores a single changed file
+type Change struct {
+	File string
+	Diff string
+}
+
+// Diff compares local and remote files and returns the changes needed to make the remote match
+func Diff(local map[string][]byte, remote map[string][]byte) []Change {
+	names := map[string]bool{}
+	for name := range local {
+		names[name] = true
+	}
+	for name := range remote {
+		names[name] = true
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []Change
+	for _, name := range sorted {
+		l, lok := local[name]
+		r, rok := remote[name]
+		// Files that only differ by their provenance header render the same config
+		if lok && rok && bytes.Equal(provenance.Strip(l), provenance.Strip(r)) {
+			continue
+		}
+		changes = append(changes, Change{File: name, Diff: lineDiff(name, string(r), string(l))})
+	}
+	return changes
+}
+
+// splitLines splits a file into lines, ignoring the trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineDiff returns a simple unified-style diff between two files
+func lineDiff(name string, before string, after string) string {
+	a, b := splitLines(before), splitLines(after)
+
+	// Trim common prefix and suffix
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (router)\n+++ %s (generated)\n@@ line %d @@\n", name, name, prefix+1)
+
+	// Large changes (such as a regenerated prefix list) aren't worth aligning
+	if len(a)*len(b) > 4000000 {
+		for _, line := range a {
+			out.WriteString("-" + line + "\n")
+		}
+		for _, line := range b {
+			out.WriteString("+" + line + "\n")
+		}
+		return out.String()
+	}
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
+
+// Push uploads the generated files to a router, validates them, and reconfigures BIRD, rolling back if reconfiguration fails
+func Push(r Remote, local map[string][]byte, birdDirectory string, birdBinary string, birdcBinary string, birdSocket string) error {
+	if _, ok := local["bird.conf"]; !ok {
+		return errors.New("generated config has no bird.conf")
+	}
+	staging := path.Join(birdDirectory, stagingDir)
+	backup := path.Join(birdDirectory, backupDir)
+
+	// Upload to a staging directory
+	if _, err := r.Run(fmt.Sprintf("rm -rf %s && mkdir -p %s", quote(staging), quote(staging)), nil); err != nil {
+		return fmt.Errorf("creating staging directory: %v", err)
+	}
+	var names []string
+	for name := range local {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := r.Run("cat > "+quote(path.Join(staging, name)), local[name]); err != nil {
+			return fmt.Errorf("uploading %s: %v", name, err)
+		}
+	}
+
+	// Validate with the router's BIRD before touching the live config
+	if _, err := r.Run(fmt.Sprintf("cd %s && %s -c bird.conf -p", quote(staging), quote(birdBinary)), nil); err != nil {
+		return fmt.Errorf("remote BIRD config validation: %v", err)
+	}
+
+	// Back up the live config
+	if _, err := r.Run(fmt.Sprintf("rm -rf %s && mkdir -p %s && for f in %s/bird.conf %s/AS*.conf; do [ -e \"$f\" ] && cp -p \"$f\" %s/; done; true",
+		quote(backup), quote(backup), quote(birdDirectory), quote(birdDirectory), quote(backup)), nil); err != nil {
+		return fmt.Errorf("backing up remote config: %v", err)
+	}
+
+	// Install the new config
+	if _, err := r.Run(install(staging, birdDirectory), nil); err != nil {
+		return fmt.Errorf("installing config: %v", err)
+	}
+
+	configureErr := configure(r, birdcBinary, birdSocket)
+	if configureErr == nil {
+		return nil // nil error
+	}
+
+	log.Warnf("[fleet] reconfigure failed, rolling back: %v", configureErr)
+	if _, err := r.Run(install(backup, birdDirectory), nil); err != nil {
+		return fmt.Errorf("reconfigure failed (%v) and restoring backup failed: %v", configureErr, err)
+	}
+	if err := configure(r, birdcBinary, birdSocket); err != nil {
+		return fmt.Errorf("reconfigure failed (%v) and reconfigure after rollback failed: %v", configureErr, err)
+	}
+	return fmt.Errorf("reconfigure failed, rolled back to previous config: %v", configureErr)
+}
+
+// install returns a command that replaces the managed files in the BIRD directory with those in another directory, which may be empty
+func install(from string, birdDirectory string) string {
+	return fmt.Sprintf("rm -f %s/AS*.conf && for f in %s/*.conf; do if [ -e \"$f\" ]; then cp -p \"$f\" %s/ || exit 1; fi; done",
+		quote(birdDirectory), quote(from), quote(birdDirectory))
+}
+
+// reconfigureReplies are the BIRD replies to configure that mean the new config was accepted, by reply code
+var reconfigureReplies = map[string]string{
+	"0003": "Reconfigured",
+	"0004": "Reconfiguration in progress",
+}
+
+// reconfigured checks if birdc output contains a successful configure reply, with or without its reply code
+func reconfigured(out string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 5 && (line[4] == ' ' || line[4] == '-') {
+			if message, found := reconfigureReplies[line[:4]]; found && line[5:] == message {
+				return true
+			}
+		}
+		for _, message := range reconfigureReplies {
+			if line == message {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configure reconfigures BIRD and checks the response
+func configure(r Remote, birdcBinary string, birdSocket string) error {
+	out, err := r.Run(fmt.Sprintf("%s -s %s configure", quote(birdcBinary), quote(birdSocket)), nil)
+	if err != nil {
+		return err
+	}
+	// birdc exits successfully even if BIRD rejects the config
+	if !reconfigured(out) {
+		return errors.New(strings.TrimSpace(out))
+	}
+	log.Debugf("[fleet] BIRD response: %s", strings.TrimSpace(out))
+	return nil // nil error
+}
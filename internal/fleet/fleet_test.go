@@ -0,0 +1,92 @@
+package fleet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRemote records commands and returns scripted responses
+type fakeRemote struct {
+	commands  []string
+	uploads   map[string]string
+	responses map[string][]string
+}
+
+func (f *fakeRemote) Run(command string, stdin []byte) (string, error) {
+	f.commands = append(f.commands, command)
+	if stdin != nil {
+		f.uploads[command] = string(stdin)
+	}
+	for match, responses := range f.responses {
+		if strings.Contains(command, match) && len(responses) > 0 {
+			f.responses[match] = responses[1:]
+			return responses[0], nil
+		}
+	}
+	return "", nil
+}
+
+func TestDiff(t *testing.T) {
+	local := map[string][]byte{
+		"bird.conf":            []byte("router id 192.0.2.1;\nlog syslog all;\n"),
+		"AS65510_Example.conf": []byte("protocol bgp Example_v4 {\n  neighbor 192.0.2.10 as 65510;\n}\n"),
+	}
+	remote := map[string][]byte{
+		"bird.conf":        []byte("router id 192.0.2.1;\nlog syslog all;\n"),
+		"AS65520_Old.conf": []byte("protocol bgp Old_v4 {\n}\n"),
+	}
+
+	changes := Diff(local, remote)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "AS65510_Example.conf", changes[0].File)
+	assert.Contains(t, changes[0].Diff, "+  neighbor 192.0.2.10 as 65510;")
+	assert.Equal(t, "AS65520_Old.conf", changes[1].File)
+	assert.Contains(t, changes[1].Diff, "-protocol bgp Old_v4 {")
+
+	assert.Empty(t, Diff(remote, remote))
+}
+
+func TestLineDiff(t *testing.T) {
+	diff := lineDiff("bird.conf", "a\nb\nc\nd\n", "a\nx\nc\nd\ne\n")
+	assert.Equal(t, "--- bird.conf (router)\n+++ bird.conf (generated)\n@@ line 2 @@\n-b\n+x\n c\n d\n+e\n", diff)
+}
+
+func TestPushRollback(t *testing.T) {
+	r := &fakeRemote{
+		uploads: map[string]string{},
+		responses: map[string][]string{
+			"configure": {"bird.conf:1:1 syntax error", "Reconfigured"},
+		},
+	}
+	local := map[string][]byte{"bird.conf": []byte("router id 192.0.2.1;\n")}
+
+	err := Push(r, local, "/etc/bird", "bird", "birdc", "/run/bird/bird.ctl")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "rolled back")
+	assert.Equal(t, "router id 192.0.2.1;\n", r.uploads["cat > '/etc/bird/.pathvector-staging/bird.conf'"])
+	assert.Contains(t, r.commands, "cd '/etc/bird/.pathvector-staging' && 'bird' -c bird.conf -p")
+	assert.Equal(t, `rm -f '/etc/bird'/AS*.conf && for f in '/etc/bird/.pathvector-backup'/*.conf; do if [ -e "$f" ]; then cp -p "$f" '/etc/bird'/ || exit 1; fi; done`, r.commands[len(r.commands)-2])
+}
+
+func TestReconfigured(t *testing.T) {
+	assert.True(t, reconfigured("BIRD 2.0.8 ready.\nReading configuration from /etc/bird/bird.conf\nReconfigured\n"))
+	assert.True(t, reconfigured("0001 BIRD 2.0.8 ready.\n0002-Reading configuration from /etc/bird/bird.conf\n0003 Reconfigured\n"))
+	assert.True(t, reconfigured("Reconfiguration in progress\n"))
+	assert.False(t, reconfigured("bird.conf:1:1 syntax error\n"))
+	assert.False(t, reconfigured("Reconfiguration rolled back\n"))
+	assert.False(t, reconfigured("8002 Reconfigured\n"))
+}
+
+func TestPush(t *testing.T) {
+	r := &fakeRemote{
+		uploads:   map[string]string{},
+		responses: map[string][]string{"configure": {"Reconfigured"}},
+	}
+	local := map[string][]byte{"bird.conf": []byte("router id 192.0.2.1;\n")}
+	assert.Nil(t, Push(r, local, "/etc/bird", "bird", "birdc", "/run/bird/bird.ctl"))
+	assert.Equal(t, "'birdc' -s '/run/bird/bird.ctl' configure", r.commands[len(r.commands)-1])
+
+	assert.NotNil(t, Push(r, map[string][]byte{}, "/etc/bird", "bird", "birdc", "/run/bird/bird.ctl"))
+}
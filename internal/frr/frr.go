@@ -0,0 +1,75 @@
+package frr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Check checks if an FRR config file is valid
+func Check(vtysh string, file string) error {
+	out, err := exec.Command(vtysh, "--dryrun", "--inputfile", file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil // nil error
+}
+
+// Reload reloads the running FRR daemons by method ('systemd', 'rc' or 'none')
+func Reload(method string) error {
+	switch method {
+	case "none":
+		return nil
+	case "systemd":
+		out, err := exec.Command("systemctl", "reload", "frr").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("systemctl reload frr: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil // nil error
+	case "rc":
+		command := []string{"service", "frr", "reload"}
+		if runtime.GOOS == "openbsd" {
+			command = []string{"rcctl", "reload", "frr"}
+		}
+		out, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(command, " "), err, strings.TrimSpace(string(out)))
+		}
+		return nil // nil error
+	}
+	return fmt.Errorf("unknown FRR reload method %s", method)
+}
+
+// Apply moves a validated config from the cache directory into place and reloads FRR, restoring the previous config on failure
+func Apply(newFile string, file string, reload string, noConfigure bool) error {
+	// Keep the previous config to roll back to
+	previous, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := util.MoveFile(newFile, file); err != nil {
+		return fmt.Errorf("moving FRR config: %v", err)
+	}
+
+	if noConfigure {
+		return nil
+	}
+	log.Infoln("Reloading FRR")
+	if err := Reload(reload); err != nil {
+		if previous != nil {
+			log.Warnf("Restoring previous FRR config")
+			if err := ioutil.WriteFile(file, previous, 0644); err != nil {
+				log.Warnf("Restoring previous FRR config: %v", err)
+			}
+		}
+		return fmt.Errorf("reloading FRR: %v", err)
+	}
+	return nil // nil error
+}
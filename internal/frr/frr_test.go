@@ -0,0 +1,52 @@
+package frr
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	if err := Check("true", "frr.conf"); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+	if err := Check("false", "frr.conf"); err == nil {
+		t.Errorf("expected validation error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pathvector-frr-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "frr.conf")
+	newFile := path.Join(dir, "cache-frr.conf")
+
+	if err := ioutil.WriteFile(newFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "none", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(newFile); !os.IsNotExist(err) {
+		t.Errorf("expected cached config to be moved")
+	}
+
+	// Failed reload restores the previous config
+	if err := ioutil.WriteFile(newFile, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "carrier-pigeon", false); err == nil {
+		t.Errorf("expected reload error")
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Errorf("expected previous config to be restored, got %s", b)
+	}
+}
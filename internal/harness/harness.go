@@ -0,0 +1,386 @@
+package harness
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+// logger tags log entries from this package so its log level can be set separately
+var logger = log.WithField("module", "harness")
+
+// Default router side addresses for sessions with peers that don't set a listen address, from the benchmarking ranges
+const (
+	defaultRouterAddress4 = "198.18.0.1"
+	defaultRouterAddress6 = "2001:2::1"
+	defaultPeerRouterID   = "198.18.0.2"
+)
+
+// Options stores how to run the disposable BIRD instances
+type Options struct {
+	Runtime    string // netns to run a local BIRD binary in network namespaces, or docker
+	BIRDBinary string // BIRD binary for the netns runtime
+	Image      string // Docker image with BIRD for the docker runtime
+	Name       string // Prefix for network namespace, interface, and container names (up to 12 characters)
+}
+
+// Result stores the outcome of a test route on a single session
+type Result struct {
+	Prefix   string
+	Protocol string
+	Problems []string
+}
+
+// Passed checks if the route behaved as expected
+func (r *Result) Passed() bool {
+	return len(r.Problems) == 0
+}
+
+// session is a BGP session between the router and the test peer
+type session struct {
+	Name         string // Router protocol name
+	IPv6         bool
+	Neighbor     string // Neighbor address in the router config, used by the test peer
+	Router       string // Router address, used as the test peer's neighbor
+	NeighborPort int
+	LocalPort    int
+	ASN          int
+	RouterASN    int
+	Password     string
+	Multihop     bool
+	Routes       []*config.TestRoute
+}
+
+// peerTemplate is the BIRD config of the test peer, which announces the test routes to the router
+var peerTemplate = template.Must(template.New("peer").Funcs(template.FuncMap{
+	"Reverse": func(path []uint32) []uint32 {
+		reversed := make([]uint32, len(path))
+		for i, asn := range path {
+			reversed[len(path)-1-i] = asn
+		}
+		return reversed
+	},
+}).Parse(`router id {{ .RouterID }};
+
+protocol device {}
+{{ range $i, $s := .Sessions }}
+protocol static routes{{ $i }} {
+  {{ if $s.IPv6 }}ipv6{{ else }}ipv4{{ end }};
+{{- range $s.Routes }}
+  route {{ .Prefix }} blackhole;
+{{- end }}
+}
+
+protocol bgp session{{ $i }} {
+  local {{ $s.Neighbor }} port {{ $s.NeighborPort }} as {{ $s.ASN }};
+  neighbor {{ $s.Router }} port {{ $s.LocalPort }} as {{ $s.RouterASN }};
+  {{ if $s.Password }}password "{{ $s.Password }}";{{ end }}
+  {{ if $s.Multihop }}multihop;{{ end }}
+  {{ if $s.IPv6 }}ipv6{{ else }}ipv4{{ end }} {
+    import none;
+    export filter {
+{{- range $s.Routes }}
+      if net = {{ .Prefix }} then {
+{{- range Reverse .ASPath }}
+        bgp_path.prepend({{ . }});
+{{- end }}
+{{- range .StandardCommunities }}
+        bgp_community.add(({{ . }}));
+{{- end }}
+{{- range .LargeCommunities }}
+        bgp_large_community.add(({{ . }}));
+{{- end }}
+        accept;
+      }
+{{- end }}
+      reject;
+    };
+  };
+}
+{{ end }}`))
+
+// sessions returns the sessions to run for a peer, one for each of its neighbors
+func sessions(c *config.Config, peer *config.Peer, routes []*config.TestRoute) ([]*session, error) {
+	routerASN := c.ASN
+	if peer.LocalASN != nil && *peer.LocalASN != 0 {
+		routerASN = *peer.LocalASN
+	}
+	var out []*session
+	for i, neighbor := range *peer.NeighborIPs {
+		if _, zone := util.SplitZone(neighbor); zone != "" {
+			return nil, fmt.Errorf("link-local neighbor %s isn't supported by the test harness", neighbor)
+		}
+		if peer.Protocols == nil || i >= len(*peer.Protocols) {
+			return nil, fmt.Errorf("no protocol was generated for neighbor %s", neighbor)
+		}
+		s := &session{
+			Name:         (*peer.Protocols)[i],
+			IPv6:         strings.Contains(neighbor, ":"),
+			Neighbor:     neighbor,
+			Router:       defaultRouterAddress4,
+			NeighborPort: *peer.NeighborPort,
+			LocalPort:    *peer.LocalPort,
+			ASN:          *peer.ASN,
+			RouterASN:    routerASN,
+			Password:     util.StrDeref(peer.Password),
+			Multihop:     *peer.Multihop,
+		}
+		if s.IPv6 {
+			s.Router = defaultRouterAddress6
+			if util.StrDeref(peer.Listen6) != "" {
+				s.Router = *peer.Listen6
+			}
+		} else if util.StrDeref(peer.Listen4) != "" {
+			s.Router = *peer.Listen4
+		}
+		for _, route := range routes {
+			if strings.Contains(route.Prefix, ":") == s.IPv6 {
+				s.Routes = append(s.Routes, route)
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil // nil error
+}
+
+// peerConfig renders the test peer BIRD config for a set of sessions
+func peerConfig(sessions []*session) (string, error) {
+	routerID := defaultPeerRouterID
+	for _, s := range sessions {
+		if !s.IPv6 {
+			routerID = s.Neighbor
+			break
+		}
+	}
+	var b bytes.Buffer
+	if err := peerTemplate.Execute(&b, map[string]interface{}{"RouterID": routerID, "Sessions": sessions}); err != nil {
+		return "", err
+	}
+	return b.String(), nil // nil error
+}
+
+// rejectionRegex matches the log message of a route rejected by the pathvector _reject function
+var rejectionRegex = regexp.MustCompile(`REJECTED \[(.*?)\] pfx (\S+) session (\S+)`)
+
+// rejections parses rejection reasons by session and prefix from a BIRD log file
+func rejections(log string) map[string]string {
+	reasons := map[string]string{}
+	for _, match := range rejectionRegex.FindAllStringSubmatch(log, -1) {
+		reasons[match[3]+" "+match[2]] = match[1]
+	}
+	return reasons
+}
+
+// normalizeCommunity formats a community in comma notation the way BIRD shows it in route attributes
+func normalizeCommunity(community string) string {
+	return "(" + strings.ReplaceAll(community, " ", "") + ")"
+}
+
+// hasCommunity checks if a BIRD community list attribute contains a community
+func hasCommunity(attribute string, community string) bool {
+	for _, c := range strings.Split(strings.ReplaceAll(attribute, ", ", ","), " ") {
+		if c == normalizeCommunity(community) {
+			return true
+		}
+	}
+	return false
+}
+
+// check compares a test route against the routes the router received on a session
+func check(route *config.TestRoute, s *session, accepted []*birdc.Route, filtered []*birdc.Route, reasons map[string]string) *Result {
+	result := &Result{Prefix: route.Prefix, Protocol: s.Name}
+	find := func(routes []*birdc.Route) *birdc.Route {
+		for _, r := range routes {
+			if r.Prefix == route.Prefix {
+				return r
+			}
+		}
+		return nil
+	}
+
+	received := find(accepted)
+	if received == nil {
+		if find(filtered) == nil {
+			result.Problems = append(result.Problems, "route wasn't received")
+		} else if route.Expect == "accept" {
+			reason := reasons[s.Name+" "+route.Prefix]
+			if reason == "" {
+				reason = "unknown reason"
+			}
+			result.Problems = append(result.Problems, "expected accept, route was rejected ("+reason+")")
+		}
+		return result
+	}
+	if route.Expect == "reject" {
+		result.Problems = append(result.Problems, "expected reject, route was accepted")
+		return result
+	}
+
+	for _, community := range route.ExpectStandardCommunities {
+		if !hasCommunity(received.Attributes["BGP.community"], community) {
+			result.Problems = append(result.Problems, fmt.Sprintf("missing community %s (has %s)", community, received.Attributes["BGP.community"]))
+		}
+	}
+	for _, community := range route.ExpectLargeCommunities {
+		if !hasCommunity(received.Attributes["BGP.large_community"], community) {
+			result.Problems = append(result.Problems, fmt.Sprintf("missing large community %s (has %s)", community, received.Attributes["BGP.large_community"]))
+		}
+	}
+	if route.ExpectLocalPref != 0 {
+		localPref, _ := strconv.Atoi(received.Attributes["BGP.local_pref"])
+		if uint(localPref) != route.ExpectLocalPref {
+			result.Problems = append(result.Problems, fmt.Sprintf("expected local pref %d, got %d", route.ExpectLocalPref, localPref))
+		}
+	}
+	return result
+}
+
+// Run starts the config rendered into the cache directory in a disposable BIRD instance and runs a test spec against it, returning a result for each route on each session
+func Run(c *config.Config, spec *config.TestSpec, opts *Options) ([]*Result, error) {
+	timeout := time.Duration(spec.Timeout) * time.Second
+	router, err := start(opts, opts.Name+"-router", c.CacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+	defer router.stop()
+	if err := router.wait(timeout); err != nil {
+		return nil, err
+	}
+	logger.Infof("Started BIRD in %s", router.netns)
+	if spec.Peer == "" {
+		return nil, nil // nil error
+	}
+
+	peer, found := c.Peers[spec.Peer]
+	if !found {
+		return nil, fmt.Errorf("peer %s isn't in the config", spec.Peer)
+	}
+	peerSessions, err := sessions(c, peer, spec.Routes)
+	if err != nil {
+		return nil, err
+	}
+	if len(peerSessions) == 0 {
+		return nil, errors.New("peer " + spec.Peer + " has no neighbors")
+	}
+	peerConf, err := peerConfig(peerSessions)
+	if err != nil {
+		return nil, fmt.Errorf("test peer config: %v", err)
+	}
+	peerDir := path.Join(path.Dir(path.Clean(c.CacheDirectory)), "peer")
+	if err := os.MkdirAll(peerDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path.Join(peerDir, "bird.conf"), []byte(peerConf), 0644); err != nil {
+		return nil, err
+	}
+
+	testPeer, err := start(opts, opts.Name+"-peer", peerDir)
+	if err != nil {
+		return nil, err
+	}
+	defer testPeer.stop()
+	var addresses [][2]string
+	seen := map[[2]string]bool{}
+	for _, s := range peerSessions {
+		pair := [2]string{s.Router, s.Neighbor}
+		if !seen[pair] {
+			seen[pair] = true
+			addresses = append(addresses, pair)
+		}
+	}
+	if err := link(opts.Name, router, testPeer, addresses); err != nil {
+		return nil, err
+	}
+	if err := testPeer.wait(timeout); err != nil {
+		return nil, err
+	}
+	logger.Infof("Started test peer AS%d in %s", *peer.ASN, testPeer.netns)
+
+	client := bird.NewClient(router.socket())
+	defer client.Close()
+	deadline := time.Now().Add(timeout)
+
+	// Wait for every session to establish
+	for {
+		out, err := client.Run("show protocols")
+		if err != nil {
+			return nil, err
+		}
+		protocols := birdc.ParseProtocols(out)
+		var down []string
+		for _, s := range peerSessions {
+			if p, found := protocols[s.Name]; !found || !strings.HasPrefix(p.Info, "Established") {
+				down = append(down, s.Name)
+			}
+		}
+		if len(down) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("sessions didn't establish within %s: %s", timeout, strings.Join(down, ", "))
+		}
+		time.Sleep(time.Second)
+	}
+	logger.Infof("Established %d sessions with the test peer", len(peerSessions))
+
+	// Wait for every route to be accepted or filtered
+	accepted := map[string][]*birdc.Route{}
+	filtered := map[string][]*birdc.Route{}
+	for {
+		missing := 0
+		for _, s := range peerSessions {
+			out, err := client.Run("show route all protocol " + s.Name)
+			if err != nil {
+				return nil, err
+			}
+			accepted[s.Name] = birdc.ParseRoutes(out)
+			out, err = client.Run("show route all filtered protocol " + s.Name)
+			if err != nil {
+				return nil, err
+			}
+			filtered[s.Name] = birdc.ParseRoutes(out)
+
+			seen := map[string]bool{}
+			for _, prefix := range birdc.Prefixes(append(accepted[s.Name], filtered[s.Name]...)) {
+				seen[prefix] = true
+			}
+			for _, route := range s.Routes {
+				if !seen[route.Prefix] {
+					missing++
+				}
+			}
+		}
+		if missing == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	logFile, err := ioutil.ReadFile(c.LogFile)
+	if err != nil {
+		logger.Warnf("Reading BIRD log for rejection reasons: %v", err)
+	}
+	reasons := rejections(string(logFile))
+	var results []*Result
+	for _, s := range peerSessions {
+		for _, route := range s.Routes {
+			results = append(results, check(route, s, accepted[s.Name], filtered[s.Name], reasons))
+		}
+	}
+	return results, nil // nil error
+}
@@ -0,0 +1,97 @@
+package harness
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+func testPeer() *config.Peer {
+	asn, port, multihop := 65530, 179, false
+	return &config.Peer{
+		ASN:          &asn,
+		NeighborIPs:  &[]string{"203.0.113.2", "2001:db8::2"},
+		Listen6:      util.StrPtr("2001:db8::1"),
+		NeighborPort: &port,
+		LocalPort:    &port,
+		Multihop:     &multihop,
+		Password:     util.StrPtr("secret"),
+		Protocols:    &[]string{"EXAMPLEv4", "EXAMPLEv6"},
+	}
+}
+
+func TestPeerConfig(t *testing.T) {
+	routes := []*config.TestRoute{
+		{Prefix: "198.51.100.0/24", ASPath: []uint32{65520, 65521}, StandardCommunities: []string{"65530,1"}, LargeCommunities: []string{"65530,2,3"}},
+		{Prefix: "2001:db8:1::/48"},
+	}
+	s, err := sessions(&config.Config{ASN: 65510}, testPeer(), routes)
+	assert.Nil(t, err)
+	assert.Len(t, s, 2)
+	assert.Equal(t, "EXAMPLEv4", s[0].Name)
+	assert.Equal(t, defaultRouterAddress4, s[0].Router)
+	assert.Equal(t, routes[:1], s[0].Routes)
+	assert.Equal(t, "2001:db8::1", s[1].Router)
+	assert.Equal(t, routes[1:], s[1].Routes)
+
+	conf, err := peerConfig(s)
+	assert.Nil(t, err)
+	assert.Contains(t, conf, "router id 203.0.113.2;")
+	assert.Contains(t, conf, "local 203.0.113.2 port 179 as 65530;")
+	assert.Contains(t, conf, "neighbor 198.18.0.1 port 179 as 65510;")
+	assert.Contains(t, conf, `password "secret";`)
+	assert.Contains(t, conf, "route 2001:db8:1::/48 blackhole;")
+	// The test peer prepends its own ASN on export, so the path is prepended in reverse
+	assert.Less(t, strings.Index(conf, "bgp_path.prepend(65521);"), strings.Index(conf, "bgp_path.prepend(65520);"))
+	assert.Contains(t, conf, "bgp_community.add((65530,1));")
+	assert.Contains(t, conf, "bgp_large_community.add((65530,2,3));")
+
+	peer := testPeer()
+	peer.LocalASN = util.IntPtr(65511)
+	s, err = sessions(&config.Config{ASN: 65510}, peer, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 65511, s[0].RouterASN)
+
+	peer.NeighborIPs = &[]string{"fe80::2%eth0"}
+	_, err = sessions(&config.Config{ASN: 65510}, peer, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	s := &session{Name: "EXAMPLEv4"}
+	accepted := birdc.ParseRoutes(`1007-Table master4:
+ 198.51.100.0/24      unicast [EXAMPLEv4 2021-06-11 02:00:00] * (100) [AS65530i]
+ 	via 203.0.113.2 on pvt1r
+1012-	BGP.local_pref: 150
+ 	BGP.community: (65510,100) (65530,1)
+ 	BGP.large_community: (65530, 2, 3)
+0000
+`)
+	filtered := birdc.ParseRoutes(`1007-Table master4:
+ 192.0.2.0/24         unicast [EXAMPLEv4 2021-06-11 02:00:00] (100) [AS65530i]
+0000
+`)
+	reasons := rejections(`2021-06-11 02:00:00.000 <INFO> REJECTED [bogon] pfx 192.0.2.0/24 session EXAMPLEv4 path [65530] pathlen 1 origin 65530`)
+	assert.Equal(t, map[string]string{"EXAMPLEv4 192.0.2.0/24": "bogon"}, reasons)
+
+	for _, tc := range []struct {
+		route    *config.TestRoute
+		problems []string
+	}{
+		{&config.TestRoute{Prefix: "198.51.100.0/24", Expect: "accept", ExpectStandardCommunities: []string{"65510,100"}, ExpectLargeCommunities: []string{"65530,2,3"}, ExpectLocalPref: 150}, nil},
+		{&config.TestRoute{Prefix: "198.51.100.0/24", Expect: "reject"}, []string{"expected reject, route was accepted"}},
+		{&config.TestRoute{Prefix: "198.51.100.0/24", Expect: "accept", ExpectStandardCommunities: []string{"65510,200"}, ExpectLocalPref: 100}, []string{"missing community 65510,200 (has (65510,100) (65530,1))", "expected local pref 100, got 150"}},
+		{&config.TestRoute{Prefix: "192.0.2.0/24", Expect: "reject"}, nil},
+		{&config.TestRoute{Prefix: "192.0.2.0/24", Expect: "accept"}, []string{"expected accept, route was rejected (bogon)"}},
+		{&config.TestRoute{Prefix: "203.0.113.0/24", Expect: "reject"}, []string{"route wasn't received"}},
+	} {
+		result := check(tc.route, s, accepted, filtered, reasons)
+		assert.Equal(t, tc.problems, result.Problems, tc.route.Prefix)
+		assert.Equal(t, tc.problems == nil, result.Passed())
+	}
+}
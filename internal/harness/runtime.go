@@ -0,0 +1,157 @@
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/bird"
+)
+
+// command runs a command and returns an error with its output if it fails
+func command(args ...string) error {
+	logger.Debugf("Running %s", strings.Join(args, " "))
+	if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil // nil error
+}
+
+// instance is a BIRD process running in its own network namespace
+type instance struct {
+	netns     string
+	dir       string // Directory with bird.conf, also containing the control socket
+	container string // Docker container name, empty when BIRD runs as a local process
+	process   *exec.Cmd
+	exited    chan struct{} // Closed when the local process exits
+	output    bytes.Buffer
+}
+
+// start starts BIRD with the config in dir in a new network namespace
+func start(opts *Options, name string, dir string) (*instance, error) {
+	i := &instance{netns: name, dir: dir}
+	if opts.Runtime == "docker" {
+		i.container = name
+		// The directory is mounted at the same path so the control socket and log file paths match on both sides
+		if err := command("docker", "run", "--detach", "--rm", "--name", name, "--network", "none", "--cap-add", "NET_ADMIN",
+			"--volume", dir+":"+dir, "--workdir", dir, opts.Image, "bird", "-f", "-c", "bird.conf", "-s", "bird.ctl"); err != nil {
+			return nil, err
+		}
+		out, err := exec.Command("docker", "inspect", "--format", "{{.State.Pid}}", name).Output()
+		if err != nil {
+			i.stop()
+			return nil, fmt.Errorf("docker inspect %s: %v", name, err)
+		}
+		if err := command("ip", "netns", "attach", name, strings.TrimSpace(string(out))); err != nil {
+			i.stop()
+			return nil, err
+		}
+	} else {
+		if err := command("ip", "netns", "add", name); err != nil {
+			return nil, err
+		}
+		i.process = exec.Command("ip", "netns", "exec", name, opts.BIRDBinary, "-f", "-c", "bird.conf", "-s", "bird.ctl")
+		i.process.Dir = dir
+		i.process.Stdout = &i.output
+		i.process.Stderr = &i.output
+		if err := i.process.Start(); err != nil {
+			i.process = nil
+			i.stop()
+			return nil, fmt.Errorf("starting BIRD: %v", err)
+		}
+		i.exited = make(chan struct{})
+		go func() {
+			_ = i.process.Wait()
+			close(i.exited)
+		}()
+	}
+	if err := command("ip", "-n", name, "link", "set", "lo", "up"); err != nil {
+		i.stop()
+		return nil, err
+	}
+	return i, nil // nil error
+}
+
+// socket returns the path to the instance's control socket
+func (i *instance) socket() string {
+	return path.Join(i.dir, "bird.ctl")
+}
+
+// wait waits for the control socket to accept connections
+func (i *instance) wait(timeout time.Duration) error {
+	client := bird.NewClient(i.socket())
+	client.Retries = 0
+	defer client.Close()
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := client.Version()
+		if err == nil {
+			return nil // nil error
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("BIRD in %s didn't start: %v", i.netns, err)
+		}
+		select {
+		case <-i.exited:
+			return fmt.Errorf("BIRD in %s exited: %s", i.netns, strings.TrimSpace(i.output.String()))
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// stop stops BIRD and removes the network namespace
+func (i *instance) stop() {
+	if i.container != "" {
+		if err := command("docker", "rm", "--force", i.container); err != nil {
+			logger.Warn(err)
+		}
+	}
+	if i.process != nil {
+		select {
+		case <-i.exited:
+		default:
+			if err := i.process.Process.Kill(); err != nil {
+				logger.Warnf("Stopping BIRD in %s: %v", i.netns, err)
+			}
+			<-i.exited
+		}
+	}
+	if err := command("ip", "netns", "delete", i.netns); err != nil {
+		logger.Warn(err)
+	}
+}
+
+// link connects the router and test peer namespaces with a veth pair, adding a point-to-point address for each router and neighbor address pair
+func link(name string, router *instance, peer *instance, addresses [][2]string) error {
+	routerLink, peerLink := name+"r", name+"p"
+	commands := [][]string{
+		{"ip", "link", "add", routerLink, "type", "veth", "peer", "name", peerLink},
+		{"ip", "link", "set", routerLink, "netns", router.netns},
+		{"ip", "link", "set", peerLink, "netns", peer.netns},
+	}
+	for _, pair := range addresses {
+		routerAddress, neighbor := pair[0], pair[1]
+		// Skip IPv6 duplicate address detection so the addresses are usable immediately
+		var flags []string
+		if strings.Contains(neighbor, ":") {
+			flags = []string{"nodad"}
+		}
+		commands = append(commands,
+			append([]string{"ip", "-n", router.netns, "addr", "add", routerAddress, "peer", neighbor, "dev", routerLink}, flags...),
+			append([]string{"ip", "-n", peer.netns, "addr", "add", neighbor, "peer", routerAddress, "dev", peerLink}, flags...),
+		)
+	}
+	commands = append(commands,
+		[]string{"ip", "-n", router.netns, "link", "set", routerLink, "up"},
+		[]string{"ip", "-n", peer.netns, "link", "set", peerLink, "up"},
+	)
+	for _, c := range commands {
+		if err := command(c...); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
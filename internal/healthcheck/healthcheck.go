@@ -0,0 +1,140 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// Check runs a single healthcheck and returns an error if it fails
+func Check(hc *config.Healthcheck) error {
+	timeout := time.Duration(hc.Timeout) * time.Second
+	switch hc.Type {
+	case "http":
+		resp, err := (&http.Client{Timeout: timeout}).Get(hc.Target)
+		if err != nil {
+			return err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer resp.Body.Close()
+		if resp.StatusCode != hc.ExpectStatus {
+			return fmt.Errorf("expected HTTP %d, got %d", hc.ExpectStatus, resp.StatusCode)
+		}
+		return nil // nil error
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", hc.Target, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "icmp":
+		return ping(hc.Target, timeout)
+	case "script":
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return exec.CommandContext(ctx, "/bin/sh", "-c", hc.Target).Run()
+	}
+	return fmt.Errorf("unknown healthcheck type %s", hc.Type)
+}
+
+// OnChange is called with the check result when a healthcheck's state changes or becomes known
+var OnChange func(name string, hc *config.Healthcheck, healthy bool, err error)
+
+// checker tracks the state of a single healthcheck
+type checker struct {
+	name      string
+	hc        *config.Healthcheck
+	known     bool // State is unknown until rise or fall consecutive results
+	healthy   bool
+	passes    uint
+	failures  uint
+	setOrigin func(hc *config.Healthcheck, announce bool) error
+}
+
+// update records a check result and returns true if the state changed or became known
+func (c *checker) update(err error) bool {
+	if err == nil {
+		c.failures = 0
+		c.passes++
+		if (!c.known || !c.healthy) && c.passes >= c.hc.Rise {
+			c.known, c.healthy = true, true
+			return true
+		}
+	} else {
+		log.Debugf("[Healthcheck %s] Check failed: %v", c.name, err)
+		c.passes = 0
+		c.failures++
+		if (!c.known || c.healthy) && c.failures >= c.hc.Fall {
+			c.known, c.healthy = true, false
+			return true
+		}
+	}
+	return false
+}
+
+// run checks until stop is closed
+func (c *checker) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(c.hc.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		err := Check(c.hc)
+		if c.update(err) {
+			if c.healthy {
+				log.Infof("[Healthcheck %s] Passing, announcing %v", c.name, c.hc.Prefixes)
+			} else {
+				log.Warnf("[Healthcheck %s] Failing (%v), withdrawing %v", c.name, err, c.hc.Prefixes)
+			}
+			if err := c.setOrigin(c.hc, c.healthy); err != nil {
+				log.Warnf("[Healthcheck %s] Updating BIRD: %v", c.name, err)
+			}
+			if OnChange != nil {
+				OnChange(c.name, c.hc, c.healthy, err)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// birdOrigin returns a function that enables or disables a healthcheck's origin protocols in BIRD
+func birdOrigin(socket string, noConfigure bool) func(*config.Healthcheck, bool) error {
+	return func(hc *config.Healthcheck, announce bool) error {
+		action := "disable"
+		if announce {
+			action = "enable"
+		}
+		if noConfigure {
+			log.Infof("[Healthcheck] Not running %s for %s (no configure)", action, hc.ProtocolName)
+			return nil
+		}
+		_, err := bird.RunCommand(fmt.Sprintf(`%s "%sv?"`, action, hc.ProtocolName), socket)
+		return err
+	}
+}
+
+// Run runs all healthchecks until stop is closed, announcing and withdrawing their prefixes in BIRD
+func Run(healthchecks map[string]*config.Healthcheck, birdSocket string, noConfigure bool, stop <-chan struct{}) {
+	done := make(chan struct{})
+	for name, hc := range healthchecks {
+		c := &checker{name: name, hc: hc, setOrigin: birdOrigin(birdSocket, noConfigure)}
+		log.Infof("[Healthcheck %s] Starting %s check of %s every %ds", name, hc.Type, hc.Target, hc.Interval)
+		go func() {
+			c.run(stop)
+			done <- struct{}{}
+		}()
+	}
+	for range healthchecks {
+		<-done
+	}
+}
@@ -0,0 +1,83 @@
+package healthcheck
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpTarget := listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		hc   config.Healthcheck
+		pass bool
+	}{
+		{config.Healthcheck{Type: "http", Target: server.URL + "/health", ExpectStatus: 200}, true},
+		{config.Healthcheck{Type: "http", Target: server.URL + "/down", ExpectStatus: 200}, false},
+		{config.Healthcheck{Type: "tcp", Target: server.Listener.Addr().String()}, true},
+		{config.Healthcheck{Type: "tcp", Target: tcpTarget}, false},
+		{config.Healthcheck{Type: "script", Target: "exit 0"}, true},
+		{config.Healthcheck{Type: "script", Target: "exit 1"}, false},
+		{config.Healthcheck{Type: "udp"}, false},
+	} {
+		tc.hc.Timeout = 1
+		if err := Check(&tc.hc); (err == nil) != tc.pass {
+			t.Errorf("expected %s check of %s pass=%v, got %v", tc.hc.Type, tc.hc.Target, tc.pass, err)
+		}
+	}
+}
+
+func TestCheckICMP(t *testing.T) {
+	conn, _, err := listenICMP(false)
+	if err != nil {
+		t.Skipf("ICMP sockets not permitted: %v", err)
+	}
+	conn.Close()
+	if err := Check(&config.Healthcheck{Type: "icmp", Target: "127.0.0.1", Timeout: 1}); err != nil {
+		t.Errorf("expected ICMP check of 127.0.0.1 to pass, got %v", err)
+	}
+}
+
+func TestCheckerRiseFall(t *testing.T) {
+	c := &checker{name: "test", hc: &config.Healthcheck{Rise: 2, Fall: 3}}
+	failed := errors.New("failed")
+	for i, tc := range []struct {
+		err     error
+		changed bool
+		healthy bool
+	}{
+		{nil, false, false},
+		{nil, true, true}, // Rise reached
+		{failed, false, true},
+		{failed, false, true},
+		{nil, false, true}, // Failure count resets
+		{failed, false, true},
+		{failed, false, true},
+		{failed, true, false}, // Fall reached
+		{nil, false, false},
+		{nil, true, true},
+	} {
+		if changed := c.update(tc.err); changed != tc.changed || c.healthy != tc.healthy {
+			t.Errorf("step %d: expected changed=%v healthy=%v, got changed=%v healthy=%v", i, tc.changed, tc.healthy, changed, c.healthy)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package healthcheck
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// icmpSeq is the sequence number of the last echo request
+var icmpSeq uint32
+
+// listenICMP opens a raw ICMP socket, falling back to an unprivileged datagram socket if raw sockets aren't permitted
+func listenICMP(v6 bool) (*icmp.PacketConn, bool, error) {
+	raw, datagram := "ip4:icmp", "udp4"
+	if v6 {
+		raw, datagram = "ip6:ipv6-icmp", "udp6"
+	}
+	if conn, err := icmp.ListenPacket(raw, ""); err == nil {
+		return conn, false, nil // nil error
+	}
+	conn, err := icmp.ListenPacket(datagram, "")
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, true, nil // nil error
+}
+
+// ping sends an ICMP echo request to an address and waits for the reply
+func ping(target string, timeout time.Duration) error {
+	ip := net.ParseIP(target)
+	if ip == nil {
+		addr, err := net.ResolveIPAddr("ip", target)
+		if err != nil {
+			return err
+		}
+		ip = addr.IP
+	}
+	v6 := ip.To4() == nil
+
+	conn, datagram, err := listenICMP(v6)
+	if err != nil {
+		return fmt.Errorf("ICMP socket: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := 1
+	if v6 {
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		protocol = 58
+	}
+
+	// Datagram sockets replace the ID with the socket's port, so replies are matched by sequence number
+	id := os.Getpid() & 0xffff
+	seq := int(atomic.AddUint32(&icmpSeq, 1) & 0xffff)
+	request, err := (&icmp.Message{
+		Type: requestType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("pathvector")},
+	}).Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if datagram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(request, dst); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no ICMP echo reply from %s: %v", ip, err)
+		}
+		peerIP := peer.String()
+		if udpAddr, ok := peer.(*net.UDPAddr); ok {
+			peerIP = udpAddr.IP.String()
+		}
+		if peerIP != ip.String() {
+			continue
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq && (datagram || echo.ID == id) {
+			return nil // nil error
+		}
+	}
+}
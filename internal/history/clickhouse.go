@@ -0,0 +1,113 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// clickHouseTime is the DateTime64 format accepted by ClickHouse
+const clickHouseTime = "2006-01-02 15:04:05.000000000"
+
+// ClickHouse writes history entries to ClickHouse over the HTTP interface
+type ClickHouse struct {
+	c          *config.ClickHouse
+	httpClient *http.Client
+}
+
+// NewClickHouse creates a new ClickHouse writer
+func NewClickHouse(c *config.ClickHouse) *ClickHouse {
+	return &ClickHouse{c: c, httpClient: &http.Client{Timeout: time.Duration(c.Timeout) * time.Second}}
+}
+
+// table returns the database qualified name of a table
+func (c *ClickHouse) table(name string) string {
+	return fmt.Sprintf("`%s`.`%s`", c.c.Database, name)
+}
+
+// query sends a query to ClickHouse with an optional body
+func (c *ClickHouse) query(query string, body string) error {
+	u := strings.TrimSuffix(c.c.URL, "/") + "/?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if c.c.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.c.Username)
+		req.Header.Set("X-ClickHouse-Key", c.c.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ClickHouse query: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("ClickHouse returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil // nil error
+}
+
+// insert inserts a row into a table
+func (c *ClickHouse) insert(table string, row interface{}) error {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	return c.query(fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", c.table(table)), string(b))
+}
+
+// CreateTables creates the probe and session tables if they don't exist
+func (c *ClickHouse) CreateTables() error {
+	if err := c.query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    time DateTime64(9, 'UTC'),
+    peer String,
+    asn UInt32,
+    source String,
+    target String,
+    latency_ms Float64,
+    jitter_ms Float64,
+    packet_loss Float64
+) ENGINE = MergeTree ORDER BY (peer, time)`, c.table(c.c.ProbeTable)), ""); err != nil {
+		return err
+	}
+	return c.query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    time DateTime64(9, 'UTC'),
+    protocol String,
+    old_state String,
+    new_state String,
+    info String
+) ENGINE = MergeTree ORDER BY (protocol, time)`, c.table(c.c.SessionTable)), "")
+}
+
+// WriteProbe writes a probe result to ClickHouse
+func (c *ClickHouse) WriteProbe(p Probe) error {
+	return c.insert(c.c.ProbeTable, map[string]interface{}{
+		"time":        p.Time.UTC().Format(clickHouseTime),
+		"peer":        p.Peer,
+		"asn":         p.ASN,
+		"source":      p.Source,
+		"target":      p.Target,
+		"latency_ms":  p.LatencyMs,
+		"jitter_ms":   p.JitterMs,
+		"packet_loss": p.PacketLoss,
+	})
+}
+
+// WriteSessionChange writes a session change to ClickHouse
+func (c *ClickHouse) WriteSessionChange(s SessionChange) error {
+	return c.insert(c.c.SessionTable, map[string]interface{}{
+		"time":      s.Time.UTC().Format(clickHouseTime),
+		"protocol":  s.Protocol,
+		"old_state": s.OldState,
+		"new_state": s.NewState,
+		"info":      s.Info,
+	})
+}
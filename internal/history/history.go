@@ -0,0 +1,241 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+// Probe stores a single optimizer probe result
+type Probe struct {
+	Time       time.Time `json:"time"`
+	Peer       string    `json:"peer"`
+	ASN        int       `json:"asn"`
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	LatencyMs  float64   `json:"latency-ms"`
+	JitterMs   float64   `json:"jitter-ms"`
+	PacketLoss float64   `json:"packet-loss"`
+}
+
+// SessionChange stores a BGP session state change
+type SessionChange struct {
+	Time     time.Time `json:"time"`
+	Protocol string    `json:"protocol"`
+	OldState string    `json:"old-state"`
+	NewState string    `json:"new-state"`
+	Info     string    `json:"info"`
+}
+
+// Writer sends history entries to an external database
+type Writer interface {
+	WriteProbe(p Probe) error
+	WriteSessionChange(s SessionChange) error
+}
+
+// writeBuffer is the number of entries queued for writers before new entries are dropped
+var writeBuffer = 1000
+
+// entry stores a probe result or session change queued for writers
+type entry struct {
+	probe   *Probe
+	session *SessionChange
+}
+
+// Store keeps a bounded in-memory history and forwards entries to writers
+type Store struct {
+	maxEntries int
+	writers    []Writer
+	queue      chan entry
+	flushed    chan struct{}
+
+	lock     sync.Mutex
+	probes   []Probe
+	sessions []SessionChange
+	states   map[string]string
+}
+
+// New creates a new history store, writing entries to writers in the background
+func New(maxEntries int, writers ...Writer) *Store {
+	s := &Store{maxEntries: maxEntries, writers: writers, states: map[string]string{}}
+	if len(writers) > 0 {
+		s.queue = make(chan entry, writeBuffer)
+		s.flushed = make(chan struct{})
+		go s.flush()
+	}
+	return s
+}
+
+// flush sends queued entries to the writers until the queue is closed
+func (s *Store) flush() {
+	defer close(s.flushed)
+	for e := range s.queue {
+		for _, w := range s.writers {
+			if e.probe != nil {
+				if err := w.WriteProbe(*e.probe); err != nil {
+					log.Warnf("[history] writing probe: %v", err)
+				}
+			} else if err := w.WriteSessionChange(*e.session); err != nil {
+				log.Warnf("[history] writing session change: %v", err)
+			}
+		}
+	}
+}
+
+// enqueue queues an entry for the writers without blocking, dropping it if the queue is full
+func (s *Store) enqueue(e entry) {
+	if s.queue == nil {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		log.Warnf("[history] write queue is full, dropping entry")
+	}
+}
+
+// Close stops accepting entries for the writers and waits for the queued entries to be written
+func (s *Store) Close() {
+	if s.queue == nil {
+		return
+	}
+	close(s.queue)
+	<-s.flushed
+}
+
+// AddProbe records a probe result
+func (s *Store) AddProbe(p Probe) {
+	s.lock.Lock()
+	s.probes = append(s.probes, p)
+	if len(s.probes) > s.maxEntries {
+		s.probes = s.probes[len(s.probes)-s.maxEntries:]
+	}
+	s.lock.Unlock()
+	s.enqueue(entry{probe: &p})
+}
+
+// AddSessionChange records a session state change
+func (s *Store) AddSessionChange(c SessionChange) {
+	s.lock.Lock()
+	s.sessions = append(s.sessions, c)
+	if len(s.sessions) > s.maxEntries {
+		s.sessions = s.sessions[len(s.sessions)-s.maxEntries:]
+	}
+	s.lock.Unlock()
+	s.enqueue(entry{session: &c})
+}
+
+// UpdateSessions records changes between the last known BGP session states and the current ones
+func (s *Store) UpdateSessions(protocols map[string]*birdc.Protocol, now time.Time) {
+	var changes []SessionChange
+	s.lock.Lock()
+	for name, p := range protocols {
+		if p.Proto != "BGP" {
+			continue
+		}
+		old, known := s.states[name]
+		if !known || old != p.State {
+			changes = append(changes, SessionChange{Time: now, Protocol: name, OldState: old, NewState: p.State, Info: p.Info})
+			s.states[name] = p.State
+		}
+	}
+	s.lock.Unlock()
+
+	for _, c := range changes {
+		s.AddSessionChange(c)
+	}
+}
+
+// WatchSessions polls BIRD for session state changes forever
+func (s *Store) WatchSessions(birdSocket string, interval time.Duration) {
+	for {
+		out, err := bird.RunCommand("show protocols", birdSocket)
+		if err != nil {
+			log.Warnf("[history] getting protocols: %v", err)
+		} else {
+			s.UpdateSessions(birdc.ParseProtocols(out), time.Now())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Probes returns probe results for a peer (all if empty) since a time, limited to the most recent entries
+func (s *Store) Probes(peer string, since time.Time, limit int) []Probe {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	out := []Probe{}
+	for _, p := range s.probes {
+		if (peer == "" || p.Peer == peer) && !p.Time.Before(since) {
+			out = append(out, p)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// SessionChanges returns session changes for a protocol (all if empty) since a time, limited to the most recent entries
+func (s *Store) SessionChanges(protocol string, since time.Time, limit int) []SessionChange {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	out := []SessionChange{}
+	for _, c := range s.sessions {
+		if (protocol == "" || c.Protocol == protocol) && !c.Time.Before(since) {
+			out = append(out, c)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// parseSince parses an RFC 3339 or UNIX timestamp query parameter
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if unix, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, since)
+}
+
+// ServeHTTP serves the history API
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, err := parseSince(query.Get("since"))
+	if err != nil {
+		http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, "invalid limit: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var out interface{}
+	switch r.URL.Path {
+	case "/history/probes":
+		out = s.Probes(query.Get("peer"), since, limit)
+	case "/history/sessions":
+		out = s.SessionChanges(query.Get("protocol"), since, limit)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,153 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+func TestStore(t *testing.T) {
+	s := New(2)
+	start := time.Unix(1000, 0)
+	s.AddProbe(Probe{Time: start, Peer: "Example", LatencyMs: 1})
+	s.AddProbe(Probe{Time: start.Add(time.Second), Peer: "Other", LatencyMs: 2})
+	s.AddProbe(Probe{Time: start.Add(2 * time.Second), Peer: "Example", LatencyMs: 3})
+
+	// Oldest entry is evicted
+	assert.Len(t, s.Probes("", time.Time{}, 0), 2)
+	assert.Equal(t, float64(3), s.Probes("Example", time.Time{}, 0)[0].LatencyMs)
+	assert.Len(t, s.Probes("", start.Add(2*time.Second), 0), 1)
+	assert.Len(t, s.Probes("", time.Time{}, 1), 1)
+}
+
+// blockingWriter records entries, waiting for release before each write
+type blockingWriter struct {
+	release chan struct{}
+	probes  []Probe
+}
+
+func (b *blockingWriter) WriteProbe(p Probe) error {
+	<-b.release
+	b.probes = append(b.probes, p)
+	return nil
+}
+
+func (b *blockingWriter) WriteSessionChange(SessionChange) error {
+	<-b.release
+	return nil
+}
+
+func TestStoreWriters(t *testing.T) {
+	defer func(original int) { writeBuffer = original }(writeBuffer)
+	writeBuffer = 2
+	w := &blockingWriter{release: make(chan struct{})}
+	s := New(10, w)
+
+	// Adding entries doesn't wait for the writer, and entries past the buffer are dropped
+	s.AddProbe(Probe{Peer: "First"})
+	for len(s.queue) > 0 {
+		time.Sleep(time.Millisecond) // Wait for the writer to take the first entry
+	}
+	for _, peer := range []string{"Second", "Third", "Dropped"} {
+		s.AddProbe(Probe{Peer: peer})
+	}
+	assert.Len(t, s.Probes("", time.Time{}, 0), 4)
+
+	close(w.release)
+	s.Close()
+	assert.Len(t, w.probes, 3)
+	assert.Equal(t, "Third", w.probes[2].Peer)
+}
+
+func TestUpdateSessions(t *testing.T) {
+	s := New(10)
+	now := time.Unix(1000, 0)
+	s.UpdateSessions(map[string]*birdc.Protocol{
+		"EXAMPLEv4": {Name: "EXAMPLEv4", Proto: "BGP", State: "up"},
+		"device1":   {Name: "device1", Proto: "Device", State: "up"},
+	}, now)
+	s.UpdateSessions(map[string]*birdc.Protocol{
+		"EXAMPLEv4": {Name: "EXAMPLEv4", Proto: "BGP", State: "up"},
+	}, now)
+	s.UpdateSessions(map[string]*birdc.Protocol{
+		"EXAMPLEv4": {Name: "EXAMPLEv4", Proto: "BGP", State: "start", Info: "Active"},
+	}, now)
+
+	changes := s.SessionChanges("EXAMPLEv4", time.Time{}, 0)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "", changes[0].OldState)
+	assert.Equal(t, "up", changes[1].OldState)
+	assert.Equal(t, "start", changes[1].NewState)
+	assert.Len(t, s.SessionChanges("device1", time.Time{}, 0), 0)
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := New(10)
+	s.AddProbe(Probe{Time: time.Unix(1000, 0), Peer: "Example"})
+	s.AddProbe(Probe{Time: time.Unix(2000, 0), Peer: "Example"})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history/probes?peer=Example&since=1500", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var probes []Probe
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&probes))
+	assert.Len(t, probes, 1)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history/sessions?since=invalid", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestInfluxDB(t *testing.T) {
+	var body, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Token example-token", r.Header.Get("Authorization"))
+		path = r.URL.Path + "?" + r.URL.RawQuery
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	i := NewInfluxDB(&config.InfluxDB{URL: server.URL, Token: "example-token", Org: "example", Bucket: "pathvector", Measurement: "pathvector", Timeout: 5})
+	assert.Nil(t, i.WriteProbe(Probe{Time: time.Unix(1, 0), Peer: "Example Peer", ASN: 65510, Source: "192.0.2.1", Target: "198.51.100.1", LatencyMs: 1.5}))
+	assert.True(t, strings.HasPrefix(path, "/api/v2/write?"))
+	assert.Contains(t, path, "bucket=pathvector")
+	assert.True(t, strings.HasPrefix(body, `pathvector_probe,peer=Example\ Peer,asn=65510,`))
+	assert.True(t, strings.HasSuffix(body, " 1000000000"))
+
+	assert.Nil(t, i.WriteSessionChange(SessionChange{Time: time.Unix(1, 0), Protocol: "EXAMPLEv4", NewState: "up", Info: `say "hi"`}))
+	assert.Contains(t, body, `info="say \"hi\""`)
+}
+
+func TestClickHouse(t *testing.T) {
+	var query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "pathvector", r.Header.Get("X-ClickHouse-User"))
+		query = r.URL.Query().Get("query")
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	c := NewClickHouse(&config.ClickHouse{URL: server.URL, Username: "pathvector", Database: "default", ProbeTable: "pathvector_probes", SessionTable: "pathvector_sessions", Timeout: 5})
+	assert.Nil(t, c.CreateTables())
+	assert.Contains(t, query, "CREATE TABLE IF NOT EXISTS `default`.`pathvector_sessions`")
+
+	assert.Nil(t, c.WriteProbe(Probe{Time: time.Unix(1, 5), Peer: "Example Peer", ASN: 65510, Source: "192.0.2.1", Target: "198.51.100.1", LatencyMs: 1.5}))
+	assert.Equal(t, "INSERT INTO `default`.`pathvector_probes` FORMAT JSONEachRow", query)
+	assert.Contains(t, body, `"time":"1970-01-01 00:00:01.000000005"`)
+	assert.Contains(t, body, `"latency_ms":1.5`)
+
+	assert.Nil(t, c.WriteSessionChange(SessionChange{Time: time.Unix(1, 0), Protocol: "EXAMPLEv4", NewState: "up"}))
+	assert.Contains(t, body, `"new_state":"up"`)
+}
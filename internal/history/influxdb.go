@@ -0,0 +1,85 @@
+package history
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// InfluxDB writes history entries using the InfluxDB line protocol
+type InfluxDB struct {
+	c          *config.InfluxDB
+	httpClient *http.Client
+}
+
+// NewInfluxDB creates a new InfluxDB writer
+func NewInfluxDB(c *config.InfluxDB) *InfluxDB {
+	return &InfluxDB{c: c, httpClient: &http.Client{Timeout: time.Duration(c.Timeout) * time.Second}}
+}
+
+// escapeTag escapes a line protocol tag key or value
+func escapeTag(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
+
+// escapeString escapes a line protocol string field value
+func escapeString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// probeLine formats a probe result as a line protocol point
+func probeLine(measurement string, p Probe) string {
+	return fmt.Sprintf("%s_probe,peer=%s,asn=%d,source=%s,target=%s latency_ms=%f,jitter_ms=%f,packet_loss=%f %d",
+		measurement, escapeTag(p.Peer), p.ASN, escapeTag(p.Source), escapeTag(p.Target),
+		p.LatencyMs, p.JitterMs, p.PacketLoss, p.Time.UnixNano())
+}
+
+// sessionLine formats a session change as a line protocol point
+func sessionLine(measurement string, s SessionChange) string {
+	return fmt.Sprintf("%s_session,protocol=%s old_state=%s,new_state=%s,info=%s %d",
+		measurement, escapeTag(s.Protocol), escapeString(s.OldState), escapeString(s.NewState), escapeString(s.Info), s.Time.UnixNano())
+}
+
+// write sends line protocol points to InfluxDB
+func (i *InfluxDB) write(lines string) error {
+	var u string
+	if i.c.Database != "" {
+		u = strings.TrimSuffix(i.c.URL, "/") + "/write?" + url.Values{"db": {i.c.Database}, "precision": {"ns"}}.Encode()
+	} else {
+		u = strings.TrimSuffix(i.c.URL, "/") + "/api/v2/write?" + url.Values{"org": {i.c.Org}, "bucket": {i.c.Bucket}, "precision": {"ns"}}.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.c.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.c.Token)
+	}
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("InfluxDB write: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("InfluxDB returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil // nil error
+}
+
+// WriteProbe writes a probe result to InfluxDB
+func (i *InfluxDB) WriteProbe(p Probe) error {
+	return i.write(probeLine(i.c.Measurement, p))
+}
+
+// WriteSessionChange writes a session change to InfluxDB
+func (i *InfluxDB) WriteSessionChange(s SessionChange) error {
+	return i.write(sessionLine(i.c.Measurement, s))
+}
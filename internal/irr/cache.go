@@ -0,0 +1,153 @@
+package irr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Cache stores IRR prefix lists on disk so runs can skip queries while results are fresh and reuse them when the IRR server is down
+type Cache struct {
+	Directory  string
+	TTL        time.Duration // Cached prefix lists newer than this are used without querying (never if 0)
+	ServeStale bool          // Use the last cached prefix list regardless of age if the query fails
+	Offline    bool          // Only use cached prefix lists regardless of age, never querying the IRR servers
+}
+
+// cacheEntry is a cached IRR prefix list, or the origin ASNs of an as-set if the family is 0
+type cacheEntry struct {
+	ASSet    string    `json:"as-set"`
+	Family   uint8     `json:"family"`
+	Resolver string    `json:"resolver"`
+	Server   string    `json:"server"` // Server that answered the query
+	Args     string    `json:"args"`
+	Time     time.Time `json:"time"`
+	Prefixes []string  `json:"prefixes,omitempty"`
+	ASNs     []uint32  `json:"asns,omitempty"`
+}
+
+// file returns the cache file of an as-set and address family, or of its origin ASNs if the family is 0
+func (c *Cache) file(asSet string, family uint8) string {
+	kind := fmt.Sprintf("%d", family)
+	if family == 0 {
+		kind = "asns"
+	}
+	return path.Join(c.Directory, fmt.Sprintf("%s_%s.json", strings.NewReplacer(":", "_", "/", "_").Replace(asSet), kind))
+}
+
+// read returns a cached prefix list, or nil if it isn't cached for the same query from one of its servers
+func (c *Cache) read(asSet string, family uint8, q *Query) *cacheEntry {
+	contents, err := ioutil.ReadFile(c.file(asSet, family))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(contents, &entry); err != nil {
+		logger.Warnf("Ignoring invalid IRR cache file %s: %v", c.file(asSet, family), err)
+		return nil
+	}
+	if entry.ASSet != asSet || entry.Family != family || entry.Resolver != q.Resolver || !util.Contains(q.Servers, entry.Server) || entry.Args != q.BGPQArgs {
+		return nil
+	}
+	return &entry
+}
+
+// write caches a prefix list, replacing the cache file atomically so concurrent queries never read a partial file
+func (c *Cache) write(entry *cacheEntry) error {
+	if err := os.MkdirAll(c.Directory, 0755); err != nil {
+		return fmt.Errorf("IRR cache directory: %v", err)
+	}
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.Directory, ".irr-")
+	if err != nil {
+		return fmt.Errorf("IRR cache file: %v", err)
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing IRR cache file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing IRR cache file: %v", err)
+	}
+	return os.Rename(tmp.Name(), c.file(entry.ASSet, entry.Family))
+}
+
+// lookup returns a cached entry if it's within the TTL or the cache is offline, otherwise runs query and caches the result, serving the stale entry if query fails and the cache serves stale entries
+func (c *Cache) lookup(asSet string, family uint8, q *Query, description string, query func() (*cacheEntry, error)) (*cacheEntry, error) {
+	cached := c.read(asSet, family, q)
+	if cached != nil && (c.Offline || (c.TTL > 0 && time.Since(cached.Time) < c.TTL)) {
+		logger.Debugf("Using cached %s from %s", description, cached.Time.Format(time.RFC3339))
+		return cached, nil
+	}
+	if c.Offline {
+		return nil, fmt.Errorf("%s isn't cached (offline)", description)
+	}
+
+	entry, err := query()
+	if err != nil {
+		if c.ServeStale && cached != nil {
+			logger.Warnf("Querying %s failed (%v), serving stale copy from %s", description, err, cached.Time.Format(time.RFC3339))
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	entry.ASSet = asSet
+	entry.Family = family
+	entry.Resolver = q.Resolver
+	entry.Args = q.BGPQArgs
+	entry.Time = time.Now()
+	if err := c.write(entry); err != nil {
+		logger.Warnf("Caching %s: %v", description, err)
+	}
+	return entry, nil
+}
+
+// PrefixSet returns a prefix list from the cache if it's within the TTL, otherwise queries the IRR servers and caches the result.
+// Without a cache, it queries the IRR servers directly.
+func (c *Cache) PrefixSet(asSet string, family uint8, q *Query) ([]string, error) {
+	if c == nil {
+		return PrefixSet(asSet, family, q)
+	}
+	entry, err := c.lookup(asSet, family, q, fmt.Sprintf("IPv%d IRR prefix list for %s", family, asSet), func() (*cacheEntry, error) {
+		prefixes, server, err := prefixSetFrom(asSet, family, q)
+		if err != nil {
+			return nil, err
+		}
+		return &cacheEntry{Server: server, Prefixes: prefixes}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry.Prefixes, nil // nil error
+}
+
+// OriginASNs returns the ASNs of an as-set from the cache if they're within the TTL, otherwise queries the IRR servers and caches the result.
+// Without a cache, it queries the IRR servers directly.
+func (c *Cache) OriginASNs(asSet string, q *Query) ([]uint32, error) {
+	if c == nil {
+		return OriginASNs(asSet, q)
+	}
+	entry, err := c.lookup(asSet, 0, q, "origin ASNs of "+asSet, func() (*cacheEntry, error) {
+		asns, server, err := originASNsFrom(asSet, q)
+		if err != nil {
+			return nil, err
+		}
+		return &cacheEntry{Server: server, ASNs: asns}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry.ASNs, nil // nil error
+}
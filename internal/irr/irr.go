@@ -4,32 +4,133 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/prefixset"
 )
 
-// PrefixSet uses bgpq4 to generate a prefix filter and return only the filter lines
-func PrefixSet(asSet string, family uint8, irrServer string, queryTimeout uint, bgpqArgs string) ([]string, error) {
-	// Run bgpq4 for BIRD format with aggregation enabled
-	cmdArgs := fmt.Sprintf("-h %s -Ab%d %s", irrServer, family, asSet)
-	if bgpqArgs != "" {
-		cmdArgs = bgpqArgs + " " + cmdArgs
+// logger tags log entries from this package so its log level can be set separately
+var logger = log.WithField("module", "irr")
+
+// Query stores the IRR servers and resolver options to build prefix lists with
+type Query struct {
+	Resolver string   // native or bgpq4
+	Servers  []string // Queried in order until one succeeds
+	Timeout  uint     // Seconds
+	BGPQArgs string   // Additional bgpq4 arguments, ignored by the native resolver
+}
+
+// NewQuery creates a query from the global config, using irr-servers if set and irr-server otherwise
+func NewQuery(c *config.Config) *Query {
+	servers := c.IRRServers
+	if len(servers) == 0 {
+		servers = []string{c.IRRServer}
+	}
+	return &Query{Resolver: c.IRRResolver, Servers: servers, Timeout: c.IRRQueryTimeout, BGPQArgs: c.BGPQArgs}
+}
+
+// forPeer returns the query for a peer, replacing the servers with the peer's IRR server if it has one
+func (q *Query) forPeer(peerData *config.Peer) *Query {
+	if peerData.IRRServer == nil || *peerData.IRRServer == "" {
+		return q
+	}
+	peerQuery := *q
+	peerQuery.Servers = []string{*peerData.IRRServer}
+	return &peerQuery
+}
+
+// PrefixSet returns the aggregated prefix list of an as-set or ASN from the first of the query's IRR servers to answer
+func PrefixSet(asSet string, family uint8, q *Query) ([]string, error) {
+	prefixes, _, err := prefixSetFrom(asSet, family, q)
+	return prefixes, err
+}
+
+// prefixSetFrom returns the prefix list of an as-set and the server that answered
+func prefixSetFrom(asSet string, family uint8, q *Query) ([]string, string, error) {
+	var prefixes []string
+	server, err := queryServers(q, fmt.Sprintf("IPv%d IRR query for %s", family, asSet), func(server string) error {
+		var err error
+		if q.Resolver == "native" {
+			prefixes, err = nativePrefixSet(asSet, family, server, q)
+		} else {
+			prefixes, err = bgpq4PrefixSet(asSet, family, server, q)
+		}
+		return err
+	})
+	return prefixes, server, err
+}
+
+// OriginASNs returns the ASNs of an as-set, or the ASN itself, from the first of the query's IRR servers to answer
+func OriginASNs(asSet string, q *Query) ([]uint32, error) {
+	asns, _, err := originASNsFrom(asSet, q)
+	return asns, err
+}
+
+// originASNsFrom returns the ASNs of an as-set and the server that answered
+func originASNsFrom(asSet string, q *Query) ([]uint32, string, error) {
+	var asns []uint32
+	server, err := queryServers(q, "IRR as-set expansion of "+asSet, func(server string) error {
+		var err error
+		if q.Resolver == "native" {
+			asns, err = nativeOriginASNs(asSet, server, q)
+		} else {
+			asns, err = bgpq4OriginASNs(asSet, server, q)
+		}
+		return err
+	})
+	return asns, server, err
+}
+
+// queryServers runs query on each of the query's IRR servers in order until one succeeds, returning the server that answered, or the last error if all fail
+func queryServers(q *Query, description string, query func(server string) error) (string, error) {
+	if len(q.Servers) == 0 {
+		return "", fmt.Errorf("no IRR servers configured")
 	}
-	log.Debugf("Running bgpq4 %s", cmdArgs)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(queryTimeout))
+	var err error
+	for i, server := range q.Servers {
+		if err = query(server); err == nil {
+			return server, nil // nil error
+		}
+		if i < len(q.Servers)-1 {
+			logger.Warnf("%s on %s failed (%v), trying %s", description, server, err, q.Servers[i+1])
+		}
+	}
+	return "", fmt.Errorf("%s: %v", q.Servers[len(q.Servers)-1], err)
+}
+
+// runBGPQ4 runs bgpq4 on an IRR server with the query's additional arguments and returns its output
+func runBGPQ4(args string, server string, q *Query) (string, error) {
+	cmdArgs := fmt.Sprintf("-h %s %s", server, args)
+	if q.BGPQArgs != "" {
+		cmdArgs = q.BGPQArgs + " " + cmdArgs
+	}
+	logger.Debugf("Running bgpq4 %s", cmdArgs)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(q.Timeout))
 	defer cancel()
 	cmd := exec.CommandContext(ctx, "bgpq4", strings.Split(cmdArgs, " ")...)
 	stdout, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(stdout), nil // nil error
+}
+
+// bgpq4PrefixSet uses bgpq4 to generate a prefix filter and return only the filter lines
+func bgpq4PrefixSet(asSet string, family uint8, server string, q *Query) ([]string, error) {
+	// Run bgpq4 for BIRD format with aggregation enabled
+	stdout, err := runBGPQ4(fmt.Sprintf("-Ab%d %s", family, asSet), server, q)
 	if err != nil {
 		return nil, err
 	}
 
 	var prefixes []string
-	for i, line := range strings.Split(string(stdout), "\n") {
+	for i, line := range strings.Split(stdout, "\n") {
 		if i == 0 { // Skip first line, as it is the definition line
 			continue
 		}
@@ -43,50 +144,92 @@ func PrefixSet(asSet string, family uint8, irrServer string, queryTimeout uint,
 	return prefixes, nil
 }
 
-// Update updates a peer's IRR prefix set
-func Update(peerData *config.Peer, irrServer string, queryTimeout uint, bgpqArgs string) error {
+// bgpq4OriginASNs uses bgpq4 to expand an as-set to a BIRD integer set and returns its ASNs
+func bgpq4OriginASNs(asSet string, server string, q *Query) ([]uint32, error) {
+	stdout, err := runBGPQ4("-tb -l ASNS "+asSet, server, q)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ASNs are between the brackets of the ASNS = [ ... ]; definition
+	start, end := strings.Index(stdout, "["), strings.LastIndex(stdout, "]")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("unexpected bgpq4 output %s", strings.TrimSpace(stdout))
+	}
+	asns := []uint32{}
+	for _, field := range strings.FieldsFunc(stdout[start+1:end], func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		asn, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ASN %s in bgpq4 output", field)
+		}
+		asns = append(asns, uint32(asn))
+	}
+	return asns, nil // nil error
+}
+
+// UpdateFamily updates a peer's IRR prefix set for one address family from the peer's IRR server or the query's servers, using cached prefix lists if cache isn't nil.
+// Only the family's prefix set is modified, so both families of a peer can be updated concurrently.
+func UpdateFamily(peerData *config.Peer, family uint8, q *Query, cache *Cache) error {
 	// Check for empty as-set
 	if peerData.ASSet == nil || *peerData.ASSet == "" {
 		return fmt.Errorf("peer has filter-irr enabled and no as-set defined")
 	}
 
-	// Does the peer have any IPv4 or IPv6 neighbors?
-	var hasNeighbor4, hasNeighbor6 bool
+	// Does the peer have any neighbors in this address family?
+	var hasNeighbor bool
 	if peerData.NeighborIPs != nil {
 		for _, n := range *peerData.NeighborIPs {
-			if strings.Contains(n, ".") {
-				hasNeighbor4 = true
-			} else if strings.Contains(n, ":") {
-				hasNeighbor6 = true
+			if (family == 4 && strings.Contains(n, ".")) || (family == 6 && !strings.Contains(n, ".") && strings.Contains(n, ":")) {
+				hasNeighbor = true
 			}
 		}
 	}
 
-	prefixesFromIRR4, err := PrefixSet(*peerData.ASSet, 4, irrServer, queryTimeout, bgpqArgs)
+	prefixesFromIRR, err := cache.PrefixSet(*peerData.ASSet, family, q.forPeer(peerData))
 	if err != nil {
-		return fmt.Errorf("unable to get IPv4 IRR prefix list from %s: %s", *peerData.ASSet, err)
+		return fmt.Errorf("unable to get IPv%d IRR prefix list from %s: %s", family, *peerData.ASSet, err)
 	}
-	if peerData.PrefixSet4 == nil {
-		peerData.PrefixSet4 = &[]string{}
+	prefixSet := &peerData.PrefixSet4
+	if family == 6 {
+		prefixSet = &peerData.PrefixSet6
 	}
-	pfx4 := append(*peerData.PrefixSet4, prefixesFromIRR4...)
-	peerData.PrefixSet4 = &pfx4
-	if len(pfx4) == 0 && hasNeighbor4 {
-		return fmt.Errorf("peer has IPv4 session(s) but no IPv4 prefixes")
+	if *prefixSet == nil {
+		*prefixSet = &prefixset.Set{}
 	}
-
-	prefixesFromIRR6, err := PrefixSet(*peerData.ASSet, 6, irrServer, queryTimeout, bgpqArgs)
-	if err != nil {
-		return fmt.Errorf("unable to get IPv6 IRR prefix list from %s: %s", *peerData.ASSet, err)
+	for _, prefix := range prefixesFromIRR {
+		if err := (*prefixSet).Add(prefix); err != nil {
+			return fmt.Errorf("IPv%d IRR prefix list from %s: %s", family, *peerData.ASSet, err)
+		}
 	}
-	if peerData.PrefixSet6 == nil {
-		peerData.PrefixSet6 = &[]string{}
+	if (*prefixSet).Len() == 0 && hasNeighbor {
+		return fmt.Errorf("peer has IPv%d session(s) but no IPv%d prefixes", family, family)
 	}
-	pfx6 := append(*peerData.PrefixSet6, prefixesFromIRR6...)
-	peerData.PrefixSet6 = &pfx6
-	if len(pfx6) == 0 && hasNeighbor6 {
-		return fmt.Errorf("peer has IPv6 session(s) but no IPv6 prefixes")
+
+	return nil // nil error
+}
+
+// Update updates a peer's IRR prefix sets for both address families, using cached prefix lists if cache isn't nil
+func Update(peerData *config.Peer, q *Query, cache *Cache) error {
+	for _, family := range []uint8{4, 6} {
+		if err := UpdateFamily(peerData, family, q, cache); err != nil {
+			return err
+		}
 	}
+	return nil // nil error
+}
 
+// UpdateOriginASNs updates a peer's origin ASNs from its as-set, using cached ASN lists if cache isn't nil
+func UpdateOriginASNs(peerData *config.Peer, q *Query, cache *Cache) error {
+	if peerData.ASSet == nil || *peerData.ASSet == "" {
+		return fmt.Errorf("peer has filter-as-path enabled and no as-set defined")
+	}
+	asns, err := cache.OriginASNs(*peerData.ASSet, q.forPeer(peerData))
+	if err != nil {
+		return fmt.Errorf("unable to expand as-set %s: %s", *peerData.ASSet, err)
+	}
+	if len(asns) == 0 {
+		return fmt.Errorf("as-set %s has no member ASNs", *peerData.ASSet)
+	}
+	peerData.OriginASNs = &asns
 	return nil // nil error
 }
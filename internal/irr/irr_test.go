@@ -1,10 +1,15 @@
 package irr
 
 import (
+	"bufio"
+	"fmt"
 	"github.com/natesales/pathvector/internal/config"
 	"github.com/natesales/pathvector/internal/util"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 const irrQueryTimeout = 10
@@ -23,7 +28,7 @@ func TestGetIRRPrefixSet(t *testing.T) {
 		{"AS-FROOT", 4, []string{"192.5.4.0/23{23,24}", "199.212.90.0/23", "199.212.92.0/23", "202.41.142.0/24"}, false},
 	}
 	for _, tc := range testCases {
-		out, err := PrefixSet(tc.asSet, tc.family, "rr.ntt.net", irrQueryTimeout, "")
+		out, err := PrefixSet(tc.asSet, tc.family, &Query{Resolver: "bgpq4", Servers: []string{"rr.ntt.net"}, Timeout: irrQueryTimeout})
 		if err != nil && !tc.shouldError {
 			t.Error(err)
 		} else if err == nil && tc.shouldError {
@@ -47,7 +52,7 @@ func TestBuildIRRPrefixSet(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		peer := config.Peer{ASSet: util.StrPtr(tc.asSet)}
-		err := Update(&peer, "rr.ntt.net", irrQueryTimeout, "")
+		err := Update(&peer, &Query{Resolver: "bgpq4", Servers: []string{"rr.ntt.net"}, Timeout: irrQueryTimeout}, nil)
 		if err != nil && tc.shouldError {
 			return
 		}
@@ -56,11 +61,208 @@ func TestBuildIRRPrefixSet(t *testing.T) {
 		} else if err == nil && tc.shouldError {
 			t.Errorf("as-set %s should error but didn't", tc.asSet)
 		}
-		if !reflect.DeepEqual(tc.prefixSet4, *peer.PrefixSet4) {
-			t.Errorf("as-set %s IPv4 prefix set expected %v got %v", tc.asSet, tc.prefixSet4, peer.PrefixSet4)
+		if !reflect.DeepEqual(tc.prefixSet4, peer.PrefixSet4.Strings()) {
+			t.Errorf("as-set %s IPv4 prefix set expected %v got %v", tc.asSet, tc.prefixSet4, peer.PrefixSet4.Strings())
 		}
-		if !reflect.DeepEqual(tc.prefixSet6, *peer.PrefixSet6) {
-			t.Errorf("as-set %s IPv6 prefix set expected %v got %v", tc.asSet, tc.prefixSet6, peer.PrefixSet6)
+		if !reflect.DeepEqual(tc.prefixSet6, peer.PrefixSet6.Strings()) {
+			t.Errorf("as-set %s IPv6 prefix set expected %v got %v", tc.asSet, tc.prefixSet6, peer.PrefixSet6.Strings())
 		}
 	}
 }
+
+func TestCache(t *testing.T) {
+	// Queries to an invalid IRR server always fail, so only cached prefix lists are returned
+	q := &Query{Resolver: "bgpq4", Servers: []string{"irr.invalid"}, Timeout: irrQueryTimeout}
+	prefixes := []string{"192.0.2.0/24", "198.51.100.0/24{24,25}"}
+	cache := &Cache{Directory: t.TempDir(), TTL: time.Hour}
+	if err := cache.write(&cacheEntry{ASSet: "AS65530:AS-EXAMPLE", Family: 4, Resolver: "bgpq4", Server: "irr.invalid", Time: time.Now(), Prefixes: prefixes}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := cache.PrefixSet("AS65530:AS-EXAMPLE", 4, q)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, prefixes) {
+		t.Errorf("fresh cache expected %v got %v", prefixes, out)
+	}
+
+	// Entries for other families, servers, or bgpq4 arguments aren't used
+	if _, err := cache.PrefixSet("AS65530:AS-EXAMPLE", 6, q); err == nil {
+		t.Error("uncached family should query and fail")
+	}
+	if _, err := cache.PrefixSet("AS65530:AS-EXAMPLE", 4, &Query{Resolver: "bgpq4", Servers: []string{"irr.invalid"}, Timeout: irrQueryTimeout, BGPQArgs: "-S RADB"}); err == nil {
+		t.Error("cache entry with different bgpq4 arguments should be ignored")
+	}
+
+	// Expired entries are only used when serving stale
+	cache.TTL = time.Nanosecond
+	if _, err := cache.PrefixSet("AS65530:AS-EXAMPLE", 4, q); err == nil {
+		t.Error("expired cache should query and fail")
+	}
+	cache.ServeStale = true
+	out, err = cache.PrefixSet("AS65530:AS-EXAMPLE", 4, q)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, prefixes) {
+		t.Errorf("stale cache expected %v got %v", prefixes, out)
+	}
+
+	// Origin ASNs are cached separately from prefix lists
+	if err := cache.write(&cacheEntry{ASSet: "AS65530:AS-EXAMPLE", Family: 0, Resolver: "bgpq4", Server: "irr.invalid", Time: time.Now(), ASNs: []uint32{65530, 65531}}); err != nil {
+		t.Fatal(err)
+	}
+	asns, err := cache.OriginASNs("AS65530:AS-EXAMPLE", q)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(asns, []uint32{65530, 65531}) {
+		t.Errorf("stale cache expected origin ASNs [65530 65531] got %v", asns)
+	}
+
+	// Offline caches use entries regardless of age and never query
+	cache.ServeStale = false
+	cache.Offline = true
+	out, err = cache.PrefixSet("AS65530:AS-EXAMPLE", 4, q)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, prefixes) {
+		t.Errorf("offline cache expected %v got %v", prefixes, out)
+	}
+	if _, err := cache.PrefixSet("AS65530:AS-EXAMPLE", 6, q); err == nil || !strings.Contains(err.Error(), "isn't cached (offline)") {
+		t.Errorf("expected offline error for uncached family, got %v", err)
+	}
+
+	// Without a cache, the IRR server is queried directly
+	var noCache *Cache
+	if _, err := noCache.PrefixSet("AS65530:AS-EXAMPLE", 4, q); err == nil {
+		t.Error("nil cache should query and fail")
+	}
+}
+
+// fakeIRRd serves a fake IRRd whois server, replying to ! commands with the space separated fields in data, or a key not found response if missing
+func fakeIRRd(t *testing.T, data map[string]string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					command := strings.TrimSpace(line)
+					switch {
+					case command == "!!":
+						continue
+					case command == "!q":
+						return
+					case strings.HasPrefix(command, "!n"):
+						fmt.Fprint(conn, "C\n")
+					case strings.HasPrefix(command, "!x"):
+						fmt.Fprint(conn, "F Unrecognized command\n")
+					default:
+						if reply, found := data[command]; found && strings.HasPrefix(reply, "F ") {
+							fmt.Fprintf(conn, "%s\n", reply)
+						} else if found {
+							fmt.Fprintf(conn, "A%d\n%s\nC\n", len(reply)+1, reply)
+						} else {
+							fmt.Fprint(conn, "D\n")
+						}
+					}
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNativePrefixSet(t *testing.T) {
+	q := &Query{Resolver: "native", Servers: []string{fakeIRRd(t, map[string]string{
+		"!a4AS-EXAMPLE":  "192.0.2.0/25 192.0.2.128/25 198.51.100.0/24 198.51.100.0/25",
+		"!a4AS-OLD":      "F Unrecognized command",
+		"!iAS-OLD,1":     "AS65531",
+		"!iAS-EXAMPLE,1": "AS65530 AS65531 RS-EXAMPLE AS65532",
+		"!gAS65530":      "192.0.2.0/25 192.0.2.128/25 198.51.100.0/24",
+		"!gAS65531":      "198.51.100.0/25",
+		"!6AS65530":      "2001:db8::/48",
+		"!gAS112":        "192.31.196.0/24 192.175.48.0/24",
+	})}, Timeout: irrQueryTimeout}
+
+	testCases := []struct {
+		asSet          string
+		family         uint8
+		expectedOutput []string
+		shouldError    bool
+	}{
+		{"AS-EXAMPLE", 4, []string{"192.0.2.0/24{25,25}", "198.51.100.0/24", "198.51.100.0/25"}, false},
+		{"AS-EXAMPLE", 6, []string{"2001:db8::/48"}, false}, // Falls back to querying each ASN without an !a6 response
+		{"AS-OLD", 4, []string{"198.51.100.0/25"}, false},
+		{"AS112", 4, []string{"192.31.196.0/24", "192.175.48.0/24"}, false}, // Single ASNs aren't expanded
+		{"AS112", 6, []string{}, false},
+		{"AS-MISSING", 4, nil, true},
+		{"AS-EXAMPLE", 9, nil, true}, // Invalid address family
+	}
+	for _, tc := range testCases {
+		out, err := PrefixSet(tc.asSet, tc.family, q)
+		if err != nil && !tc.shouldError {
+			t.Error(err)
+		} else if err == nil && tc.shouldError {
+			t.Errorf("as-set %s family %d should error but didn't", tc.asSet, tc.family)
+		}
+		if err == nil && !reflect.DeepEqual(out, tc.expectedOutput) {
+			t.Errorf("as-set %s family %d failed. expected '%s' got '%s'", tc.asSet, tc.family, tc.expectedOutput, out)
+		}
+	}
+
+	for asSet, expected := range map[string][]uint32{
+		"AS-EXAMPLE": {65530, 65531, 65532},
+		"as112":      {112},
+	} {
+		asns, err := OriginASNs(asSet, q)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(asns, expected) {
+			t.Errorf("as-set %s origin ASNs expected %v got %v", asSet, expected, asns)
+		}
+	}
+	if _, err := OriginASNs("AS-MISSING", q); err == nil {
+		t.Error("missing as-set should error but didn't")
+	}
+}
+
+func TestIRRServerFallback(t *testing.T) {
+	// Nothing listens on the first server so the connection is refused
+	primary := fakeIRRd(t, map[string]string{"!gAS65530": "192.0.2.0/24"})
+	secondary := fakeIRRd(t, map[string]string{"!gAS65530": "198.51.100.0/24"})
+	q := &Query{Resolver: "native", Servers: []string{"127.0.0.1:1", secondary}, Timeout: irrQueryTimeout}
+
+	out, server, err := prefixSetFrom("AS65530", 4, q)
+	if err != nil {
+		t.Error(err)
+	}
+	if server != secondary || !reflect.DeepEqual(out, []string{"198.51.100.0/24"}) {
+		t.Errorf("expected [198.51.100.0/24] from %s got %s from %s", secondary, out, server)
+	}
+
+	if _, err := PrefixSet("AS65530", 4, &Query{Resolver: "native", Servers: []string{"127.0.0.1:1"}, Timeout: irrQueryTimeout}); err == nil {
+		t.Error("query with no reachable servers should error but didn't")
+	}
+
+	// A peer's IRR server replaces the query's servers
+	peer := config.Peer{ASSet: util.StrPtr("AS65530"), IRRServer: &primary}
+	if err := UpdateFamily(&peer, 4, q, nil); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(peer.PrefixSet4.Strings(), []string{"192.0.2.0/24"}) {
+		t.Errorf("expected peer prefixes [192.0.2.0/24] got %s", peer.PrefixSet4.Strings())
+	}
+}
@@ -0,0 +1,200 @@
+package irr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/prefixset"
+)
+
+// asnRegex matches a single ASN, which is queried directly instead of expanded as an as-set
+var asnRegex = regexp.MustCompile(`(?i)^AS\d+$`)
+
+// irrdClient runs queries on an IRRd server over the whois protocol in multiple command mode
+type irrdClient struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// dialIRRd connects to an IRRd server, using the whois port if the server doesn't include one
+func dialIRRd(server string, timeout time.Duration) (*irrdClient, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "43")
+	}
+	conn, err := net.DialTimeout("tcp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &irrdClient{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+
+	// Enable multiple command mode so the connection stays open between queries, then identify the client
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := fmt.Fprint(conn, "!!\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := c.query("!npathvector"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil // nil error
+}
+
+// query runs an IRRd ! command and returns the space separated fields of its response, or nil if the key wasn't found
+func (c *irrdClient) query(command string) ([]string, error) {
+	// Each query gets the full timeout, so an as-set with many members doesn't time out
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(c.conn, "%s\n", command); err != nil {
+		return nil, err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading %s response: %v", command, err)
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "C":
+		return []string{}, nil // nil error
+	case line == "D":
+		return nil, nil // nil error
+	case strings.HasPrefix(line, "F"):
+		return nil, fmt.Errorf("%s: %s", command, strings.TrimSpace(strings.TrimPrefix(line, "F")))
+	case strings.HasPrefix(line, "A"):
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s response length %s", command, line)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, fmt.Errorf("reading %s response: %v", command, err)
+		}
+		// The data is followed by a C line
+		for {
+			end, err := c.reader.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("reading %s response: %v", command, err)
+			}
+			if end = strings.TrimSpace(end); end == "C" {
+				break
+			} else if end != "" {
+				return nil, fmt.Errorf("unexpected %s response %s", command, end)
+			}
+		}
+		return strings.Fields(string(data)), nil // nil error
+	}
+	return nil, fmt.Errorf("unexpected %s response %s", command, line)
+}
+
+// close ends the session and closes the connection
+func (c *irrdClient) close() {
+	_, _ = fmt.Fprint(c.conn, "!q\n")
+	c.conn.Close()
+}
+
+// originASNs expands an as-set to its member ASNs, or returns the ASN if asSet is a single ASN
+func (c *irrdClient) originASNs(asSet string) ([]string, error) {
+	if asnRegex.MatchString(asSet) {
+		return []string{strings.ToUpper(asSet)}, nil // nil error
+	}
+	members, err := c.query("!i" + asSet + ",1")
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		return nil, fmt.Errorf("as-set %s not found", asSet)
+	}
+	asns := []string{}
+	for _, member := range members {
+		// Route sets can also be members, but only ASNs have route objects to query
+		if asnRegex.MatchString(member) {
+			asns = append(asns, strings.ToUpper(member))
+		}
+	}
+	return asns, nil // nil error
+}
+
+// nativePrefixSet expands an as-set to its ASNs, queries an IRRd server for their route objects, and returns the aggregated prefix list
+func nativePrefixSet(asSet string, family uint8, server string, q *Query) ([]string, error) {
+	routeCommand := map[uint8]string{4: "!g", 6: "!6"}[family]
+	if routeCommand == "" {
+		return nil, fmt.Errorf("invalid address family %d", family)
+	}
+
+	logger.Debugf("Querying %s for IPv%d prefixes of %s", server, family, asSet)
+	client, err := dialIRRd(server, time.Second*time.Duration(q.Timeout))
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	set := &prefixset.Set{}
+	if !asnRegex.MatchString(asSet) {
+		// Resolve the as-set's prefixes on the server in a single query
+		prefixes, err := client.query(fmt.Sprintf("!a%d%s", family, asSet))
+		if err == nil && prefixes != nil {
+			for _, prefix := range prefixes {
+				if err := set.Add(prefix); err != nil {
+					return nil, fmt.Errorf("%s route object %s: %v", asSet, prefix, err)
+				}
+			}
+			set.Aggregate()
+			return set.Strings(), nil // nil error
+		}
+		// Older servers don't support !a, so expand the as-set and query each ASN
+		logger.Debugf("%s didn't resolve IPv%d prefixes of %s (%v), querying each ASN", server, family, asSet, err)
+	}
+
+	asns, err := client.originASNs(asSet)
+	if err != nil {
+		return nil, err
+	}
+	for _, asn := range asns {
+		prefixes, err := client.query(routeCommand + asn)
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range prefixes {
+			if err := set.Add(prefix); err != nil {
+				return nil, fmt.Errorf("%s route object %s: %v", asn, prefix, err)
+			}
+		}
+	}
+	set.Aggregate()
+	return set.Strings(), nil // nil error
+}
+
+// nativeOriginASNs expands an as-set to its member ASNs on an IRRd server
+func nativeOriginASNs(asSet string, server string, q *Query) ([]uint32, error) {
+	logger.Debugf("Querying %s for member ASNs of %s", server, asSet)
+	client, err := dialIRRd(server, time.Second*time.Duration(q.Timeout))
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	members, err := client.originASNs(asSet)
+	if err != nil {
+		return nil, err
+	}
+	asns := []uint32{}
+	for _, member := range members {
+		asn, err := strconv.ParseUint(member[2:], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ASN %s in as-set %s", member, asSet)
+		}
+		asns = append(asns, uint32(asn))
+	}
+	return asns, nil // nil error
+}
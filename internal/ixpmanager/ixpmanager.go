@@ -0,0 +1,226 @@
+package ixpmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// defaultTemplate holds the route server client settings used where the ixp-manager template doesn't set them
+var defaultTemplate = config.Peer{
+	RSClient:  util.BoolPtr(true),
+	FilterIRR: util.BoolPtr(true),
+}
+
+// Export stores an IX-F member export
+type Export struct {
+	Version    string   `json:"version"`
+	MemberList []Member `json:"member_list"`
+}
+
+// Member stores a single IX-F member
+type Member struct {
+	ASN            int          `json:"asnum"`
+	Name           string       `json:"name"`
+	MemberType     string       `json:"member_type"`
+	ConnectionList []Connection `json:"connection_list"`
+}
+
+// Connection stores a single IX-F member connection
+type Connection struct {
+	IXPID    int    `json:"ixp_id"`
+	State    string `json:"state"`
+	VLANList []VLAN `json:"vlan_list"`
+}
+
+// VLAN stores a single IX-F member VLAN interface
+type VLAN struct {
+	VLANID int          `json:"vlan_id"`
+	IPv4   *VLANAddress `json:"ipv4"`
+	IPv6   *VLANAddress `json:"ipv6"`
+}
+
+// VLANAddress stores a single address family of an IX-F VLAN interface
+type VLANAddress struct {
+	Address     string `json:"address"`
+	ASMacro     string `json:"as_macro"`
+	RouteServer bool   `json:"routeserver"`
+	MaxPrefix   int    `json:"max_prefix"`
+}
+
+// MemberExport gets the IX-F member export from IXP Manager
+func MemberExport(ixpManagerURL string, key string, queryTimeout uint) (*Export, error) {
+	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(ixpManagerURL, "/")+"/api/v4/member-export/ixf/1.0", nil)
+	if err != nil {
+		return nil, errors.New("IXP Manager GET: " + err.Error())
+	}
+	if key != "" {
+		req.Header.Set("X-IXP-Manager-API-Key", key)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.New("IXP Manager GET request: " + err.Error())
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.New("IXP Manager read: " + err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("IXP Manager returned HTTP %d: %s", res.StatusCode, body)
+	}
+
+	var export Export
+	if err := json.Unmarshal(body, &export); err != nil {
+		return nil, errors.New("IXP Manager JSON Unmarshal: " + err.Error())
+	}
+
+	return &export, nil // nil error
+}
+
+// routeServerClients builds route server client peers from an IX-F member export
+func routeServerClients(export *Export, o *config.IXPManager) map[string]*config.Peer {
+	peers := map[string]*config.Peer{}
+
+	for _, member := range export.MemberList {
+		// Skip the IXP's own infrastructure
+		if member.MemberType == "ixp" || member.MemberType == "routeserver" {
+			continue
+		}
+		excluded := false
+		for _, asn := range o.ExcludeASNs {
+			if asn == member.ASN {
+				excluded = true
+			}
+		}
+		if excluded {
+			log.Debugf("Skipping excluded IXP Manager member AS%d", member.ASN)
+			continue
+		}
+
+		var neighbors []string
+		asSet := ""
+		limit4, limit6 := 0, 0
+		for _, connection := range member.ConnectionList {
+			if connection.State != "" && connection.State != "active" {
+				continue
+			}
+			if o.IXPID != 0 && connection.IXPID != o.IXPID {
+				continue
+			}
+			for _, vlan := range connection.VLANList {
+				if o.VLANID != 0 && vlan.VLANID != o.VLANID {
+					continue
+				}
+				for _, addr := range []*VLANAddress{vlan.IPv4, vlan.IPv6} {
+					if addr == nil || !addr.RouteServer || addr.Address == "" {
+						continue
+					}
+					neighbors = append(neighbors, addr.Address)
+					if addr.ASMacro != "" {
+						asSet = addr.ASMacro
+					}
+				}
+				if vlan.IPv4 != nil && vlan.IPv4.MaxPrefix > limit4 {
+					limit4 = vlan.IPv4.MaxPrefix
+				}
+				if vlan.IPv6 != nil && vlan.IPv6.MaxPrefix > limit6 {
+					limit6 = vlan.IPv6.MaxPrefix
+				}
+			}
+		}
+		if len(neighbors) == 0 {
+			continue
+		}
+
+		asn := member.ASN
+		if asSet == "" {
+			asSet = fmt.Sprintf("AS%d", asn)
+		}
+		description := fmt.Sprintf("%s (AS%d)", member.Name, asn)
+		peer := &config.Peer{
+			ASN:         &asn,
+			NeighborIPs: &neighbors,
+			Description: &description,
+			ASSet:       &asSet,
+		}
+		if limit4 > 0 {
+			peer.ImportLimit4 = &limit4
+		}
+		if limit6 > 0 {
+			peer.ImportLimit6 = &limit6
+		}
+		if o.Template != "" {
+			template := o.Template
+			peer.Template = &template
+		}
+
+		name := member.Name
+		if name == "" || peers[name] != nil {
+			name = fmt.Sprintf("%s AS%d", member.Name, asn)
+		}
+		peers[strings.TrimSpace(name)] = peer
+	}
+
+	return peers
+}
+
+// Update pulls the member list from IXP Manager and adds route server clients to the config
+func Update(c *config.Config) error {
+	export, err := MemberExport(c.IXPManager.URL, c.IXPManager.Key, c.IXPManager.QueryTimeout)
+	if err != nil {
+		return err
+	}
+
+	peers := routeServerClients(export, &c.IXPManager)
+
+	// Apply the default template's values that the configured template doesn't override
+	template := &config.Peer{}
+	if c.IXPManager.Template != "" {
+		template = c.Templates[c.IXPManager.Template]
+		if template == nil {
+			return fmt.Errorf("IXP Manager template %s not found", c.IXPManager.Template)
+		}
+	}
+	for _, peer := range peers {
+		if template.RSClient == nil {
+			peer.RSClient = defaultTemplate.RSClient
+		}
+		if template.FilterIRR == nil {
+			peer.FilterIRR = defaultTemplate.FilterIRR
+		}
+	}
+
+	// Add peers in a stable order
+	var names []string
+	for name := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, exists := c.Peers[name]; exists {
+			log.Warnf("[%s] is defined in both the config file and IXP Manager, using the config file definition", name)
+			continue
+		}
+		if err := c.AddPeer(name, peers[name]); err != nil {
+			return fmt.Errorf("adding IXP Manager route server client %s: %v", name, err)
+		}
+	}
+	log.Infof("Added %d route server clients from IXP Manager", len(peers))
+
+	return nil // nil error
+}
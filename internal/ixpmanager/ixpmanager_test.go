@@ -0,0 +1,71 @@
+package ixpmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestUpdate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IXP-Manager-API-Key") != "example" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"version": "1.0", "member_list": [
+{"asnum": 65510, "name": "Example Networks", "member_type": "peering", "connection_list": [
+  {"ixp_id": 1, "state": "active", "vlan_list": [
+    {"vlan_id": 1, "ipv4": {"address": "192.0.2.10", "as_macro": "AS-EXAMPLE", "routeserver": true, "max_prefix": 100},
+                   "ipv6": {"address": "2001:db8::10", "as_macro": "AS-EXAMPLE", "routeserver": true, "max_prefix": 50}},
+    {"vlan_id": 2, "ipv4": {"address": "198.51.100.10", "routeserver": true}}
+  ]}
+]},
+{"asnum": 65520, "name": "No RS", "member_type": "peering", "connection_list": [
+  {"ixp_id": 1, "state": "active", "vlan_list": [{"vlan_id": 1, "ipv4": {"address": "192.0.2.20", "routeserver": false}}]}
+]},
+{"asnum": 65530, "name": "Route Server", "member_type": "routeserver", "connection_list": []},
+{"asnum": 65540, "name": "Excluded", "member_type": "peering", "connection_list": [
+  {"ixp_id": 1, "state": "active", "vlan_list": [{"vlan_id": 1, "ipv4": {"address": "192.0.2.40", "routeserver": true}}]}
+]}
+]}`)
+	}))
+	defer server.Close()
+
+	c, err := config.Load([]byte(fmt.Sprintf(`
+asn: 65530
+router-id: 192.0.2.1
+templates:
+  rs-client:
+    local-pref: 110
+    filter-irr: false
+ixp-manager:
+  url: %s
+  key: example
+  vlan-id: 1
+  template: rs-client
+  exclude-asns: [65540]
+`, server.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Update(c); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, len(c.Peers))
+	peer := c.Peers["Example Networks"]
+	if assert.NotNil(t, peer) {
+		assert.Equal(t, []string{"192.0.2.10", "2001:db8::10"}, *peer.NeighborIPs)
+		assert.Equal(t, "AS-EXAMPLE", *peer.ASSet)
+		assert.Equal(t, 100, *peer.ImportLimit4)
+		assert.Equal(t, 50, *peer.ImportLimit6)
+		assert.Equal(t, 110, *peer.LocalPref)
+		assert.True(t, *peer.RSClient)
+		assert.False(t, *peer.FilterIRR)
+	}
+}
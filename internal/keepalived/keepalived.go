@@ -0,0 +1,96 @@
+package keepalived
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Check checks if a keepalived config file is valid
+func Check(binary string, file string) error {
+	out, err := exec.Command(binary, "--config-test", "--use-file", file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil // nil error
+}
+
+// Reload reloads the running keepalived daemon by method ('signal', 'systemd', 'rc' or 'none')
+func Reload(method string, pidFile string) error {
+	switch method {
+	case "none":
+		return nil
+	case "systemd":
+		out, err := exec.Command("systemctl", "reload", "keepalived").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("systemctl reload keepalived: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil // nil error
+	case "rc":
+		command := []string{"service", "keepalived", "reload"}
+		if runtime.GOOS == "openbsd" {
+			command = []string{"rcctl", "reload", "keepalived"}
+		}
+		out, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(command, " "), err, strings.TrimSpace(string(out)))
+		}
+		return nil // nil error
+	case "signal":
+		pidBytes, err := ioutil.ReadFile(pidFile)
+		if err != nil {
+			return fmt.Errorf("reading keepalived PID file: %v", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+		if err != nil {
+			return fmt.Errorf("invalid keepalived PID file %s: %v", pidFile, err)
+		}
+		return syscall.Kill(pid, syscall.SIGHUP)
+	}
+	return fmt.Errorf("unknown keepalived reload method %s", method)
+}
+
+// Apply validates a newly rendered config, moves it into place and reloads keepalived, restoring the previous config on failure
+func Apply(newFile string, file string, binary string, reload string, pidFile string, noConfigure bool) error {
+	if _, err := os.Stat(newFile); os.IsNotExist(err) {
+		log.Debugf("No keepalived config rendered, not applying")
+		return nil
+	}
+
+	if err := Check(binary, newFile); err != nil {
+		_ = os.Remove(newFile)
+		return fmt.Errorf("keepalived config validation: %v", err)
+	}
+	log.Infof("keepalived config validation passed")
+
+	// Keep the previous config to roll back to
+	previous, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(newFile, file); err != nil {
+		return fmt.Errorf("moving keepalived config: %v", err)
+	}
+
+	if noConfigure {
+		return nil
+	}
+	log.Infoln("Reloading keepalived")
+	if err := Reload(reload, pidFile); err != nil {
+		if previous != nil {
+			log.Warnf("Restoring previous keepalived config")
+			if err := ioutil.WriteFile(file, previous, 0644); err != nil {
+				log.Warnf("Restoring previous keepalived config: %v", err)
+			}
+		}
+		return fmt.Errorf("reloading keepalived: %v", err)
+	}
+	return nil // nil error
+}
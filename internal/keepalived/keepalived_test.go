@@ -0,0 +1,63 @@
+package keepalived
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pathvector-keepalived-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "keepalived.conf")
+	newFile := file + ".new"
+
+	// Nothing rendered
+	if err := Apply(newFile, file, "false", "none", "", false); err != nil {
+		t.Errorf("expected no error without a rendered config, got %v", err)
+	}
+
+	// Valid config
+	if err := ioutil.WriteFile(newFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "true", "none", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid config leaves the previous config in place
+	if err := ioutil.WriteFile(newFile, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "false", "none", "", false); err == nil {
+		t.Errorf("expected validation error")
+	}
+	if _, err := os.Stat(newFile); !os.IsNotExist(err) {
+		t.Errorf("expected rejected config to be removed")
+	}
+
+	// Failed reload restores the previous config
+	if err := ioutil.WriteFile(newFile, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "true", "signal", path.Join(dir, "missing.pid"), false); err == nil {
+		t.Errorf("expected reload error")
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Errorf("expected previous config to be restored, got %s", b)
+	}
+}
+
+func TestReloadUnknownMethod(t *testing.T) {
+	if err := Reload("carrier-pigeon", ""); err == nil {
+		t.Errorf("expected unknown method error")
+	}
+}
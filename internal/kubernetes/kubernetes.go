@@ -0,0 +1,271 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// API group and version of the pathvector CRDs
+const (
+	Group   = "pathvector.io"
+	Version = "v1alpha1"
+)
+
+// RouterLabel is the label used to assign a Peer resource to a RouterConfig
+const RouterLabel = "pathvector.io/router"
+
+// serviceAccountDir is where Kubernetes mounts the pod service account credentials
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Object stores the common fields of a custom resource
+type Object struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		Labels          map[string]string `json:"labels"`
+		ResourceVersion string            `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec map[string]interface{} `json:"spec"`
+}
+
+// Status stores the outcome of the last reconcile of a RouterConfig
+type Status struct {
+	Phase   string `json:"phase"` // Applied or Failed
+	Message string `json:"message,omitempty"`
+}
+
+// list stores a custom resource list response
+type list struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []Object `json:"items"`
+}
+
+// event stores a single watch event
+type event struct {
+	Type   string `json:"type"`
+	Object Object `json:"object"`
+}
+
+// Client is a minimal Kubernetes API client for the pathvector CRDs
+type Client struct {
+	Host      string
+	Token     string
+	Namespace string
+
+	httpClient *http.Client
+}
+
+// InCluster creates a client from the pod's service account
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set, is pathvector running in a pod?")
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %v", err)
+	}
+	namespace, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account namespace: %v", err)
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid service account CA certificate")
+	}
+
+	return &Client{
+		Host:      "https://" + host + ":" + port,
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(namespace)),
+		httpClient: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}},
+	}, nil // nil error
+}
+
+// resourceURL returns the API URL of a custom resource collection
+func (c *Client) resourceURL(resource string, query url.Values) string {
+	return fmt.Sprintf("%s/apis/%s/%s/namespaces/%s/%s?%s", c.Host, Group, Version, c.Namespace, resource, query.Encode())
+}
+
+// get sends an authenticated GET request
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, u, nil)
+}
+
+// do sends an authenticated request, with body as a JSON merge patch if it isn't nil
+func (c *Client) do(ctx context.Context, method string, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		//noinspection GoUnhandledErrorResult
+		resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes API %s %s returned HTTP %d: %s", method, u, resp.StatusCode, respBody)
+	}
+	return resp, nil // nil error
+}
+
+// List lists all custom resources of a type, optionally filtered by a label selector
+func (c *Client) List(ctx context.Context, resource string, labelSelector string) ([]Object, string, error) {
+	query := url.Values{}
+	if labelSelector != "" {
+		query.Set("labelSelector", labelSelector)
+	}
+	resp, err := c.get(ctx, c.resourceURL(resource, query))
+	if err != nil {
+		return nil, "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	var l list
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, "", fmt.Errorf("decoding %s list: %v", resource, err)
+	}
+	return l.Items, l.Metadata.ResourceVersion, nil // nil error
+}
+
+// UpdateStatus replaces the status of a custom resource
+func (c *Client) UpdateStatus(ctx context.Context, resource string, name string, status interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/apis/%s/%s/namespaces/%s/%s/%s/status", c.Host, Group, Version, c.Namespace, resource, name)
+	resp, err := c.do(ctx, http.MethodPatch, u, body)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	resp.Body.Close()
+	return nil // nil error
+}
+
+// Watch watches a custom resource type from a resource version and calls onChange for every change until the watch ends
+func (c *Client) Watch(ctx context.Context, resource string, resourceVersion string, onChange func(eventType string, o Object)) error {
+	query := url.Values{"watch": {"true"}, "allowWatchBookmarks": {"true"}}
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+	resp, err := c.get(ctx, c.resourceURL(resource, query))
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("decoding %s watch event: %v", resource, err)
+		}
+		if e.Type == "BOOKMARK" {
+			continue
+		}
+		if e.Type == "ERROR" {
+			return fmt.Errorf("%s watch error: %v", resource, e.Object.Spec)
+		}
+		log.Debugf("[kubernetes] %s %s %s", e.Type, resource, e.Object.Metadata.Name)
+		onChange(e.Type, e.Object)
+	}
+	return scanner.Err()
+}
+
+// RenderConfig builds a pathvector YAML config from a RouterConfig and the Peers assigned to it
+func RenderConfig(routerConfig Object, peers []Object) ([]byte, error) {
+	global := map[string]interface{}{}
+	for k, v := range routerConfig.Spec {
+		global[k] = v
+	}
+
+	peerMap := map[string]interface{}{}
+	if existing, ok := global["peers"].(map[string]interface{}); ok {
+		for name, peer := range existing {
+			peerMap[name] = peer
+		}
+	}
+	for _, peer := range peers {
+		name := peer.Metadata.Name
+		spec := map[string]interface{}{}
+		for k, v := range peer.Spec {
+			// The peer's display name may differ from the resource name, which is limited to DNS label characters
+			if k == "name" {
+				if s, ok := v.(string); ok && s != "" {
+					name = s
+				}
+				continue
+			}
+			spec[k] = v
+		}
+		if _, exists := peerMap[name]; exists {
+			return nil, fmt.Errorf("peer %s is defined more than once", name)
+		}
+		peerMap[name] = spec
+	}
+	global["peers"] = peerMap
+
+	return yaml.Marshal(toYAMLCompatible(global))
+}
+
+// toYAMLCompatible converts JSON decoded numbers to integers where possible so they unmarshal into int fields
+func toYAMLCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, val := range t {
+			out[k] = toYAMLCompatible(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = toYAMLCompatible(val)
+		}
+		return out
+	case float64:
+		if t == float64(int64(t)) {
+			return int64(t)
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestListAndRender(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer example" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/pathvector.io/v1alpha1/namespaces/default/routerconfigs":
+			fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": [{"metadata": {"name": "edge1"}, "spec": {"asn": 65530, "router-id": "192.0.2.1"}}]}`)
+		case "/apis/pathvector.io/v1alpha1/namespaces/default/peers":
+			assert.Equal(t, RouterLabel+"=edge1", r.URL.Query().Get("labelSelector"))
+			fmt.Fprint(w, `{"metadata": {"resourceVersion": "2"}, "items": [{"metadata": {"name": "example"}, "spec": {"name": "Example Peer", "asn": 65510, "local-pref": 90, "neighbors": ["192.0.2.2"]}}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Token: "example", Namespace: "default"}
+	routerConfigs, _, err := client.List(context.Background(), "routerconfigs", "")
+	assert.Nil(t, err)
+	peers, resourceVersion, err := client.List(context.Background(), "peers", RouterLabel+"=edge1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", resourceVersion)
+
+	rendered, err := RenderConfig(routerConfigs[0], peers)
+	assert.Nil(t, err)
+
+	c, err := config.Load(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 65530, c.ASN)
+	if assert.NotNil(t, c.Peers["Example Peer"]) {
+		assert.Equal(t, 90, *c.Peers["Example Peer"].LocalPref)
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "/apis/pathvector.io/v1alpha1/namespaces/default/routerconfigs/edge1/status", r.URL.Path)
+		assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"status": {"phase": "Failed", "message": "BIRD config validation: exit status 1"}}`, string(body))
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Token: "example", Namespace: "default"}
+	assert.Nil(t, client.UpdateStatus(context.Background(), "routerconfigs", "edge1", Status{Phase: "Failed", Message: "BIRD config validation: exit status 1"}))
+	assert.NotNil(t, client.UpdateStatus(context.Background(), "routerconfigs", "edge1", func() {}))
+}
+
+func TestWatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("watch"))
+		fmt.Fprintln(w, `{"type": "ADDED", "object": {"metadata": {"name": "a"}}}`)
+		fmt.Fprintln(w, `{"type": "BOOKMARK", "object": {"metadata": {"resourceVersion": "5"}}}`)
+		fmt.Fprintln(w, `{"type": "DELETED", "object": {"metadata": {"name": "b"}}}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Namespace: "default"}
+	var events []string
+	err := client.Watch(context.Background(), "peers", "1", func(eventType string, o Object) {
+		events = append(events, eventType+" "+o.Metadata.Name)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ADDED a", "DELETED b"}, events)
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// writeRotationMarker records when a log file was started
+func writeRotationMarker(marker string, now time.Time) error {
+	return ioutil.WriteFile(marker, []byte(now.UTC().Format(time.RFC3339)+"\n"), 0644)
+}
+
+// RotateFile moves a log file to file.1, shifting older backups up to the backups limit, if it was started more than maxAge ago. The start time is tracked in file.rotated, which is created on the first call
+func RotateFile(file string, maxAge time.Duration, backups uint, now time.Time) (bool, error) {
+	marker := file + ".rotated"
+	contents, err := ioutil.ReadFile(marker)
+	if os.IsNotExist(err) {
+		return false, writeRotationMarker(marker, now)
+	} else if err != nil {
+		return false, err
+	}
+	started, err := time.Parse(time.RFC3339, strings.TrimSpace(string(contents)))
+	if err != nil {
+		return false, fmt.Errorf("invalid log rotation marker %s: %v", marker, err)
+	}
+	if now.Sub(started) < maxAge {
+		return false, nil // nil error
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return false, writeRotationMarker(marker, now)
+	}
+
+	if backups == 0 {
+		if err := os.Remove(file); err != nil {
+			return false, err
+		}
+	} else {
+		for i := backups; i > 1; i-- {
+			if err := os.Rename(fmt.Sprintf("%s.%d", file, i-1), fmt.Sprintf("%s.%d", file, i)); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+		}
+		if err := os.Rename(file, file+".1"); err != nil {
+			return false, err
+		}
+	}
+	return true, writeRotationMarker(marker, now)
+}
+
+// fileHook writes log entries to a file
+type fileHook struct {
+	file      *os.File
+	formatter log.Formatter
+}
+
+func (h *fileHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *fileHook) Fire(entry *log.Entry) error {
+	if !allowed(entry) {
+		return nil // nil error
+	}
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(b)
+	return err
+}
+
+// StartRunLog writes log output from the rest of this run to a new file in dir, removing the oldest run logs beyond keep (unlimited if zero). The returned file should be closed when the run finishes
+func StartRunLog(dir string, keep uint, format string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("run log directory: %v", err)
+	}
+	file, err := os.OpenFile(path.Join(dir, fmt.Sprintf("%s-%s.log", time.Now().UTC().Format("20060102T150405Z"), RunID())), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("run log: %v", err)
+	}
+
+	var formatter log.Formatter = &log.TextFormatter{DisableColors: true, FullTimestamp: true}
+	if format == "json" {
+		formatter = &log.JSONFormatter{}
+	}
+	log.AddHook(&fileHook{file: file, formatter: formatter})
+
+	if keep > 0 {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			log.Warnf("Reading run log directory: %v", err)
+		}
+		var runLogs []string
+		for _, f := range files {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), ".log") {
+				runLogs = append(runLogs, f.Name())
+			}
+		}
+		// Run log names start with a timestamp, so they sort oldest first
+		sort.Strings(runLogs)
+		for len(runLogs) > int(keep) {
+			if err := os.Remove(path.Join(dir, runLogs[0])); err != nil {
+				log.Warnf("Removing old run log: %v", err)
+			}
+			runLogs = runLogs[1:]
+		}
+	}
+
+	return file, nil // nil error
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// gelfChunkSize is the maximum UDP payload before a message is chunked
+const gelfChunkSize = 8192
+
+// gelfMaxChunks is the maximum number of chunks allowed by the GELF spec
+const gelfMaxChunks = 128
+
+// GELFHook sends log entries to a Graylog GELF endpoint
+type GELFHook struct {
+	network string
+	host    string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+// NewGELFHook creates a new GELF hook over UDP or TCP
+func NewGELFHook(network string, address string) (*GELFHook, error) {
+	conn, err := net.DialTimeout(network, address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "pathvector"
+	}
+	return &GELFHook{network: network, host: host, conn: conn}, nil
+}
+
+// Levels returns the log levels sent to the GELF endpoint
+func (h *GELFHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// syslogLevel converts a logrus level to a syslog severity
+func syslogLevel(l log.Level) int {
+	switch l {
+	case log.PanicLevel:
+		return 0
+	case log.FatalLevel:
+		return 2
+	case log.ErrorLevel:
+		return 3
+	case log.WarnLevel:
+		return 4
+	case log.InfoLevel:
+		return 6
+	}
+	return 7
+}
+
+// gelfMessage encodes a log entry as a GELF 1.1 message
+func gelfMessage(host string, entry *log.Entry) ([]byte, error) {
+	m := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": entry.Message,
+		"timestamp":     float64(entry.Time.UnixNano()) / float64(time.Second),
+		"level":         syslogLevel(entry.Level),
+	}
+	for k, v := range entry.Data {
+		if k == "id" {
+			k = "field_id" // _id is reserved
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m["_"+k] = v
+	}
+	return json.Marshal(m)
+}
+
+// gelfChunks splits a message into GELF UDP chunks
+func gelfChunks(msg []byte) ([][]byte, error) {
+	if len(msg) <= gelfChunkSize {
+		return [][]byte{msg}, nil
+	}
+	dataSize := gelfChunkSize - 12
+	count := (len(msg) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("message too large (%d chunks)", count)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	var chunks [][]byte
+	for i := 0; i < count; i++ {
+		end := (i + 1) * dataSize
+		if end > len(msg) {
+			end = len(msg)
+		}
+		var chunk bytes.Buffer
+		chunk.Write([]byte{0x1e, 0x0f})
+		chunk.Write(id)
+		chunk.Write([]byte{byte(i), byte(count)})
+		chunk.Write(msg[i*dataSize : end])
+		chunks = append(chunks, chunk.Bytes())
+	}
+	return chunks, nil
+}
+
+// Fire sends a log entry to the GELF endpoint
+func (h *GELFHook) Fire(entry *log.Entry) error {
+	msg, err := gelfMessage(h.host, entry)
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.network == "tcp" {
+		// TCP messages are null byte delimited
+		_, err = h.conn.Write(append(msg, 0))
+		return err
+	}
+	chunks, err := gelfChunks(msg)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := h.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
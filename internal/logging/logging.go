@@ -0,0 +1,195 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/syslog"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+var (
+	stageLock sync.Mutex
+	runID     = newRunID()
+	stage     string
+)
+
+// newRunID generates a random run ID
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewRun starts a new run, generating the run ID attached to subsequent log entries and clearing the stage
+func NewRun() string {
+	id := newRunID()
+	stageLock.Lock()
+	runID = id
+	stage = ""
+	stageLock.Unlock()
+	return id
+}
+
+// RunID returns the ID of the current pathvector run
+func RunID() string {
+	stageLock.Lock()
+	defer stageLock.Unlock()
+	return runID
+}
+
+// SetStage sets the pipeline stage attached to subsequent log entries
+func SetStage(s string) {
+	stageLock.Lock()
+	stage = s
+	stageLock.Unlock()
+}
+
+// Peer returns a log entry for a peer
+func Peer(name string) *log.Entry {
+	return log.WithField("peer", name)
+}
+
+// fieldsHook adds the run ID and stage to every log entry
+type fieldsHook struct{}
+
+func (fieldsHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (fieldsHook) Fire(entry *log.Entry) error {
+	stageLock.Lock()
+	entry.Data["run_id"] = runID
+	if stage != "" {
+		entry.Data["stage"] = stage
+	}
+	stageLock.Unlock()
+	return nil // nil error
+}
+
+// modules lists the subsystems that tag their log entries with a module field
+var modules = map[string]bool{
+	"config":    true,
+	"irr":       true,
+	"peeringdb": true,
+	"optimizer": true,
+	"bird":      true,
+	"harness":   true,
+}
+
+var (
+	moduleLevels map[string]log.Level // nil if all modules log at the global level
+	globalLevel  log.Level
+)
+
+// allowed checks if an entry is at or above its module's log level
+func allowed(entry *log.Entry) bool {
+	if moduleLevels == nil {
+		return true
+	}
+	level := globalLevel
+	if module, ok := entry.Data["module"].(string); ok {
+		if moduleLevel, ok := moduleLevels[module]; ok {
+			level = moduleLevel
+		}
+	}
+	return entry.Level <= level
+}
+
+// moduleFormatter drops entries below their module's log level
+type moduleFormatter struct {
+	log.Formatter
+}
+
+func (f moduleFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if !allowed(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// moduleHook only fires a hook for entries at or above their module's log level
+type moduleHook struct {
+	log.Hook
+}
+
+func (h moduleHook) Fire(entry *log.Entry) error {
+	if !allowed(entry) {
+		return nil // nil error
+	}
+	return h.Hook.Fire(entry)
+}
+
+// setLevels applies per-module log levels, raising the global logger level to the most verbose module so entries reach the module filter
+func setLevels(levels map[string]string) error {
+	if len(levels) == 0 {
+		return nil // nil error
+	}
+	globalLevel = log.GetLevel()
+	maxLevel := globalLevel
+	moduleLevels = map[string]log.Level{}
+	for module, levelName := range levels {
+		if !modules[module] {
+			return fmt.Errorf("unknown log module %s", module)
+		}
+		level, err := log.ParseLevel(levelName)
+		if err != nil {
+			return fmt.Errorf("log module %s: %v", module, err)
+		}
+		moduleLevels[module] = level
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+	log.SetLevel(maxLevel)
+	return nil // nil error
+}
+
+// Setup configures the log format, per-module log levels, and remote log outputs
+func Setup(c *config.Logging) error {
+	if c.Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	if err := setLevels(c.Levels); err != nil {
+		return err
+	}
+	if moduleLevels != nil {
+		log.SetFormatter(moduleFormatter{log.StandardLogger().Formatter})
+	}
+	if c.Format == "json" || c.Syslog.Address != "" || c.SyslogLocal || c.GELF.Address != "" {
+		log.AddHook(fieldsHook{})
+	}
+
+	if c.Syslog.Address != "" {
+		hook, err := lsyslog.NewSyslogHook(c.Syslog.Network, c.Syslog.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, c.SyslogTag)
+		if err != nil {
+			return fmt.Errorf("syslog: %v", err)
+		}
+		log.AddHook(moduleHook{hook})
+	}
+
+	if c.SyslogLocal {
+		hook, err := lsyslog.NewSyslogHook("", "", syslog.LOG_INFO|syslog.LOG_DAEMON, c.SyslogTag)
+		if err != nil {
+			return fmt.Errorf("local syslog: %v", err)
+		}
+		log.AddHook(moduleHook{hook})
+	}
+
+	if c.GELF.Address != "" {
+		hook, err := NewGELFHook(c.GELF.Network, c.GELF.Address)
+		if err != nil {
+			return fmt.Errorf("GELF: %v", err)
+		}
+		log.AddHook(moduleHook{hook})
+	}
+
+	return nil // nil error
+}
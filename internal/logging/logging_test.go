@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestFieldsHook(t *testing.T) {
+	var b bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&b)
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.AddHook(fieldsHook{})
+
+	SetStage("render")
+	defer SetStage("")
+	logger.WithField("peer", "Example").Info("Writing config")
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &entry))
+	assert.Equal(t, RunID(), entry["run_id"])
+	assert.Equal(t, "render", entry["stage"])
+	assert.Equal(t, "Example", entry["peer"])
+	assert.Equal(t, "Writing config", entry["msg"])
+
+	// A new run gets a new ID and no stage
+	previous := RunID()
+	id := NewRun()
+	assert.NotEqual(t, previous, id)
+	assert.Equal(t, id, RunID())
+	b.Reset()
+	logger.Info("Starting run")
+	entry = map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &entry))
+	assert.Equal(t, id, entry["run_id"])
+	assert.NotContains(t, entry, "stage")
+}
+
+func TestGELFChunks(t *testing.T) {
+	chunks, err := gelfChunks([]byte("short"))
+	assert.Nil(t, err)
+	assert.Len(t, chunks, 1)
+
+	chunks, err = gelfChunks(bytes.Repeat([]byte("a"), gelfChunkSize*2))
+	assert.Nil(t, err)
+	assert.Len(t, chunks, 3)
+	for i, chunk := range chunks {
+		assert.Equal(t, []byte{0x1e, 0x0f}, chunk[:2])
+		assert.Equal(t, byte(i), chunk[10])
+		assert.Equal(t, byte(3), chunk[11])
+		assert.LessOrEqual(t, len(chunk), gelfChunkSize)
+	}
+
+	_, err = gelfChunks(bytes.Repeat([]byte("a"), gelfChunkSize*gelfMaxChunks))
+	assert.NotNil(t, err)
+}
+
+func TestGELFHook(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	hook, err := NewGELFHook("udp", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	entry := &log.Entry{
+		Message: "Processing AS65510",
+		Level:   log.WarnLevel,
+		Time:    time.Unix(1, 0),
+		Data:    log.Fields{"peer": "Example", "id": 1},
+	}
+	assert.Nil(t, hook.Fire(entry))
+
+	buf := make([]byte, gelfChunkSize)
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	var msg map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf[:n], &msg))
+	assert.Equal(t, "1.1", msg["version"])
+	assert.Equal(t, "Processing AS65510", msg["short_message"])
+	assert.Equal(t, float64(4), msg["level"])
+	assert.Equal(t, "Example", msg["_peer"])
+	assert.Contains(t, msg, "_field_id")
+}
+
+func TestModuleLevels(t *testing.T) {
+	level := log.GetLevel()
+	defer func() {
+		moduleLevels = nil
+		log.SetLevel(level)
+	}()
+	log.SetLevel(log.InfoLevel)
+	assert.Nil(t, setLevels(map[string]string{"irr": "debug", "bird": "warning"}))
+	assert.Equal(t, log.DebugLevel, log.GetLevel())
+
+	var b bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&b)
+	logger.SetLevel(log.GetLevel())
+	logger.SetFormatter(moduleFormatter{&log.TextFormatter{DisableColors: true, DisableTimestamp: true}})
+	logger.WithField("module", "irr").Debug("irr debug")
+	logger.WithField("module", "config").Debug("config debug")
+	logger.WithField("module", "config").Info("config info")
+	logger.WithField("module", "bird").Info("bird info")
+	logger.WithField("module", "bird").Warn("bird warning")
+	logger.Debug("global debug")
+	assert.Equal(t, `level=debug msg="irr debug" module=irr
+level=info msg="config info" module=config
+level=warning msg="bird warning" module=bird
+`, b.String())
+
+	assert.NotNil(t, setLevels(map[string]string{"templating": "debug"}))
+	assert.NotNil(t, setLevels(map[string]string{"irr": "verbose"}))
+}
+
+func TestSetup(t *testing.T) {
+	assert.Nil(t, Setup(&config.Logging{Format: "text"}))
+	err := Setup(&config.Logging{Format: "text", GELF: config.RemoteLog{Network: "tcp", Address: "127.0.0.1:1"}})
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "GELF"))
+}
+
+func TestRotateFile(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "bird.log")
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, ioutil.WriteFile(file, []byte("first\n"), 0644))
+
+	// The first call starts tracking the file's age
+	rotated, err := RotateFile(file, time.Hour, 2, now)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+	rotated, err = RotateFile(file, time.Hour, 2, now.Add(30*time.Minute))
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+
+	rotated, err = RotateFile(file, time.Hour, 2, now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, rotated)
+	assert.NoFileExists(t, file)
+	contents, err := ioutil.ReadFile(file + ".1")
+	assert.Nil(t, err)
+	assert.Equal(t, "first\n", string(contents))
+
+	for i, line := range []string{"second\n", "third\n"} {
+		assert.Nil(t, ioutil.WriteFile(file, []byte(line), 0644))
+		rotated, err = RotateFile(file, time.Hour, 2, now.Add(time.Duration(i+2)*time.Hour))
+		assert.Nil(t, err)
+		assert.True(t, rotated)
+	}
+	contents, err = ioutil.ReadFile(file + ".1")
+	assert.Nil(t, err)
+	assert.Equal(t, "third\n", string(contents))
+	contents, err = ioutil.ReadFile(file + ".2")
+	assert.Nil(t, err)
+	assert.Equal(t, "second\n", string(contents))
+	assert.NoFileExists(t, file+".3")
+
+	assert.Nil(t, ioutil.WriteFile(file+".rotated", []byte("yesterday"), 0644))
+	_, err = RotateFile(file, time.Hour, 2, now)
+	assert.NotNil(t, err)
+}
+
+func TestStartRunLog(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"20200101T000000Z-a.log", "20200102T000000Z-b.log", "notes.txt"} {
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte{}, 0644))
+	}
+	hooks := log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+	defer log.StandardLogger().ReplaceHooks(hooks)
+
+	file, err := StartRunLog(dir, 2, "json")
+	assert.Nil(t, err)
+	log.WithField("peer", "Example").Info("Writing config")
+	assert.Nil(t, file.Close())
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Len(t, names, 3)
+	assert.Equal(t, "20200102T000000Z-b.log", names[0])
+	assert.Equal(t, "notes.txt", names[2])
+	assert.True(t, strings.HasSuffix(names[1], RunID()+".log"))
+
+	contents, err := ioutil.ReadFile(path.Join(dir, names[1]))
+	assert.Nil(t, err)
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(contents, &entry))
+	assert.Equal(t, "Writing config", entry["msg"])
+	assert.Equal(t, "Example", entry["peer"])
+}
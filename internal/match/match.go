@@ -3,8 +3,6 @@ package match
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strings"
 	"time"
 
@@ -36,25 +34,9 @@ type peeringDbIxLanData struct {
 }
 
 func peeringDbIxLans(asn uint, peeringDbQueryTimeout uint) ([]peeringDbIxLanData, error) {
-	httpClient := http.Client{Timeout: time.Second * time.Duration(peeringDbQueryTimeout)}
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://peeringdb.com/api/netixlan?asn=%d", asn), nil)
+	body, err := peeringdb.Get(fmt.Sprintf("/api/netixlan?asn=%d", asn), peeringDbQueryTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET (This peer might not have a PeeringDB page): %s", err)
-	}
-
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET request: %s", err)
-	}
-
-	if res.Body != nil {
-		//noinspection GoUnhandledErrorResult
-		defer res.Body.Close()
-	}
-
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB read: %s", err)
+		return nil, err
 	}
 
 	var pDbResponse peeringDbIxLanResponse
@@ -80,7 +62,7 @@ func CommonIXs(a uint, b uint, yamlFormat bool, queryTimeout uint) string {
 		log.Fatalf("AS%d: %v", a, err)
 	}
 
-	networkBInfo, err := peeringdb.NetworkInfo(b, queryTimeout)
+	networkBInfo, err := peeringdb.NetworkInfo(b, queryTimeout, nil)
 	if err != nil {
 		log.Fatalf("AS%d: %v", b, err)
 	}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+// birdMetrics lists the metrics set by the BIRD collector so series of removed protocols are cleared on each scrape
+var birdMetrics = []string{
+	"pathvector_bird_up",
+	"pathvector_bird_last_reboot_timestamp_seconds",
+	"pathvector_bird_last_reconfiguration_timestamp_seconds",
+	"pathvector_bgp_session_up",
+	"pathvector_bgp_session_since_timestamp_seconds",
+	"pathvector_bgp_routes_imported",
+	"pathvector_bgp_routes_filtered",
+	"pathvector_bgp_routes_exported",
+	"pathvector_bgp_routes_preferred",
+	"pathvector_bgp_import_updates_rejected_total",
+	"pathvector_bgp_import_updates_filtered_total",
+	"pathvector_bgp_export_updates_rejected_total",
+	"pathvector_bgp_export_updates_filtered_total",
+}
+
+// setTimestamp sets a gauge to a RFC3339 timestamp in seconds, skipping timestamps that aren't in RFC3339
+func setTimestamp(r *Registry, name string, help string, labels Labels, timestamp string) {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return
+	}
+	r.Set(name, help, labels, float64(t.Unix()))
+}
+
+// setChangeStat sets a change stats counter, skipping columns BIRD doesn't count
+func setChangeStat(r *Registry, name string, help string, labels Labels, value int) {
+	if value >= 0 {
+		r.SetCounter(name, help, labels, float64(value))
+	}
+}
+
+// collectBIRD sets BIRD metrics from the output of show status and show protocols all
+func collectBIRD(r *Registry, status string, protocols string) {
+	s := birdc.ParseStatus(status)
+	r.Set("pathvector_bird_up", "Whether the BIRD control socket is reachable", nil, 1)
+	setTimestamp(r, "pathvector_bird_last_reboot_timestamp_seconds", "Time BIRD was last started", nil, s.LastReboot)
+	setTimestamp(r, "pathvector_bird_last_reconfiguration_timestamp_seconds", "Time BIRD was last reconfigured", nil, s.LastReconfiguration)
+
+	for _, protocol := range birdc.ParseProtocols(protocols) {
+		if protocol.Proto != "BGP" {
+			continue
+		}
+		peer := protocol.Description
+		if peer == "" {
+			peer = protocol.Name
+		}
+		labels := Labels{"protocol": protocol.Name, "peer": peer, "asn": strconv.Itoa(int(protocol.NeighborAS))}
+		up := 0.0
+		if protocol.State == "up" {
+			up = 1
+		}
+		r.Set("pathvector_bgp_session_up", "Whether the BGP session is established", labels, up)
+		setTimestamp(r, "pathvector_bgp_session_since_timestamp_seconds", "Time of the last BGP session state change", labels, protocol.Since)
+
+		for _, channel := range protocol.Channels {
+			channelLabels := Labels{"protocol": protocol.Name, "peer": peer, "asn": labels["asn"], "channel": channel.Name}
+			r.Set("pathvector_bgp_routes_imported", "Number of routes imported from the BGP session", channelLabels, float64(channel.Routes.Imported))
+			r.Set("pathvector_bgp_routes_filtered", "Number of routes from the BGP session rejected by the import filter and kept by import keep filtered", channelLabels, float64(channel.Routes.Filtered))
+			r.Set("pathvector_bgp_routes_exported", "Number of routes exported to the BGP session", channelLabels, float64(channel.Routes.Exported))
+			r.Set("pathvector_bgp_routes_preferred", "Number of routes from the BGP session selected as best", channelLabels, float64(channel.Routes.Preferred))
+			setChangeStat(r, "pathvector_bgp_import_updates_rejected_total", "Number of import updates rejected as invalid", channelLabels, channel.ImportUpdates.Rejected)
+			setChangeStat(r, "pathvector_bgp_import_updates_filtered_total", "Number of import updates rejected by the import filter", channelLabels, channel.ImportUpdates.Filtered)
+			setChangeStat(r, "pathvector_bgp_export_updates_rejected_total", "Number of export updates rejected as invalid", channelLabels, channel.ExportUpdates.Rejected)
+			setChangeStat(r, "pathvector_bgp_export_updates_filtered_total", "Number of export updates rejected by the export filter", channelLabels, channel.ExportUpdates.Filtered)
+		}
+	}
+}
+
+// BIRD returns a collector that queries session state, route counts, filter counters and the last reconfiguration time from the BIRD socket
+func BIRD(socket string) Collector {
+	return func(r *Registry) error {
+		for _, name := range birdMetrics {
+			r.Reset(name)
+		}
+
+		client := bird.NewClient(socket)
+		defer client.Close()
+		status, err := client.Run("show status")
+		if err != nil {
+			r.Set("pathvector_bird_up", "Whether the BIRD control socket is reachable", nil, 0)
+			return fmt.Errorf("getting BIRD status: %v", err)
+		}
+		protocols, err := client.Run("show protocols all")
+		if err != nil {
+			r.Set("pathvector_bird_up", "Whether the BIRD control socket is reachable", nil, 0)
+			return fmt.Errorf("getting BIRD protocols: %v", err)
+		}
+		collectBIRD(r, status, protocols)
+		return nil // nil error
+	}
+}
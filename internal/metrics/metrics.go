@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels stores a metric's label names and values
+type Labels map[string]string
+
+// metric stores all series of a single metric
+type metric struct {
+	help       string
+	metricType string
+	series     map[string]float64 // Formatted label set to value
+}
+
+// Collector updates metrics in a registry before they're served
+type Collector func(r *Registry) error
+
+// Registry stores metrics and serves them in the Prometheus text format
+type Registry struct {
+	lock       sync.Mutex
+	metrics    map[string]*metric
+	collectors []Collector
+}
+
+// Default is the registry used by the package level functions
+var Default = NewRegistry()
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]*metric{}}
+}
+
+// formatLabels formats a label set in the Prometheus text format, sorted by label name
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(labels[name])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// get returns a metric by name, creating it if it doesn't exist
+func (r *Registry) get(name string, help string, metricType string) *metric {
+	m, found := r.metrics[name]
+	if !found {
+		m = &metric{help: help, metricType: metricType, series: map[string]float64{}}
+		r.metrics[name] = m
+	}
+	return m
+}
+
+// Set sets a gauge value
+func (r *Registry) Set(name string, help string, labels Labels, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.get(name, help, "gauge").series[formatLabels(labels)] = value
+}
+
+// SetCounter sets a counter value from an external source
+func (r *Registry) SetCounter(name string, help string, labels Labels, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.get(name, help, "counter").series[formatLabels(labels)] = value
+}
+
+// Inc increments a counter
+func (r *Registry) Inc(name string, help string, labels Labels) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.get(name, help, "counter").series[formatLabels(labels)]++
+}
+
+// Delete removes a series from a metric
+func (r *Registry) Delete(name string, labels Labels) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if m, found := r.metrics[name]; found {
+		delete(m.series, formatLabels(labels))
+	}
+}
+
+// Reset removes all series of a metric
+func (r *Registry) Reset(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.metrics, name)
+}
+
+// Register adds a collector to run before each scrape
+func (r *Registry) Register(c Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// collect runs all registered collectors, logging errors so the remaining metrics are still served
+func (r *Registry) collect() {
+	r.lock.Lock()
+	collectors := r.collectors
+	r.lock.Unlock()
+	for _, c := range collectors {
+		if err := c(r); err != nil {
+			log.Warnf("[metrics] collecting: %v", err)
+		}
+	}
+}
+
+// Write writes all metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var names []string
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := r.metrics[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.metricType); err != nil {
+			return err
+		}
+		var series []string
+		for labels := range m.series {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(m.series[labels], 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil // nil error
+}
+
+// ServeHTTP serves the metrics endpoint
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.collect()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = r.Write(w)
+}
+
+// Set sets a gauge value in the default registry
+func Set(name string, help string, labels Labels, value float64) {
+	Default.Set(name, help, labels, value)
+}
+
+// Register adds a collector to the default registry
+func Register(c Collector) {
+	Default.Register(c)
+}
+
+// Inc increments a counter in the default registry
+func Inc(name string, help string, labels Labels) {
+	Default.Inc(name, help, labels)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Set("pathvector_example", "Example gauge", Labels{"peer": "Example", "asn": "65510"}, 1.5)
+	r.Set("pathvector_example", "Example gauge", Labels{"peer": `Say "hi"`, "asn": "65520"}, 2)
+	r.Inc("pathvector_events_total", "Example counter", nil)
+	r.Inc("pathvector_events_total", "Example counter", nil)
+
+	var b bytes.Buffer
+	assert.Nil(t, r.Write(&b))
+	assert.Equal(t, `# HELP pathvector_events_total Example counter
+# TYPE pathvector_events_total counter
+pathvector_events_total 2
+# HELP pathvector_example Example gauge
+# TYPE pathvector_example gauge
+pathvector_example{asn="65510",peer="Example"} 1.5
+pathvector_example{asn="65520",peer="Say \"hi\""} 2
+`, b.String())
+
+	r.Delete("pathvector_example", Labels{"peer": "Example", "asn": "65510"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.NotContains(t, rec.Body.String(), `peer="Example"`)
+}
+
+func TestCollectBIRD(t *testing.T) {
+	r := NewRegistry()
+	collectBIRD(r, `1000-BIRD 2.0.8
+1011-Router ID is 192.0.2.1
+ Current server time is 2021-06-11 03:00:00
+ Last reboot on 2021-06-11 01:59:05
+ Last reconfiguration on 2021-06-11 02:30:00
+0013 Daemon is up and running
+`, `2002-Name       Proto      Table      State  Since         Info
+1002-device1    Device     ---        up     2021-06-11 01:59:05
+1002-EXAMPLE_AS65510_v4  BGP        ---        up     2021-06-11 02:00:00  Established
+1006-  Description:    Example
+   BGP state:          Established
+     Neighbor AS:      65510
+   Channel ipv4
+     Routes:         15 imported, 2 filtered, 4 exported, 10 preferred
+     Route change stats:     received   rejected   filtered    ignored   accepted
+       Import updates:             20          1          2          0         17
+       Export updates:             30          5          0        ---         25
+1002-EXAMPLE_AS65510_v6  BGP        ---        start  2021-06-11 02:00:00  Active        Socket: Connection refused
+1006-  Description:    Example
+   BGP state:          Active
+     Neighbor AS:      65510
+0000
+`)
+
+	var b bytes.Buffer
+	assert.Nil(t, r.Write(&b))
+	out := b.String()
+	assert.Contains(t, out, "pathvector_bird_up 1\n")
+	assert.Contains(t, out, "# TYPE pathvector_bird_last_reconfiguration_timestamp_seconds gauge")
+	assert.Contains(t, out, `pathvector_bgp_session_up{asn="65510",peer="Example",protocol="EXAMPLE_AS65510_v4"} 1`)
+	assert.Contains(t, out, `pathvector_bgp_session_up{asn="65510",peer="Example",protocol="EXAMPLE_AS65510_v6"} 0`)
+	assert.Contains(t, out, `pathvector_bgp_routes_imported{asn="65510",channel="ipv4",peer="Example",protocol="EXAMPLE_AS65510_v4"} 15`)
+	assert.Contains(t, out, `pathvector_bgp_routes_filtered{asn="65510",channel="ipv4",peer="Example",protocol="EXAMPLE_AS65510_v4"} 2`)
+	assert.Contains(t, out, "# TYPE pathvector_bgp_import_updates_filtered_total counter")
+	assert.Contains(t, out, `pathvector_bgp_import_updates_filtered_total{asn="65510",channel="ipv4",peer="Example",protocol="EXAMPLE_AS65510_v4"} 2`)
+	assert.Contains(t, out, `pathvector_bgp_export_updates_rejected_total{asn="65510",channel="ipv4",peer="Example",protocol="EXAMPLE_AS65510_v4"} 5`)
+	assert.NotContains(t, out, "device1")
+
+	// Collectors reset BIRD metrics so removed protocols aren't served
+	// and a failed query is reported by pathvector_bird_up
+	r.Register(BIRD("/nonexistent/bird.ctl"))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "pathvector_bird_up 0\n")
+	assert.NotContains(t, rec.Body.String(), "EXAMPLE_AS65510_v4")
+}
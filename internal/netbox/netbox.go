@@ -0,0 +1,289 @@
+package netbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// listResponse stores a paginated NetBox API list response
+type listResponse struct {
+	Next    string          `json:"next"`
+	Results json.RawMessage `json:"results"`
+}
+
+// ipAddress stores a nested NetBox IP address object
+type ipAddress struct {
+	Address string `json:"address"`
+}
+
+// asn stores a nested NetBox ASN object
+type asn struct {
+	ASN int `json:"asn"`
+	// Older versions of the BGP plugin use their own ASN model with "number" instead of "asn"
+	LegacyASN int `json:"number"`
+}
+
+// value returns the ASN number regardless of plugin version
+func (a *asn) value() int {
+	if a == nil {
+		return 0
+	}
+	if a.ASN != 0 {
+		return a.ASN
+	}
+	return a.LegacyASN
+}
+
+// Session stores a single BGP session from the NetBox BGP plugin
+type Session struct {
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	LocalAddress  *ipAddress `json:"local_address"`
+	RemoteAddress *ipAddress `json:"remote_address"`
+	LocalAS       *asn       `json:"local_as"`
+	RemoteAS      *asn       `json:"remote_as"`
+	Status        struct {
+		Value string `json:"value"`
+	} `json:"status"`
+	PeerGroup *struct {
+		Name string `json:"name"`
+	} `json:"peer_group"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+// Prefix stores a single NetBox IPAM prefix
+type Prefix struct {
+	Prefix string `json:"prefix"`
+}
+
+// client is a NetBox API client
+type client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// list gets all results of a paginated NetBox API endpoint and passes each page to the callback
+func (c *client) list(endpoint string, query url.Values, callback func(results json.RawMessage) error) error {
+	next := strings.TrimSuffix(c.url, "/") + endpoint + "?" + query.Encode()
+	for next != "" {
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if err != nil {
+			return fmt.Errorf("NetBox GET: %s", err)
+		}
+		req.Header.Set("Authorization", "Token "+c.token)
+		req.Header.Set("Accept", "application/json")
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("NetBox GET request: %s", err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		//noinspection GoUnhandledErrorResult
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("NetBox read: %s", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("NetBox GET %s returned HTTP %d: %s", endpoint, res.StatusCode, body)
+		}
+
+		var page listResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return fmt.Errorf("NetBox JSON Unmarshal: %s", err)
+		}
+		if err := callback(page.Results); err != nil {
+			return err
+		}
+		next = page.Next
+	}
+	return nil // nil error
+}
+
+// Sessions gets all BGP sessions for a device from the NetBox BGP plugin
+func (c *client) Sessions(device string) ([]Session, error) {
+	var sessions []Session
+	err := c.list("/api/plugins/bgp/bgpsession/", url.Values{"device": {device}, "limit": {"1000"}}, func(results json.RawMessage) error {
+		var page []Session
+		if err := json.Unmarshal(results, &page); err != nil {
+			return fmt.Errorf("NetBox session JSON Unmarshal: %s", err)
+		}
+		sessions = append(sessions, page...)
+		return nil
+	})
+	return sessions, err
+}
+
+// Prefixes gets all prefixes with a given tag
+func (c *client) Prefixes(tag string) ([]string, error) {
+	var prefixes []string
+	err := c.list("/api/ipam/prefixes/", url.Values{"tag": {tag}, "limit": {"1000"}}, func(results json.RawMessage) error {
+		var page []Prefix
+		if err := json.Unmarshal(results, &page); err != nil {
+			return fmt.Errorf("NetBox prefix JSON Unmarshal: %s", err)
+		}
+		for _, p := range page {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		return nil
+	})
+	return prefixes, err
+}
+
+// stripLength removes the prefix length from a NetBox IP address
+func stripLength(address string) string {
+	return strings.Split(address, "/")[0]
+}
+
+// customString returns a string custom field, or an empty string if unset
+func customString(fields map[string]interface{}, key string) string {
+	if v, ok := fields[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// sessionsToPeers groups NetBox sessions by name into peer definitions
+func sessionsToPeers(sessions []Session, templates map[string]*config.Peer, defaultTemplate string) (map[string]*config.Peer, error) {
+	peers := map[string]*config.Peer{}
+	for _, session := range sessions {
+		remoteASN := session.RemoteAS.value()
+		if remoteASN == 0 {
+			return nil, fmt.Errorf("NetBox session %s has no remote AS", session.Name)
+		}
+		if session.RemoteAddress == nil || session.RemoteAddress.Address == "" {
+			return nil, fmt.Errorf("NetBox session %s has no remote address", session.Name)
+		}
+		neighbor := stripLength(session.RemoteAddress.Address)
+
+		name := session.Name
+		if name == "" {
+			name = fmt.Sprintf("AS%d", remoteASN)
+		}
+
+		peer, exists := peers[name]
+		if !exists {
+			peer = &config.Peer{
+				ASN:         &remoteASN,
+				NeighborIPs: &[]string{},
+			}
+
+			// Use the peer group as the template if one exists by that name
+			template := defaultTemplate
+			if session.PeerGroup != nil && templates[session.PeerGroup.Name] != nil {
+				template = session.PeerGroup.Name
+			}
+			if template != "" {
+				peer.Template = &template
+			}
+
+			if session.Description != "" {
+				description := session.Description
+				peer.Description = &description
+			}
+			if asSet := customString(session.CustomFields, "as_set"); asSet != "" {
+				peer.ASSet = &asSet
+			}
+			if localASN := session.LocalAS.value(); localASN != 0 {
+				peer.LocalASN = &localASN
+			}
+
+			// Only active sessions are enabled
+			disabled := session.Status.Value != "" && session.Status.Value != "active"
+			peer.Disabled = &disabled
+
+			peers[name] = peer
+		} else if *peer.ASN != remoteASN {
+			return nil, fmt.Errorf("NetBox sessions named %s have different remote ASNs (%d and %d)", name, *peer.ASN, remoteASN)
+		}
+
+		*peer.NeighborIPs = append(*peer.NeighborIPs, neighbor)
+
+		// Listen addresses are per address family, so all of a peer's sessions in a family must share one
+		if session.LocalAddress != nil && session.LocalAddress.Address != "" {
+			local := stripLength(session.LocalAddress.Address)
+			listen := &peer.Listen4
+			if strings.Contains(local, ":") {
+				listen = &peer.Listen6
+			}
+			if *listen != nil && **listen != local {
+				return nil, fmt.Errorf("NetBox sessions named %s have different local addresses (%s and %s)", name, **listen, local)
+			}
+			*listen = &local
+		}
+	}
+	return peers, nil // nil error
+}
+
+// Update pulls BGP sessions and prefixes from NetBox and adds them to the config
+func Update(c *config.Config) error {
+	if c.NetBox.Token == "" {
+		return errors.New("NetBox token must be set")
+	}
+	nb := &client{
+		url:        c.NetBox.URL,
+		token:      c.NetBox.Token,
+		httpClient: &http.Client{Timeout: time.Second * time.Duration(c.NetBox.QueryTimeout)},
+	}
+
+	device := c.NetBox.Device
+	if device == "" {
+		device = c.Hostname
+	}
+
+	// Prefixes are added first so that NetBox peers announce them
+	if c.NetBox.PrefixTag != "" {
+		prefixes, err := nb.Prefixes(c.NetBox.PrefixTag)
+		if err != nil {
+			return err
+		}
+		for _, prefix := range prefixes {
+			if err := c.AddPrefix(prefix); err != nil {
+				return fmt.Errorf("adding NetBox prefix: %v", err)
+			}
+		}
+		if err := c.ResolveAnnouncements(); err != nil {
+			return err
+		}
+		log.Infof("Added %d prefixes from NetBox", len(prefixes))
+	}
+
+	log.Debugf("Querying NetBox for sessions on %s", device)
+	sessions, err := nb.Sessions(device)
+	if err != nil {
+		return err
+	}
+	peers, err := sessionsToPeers(sessions, c.Templates, c.NetBox.Template)
+	if err != nil {
+		return err
+	}
+
+	// Add peers in a stable order
+	var names []string
+	for name := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, exists := c.Peers[name]; exists {
+			log.Warnf("[%s] is defined in both the config file and NetBox, using the config file definition", name)
+			continue
+		}
+		if err := c.AddPeer(name, peers[name]); err != nil {
+			return fmt.Errorf("adding NetBox peer %s: %v", name, err)
+		}
+	}
+	log.Infof("Added %d peers from NetBox", len(peers))
+
+	return nil // nil error
+}
@@ -0,0 +1,99 @@
+package netbox
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestUpdate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token example" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/plugins/bgp/bgpsession/":
+			fmt.Fprint(w, `{"next": null, "results": [
+{"name": "Upstream", "remote_as": {"asn": 65510}, "local_as": {"asn": 65530}, "remote_address": {"address": "203.0.113.1/31"}, "local_address": {"address": "203.0.113.0/31"}, "status": {"value": "active"}, "peer_group": {"name": "upstream"}},
+{"name": "Upstream", "remote_as": {"asn": 65510}, "remote_address": {"address": "2001:db8::1/127"}, "status": {"value": "active"}, "peer_group": {"name": "upstream"}},
+{"name": "", "remote_as": {"number": 65520}, "remote_address": {"address": "192.0.2.2/24"}, "status": {"value": "planned"}, "custom_fields": {"as_set": "AS-EXAMPLE"}}
+]}`)
+		case "/api/ipam/prefixes/":
+			fmt.Fprint(w, `{"next": null, "results": [{"prefix": "198.51.100.0/24"}, {"prefix": "2001:db8:1::/48"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := config.Load([]byte(fmt.Sprintf(`
+asn: 65530
+router-id: 192.0.2.1
+hostname: router1
+templates:
+  upstream:
+    local-pref: 90
+peers:
+  Static:
+    asn: 65540
+    template: upstream
+    neighbors: [192.0.2.4]
+netbox:
+  url: %s
+  token: example
+  prefix-tag: anycast
+`, server.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Update(c); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"198.51.100.0/24"}, c.Prefixes4)
+	assert.Equal(t, []string{"2001:db8:1::/48"}, c.Prefixes6)
+
+	upstream := c.Peers["Upstream"]
+	if assert.NotNil(t, upstream) {
+		assert.Equal(t, 65510, *upstream.ASN)
+		assert.Equal(t, 90, *upstream.LocalPref)
+		assert.Equal(t, []string{"203.0.113.1", "2001:db8::1"}, *upstream.NeighborIPs)
+		assert.Equal(t, "203.0.113.0", *upstream.Listen4)
+		assert.False(t, *upstream.Disabled)
+		assert.True(t, *upstream.AnnounceOriginated)
+	}
+
+	// Peers loaded before the NetBox prefixes announce them, and don't share values with their template
+	static := c.Peers["Static"]
+	assert.True(t, *static.AnnounceOriginated)
+	assert.NotSame(t, c.Templates["upstream"].LocalPref, static.LocalPref)
+
+	planned := c.Peers["AS65520"]
+	if assert.NotNil(t, planned) {
+		assert.True(t, *planned.Disabled)
+		assert.Equal(t, "AS-EXAMPLE", *planned.ASSet)
+	}
+}
+
+func TestSessionsToPeersLocalAddresses(t *testing.T) {
+	session := func(remote, local string) Session {
+		return Session{
+			Name:          "Upstream",
+			RemoteAS:      &asn{ASN: 65510},
+			RemoteAddress: &ipAddress{Address: remote},
+			LocalAddress:  &ipAddress{Address: local},
+		}
+	}
+	peers, err := sessionsToPeers([]Session{session("203.0.113.1/31", "203.0.113.0/31"), session("203.0.113.3/31", "203.0.113.0/31")}, nil, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "203.0.113.0", *peers["Upstream"].Listen4)
+
+	_, err = sessionsToPeers([]Session{session("203.0.113.1/31", "203.0.113.0/31"), session("203.0.113.3/31", "203.0.113.2/31")}, nil, "")
+	assert.EqualError(t, err, "NetBox sessions named Upstream have different local addresses (203.0.113.0 and 203.0.113.2)")
+}
@@ -0,0 +1,62 @@
+package openbgpd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Check checks if an OpenBGPD config file is valid
+func Check(binary string, file string) error {
+	out, err := exec.Command(binary, "-n", "-f", file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil // nil error
+}
+
+// Reload reloads the running bgpd with bgpctl
+func Reload(bgpctl string) error {
+	out, err := exec.Command(bgpctl, "reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s reload: %v: %s", bgpctl, err, strings.TrimSpace(string(out)))
+	}
+	return nil // nil error
+}
+
+// Apply moves a validated config from the cache directory into place and reloads OpenBGPD, restoring the previous config on failure
+func Apply(newFile string, file string, bgpctl string, noConfigure bool) error {
+	// Keep the previous config to roll back to
+	previous, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := util.MoveFile(newFile, file); err != nil {
+		return fmt.Errorf("moving OpenBGPD config: %v", err)
+	}
+	// bgpd refuses to load a config that's readable by other users
+	if err := os.Chmod(file, 0600); err != nil {
+		return fmt.Errorf("setting OpenBGPD config permissions: %v", err)
+	}
+
+	if noConfigure {
+		return nil
+	}
+	log.Infoln("Reloading OpenBGPD")
+	if err := Reload(bgpctl); err != nil {
+		if previous != nil {
+			log.Warnf("Restoring previous OpenBGPD config")
+			if err := ioutil.WriteFile(file, previous, 0600); err != nil {
+				log.Warnf("Restoring previous OpenBGPD config: %v", err)
+			}
+		}
+		return fmt.Errorf("reloading OpenBGPD: %v", err)
+	}
+	return nil // nil error
+}
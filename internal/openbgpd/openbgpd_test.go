@@ -0,0 +1,56 @@
+package openbgpd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	if err := Check("true", "bgpd.conf"); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+	if err := Check("false", "bgpd.conf"); err == nil {
+		t.Errorf("expected validation error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pathvector-openbgpd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "bgpd.conf")
+	newFile := path.Join(dir, "cache-bgpd.conf")
+
+	if err := ioutil.WriteFile(newFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "true", false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected config mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// Failed reload restores the previous config
+	if err := ioutil.WriteFile(newFile, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(newFile, file, "false", false); err == nil {
+		t.Errorf("expected reload error")
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Errorf("expected previous config to be restored, got %s", b)
+	}
+}
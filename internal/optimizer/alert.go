@@ -0,0 +1,175 @@
+package optimizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// Optimizer event actions
+const (
+	actionAlert       = "alert"
+	actionDepreferred = "depreferred"
+	actionRestored    = "restored"
+)
+
+// alertName is the Alertmanager alertname label for optimizer alerts
+const alertName = "PathvectorOptimizerThresholdExceeded"
+
+// Event stores an optimizer event
+type Event struct {
+	Time       time.Time     `json:"time"`
+	Hostname   string        `json:"hostname"`
+	Peer       string        `json:"peer"`
+	ASN        string        `json:"asn"`
+	Family     string        `json:"family"`
+	Action     string        `json:"action"`
+	ReportOnly bool          `json:"report-only"`
+	Targets    []EventTarget `json:"targets"`
+}
+
+// EventTarget stores the measurements to a single target in an optimizer event
+type EventTarget struct {
+	Target     string  `json:"target"`
+	Message    string  `json:"message,omitempty"`
+	LatencyMs  float64 `json:"latency-ms"`
+	JitterMs   float64 `json:"jitter-ms"`
+	PacketLoss float64 `json:"packet-loss"`
+	Path       string  `json:"path,omitempty"`
+}
+
+// amAlert stores a single alert in the Alertmanager v2 API format
+type amAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+// eventTarget builds an event target from a target's average measurements
+func eventTarget(target string, message string, avg *peerAvg) EventTarget {
+	return EventTarget{
+		Target:     target,
+		Message:    message,
+		LatencyMs:  float64(avg.Latency) / float64(time.Millisecond),
+		JitterMs:   float64(avg.Jitter) / float64(time.Millisecond),
+		PacketLoss: avg.PacketLoss,
+	}
+}
+
+// alertEvent builds an event from a peer's threshold alerts
+func alertEvent(o *config.Optimizer, hostname string, peerASN string, peerName string, af string, action string, alerts []alert, paths map[string]string) Event {
+	e := Event{Time: time.Now(), Hostname: hostname, Peer: peerName, ASN: peerASN, Family: af, Action: action, ReportOnly: o.ReportOnly}
+	for _, a := range alerts {
+		t := eventTarget(a.Target, a.Message, a.Avg)
+		t.Path = paths[a.Target]
+		e.Targets = append(e.Targets, t)
+	}
+	return e
+}
+
+// restoreEvent builds an event with the current measurements to each of a peer's targets
+func restoreEvent(o *config.Optimizer, hostname string, peerASN string, peerName string, af string, results []config.ProbeResult) Event {
+	e := Event{Time: time.Now(), Hostname: hostname, Peer: peerName, ASN: peerASN, Family: af, Action: actionRestored, ReportOnly: o.ReportOnly}
+	byTarget, targets := groupByTarget(results)
+	for _, target := range targets {
+		e.Targets = append(e.Targets, eventTarget(target, "", average(byTarget[target], o.EWMAAlpha)))
+	}
+	return e
+}
+
+// alertmanagerAlerts converts an event to one Alertmanager alert per target, resolving them on restore
+func alertmanagerAlerts(e Event, startsAt time.Time) []amAlert {
+	var alerts []amAlert
+	index := map[string]int{}
+	for _, t := range e.Targets {
+		if i, found := index[t.Target]; found {
+			alerts[i].Annotations["description"] += "\n" + t.Message
+			continue
+		}
+		a := amAlert{
+			Labels: map[string]string{
+				"alertname": alertName,
+				"instance":  e.Hostname,
+				"peer":      e.Peer,
+				"asn":       e.ASN,
+				"family":    "ipv" + e.Family,
+				"target":    t.Target,
+			},
+			Annotations: map[string]string{
+				"summary":     fmt.Sprintf("AS%s %s IPv%s %s", e.ASN, e.Peer, e.Family, e.Action),
+				"description": t.Message,
+				"action":      e.Action,
+				"report_only": strconv.FormatBool(e.ReportOnly),
+				"latency_ms":  fmt.Sprintf("%.3f", t.LatencyMs),
+				"jitter_ms":   fmt.Sprintf("%.3f", t.JitterMs),
+				"packet_loss": fmt.Sprintf("%.3f", t.PacketLoss),
+			},
+			StartsAt: startsAt,
+		}
+		if t.Path != "" {
+			a.Annotations["path"] = t.Path
+		}
+		if e.Action == actionRestored {
+			endsAt := e.Time
+			a.EndsAt = &endsAt
+		}
+		index[t.Target] = len(alerts)
+		alerts = append(alerts, a)
+	}
+	return alerts
+}
+
+// postJSON POSTs a JSON body to a URL
+func postJSON(url string, timeout int, body interface{}) error {
+	contents, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	return nil // nil error
+}
+
+// RunAlertScript calls the alert script with an alert and its arguments, if an alert script is configured
+func RunAlertScript(o *config.Optimizer, args ...string) {
+	if o.AlertScript == "" {
+		return
+	}
+	cmd := exec.Command(o.AlertScript, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logger.Warnf("[Optimizer] alert script: %v", err)
+	}
+}
+
+// notify sends an optimizer event to the configured webhook and Alertmanager
+func notify(o *config.Optimizer, e Event, startsAt time.Time) {
+	if o.WebhookURL != "" {
+		if err := postJSON(o.WebhookURL, o.AlertTimeout, e); err != nil {
+			logger.Warnf("[Optimizer] webhook: %v", err)
+		}
+	}
+	if o.AlertmanagerURL != "" && len(e.Targets) > 0 {
+		url := strings.TrimSuffix(o.AlertmanagerURL, "/") + "/api/v2/alerts"
+		if err := postJSON(url, o.AlertTimeout, alertmanagerAlerts(e, startsAt)); err != nil {
+			logger.Warnf("[Optimizer] alertmanager: %v", err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package optimizer
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/pkg/birdc"
+)
+
+// parseRoutePrefixes parses the unique prefixes from the output of show route
+func parseRoutePrefixes(output string) []string {
+	return birdc.Prefixes(birdc.ParseRoutes(output))
+}
+
+// hostAddress returns the address at an offset inside a prefix
+func hostAddress(prefix string, offset int) (string, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	ip := network.IP
+	if ip.To4() != nil {
+		ip = ip.To4()
+	}
+	host := new(big.Int).Add(new(big.Int).SetBytes(ip), big.NewInt(int64(offset)))
+	b := host.Bytes()
+	if len(b) > len(ip) {
+		return "", fmt.Errorf("offset %d overflows %s", offset, prefix)
+	}
+	addr := make(net.IP, len(ip))
+	copy(addr[len(ip)-len(b):], b)
+	if !network.Contains(addr) {
+		return "", fmt.Errorf("offset %d is outside %s", offset, prefix)
+	}
+	return addr.String(), nil
+}
+
+// pickTargets picks up to count evenly spaced prefixes and returns the address at an offset inside each
+func pickTargets(prefixes []string, count int, offset int) []string {
+	var targets []string
+	if len(prefixes) == 0 || count <= 0 {
+		return targets
+	}
+	if count > len(prefixes) {
+		count = len(prefixes)
+	}
+	step := float64(len(prefixes)) / float64(count)
+	for i := 0; i < count; i++ {
+		prefix := prefixes[int(float64(i)*step)]
+		target, err := hostAddress(prefix, offset)
+		if err != nil {
+			logger.Debugf("[Optimizer] Skipping auto target in %s: %v", prefix, err)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// autoTargets returns probe targets derived from the prefixes learned from a peer
+func autoTargets(o *config.Optimizer, peer *config.Peer, birdSocket string) []string {
+	var targets []string
+	if peer == nil || peer.ProtocolName == nil {
+		return targets
+	}
+	for _, af := range []string{"4", "6"} {
+		out, err := bird.RunCommand(fmt.Sprintf(`show route where proto ~ "%s*"`, peer.FamilyProtocolName(af)), birdSocket)
+		if err != nil {
+			logger.Warnf("[Optimizer] Getting routes from %s: %v", *peer.ProtocolName, err)
+			continue
+		}
+		targets = append(targets, pickTargets(parseRoutePrefixes(out), o.AutoTargets, o.AutoTargetOffset)...)
+	}
+	return targets
+}
+
+// autoTargetCache stores derived probe targets so BIRD is only queried for a peer's learned prefixes every refresh interval
+type autoTargetCache struct {
+	targets   map[string][]string // Peer name to derived targets
+	refreshed time.Time
+}
+
+// get returns the cached derived targets for a peer, querying BIRD if the cache has expired
+func (c *autoTargetCache) get(o *config.Optimizer, name string, peer *config.Peer, birdSocket string) []string {
+	if c.targets == nil || time.Since(c.refreshed) >= time.Duration(o.AutoTargetRefresh)*time.Second {
+		c.targets = map[string][]string{}
+		c.refreshed = time.Now()
+	}
+	targets, found := c.targets[name]
+	if !found {
+		targets = autoTargets(o, peer, birdSocket)
+		logger.Debugf("[Optimizer] Derived probe targets for %s: %v", name, targets)
+		c.targets[name] = targets
+	}
+	return targets
+}
+
+// carriesTarget checks if a peer has a route covering a target address
+func carriesTarget(peer *config.Peer, address string, birdSocket string) (bool, error) {
+	if peer == nil || peer.ProtocolName == nil {
+		return false, nil
+	}
+	af := "4"
+	if !sameAddressFamily(address, "0.0.0.0") {
+		af = "6"
+	}
+	out, err := bird.RunCommand(fmt.Sprintf(`show route for %s where proto ~ "%s*"`, address, peer.FamilyProtocolName(af)), birdSocket)
+	if err != nil {
+		return false, err
+	}
+	return len(parseRoutePrefixes(out)) > 0, nil
+}
+
+// routedJobs returns the probe jobs whose targets are covered by a route learned from the job's peer
+func routedJobs(o *config.Optimizer, jobs []*probeJob, peers map[string]*config.Peer, birdSocket string) []*probeJob {
+	var routed []*probeJob
+	carried := map[string]bool{} // Peer and target address to whether the peer carries it
+	for _, job := range jobs {
+		_, name := parsePeerDelimiter(job.Peer)
+		address := targetAddress(o, job.Target)
+		key := job.Peer + Delimiter + address
+		if _, found := carried[key]; !found {
+			ok, err := carriesTarget(peers[name], address, birdSocket)
+			if err != nil {
+				logger.Warnf("[Optimizer] Checking route to %s via %s: %v", address, name, err)
+			}
+			carried[key] = ok
+			if !ok {
+				logger.Debugf("[Optimizer] Skipping %s for %s, no route learned from the peer", address, name)
+			}
+		}
+		if carried[key] {
+			routed = append(routed, job)
+		}
+	}
+	return routed
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package optimizer
+
+import (
+	"syscall"
+)
+
+// bindToDevice returns a dialer control function that binds sockets to an interface
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		if err := c.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), iface)
+		}); err != nil {
+			return err
+		}
+		return bindErr
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package optimizer
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDevice returns a dialer control function that fails, since binding to an interface is only supported on Linux
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return fmt.Errorf("binding to interface %s is only supported on Linux", iface)
+	}
+}
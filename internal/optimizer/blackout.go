@@ -0,0 +1,87 @@
+package optimizer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// weekdays maps day abbreviations to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// clockMinutes parses a HH:MM time to minutes since midnight
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// windowActive checks if a blackout window covers a time
+func windowActive(w config.BlackoutWindow, now time.Time) (bool, error) {
+	// One-off window
+	if start, err := time.Parse(time.RFC3339, w.Start); err == nil {
+		end, err := time.Parse(time.RFC3339, w.End)
+		if err != nil {
+			return false, fmt.Errorf("blackout window end %s: %v", w.End, err)
+		}
+		return !now.Before(start) && now.Before(end), nil
+	}
+
+	// Recurring window
+	start, err := clockMinutes(w.Start)
+	if err != nil {
+		return false, fmt.Errorf("blackout window start %s must be RFC3339 or HH:MM", w.Start)
+	}
+	end, err := clockMinutes(w.End)
+	if err != nil {
+		return false, fmt.Errorf("blackout window end %s must be HH:MM", w.End)
+	}
+	days := map[time.Weekday]bool{}
+	for _, day := range w.Days {
+		weekday, found := weekdays[strings.ToLower(day)]
+		if !found && len(day) > 3 {
+			weekday, found = weekdays[strings.ToLower(day[:3])]
+		}
+		if !found {
+			return false, fmt.Errorf("invalid blackout window day %s", day)
+		}
+		days[weekday] = true
+	}
+	startsOn := func(day time.Weekday) bool {
+		return len(days) == 0 || days[day]
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return startsOn(now.Weekday()) && minute >= start && minute < end, nil
+	}
+	// The window crosses midnight, so it either started today or yesterday
+	yesterday := now.AddDate(0, 0, -1).Weekday()
+	return (startsOn(now.Weekday()) && minute >= start) || (startsOn(yesterday) && minute < end), nil
+}
+
+// blackout returns the active blackout window, or nil if there is none
+func blackout(o *config.Optimizer, now time.Time) (*config.BlackoutWindow, error) {
+	for i := range o.BlackoutWindows {
+		active, err := windowActive(o.BlackoutWindows[i], now)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			return &o.BlackoutWindows[i], nil
+		}
+	}
+	return nil, nil // nil error
+}
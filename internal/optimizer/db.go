@@ -0,0 +1,118 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// dbFile is the name of the probe database file in the cache directory
+const dbFile = "optimizer-db.json"
+
+// stateFile is the name of the depreferred peer state file in the cache directory
+const stateFile = "optimizer-state.json"
+
+// decisionsFile is the name of the optimizer decision history file in the cache directory
+const decisionsFile = "optimizer-decisions.json"
+
+// readJSON reads a JSON file from the cache directory, leaving v unchanged if it doesn't exist
+func readJSON(cacheDirectory string, file string, v interface{}) error {
+	contents, err := ioutil.ReadFile(path.Join(cacheDirectory, file))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, v)
+}
+
+// writeJSON writes a JSON file to the cache directory
+func writeJSON(cacheDirectory string, file string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheDirectory, 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash doesn't leave a partial file
+	tmpFile := path.Join(cacheDirectory, file+".tmp")
+	if err := ioutil.WriteFile(tmpFile, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path.Join(cacheDirectory, file))
+}
+
+// loadDb loads the probe database from the cache directory, keeping only peers in the source map
+func loadDb(cacheDirectory string, sourceMap map[string][]string, cacheSize int) (map[string][]config.ProbeResult, error) {
+	db := map[string][]config.ProbeResult{}
+	var stored map[string][]config.ProbeResult
+	if err := readJSON(cacheDirectory, dbFile, &stored); err != nil {
+		return nil, err
+	}
+	for peer, results := range stored {
+		if _, found := sourceMap[peer]; !found {
+			continue
+		}
+		if len(results) > cacheSize {
+			results = results[len(results)-cacheSize:]
+		}
+		db[peer] = results
+	}
+	return db, nil
+}
+
+// saveDb writes the probe database to the cache directory
+func saveDb(cacheDirectory string, db map[string][]config.ProbeResult) error {
+	return writeJSON(cacheDirectory, dbFile, db)
+}
+
+// loadState loads the depreferred peer address families from the cache directory
+func loadState(cacheDirectory string) (map[string]int64, error) {
+	stored := map[string]int64{}
+	if err := readJSON(cacheDirectory, stateFile, &stored); err != nil {
+		return nil, err
+	}
+	state := map[string]int64{}
+	for key, since := range stored {
+		// Peers depreferred before address families were tracked separately were depreferred in both
+		if peer, af := parseFamilyKey(key); af == "" {
+			for _, af := range families {
+				state[familyKey(peer, af)] = since
+			}
+		} else {
+			state[key] = since
+		}
+	}
+	return state, nil
+}
+
+// saveState writes the depreferred peers to the cache directory
+func saveState(cacheDirectory string, state map[string]int64) error {
+	return writeJSON(cacheDirectory, stateFile, state)
+}
+
+// loadDecisions loads the optimizer decision history from the cache directory
+func loadDecisions(cacheDirectory string) ([]Event, error) {
+	var decisions []Event
+	if err := readJSON(cacheDirectory, decisionsFile, &decisions); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// saveDecision appends a decision to the history in the cache directory, keeping at most max entries
+func saveDecision(cacheDirectory string, e Event, max int) error {
+	decisions, err := loadDecisions(cacheDirectory)
+	if err != nil {
+		return err
+	}
+	decisions = append(decisions, e)
+	if max > 0 && len(decisions) > max {
+		decisions = decisions[len(decisions)-max:]
+	}
+	return writeJSON(cacheDirectory, decisionsFile, decisions)
+}
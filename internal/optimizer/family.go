@@ -0,0 +1,52 @@
+package optimizer
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// families are the address families the optimizer tracks separately
+var families = []string{"4", "6"}
+
+// targetFamily returns the address family of a probe target string
+func targetFamily(o *config.Optimizer, target string) string {
+	address := targetAddress(o, target)
+	if net.ParseIP(address) == nil {
+		// Probe targets that are no longer configured are parsed from the target URL
+		if u, err := url.Parse(target); err == nil && u.Hostname() != "" {
+			address = u.Hostname()
+		}
+	}
+	if net.ParseIP(address).To4() != nil {
+		return "4"
+	}
+	return "6"
+}
+
+// familyResults returns the probe results to targets in an address family
+func familyResults(o *config.Optimizer, results []config.ProbeResult, af string) []config.ProbeResult {
+	var filtered []config.ProbeResult
+	for _, result := range results {
+		if targetFamily(o, result.Stats.Addr) == af {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// familyKey returns the depreferred state key for an address family of a peer
+func familyKey(peer string, af string) string {
+	return peer + Delimiter + af
+}
+
+// parseFamilyKey splits a depreferred state key into the peer and address family, returning an empty family for keys without one
+func parseFamilyKey(key string) (string, string) {
+	if strings.Count(key, Delimiter) < 2 {
+		return key, ""
+	}
+	i := strings.LastIndex(key, Delimiter)
+	return key[:i], key[i+len(Delimiter):]
+}
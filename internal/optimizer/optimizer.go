@@ -5,9 +5,10 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
-	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,14 +17,30 @@ import (
 
 	"github.com/natesales/pathvector/internal/bird"
 	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/metrics"
+	"github.com/natesales/pathvector/internal/provenance"
 	"github.com/natesales/pathvector/internal/util"
 )
 
+// logger tags log entries from this package so its log level can be set separately
+var logger = log.WithField("module", "optimizer")
+
 // Delimiter is an arbitrary delimiter used to split ASN from peerName
 var Delimiter = "####"
 
+// OnProbe is called with every probe result if set
+var OnProbe func(peerASN string, peerName string, source string, target string, result config.ProbeResult)
+
 type peerAvg struct {
 	Latency    time.Duration
+	Jitter     time.Duration
+	PacketLoss float64
+}
+
+// limits stores the thresholds for a single target (jitter is disabled if 0)
+type limits struct {
+	Latency    time.Duration
+	Jitter     time.Duration
 	PacketLoss float64
 }
 
@@ -33,6 +50,14 @@ func parsePeerDelimiter(i string) (string, string) {
 	return parts[0], parts[1]
 }
 
+// boolFloat converts a bool to a metric value
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // sameAddressFamily returns if two strings (IP addresses) are of the same address family
 func sameAddressFamily(a string, b string) bool {
 	a4 := net.ParseIP(a).To4() != nil // Is address A IPv4?
@@ -42,7 +67,12 @@ func sameAddressFamily(a string, b string) bool {
 }
 
 // sendPing sends a probe ping to a specified target
-func sendPing(source string, target string, count int, timeout int, udp bool) (*ping.Statistics, error) {
+func sendPing(source string, iface string, target string, count int, timeout int, interval time.Duration, udp bool) (*ping.Statistics, error) {
+	// Binding to an interface requires the system ping binary
+	if iface != "" {
+		return sendSystemPing(iface, target, count, timeout, interval)
+	}
+
 	pinger, err := ping.NewPinger(target)
 	if err != nil {
 		return &ping.Statistics{}, err
@@ -51,6 +81,9 @@ func sendPing(source string, target string, count int, timeout int, udp bool) (*
 	// Set pinger options
 	pinger.Count = count
 	pinger.Timeout = time.Duration(timeout) * time.Second
+	if interval > 0 {
+		pinger.Interval = interval
+	}
 	pinger.Source = source
 	pinger.SetNetwork("ip") // TODO: Is this needed?
 	pinger.SetPrivileged(!udp)
@@ -64,51 +97,125 @@ func sendPing(source string, target string, count int, timeout int, udp bool) (*
 	return pinger.Statistics(), nil // nil error
 }
 
+// probeInterface returns the outgoing interface for a peer's probe source, or an empty string if not set
+func probeInterface(peer *config.Peer, source string) string {
+	if peer == nil || peer.OptimizerProbeInterfaces == nil {
+		return ""
+	}
+	return (*peer.OptimizerProbeInterfaces)[source]
+}
+
+// addResult adds a probe result to a peer's cache, and returns true if the cache is full and the optimizer should exit
+func addResult(o *config.Optimizer, peerName string, source string, target string, stats *ping.Statistics) bool {
+	// Check for nil Db entries
+	if o.Db[peerName] == nil {
+		o.Db[peerName] = []config.ProbeResult{}
+	}
+
+	result := config.ProbeResult{
+		Time:  time.Now().UnixNano(),
+		Stats: *stats,
+	}
+
+	peerASN, name := parsePeerDelimiter(peerName)
+	if OnProbe != nil {
+		OnProbe(peerASN, name, source, target, result)
+	}
+	labels := metrics.Labels{"peer": name, "asn": peerASN, "source": source, "target": target}
+	metrics.Set("pathvector_optimizer_probe_latency_seconds", "Average probe round trip time", labels, stats.AvgRtt.Seconds())
+	metrics.Set("pathvector_optimizer_probe_jitter_seconds", "Probe round trip time standard deviation", labels, stats.StdDevRtt.Seconds())
+	metrics.Set("pathvector_optimizer_probe_packet_loss_percent", "Probe packet loss", labels, stats.PacketLoss)
+	metrics.Inc("pathvector_optimizer_probes_total", "Number of probe runs", labels)
+
+	logger.Debugf("[Optimizer] cache usage: %d/%d", len(o.Db[peerName]), o.CacheSize)
+
+	if len(o.Db[peerName]) < o.CacheSize {
+		// If the array is not full to CacheSize, append the result
+		o.Db[peerName] = append(o.Db[peerName], result)
+	} else {
+		// If the array is full to probeCacheSize...
+		if o.ExitOnCacheFull {
+			return true
+		}
+		// Chop off the first element and append the result
+		o.Db[peerName] = append(o.Db[peerName][1:], result)
+	}
+	return false
+}
+
 // StartProbe starts the probe scheduler to send probes to all configured targets and logs the results
 func StartProbe(o *config.Optimizer, sourceMap map[string][]string, global *config.Config, noConfigure bool, dryRun bool) error {
-	// Initialize Db map
+	// Initialize Db map from the last run
 	if o.Db == nil {
-		o.Db = map[string][]config.ProbeResult{} // peerName to list of probe results
+		db, err := loadDb(global.CacheDirectory, sourceMap, o.CacheSize)
+		if err != nil {
+			logger.Warnf("[Optimizer] Loading probe database: %v", err)
+			db = map[string][]config.ProbeResult{}
+		}
+		logger.Debugf("[Optimizer] Loaded probe results for %d peers", len(db))
+		o.Db = db // peerName to list of probe results
 	}
 
+	// Check the blackout windows are valid before probing
+	if _, err := blackout(o, time.Now()); err != nil {
+		return err
+	}
+
+	// Load depreferred peers from the last run
+	if o.Depreferred == nil && o.ReportOnly {
+		logger.Info("[Optimizer] Running in report-only mode, BIRD policy will not be modified")
+		o.Depreferred = map[string]int64{}
+	} else if o.Depreferred == nil {
+		state, err := loadState(global.CacheDirectory)
+		if err != nil {
+			logger.Warnf("[Optimizer] Loading depreferred peers: %v", err)
+			state = map[string]int64{}
+		}
+		o.Depreferred = state
+	}
+
+	for peer := range sourceMap {
+		peerASN, peerName := parsePeerDelimiter(peer)
+		for _, af := range families {
+			_, depreferred := o.Depreferred[familyKey(peer, af)]
+			metrics.Set("pathvector_optimizer_peer_depreferred", "Whether the peer is depreferred by the optimizer", metrics.Labels{"peer": peerName, "asn": peerASN, "af": af}, boolFloat(depreferred))
+		}
+	}
+
+	derived := &autoTargetCache{}
 	for {
-		// Loop over every source/target pair
+		// Collect every source/target pair
+		var jobs []*probeJob
 		for peerName, sources := range sourceMap {
-			for _, source := range sources {
-				for _, target := range o.Targets {
-					if sameAddressFamily(source, target) {
-						log.Debugf("[Optimizer] Sending %d ICMP probes src %s dst %s", o.PingCount, source, target)
-						stats, err := sendPing(source, target, o.PingCount, o.PingTimeout, o.ProbeUDPMode)
-						if err != nil {
-							return err
-						}
-
-						// Check for nil Db entries
-						if o.Db[peerName] == nil {
-							o.Db[peerName] = []config.ProbeResult{}
-						}
-
-						result := config.ProbeResult{
-							Time:  time.Now().UnixNano(),
-							Stats: *stats,
-						}
-
-						log.Debugf("[Optimizer] cache usage: %d/%d", len(o.Db[peerName]), o.CacheSize)
-
-						if len(o.Db[peerName]) < o.CacheSize {
-							// If the array is not full to CacheSize, append the result
-							o.Db[peerName] = append(o.Db[peerName], result)
-						} else {
-							// If the array is full to probeCacheSize...
-							if o.ExitOnCacheFull {
-								return nil
-							}
-							// Chop off the first element and append the result
-							o.Db[peerName] = append(o.Db[peerName][1:], result)
-						}
-					}
-				}
+			_, name := parsePeerDelimiter(peerName)
+
+			// Add targets derived from the peer's learned prefixes
+			targets := append([]string{}, o.Targets...)
+			if o.AutoTargets > 0 {
+				targets = append(targets, derived.get(o, name, global.Peers[name], global.BIRDSocket)...)
 			}
+			jobs = append(jobs, probeJobs(o, peerName, sources, global.Peers[name], targets)...)
+		}
+
+		// Skip targets that aren't routed via the peer, as their probes egress elsewhere
+		if o.VerifyRoutes {
+			jobs = routedJobs(o, jobs, global.Peers, global.BIRDSocket)
+		}
+
+		// Probe concurrently, then add the results in order
+		runJobs(o, jobs)
+		for _, job := range jobs {
+			if job.Err != nil {
+				return job.Err
+			}
+			if addResult(o, job.Peer, job.Source, job.Target, job.Stats) {
+				return nil
+			}
+		}
+
+		// Save probe results for the next run
+		if err := saveDb(global.CacheDirectory, o.Db); err != nil {
+			logger.Warnf("[Optimizer] Saving probe database: %v", err)
 		}
 
 		// Compute averages
@@ -116,105 +223,351 @@ func StartProbe(o *config.Optimizer, sourceMap map[string][]string, global *conf
 
 		// Sleep before sending the next probe
 		waitInterval := time.Duration(o.Interval) * time.Second
-		log.Debugf("[Optimizer] Waiting %s until next probe run", waitInterval)
+		logger.Debugf("[Optimizer] Waiting %s until next probe run", waitInterval)
 		time.Sleep(waitInterval)
 	}
 }
 
+// average calculates the latency, jitter, and packet loss of a set of chronological probe results, as an exponential moving average if alpha is set or a simple mean otherwise
+func average(results []config.ProbeResult, alpha float64) *peerAvg {
+	avg := &peerAvg{}
+	if len(results) == 0 {
+		return avg
+	}
+	if alpha > 0 {
+		avg.Latency = results[0].Stats.AvgRtt
+		avg.Jitter = results[0].Stats.StdDevRtt
+		avg.PacketLoss = results[0].Stats.PacketLoss
+		for _, result := range results[1:] {
+			avg.Latency = time.Duration(alpha*float64(result.Stats.AvgRtt) + (1-alpha)*float64(avg.Latency))
+			avg.Jitter = time.Duration(alpha*float64(result.Stats.StdDevRtt) + (1-alpha)*float64(avg.Jitter))
+			avg.PacketLoss = alpha*result.Stats.PacketLoss + (1-alpha)*avg.PacketLoss
+		}
+		return avg
+	}
+	for _, result := range results {
+		avg.PacketLoss += result.Stats.PacketLoss
+		avg.Latency += result.Stats.AvgRtt
+		avg.Jitter += result.Stats.StdDevRtt
+	}
+	avg.PacketLoss = avg.PacketLoss / float64(len(results))
+	avg.Latency = avg.Latency / time.Duration(len(results))
+	avg.Jitter = avg.Jitter / time.Duration(len(results))
+	return avg
+}
+
+// thresholds returns the thresholds for a target, preferring target over peer over global thresholds
+func thresholds(o *config.Optimizer, peer *config.Peer, target string) limits {
+	latency := o.LatencyThreshold
+	jitter := o.JitterThreshold
+	packetLoss := o.PacketLossThreshold
+	if peer != nil && peer.OptimizerLatencyThreshold != nil {
+		latency = *peer.OptimizerLatencyThreshold
+	}
+	if peer != nil && peer.OptimizerJitterThreshold != nil {
+		jitter = *peer.OptimizerJitterThreshold
+	}
+	if peer != nil && peer.OptimizerPacketLossThreshold != nil {
+		packetLoss = *peer.OptimizerPacketLossThreshold
+	}
+	for _, t := range o.ProbeTargets {
+		if targetString(t) == target {
+			if t.LatencyThreshold != 0 {
+				latency = t.LatencyThreshold
+			}
+			if t.JitterThreshold != 0 {
+				jitter = t.JitterThreshold
+			}
+			if t.PacketLossThreshold != 0 {
+				packetLoss = t.PacketLossThreshold
+			}
+		}
+	}
+	return limits{
+		Latency:    time.Duration(latency) * time.Millisecond,
+		Jitter:     time.Duration(jitter) * time.Millisecond,
+		PacketLoss: packetLoss,
+	}
+}
+
+// groupByTarget groups probe results by target, and returns the sorted list of targets
+func groupByTarget(results []config.ProbeResult) (map[string][]config.ProbeResult, []string) {
+	byTarget := map[string][]config.ProbeResult{}
+	var targets []string
+	for _, result := range results {
+		if byTarget[result.Stats.Addr] == nil {
+			targets = append(targets, result.Stats.Addr)
+		}
+		byTarget[result.Stats.Addr] = append(byTarget[result.Stats.Addr], result)
+	}
+	sort.Strings(targets)
+	return byTarget, targets
+}
+
+// belowRestoreThresholds returns true if all of a peer's targets are below their restore thresholds
+func belowRestoreThresholds(o *config.Optimizer, peer *config.Peer, results []config.ProbeResult) bool {
+	byTarget, targets := groupByTarget(results)
+	for _, target := range targets {
+		avg := average(byTarget[target], o.EWMAAlpha)
+		l := thresholds(o, peer, target)
+		// Restore thresholds can only be lower than the trip thresholds
+		if restore := time.Duration(o.RestoreLatencyThreshold) * time.Millisecond; restore != 0 && restore < l.Latency {
+			l.Latency = restore
+		}
+		if restore := time.Duration(o.RestoreJitterThreshold) * time.Millisecond; restore != 0 && restore < l.Jitter {
+			l.Jitter = restore
+		}
+		if o.RestorePacketLossThreshold != 0 && o.RestorePacketLossThreshold < l.PacketLoss {
+			l.PacketLoss = o.RestorePacketLossThreshold
+		}
+		if avg.Latency >= l.Latency || avg.PacketLoss >= l.PacketLoss || (l.Jitter != 0 && avg.Jitter >= l.Jitter) {
+			return false
+		}
+	}
+	return true
+}
+
+// alert stores a threshold violation for a single target
+type alert struct {
+	Target  string
+	Message string
+	Avg     *peerAvg
+}
+
+// checkThresholds returns alerts for each of a peer's targets that meets or exceeds its thresholds
+func checkThresholds(o *config.Optimizer, peer *config.Peer, peerASN string, peerName string, results []config.ProbeResult) []alert {
+	byTarget, targets := groupByTarget(results)
+	var alerts []alert
+	for _, target := range targets {
+		avg := average(byTarget[target], o.EWMAAlpha)
+		l := thresholds(o, peer, target)
+		if avg.PacketLoss >= l.PacketLoss {
+			alerts = append(alerts, alert{target, fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable packet loss to %s: %f >= %f",
+				peerASN, peerName, target, avg.PacketLoss, l.PacketLoss), avg})
+		}
+		if avg.Latency >= l.Latency {
+			alerts = append(alerts, alert{target, fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable latency to %s: %v >= %v",
+				peerASN, peerName, target, avg.Latency, l.Latency), avg})
+		}
+		if l.Jitter != 0 && avg.Jitter >= l.Jitter {
+			alerts = append(alerts, alert{target, fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable jitter to %s: %v >= %v",
+				peerASN, peerName, target, avg.Jitter, l.Jitter), avg})
+		}
+	}
+	return alerts
+}
+
 // computeMetrics calculates average latency and packet loss
 func computeMetrics(o *config.Optimizer, global *config.Config, noConfigure bool, dryRun bool) {
-	p := map[string]*peerAvg{}
+	window, err := blackout(o, time.Now())
+	if err != nil {
+		logger.Warnf("[Optimizer] Checking blackout windows: %v", err)
+	}
+	if window != nil {
+		logger.Infof("[Optimizer] In blackout window %s-%s %s, suppressing policy changes and alerts", window.Start, window.End, window.Description)
+	}
+	metrics.Set("pathvector_optimizer_blackout", "Whether the optimizer is in a blackout window", nil, boolFloat(window != nil))
+
 	for peer := range o.Db {
-		if p[peer] == nil {
-			p[peer] = &peerAvg{Latency: 0, PacketLoss: 0}
-		}
-		for result := range o.Db[peer] {
-			p[peer].PacketLoss += o.Db[peer][result].Stats.PacketLoss
-			p[peer].Latency += o.Db[peer][result].Stats.AvgRtt
+		for _, af := range families {
+			if results := familyResults(o, o.Db[peer], af); len(results) > 0 {
+				computeFamily(o, global, peer, af, results, window != nil, noConfigure, dryRun)
+			}
 		}
+	}
 
-		// Calculate average latency and packet loss
-		totalProbes := float64(len(o.Db[peer]))
-		p[peer].PacketLoss = p[peer].PacketLoss / totalProbes
-		p[peer].Latency = p[peer].Latency / time.Duration(totalProbes)
+	// Report-only decisions are never applied, so they aren't persisted
+	if o.ReportOnly {
+		return
+	}
+	if err := saveState(global.CacheDirectory, o.Depreferred); err != nil {
+		logger.Warnf("[Optimizer] Saving depreferred peers: %v", err)
+	}
+}
 
-		// Check thresholds to apply optimizations
-		var alerts []string
-		peerASN, peerName := parsePeerDelimiter(peer)
-		if p[peer].PacketLoss >= o.PacketLossThreshold {
-			alerts = append(alerts, fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable packet loss: %f >= %f",
-				peerASN, peerName, p[peer].PacketLoss, o.PacketLossThreshold))
-		}
-		if p[peer].Latency >= time.Duration(o.LatencyThreshold)*time.Millisecond {
-			alerts = append(alerts, fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable latency: %v >= %v",
-				peerASN, peerName, p[peer].Latency, o.LatencyThreshold))
-		}
-
-		// If there is at least one alert,
-		if len(alerts) > 0 {
-			for _, alert := range alerts {
-				log.Debugf("[Optimizer] %s", alert)
-				if o.AlertScript != "" {
-					birdCmd := exec.Command(o.AlertScript, alert)
-					birdCmd.Stdout = os.Stdout
-					birdCmd.Stderr = os.Stderr
-					if err := birdCmd.Run(); err != nil {
-						log.Warnf("[Optimizer] alert script: %v", err)
-					}
-				}
+// computeFamily checks a peer's probe results in a single address family and depreferences or restores that family unless suppressed
+func computeFamily(o *config.Optimizer, global *config.Config, peer string, af string, results []config.ProbeResult, suppressed bool, noConfigure bool, dryRun bool) {
+	avg := average(results, o.EWMAAlpha)
+	peerASN, peerName := parsePeerDelimiter(peer)
+	key := familyKey(peer, af)
+	labels := metrics.Labels{"peer": peerName, "asn": peerASN, "af": af}
+	metrics.Set("pathvector_optimizer_peer_latency_seconds", "Average latency over the probe cache", labels, avg.Latency.Seconds())
+	metrics.Set("pathvector_optimizer_peer_jitter_seconds", "Average jitter over the probe cache", labels, avg.Jitter.Seconds())
+	metrics.Set("pathvector_optimizer_peer_packet_loss_percent", "Average packet loss over the probe cache", labels, avg.PacketLoss)
+
+	// Check thresholds to apply optimizations
+	alerts := checkThresholds(o, global.Peers[peerName], peerASN, peerName, results)
+
+	metrics.Set("pathvector_optimizer_peer_threshold_exceeded", "Whether the peer currently exceeds a latency or packet loss threshold", labels, boolFloat(len(alerts) > 0))
+
+	if suppressed {
+		return
+	}
+
+	// If there is at least one alert,
+	if len(alerts) > 0 {
+		_, depreferred := o.Depreferred[key]
+
+		// Capture the path to each affected target when the peer is first depreferred
+		paths := map[string]string{}
+		if o.Traceroute && !depreferred {
+			paths = capturePaths(o, global.Peers[peerName], alerts)
+		}
+
+		for _, alert := range alerts {
+			logger.Debugf("[Optimizer] %s", alert.Message)
+			args := []string{alert.Message}
+			if trace, found := paths[alert.Target]; found {
+				args = append(args, trace)
+			}
+			RunAlertScript(o, args...)
+		}
+		action := actionAlert
+		if !depreferred {
+			action = actionDepreferred
+			o.Depreferred[key] = time.Now().Unix()
+			if o.ReportOnly {
+				logger.Infof("[Optimizer] Report-only: would deprefer AS%s %s IPv%s", peerASN, peerName, af)
+			} else {
+				metrics.Set("pathvector_optimizer_peer_depreferred", "Whether the peer is depreferred by the optimizer", labels, 1)
+				metrics.Inc("pathvector_optimizer_modifications_total", "Number of optimizer local pref modifications", labels)
+				modifyPref(peer, af, global.Peers, true, o, global, noConfigure, dryRun)
+			}
+		}
+		event := alertEvent(o, global.Hostname, peerASN, peerName, af, action, alerts, paths)
+		if action == actionDepreferred {
+			recordDecision(o, global.CacheDirectory, event)
+		}
+		notify(o, event, time.Unix(o.Depreferred[key], 0))
+	} else if since, depreferred := o.Depreferred[key]; depreferred {
+		// Restore the peer once it has been healthy for the hold time
+		held := time.Since(time.Unix(since, 0))
+		if held < time.Duration(o.HoldTime)*time.Second {
+			logger.Debugf("[Optimizer] Holding AS%s %s IPv%s depreferred for %s of %ds", peerASN, peerName, af, held.Round(time.Second), o.HoldTime)
+		} else if belowRestoreThresholds(o, global.Peers[peerName], results) {
+			delete(o.Depreferred, key)
+			if o.ReportOnly {
+				logger.Infof("[Optimizer] Report-only: would restore AS%s %s IPv%s", peerASN, peerName, af)
+			} else {
+				metrics.Set("pathvector_optimizer_peer_depreferred", "Whether the peer is depreferred by the optimizer", labels, 0)
+				metrics.Inc("pathvector_optimizer_modifications_total", "Number of optimizer local pref modifications", labels)
+				modifyPref(peer, af, global.Peers, false, o, global, noConfigure, dryRun)
 			}
-			modifyPref(peer,
-				global.Peers,
-				o.LocalPrefModifier,
-				global.CacheDirectory,
-				global.BIRDDirectory,
-				global.BIRDSocket,
-				global.BIRDBinary,
-				noConfigure,
-				dryRun,
-			)
-		}
-	}
-}
-
-func modifyPref(
-	peerPair string,
-	peers map[string]*config.Peer,
-	localPrefModifier uint,
-	cacheDirectory string,
-	birdDirectory string,
-	birdSocket string,
-	birdBinary string,
-	noConfigure bool,
-	dryRun bool,
-) {
+			event := restoreEvent(o, global.Hostname, peerASN, peerName, af, results)
+			recordDecision(o, global.CacheDirectory, event)
+			notify(o, event, time.Unix(since, 0))
+		}
+	}
+}
+
+// copyConfig copies BIRD config files from one directory to another
+func copyConfig(from string, to string) error {
+	files, err := filepath.Glob(path.Join(from, "*.conf"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		contents, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path.Join(to, filepath.Base(f)), contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
+
+// depreferredLocalPref returns a peer's local pref lowered by the peer or global modifier, limited to the peer's floor
+func depreferredLocalPref(o *config.Optimizer, peer *config.Peer) uint {
+	modifier := o.LocalPrefModifier
+	if peer.OptimizerModifier != nil {
+		modifier = *peer.OptimizerModifier
+	}
+	floor := uint(0)
+	if peer.OptimizerLocalPrefFloor != nil {
+		floor = *peer.OptimizerLocalPrefFloor
+	}
+	localPref := uint(*peer.LocalPref)
+	if localPref < floor+modifier {
+		return floor
+	}
+	return localPref - modifier
+}
+
+// exportRegex matches the optimizer's export policy line in an address family
+func exportRegex(af string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^([ \t]*).*# pathvector:optimizer-export:v` + af + `$`)
+}
+
+// exportPolicy returns the export filter statements for a depreferred peer
+func exportPolicy(peer *config.Peer) string {
+	policy := ""
+	if peer.OptimizerPrepends != nil {
+		policy += strings.Repeat("bgp_path.prepend(ASN); ", *peer.OptimizerPrepends)
+	}
+	if peer.OptimizerMED != nil {
+		policy += fmt.Sprintf("bgp_med = %d; ", *peer.OptimizerMED)
+	}
+	return policy
+}
+
+// modifyPref depreferences or restores a peer's inbound local pref and outbound export policy in an address family and reconfigures BIRD
+func modifyPref(peerPair string, af string, peers map[string]*config.Peer, depreferred bool, o *config.Optimizer, global *config.Config, noConfigure bool, dryRun bool) {
+	cacheDirectory := global.CacheDirectory
 	peerASN, peerName := parsePeerDelimiter(peerPair)
 	fileName := path.Join(cacheDirectory, fmt.Sprintf("AS%s_%s.conf", peerASN, *util.Sanitize(peerName)))
+
+	// The cache is moved into the BIRD directory on reconfigure, so copy the running config back first
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		if err := copyConfig(global.BIRDDirectory, cacheDirectory); err != nil {
+			logger.Fatal("copying BIRD config to cache: " + err.Error())
+		}
+	}
+
 	peerFile, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		log.Fatal("reading peer file: " + err.Error())
+		logger.Fatal("reading peer file: " + err.Error())
 	}
+	modified := string(peerFile)
 
 	peerData := peers[peerName]
 	if *peerData.OptimizeInbound {
 		// Calculate new local pref
 		currentLocalPref := *peerData.LocalPref
-		newLocalPref := uint(currentLocalPref) - localPrefModifier
+		newLocalPref := uint(currentLocalPref)
+		if depreferred {
+			newLocalPref = depreferredLocalPref(o, peerData)
+		}
 
-		lpRegex := regexp.MustCompile(`bgp_local_pref = .*; # pathvector:localpref`)
-		modified := lpRegex.ReplaceAllString(string(peerFile), fmt.Sprintf("bgp_local_pref = %d; # pathvector:localpref", newLocalPref))
+		lpRegex := regexp.MustCompile(`bgp_local_pref = .*; # pathvector:localpref:v` + af)
+		modified = lpRegex.ReplaceAllString(modified, fmt.Sprintf("bgp_local_pref = %d; # pathvector:localpref:v%s", newLocalPref, af))
+		logger.Printf("[Optimizer] Set AS%s %s IPv%s local-pref to %d (configured %d)", peerASN, peerName, af, newLocalPref, currentLocalPref)
+	}
 
-		if err := ioutil.WriteFile(fileName, []byte(modified), 0755); err != nil {
-			log.Fatal(err)
-		} else {
-			log.Printf("[Optimizer] Lowered AS%s %s local-pref from %d to %d", peerASN, peerName, currentLocalPref, newLocalPref)
+	if *peerData.OptimizeOutbound {
+		policy := ""
+		if depreferred {
+			policy = exportPolicy(peerData)
 		}
+		modified = exportRegex(af).ReplaceAllString(modified, "${1}"+policy+"# pathvector:optimizer-export:v"+af)
+		logger.Printf("[Optimizer] Set AS%s %s IPv%s export policy to '%s'", peerASN, peerName, af, strings.TrimSpace(policy))
+	}
+
+	// Keep the provenance header's hash in sync with the modified config
+	if err := ioutil.WriteFile(fileName, provenance.Seal([]byte(modified)), 0755); err != nil {
+		logger.Fatal(err)
 	}
 
 	// Run BIRD config validation
-	bird.Validate(birdBinary, cacheDirectory)
+	bird.Validate(global.BIRDBinary, cacheDirectory)
 
 	if !dryRun {
-		bird.MoveCacheAndReconfigure(birdDirectory, cacheDirectory, birdSocket, noConfigure)
+		if err := bird.MoveCacheAndReconfigure(global.BIRDDirectory, cacheDirectory, global.BIRDSocket, noConfigure); err != nil {
+			logger.Fatal(err)
+		}
 	}
 }
@@ -1,7 +1,22 @@
 package optimizer
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
 )
 
 func TestOptimizerSameAddressFamily(t *testing.T) {
@@ -22,3 +37,495 @@ func TestOptimizerSameAddressFamily(t *testing.T) {
 		}
 	}
 }
+
+func TestOptimizerStatistics(t *testing.T) {
+	s := statistics("192.0.2.1", 4, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond})
+	assert.Equal(t, float64(25), s.PacketLoss)
+	assert.Equal(t, 20*time.Millisecond, s.AvgRtt)
+	assert.Equal(t, 10*time.Millisecond, s.MinRtt)
+	assert.Equal(t, 30*time.Millisecond, s.MaxRtt)
+
+	s = statistics("192.0.2.1", 2, nil)
+	assert.Equal(t, float64(100), s.PacketLoss)
+}
+
+func TestOptimizerTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	s := sendProbe("127.0.0.1", "", config.ProbeTarget{Type: "tcp", Address: "127.0.0.1", Port: port}, 3, 1, 0)
+	assert.Equal(t, 3, s.PacketsRecv)
+	assert.Equal(t, float64(0), s.PacketLoss)
+}
+
+func TestOptimizerHTTPProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Host, "example.com:"))
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	target := config.ProbeTarget{Type: "http", Address: "127.0.0.1", Port: port, Path: "/health", Host: "example.com", ExpectedStatus: 200}
+	assert.Equal(t, float64(0), sendProbe("127.0.0.1", "", target, 2, 1, 0).PacketLoss)
+
+	target.Path = "/missing"
+	assert.Equal(t, float64(100), sendProbe("127.0.0.1", "", target, 2, 1, 0).PacketLoss)
+}
+
+func TestOptimizerDb(t *testing.T) {
+	dir := t.TempDir()
+	db, err := loadDb(dir, map[string][]string{}, 2)
+	assert.Nil(t, err)
+	assert.Len(t, db, 0)
+
+	assert.Nil(t, saveDb(dir, map[string][]config.ProbeResult{
+		"65510####Example": {{Time: 1}, {Time: 2}, {Time: 3}},
+		"65520####Removed": {{Time: 1}},
+	}))
+	db, err = loadDb(dir, map[string][]string{"65510####Example": {"192.0.2.1"}}, 2)
+	assert.Nil(t, err)
+	assert.Len(t, db, 1)
+	assert.Equal(t, []config.ProbeResult{{Time: 2}, {Time: 3}}, db["65510####Example"])
+}
+
+func TestOptimizerThresholds(t *testing.T) {
+	o := &config.Optimizer{
+		LatencyThreshold:    100,
+		PacketLossThreshold: 0.5,
+		ProbeTargets:        []config.ProbeTarget{{Type: "tcp", Address: "192.0.2.10", Port: 443, LatencyThreshold: 5}},
+	}
+	peerLatency := uint(200)
+	peer := &config.Peer{OptimizerLatencyThreshold: &peerLatency}
+
+	l := thresholds(o, nil, "192.0.2.20")
+	assert.Equal(t, 100*time.Millisecond, l.Latency)
+	assert.Equal(t, 0.5, l.PacketLoss)
+	assert.Equal(t, 200*time.Millisecond, thresholds(o, peer, "192.0.2.20").Latency)
+	assert.Equal(t, 5*time.Millisecond, thresholds(o, peer, "tcp://192.0.2.10:443").Latency)
+
+	results := []config.ProbeResult{
+		{Stats: ping.Statistics{Addr: "192.0.2.20", AvgRtt: 150 * time.Millisecond}},
+		{Stats: ping.Statistics{Addr: "tcp://192.0.2.10:443", AvgRtt: 10 * time.Millisecond}},
+	}
+	alerts := checkThresholds(o, peer, "65510", "Example", results)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "tcp://192.0.2.10:443", alerts[0].Target)
+}
+
+func TestOptimizerRestoreThresholds(t *testing.T) {
+	o := &config.Optimizer{LatencyThreshold: 100, PacketLossThreshold: 0.5, RestoreLatencyThreshold: 80}
+	results := func(latency time.Duration) []config.ProbeResult {
+		return []config.ProbeResult{{Stats: ping.Statistics{Addr: "192.0.2.20", AvgRtt: latency}}}
+	}
+	// Between the restore and trip thresholds
+	assert.False(t, belowRestoreThresholds(o, nil, results(90*time.Millisecond)))
+	assert.Len(t, checkThresholds(o, nil, "65510", "Example", results(90*time.Millisecond)), 0)
+	assert.True(t, belowRestoreThresholds(o, nil, results(70*time.Millisecond)))
+
+	// Restore thresholds can't be higher than the trip threshold
+	o.RestoreLatencyThreshold = 200
+	assert.False(t, belowRestoreThresholds(o, nil, results(150*time.Millisecond)))
+}
+
+func TestOptimizerState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := loadState(dir)
+	assert.Nil(t, err)
+	assert.Len(t, state, 0)
+
+	assert.Nil(t, saveState(dir, map[string]int64{"65510####Example####6": 1000}))
+	state, err = loadState(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"65510####Example####6": 1000}, state)
+
+	// State without address families is migrated to both
+	assert.Nil(t, saveState(dir, map[string]int64{"65510####Example": 1000}))
+	state, err = loadState(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"65510####Example####4": 1000, "65510####Example####6": 1000}, state)
+}
+
+func TestOptimizerCopyConfig(t *testing.T) {
+	from, to := t.TempDir(), path.Join(t.TempDir(), "cache")
+	assert.Nil(t, ioutil.WriteFile(path.Join(from, "AS65510_Example.conf"), []byte("protocol bgp"), 0644))
+	assert.Nil(t, ioutil.WriteFile(path.Join(from, "notes.txt"), []byte(""), 0644))
+	assert.Nil(t, copyConfig(from, to))
+	contents, err := ioutil.ReadFile(path.Join(to, "AS65510_Example.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "protocol bgp", string(contents))
+	assert.NoFileExists(t, path.Join(to, "notes.txt"))
+}
+
+func TestOptimizerEWMA(t *testing.T) {
+	results := []config.ProbeResult{
+		{Stats: ping.Statistics{AvgRtt: 10 * time.Millisecond}},
+		{Stats: ping.Statistics{AvgRtt: 10 * time.Millisecond}},
+		{Stats: ping.Statistics{AvgRtt: 110 * time.Millisecond, PacketLoss: 100}},
+	}
+	// A single bad round moves the simple mean more than a smoothed average
+	assert.Equal(t, 43333333*time.Nanosecond, average(results, 0).Latency)
+	avg := average(results, 0.2)
+	assert.Equal(t, 30*time.Millisecond, avg.Latency)
+	assert.InDelta(t, 20, avg.PacketLoss, 0.001)
+	assert.Equal(t, 110*time.Millisecond, average(results, 1).Latency)
+}
+
+func TestOptimizerJitter(t *testing.T) {
+	o := &config.Optimizer{LatencyThreshold: 100, PacketLossThreshold: 0.5}
+	results := []config.ProbeResult{{Stats: ping.Statistics{Addr: "192.0.2.20", AvgRtt: 20 * time.Millisecond, StdDevRtt: 15 * time.Millisecond}}}
+	// Jitter is ignored unless a threshold is set
+	assert.Len(t, checkThresholds(o, nil, "65510", "Example", results), 0)
+
+	jitter := uint(10)
+	peer := &config.Peer{OptimizerJitterThreshold: &jitter}
+	alerts := checkThresholds(o, peer, "65510", "Example", results)
+	assert.Len(t, alerts, 1)
+	assert.Contains(t, alerts[0].Message, "jitter")
+	assert.False(t, belowRestoreThresholds(o, peer, results))
+}
+
+func TestOptimizerCapturePaths(t *testing.T) {
+	binary := path.Join(t.TempDir(), "mtr")
+	assert.Nil(t, ioutil.WriteFile(binary, []byte("#!/bin/sh\necho \"$@\"\n"), 0755))
+
+	o := &config.Optimizer{
+		TracerouteBinary:  binary,
+		TracerouteCycles:  3,
+		TracerouteTimeout: 5,
+		ProbeTargets:      []config.ProbeTarget{{Type: "tcp", Address: "192.0.2.10", Port: 443}},
+	}
+	peer := &config.Peer{OptimizerProbeSources: &[]string{"192.0.2.1", "2001:db8::1"}}
+	paths := capturePaths(o, peer, []alert{{Target: "tcp://192.0.2.10:443"}, {Target: "tcp://192.0.2.10:443"}})
+	assert.Equal(t, "--report --no-dns --report-cycles 3 --address 192.0.2.1 192.0.2.10\n", paths["tcp://192.0.2.10:443"])
+
+	assert.Equal(t, []string{"-n", "-s", "192.0.2.1", "192.0.2.10"}, tracerouteArgs("/usr/bin/traceroute", 3, "192.0.2.1", "192.0.2.10"))
+}
+
+func TestOptimizerParseSystemPing(t *testing.T) {
+	s, err := parseSystemPing("192.0.2.10", `PING 192.0.2.10 (192.0.2.10) from 192.0.2.1 eth1: 56(84) bytes of data.
+64 bytes from 192.0.2.10: icmp_seq=1 ttl=64 time=1.50 ms
+
+--- 192.0.2.10 ping statistics ---
+4 packets transmitted, 3 received, 25% packet loss, time 3004ms
+rtt min/avg/max/mdev = 1.000/1.500/2.000/0.250 ms
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(25), s.PacketLoss)
+	assert.Equal(t, 1500*time.Microsecond, s.AvgRtt)
+	assert.Equal(t, 250*time.Microsecond, s.StdDevRtt)
+
+	s, err = parseSystemPing("192.0.2.10", "2 packets transmitted, 0 received, 100% packet loss, time 1001ms\n")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(100), s.PacketLoss)
+
+	_, err = parseSystemPing("192.0.2.10", "ping: SO_BINDTODEVICE eth9: No such device")
+	assert.NotNil(t, err)
+}
+
+func TestOptimizerProbeInterface(t *testing.T) {
+	assert.Equal(t, "", probeInterface(nil, "192.0.2.1"))
+	peer := &config.Peer{OptimizerProbeInterfaces: &map[string]string{"192.0.2.1": "eth1"}}
+	assert.Equal(t, "eth1", probeInterface(peer, "192.0.2.1"))
+	assert.Equal(t, "", probeInterface(peer, "192.0.2.2"))
+}
+
+func TestOptimizerExportPolicy(t *testing.T) {
+	prepends, med := 2, 500
+	policy := exportPolicy(&config.Peer{OptimizerPrepends: &prepends, OptimizerMED: &med})
+	assert.Equal(t, "bgp_path.prepend(ASN); bgp_path.prepend(ASN); bgp_med = 500; ", policy)
+
+	filter := "        export filter {\n            # pathvector:optimizer-export:v4\n            accept;\n"
+	modified := exportRegex("4").ReplaceAllString(filter, "${1}"+policy+"# pathvector:optimizer-export:v4")
+	assert.Contains(t, modified, "\n            bgp_path.prepend(ASN); bgp_path.prepend(ASN); bgp_med = 500; # pathvector:optimizer-export:v4\n")
+	assert.Equal(t, filter, exportRegex("4").ReplaceAllString(modified, "${1}# pathvector:optimizer-export:v4"))
+	assert.Equal(t, modified, exportRegex("6").ReplaceAllString(modified, "${1}# pathvector:optimizer-export:v6"))
+}
+
+func TestOptimizerDepreferredLocalPref(t *testing.T) {
+	o := &config.Optimizer{LocalPrefModifier: 20}
+	localPref, modifier, floor := 100, uint(60), uint(50)
+	peer := &config.Peer{LocalPref: &localPref}
+	assert.Equal(t, uint(80), depreferredLocalPref(o, peer))
+
+	peer.OptimizerModifier = &modifier
+	assert.Equal(t, uint(40), depreferredLocalPref(o, peer))
+
+	peer.OptimizerLocalPrefFloor = &floor
+	assert.Equal(t, uint(50), depreferredLocalPref(o, peer))
+
+	// Local pref can't wrap around
+	modifier = 200
+	peer.OptimizerLocalPrefFloor = nil
+	assert.Equal(t, uint(0), depreferredLocalPref(o, peer))
+}
+
+func TestOptimizerAutoTargets(t *testing.T) {
+	prefixes := parseRoutePrefixes(`0001 BIRD 2.0.7 ready.
+1007-Table master4:
+ 192.0.2.0/24         unicast [EXAMPLEv4 2021-06-11] * (100) [AS65510i]
+1007-198.51.100.0/24      unicast [EXAMPLEv4 2021-06-11] * (100) [AS65510i]
+ 	via 203.0.113.1 on eth0
+                     unicast [EXAMPLEv4_1 2021-06-11] (100) [AS65510i]
+1007-203.0.113.0/25       unicast [EXAMPLEv4 2021-06-11] * (100) [AS65510i]
+ 2001:db8::/32        unicast [EXAMPLEv6 2021-06-11] * (100) [AS65510i]
+0000
+`)
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/25", "2001:db8::/32"}, prefixes)
+
+	assert.Equal(t, []string{"192.0.2.1", "198.51.100.1"}, pickTargets(prefixes[:3], 2, 1))
+	assert.Equal(t, []string{"192.0.2.1", "198.51.100.1", "203.0.113.1"}, pickTargets(prefixes[:3], 3, 1))
+	assert.Equal(t, []string{"2001:db8::1"}, pickTargets(prefixes[3:], 5, 1))
+
+	_, err := hostAddress("192.0.2.0/30", 4)
+	assert.NotNil(t, err)
+	host, err := hostAddress("192.0.2.0/24", 255)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.255", host)
+}
+
+func TestOptimizerNotify(t *testing.T) {
+	var event Event
+	var body string
+	var alerts []amAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/alerts" {
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&alerts))
+		} else {
+			b, err := ioutil.ReadAll(r.Body)
+			assert.Nil(t, err)
+			body = string(b)
+			assert.Nil(t, json.Unmarshal(b, &event))
+		}
+	}))
+	defer server.Close()
+
+	o := &config.Optimizer{WebhookURL: server.URL + "/hook", AlertmanagerURL: server.URL + "/", AlertTimeout: 5}
+	avg := &peerAvg{Latency: 150 * time.Millisecond, PacketLoss: 10}
+	notify(o, alertEvent(o, "router1", "65510", "Example", "4", actionDepreferred, []alert{
+		{Target: "192.0.2.1", Message: "latency", Avg: avg},
+		{Target: "192.0.2.1", Message: "packet loss", Avg: avg},
+	}, map[string]string{"192.0.2.1": "path"}), time.Now())
+
+	assert.Equal(t, "Example", event.Peer)
+	assert.Equal(t, actionDepreferred, event.Action)
+	assert.Len(t, event.Targets, 2)
+	assert.Equal(t, float64(150), event.Targets[0].LatencyMs)
+	assert.Equal(t, "path", event.Targets[0].Path)
+	assert.Contains(t, body, `"report-only":false`)
+	assert.Contains(t, body, `"latency-ms":150`)
+
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "192.0.2.1", alerts[0].Labels["target"])
+	assert.Equal(t, "latency\npacket loss", alerts[0].Annotations["description"])
+	assert.Nil(t, alerts[0].EndsAt)
+
+	notify(o, restoreEvent(o, "router1", "65510", "Example", "4", []config.ProbeResult{{Stats: ping.Statistics{Addr: "192.0.2.1", AvgRtt: time.Millisecond}}}), time.Now())
+	assert.Equal(t, actionRestored, event.Action)
+	assert.Len(t, alerts, 1)
+	assert.NotNil(t, alerts[0].EndsAt)
+}
+
+func TestOptimizerReportOnly(t *testing.T) {
+	dir := t.TempDir()
+	o := &config.Optimizer{
+		LatencyThreshold:    100,
+		PacketLossThreshold: 0.5,
+		ReportOnly:          true,
+		Db: map[string][]config.ProbeResult{
+			"65510" + Delimiter + "Example": {{Stats: ping.Statistics{Addr: "192.0.2.20", AvgRtt: 150 * time.Millisecond}}},
+		},
+		Depreferred: map[string]int64{},
+	}
+	global := &config.Config{CacheDirectory: dir, Peers: map[string]*config.Peer{}}
+
+	// The peer file doesn't exist, so modifying BIRD policy would exit
+	computeMetrics(o, global, true, true)
+	assert.Contains(t, o.Depreferred, familyKey("65510"+Delimiter+"Example", "4"))
+	assert.NotContains(t, o.Depreferred, familyKey("65510"+Delimiter+"Example", "6"))
+	_, err := ioutil.ReadFile(path.Join(dir, stateFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOptimizerStatus(t *testing.T) {
+	dir := t.TempDir()
+	peer := "65510" + Delimiter + "Example"
+	sourceMap := map[string][]string{peer: {"192.0.2.1"}, "65520" + Delimiter + "Other": {"192.0.2.1"}}
+	assert.Nil(t, saveDb(dir, map[string][]config.ProbeResult{
+		peer:                          {{Stats: ping.Statistics{Addr: "192.0.2.20", AvgRtt: 150 * time.Millisecond}}},
+		"65520" + Delimiter + "Other": {{Stats: ping.Statistics{Addr: "2001:db8::20", AvgRtt: time.Millisecond}}},
+	}))
+	assert.Nil(t, saveState(dir, map[string]int64{familyKey(peer, "4"): 1600000000}))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, saveDecision(dir, Event{Peer: "Example", ASN: "65510", Family: "4", Action: actionDepreferred, Targets: []EventTarget{{Target: "192.0.2.20", Message: "latency"}}}, 2))
+	}
+
+	status, err := GetStatus(&config.Optimizer{CacheSize: 15}, sourceMap, &config.Config{CacheDirectory: dir})
+	assert.Nil(t, err)
+	assert.Len(t, status.Decisions, 2)
+	assert.Len(t, status.Peers, 2)
+	assert.Equal(t, "Example", status.Peers[0].Peer)
+	assert.Equal(t, "4", status.Peers[0].Family)
+	assert.True(t, status.Peers[0].Depreferred)
+	assert.Equal(t, 150*time.Millisecond, status.Peers[0].Latency)
+	assert.Equal(t, []string{"latency"}, status.Peers[0].Reasons)
+	assert.Equal(t, "6", status.Peers[1].Family)
+	assert.False(t, status.Peers[1].Depreferred)
+}
+
+func TestOptimizerFamilies(t *testing.T) {
+	o := &config.Optimizer{ProbeTargets: []config.ProbeTarget{{Type: "tcp", Address: "2001:db8::1", Port: 443}}}
+	assert.Equal(t, "4", targetFamily(o, "192.0.2.1"))
+	assert.Equal(t, "6", targetFamily(o, "2001:db8::2"))
+	assert.Equal(t, "6", targetFamily(o, "tcp://[2001:db8::1]:443"))
+	assert.Equal(t, "4", targetFamily(o, "https://192.0.2.1:443/health"))
+
+	results := []config.ProbeResult{{Stats: ping.Statistics{Addr: "192.0.2.1"}}, {Stats: ping.Statistics{Addr: "tcp://[2001:db8::1]:443"}}}
+	assert.Len(t, familyResults(o, results, "4"), 1)
+	assert.Len(t, familyResults(o, results, "6"), 1)
+
+	peer, af := parseFamilyKey(familyKey("65510"+Delimiter+"Example", "6"))
+	assert.Equal(t, "65510"+Delimiter+"Example", peer)
+	assert.Equal(t, "6", af)
+	_, af = parseFamilyKey("65510" + Delimiter + "Example")
+	assert.Equal(t, "", af)
+}
+
+func TestOptimizerProbeJobs(t *testing.T) {
+	o := &config.Optimizer{
+		PingCount:        1,
+		PingTimeout:      1,
+		ProbeConcurrency: 4,
+		ProbeTargets:     []config.ProbeTarget{{Type: "tcp", Address: "127.0.0.1", Port: 1}, {Type: "tcp", Address: "2001:db8::1", Port: 1}},
+	}
+	jobs := probeJobs(o, "65510"+Delimiter+"Example", []string{"127.0.0.1"}, nil, []string{"192.0.2.1", "2001:db8::2"})
+	assert.Len(t, jobs, 2)
+	assert.Nil(t, jobs[0].Probe)
+	assert.Equal(t, "tcp://127.0.0.1:1", jobs[1].Target)
+
+	runJobs(o, jobs[1:])
+	assert.Equal(t, float64(100), jobs[1].Stats.PacketLoss)
+}
+
+func TestOptimizerRoutedJobs(t *testing.T) {
+	socket := path.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("0001 BIRD 2.0.8 ready.\n"))
+			buf := make([]byte, 1024)
+			n, _ := conn.Read(buf)
+			if strings.Contains(string(buf[:n]), "192.0.2.1 ") {
+				_, _ = conn.Write([]byte("1007-Table master4:\n192.0.2.0/24         unicast [EXAMPLEv4 2021-01-01] * (100) [AS65510i]\n0000 \n"))
+			} else {
+				_, _ = conn.Write([]byte("0000 \n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	name := "EXAMPLE"
+	peers := map[string]*config.Peer{"Example": {ProtocolName: &name}}
+	jobs := []*probeJob{
+		{Peer: "65510" + Delimiter + "Example", Source: "192.0.2.100", Target: "192.0.2.1"},
+		{Peer: "65510" + Delimiter + "Example", Source: "192.0.2.101", Target: "192.0.2.1"},
+		{Peer: "65510" + Delimiter + "Example", Source: "192.0.2.100", Target: "198.51.100.1"},
+	}
+	routed := routedJobs(&config.Optimizer{}, jobs, peers, socket)
+	assert.Len(t, routed, 2)
+	assert.Equal(t, "192.0.2.1", routed[1].Target)
+}
+
+func TestOptimizerAutoTargetCache(t *testing.T) {
+	socket := path.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	defer l.Close()
+	var queries int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&queries, 1)
+			_, _ = conn.Write([]byte("0001 BIRD 2.0.8 ready.\n"))
+			buf := make([]byte, 1024)
+			n, _ := conn.Read(buf)
+			if strings.Contains(string(buf[:n]), "EXAMPLEv4") {
+				_, _ = conn.Write([]byte("1007-Table master4:\n192.0.2.0/24         unicast [EXAMPLEv4 2021-01-01] * (100) [AS65510i]\n0000 \n"))
+			} else {
+				_, _ = conn.Write([]byte("0000 \n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	name := "EXAMPLE"
+	peer := &config.Peer{ProtocolName: &name}
+	o := &config.Optimizer{AutoTargets: 1, AutoTargetOffset: 1, AutoTargetRefresh: 3600}
+	cache := &autoTargetCache{}
+	assert.Equal(t, []string{"192.0.2.1"}, cache.get(o, "Example", peer, socket))
+	assert.Equal(t, []string{"192.0.2.1"}, cache.get(o, "Example", peer, socket))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries)) // One query per address family
+
+	// The targets are derived again once the cache expires
+	cache.refreshed = time.Now().Add(-time.Hour)
+	assert.Equal(t, []string{"192.0.2.1"}, cache.get(o, "Example", peer, socket))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&queries))
+}
+
+func TestOptimizerBlackout(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		assert.Nil(t, err)
+		return ts
+	}
+	testCases := []struct {
+		window config.BlackoutWindow
+		now    string
+		active bool
+	}{
+		{config.BlackoutWindow{Start: "2021-06-01T02:00:00Z", End: "2021-06-01T04:00:00Z"}, "2021-06-01T03:00:00Z", true},
+		{config.BlackoutWindow{Start: "2021-06-01T02:00:00Z", End: "2021-06-01T04:00:00Z"}, "2021-06-01T04:00:00Z", false},
+		{config.BlackoutWindow{Start: "02:00", End: "04:00"}, "2021-06-01T02:30:00Z", true},
+		{config.BlackoutWindow{Start: "02:00", End: "04:00", Days: []string{"mon"}}, "2021-06-01T02:30:00Z", false}, // Tuesday
+		{config.BlackoutWindow{Start: "23:00", End: "01:00", Days: []string{"Monday"}}, "2021-06-01T00:30:00Z", true},
+		{config.BlackoutWindow{Start: "23:00", End: "01:00", Days: []string{"tue"}}, "2021-06-01T00:30:00Z", false},
+		{config.BlackoutWindow{Start: "23:00", End: "01:00", Days: []string{"tue"}}, "2021-06-01T23:30:00Z", true},
+	}
+	for _, tc := range testCases {
+		active, err := windowActive(tc.window, at(tc.now))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.active, active, "%+v at %s", tc.window, tc.now)
+	}
+
+	_, err := windowActive(config.BlackoutWindow{Start: "2am", End: "04:00"}, time.Now())
+	assert.NotNil(t, err)
+	_, err = windowActive(config.BlackoutWindow{Start: "02:00", End: "04:00", Days: []string{"someday"}}, time.Now())
+	assert.NotNil(t, err)
+
+	o := &config.Optimizer{BlackoutWindows: []config.BlackoutWindow{{Start: "02:00", End: "04:00", Description: "maintenance"}}}
+	window, err := blackout(o, at("2021-06-01T03:00:00Z"))
+	assert.Nil(t, err)
+	assert.Equal(t, "maintenance", window.Description)
+}
@@ -0,0 +1,205 @@
+package optimizer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-ping/ping"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// targetPort returns a probe target's port, defaulting by probe type
+func targetPort(t config.ProbeTarget) int {
+	if t.Port != 0 {
+		return t.Port
+	}
+	switch t.Type {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
+
+// targetString formats a probe target for logging
+func targetString(t config.ProbeTarget) string {
+	if t.Type == "icmp" {
+		return t.Address
+	}
+	addr := net.JoinHostPort(t.Address, strconv.Itoa(targetPort(t)))
+	if t.Type == "tcp" {
+		return "tcp://" + addr
+	}
+	return t.Type + "://" + addr + t.Path
+}
+
+// statistics builds ping statistics from a set of probe round trip times
+func statistics(addr string, sent int, rtts []time.Duration) *ping.Statistics {
+	s := &ping.Statistics{
+		Addr:        addr,
+		PacketsSent: sent,
+		PacketsRecv: len(rtts),
+		Rtts:        rtts,
+	}
+	if sent > 0 {
+		s.PacketLoss = float64(sent-len(rtts)) / float64(sent) * 100
+	}
+	if len(rtts) == 0 {
+		return s
+	}
+
+	s.MinRtt = rtts[0]
+	var total time.Duration
+	for _, rtt := range rtts {
+		total += rtt
+		if rtt < s.MinRtt {
+			s.MinRtt = rtt
+		}
+		if rtt > s.MaxRtt {
+			s.MaxRtt = rtt
+		}
+	}
+	s.AvgRtt = total / time.Duration(len(rtts))
+
+	var variance float64
+	for _, rtt := range rtts {
+		variance += math.Pow(float64(rtt-s.AvgRtt), 2)
+	}
+	s.StdDevRtt = time.Duration(math.Sqrt(variance / float64(len(rtts))))
+	return s
+}
+
+// dialer returns a dialer bound to a source address and optionally an interface
+func dialer(source string, iface string, timeout int) *net.Dialer {
+	d := &net.Dialer{
+		Timeout:   time.Duration(timeout) * time.Second,
+		LocalAddr: &net.TCPAddr{IP: net.ParseIP(source)},
+	}
+	if iface != "" {
+		d.Control = bindToDevice(iface)
+	}
+	return d
+}
+
+// probeTCP measures TCP connection setup time to a target
+func probeTCP(source string, iface string, t config.ProbeTarget, timeout int) (time.Duration, error) {
+	start := time.Now()
+	conn, err := dialer(source, iface, timeout).Dial("tcp", net.JoinHostPort(t.Address, strconv.Itoa(targetPort(t))))
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	return rtt, conn.Close()
+}
+
+// probeHTTP measures the time to receive an HTTP response from a target
+func probeHTTP(source string, iface string, t config.ProbeTarget, timeout int) (time.Duration, error) {
+	host := t.Host
+	if host == "" {
+		host = t.Address
+	}
+	addr := net.JoinHostPort(t.Address, strconv.Itoa(targetPort(t)))
+	d := dialer(source, iface, timeout)
+	client := &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+		Transport: &http.Transport{
+			// Always connect to the target address, regardless of the host header
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig:   &tls.Config{ServerName: host, InsecureSkipVerify: t.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Get(t.Type + "://" + net.JoinHostPort(host, strconv.Itoa(targetPort(t))) + t.Path)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != t.ExpectedStatus {
+		return 0, fmt.Errorf("expected HTTP %d, got %d", t.ExpectedStatus, resp.StatusCode)
+	}
+	return rtt, nil // nil error
+}
+
+// sendProbe sends count TCP or HTTP probes to a target from a source address and optional interface
+func sendProbe(source string, iface string, t config.ProbeTarget, count int, timeout int, interval time.Duration) *ping.Statistics {
+	var rtts []time.Duration
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		var rtt time.Duration
+		var err error
+		if t.Type == "tcp" {
+			rtt, err = probeTCP(source, iface, t, timeout)
+		} else {
+			rtt, err = probeHTTP(source, iface, t, timeout)
+		}
+		if err != nil {
+			logger.Debugf("[Optimizer] %s probe src %s dst %s failed: %v", t.Type, source, targetString(t), err)
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+	return statistics(targetString(t), count, rtts)
+}
+
+var (
+	pingSummaryRegex = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingRttRegex     = regexp.MustCompile(`= ([\d.]+)/([\d.]+)/([\d.]+)/([\d.]+) ms`)
+)
+
+// parseSystemPing parses the output of the system ping binary
+func parseSystemPing(target string, output string) (*ping.Statistics, error) {
+	summary := pingSummaryRegex.FindStringSubmatch(output)
+	if summary == nil {
+		return nil, fmt.Errorf("unable to parse ping output: %s", output)
+	}
+	sent, _ := strconv.Atoi(summary[1])
+	received, _ := strconv.Atoi(summary[2])
+	s := &ping.Statistics{Addr: target, PacketsSent: sent, PacketsRecv: received}
+	if sent > 0 {
+		s.PacketLoss = float64(sent-received) / float64(sent) * 100
+	}
+
+	if rtt := pingRttRegex.FindStringSubmatch(output); rtt != nil {
+		ms := func(v string) time.Duration {
+			f, _ := strconv.ParseFloat(v, 64)
+			return time.Duration(f * float64(time.Millisecond))
+		}
+		s.MinRtt, s.AvgRtt, s.MaxRtt, s.StdDevRtt = ms(rtt[1]), ms(rtt[2]), ms(rtt[3]), ms(rtt[4])
+	}
+	return s, nil
+}
+
+// sendSystemPing sends pings bound to an interface with the system ping binary
+func sendSystemPing(iface string, target string, count int, timeout int, interval time.Duration) (*ping.Statistics, error) {
+	args := []string{"-n", "-c", strconv.Itoa(count), "-W", strconv.Itoa(timeout), "-I", iface}
+	if interval > 0 {
+		args = append(args, "-i", strconv.FormatFloat(interval.Seconds(), 'f', 3, 64))
+	}
+	// ping exits non-zero when packets are lost, so only the output is checked
+	out, _ := exec.Command("ping", append(args, target)...).CombinedOutput()
+	return parseSystemPing(target, string(out))
+}
@@ -0,0 +1,77 @@
+package optimizer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// probeJob stores a single source/target pair to probe
+type probeJob struct {
+	Peer   string
+	Source string
+	Iface  string
+	Target string
+	Probe  *config.ProbeTarget // nil for ICMP/UDP targets
+
+	Stats *ping.Statistics
+	Err   error
+}
+
+// probeJobs returns the source/target pairs to probe for a peer
+func probeJobs(o *config.Optimizer, peer string, sources []string, p *config.Peer, targets []string) []*probeJob {
+	var jobs []*probeJob
+	for _, source := range sources {
+		iface := probeInterface(p, source)
+		for _, target := range targets {
+			if sameAddressFamily(source, target) {
+				jobs = append(jobs, &probeJob{Peer: peer, Source: source, Iface: iface, Target: target})
+			}
+		}
+		for i := range o.ProbeTargets {
+			target := &o.ProbeTargets[i]
+			if sameAddressFamily(source, target.Address) {
+				jobs = append(jobs, &probeJob{Peer: peer, Source: source, Iface: iface, Target: targetString(*target), Probe: target})
+			}
+		}
+	}
+	return jobs
+}
+
+// run sends the probes for a job
+func (j *probeJob) run(o *config.Optimizer) {
+	pacing := time.Duration(o.ProbePacing) * time.Millisecond
+	if j.Probe == nil {
+		logger.Debugf("[Optimizer] Sending %d ICMP probes src %s dst %s", o.PingCount, j.Source, j.Target)
+		j.Stats, j.Err = sendPing(j.Source, j.Iface, j.Target, o.PingCount, o.PingTimeout, pacing, o.ProbeUDPMode)
+	} else if j.Probe.Type == "icmp" {
+		logger.Debugf("[Optimizer] Sending %d icmp probes src %s dst %s", o.PingCount, j.Source, j.Target)
+		j.Stats, j.Err = sendPing(j.Source, j.Iface, j.Probe.Address, o.PingCount, o.PingTimeout, pacing, o.ProbeUDPMode)
+	} else {
+		logger.Debugf("[Optimizer] Sending %d %s probes src %s dst %s", o.PingCount, j.Probe.Type, j.Source, j.Target)
+		j.Stats = sendProbe(j.Source, j.Iface, *j.Probe, o.PingCount, o.PingTimeout, pacing)
+	}
+}
+
+// runJobs runs probe jobs with at most o.ProbeConcurrency running at once
+func runJobs(o *config.Optimizer, jobs []*probeJob) {
+	concurrency := o.ProbeConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(job *probeJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			job.run(o)
+		}(job)
+	}
+	wg.Wait()
+}
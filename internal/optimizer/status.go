@@ -0,0 +1,102 @@
+package optimizer
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// PeerStatus stores the current optimizer measurements and state of an address family of a peer
+type PeerStatus struct {
+	Peer        string
+	ASN         string
+	Family      string
+	Probes      int
+	Latency     time.Duration
+	Jitter      time.Duration
+	PacketLoss  float64
+	Depreferred bool
+	Since       time.Time
+	Reasons     []string
+}
+
+// Status stores the optimizer state read from the cache directory
+type Status struct {
+	Peers     []PeerStatus
+	Decisions []Event
+}
+
+// recordDecision saves a depreference or restore decision to the history
+func recordDecision(o *config.Optimizer, cacheDirectory string, e Event) {
+	if err := saveDecision(cacheDirectory, e, o.DecisionHistory); err != nil {
+		logger.Warnf("[Optimizer] Saving decision history: %v", err)
+	}
+}
+
+// GetStatus reads the optimizer's probe database, depreferred peers and decision history from the cache directory
+func GetStatus(o *config.Optimizer, sourceMap map[string][]string, global *config.Config) (*Status, error) {
+	db, err := loadDb(global.CacheDirectory, sourceMap, o.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(global.CacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := loadDecisions(global.CacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the most recent depreference reasons for each peer
+	reasons := map[string][]string{}
+	for _, e := range decisions {
+		if e.Action != actionDepreferred || e.ReportOnly {
+			continue
+		}
+		var messages []string
+		for _, t := range e.Targets {
+			messages = append(messages, t.Message)
+		}
+		reasons[familyKey(e.ASN+Delimiter+e.Peer, e.Family)] = messages
+	}
+
+	status := &Status{Decisions: decisions}
+	for peer := range sourceMap {
+		peerASN, peerName := parsePeerDelimiter(peer)
+		for _, af := range families {
+			key := familyKey(peer, af)
+			results := familyResults(o, db[peer], af)
+			since, depreferred := state[key]
+			if len(results) == 0 && !depreferred {
+				continue
+			}
+			avg := average(results, o.EWMAAlpha)
+			s := PeerStatus{
+				Peer:       peerName,
+				ASN:        peerASN,
+				Family:     af,
+				Probes:     len(results),
+				Latency:    avg.Latency,
+				Jitter:     avg.Jitter,
+				PacketLoss: avg.PacketLoss,
+			}
+			if depreferred {
+				s.Depreferred = true
+				s.Since = time.Unix(since, 0)
+				s.Reasons = reasons[key]
+			}
+			status.Peers = append(status.Peers, s)
+		}
+	}
+	sort.Slice(status.Peers, func(i, j int) bool {
+		a, b := strings.ToLower(status.Peers[i].Peer), strings.ToLower(status.Peers[j].Peer)
+		if a == b {
+			return status.Peers[i].Family < status.Peers[j].Family
+		}
+		return a < b
+	})
+	return status, nil // nil error
+}
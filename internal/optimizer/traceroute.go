@@ -0,0 +1,73 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// targetAddress returns the IP address of a probe target string
+func targetAddress(o *config.Optimizer, target string) string {
+	for _, t := range o.ProbeTargets {
+		if targetString(t) == target {
+			return t.Address
+		}
+	}
+	return target
+}
+
+// tracerouteArgs returns the arguments to capture a path with mtr or traceroute
+func tracerouteArgs(binary string, cycles int, source string, target string) []string {
+	if strings.HasPrefix(filepath.Base(binary), "traceroute") {
+		return []string{"-n", "-s", source, target}
+	}
+	return []string{"--report", "--no-dns", "--report-cycles", strconv.Itoa(cycles), "--address", source, target}
+}
+
+// traceroute captures the path from a source address to a target
+func traceroute(o *config.Optimizer, source string, target string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.TracerouteTimeout)*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, o.TracerouteBinary, tracerouteArgs(o.TracerouteBinary, o.TracerouteCycles, source, target)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v: %s", o.TracerouteBinary, err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil // nil error
+}
+
+// capturePaths captures the path from each of a peer's probe sources to each alerting target, and returns a map of target to paths
+func capturePaths(o *config.Optimizer, peer *config.Peer, alerts []alert) map[string]string {
+	paths := map[string]string{}
+	if peer == nil || peer.OptimizerProbeSources == nil {
+		return paths
+	}
+	for _, a := range alerts {
+		if _, found := paths[a.Target]; found {
+			continue
+		}
+		address := targetAddress(o, a.Target)
+		var out []string
+		for _, source := range *peer.OptimizerProbeSources {
+			if !sameAddressFamily(source, address) {
+				continue
+			}
+			path, err := traceroute(o, source, address)
+			if err != nil {
+				logger.Warnf("[Optimizer] Capturing path from %s to %s: %v", source, address, err)
+				continue
+			}
+			logger.Infof("[Optimizer] Path from %s to %s:\n%s", source, address, path)
+			out = append(out, path)
+		}
+		if len(out) > 0 {
+			paths[a.Target] = strings.Join(out, "\n")
+		}
+	}
+	return paths
+}
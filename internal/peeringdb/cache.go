@@ -0,0 +1,98 @@
+package peeringdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Cache stores PeeringDB responses on disk so runs can skip queries while responses are fresh, or never query PeeringDB when offline
+type Cache struct {
+	Directory string
+	TTL       time.Duration // Cached responses newer than this are used without querying (never if 0)
+	Offline   bool          // Only use cached responses regardless of age
+}
+
+// cacheEntry is a cached PeeringDB response
+type cacheEntry struct {
+	Endpoint string          `json:"endpoint"`
+	Time     time.Time       `json:"time"`
+	Response json.RawMessage `json:"response"`
+}
+
+// file returns the cache file of an API endpoint
+func (c *Cache) file(endpoint string) string {
+	name := strings.NewReplacer("/", "_", "?", "_", "=", "_", "&", "_").Replace(strings.TrimPrefix(endpoint, "/api/"))
+	return path.Join(c.Directory, name+".json")
+}
+
+// read returns a cached response, or nil if the endpoint isn't cached
+func (c *Cache) read(endpoint string) *cacheEntry {
+	contents, err := ioutil.ReadFile(c.file(endpoint))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(contents, &entry); err != nil {
+		logger.Warnf("Ignoring invalid PeeringDB cache file %s: %v", c.file(endpoint), err)
+		return nil
+	}
+	if entry.Endpoint != endpoint {
+		return nil
+	}
+	return &entry
+}
+
+// write caches a response, replacing the cache file atomically so concurrent queries never read a partial file
+func (c *Cache) write(entry *cacheEntry) error {
+	if err := os.MkdirAll(c.Directory, 0755); err != nil {
+		return fmt.Errorf("PeeringDB cache directory: %v", err)
+	}
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.Directory, ".peeringdb-")
+	if err != nil {
+		return fmt.Errorf("PeeringDB cache file: %v", err)
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing PeeringDB cache file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing PeeringDB cache file: %v", err)
+	}
+	return os.Rename(tmp.Name(), c.file(entry.Endpoint))
+}
+
+// get returns a response from the cache if it's within the TTL or the cache is offline, otherwise queries PeeringDB and caches the response
+func (c *Cache) get(endpoint string, queryTimeout uint) ([]byte, error) {
+	cached := c.read(endpoint)
+	if cached != nil && (c.Offline || (c.TTL > 0 && time.Since(cached.Time) < c.TTL)) {
+		logger.Debugf("Using cached PeeringDB response for %s from %s", endpoint, cached.Time.Format(time.RFC3339))
+		return cached.Response, nil
+	}
+	if c.Offline {
+		return nil, fmt.Errorf("PeeringDB response for %s isn't cached (offline)", endpoint)
+	}
+
+	body, err := Get(endpoint, queryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// Invalid responses aren't cached, and fail to unmarshal in the caller
+	if !json.Valid(body) {
+		return body, nil
+	}
+	if err := c.write(&cacheEntry{Endpoint: endpoint, Time: time.Now(), Response: body}); err != nil {
+		logger.Warnf("Caching PeeringDB response for %s: %v", endpoint, err)
+	}
+	return body, nil // nil error
+}
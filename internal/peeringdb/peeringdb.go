@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +16,9 @@ import (
 	"github.com/natesales/pathvector/internal/config"
 )
 
+// logger tags log entries from this package so its log level can be set separately
+var logger = log.WithField("module", "peeringdb")
+
 // Response contains the response from a PeeringDB query
 type Response struct {
 	Data []Data `json:"data"`
@@ -28,27 +33,94 @@ type Data struct {
 	ImportLimit6 int    `json:"info_prefixes6"`
 }
 
-// NetworkInfo returns PeeringDB for an ASN
-func NetworkInfo(asn uint, queryTimeout uint) (*Data, error) {
-	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://peeringdb.com/api/net?asn=%d", asn), nil)
-	if err != nil {
-		return nil, errors.New("PeeringDB GET (This peer might not have a PeeringDB page): " + err.Error())
+// peeringDBURL is the PeeringDB API base URL, a variable for testing
+var peeringDBURL = "https://peeringdb.com"
+
+// apiKeyEnv is the environment variable holding the PeeringDB API key if none is configured
+const apiKeyEnv = "PEERINGDB_API_KEY"
+
+// apiKey authenticates PeeringDB queries if set
+var apiKey string
+
+// maxRetries is the number of times a rate limited query is retried
+const maxRetries = 5
+
+// retryDelay is the initial delay before retrying a rate limited query if PeeringDB doesn't send a Retry-After header, doubling on each retry
+var retryDelay = 2 * time.Second
+
+// SetAPIKey sets the API key of PeeringDB queries, falling back to the PEERINGDB_API_KEY environment variable if empty
+func SetAPIKey(key string) {
+	if key == "" {
+		key = os.Getenv(apiKeyEnv)
 	}
+	apiKey = key
+}
 
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, errors.New("PeeringDB GET request: " + err.Error())
+// retryAfter returns the delay requested by a Retry-After header in seconds, or fallback if it's missing or invalid
+func retryAfter(header string, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || seconds < 0 {
+		return fallback
 	}
+	return time.Duration(seconds) * time.Second
+}
 
-	if res.Body != nil {
+// Get runs a PeeringDB API query such as /api/net?asn=112 and returns the response body, retrying with backoff if the query is rate limited
+func Get(endpoint string, queryTimeout uint) ([]byte, error) {
+	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, peeringDBURL+endpoint, nil)
+		if err != nil {
+			return nil, errors.New("PeeringDB GET: " + err.Error())
+		}
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Api-Key "+apiKey)
+		}
+
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return nil, errors.New("PeeringDB GET request: " + err.Error())
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
 		//noinspection GoUnhandledErrorResult
-		defer res.Body.Close()
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.New("PeeringDB read: " + err.Error())
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			wait := retryAfter(res.Header.Get("Retry-After"), delay)
+			logger.Warnf("PeeringDB rate limited %s, retrying in %s (%d/%d)", endpoint, wait, attempt+1, maxRetries)
+			time.Sleep(wait)
+			delay *= 2
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			if res.StatusCode == http.StatusTooManyRequests && apiKey == "" {
+				return nil, fmt.Errorf("PeeringDB GET request: %s (set peeringdb-api-key or %s for a higher rate limit)", res.Status, apiKeyEnv)
+			}
+			return nil, fmt.Errorf("PeeringDB GET request: %s", res.Status)
+		}
+
+		return body, nil // nil error
 	}
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+// query runs a PeeringDB API query, using cached responses if cache isn't nil
+func query(endpoint string, queryTimeout uint, cache *Cache) ([]byte, error) {
+	if cache == nil {
+		return Get(endpoint, queryTimeout)
+	}
+	return cache.get(endpoint, queryTimeout)
+}
+
+// NetworkInfo returns PeeringDB for an ASN, using cached responses if cache isn't nil
+func NetworkInfo(asn uint, queryTimeout uint, cache *Cache) (*Data, error) {
+	body, err := query(fmt.Sprintf("/api/net?asn=%d", asn), queryTimeout, cache)
 	if err != nil {
-		return nil, errors.New("PeeringDB read: " + err.Error())
+		return nil, err
 	}
 
 	var pDbResponse Response
@@ -63,11 +135,11 @@ func NetworkInfo(asn uint, queryTimeout uint) (*Data, error) {
 	return &pDbResponse.Data[0], nil // nil error
 }
 
-// Update updates peer values from PeeringDB
-func Update(peerData *config.Peer, queryTimeout uint) {
-	pDbData, err := NetworkInfo(uint(*peerData.ASN), queryTimeout)
+// Update updates peer values from PeeringDB, using cached responses if cache isn't nil
+func Update(peerData *config.Peer, queryTimeout uint, cache *Cache) error {
+	pDbData, err := NetworkInfo(uint(*peerData.ASN), queryTimeout, cache)
 	if err != nil {
-		log.Fatalf("unable to get PeeringDB data: %+v", err)
+		return fmt.Errorf("unable to get PeeringDB data: %v", err)
 	}
 
 	// Set import limits
@@ -76,17 +148,17 @@ func Update(peerData *config.Peer, queryTimeout uint) {
 		peerData.ImportLimit6 = &pDbData.ImportLimit6
 
 		if pDbData.ImportLimit4 == 0 {
-			log.Warnf("peer AS%d has an IPv4 import limit of zero from PeeringDB", *peerData.ASN)
+			logger.Warnf("peer AS%d has an IPv4 import limit of zero from PeeringDB", *peerData.ASN)
 		}
 		if pDbData.ImportLimit6 == 0 {
-			log.Warnf("peer AS%d has an IPv6 import limit of zero from PeeringDB", *peerData.ASN)
+			logger.Warnf("peer AS%d has an IPv6 import limit of zero from PeeringDB", *peerData.ASN)
 		}
 	}
 
 	// Set as-set if auto-as-set is enabled and there isn't a manual AS set defined
 	if *peerData.AutoASSet && peerData.ASSet == nil {
 		if pDbData.ASSet == "" {
-			log.Warnf("peer AS%d doesn't have an as-set in PeeringDB, using ASN instead", *peerData.ASN)
+			logger.Warnf("peer AS%d doesn't have an as-set in PeeringDB, using ASN instead", *peerData.ASN)
 			pDbData.ASSet = fmt.Sprintf("AS%d", *peerData.ASN)
 		}
 
@@ -94,27 +166,15 @@ func Update(peerData *config.Peer, queryTimeout uint) {
 		asSetOutput := sanitizeASSet(pDbData.ASSet)
 		peerData.ASSet = &asSetOutput
 	}
-}
 
-// NeverViaRouteServers gets a list of networks that report should never be reachable via route servers
-func NeverViaRouteServers(queryTimeout uint) ([]uint32, error) {
-	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
-	req, err := http.NewRequest(http.MethodGet, "https://peeringdb.com/api/net?info_never_via_route_servers=1", nil)
-	if err != nil {
-		return nil, errors.New("PeeringDB GET: " + err.Error())
-	}
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, errors.New("PeeringDB GET request: " + err.Error())
-	}
-	if res.Body != nil {
-		//noinspection GoUnhandledErrorResult
-		defer res.Body.Close()
-	}
+	return nil // nil error
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+// NeverViaRouteServers gets a list of networks that report should never be reachable via route servers, using cached responses if cache isn't nil
+func NeverViaRouteServers(queryTimeout uint, cache *Cache) ([]uint32, error) {
+	body, err := query("/api/net?info_never_via_route_servers=1", queryTimeout, cache)
 	if err != nil {
-		return nil, errors.New("PeeringDB read: " + err.Error())
+		return nil, err
 	}
 
 	var pDbResponse Response
@@ -137,13 +197,13 @@ func sanitizeASSet(asSet string) string {
 	// If the as-set has a space in it, split and pick the first one
 	if strings.Contains(output, " ") {
 		output = strings.Split(output, " ")[0]
-		log.Warnf("Original as-set %s has a space in it. Selecting first element %s", asSet, output)
+		logger.Warnf("Original as-set %s has a space in it. Selecting first element %s", asSet, output)
 	}
 
 	// Trim IRRDB prefix
 	if strings.Contains(output, "::") {
 		output = strings.Split(output, "::")[1]
-		log.Warnf("Original as-set %s has an IRRDB prefix in it. Using %s", asSet, output)
+		logger.Warnf("Original as-set %s has an IRRDB prefix in it. Using %s", asSet, output)
 	}
 
 	return output
@@ -1,11 +1,16 @@
 package peeringdb
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
 	"github.com/natesales/pathvector/internal/config"
 	"github.com/natesales/pathvector/internal/util"
 	"github.com/stretchr/testify/assert"
-	"strings"
-	"testing"
 )
 
 const peeringDbQueryTimeout = 10 // 10 seconds
@@ -25,7 +30,7 @@ func TestPeeringDbQuery(t *testing.T) {
 		{65530, "RIPE::RS-KROOT RIPE::RS-KROOT-V6", "RIPE NCC K-Root Operations", 5, 5, true}, // Private ASN, no PeeringDB page
 	}
 	for _, tc := range testCases {
-		pDbData, err := NetworkInfo(uint(tc.asn), peeringDbQueryTimeout)
+		pDbData, err := NetworkInfo(uint(tc.asn), peeringDbQueryTimeout, nil)
 		if err != nil && !tc.shouldError {
 			t.Error(err)
 		}
@@ -56,7 +61,7 @@ func TestPeeringDbQuery(t *testing.T) {
 }
 
 func TestPeeringDbNoPage(t *testing.T) {
-	_, err := NetworkInfo(65530, peeringDbQueryTimeout)
+	_, err := NetworkInfo(65530, peeringDbQueryTimeout, nil)
 	if err == nil || !strings.Contains(err.Error(), "doesn't have a PeeringDB page") {
 		t.Errorf("expected PeeringDB page not exist error, got %v", err)
 	}
@@ -71,18 +76,18 @@ func TestPeeringDbQueryAndModify(t *testing.T) {
 		{112, false},
 	}
 	for _, tc := range testCases {
-		Update(&config.Peer{
+		assert.Nil(t, Update(&config.Peer{
 			ASN:              util.IntPtr(tc.asn),
 			AutoImportLimits: util.BoolPtr(tc.auto),
 			AutoASSet:        util.BoolPtr(tc.auto),
 			ImportLimit4:     util.IntPtr(0),
 			ImportLimit6:     util.IntPtr(0),
-		}, peeringDbQueryTimeout)
+		}, peeringDbQueryTimeout, nil))
 	}
 }
 
 func TestPeeringNeverViaRouteServers(t *testing.T) {
-	asns, err := NeverViaRouteServers(peeringDbQueryTimeout)
+	asns, err := NeverViaRouteServers(peeringDbQueryTimeout, nil)
 	assert.Nil(t, err)
 	assert.Greater(t, len(asns), 100)
 }
@@ -103,3 +108,76 @@ func TestSanitizeASSet(t *testing.T) {
 		}
 	}
 }
+
+func TestCache(t *testing.T) {
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		fmt.Fprintf(w, `{"data": [{"name": "Example %d", "asn": 65530, "irr_as_set": "AS65530:AS-EXAMPLE", "info_prefixes4": 10, "info_prefixes6": 5}]}`, queries)
+	}))
+	defer server.Close()
+	defaultURL := peeringDBURL
+	peeringDBURL = server.URL
+	defer func() { peeringDBURL = defaultURL }()
+
+	// Fresh responses are served from the cache
+	cache := &Cache{Directory: t.TempDir(), TTL: time.Hour}
+	for i := 0; i < 2; i++ {
+		info, err := NetworkInfo(65530, peeringDbQueryTimeout, cache)
+		assert.Nil(t, err)
+		assert.Equal(t, "Example 1", info.Name)
+	}
+	assert.Equal(t, 1, queries)
+
+	// Expired responses are queried again
+	cache.TTL = time.Nanosecond
+	info, err := NetworkInfo(65530, peeringDbQueryTimeout, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, "Example 2", info.Name)
+
+	// Offline caches use responses regardless of age and never query
+	cache.Offline = true
+	info, err = NetworkInfo(65530, peeringDbQueryTimeout, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, "Example 2", info.Name)
+	_, err = NetworkInfo(65531, peeringDbQueryTimeout, cache)
+	if err == nil || !strings.Contains(err.Error(), "isn't cached (offline)") {
+		t.Errorf("expected offline error, got %v", err)
+	}
+	assert.Equal(t, 2, queries)
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	limited := 2
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if limited > 0 {
+			limited--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"name": "Example", "asn": 65530}]}`)
+	}))
+	defer server.Close()
+	defaultURL, defaultDelay := peeringDBURL, retryDelay
+	peeringDBURL, retryDelay = server.URL, time.Millisecond
+	defer func() { peeringDBURL, retryDelay = defaultURL, defaultDelay; SetAPIKey("") }()
+
+	// Rate limited queries are retried with the API key
+	SetAPIKey("example-key")
+	info, err := NetworkInfo(65530, peeringDbQueryTimeout, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Example", info.Name)
+	assert.Equal(t, "Api-Key example-key", authorization)
+
+	// Queries fail once the retries are exhausted
+	limited = maxRetries + 1
+	SetAPIKey("")
+	_, err = NetworkInfo(65530, peeringDbQueryTimeout, nil)
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("expected rate limit error, got %v", err)
+	}
+	assert.Equal(t, "", authorization)
+}
@@ -5,16 +5,17 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"github.com/natesales/pathvector/internal/bird"
 	"io"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/natesales/pathvector/internal/bird"
 	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/pkg/birdc"
 )
 
 // session stores a portal BGP session
@@ -25,55 +26,75 @@ type session struct {
 	LocalIP    string `json:"local-ip"`
 	NeighborIP string `json:"neighbor-ip"`
 	State      string `json:"state"`
+
+	Protocol         string `json:"protocol"`
+	Info             string `json:"info"`
+	Since            string `json:"since"`
+	ImportedPrefixes int    `json:"imported-prefixes"`
+	FilteredPrefixes int    `json:"filtered-prefixes"`
+	ExportedPrefixes int    `json:"exported-prefixes"`
+	Updated          string `json:"updated"`
 }
 
-// Record records a peer session to the peering portal server
-func Record(host string, key string, routerHostname string, peers map[string]*config.Peer, birdSocket string) error {
-	// Get protocols
-	protocols, err := bird.RunCommand("show protocols", birdSocket)
-	if err != nil {
-		return err
+// protocolStatus stores the live state of a BIRD protocol
+type protocolStatus struct {
+	State    string
+	Since    string
+	Info     string
+	Imported int
+	Filtered int
+	Exported int
+}
+
+// parseProtocols parses BGP protocols from the output of show protocols
+func parseProtocols(output string) map[string]*protocolStatus {
+	protocols := map[string]*protocolStatus{}
+	for name, p := range birdc.ParseProtocols(output) {
+		if p.Proto != "BGP" {
+			continue
+		}
+		protocols[name] = &protocolStatus{State: strings.Title(p.State), Since: p.Since, Info: p.Info}
 	}
+	return protocols
+}
 
-	var sessions []session
-	for name, peer := range peers {
-		for _, neighborIP := range *peer.NeighborIPs {
-			log.Debugf("Adding %s", neighborIP)
-			localIP := ""
-			if strings.Contains(neighborIP, ":") { // If IPv6
-				if peer.Listen6 != nil {
-					localIP = *peer.Listen6
-				}
-			} else { // If IPv4
-				if peer.Listen4 != nil {
-					localIP = *peer.Listen4
-				}
-			}
-			// Get session state
-			state := "UNKNOWN"
-			for _, line := range strings.Split(strings.TrimSuffix(protocols, "\n"), "\n") {
-				line = strings.TrimSpace(line)
-				if strings.Contains(line, *peer.ProtocolName) {
-					line = strings.Split(line, "BGP ")[1]
-					line = strings.ReplaceAll(line, "---", "")
-					line = strings.Title(line)
-					space := regexp.MustCompile(`\s+`)
-					state = space.ReplaceAllString(line, " ")
-					break
-				}
-			}
-			sessions = append(sessions, session{
-				Name:       name,
-				Router:     routerHostname,
-				ASN:        uint32(*peer.ASN),
-				LocalIP:    localIP,
-				NeighborIP: neighborIP,
-				State:      state,
-			})
+// parseRoutes parses the route counts from the output of show protocols all
+func parseRoutes(output string, status *protocolStatus) {
+	for _, p := range birdc.ParseProtocols(output) {
+		for _, channel := range p.Channels {
+			status.Imported += channel.Routes.Imported
+			status.Filtered += channel.Routes.Filtered
+			status.Exported += channel.Routes.Exported
 		}
 	}
+}
+
+// protocolName returns the BIRD protocol name generated for a peer's neighbor
+func protocolName(peer *config.Peer, neighborIP string) string {
+	if peer.NeighborProtocols != nil {
+		if protocol, found := (*peer.NeighborProtocols)[neighborIP]; found {
+			return protocol
+		}
+	}
+	// The peer hasn't been rendered, so assume its first protocol for the address family
+	af := "4"
+	if strings.Contains(neighborIP, ":") {
+		af = "6"
+	}
+	return peer.FamilyProtocolName(af)
+}
 
-	jsonValue, err := json.Marshal(sessions)
+// newClient returns an HTTP client for the portal server with its own transport, leaving http.DefaultTransport untouched
+func newClient(insecureSkipVerify bool) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipVerify},
+	}}
+}
+
+// post sends an authenticated JSON request to the portal server
+func post(host string, key string, path string, body interface{}) error {
+	jsonValue, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
@@ -81,7 +102,7 @@ func Record(host string, key string, routerHostname string, peers map[string]*co
 	if err != nil {
 		return err
 	}
-	u.Path = "/session"
+	u.Path = path
 	log.Debugf("Posting %s", jsonValue)
 	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonValue))
 	if err != nil {
@@ -89,19 +110,75 @@ func Record(host string, key string, routerHostname string, peers map[string]*co
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", key)
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := newClient(true).Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	respText, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode != 200 {
-		defer resp.Body.Close()
 		return fmt.Errorf("portal server: %s", respText)
 	}
-
 	return nil
 }
+
+// Record records peer sessions and their live state to the peering portal server
+func Record(host string, key string, routerHostname string, peers map[string]*config.Peer, birdSocket string) error {
+	// Get protocols
+	protocolsOutput, err := bird.RunCommand("show protocols", birdSocket)
+	if err != nil {
+		return err
+	}
+	protocols := parseProtocols(protocolsOutput)
+	updated := time.Now().Format(time.RFC3339)
+
+	var sessions []session
+	for name, peer := range peers {
+		for _, neighborIP := range *peer.NeighborIPs {
+			log.Debugf("Adding %s", neighborIP)
+			localIP := ""
+			if strings.Contains(neighborIP, ":") { // If IPv6
+				if peer.Listen6 != nil {
+					localIP = *peer.Listen6
+				}
+			} else { // If IPv4
+				if peer.Listen4 != nil {
+					localIP = *peer.Listen4
+				}
+			}
+
+			s := session{
+				Name:       name,
+				Router:     routerHostname,
+				ASN:        uint32(*peer.ASN),
+				LocalIP:    localIP,
+				NeighborIP: neighborIP,
+				State:      "UNKNOWN",
+				Protocol:   protocolName(peer, neighborIP),
+				Updated:    updated,
+			}
+
+			// Get session state and prefix counts
+			if status, found := protocols[s.Protocol]; found {
+				detail, err := bird.RunCommand("show protocols all "+s.Protocol, birdSocket)
+				if err != nil {
+					log.Warnf("[%s] getting protocol details: %v", s.Protocol, err)
+				} else {
+					parseRoutes(detail, status)
+				}
+				s.State = status.State
+				s.Info = status.Info
+				s.Since = status.Since
+				s.ImportedPrefixes = status.Imported
+				s.FilteredPrefixes = status.Filtered
+				s.ExportedPrefixes = status.Exported
+			}
+			sessions = append(sessions, s)
+		}
+	}
+
+	return post(host, key, "/session", sessions)
+}
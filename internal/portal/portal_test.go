@@ -1,3 +1,146 @@
 package portal
 
-// TODO
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+func TestParseProtocols(t *testing.T) {
+	protocols := parseProtocols(`0001 BIRD 2.0.7 ready.
+2002-Name       Proto      Table      State  Since         Info
+1002-device1    Device     ---        up     2021-06-11 01:59:05
+ EXAMPLEv4  BGP        ---        up     2021-06-11 02:00:00  Established
+ EXAMPLEv6  BGP        ---        start  2021-06-11 02:00:00  Active        Socket: Connection refused
+0000
+`)
+	assert.Len(t, protocols, 2)
+	assert.Equal(t, "Up", protocols["EXAMPLEv4"].State)
+	assert.Equal(t, "Established", protocols["EXAMPLEv4"].Info)
+	assert.Contains(t, protocols["EXAMPLEv4"].Since, "2021-06-11T02:00:00")
+	assert.Equal(t, "Active Socket: Connection refused", protocols["EXAMPLEv6"].Info)
+}
+
+func TestParseRoutes(t *testing.T) {
+	status := &protocolStatus{}
+	parseRoutes(`2002-Name       Proto      Table      State  Since         Info
+1002-EXAMPLEv4  BGP        ---        up     2021-06-11 02:00:00  Established
+1006-  BGP state:          Established
+    Channel ipv4
+      State:          UP
+      Routes:         15 imported, 2 filtered, 4 exported, 10 preferred
+`, status)
+	assert.Equal(t, 15, status.Imported)
+	assert.Equal(t, 2, status.Filtered)
+	assert.Equal(t, 4, status.Exported)
+}
+
+func TestProtocolName(t *testing.T) {
+	peer := &config.Peer{ProtocolName: util.StrPtr("EXAMPLE")}
+	assert.Equal(t, "EXAMPLEv6", protocolName(peer, "2001:db8::1"))
+	peer.NeighborProtocols = &map[string]string{"192.0.2.1": "EXAMPLEv4", "192.0.2.2": "EXAMPLEv4_1"}
+	assert.Equal(t, "EXAMPLEv4_1", protocolName(peer, "192.0.2.2"))
+	assert.Equal(t, "EXAMPLEv6", protocolName(peer, "2001:db8::1"))
+}
+
+func TestPost(t *testing.T) {
+	var received []session
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/session", r.URL.Path)
+		assert.Equal(t, "example-key", r.Header.Get("Authorization"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	assert.Nil(t, post(server.URL, "example-key", "/session", []session{{Name: "Example", ImportedPrefixes: 15}}))
+	assert.Equal(t, 15, received[0].ImportedPrefixes)
+}
+
+func TestProvision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/request", r.URL.Path)
+		assert.Equal(t, "approved", r.URL.Query().Get("status"))
+		assert.Equal(t, "rtr1", r.URL.Query().Get("router"))
+		fmt.Fprint(w, `[
+{"id": 1, "name": "Example", "asn": 65510, "neighbor-ips": ["192.0.2.10"], "as-set": "AS-EXAMPLE"},
+{"id": 2, "asn": 65520, "neighbor-ips": ["192.0.2.20"]},
+{"id": 3, "name": "Existing", "asn": 65540, "neighbor-ips": ["192.0.2.40"]},
+{"id": 4, "name": "Leak", "asn": 65550, "neighbor-ips": ["192.0.2.50"], "template": "accept-any"},
+{"id": 5, "name": "Customer", "asn": 65560, "neighbor-ips": ["192.0.2.60"], "template": "customer"}
+]`)
+	}))
+	defer server.Close()
+
+	stateFile := path.Join(t.TempDir(), "confirmed.json")
+	c, err := config.Load([]byte(fmt.Sprintf(`
+asn: 65530
+router-id: 192.0.2.1
+hostname: rtr1
+portal-host: %s
+portal-provision:
+  enabled: true
+  template: upstream
+  templates: [customer]
+  require-confirmation: true
+  state-file: %s
+templates:
+  upstream:
+    filter-irr: true
+  customer:
+    filter-irr: false
+  accept-any:
+    filter-irr: false
+peers:
+  Existing:
+    asn: 65540
+    neighbors: [192.0.2.40]
+`, server.URL, stateFile)))
+	assert.Nil(t, err)
+
+	// Nothing is added until confirmed
+	assert.Nil(t, Provision(c))
+	assert.Len(t, c.Peers, 1)
+
+	assert.Nil(t, Confirm(stateFile, []int{1}))
+	assert.Nil(t, Provision(c))
+	assert.Len(t, c.Peers, 2)
+	assert.Equal(t, "AS-EXAMPLE", *c.Peers["Example"].ASSet)
+	assert.True(t, *c.Peers["Example"].FilterIRR)
+	assert.NotContains(t, c.Peers, "AS65520")
+
+	// Requests can only select allowed templates
+	assert.Nil(t, Confirm(stateFile, []int{4, 5}))
+	assert.Nil(t, Provision(c))
+	assert.NotContains(t, c.Peers, "Leak")
+	assert.Equal(t, "customer", *c.Peers["Customer"].Template)
+
+	// Without allowed templates, the template of a request is ignored
+	peer, err := requestToPeer(Request{Name: "Leak", Template: "accept-any"}, "upstream", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "upstream", *peer.Template)
+}
+
+func TestRequestsTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "asn": 65510, "neighbor-ips": ["192.0.2.10"]}]`)
+	}))
+	defer server.Close()
+
+	// The server's self-signed certificate is rejected unless verification is skipped
+	_, err := Requests(server.URL, "example-key", "rtr1", false)
+	assert.NotNil(t, err)
+	requests, err := Requests(server.URL, "example-key", "rtr1", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "AS65510", requests[0].Name)
+	if tlsConfig := http.DefaultTransport.(*http.Transport).TLSClientConfig; tlsConfig != nil && tlsConfig.InsecureSkipVerify {
+		t.Error("expected http.DefaultTransport to verify TLS certificates")
+	}
+}
@@ -0,0 +1,175 @@
+package portal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Request stores an approved peering request from the portal
+type Request struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	ASN         int      `json:"asn"`
+	NeighborIPs []string `json:"neighbor-ips"`
+	ASSet       string   `json:"as-set"`
+	Template    string   `json:"template"`
+}
+
+// Requests gets the approved peering requests for a router from the portal server
+func Requests(host string, key string, routerHostname string, insecureSkipVerify bool) ([]Request, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/request"
+	u.RawQuery = url.Values{"status": {"approved"}, "router": {routerHostname}}.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", key)
+	resp, err := newClient(insecureSkipVerify).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("portal server: %s", respText)
+	}
+
+	var requests []Request
+	if err := json.Unmarshal(respText, &requests); err != nil {
+		return nil, fmt.Errorf("portal requests JSON unmarshal: %v", err)
+	}
+	for i := range requests {
+		if requests[i].Name == "" {
+			requests[i].Name = fmt.Sprintf("AS%d", requests[i].ASN)
+		}
+	}
+	return requests, nil
+}
+
+// Confirmed loads the confirmed request IDs from a state file
+func Confirmed(stateFile string) (map[int]bool, error) {
+	confirmed := map[int]bool{}
+	contents, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return confirmed, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ids []int
+	if err := json.Unmarshal(contents, &ids); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", stateFile, err)
+	}
+	for _, id := range ids {
+		confirmed[id] = true
+	}
+	return confirmed, nil
+}
+
+// Confirm adds request IDs to the confirmed state file
+func Confirm(stateFile string, ids []int) error {
+	confirmed, err := Confirmed(stateFile)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		confirmed[id] = true
+	}
+	var all []int
+	for id := range confirmed {
+		all = append(all, id)
+	}
+	sort.Ints(all)
+	contents, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(stateFile), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stateFile, contents, 0644)
+}
+
+// requestToPeer builds a peer from a request, using the template of the request only if it's allowed
+func requestToPeer(r Request, defaultTemplate string, allowedTemplates []string) (*config.Peer, error) {
+	asn := r.ASN
+	neighbors := r.NeighborIPs
+	peer := &config.Peer{ASN: &asn, NeighborIPs: &neighbors}
+	if r.ASSet != "" {
+		asSet := r.ASSet
+		peer.ASSet = &asSet
+	}
+	template := defaultTemplate
+	if r.Template != "" {
+		if len(allowedTemplates) == 0 {
+			log.Debugf("[%s] ignoring template %s of portal request %d, no templates are allowed", r.Name, r.Template, r.ID)
+		} else if !util.Contains(allowedTemplates, r.Template) {
+			return nil, fmt.Errorf("template %s isn't allowed", r.Template)
+		} else {
+			template = r.Template
+		}
+	}
+	if template != "" {
+		peer.Template = &template
+	}
+	return peer, nil // nil error
+}
+
+// Provision adds approved (and if required, confirmed) peering requests to the config
+func Provision(c *config.Config) error {
+	requests, err := Requests(c.PortalHost, c.PortalKey, c.Hostname, c.PortalProvision.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	confirmed := map[int]bool{}
+	if c.PortalProvision.RequireConfirmation {
+		confirmed, err = Confirmed(c.PortalProvision.StateFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	added := 0
+	for _, r := range requests {
+		if _, exists := c.Peers[r.Name]; exists {
+			log.Debugf("[%s] portal request %d is already configured", r.Name, r.ID)
+			continue
+		}
+		if c.PortalProvision.RequireConfirmation && !confirmed[r.ID] {
+			log.Infof("[%s] portal request %d (AS%d) is waiting for confirmation", r.Name, r.ID, r.ASN)
+			continue
+		}
+		peer, err := requestToPeer(r, c.PortalProvision.Template, c.PortalProvision.Templates)
+		if err != nil {
+			log.Warnf("[%s] skipping portal request %d: %v", r.Name, r.ID, err)
+			continue
+		}
+		if peer.Template != nil && c.Templates[*peer.Template] == nil {
+			return fmt.Errorf("portal request %d uses template %s which doesn't exist", r.ID, *peer.Template)
+		}
+		if err := c.AddPeer(r.Name, peer); err != nil {
+			return fmt.Errorf("adding portal request %d: %v", r.ID, err)
+		}
+		added++
+	}
+	log.Infof("Added %d peers from portal requests", added)
+	return nil
+}
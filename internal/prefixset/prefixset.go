@@ -0,0 +1,423 @@
+package prefixset
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// entry is a prefix with the range of prefix lengths it matches, like a BIRD prefix pattern
+type entry struct {
+	hi, lo uint64 // Network address, IPv4 addresses are stored in the high 32 bits of hi
+	length uint8
+	min    uint8
+	max    uint8
+}
+
+// Set is a compact set of prefix patterns for a single address family. Reads sort the set in place, so it isn't safe for concurrent use
+type Set struct {
+	bits    uint8 // 32 for IPv4, 128 for IPv6, 0 until the first prefix is added
+	entries []entry
+	sorted  bool // entries are sorted and deduplicated
+}
+
+// New creates a set from a list of prefixes
+func New(prefixes ...string) (*Set, error) {
+	s := &Set{}
+	for _, prefix := range prefixes {
+		if err := s.Add(prefix); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil // nil error
+}
+
+// parse parses a prefix or BIRD prefix pattern (192.0.2.0/24, 192.0.2.0/24+, 192.0.2.0/24-, 192.0.2.0/24{24,32})
+func parse(pattern string) (entry, uint8, error) {
+	prefix, modifier := pattern, ""
+	if i := strings.IndexAny(pattern, "+-{"); i != -1 {
+		prefix, modifier = pattern[:i], pattern[i:]
+	}
+	ip, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return entry{}, 0, fmt.Errorf("invalid prefix %s", pattern)
+	}
+	ones, bits := ipNet.Mask.Size()
+
+	var e entry
+	if ip.To4() != nil {
+		e.hi = uint64(binary.BigEndian.Uint32(ipNet.IP.To4())) << 32
+	} else {
+		e.hi = binary.BigEndian.Uint64(ipNet.IP[:8])
+		e.lo = binary.BigEndian.Uint64(ipNet.IP[8:])
+	}
+	e.length, e.min, e.max = uint8(ones), uint8(ones), uint8(ones)
+
+	switch {
+	case modifier == "":
+	case modifier == "+":
+		e.max = uint8(bits)
+	case modifier == "-":
+		e.min = 0
+	case strings.HasPrefix(modifier, "{") && strings.HasSuffix(modifier, "}"):
+		parts := strings.Split(modifier[1:len(modifier)-1], ",")
+		if len(parts) != 2 {
+			return entry{}, 0, fmt.Errorf("invalid prefix length range in %s", pattern)
+		}
+		minLength, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return entry{}, 0, fmt.Errorf("invalid prefix length range in %s", pattern)
+		}
+		maxLength, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return entry{}, 0, fmt.Errorf("invalid prefix length range in %s", pattern)
+		}
+		if minLength < 0 || minLength > maxLength || maxLength > bits {
+			return entry{}, 0, fmt.Errorf("invalid prefix length range in %s", pattern)
+		}
+		e.min, e.max = uint8(minLength), uint8(maxLength)
+	default:
+		return entry{}, 0, fmt.Errorf("invalid prefix %s", pattern)
+	}
+	return e, uint8(bits), nil // nil error
+}
+
+// Add adds a prefix or BIRD prefix pattern to the set
+func (s *Set) Add(pattern string) error {
+	e, bits, err := parse(pattern)
+	if err != nil {
+		return err
+	}
+	if s.bits == 0 {
+		s.bits = bits
+	} else if s.bits != bits {
+		return errors.New("mixed address families in prefix set: " + pattern)
+	}
+	s.entries = append(s.entries, e)
+	s.sorted = false
+	return nil // nil error
+}
+
+// less compares two addresses
+func less(hi1, lo1, hi2, lo2 uint64) bool {
+	return hi1 < hi2 || (hi1 == hi2 && lo1 < lo2)
+}
+
+// last returns the last address covered by an entry
+func (s *Set) last(e entry) (uint64, uint64) {
+	hostBits := uint(s.bits - e.length)
+	if s.bits == 32 {
+		hostBits += 96
+	}
+	switch {
+	case hostBits == 0:
+		return e.hi, e.lo
+	case hostBits < 64:
+		return e.hi, e.lo | (1<<hostBits - 1)
+	case hostBits == 64:
+		return e.hi, ^uint64(0)
+	case hostBits < 128:
+		return e.hi | (1<<(hostBits-64) - 1), ^uint64(0)
+	}
+	return ^uint64(0), ^uint64(0)
+}
+
+// mask clears the host bits of an address beyond a prefix length
+func (s *Set) mask(hi, lo uint64, length uint8) (uint64, uint64) {
+	hostBits := uint(s.bits) - uint(length)
+	if s.bits == 32 {
+		hostBits += 96
+	}
+	switch {
+	case hostBits >= 128:
+		return 0, 0
+	case hostBits >= 64:
+		return hi &^ (1<<(hostBits-64) - 1), 0
+	case hostBits > 0:
+		return hi, lo &^ (1<<hostBits - 1)
+	}
+	return hi, lo
+}
+
+// sibling returns the other half of an entry's parent prefix
+func sibling(e entry) entry {
+	bit := uint(e.length) - 1 // Bit that differs between siblings, counting from the most significant bit
+	if bit < 64 {
+		e.hi ^= 1 << (63 - bit)
+	} else {
+		e.lo ^= 1 << (127 - bit)
+	}
+	return e
+}
+
+// compact sorts and deduplicates the set
+func (s *Set) compact() {
+	if s.sorted {
+		return
+	}
+	sort.Slice(s.entries, func(i, j int) bool {
+		a, b := s.entries[i], s.entries[j]
+		if a.hi != b.hi || a.lo != b.lo {
+			return less(a.hi, a.lo, b.hi, b.lo)
+		}
+		if a.length != b.length {
+			return a.length < b.length
+		}
+		if a.min != b.min {
+			return a.min < b.min
+		}
+		return a.max < b.max
+	})
+	unique := s.entries[:0]
+	for i, e := range s.entries {
+		if i == 0 || e != unique[len(unique)-1] {
+			unique = append(unique, e)
+		}
+	}
+	// Release the unused capacity
+	s.entries = append(make([]entry, 0, len(unique)), unique...)
+	s.sorted = true
+}
+
+// Len returns the number of unique prefix patterns in the set
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.compact()
+	return len(s.entries)
+}
+
+// prefix formats an address and prefix length as a prefix
+func (s *Set) prefix(hi, lo uint64, length uint8) string {
+	var ip net.IP
+	if s.bits == 32 {
+		ip = make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(hi>>32))
+	} else {
+		ip = make(net.IP, 16)
+		binary.BigEndian.PutUint64(ip[:8], hi)
+		binary.BigEndian.PutUint64(ip[8:], lo)
+	}
+	return ip.String() + "/" + strconv.Itoa(int(length))
+}
+
+// format formats an entry as a BIRD prefix pattern
+func (s *Set) format(e entry) string {
+	prefix := s.prefix(e.hi, e.lo, e.length)
+	switch {
+	case e.min == e.length && e.max == e.length:
+		return prefix
+	case e.min == e.length && e.max == s.bits:
+		return prefix + "+"
+	case e.min == 0 && e.max == e.length:
+		return prefix + "-"
+	}
+	return fmt.Sprintf("%s{%d,%d}", prefix, e.min, e.max)
+}
+
+// Strings returns the prefix patterns in the set in address order
+func (s *Set) Strings() []string {
+	if s == nil {
+		return []string{}
+	}
+	s.compact()
+	prefixes := make([]string, len(s.entries))
+	for i, e := range s.entries {
+		prefixes[i] = s.format(e)
+	}
+	return prefixes
+}
+
+// PrefixList returns the set as prefix list entries with ge and le lengths, like FRR and Cisco prefix lists, in address order.
+// Patterns matching prefixes shorter than their own length are expanded into an entry per covering prefix.
+func (s *Set) PrefixList() []string {
+	if s == nil {
+		return []string{}
+	}
+	s.compact()
+	var entries []string
+	for _, e := range s.entries {
+		for length := e.min; length < e.length && length <= e.max; length++ {
+			hi, lo := s.mask(e.hi, e.lo, length)
+			entries = append(entries, s.prefix(hi, lo, length))
+		}
+		min := e.min
+		if min < e.length {
+			min = e.length
+		}
+		if min > e.max {
+			continue
+		}
+		entry := s.prefix(e.hi, e.lo, e.length)
+		if min > e.length {
+			entry += " ge " + strconv.Itoa(int(min))
+		}
+		if e.max > e.length {
+			entry += " le " + strconv.Itoa(int(e.max))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// search returns the index of the first entry at or after an address and prefix length
+func (s *Set) search(hi, lo uint64, length uint8) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		e := s.entries[i]
+		if e.hi != hi || e.lo != lo {
+			return !less(e.hi, e.lo, hi, lo)
+		}
+		return e.length >= length
+	})
+}
+
+// covering calls f for each entry with a prefix that covers or equals a prefix, stopping if f returns true
+func (s *Set) covering(q entry, f func(entry) bool) bool {
+	for length := 0; length <= int(q.length); length++ {
+		hi, lo := s.mask(q.hi, q.lo, uint8(length))
+		for i := s.search(hi, lo, uint8(length)); i < len(s.entries); i++ {
+			e := s.entries[i]
+			if e.hi != hi || e.lo != lo || e.length != uint8(length) {
+				break
+			}
+			if f(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// query parses a prefix for a lookup against the set
+func (s *Set) query(prefix string) (entry, bool) {
+	if s == nil || len(s.entries) == 0 {
+		return entry{}, false
+	}
+	q, bits, err := parse(prefix)
+	if err != nil || bits != s.bits {
+		return entry{}, false
+	}
+	s.compact()
+	return q, true
+}
+
+// Contains checks if the set contains a prefix pattern exactly
+func (s *Set) Contains(pattern string) bool {
+	q, ok := s.query(pattern)
+	if !ok {
+		return false
+	}
+	i := s.search(q.hi, q.lo, q.length)
+	for ; i < len(s.entries) && s.entries[i].hi == q.hi && s.entries[i].lo == q.lo && s.entries[i].length == q.length; i++ {
+		if s.entries[i] == q {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks if a prefix is matched by any pattern in the set, following BIRD prefix set semantics
+func (s *Set) Matches(prefix string) bool {
+	q, ok := s.query(prefix)
+	if !ok {
+		return false
+	}
+	return s.covering(q, func(e entry) bool {
+		return q.length >= e.min && q.length <= e.max
+	})
+}
+
+// Overlaps checks if any prefix in the set covers, equals, or is covered by a prefix, ignoring length ranges
+func (s *Set) Overlaps(prefix string) bool {
+	q, ok := s.query(prefix)
+	if !ok {
+		return false
+	}
+	if s.covering(q, func(entry) bool { return true }) {
+		return true
+	}
+	// Check for more specific prefixes starting within the query prefix
+	lastHi, lastLo := s.last(q)
+	i := s.search(q.hi, q.lo, q.length)
+	return i < len(s.entries) && !less(lastHi, lastLo, s.entries[i].hi, s.entries[i].lo)
+}
+
+// aggregatable checks if an entry only matches prefixes within its own network, so it can be merged with or removed in favor of other entries without changing what the set matches
+func aggregatable(e entry) bool {
+	return e.min >= e.length
+}
+
+// Aggregate removes patterns covered by other patterns and merges sibling patterns into their parent prefix, without changing which prefixes the set matches
+func (s *Set) Aggregate() {
+	if s == nil {
+		return
+	}
+	for {
+		s.compact()
+		changed := false
+
+		// Remove patterns matched entirely by a covering pattern
+		redundant := map[int]bool{}
+		for i, e := range s.entries {
+			if !aggregatable(e) {
+				continue
+			}
+			redundant[i] = s.covering(e, func(c entry) bool {
+				return c != e && aggregatable(c) && c.min <= e.min && c.max >= e.max
+			})
+		}
+		unique := s.entries[:0]
+		for i, e := range s.entries {
+			if redundant[i] {
+				changed = true
+			} else {
+				unique = append(unique, e)
+			}
+		}
+		s.entries = unique
+
+		// Merge sibling patterns with the same length range, most specific first so merged parents can merge again
+		present := map[entry]bool{}
+		for _, e := range s.entries {
+			present[e] = true
+		}
+		for length := int(s.bits); length > 0; length-- {
+			for _, e := range s.entries {
+				if int(e.length) != length || !present[e] || !aggregatable(e) {
+					continue
+				}
+				sib := sibling(e)
+				if !present[sib] {
+					continue
+				}
+				delete(present, e)
+				delete(present, sib)
+				parent := e
+				parent.length--
+				parent.hi, parent.lo = s.mask(e.hi, e.lo, parent.length)
+				present[parent] = true
+				s.entries = append(s.entries, parent)
+				changed = true
+			}
+		}
+		merged := s.entries[:0]
+		for _, e := range s.entries {
+			if present[e] {
+				merged = append(merged, e)
+				delete(present, e)
+			}
+		}
+		s.entries = merged
+		s.sorted = false
+
+		if !changed {
+			s.compact()
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package prefixset
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetStrings(t *testing.T) {
+	s, err := New("198.51.100.0/24", "192.0.2.1/24", "192.0.2.0/24{24,32}", "192.0.2.0/24", "203.0.113.0/24+", "10.0.0.0/8-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, s.Len())
+	assert.Equal(t, []string{"10.0.0.0/8-", "192.0.2.0/24", "192.0.2.0/24+", "198.51.100.0/24", "203.0.113.0/24+"}, s.Strings())
+
+	s6, err := New("2001:500:9c::/47{47,48}", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"2001:500:9c::/47{47,48}", "2001:db8::/32"}, s6.Strings())
+
+	var nilSet *Set
+	assert.Equal(t, 0, nilSet.Len())
+	assert.Equal(t, []string{}, nilSet.Strings())
+	assert.False(t, nilSet.Matches("192.0.2.0/24"))
+}
+
+func TestSetPrefixList(t *testing.T) {
+	s, err := New("192.0.2.0/24", "198.51.100.0/24+", "203.0.113.0/24{25,28}", "10.0.0.0/10{8,9}", "100.64.0.0/10{9,11}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"10.0.0.0/8",
+		"10.0.0.0/9",
+		"100.0.0.0/9",
+		"100.64.0.0/10 le 11",
+		"192.0.2.0/24",
+		"198.51.100.0/24 le 32",
+		"203.0.113.0/24 ge 25 le 28",
+	}, s.PrefixList())
+
+	s6, err := New("2001:db8::/32{48,48}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"2001:db8::/32 ge 48 le 48"}, s6.PrefixList())
+
+	var nilSet *Set
+	assert.Equal(t, []string{}, nilSet.PrefixList())
+}
+
+func TestSetErrors(t *testing.T) {
+	for _, tc := range []string{"foo", "192.0.2.0/24{25,24}", "192.0.2.0/24{24,33}", "192.0.2.0/24{24}", "192.0.2.0/24*"} {
+		if _, err := New(tc); err == nil {
+			t.Errorf("expected error for %s", tc)
+		}
+	}
+	if _, err := New("192.0.2.0/24", "2001:db8::/32"); err == nil {
+		t.Errorf("expected mixed address family error")
+	}
+}
+
+func TestSetQueries(t *testing.T) {
+	s, err := New("192.0.2.0/24{24,26}", "198.51.100.0/24", "10.0.0.0/8+")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		prefix   string
+		contains bool
+		matches  bool
+		overlaps bool
+	}{
+		{"192.0.2.0/24{24,26}", true, true, true},
+		{"192.0.2.0/24", false, true, true},
+		{"192.0.2.64/26", false, true, true},
+		{"192.0.2.64/27", false, false, true},
+		{"192.0.0.0/16", false, false, true},
+		{"198.51.100.0/25", false, false, true},
+		{"10.1.2.0/24", false, true, true},
+		{"203.0.113.0/24", false, false, false},
+		{"0.0.0.0/0", false, false, true},
+		{"2001:db8::/32", false, false, false},
+	} {
+		assert.Equal(t, tc.contains, s.Contains(tc.prefix), "contains "+tc.prefix)
+		assert.Equal(t, tc.matches, s.Matches(tc.prefix), "matches "+tc.prefix)
+		assert.Equal(t, tc.overlaps, s.Overlaps(tc.prefix), "overlaps "+tc.prefix)
+	}
+
+	s6, err := New("2001:db8::/32+", "2001:db8:1::/48", "::/0{0,0}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, s6.Matches("2001:db8:1:2::/64"))
+	assert.True(t, s6.Matches("::/0"))
+	assert.False(t, s6.Matches("2001:db9::/32"))
+	assert.True(t, s6.Overlaps("2001:db9::/32"))
+}
+
+func TestSetAggregate(t *testing.T) {
+	for _, tc := range []struct {
+		prefixes   []string
+		aggregated []string
+	}{
+		{ // Siblings merge into their parent, keeping the original lengths
+			[]string{"192.0.2.0/25", "192.0.2.128/25"},
+			[]string{"192.0.2.0/24{25,25}"},
+		},
+		{ // Merged parents merge again
+			[]string{"192.0.2.0/26", "192.0.2.64/26", "192.0.2.128/26", "192.0.2.192/26"},
+			[]string{"192.0.2.0/24{26,26}"},
+		},
+		{ // Covered patterns are removed
+			[]string{"10.0.0.0/8+", "10.1.0.0/16", "10.2.0.0/16{16,24}", "198.51.100.0/24"},
+			[]string{"10.0.0.0/8+", "198.51.100.0/24"},
+		},
+		{ // A less specific prefix doesn't cover a more specific one without a length range
+			[]string{"192.0.2.0/24", "192.0.2.0/25"},
+			[]string{"192.0.2.0/24", "192.0.2.0/25"},
+		},
+		{ // Siblings with different length ranges and parents matching shorter prefixes are kept
+			[]string{"192.0.2.0/25", "192.0.2.128/25+", "198.51.100.0/24-", "198.51.101.0/24-"},
+			[]string{"192.0.2.0/25", "192.0.2.128/25+", "198.51.100.0/24-", "198.51.101.0/24-"},
+		},
+		{
+			[]string{"2001:db8::/33", "2001:db8:8000::/33", "2001:db8:1::/48"},
+			[]string{"2001:db8::/32{33,33}", "2001:db8:1::/48"},
+		},
+	} {
+		s, err := New(tc.prefixes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Aggregate()
+		assert.Equal(t, tc.aggregated, s.Strings())
+	}
+
+	// Aggregation doesn't change which prefixes are matched
+	s, err := New("192.0.2.0/25", "192.0.2.128/26", "192.0.2.192/26", "198.51.100.0/24{24,25}", "198.51.101.0/24{24,25}", "198.51.100.0/23+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := map[string]bool{}
+	for length := 16; length <= 28; length++ {
+		for _, network := range []string{"192.0.2.0", "192.0.2.128", "192.0.2.192", "198.51.100.0", "198.51.101.0"} {
+			prefix := fmt.Sprintf("%s/%d", network, length)
+			before[prefix] = s.Matches(prefix)
+		}
+	}
+	s.Aggregate()
+	for prefix, matched := range before {
+		assert.Equal(t, matched, s.Matches(prefix), prefix)
+	}
+
+	var nilSet *Set
+	nilSet.Aggregate()
+}
+
+func BenchmarkSetAggregate(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		s := &Set{}
+		for j := 0; j < 100000; j++ {
+			if err := s.Add(fmt.Sprintf("%d.%d.%d.0/24", 10+j>>16, (j>>8)&255, j&255)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+		s.Aggregate()
+	}
+}
+
+func BenchmarkSetAdd(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		s := &Set{}
+		for j := 0; j < 100000; j++ {
+			if err := s.Add(fmt.Sprintf("%d.%d.%d.0/24", 10+j>>16, (j>>8)&255, j&255)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		s.Len()
+	}
+}
@@ -0,0 +1,212 @@
+package provenance
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// prefix starts every header line
+const prefix = "# pathvector-"
+
+// Header stores where a generated config file came from
+type Header struct {
+	Version    string
+	ConfigHash string
+	Generated  time.Time
+	Sources    map[string]time.Time // External data source to when it was fetched
+	BodyHash   string               // SHA-256 of the file after the header, set by Seal
+}
+
+// New creates a header for files generated now
+func New(version string, configHash string) *Header {
+	return &Header{
+		Version:    version,
+		ConfigHash: configHash,
+		Generated:  time.Now().UTC().Truncate(time.Second),
+		Sources:    map[string]time.Time{},
+	}
+}
+
+// Fetched records that an external data source was just fetched
+func (h *Header) Fetched(source string) {
+	h.Sources[source] = time.Now().UTC().Truncate(time.Second)
+}
+
+// Copy returns a copy of the header with its own sources
+func (h *Header) Copy() *Header {
+	c := *h
+	c.Sources = map[string]time.Time{}
+	for source, fetched := range h.Sources {
+		c.Sources[source] = fetched
+	}
+	return &c
+}
+
+// String renders the header as config file comment lines
+func (h *Header) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sversion: %s\n", prefix, h.Version)
+	fmt.Fprintf(&b, "%sconfig-sha256: %s\n", prefix, h.ConfigHash)
+	fmt.Fprintf(&b, "%sgenerated: %s\n", prefix, h.Generated.Format(time.RFC3339))
+	var sources []string
+	for source := range h.Sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Fprintf(&b, "%ssource: %s %s\n", prefix, source, h.Sources[source].Format(time.RFC3339))
+	}
+	if h.BodyHash != "" {
+		fmt.Fprintf(&b, "%ssha256: %s\n", prefix, h.BodyHash)
+	}
+	return b.String()
+}
+
+// Parse parses the header from the start of a generated file
+func Parse(file []byte) (*Header, error) {
+	h := &Header{Sources: map[string]time.Time{}}
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+		found = true
+		parts := strings.SplitN(strings.TrimPrefix(line, prefix), ": ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid provenance line %s", line)
+		}
+		switch parts[0] {
+		case "version":
+			h.Version = parts[1]
+		case "config-sha256":
+			h.ConfigHash = parts[1]
+		case "generated":
+			generated, err := time.Parse(time.RFC3339, parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid generation time: %v", err)
+			}
+			h.Generated = generated
+		case "source":
+			sourceParts := strings.SplitN(parts[1], " ", 2)
+			if len(sourceParts) != 2 {
+				return nil, fmt.Errorf("invalid provenance line %s", line)
+			}
+			fetched, err := time.Parse(time.RFC3339, sourceParts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid fetch time for %s: %v", sourceParts[0], err)
+			}
+			h.Sources[sourceParts[0]] = fetched
+		case "sha256":
+			h.BodyHash = parts[1]
+		}
+	}
+	if !found {
+		return nil, errors.New("no provenance header")
+	}
+	return h, nil // nil error
+}
+
+// Strip removes the header from a generated file
+func Strip(file []byte) []byte {
+	for bytes.HasPrefix(file, []byte(prefix)) {
+		i := bytes.IndexByte(file, '\n')
+		if i == -1 {
+			return nil
+		}
+		file = file[i+1:]
+	}
+	return file
+}
+
+// bodyHash returns the hex SHA-256 of a generated file after its header
+func bodyHash(file []byte) string {
+	sum := sha256.Sum256(Strip(file))
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal adds the hash of a generated file's body to its header, replacing any previous hash. Files without a header are returned unchanged.
+func Seal(file []byte) []byte {
+	body := Strip(file)
+	header := file[:len(file)-len(body)]
+	if len(header) == 0 {
+		return file
+	}
+	var sealed bytes.Buffer
+	for _, line := range strings.SplitAfter(string(header), "\n") {
+		if line != "" && !strings.HasPrefix(line, prefix+"sha256: ") {
+			sealed.WriteString(line)
+		}
+	}
+	fmt.Fprintf(&sealed, "%ssha256: %s\n", prefix, bodyHash(file))
+	sealed.Write(body)
+	return sealed.Bytes()
+}
+
+// SealFile seals a generated file in place
+func SealFile(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, Seal(file), info.Mode())
+}
+
+// Verify checks that generated files are unmodified, were all rendered in one run from a config, and that their external data isn't older than maxAge (unchecked if zero), returning a list of problems
+func Verify(files map[string][]byte, configHash string, maxAge time.Duration, now time.Time) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	var generated time.Time
+	for _, name := range names {
+		h, err := Parse(files[name])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if h.BodyHash == "" {
+			problems = append(problems, fmt.Sprintf("%s: no body hash", name))
+		} else if h.BodyHash != bodyHash(files[name]) {
+			problems = append(problems, fmt.Sprintf("%s: modified since it was generated", name))
+		}
+		if h.ConfigHash != configHash {
+			problems = append(problems, fmt.Sprintf("%s: generated from config %s, current config is %s", name, h.ConfigHash, configHash))
+		}
+		if generated.IsZero() {
+			generated = h.Generated
+		} else if !h.Generated.Equal(generated) {
+			problems = append(problems, fmt.Sprintf("%s: generated at %s, other files at %s", name, h.Generated.Format(time.RFC3339), generated.Format(time.RFC3339)))
+		}
+		if maxAge > 0 {
+			var sources []string
+			for source := range h.Sources {
+				sources = append(sources, source)
+			}
+			sort.Strings(sources)
+			for _, source := range sources {
+				if age := now.Sub(h.Sources[source]); age > maxAge {
+					problems = append(problems, fmt.Sprintf("%s: %s data is %s old", name, source, age.Truncate(time.Second)))
+				}
+			}
+		}
+	}
+	return problems
+}
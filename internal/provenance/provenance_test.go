@@ -0,0 +1,81 @@
+package provenance
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	h := New("v1.2.3", "abc123")
+	h.Sources["peeringdb"] = h.Generated.Add(-time.Minute)
+	h.Sources["irr"] = h.Generated
+	file := []byte(h.String() + "router id 192.0.2.1;\n")
+
+	parsed, err := Parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, h, parsed)
+	assert.Equal(t, "router id 192.0.2.1;\n", string(Strip(file)))
+	assert.True(t, strings.Index(h.String(), "source: irr") < strings.Index(h.String(), "source: peeringdb"))
+
+	if _, err := Parse([]byte("router id 192.0.2.1;\n")); err == nil {
+		t.Errorf("expected missing header error")
+	}
+	if _, err := Parse([]byte("# pathvector-generated: yesterday\n")); err == nil {
+		t.Errorf("expected invalid generation time error")
+	}
+}
+
+func TestHeaderCopy(t *testing.T) {
+	h := New("v1.2.3", "abc123")
+	c := h.Copy()
+	c.Fetched("irr")
+	assert.Empty(t, h.Sources)
+	assert.Len(t, c.Sources, 1)
+}
+
+func TestSeal(t *testing.T) {
+	h := New("v1.2.3", "abc123")
+	sealed := Seal([]byte(h.String() + "router id 192.0.2.1;\n"))
+	parsed, err := Parse(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bodyHash(sealed), parsed.BodyHash)
+	assert.Equal(t, "router id 192.0.2.1;\n", string(Strip(sealed)))
+
+	// Sealing again replaces the hash
+	assert.Equal(t, sealed, Seal(sealed))
+	assert.Equal(t, []byte("router id 192.0.2.1;\n"), Seal([]byte("router id 192.0.2.1;\n")))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := &Header{Version: "v1.2.3", ConfigHash: "abc123", Generated: now.Add(-time.Hour), Sources: map[string]time.Time{}}
+	stale := h.Copy()
+	stale.Sources["irr"] = now.Add(-2 * time.Hour)
+	files := map[string][]byte{
+		"bird.conf":         Seal([]byte(h.String())),
+		"AS65510_PEER.conf": Seal([]byte(stale.String())),
+	}
+	assert.Empty(t, Verify(files, "abc123", 0, now))
+	assert.Equal(t, []string{"AS65510_PEER.conf: irr data is 2h0m0s old"}, Verify(files, "abc123", 90*time.Minute, now))
+
+	other := h.Copy()
+	other.Generated = now
+	files["AS65520_OTHER.conf"] = Seal([]byte(other.String()))
+	files["AS65530_MANUAL.conf"] = []byte("protocol bgp MANUAL {}\n")
+	files["AS65540_EDITED.conf"] = append(Seal([]byte(h.String()+"protocol bgp EDITED {}\n")), "# edited\n"...)
+	files["AS65550_UNSEALED.conf"] = []byte(h.String())
+	problems := Verify(files, "def456", 0, now)
+	assert.Len(t, problems, 9)
+	assert.Contains(t, problems, "AS65540_EDITED.conf: modified since it was generated")
+	assert.Contains(t, problems, "AS65550_UNSEALED.conf: no body hash")
+	assert.Contains(t, problems, "AS65530_MANUAL.conf: no provenance header")
+	assert.Contains(t, problems, "bird.conf: generated from config abc123, current config is def456")
+	assert.Contains(t, problems, "AS65520_OTHER.conf: generated at 2021-01-01T12:00:00Z, other files at 2021-01-01T11:00:00Z")
+}
@@ -0,0 +1,187 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// acceptRegex matches an accept statement in custom filter config
+var acceptRegex = regexp.MustCompile(`\baccept\b`)
+
+// Policy stores a summary of a peer's effective import and export policy
+type Policy struct {
+	Peer        string   `json:"peer" yaml:"peer"`
+	ASN         int      `json:"asn" yaml:"asn"`
+	Disabled    bool     `json:"disabled" yaml:"disabled"`
+	Import      []string `json:"import" yaml:"import"`
+	Export      []string `json:"export" yaml:"export"`
+	AcceptAny   bool     `json:"accept-any" yaml:"accept-any"`
+	AnnounceAny bool     `json:"announce-any" yaml:"announce-any"`
+	Findings    []string `json:"findings" yaml:"findings"`
+}
+
+// Compliant returns true if the peer is disabled or neither accepts nor announces any route
+func (p *Policy) Compliant() bool {
+	return p.Disabled || (!p.AcceptAny && !p.AnnounceAny)
+}
+
+// Status returns a short description of the policy's compliance
+func (p *Policy) Status() string {
+	if p.Disabled {
+		return "disabled"
+	}
+	var status []string
+	if p.AcceptAny {
+		status = append(status, "accept-any")
+	}
+	if p.AnnounceAny {
+		status = append(status, "announce-any")
+	}
+	if len(status) == 0 {
+		return "ok"
+	}
+	return strings.Join(status, ", ")
+}
+
+// boolDeref returns a bool pointer's value, or false if nil
+func boolDeref(b *bool) bool {
+	return b != nil && *b
+}
+
+// strSlice returns a string slice pointer's value, or nil if nil
+func strSlice(s *[]string) []string {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// importPolicy summarizes a peer's import filter in filter order
+func importPolicy(peer *config.Peer, p *Policy) {
+	p.Import = []string{}
+	prefixes := strSlice(peer.Prefixes)
+	if boolDeref(peer.FilterIRR) {
+		switch {
+		case util.StrDeref(peer.ASSet) != "":
+			p.Import = append(p.Import, "IRR prefix list from "+*peer.ASSet)
+		case boolDeref(peer.AutoASSet):
+			p.Import = append(p.Import, "IRR prefix list from the PeeringDB as-set")
+		}
+		if len(prefixes) > 0 {
+			p.Import = append(p.Import, fmt.Sprintf("%d static prefixes", len(prefixes)))
+		}
+	} else {
+		p.AcceptAny = true
+		p.Findings = append(p.Findings, "import accepts any prefix, filter-irr is disabled")
+		if len(prefixes) > 0 {
+			p.Findings = append(p.Findings, fmt.Sprintf("%d static prefixes are only enforced when filter-irr is enabled", len(prefixes)))
+		}
+	}
+
+	for _, filter := range []struct {
+		enabled bool
+		name    string
+	}{
+		{boolDeref(peer.FilterRPKI), "RPKI"},
+		{boolDeref(peer.FilterASPA), "ASPA"},
+		{boolDeref(peer.FilterBogonRoutes), "bogon prefixes"},
+		{boolDeref(peer.FilterBogonASNs), "bogon ASNs"},
+		{boolDeref(peer.FilterTransitASNs), "transit ASNs"},
+		{boolDeref(peer.FilterASPath), "origin AS in as-set"},
+		{boolDeref(peer.FilterPrefixLength), "prefix length"},
+		{boolDeref(peer.FilterNeverViaRouteServers), "never via route servers"},
+		{boolDeref(peer.EnforceFirstAS), "first AS"},
+		{boolDeref(peer.EnforcePeerNexthop), "peer next hop"},
+	} {
+		if filter.enabled {
+			p.Import = append(p.Import, filter.name)
+		}
+	}
+	if boolDeref(peer.FilterMaxPrefix) && peer.ImportLimit4 != nil && peer.ImportLimit6 != nil {
+		p.Import = append(p.Import, fmt.Sprintf("max prefix %d/%d", *peer.ImportLimit4, *peer.ImportLimit6))
+	}
+
+	if util.StrDeref(peer.PreImport) != "" || util.StrDeref(peer.PreImportFinal) != "" {
+		p.Import = append(p.Import, "custom")
+		p.Findings = append(p.Findings, "custom import config isn't analyzed")
+	}
+}
+
+// exportPolicy summarizes the routes a peer's export filter announces
+func exportPolicy(peer *config.Peer, p *Policy) {
+	p.Export = []string{}
+	if boolDeref(peer.AnnounceOriginated) {
+		if peer.AnnouncePrefixes != nil {
+			p.Export = append(p.Export, "originated ("+strings.Join(*peer.AnnouncePrefixes, ", ")+")")
+		} else if peer.AnnouncePrefixes4 != nil {
+			p.Export = append(p.Export, fmt.Sprintf("originated (%d prefixes matching tags)", len(*peer.AnnouncePrefixes4)+len(*peer.AnnouncePrefixes6)))
+		} else {
+			p.Export = append(p.Export, "originated")
+		}
+	}
+	for _, community := range strSlice(peer.AnnounceCommunities) {
+		p.Export = append(p.Export, "community "+community)
+	}
+	if boolDeref(peer.AnnounceDefault) {
+		p.Export = append(p.Export, "default route")
+	}
+
+	// The export filter ends with a reject, so only custom config can accept routes outside of the classes above
+	for _, custom := range []struct {
+		option string
+		config *string
+	}{
+		{"pre-export", peer.PreExport},
+		{"pre-export-final", peer.PreExportFinal},
+	} {
+		if acceptRegex.MatchString(util.StrDeref(custom.config)) {
+			p.AnnounceAny = true
+			p.Export = append(p.Export, "custom")
+			p.Findings = append(p.Findings, custom.option+" accepts routes that aren't restricted to originated, community or default routes")
+		}
+	}
+	if len(p.Export) == 0 {
+		p.Export = append(p.Export, "none")
+	}
+}
+
+// Build summarizes the effective policy of each peer in a loaded config, sorted by peer name
+func Build(c *config.Config) []*Policy {
+	var names []string
+	for name := range c.Peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	policies := []*Policy{}
+	for _, name := range names {
+		peer := c.Peers[name]
+		p := &Policy{Peer: name, Disabled: boolDeref(peer.Disabled), Findings: []string{}}
+		if peer.ASN != nil {
+			p.ASN = *peer.ASN
+		}
+		importPolicy(peer, p)
+		exportPolicy(peer, p)
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// Marshal encodes policies as JSON or YAML
+func Marshal(policies []*Policy, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(policies, "", "  ")
+	case "yaml":
+		return yaml.Marshal(policies)
+	}
+	return nil, fmt.Errorf("unsupported format %s, must be json or yaml", format)
+}
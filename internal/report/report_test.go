@@ -0,0 +1,85 @@
+package report
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestBuild(t *testing.T) {
+	c, err := config.Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [192.0.2.0/24]
+peers:
+  Customer:
+    asn: 65530
+    neighbors: [203.0.113.2]
+    filter-irr: true
+    as-set: AS-EXAMPLE
+    prefixes: [198.51.100.0/24]
+    announce-prefixes: [192.0.2.0/24]
+    announce-default: true
+  Peer:
+    asn: 65531
+    neighbors: [203.0.113.3]
+    prefixes: [198.51.100.0/24]
+    filter-rpki: false
+  Transit:
+    asn: 65532
+    neighbors: [203.0.113.4]
+    filter-irr: true
+    as-set: AS-TRANSIT
+    pre-export-final: accept;
+  Disabled:
+    asn: 65533
+    neighbors: [203.0.113.5]
+    disabled: true
+`))
+	assert.Nil(t, err)
+
+	policies := Build(c)
+	assert.Len(t, policies, 4)
+	assert.Equal(t, []string{"Customer", "Disabled", "Peer", "Transit"}, []string{policies[0].Peer, policies[1].Peer, policies[2].Peer, policies[3].Peer})
+
+	customer := policies[0]
+	assert.Equal(t, 65530, customer.ASN)
+	assert.Contains(t, customer.Import, "IRR prefix list from AS-EXAMPLE")
+	assert.Contains(t, customer.Import, "1 static prefixes")
+	assert.Contains(t, customer.Import, "RPKI")
+	assert.Equal(t, []string{"originated (192.0.2.0/24)", "default route"}, customer.Export)
+	assert.True(t, customer.Compliant())
+	assert.Equal(t, "ok", customer.Status())
+	assert.Empty(t, customer.Findings)
+
+	disabled := policies[1]
+	assert.True(t, disabled.AcceptAny)
+	assert.True(t, disabled.Compliant())
+	assert.Equal(t, "disabled", disabled.Status())
+
+	peer := policies[2]
+	assert.True(t, peer.AcceptAny)
+	assert.False(t, peer.AnnounceAny)
+	assert.NotContains(t, peer.Import, "RPKI")
+	assert.False(t, peer.Compliant())
+	assert.Equal(t, "accept-any", peer.Status())
+	assert.Len(t, peer.Findings, 2)
+
+	transit := policies[3]
+	assert.False(t, transit.AcceptAny)
+	assert.True(t, transit.AnnounceAny)
+	assert.Contains(t, transit.Export, "custom")
+	assert.Equal(t, "announce-any", transit.Status())
+
+	out, err := Marshal(policies, "json")
+	assert.Nil(t, err)
+	var decoded []*Policy
+	assert.Nil(t, json.Unmarshal(out, &decoded))
+	assert.Equal(t, policies, decoded)
+
+	_, err = Marshal(policies, "xml")
+	assert.NotNil(t, err)
+}
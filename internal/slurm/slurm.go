@@ -0,0 +1,150 @@
+// Package slurm parses RFC 8416 SLURM files of local RPKI exceptions and converts them to BIRD ROA filters and static ROAs
+package slurm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// PrefixFilter removes VRPs matching a prefix (including more specifics), an origin ASN, or both
+type PrefixFilter struct {
+	Prefix  string  `json:"prefix,omitempty"`
+	ASN     *uint32 `json:"asn,omitempty"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// PrefixAssertion adds a local VRP
+type PrefixAssertion struct {
+	ASN             uint32 `json:"asn"`
+	Prefix          string `json:"prefix"`
+	MaxPrefixLength *int   `json:"maxPrefixLength,omitempty"`
+	Comment         string `json:"comment,omitempty"`
+}
+
+// File stores a SLURM file. BGPsec filters and assertions are accepted but not used.
+type File struct {
+	Version                 int `json:"slurmVersion"`
+	ValidationOutputFilters struct {
+		PrefixFilters []PrefixFilter    `json:"prefixFilters"`
+		BGPsecFilters []json.RawMessage `json:"bgpsecFilters"`
+	} `json:"validationOutputFilters"`
+	LocallyAddedAssertions struct {
+		PrefixAssertions []PrefixAssertion `json:"prefixAssertions"`
+		BGPsecAssertions []json.RawMessage `json:"bgpsecAssertions"`
+	} `json:"locallyAddedAssertions"`
+}
+
+// parsePrefix parses a prefix, returning its address family and length and requiring it to have no host bits set
+func parsePrefix(prefix string) (string, int, error) {
+	ip, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	if !ip.Equal(ipNet.IP) {
+		return "", 0, fmt.Errorf("prefix %s has host bits set", prefix)
+	}
+	length, _ := ipNet.Mask.Size()
+	if ip.To4() != nil {
+		return "4", length, nil // nil error
+	}
+	return "6", length, nil // nil error
+}
+
+// family returns the address family of a valid prefix
+func family(prefix string) string {
+	if strings.Contains(prefix, ":") {
+		return "6"
+	}
+	return "4"
+}
+
+// Parse parses and validates a SLURM file
+func Parse(data []byte) (*File, error) {
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("JSON unmarshal: %v", err)
+	}
+	if f.Version != 1 {
+		return nil, fmt.Errorf("unsupported slurmVersion %d", f.Version)
+	}
+
+	for i, filter := range f.ValidationOutputFilters.PrefixFilters {
+		if filter.Prefix == "" && filter.ASN == nil {
+			return nil, fmt.Errorf("prefix filter %d has no prefix or asn", i)
+		}
+		if filter.Prefix != "" {
+			if _, _, err := parsePrefix(filter.Prefix); err != nil {
+				return nil, fmt.Errorf("prefix filter %d: %v", i, err)
+			}
+		}
+	}
+
+	for i, assertion := range f.LocallyAddedAssertions.PrefixAssertions {
+		af, length, err := parsePrefix(assertion.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("prefix assertion %d: %v", i, err)
+		}
+		if assertion.MaxPrefixLength != nil {
+			maxLength := 32
+			if af == "6" {
+				maxLength = 128
+			}
+			if *assertion.MaxPrefixLength < length || *assertion.MaxPrefixLength > maxLength {
+				return nil, fmt.Errorf("prefix assertion %d: maxPrefixLength %d must be between %d and %d", i, *assertion.MaxPrefixLength, length, maxLength)
+			}
+		}
+	}
+
+	return &f, nil // nil error
+}
+
+// Load reads and parses a SLURM file
+func Load(file string) (*File, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty SLURM file")
+	}
+	return Parse(data)
+}
+
+// Filters returns BIRD conditions matching the ROAs removed by the prefix filters of an address family
+func (f *File) Filters(af string) []string {
+	conditions := []string{}
+	for _, filter := range f.ValidationOutputFilters.PrefixFilters {
+		if filter.Prefix != "" && family(filter.Prefix) != af {
+			continue
+		}
+		var condition []string
+		if filter.Prefix != "" {
+			condition = append(condition, fmt.Sprintf("net ~ [ %s+ ]", filter.Prefix))
+		}
+		if filter.ASN != nil {
+			condition = append(condition, fmt.Sprintf("net.asn = %d", *filter.ASN))
+		}
+		conditions = append(conditions, strings.Join(condition, " && "))
+	}
+	return conditions
+}
+
+// Assertions returns BIRD static ROA routes for the prefix assertions of an address family
+func (f *File) Assertions(af string) []string {
+	routes := []string{}
+	for _, assertion := range f.LocallyAddedAssertions.PrefixAssertions {
+		if family(assertion.Prefix) != af {
+			continue
+		}
+		_, length, _ := parsePrefix(assertion.Prefix)
+		if assertion.MaxPrefixLength != nil {
+			length = *assertion.MaxPrefixLength
+		}
+		routes = append(routes, fmt.Sprintf("%s max %d as %d", assertion.Prefix, length, assertion.ASN))
+	}
+	return routes
+}
@@ -0,0 +1,77 @@
+package slurm
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcExample is the SLURM file example from RFC 8416 section 3.5
+const rfcExample = `{
+  "slurmVersion": 1,
+  "validationOutputFilters": {
+    "prefixFilters": [
+      {"prefix": "192.0.2.0/24", "comment": "All VRPs encompassed by prefix"},
+      {"asn": 64496, "comment": "All VRPs matching ASN"},
+      {"prefix": "198.51.100.0/24", "asn": 64497, "comment": "All VRPs encompassed by prefix, matching ASN"}
+    ],
+    "bgpsecFilters": [
+      {"asn": 64496, "comment": "All keys for ASN"}
+    ]
+  },
+  "locallyAddedAssertions": {
+    "prefixAssertions": [
+      {"asn": 64496, "prefix": "198.51.100.0/24", "comment": "My other important route"},
+      {"asn": 64496, "prefix": "2001:db8::/32", "maxPrefixLength": 48, "comment": "My other important de-aggregated routes"}
+    ],
+    "bgpsecAssertions": []
+  }
+}`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(rfcExample))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"net ~ [ 192.0.2.0/24+ ]",
+		"net.asn = 64496",
+		"net ~ [ 198.51.100.0/24+ ] && net.asn = 64497",
+	}, f.Filters("4"))
+	assert.Equal(t, []string{"net.asn = 64496"}, f.Filters("6"))
+	assert.Equal(t, []string{"198.51.100.0/24 max 24 as 64496"}, f.Assertions("4"))
+	assert.Equal(t, []string{"2001:db8::/32 max 48 as 64496"}, f.Assertions("6"))
+
+	for _, tc := range []struct {
+		old string
+		new string
+		err string
+	}{
+		{`"slurmVersion": 1`, `"slurmVersion": 2`, "unsupported slurmVersion 2"},
+		{`{"asn": 64496, "comment": "All VRPs matching ASN"}`, `{"comment": "Nothing"}`, "has no prefix or asn"},
+		{`"prefix": "192.0.2.0/24"`, `"prefix": "192.0.2.1/24"`, "host bits set"},
+		{`"prefix": "198.51.100.0/24", "comment"`, `"prefix": "198.51.100.0/33", "comment"`, "invalid prefix"},
+		{`"maxPrefixLength": 48`, `"maxPrefixLength": 16`, "must be between 32 and 128"},
+		{`"slurmVersion": 1,`, `"slurmVersion": 1`, "JSON unmarshal"},
+	} {
+		_, err := Parse([]byte(strings.Replace(rfcExample, tc.old, tc.new, 1)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %s error, got %+v", tc.err, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := path.Join(t.TempDir(), "slurm.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(rfcExample), 0644))
+	f, err := Load(file)
+	assert.Nil(t, err)
+	assert.Len(t, f.LocallyAddedAssertions.PrefixAssertions, 2)
+
+	assert.Nil(t, ioutil.WriteFile(file, nil, 0644))
+	_, err = Load(file)
+	assert.NotNil(t, err)
+	_, err = Load(path.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err)
+}
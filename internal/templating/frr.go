@@ -0,0 +1,134 @@
+package templating
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// frrConfig is passed to the FRR template
+type frrConfig struct {
+	*config.Config
+	Header          string
+	OriginRouteMaps map[string]string
+	Peers           []*peerSessions
+}
+
+// frrRejected lists peer options the FRR renderer can't render and can't safely ignore
+var frrRejected = []unsupportedOption{
+	{"pre-import", func(p *config.Peer) bool { return util.StrDeref(p.PreImport) != "" }},
+	{"pre-import-final", func(p *config.Peer) bool { return util.StrDeref(p.PreImportFinal) != "" }},
+	{"vrf", func(p *config.Peer) bool { return p.VRF != nil }},
+	{"tcp-ao-key-chain", func(p *config.Peer) bool { return p.TCPAOKeyChain != nil }},
+	{"filter-aspa", func(p *config.Peer) bool { return p.FilterASPA != nil && *p.FilterASPA }},
+	{"max-prefix-action block", func(p *config.Peer) bool {
+		return p.FilterMaxPrefix != nil && *p.FilterMaxPrefix && util.StrDeref(p.MaxPrefixTripAction) == "block"
+	}},
+}
+
+// frrUnsupported lists peer options the FRR renderer ignores
+var frrUnsupported = []unsupportedOption{
+	{"session-global", func(p *config.Peer) bool { return util.StrDeref(p.SessionGlobal) != "" }},
+	{"pre-export", func(p *config.Peer) bool { return util.StrDeref(p.PreExport) != "" }},
+	{"pre-export-final", func(p *config.Peer) bool { return util.StrDeref(p.PreExportFinal) != "" }},
+	{"debug", func(p *config.Peer) bool { return p.Debug != nil && len(*p.Debug) > 0 }},
+	{"as-prefs", func(p *config.Peer) bool { return p.ASPrefs != nil && len(*p.ASPrefs) > 0 }},
+	{"remove-communities", func(p *config.Peer) bool { return p.RemoveCommunities != nil && len(*p.RemoveCommunities) > 0 }},
+	{"remove-all-communities", func(p *config.Peer) bool { return p.RemoveAllCommunities != nil && *p.RemoveAllCommunities != 0 }},
+	{"flowspec", func(p *config.Peer) bool { return p.FlowSpec != nil && *p.FlowSpec }},
+	{"announce-ospf", func(p *config.Peer) bool { return p.AnnounceOSPF != nil && *p.AnnounceOSPF }},
+	{"announce-babel", func(p *config.Peer) bool { return p.AnnounceBabel != nil && *p.AnnounceBabel }},
+	{"afi-safi vpn4-unicast and vpn6-unicast", func(p *config.Peer) bool { return p.VPNFamilies != nil }},
+	{"extended communities", func(p *config.Peer) bool {
+		return p.ImportExtendedCommunities != nil || p.ExportExtendedCommunities != nil || p.AnnounceExtendedCommunities != nil || p.RemoveExtendedCommunities != nil
+	}},
+	{"confederation", func(p *config.Peer) bool { return p.Confederation != nil && *p.Confederation != 0 }},
+	{"graceful-restart-time", func(p *config.Peer) bool { return p.GracefulRestartTime != nil && *p.GracefulRestartTime != 120 }},
+	{"llgr", func(p *config.Peer) bool { return p.LLGR != nil && *p.LLGR }},
+	{"startup-hold-time", func(p *config.Peer) bool { return p.StartupHoldTime != nil && *p.StartupHoldTime != 240 }},
+	{"allow-blackhole-community", func(p *config.Peer) bool { return p.AllowBlackholeCommunity != nil && *p.AllowBlackholeCommunity }},
+	{"optimize-outbound", func(p *config.Peer) bool { return p.OptimizeOutbound != nil && *p.OptimizeOutbound }},
+	{"optimize-inbound", func(p *config.Peer) bool { return p.OptimizeInbound != nil && *p.OptimizeInbound }},
+}
+
+// frrRouteMapName returns an FRR route-map name for a prefix
+func frrRouteMapName(prefix string) string {
+	return "ORIGIN_" + strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(prefix)
+}
+
+// FRR renders a single frr.conf with the global and peer config
+type FRR struct{}
+
+// Render renders frr.conf into the cache directory, with each peer's provenance header before its config
+func (FRR) Render(c *config.Config, header string, peerHeaders map[string]string) error {
+	if len(c.ConditionalPrefixes4) > 0 || len(c.ConditionalPrefixes6) > 0 {
+		log.Warn("Conditional prefixes from VRRP instances, healthchecks and conditional-prefixes aren't supported by the FRR renderer, not originating them")
+	}
+	if len(c.Augments.SRDCommunities) > 0 {
+		log.Warn("srd-communities isn't supported by the FRR renderer, ignoring")
+	}
+	if c.SLURM != nil {
+		log.Warn("rpki-slurm-file isn't supported by the FRR renderer, ignoring")
+	}
+	if c.ActionCommunities.Enabled {
+		log.Warn("action-communities isn't supported by the FRR renderer, ignoring")
+	}
+	if len(c.FlowSpecRules) > 0 {
+		log.Warn("flowspec-rules isn't supported by the FRR renderer, ignoring")
+	}
+	if len(c.VRFs) > 0 {
+		log.Warn("vrfs isn't supported by the FRR renderer, ignoring")
+	}
+	if len(c.OSPF.Areas) > 0 {
+		log.Warn("ospf isn't supported by the FRR renderer, ignoring")
+	}
+	for prefix, static := range c.Augments.Statics {
+		for _, nexthop := range static.Nexthops {
+			if nexthop.Weight != 0 || nexthop.OnLink || nexthop.BFD {
+				log.Warnf("Static nexthop weight, onlink, and bfd aren't supported by the FRR renderer, ignoring for %s", prefix)
+				break
+			}
+		}
+	}
+	if len(c.Babel.Interfaces) > 0 {
+		log.Warn("babel isn't supported by the FRR renderer, ignoring")
+	}
+
+	frr := frrConfig{Config: c, Header: header, OriginRouteMaps: map[string]string{}}
+	for prefix, attributes := range c.OriginAttributes {
+		if attributes != nil {
+			frr.OriginRouteMaps[prefix] = frrRouteMapName(prefix)
+		}
+	}
+
+	peers, err := buildPeers(c, peerHeaders, "FRR", frrUnsupported, frrRejected, false)
+	if err != nil {
+		return err
+	}
+	frr.Peers = peers
+
+	var b strings.Builder
+	if err := FRRTemplate.ExecuteTemplate(&b, "frr.tmpl", frr); err != nil {
+		return fmt.Errorf("execute FRR template: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(c.CacheDirectory, "frr.conf"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("write FRR output file: %v", err)
+	}
+	return nil // nil error
+}
+
+// CacheFiles returns frr.conf in the cache directory
+func (FRR) CacheFiles(c *config.Config) ([]string, error) {
+	return []string{path.Join(c.CacheDirectory, "frr.conf")}, nil // nil error
+}
+
+// RunningFiles returns the FRR config file
+func (FRR) RunningFiles(c *config.Config) ([]string, error) {
+	return []string{c.FRRConfig}, nil // nil error
+}
@@ -0,0 +1,157 @@
+package templating
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// openBGPDConfig is passed to the OpenBGPD template
+type openBGPDConfig struct {
+	*config.Config
+	Header string
+	Peers  []*peerSessions
+}
+
+// openBGPDRejected lists peer options the OpenBGPD renderer can't render and can't safely ignore
+var openBGPDRejected = []unsupportedOption{
+	{"pre-import", func(p *config.Peer) bool { return util.StrDeref(p.PreImport) != "" }},
+	{"pre-import-final", func(p *config.Peer) bool { return util.StrDeref(p.PreImportFinal) != "" }},
+	{"vrf", func(p *config.Peer) bool { return p.VRF != nil }},
+	{"tcp-ao-key-chain", func(p *config.Peer) bool { return p.TCPAOKeyChain != nil }},
+	{"interface", func(p *config.Peer) bool { return p.Interface != nil }},
+	{"listen-interface", func(p *config.Peer) bool { return p.ListenInterface != nil }},
+	{"max-prefix-action warn and block", func(p *config.Peer) bool {
+		action := util.StrDeref(p.MaxPrefixTripAction)
+		return p.FilterMaxPrefix != nil && *p.FilterMaxPrefix && (action == "warn" || action == "block")
+	}},
+}
+
+// openBGPDUnsupported lists peer options the OpenBGPD renderer ignores
+var openBGPDUnsupported = []unsupportedOption{
+	{"session-global", func(p *config.Peer) bool { return util.StrDeref(p.SessionGlobal) != "" }},
+	{"pre-export", func(p *config.Peer) bool { return util.StrDeref(p.PreExport) != "" }},
+	{"pre-export-final", func(p *config.Peer) bool { return util.StrDeref(p.PreExportFinal) != "" }},
+	{"force-peer-nexthop", func(p *config.Peer) bool { return p.ForcePeerNexthop != nil && *p.ForcePeerNexthop }},
+	{"debug", func(p *config.Peer) bool { return p.Debug != nil && len(*p.Debug) > 0 }},
+	{"as-prefs", func(p *config.Peer) bool { return p.ASPrefs != nil && len(*p.ASPrefs) > 0 }},
+	{"remove-communities", func(p *config.Peer) bool { return p.RemoveCommunities != nil && len(*p.RemoveCommunities) > 0 }},
+	{"remove-all-communities", func(p *config.Peer) bool { return p.RemoveAllCommunities != nil && *p.RemoveAllCommunities != 0 }},
+	{"flowspec", func(p *config.Peer) bool { return p.FlowSpec != nil && *p.FlowSpec }},
+	{"announce-ospf", func(p *config.Peer) bool { return p.AnnounceOSPF != nil && *p.AnnounceOSPF }},
+	{"announce-babel", func(p *config.Peer) bool { return p.AnnounceBabel != nil && *p.AnnounceBabel }},
+	{"announce-isis", func(p *config.Peer) bool { return p.AnnounceISIS != nil && *p.AnnounceISIS }},
+	{"afi-safi", func(p *config.Peer) bool { return p.AFISAFI != nil && len(*p.AFISAFI) > 0 }},
+	{"extended communities", func(p *config.Peer) bool {
+		return p.ImportExtendedCommunities != nil || p.ExportExtendedCommunities != nil || p.AnnounceExtendedCommunities != nil || p.RemoveExtendedCommunities != nil
+	}},
+	{"confederation", func(p *config.Peer) bool { return p.Confederation != nil && *p.Confederation != 0 }},
+	{"graceful-restart-time", func(p *config.Peer) bool { return p.GracefulRestartTime != nil && *p.GracefulRestartTime != 120 }},
+	{"llgr", func(p *config.Peer) bool { return p.LLGR != nil && *p.LLGR }},
+	{"tcp-mss", func(p *config.Peer) bool { return p.TCPMSS != nil }},
+	{"keepalive-time", func(p *config.Peer) bool {
+		return p.KeepaliveTime != nil && p.HoldTime != nil && *p.KeepaliveTime != *p.HoldTime/3
+	}},
+	{"connect-retry-time", func(p *config.Peer) bool { return p.ConnectRetryTime != nil && *p.ConnectRetryTime != 120 }},
+	{"startup-hold-time", func(p *config.Peer) bool { return p.StartupHoldTime != nil && *p.StartupHoldTime != 240 }},
+	{"allow-blackhole-community", func(p *config.Peer) bool { return p.AllowBlackholeCommunity != nil && *p.AllowBlackholeCommunity }},
+	{"allow-local-as", func(p *config.Peer) bool { return p.AllowLocalAS != nil && *p.AllowLocalAS }},
+	{"as-override", func(p *config.Peer) bool { return p.ASOverride != nil && *p.ASOverride }},
+	{"bfd", func(p *config.Peer) bool { return (p.BFD != nil && *p.BFD) || (p.BFDStrict != nil && *p.BFDStrict) }},
+	{"neighbor-port", func(p *config.Peer) bool { return p.NeighborPort != nil && *p.NeighborPort != 179 }},
+	{"optimize-outbound", func(p *config.Peer) bool { return p.OptimizeOutbound != nil && *p.OptimizeOutbound }},
+	{"optimize-inbound", func(p *config.Peer) bool { return p.OptimizeInbound != nil && *p.OptimizeInbound }},
+}
+
+// openBGPDPrefix converts a prefix list entry to an OpenBGPD prefix-set entry
+func openBGPDPrefix(entry string) string {
+	fields := strings.Fields(entry)
+	if len(fields) == 1 {
+		return entry
+	}
+	min := fields[0][strings.Index(fields[0], "/")+1:]
+	max := fields[len(fields)-1]
+	if fields[1] == "ge" {
+		min = fields[2]
+	}
+	return fmt.Sprintf("%s prefixlen %s - %s", fields[0], min, max)
+}
+
+// OpenBGPD renders a single bgpd.conf with the global and peer config
+type OpenBGPD struct{}
+
+// Render renders bgpd.conf into the cache directory, with each peer's provenance header before its config
+func (OpenBGPD) Render(c *config.Config, header string, peerHeaders map[string]string) error {
+	if len(c.ConditionalPrefixes4) > 0 || len(c.ConditionalPrefixes6) > 0 {
+		log.Warn("Conditional prefixes from VRRP instances, healthchecks and conditional-prefixes aren't supported by the OpenBGPD renderer, not originating them")
+	}
+	if len(c.Augments.Statics) > 0 {
+		log.Warn("Static routes aren't supported by the OpenBGPD renderer, add them to the kernel routing table instead")
+	}
+	if len(c.Augments.SRDCommunities) > 0 {
+		log.Warn("srd-communities isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if c.SLURM != nil {
+		log.Warn("rpki-slurm-file isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if c.ActionCommunities.Enabled {
+		log.Warn("action-communities isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if len(c.FlowSpecRules) > 0 {
+		log.Warn("flowspec-rules isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if len(c.VRFs) > 0 {
+		log.Warn("vrfs isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if len(c.OSPF.Areas) > 0 {
+		log.Warn("ospf isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if len(c.Babel.Interfaces) > 0 {
+		log.Warn("babel isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if len(c.ISIS.Interfaces) > 0 {
+		log.Warn("isis isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	if len(c.Augments.VXLAN) > 0 {
+		log.Warn("vxlan isn't supported by the OpenBGPD renderer, ignoring")
+	}
+	for _, rtrServer := range c.RTRServers {
+		if c.RPKIEnable && rtrServer.Transport != "tcp" {
+			log.Warnf("RTR %s transport isn't supported by the OpenBGPD renderer, skipping %s", rtrServer.Transport, rtrServer.Server)
+		}
+	}
+
+	peers, err := buildPeers(c, peerHeaders, "OpenBGPD", openBGPDUnsupported, openBGPDRejected, true)
+	if err != nil {
+		return err
+	}
+	bgpd := openBGPDConfig{
+		Config: c,
+		Header: header,
+		Peers:  peers,
+	}
+	var b strings.Builder
+	if err := OpenBGPDTemplate.ExecuteTemplate(&b, "openbgpd.tmpl", bgpd); err != nil {
+		return fmt.Errorf("execute OpenBGPD template: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(c.CacheDirectory, "bgpd.conf"), []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("write OpenBGPD output file: %v", err)
+	}
+	return nil // nil error
+}
+
+// CacheFiles returns bgpd.conf in the cache directory
+func (OpenBGPD) CacheFiles(c *config.Config) ([]string, error) {
+	return []string{path.Join(c.CacheDirectory, "bgpd.conf")}, nil // nil error
+}
+
+// RunningFiles returns the OpenBGPD config file
+func (OpenBGPD) RunningFiles(c *config.Config) ([]string, error) {
+	return []string{c.OpenBGPDConfig}, nil // nil error
+}
@@ -0,0 +1,210 @@
+package templating
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/bird"
+	"github.com/natesales/pathvector/internal/config"
+	"github.com/natesales/pathvector/internal/logging"
+	"github.com/natesales/pathvector/internal/util"
+)
+
+// Renderer renders a config for a routing daemon into the cache directory
+type Renderer interface {
+	// Render writes the daemon config, starting the global config with header and each peer's config with its entry in peerHeaders
+	Render(c *config.Config, header string, peerHeaders map[string]string) error
+	// CacheFiles returns the files Render wrote to the cache directory
+	CacheFiles(c *config.Config) ([]string, error)
+	// RunningFiles returns the files the daemon runs from once the rendered config is applied, starting with the global config
+	RunningFiles(c *config.Config) ([]string, error)
+}
+
+// Renderers maps daemon names to their renderers
+var Renderers = map[string]Renderer{
+	"bird":     BIRD{},
+	"frr":      FRR{},
+	"openbgpd": OpenBGPD{},
+}
+
+// sortedPeerNames returns the config's peer names in order so duplicate protocol names are numbered the same way every run
+func sortedPeerNames(c *config.Config) []string {
+	var peerNames []string
+	for peerName := range c.Peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+	return peerNames
+}
+
+// BIRD renders bird.conf and a config file per peer
+type BIRD struct{}
+
+// Render renders the global and peer BIRD configs
+func (BIRD) Render(c *config.Config, header string, peerHeaders map[string]string) error {
+	if c.EVPNEnable || len(c.Augments.VXLAN) > 0 {
+		log.Warn("EVPN isn't supported by the BIRD renderer, ignoring afi-safi l2vpn-evpn and vxlan (use the frr daemon)")
+	}
+	if len(c.ISIS.Interfaces) > 0 {
+		log.Warn("isis isn't supported by the BIRD renderer, ignoring (use the frr daemon)")
+	}
+	for _, peerName := range sortedPeerNames(c) {
+		if c.Peers[peerName].TCPMSS != nil {
+			logging.Peer(peerName).Warn("tcp-mss isn't supported by the BIRD renderer, ignoring")
+		}
+	}
+
+	// Create the global output file
+	globalFile, err := os.Create(path.Join(c.CacheDirectory, "bird.conf"))
+	if err != nil {
+		return fmt.Errorf("create global BIRD output file: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer globalFile.Close()
+	if _, err := globalFile.WriteString(header); err != nil {
+		return fmt.Errorf("write global BIRD output file: %v", err)
+	}
+
+	// Render the global template and write to file
+	if err := GlobalTemplate.ExecuteTemplate(globalFile, "global.tmpl", c); err != nil {
+		return fmt.Errorf("execute global template: %v", err)
+	}
+	if err := globalFile.Close(); err != nil {
+		return fmt.Errorf("close global BIRD output file: %v", err)
+	}
+
+	// Remove old peer-specific configs and any config left from a previous daemon so they aren't moved into the BIRD directory
+	for _, glob := range []string{"AS*.conf", "frr.conf", "bgpd.conf"} {
+		if err := util.RemoveFileGlob(path.Join(c.CacheDirectory, glob)); err != nil {
+			return fmt.Errorf("removing old config files: %v", err)
+		}
+	}
+
+	for _, peerName := range sortedPeerNames(c) {
+		peerData := c.Peers[peerName]
+
+		// Render the template and write to buffer
+		peerData.Protocols = &[]string{}
+		peerData.NeighborProtocols = &map[string]string{}
+		var b bytes.Buffer
+		logging.Peer(peerName).Debug("Writing config")
+		if err := PeerTemplate.ExecuteTemplate(&b, "peer.tmpl", &Wrapper{Name: peerName, Peer: *peerData, Config: c}); err != nil {
+			return fmt.Errorf("execute template: %v", err)
+		}
+
+		// Reformat config and write template to peer file
+		peerFileName := path.Join(c.CacheDirectory, fmt.Sprintf("AS%d_%s.conf", *peerData.ASN, *util.Sanitize(peerName)))
+		if err := ioutil.WriteFile(peerFileName, []byte(peerHeaders[peerName]+bird.Reformat(b.String())), 0644); err != nil {
+			return fmt.Errorf("write peer specific output file: %v", err)
+		}
+		logging.Peer(peerName).Debug("Wrote config")
+	}
+
+	return nil // nil error
+}
+
+// birdFiles returns bird.conf and the peer configs in a directory
+func birdFiles(dir string) ([]string, error) {
+	peerFiles, err := filepath.Glob(path.Join(dir, "AS*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{path.Join(dir, "bird.conf")}, peerFiles...), nil // nil error
+}
+
+// CacheFiles returns the BIRD configs in the cache directory
+func (BIRD) CacheFiles(c *config.Config) ([]string, error) {
+	return birdFiles(c.CacheDirectory)
+}
+
+// RunningFiles returns the BIRD configs in the BIRD directory
+func (BIRD) RunningFiles(c *config.Config) ([]string, error) {
+	return birdFiles(c.BIRDDirectory)
+}
+
+// session stores a single BGP neighbor of a peer
+type session struct {
+	Name     string
+	Neighbor string
+	AF       string
+	Families []string
+}
+
+// peerSessions stores a peer and its BGP neighbors for renderers that write a single config file
+type peerSessions struct {
+	Name      string
+	Header    string
+	Peer      *config.Peer
+	ListName  string
+	Prefixes4 []string
+	Prefixes6 []string
+	Sessions  []session
+}
+
+// unsupportedOption stores a peer option that a renderer doesn't support and whether a peer sets it
+type unsupportedOption struct {
+	option string
+	set    func(p *config.Peer) bool
+}
+
+// buildPeers splits each peer into its BGP neighbors in name order, warning about unsupported options the daemon ignores.
+// Rejected options would weaken a peer's filtering, authentication, or isolation if ignored, so they return an error instead.
+// Link-local neighbors are skipped unless the daemon supports interface scoped neighbor addresses.
+func buildPeers(c *config.Config, peerHeaders map[string]string, daemon string, unsupported []unsupportedOption, rejected []unsupportedOption, linkLocal bool) ([]*peerSessions, error) {
+	var peers []*peerSessions
+	for _, peerName := range sortedPeerNames(c) {
+		peerData := c.Peers[peerName]
+		for _, option := range rejected {
+			if option.set(peerData) {
+				return nil, fmt.Errorf("peer %s: %s isn't supported by the %s renderer", peerName, option.option, daemon)
+			}
+		}
+		for _, option := range unsupported {
+			if option.set(peerData) {
+				logging.Peer(peerName).Warnf("%s isn't supported by the %s renderer, ignoring", option.option, daemon)
+			}
+		}
+
+		peerData.Protocols = &[]string{}
+		peerData.NeighborProtocols = &map[string]string{}
+		p := &peerSessions{
+			Name:      peerName,
+			Header:    peerHeaders[peerName],
+			Peer:      peerData,
+			ListName:  fmt.Sprintf("AS%d_%s", *peerData.ASN, *peerData.ProtocolName),
+			Prefixes4: peerData.PrefixSet4.PrefixList(),
+			Prefixes6: peerData.PrefixSet6.PrefixList(),
+		}
+		for _, neighbor := range *peerData.NeighborIPs {
+			address, zone := util.SplitZone(neighbor)
+			if zone != "" && !linkLocal {
+				logging.Peer(peerName).Warnf("Link-local neighbor %s isn't supported by the %s renderer, skipping", neighbor, daemon)
+				continue
+			}
+			af := "4"
+			if strings.Contains(address, ":") {
+				af = "6"
+			}
+			s := session{
+				Name:     neighborProtocolName(peerData.FamilyProtocolName(af), peerData.Protocols, peerData.NeighborProtocols, neighbor),
+				Neighbor: neighbor,
+				AF:       af,
+				Families: []string{af},
+			}
+			if peerData.MPUnicast46 != nil && *peerData.MPUnicast46 {
+				s.Families = []string{"4", "6"}
+			}
+			p.Sessions = append(p.Sessions, s)
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil // nil error
+}
@@ -2,26 +2,30 @@ package templating
 
 import (
 	"embed"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 
 	"github.com/natesales/pathvector/internal/config"
 	"github.com/natesales/pathvector/internal/util"
 )
 
-var protocolNames []string
+var protocolNames = map[string]bool{}
 
 // Wrapper is passed to the peer template
 type Wrapper struct {
 	Name   string
 	Peer   config.Peer
-	Config config.Config
+	Config *config.Config
 }
 
 // Template functions
@@ -41,8 +45,24 @@ var funcMap = template.FuncMap{
 		return items
 	},
 
-	"BirdSet": func(prefixes []string) string {
+	"NeighborAddress": func(neighbor string) string {
+		// Neighbor IP without the interface zone
+		address, _ := util.SplitZone(neighbor)
+		return address
+	},
+
+	"NeighborInterface": func(neighbor string) string {
+		// Interface zone of a link-local neighbor
+		_, zone := util.SplitZone(neighbor)
+		return zone
+	},
+
+	"BirdSet": func(prefixLists ...[]string) string {
 		// Build a formatted BIRD prefix list
+		var prefixes []string
+		for _, prefixList := range prefixLists {
+			prefixes = append(prefixes, prefixList...)
+		}
 		output := ""
 		for i, prefix := range prefixes {
 			output += "  " + prefix
@@ -54,11 +74,6 @@ var funcMap = template.FuncMap{
 		return output
 	},
 
-	"Empty": func(arr *[]string) bool {
-		// Is `arr` empty?
-		return arr == nil || len(*arr) == 0
-	},
-
 	"Timestamp": func(format string) string {
 		// Get current timestamp
 		if format == "unix" {
@@ -124,6 +139,13 @@ var funcMap = template.FuncMap{
 		return map[uint32]uint32{}
 	},
 
+	"Uint32SliceDeref": func(s *[]uint32) []uint32 {
+		if s != nil {
+			return *s
+		}
+		return []uint32{}
+	},
+
 	"StrSliceDeref": func(s *[]string) []string {
 		if s != nil {
 			return *s
@@ -138,19 +160,38 @@ var funcMap = template.FuncMap{
 		return ""
 	},
 
-	// UniqueProtocolName takes a protocol-safe string and address family and returns a unique protocol name
-	"UniqueProtocolName": func(s *string, af string) string {
-		protoName := fmt.Sprintf("%sv%s", *s, af)
-		i := 1
-		for {
-			if !util.Contains(protocolNames, protoName) {
-				protocolNames = append(protocolNames, protoName)
-				return protoName
-			}
-			protoName = fmt.Sprintf("%sv%s_%d", *s, af, i)
-			i++
-		}
+	"UniqueProtocolName":   uniqueProtocolName,
+	"NeighborProtocolName": neighborProtocolName,
+
+	"FRRCommunity": func(community string) string {
+		// Convert a BIRD community tuple to FRR colon notation
+		return strings.ReplaceAll(strings.ReplaceAll(community, " ", ""), ",", ":")
 	},
+
+	"OpenBGPDPrefix": openBGPDPrefix,
+}
+
+// uniqueProtocolName takes a protocol name and returns a unique protocol name
+// The name is also appended to the peer's list of generated protocols if one is provided
+func uniqueProtocolName(s string, peerProtocols *[]string) string {
+	protoName := s
+	for i := 1; protocolNames[protoName]; i++ {
+		protoName = fmt.Sprintf("%s_%d", s, i)
+	}
+	protocolNames[protoName] = true
+	if peerProtocols != nil {
+		*peerProtocols = append(*peerProtocols, protoName)
+	}
+	return protoName
+}
+
+// neighborProtocolName returns a unique protocol name for a peer's neighbor, recording it in the peer's protocols and neighbor to protocol map
+func neighborProtocolName(s string, peerProtocols *[]string, neighborProtocols *map[string]string, neighbor string) string {
+	protoName := uniqueProtocolName(s, peerProtocols)
+	if neighborProtocols != nil {
+		(*neighborProtocols)[neighbor] = protoName
+	}
+	return protoName
 }
 
 // Templates
@@ -159,11 +200,16 @@ var PeerTemplate *template.Template
 var GlobalTemplate *template.Template
 var UITemplate *template.Template
 var VRRPTemplate *template.Template
+var FRRTemplate *template.Template
+var OpenBGPDTemplate *template.Template
 
 // Load loads the templates from the embedded filesystem
 func Load(fs embed.FS) error {
 	var err error
 
+	// Reset generated protocol names so they stay stable across runs of a long-running process
+	protocolNames = map[string]bool{}
+
 	// Generate peer template
 	PeerTemplate, err = template.New("").Funcs(funcMap).ParseFS(fs, "templates/peer.tmpl")
 	if err != nil {
@@ -188,44 +234,280 @@ func Load(fs embed.FS) error {
 		return fmt.Errorf("reading VRRP template: %v", err)
 	}
 
+	// Generate FRR template
+	FRRTemplate, err = template.New("").Funcs(funcMap).ParseFS(fs, "templates/frr.tmpl")
+	if err != nil {
+		return fmt.Errorf("reading FRR template: %v", err)
+	}
+
+	// Generate OpenBGPD template
+	OpenBGPDTemplate, err = template.New("").Funcs(funcMap).ParseFS(fs, "templates/openbgpd.tmpl")
+	if err != nil {
+		return fmt.Errorf("reading OpenBGPD template: %v", err)
+	}
+
 	return nil // nil error
 }
 
-// WriteVRRPConfig writes the VRRP config to a keepalived config file
-func WriteVRRPConfig(instances map[string]*config.VRRPInstance, keepalivedConfig string) {
-	if len(instances) < 1 {
+// vrrpInstance stores a single address family keepalived instance of a VRRP instance
+type vrrpInstance struct {
+	*config.VRRPInstance
+	Name          string
+	VRID          uint
+	IPv6          bool
+	VIPs          []string
+	UnicastSource string
+	UnicastPeers  []string
+}
+
+// vrrpSyncGroup stores a sync group with the keepalived names of its member instances
+type vrrpSyncGroup struct {
+	*config.VRRPSyncGroup
+	Instances []string
+}
+
+// vrrpConfig stores the VRRP instances and sync groups to render
+type vrrpConfig struct {
+	Scripts       []config.VRRPTrackScript
+	Instances     []vrrpInstance
+	SyncGroups    map[string]vrrpSyncGroup
+	NotifyCommand string
+}
+
+// filterFamily returns the addresses in the given address family
+func filterFamily(addresses []string, ipv6 bool) []string {
+	var filtered []string
+	for _, address := range addresses {
+		if strings.Contains(address, ":") == ipv6 {
+			filtered = append(filtered, address)
+		}
+	}
+	return filtered
+}
+
+// vrrpFamilyInstances splits a VRRP instance into one keepalived instance per address family, as a single VRRP instance can't carry both
+func vrrpFamilyInstances(name string, instance *config.VRRPInstance) []vrrpInstance {
+	var families []bool // IPv6
+	if len(instance.VIPs4) > 0 || len(instance.VIPs6) == 0 {
+		families = append(families, false)
+	}
+	if len(instance.VIPs6) > 0 {
+		families = append(families, true)
+	}
+
+	var instances []vrrpInstance
+	for _, ipv6 := range families {
+		i := vrrpInstance{
+			VRRPInstance: instance,
+			Name:         "VRRP" + name,
+			VRID:         instance.VRID,
+			IPv6:         ipv6,
+			VIPs:         instance.VIPs4,
+			UnicastPeers: filterFamily(instance.UnicastPeers, ipv6),
+		}
+		if ipv6 {
+			i.VIPs = instance.VIPs6
+		}
+		if len(filterFamily([]string{instance.UnicastSource}, ipv6)) > 0 {
+			i.UnicastSource = instance.UnicastSource
+		}
+		if len(families) > 1 {
+			if ipv6 {
+				i.Name += "v6"
+				i.VRID += instance.VRID6Offset
+			} else {
+				i.Name += "v4"
+			}
+		}
+		instances = append(instances, i)
+	}
+	return instances
+}
+
+// WriteVRRPConfig writes the VRRP config to a keepalived config file, skipping instances run by the builtin and carp implementations.
+// notifyCommand is run with the instance protocol name and new state for instances with conditional origin prefixes.
+// header is written at the start of the file.
+func WriteVRRPConfig(instances map[string]*config.VRRPInstance, syncGroups map[string]*config.VRRPSyncGroup, notifyCommand string, header string, keepalivedConfig string) error {
+	var names []string
+	for name, instance := range instances {
+		if instance.Implementation != "builtin" && instance.Implementation != "carp" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) < 1 {
 		log.Infof("No VRRP instances are defined, not writing config")
-		return
+		return nil
+	}
+
+	vrrp := vrrpConfig{SyncGroups: map[string]vrrpSyncGroup{}, NotifyCommand: notifyCommand}
+	familyNames := map[string][]string{} // VRRP instance name to keepalived instance names
+	for _, name := range names {
+		vrrp.Scripts = append(vrrp.Scripts, instances[name].TrackScripts...)
+		for _, i := range vrrpFamilyInstances(name, instances[name]) {
+			vrrp.Instances = append(vrrp.Instances, i)
+			familyNames[name] = append(familyNames[name], i.Name)
+		}
+	}
+	for groupName, group := range syncGroups {
+		g := vrrpSyncGroup{VRRPSyncGroup: group}
+		for _, name := range group.Instances {
+			g.Instances = append(g.Instances, familyNames[name]...)
+		}
+		vrrp.SyncGroups[groupName] = g
 	}
 
 	// Create the VRRP config file
 	keepalivedFile, err := os.Create(keepalivedConfig)
 	if err != nil {
-		log.Fatalf("Create keepalived output file: %v", err)
+		return fmt.Errorf("create keepalived output file: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer keepalivedFile.Close()
+	if _, err := keepalivedFile.WriteString(header); err != nil {
+		return fmt.Errorf("write keepalived output file: %v", err)
 	}
 
 	// Render the template and write to disk
-	err = VRRPTemplate.ExecuteTemplate(keepalivedFile, "vrrp.tmpl", instances)
+	if err := VRRPTemplate.ExecuteTemplate(keepalivedFile, "vrrp.tmpl", vrrp); err != nil {
+		return fmt.Errorf("execute template: %v", err)
+	}
+	return nil // nil error
+}
+
+// neighbor stores a single birdwatcher/Alice-LG compatible BGP neighbor
+type neighbor struct {
+	Protocol        string `json:"protocol"`
+	NeighborAddress string `json:"neighbor_address"`
+	NeighborAS      int    `json:"neighbor_as"`
+	Description     string `json:"description"`
+	Type            string `json:"type"`
+	Peer            string `json:"peer"`
+}
+
+// peerType returns the looking glass neighbor type of a peer
+func peerType(peer *config.Peer) string {
+	if peer.RSClient != nil && *peer.RSClient {
+		return "rs-client"
+	} else if peer.RRClient != nil && *peer.RRClient {
+		return "rr-client"
+	}
+	return "peer"
+}
+
+// WriteNeighborsFile writes a birdwatcher/Alice-LG compatible JSON file of BGP neighbors keyed by protocol name
+func WriteNeighborsFile(c *config.Config) error {
+	protocols := map[string]neighbor{}
+	for peerName, peer := range c.Peers {
+		if peer.NeighborProtocols == nil {
+			continue
+		}
+		// Descriptions are rendered from the description template when the config is loaded
+		description := util.StrDeref(peer.Description)
+
+		for neighborIP, protocol := range *peer.NeighborProtocols {
+			protocols[protocol] = neighbor{
+				Protocol:        protocol,
+				NeighborAddress: neighborIP,
+				NeighborAS:      *peer.ASN,
+				Description:     description,
+				Type:            peerType(peer),
+				Peer:            peerName,
+			}
+		}
+	}
+
+	neighborsJSON, err := json.MarshalIndent(map[string]interface{}{"protocols": protocols}, "", "  ")
 	if err != nil {
-		log.Fatalf("Execute template: %v", err)
+		return fmt.Errorf("marshal neighbors JSON: %v", err)
 	}
+	if err := ioutil.WriteFile(c.NeighborsFile, neighborsJSON, 0644); err != nil {
+		return fmt.Errorf("write neighbors file: %v", err)
+	}
+	log.Debugf("Wrote %d neighbors to %s", len(protocols), c.NeighborsFile)
+	return nil // nil error
+}
+
+// WriteBirdLGConfig writes the bird-lg-go frontend and proxy config files, starting each with header
+func WriteBirdLGConfig(c *config.Config, header string) error {
+	servers := []string{c.Hostname}
+	for _, server := range c.BirdLG.Servers {
+		if !util.Contains(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+
+	title := c.BirdLG.Title
+	if title == "" {
+		title = fmt.Sprintf("AS%d Looking Glass", c.ASN)
+	}
+
+	if c.BirdLG.FrontendFile != "" {
+		frontend := map[string]interface{}{
+			"servers":     strings.Join(servers, ","),
+			"domain":      c.BirdLG.Domain,
+			"listen":      c.BirdLG.Listen,
+			"proxy_port":  c.BirdLG.ProxyPort,
+			"title_brand": title,
+		}
+		if len(c.BirdLG.ProtocolFilter) > 0 {
+			frontend["protocol_filter"] = strings.Join(c.BirdLG.ProtocolFilter, ",")
+		}
+		if err := writeYAML(c.BirdLG.FrontendFile, header, frontend); err != nil {
+			return err
+		}
+	}
+
+	if c.BirdLG.ProxyFile != "" {
+		proxy := map[string]interface{}{
+			"bird_socket": c.BIRDSocket,
+			"listen":      c.BirdLG.ProxyListen,
+		}
+		if len(c.BirdLG.AllowedIPs) > 0 {
+			proxy["allowed"] = strings.Join(c.BirdLG.AllowedIPs, ",")
+		}
+		if !c.BirdLG.Traceroute {
+			// bird-lg-go disables traceroute when the binary doesn't exist
+			proxy["traceroute_bin"] = "/nonexistent"
+		}
+		if err := writeYAML(c.BirdLG.ProxyFile, header, proxy); err != nil {
+			return err
+		}
+	}
+	return nil // nil error
+}
+
+// writeYAML marshals a value and writes it to a file after a header
+func writeYAML(file string, header string, v interface{}) error {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %v", file, err)
+	}
+	if err := ioutil.WriteFile(file, append([]byte(header), out...), 0644); err != nil {
+		return fmt.Errorf("write %s: %v", file, err)
+	}
+	log.Debugf("Wrote %s", file)
+	return nil // nil error
 }
 
 // WriteUIFile renders and writes the web UI file
-func WriteUIFile(config *config.Config) {
+func WriteUIFile(config *config.Config) error {
 	// Create the UI output file
 	log.Debug("Creating UI output file")
 	uiFileObj, err := os.Create(config.WebUIFile)
 	if err != nil {
-		log.Fatalf("Create UI output file: %v", err)
+		return fmt.Errorf("create UI output file: %v", err)
 	}
+	//noinspection GoUnhandledErrorResult
+	defer uiFileObj.Close()
 	log.Debug("Finished creating UI file")
 
 	// Render the UI template and write to disk
 	log.Debug("Writing UI file")
-	err = UITemplate.ExecuteTemplate(uiFileObj, "ui.tmpl", config)
-	if err != nil {
-		log.Fatalf("Execute UI template: %v", err)
+	if err := UITemplate.ExecuteTemplate(uiFileObj, "ui.tmpl", config); err != nil {
+		return fmt.Errorf("execute UI template: %v", err)
 	}
 	log.Debug("Finished writing UI file")
+	return nil // nil error
 }
@@ -1,10 +1,18 @@
 package templating
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/natesales/pathvector/internal/config"
 	"github.com/natesales/pathvector/internal/embed"
+	"github.com/natesales/pathvector/internal/prefixset"
+	"github.com/natesales/pathvector/internal/slurm"
+	"github.com/natesales/pathvector/internal/util"
 )
 
 func TestLoadTemplates(t *testing.T) {
@@ -14,13 +22,549 @@ func TestLoadTemplates(t *testing.T) {
 }
 
 func TestWriteUIFile(t *testing.T) {
-	WriteUIFile(&config.Config{WebUIFile: "/tmp/pathvector-go-test-ui.html"})
+	if err := WriteUIFile(&config.Config{WebUIFile: "/tmp/pathvector-go-test-ui.html"}); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestWriteBlankVRRPConfig(t *testing.T) {
-	WriteVRRPConfig(map[string]*config.VRRPInstance{}, "/tmp/pathvector-go-test-keepalived.conf")
+	if err := WriteVRRPConfig(map[string]*config.VRRPInstance{}, nil, "", "", "/tmp/pathvector-go-test-keepalived.conf"); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestWriteVRRPConfig(t *testing.T) {
-	WriteVRRPConfig(map[string]*config.VRRPInstance{"VRRP 1": {State: "primary"}}, "/tmp/pathvector-go-test-keepalived.conf")
+	if err := WriteVRRPConfig(map[string]*config.VRRPInstance{"VRRP 1": {State: "primary"}}, nil, "", "", "/tmp/pathvector-go-test-keepalived.conf"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteVRRPConfigOptions(t *testing.T) {
+	if err := WriteVRRPConfig(map[string]*config.VRRPInstance{"VRRP 1": {
+		State:           "BACKUP",
+		AdvertInterval:  2,
+		UnicastSource:   "192.0.2.1",
+		UnicastPeers:    []string{"192.0.2.2", "192.0.2.3"},
+		AuthType:        "PASS",
+		AuthPassword:    "secret",
+		NoPreempt:       true,
+		PreemptDelay:    30,
+		GARPMasterDelay: 5,
+		TrackInterfaces: []config.VRRPTrackInterface{{Interface: "eth0", Weight: -20}},
+		TrackScripts:    []config.VRRPTrackScript{{Name: "VRRP_1_0", Script: "/usr/local/bin/check-bird", Interval: 2, Weight: -30, Fall: 2, Rise: 1}},
+		Originate:       []string{"198.51.100.0/24"},
+		ProtocolName:    "VRRP_VRRP_1",
+	}, "VRRP 2": {State: "BACKUP", AdvertInterval: 1}, "VRRP 3": {State: "BACKUP", Implementation: "builtin"}}, map[string]*config.VRRPSyncGroup{"GATEWAY": {
+		Instances:    []string{"VRRP 1", "VRRP 2"},
+		NotifyMaster: "/usr/local/bin/primary",
+	}}, "/usr/bin/pathvector --config /etc/pathvector.yml vrrp notify", "# pathvector-version: devel\n", "/tmp/pathvector-go-test-keepalived.conf"); err != nil {
+		t.Fatal(err)
+	}
+	keepalived, err := ioutil.ReadFile("/tmp/pathvector-go-test-keepalived.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(keepalived), "# pathvector-version: devel\n") {
+		t.Errorf("expected provenance header in keepalived config: %s", keepalived)
+	}
+	for _, line := range []string{"advert_int 2", "nopreempt", "preempt_delay 30", "garp_master_delay 5", "unicast_src_ip 192.0.2.1", "        192.0.2.3", "auth_type PASS", "auth_pass secret", "eth0 weight -20", "vrrp_script VRRP_1_0 {", `script "/usr/local/bin/check-bird"`, "weight -30", "        VRRP_1_0\n", "vrrp_sync_group GATEWAY {", "        VRRPVRRP 2\n", `notify_master "/usr/local/bin/primary"`, `notify_master "/usr/bin/pathvector --config /etc/pathvector.yml vrrp notify VRRP_VRRP_1 primary"`} {
+		if !strings.Contains(string(keepalived), line) {
+			t.Errorf("expected %s in keepalived config: %s", line, keepalived)
+		}
+	}
+	if strings.Contains(string(keepalived), "VRRPVRRP 3") {
+		t.Errorf("expected builtin instance to be skipped in keepalived config: %s", keepalived)
+	}
+}
+
+func TestWriteVRRPConfigDualStack(t *testing.T) {
+	if err := WriteVRRPConfig(map[string]*config.VRRPInstance{"GW": {
+		State:          "MASTER",
+		Interface:      "eth0",
+		VRID:           10,
+		VRID6Offset:    100,
+		AdvertInterval: 1,
+		UnicastPeers:   []string{"192.0.2.2", "2001:db8::2"},
+		AuthType:       "PASS",
+		AuthPassword:   "secret",
+		VIPs4:          []string{"192.0.2.1/24"},
+		VIPs6:          []string{"2001:db8::1/64"},
+	}}, map[string]*config.VRRPSyncGroup{"GATEWAY": {Instances: []string{"GW"}}}, "", "", "/tmp/pathvector-go-test-keepalived.conf"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile("/tmp/pathvector-go-test-keepalived.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keepalived := string(b)
+
+	v4 := keepalived[strings.Index(keepalived, "vrrp_instance VRRPGWv4 {"):strings.Index(keepalived, "vrrp_instance VRRPGWv6 {")]
+	v6 := keepalived[strings.Index(keepalived, "vrrp_instance VRRPGWv6 {"):strings.Index(keepalived, "vrrp_sync_group")]
+	for _, line := range []string{"virtual_router_id 10\n", "192.0.2.1/24", "192.0.2.2", "auth_type PASS"} {
+		if !strings.Contains(v4, line) {
+			t.Errorf("expected %s in IPv4 instance: %s", line, v4)
+		}
+	}
+	for _, line := range []string{"virtual_router_id 110\n", "2001:db8::1/64", "2001:db8::2"} {
+		if !strings.Contains(v6, line) {
+			t.Errorf("expected %s in IPv6 instance: %s", line, v6)
+		}
+	}
+	for _, line := range []string{"192.0.2", "auth_type", "virtual_ipaddress_excluded"} {
+		if strings.Contains(v6, line) {
+			t.Errorf("unexpected %s in IPv6 instance: %s", line, v6)
+		}
+	}
+	if !strings.Contains(keepalived, "        VRRPGWv4\n        VRRPGWv6\n") {
+		t.Errorf("expected both address family instances in sync group: %s", keepalived)
+	}
+}
+
+func TestWriteNeighborsFile(t *testing.T) {
+	if err := WriteNeighborsFile(&config.Config{
+		NeighborsFile: "/tmp/pathvector-go-test-neighbors.json",
+		Peers: map[string]*config.Peer{
+			"Example": {
+				ASN:         util.IntPtr(65510),
+				NeighborIPs: &[]string{"fe80::1%eth0", "2001:db8::1"},
+				RSClient:    util.BoolPtr(true),
+				Protocols:   &[]string{"EXAMPLEv6"},
+				// The link-local neighbor was skipped by the renderer
+				NeighborProtocols: &map[string]string{"2001:db8::1": "EXAMPLEv6"},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	neighbors, err := ioutil.ReadFile("/tmp/pathvector-go-test-neighbors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(neighbors), `"protocol": "EXAMPLEv6",
+      "neighbor_address": "2001:db8::1"`) || !strings.Contains(string(neighbors), `"type": "rs-client"`) {
+		t.Errorf("unexpected neighbors file: %s", neighbors)
+	}
+}
+
+func TestNeighborProtocols(t *testing.T) {
+	if err := Load(embed.FS); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+daemon: frr
+cache-directory: ` + t.TempDir() + `
+peers:
+  Example:
+    asn: 65530
+    neighbors: ["fe80::1%eth0", 192.0.2.2, 2001:db8::2]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Renderers["frr"].Render(c, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"192.0.2.2": "EXAMPLEv4", "2001:db8::2": "EXAMPLEv6"}
+	if !reflect.DeepEqual(*c.Peers["Example"].NeighborProtocols, expected) {
+		t.Errorf("unexpected neighbor protocols %v", *c.Peers["Example"].NeighborProtocols)
+	}
+}
+
+func TestWriteBirdLGConfig(t *testing.T) {
+	if err := WriteBirdLGConfig(&config.Config{
+		ASN:        65510,
+		Hostname:   "router1",
+		BIRDSocket: "/run/bird/bird.ctl",
+		BirdLG: config.BirdLG{
+			FrontendFile: "/tmp/pathvector-go-test-bird-lg.yaml",
+			ProxyFile:    "/tmp/pathvector-go-test-bird-lgproxy.yaml",
+			Servers:      []string{"router2", "router1"},
+			AllowedIPs:   []string{"192.0.2.1"},
+		},
+	}, ""); err != nil {
+		t.Fatal(err)
+	}
+	frontend, err := ioutil.ReadFile("/tmp/pathvector-go-test-bird-lg.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(frontend), "servers: router1,router2") {
+		t.Errorf("unexpected frontend config: %s", frontend)
+	}
+	proxy, err := ioutil.ReadFile("/tmp/pathvector-go-test-bird-lgproxy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(proxy), "bird_socket: /run/bird/bird.ctl") || !strings.Contains(string(proxy), "allowed: 192.0.2.1") {
+		t.Errorf("unexpected proxy config: %s", proxy)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pathvector-renderer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, daemon := range []string{"bird", "frr", "openbgpd"} {
+		// Loading the templates resets the generated protocol names
+		if err := Load(embed.FS); err != nil {
+			t.Fatal(err)
+		}
+		c, err := config.Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+rtr-servers:
+  - server: 192.0.2.3:8282
+  - server: rtr.example.com:22
+    preference: 2
+    transport: ssh
+    ssh-user: rpki
+    ssh-private-key: /etc/rtr_key
+action-communities:
+  enabled: true
+vrfs:
+  customer-a:
+    interface: vrf-a
+    kernel-table: 100
+    route-distinguisher: "34553:1"
+    import-targets: ["34553:1"]
+    export-targets: ["34553:1"]
+  customer-b:
+    interface: vrf-b
+    kernel-table: 200
+    source4: 198.51.100.1
+    prefixes: [198.51.100.0/24]
+    import-master: true
+ospf:
+  redistribute: [static]
+  areas:
+    "0":
+      interfaces:
+        eth0:
+          cost: 20
+babel:
+  interfaces:
+    "wg*":
+      rxcost: 96
+isis:
+  net: 49.0001.1920.0000.2001.00
+  redistribute: [static]
+  interfaces:
+    eth1:
+      passive: true
+tcp-ao-key-chains:
+  customer:
+    keys:
+      - send-id: 1
+        recv-id: 1
+        secret: old
+      - send-id: 2
+        recv-id: 2
+        secret: new
+        algorithm: hmac-sha256
+        preferred: true
+flowspec-rules:
+  ntp:
+    destination: 192.0.2.0/24
+    protocols: [17]
+    source-ports: ["123"]
+augments:
+  statics:
+    198.51.101.0/24:
+      nexthops:
+        - address: 192.0.2.11
+          weight: 2
+        - address: 192.0.2.12
+          onlink: true
+      preference: 150
+    203.0.113.0/24: prohibit
+  vxlan:
+    tenant-a:
+      vni: 10100
+      route-distinguisher: "192.0.2.1:100"
+      import-targets: ["65530:10100"]
+daemon: ` + daemon + `
+cache-directory: ` + dir + `
+prefixes: [192.0.2.0/24, 2001:db8::/48]
+peers:
+  Example:
+    asn: 65530
+    neighbors: [203.0.113.2, 2001:db8::2]
+    filter-irr: true
+    filter-as-path: true
+    filter-aspa: true
+    as-set: AS-EXAMPLE
+    prepends: 2
+    flowspec: true
+    afi-safi: [vpn6-unicast, l2vpn-evpn]
+    import-communities: ["65530:1", "rt:65530:1"]
+    llgr: true
+    llgr-stale-time: 86400
+    hold-time: 90
+    role: customer
+    listen-interface: eth2
+  Customer:
+    asn: 65540
+    neighbors: [203.0.113.3]
+    vrf: customer-b
+    tcp-ao-key-chain: customer
+    as-override: true
+    role: provider
+    require-role: true
+    tcp-mss: 1400
+    interface: gre1
+    bfd: true
+    announce-ospf: true
+    announce-babel: true
+    announce-isis: true
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer := c.Peers["Example"]
+		if daemon == "frr" {
+			peer.BFDStrict = util.BoolPtr(true)
+			peer.FilterASPA = util.BoolPtr(false)
+		}
+		// FRR and OpenBGPD reject VRF, TCP-AO, and (OpenBGPD) interface bound peers
+		if daemon != "bird" {
+			customer := c.Peers["Customer"]
+			customer.VRF = nil
+			customer.TCPAOKeyChain = nil
+			if daemon == "openbgpd" {
+				customer.Interface = nil
+				peer.ListenInterface = nil
+			}
+		}
+		peer.PrefixSet4, _ = prefixset.New("198.51.100.0/24+")
+		peer.PrefixSet6, _ = prefixset.New("2001:db8:1::/48")
+		peer.OriginASNs = &[]uint32{65530, 65531}
+		c.SLURM, err = slurm.Parse([]byte(`{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [{"asn": 64496}], "bgpsecFilters": []},
+"locallyAddedAssertions": {"prefixAssertions": [{"asn": 64496, "prefix": "198.51.100.0/24"}], "bgpsecAssertions": []}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Renderers[c.Daemon].Render(c, "# header\n", map[string]string{"Example": "# peer header\n"}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*peer.Protocols, []string{"EXAMPLEv4", "EXAMPLEv6"}) {
+			t.Errorf("%s: unexpected protocols %v", daemon, *peer.Protocols)
+		}
+		files, err := Renderers[c.Daemon].CacheFiles(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if _, err := os.Stat(file); err != nil {
+				t.Errorf("%s: rendered file %s: %v", daemon, file, err)
+			}
+		}
+		if daemon == "bird" && len(files) != 3 {
+			t.Errorf("expected bird.conf and 2 peer files, got %v", files)
+		}
+	}
+
+	global, err := ioutil.ReadFile(path.Join(dir, "bird.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"aspa table aspas;\n",
+		"route 198.51.101.0/24 via 192.0.2.11 weight 2 via 192.0.2.12 onlink { preference = 150; };\n",
+		"route 203.0.113.0/24 prohibit { bgp_community.add((65535,666)); };\n",
+		"transport tcp;\n  remote \"192.0.2.3\" port 8282;\n",
+		"filter slurm_v4 {\n  if (net.asn = 64496) then reject;\n  accept;\n}\n",
+		"protocol static SLURM_v4 {\n  roa4 { table rpki4; };\n  route 198.51.100.0/24 max 24 as 64496;\n}\n",
+		"roa6 { table rpki6; import filter slurm_v6; };\n",
+		"transport ssh {\n    bird private key \"/etc/rtr_key\";\n",
+		"aspa { table aspas; };\n",
+		"function reject_aspa_invalid() {\n",
+		"if (defined(bgp_otc) && bgp_otc != peer_asn) then _reject(\"route leak (OTC from another AS)\");\n",
+		"for int path_asn in bgp_path do {\n    if (path_asn = peer_asn) then reversed.prepend(ASN); else reversed.prepend(path_asn);\n  }\n",
+		"if ((34553, 1000, peer_asn) ~ bgp_large_community || (34553, 1000, 0) ~ bgp_large_community) then reject;\n",
+		"bgp_large_community.delete([(34553, 1000, *), (34553, 2000, *), (34553, 3000, *), (34553, 4000, *), (34553, 5000, *)]);\n",
+		"flow4 table flowtab4;\n",
+		"mpls domain mdom;\n",
+		"protocol l3vpn VRF_CUSTOMERA {\n  vrf \"vrf-a\";\n",
+		"import target [(rt,34553,1)];\n",
+		"protocol ospf v3 ospf6 {\n  ipv6 {\n    import all;\n    export filter {\n      if source = RTS_STATIC then accept;\n      reject;\n",
+		"  area 0 {\n    interface \"eth0\" {\n      cost 20;\n    };\n  };\n",
+		"protocol babel babel {\n",
+		"  interface \"wg*\" {\n    type wired;\n    rxcost 96;\n  };\n",
+		"function vrf_customerb_accept_local() {\n  if (proto = \"VRF_CUSTOMERB_static4\") then accept;\n}\n",
+		"protocol static VRF_CUSTOMERB_static4 {\n  ipv4 { table vrf_customerb4; };\n  route 198.51.100.0/24 reject;\n}\n",
+		"protocol pipe VRF_CUSTOMERB_pipe6 {\n  table master6;\n  peer table vrf_customerb6;\n",
+		"if source = RTS_BGP then krt_prefsrc = 198.51.100.1;\n",
+		"route flow4 { dst 192.0.2.0/24; proto 17; sport 123; } { bgp_ext_community.add((generic, 0x80060000, 0x0)); };\n",
+	} {
+		if !strings.Contains(string(global), line) {
+			t.Errorf("expected %q in BIRD global config: %s", line, global)
+		}
+	}
+	bird, err := ioutil.ReadFile(path.Join(dir, "AS65530_EXAMPLE.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"define AS65530_EXAMPLE_ORIGINS = [ 65530, 65531 ];\n",
+		"enforce_origin_asns(AS65530_EXAMPLE_ORIGINS);\n",
+		"interface \"eth2\";\n",
+		"reject_aspa_invalid();\n",
+		"apply_action_communities(65530);\n",
+		"bgp_ext_community.add((rt,65530,1));\n",
+		"mpls { label policy aggregate; };\n",
+		"vpn6 mpls {\n        table vpntab6;\n",
+		"hold time 90;\n    keepalive time 30;\n    startup hold time 240;\n    connect retry time 120;\n",
+		"graceful restart on;\n    graceful restart time 120;\n",
+		"long lived graceful restart on;\n    long lived stale time 86400;\n",
+		"local role customer;\n",
+		"reject_otc_leak(65530);\n",
+		"flow4 {\n        table flowtab4;\n        import none;\n        export where proto = \"flowspec4\";\n    };\n",
+	} {
+		if !strings.Contains(string(bird), line) {
+			t.Errorf("expected %q in BIRD config: %s", line, bird)
+		}
+	}
+	customer, err := ioutil.ReadFile(path.Join(dir, "AS65540_CUSTOMER.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"interface \"gre1\";\n    vrf \"vrf-b\";\n",
+		"authentication ao;\n\n    keys {\n\n        key {\n            send id 1;\n            recv id 1;\n            secret \"old\";\n            algorithm hmac sha1;\n        };\n",
+		"secret \"new\";\n            algorithm hmac sha256;\n            preferred;\n        };\n    };\n",
+		"table vrf_customerb4;\n",
+		"vrf_customerb_accept_local();\n",
+		"as_override(65540);\n",
+		"local role provider;\n    require roles;\n    bfd on;\n",
+		"reject_otc_from_customer();\n",
+		"if (proto = \"ospf4\") then accept;\n",
+		"if (proto = \"babel\") then accept;\n",
+	} {
+		if !strings.Contains(string(customer), line) {
+			t.Errorf("expected %q in BIRD VRF peer config: %s", line, customer)
+		}
+	}
+	frr, err := ioutil.ReadFile(path.Join(dir, "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# header\nfrr defaults traditional\n",
+		"ip route 192.0.2.0/24 blackhole\n",
+		"ip route 198.51.101.0/24 192.0.2.12 150\n",
+		"ip route 203.0.113.0/24 reject\n",
+		"ip prefix-list LOCAL_v4 permit 192.0.2.0/24\n",
+		"ip prefix-list AS65530_EXAMPLE_NOT_PFX_v4 deny 198.51.100.0/24 le 32\n",
+		"ipv6 prefix-list AS65530_EXAMPLE_NOT_PFX_v6 deny 2001:db8:1::/48\n",
+		"bgp as-path access-list AS65530_EXAMPLE_NOT_ORIGINS deny _65530$\nbgp as-path access-list AS65530_EXAMPLE_NOT_ORIGINS deny _65531$\nbgp as-path access-list AS65530_EXAMPLE_NOT_ORIGINS permit .*\n",
+		"route-map EXAMPLEv4_IMPORT_v4 deny 70\n match as-path AS65530_EXAMPLE_NOT_ORIGINS\nroute-map EXAMPLEv4_IMPORT_v4 deny 80\n",
+		"route-map EXAMPLEv4_IMPORT_v4 deny 80\n match ip address prefix-list AS65530_EXAMPLE_NOT_PFX_v4\n",
+		" set community 65530:1 additive\n",
+		"route-map EXAMPLEv6_EXPORT_v6 permit 10\n match ipv6 address prefix-list LOCAL_v6\n set as-path prepend 34553 34553\n",
+		"router bgp 34553\n bgp router-id 192.0.2.1\n",
+		" neighbor 203.0.113.2 remote-as 65530\n",
+		" neighbor 203.0.113.2 update-source eth2\n",
+		" neighbor 2001:db8::2 update-source eth2\n",
+		" neighbor 203.0.113.3 tcp-mss 1400\n neighbor 203.0.113.3 interface gre1\n",
+		"  neighbor 203.0.113.3 as-override\n",
+		" neighbor 203.0.113.2 local-role customer\n",
+		" neighbor 203.0.113.2 bfd\n neighbor 203.0.113.2 bfd strict\n",
+		" neighbor 203.0.113.3 bfd\n",
+		" neighbor 203.0.113.3 local-role provider strict-mode\n",
+		" neighbor 203.0.113.2 graceful-restart\n neighbor 203.0.113.2 timers 30 90\n neighbor 203.0.113.2 timers connect 120\n",
+		" address-family ipv6 unicast\n  network 2001:db8::/48\n  neighbor 2001:db8::2 activate\n",
+		" address-family l2vpn evpn\n  neighbor 203.0.113.2 activate\n  neighbor 2001:db8::2 activate\n  advertise-all-vni\n",
+		"  vni 10100\n   rd 192.0.2.1:100\n   route-target import 65530:10100\n  exit-vni\n exit-address-family\n",
+		"interface eth1\n ip router isis pathvector\n ipv6 router isis pathvector\n isis passive\nexit\n",
+		"router isis pathvector\n net 49.0001.1920.0000.2001.00\n is-type level-2-only\n redistribute ipv4 static level-2\n redistribute ipv6 static level-2\nexit\n",
+		"  redistribute isis\n",
+		"route-map CUSTOMERv4_EXPORT_v4 permit 40\n match source-protocol isis\n",
+		" rpki cache tcp 192.0.2.3 8282 preference 1\n rpki cache ssh rtr.example.com 22 rpki /etc/rtr_key preference 2\n",
+	} {
+		if !strings.Contains(string(frr), line) {
+			t.Errorf("expected %q in FRR config: %s", line, frr)
+		}
+	}
+
+	bgpd, err := ioutil.ReadFile(path.Join(dir, "bgpd.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# header\nAS 34553\nrouter-id 192.0.2.1\n",
+		"rtr 192.0.2.3 {\n\tport 8282\n}\n",
+		"prefix-set LOCAL_v4 {\n\t192.0.2.0/24\n}\n",
+		"prefix-set AS65530_EXAMPLE_PFX {\n\t198.51.100.0/24 prefixlen 24 - 32\n\t2001:db8:1::/48\n}\n",
+		"network 2001:db8::/48\n",
+		"# peer header\ngroup \"Example\" {\n\tremote-as 65530\n\tneighbor 203.0.113.2 {\n",
+		"\t\tholdtime 90\n",
+		"\t\trole customer\n\t\tannounce restart yes\n",
+		"deny from any\ndeny to any\n",
+		"deny quick from group \"Example\" avs invalid\n",
+		"deny quick to group \"Example\" AS { 64512 - 65534 4200000000 - 4294967294 }\n",
+		"as-set AS65530_EXAMPLE_ORIGINS { 65530 65531 }\n",
+		`allow from group "Example" prefix-set AS65530_EXAMPLE_PFX source-as as-set AS65530_EXAMPLE_ORIGINS nexthop neighbor set { localpref 100 community 65530:1 }`,
+		`allow to group "Example" prefix-set LOCAL_v6 set { prepend-self 2 }`,
+	} {
+		if !strings.Contains(string(bgpd), line) {
+			t.Errorf("expected %q in OpenBGPD config: %s", line, bgpd)
+		}
+	}
+}
+
+func TestRenderRejected(t *testing.T) {
+	dir := t.TempDir()
+	for _, daemon := range []string{"frr", "openbgpd"} {
+		if err := Load(embed.FS); err != nil {
+			t.Fatal(err)
+		}
+		c, err := config.Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+daemon: ` + daemon + `
+cache-directory: ` + dir + `
+vrfs:
+  customer-a:
+    interface: vrf-a
+    kernel-table: 100
+peers:
+  Customer:
+    asn: 65540
+    neighbors: [203.0.113.3]
+    vrf: customer-a
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Renderers[daemon].Render(c, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "peer Customer: vrf isn't supported") {
+			t.Errorf("%s: expected vrf error, got %+v", daemon, err)
+		}
+	}
+
+	c, err := config.Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+daemon: frr
+cache-directory: ` + dir + `
+rtr-servers:
+  - server: 192.0.2.3:8282
+peers:
+  Customer:
+    asn: 65540
+    neighbors: [203.0.113.3]
+    filter-aspa: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Renderers["frr"].Render(c, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "peer Customer: filter-aspa isn't supported by the FRR renderer") {
+		t.Errorf("expected filter-aspa error, got %+v", err)
+	}
 }
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"errors"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -12,8 +14,6 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var alphabet = strings.Split("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789", "")
-
 // Contains runs a linear search on a string array
 func Contains(a []string, x string) bool {
 	for _, n := range a {
@@ -26,12 +26,13 @@ func Contains(a []string, x string) bool {
 
 // Sanitize limits an input string to only uppercase letters and numbers
 func Sanitize(input string) *string {
-	output := ""
+	var b strings.Builder
 	for _, chr := range strings.ReplaceAll(strings.ToUpper(input), " ", "_") {
-		if Contains(alphabet, string(chr)) || string(chr) == "_" {
-			output += string(chr)
+		if (chr >= 'A' && chr <= 'Z') || (chr >= '0' && chr <= '9') || chr == '_' {
+			b.WriteRune(chr)
 		}
 	}
+	output := b.String()
 
 	// Add peer prefix if the first character of peerName is a number
 	if unicode.IsDigit(rune(output[0])) {
@@ -119,7 +120,7 @@ func PrintTable(header []string, data [][]string) {
 func RemoveFileGlob(glob string) error {
 	files, err := filepath.Glob(glob)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	for _, f := range files {
 		if err := os.Remove(f); err != nil {
@@ -129,6 +130,27 @@ func RemoveFileGlob(glob string) error {
 	return nil
 }
 
+// SplitZone splits a scoped IPv6 address (fe80::1%eth0) into the address and interface
+func SplitZone(address string) (string, string) {
+	if i := strings.LastIndex(address, "%"); i != -1 {
+		return address[:i], address[i+1:]
+	}
+	return address, ""
+}
+
+// ValidateNeighbor checks if an address is a valid neighbor IP, allowing an interface zone on IPv6 link-local addresses
+func ValidateNeighbor(address string) error {
+	addr, zone := SplitZone(address)
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return errors.New("invalid neighbor address " + address)
+	}
+	if zone != "" && (ip.To4() != nil || !ip.IsLinkLocalUnicast()) {
+		return errors.New("interface zone is only allowed on IPv6 link-local neighbor addresses, got " + address)
+	}
+	return nil // nil error
+}
+
 // Pointer helpers used to write cleaner tests
 
 // StrDeref returns the value of a pointer to a string
@@ -89,3 +89,29 @@ func TestStrDeref(t *testing.T) {
 		t.Errorf("strDeref failed. expected 'foo' got '%s'", out)
 	}
 }
+
+func TestValidateNeighbor(t *testing.T) {
+	testCases := []struct {
+		input   string
+		address string
+		zone    string
+		valid   bool
+	}{
+		{"192.0.2.1", "192.0.2.1", "", true},
+		{"2001:db8::1", "2001:db8::1", "", true},
+		{"fe80::1%eth0", "fe80::1", "eth0", true},
+		{"fe80::1%", "fe80::1", "", true},
+		{"2001:db8::1%eth0", "2001:db8::1", "eth0", false},
+		{"192.0.2.1%eth0", "192.0.2.1", "eth0", false},
+		{"foo%eth0", "foo", "eth0", false},
+	}
+	for _, tc := range testCases {
+		address, zone := SplitZone(tc.input)
+		if address != tc.address || zone != tc.zone {
+			t.Errorf("SplitZone %s: expected %s %s, got %s %s", tc.input, tc.address, tc.zone, address, zone)
+		}
+		if err := ValidateNeighbor(tc.input); (err == nil) != tc.valid {
+			t.Errorf("ValidateNeighbor %s: expected valid=%v, got %v", tc.input, tc.valid, err)
+		}
+	}
+}
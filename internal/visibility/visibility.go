@@ -0,0 +1,330 @@
+package visibility
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+// Data source endpoints and timeouts, variables for testing
+var (
+	ripeStatURL    = "https://stat.ripe.net"
+	bgpToolsWhois  = "bgp.tools:43"
+	routeViewsZone = "asn.routeviews.org"
+	lookupTXT      = net.DefaultResolver.LookupTXT
+	webhookTimeout = 10 * time.Second
+)
+
+// Result stores the external visibility of a single prefix
+type Result struct {
+	Prefix  string `json:"prefix"`
+	Visible bool   `json:"visible"`
+	Origins []int  `json:"origins"`
+	Peers   int    `json:"peers"`
+}
+
+// Problem stores a visibility regression
+type Problem struct {
+	Prefix  string `json:"prefix"`
+	Message string `json:"message"`
+}
+
+// ripeStatResponse stores the parts of a RIPEstat routing-status response we use
+type ripeStatResponse struct {
+	Data struct {
+		Visibility struct {
+			V4 struct {
+				RISPeersSeeing int `json:"ris_peers_seeing"`
+			} `json:"v4"`
+			V6 struct {
+				RISPeersSeeing int `json:"ris_peers_seeing"`
+			} `json:"v6"`
+		} `json:"visibility"`
+		Origins []struct {
+			Origin int `json:"origin"`
+		} `json:"origins"`
+	} `json:"data"`
+}
+
+// queryRIPEStat gets prefix visibility from RIPE RIS through the RIPEstat API
+func queryRIPEStat(prefix string, timeout time.Duration) (*Result, error) {
+	httpClient := http.Client{Timeout: timeout}
+	res, err := httpClient.Get(ripeStatURL + "/data/routing-status/data.json?resource=" + url.QueryEscape(prefix))
+	if err != nil {
+		return nil, errors.New("RIPEstat GET request: " + err.Error())
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.New("RIPEstat read: " + err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RIPEstat returned HTTP %d", res.StatusCode)
+	}
+
+	var r ripeStatResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, errors.New("RIPEstat JSON Unmarshal: " + err.Error())
+	}
+	result := &Result{Prefix: prefix, Peers: r.Data.Visibility.V4.RISPeersSeeing + r.Data.Visibility.V6.RISPeersSeeing}
+	for _, o := range r.Data.Origins {
+		result.Origins = append(result.Origins, o.Origin)
+	}
+	result.Visible = result.Peers > 0
+	return result, nil // nil error
+}
+
+// queryBGPTools gets prefix visibility from the bgp.tools bulk whois interface
+func queryBGPTools(prefixes []string, timeout time.Duration) (map[string]*Result, error) {
+	conn, err := net.DialTimeout("tcp", bgpToolsWhois, timeout)
+	if err != nil {
+		return nil, errors.New("bgp.tools connect: " + err.Error())
+	}
+	//noinspection GoUnhandledErrorResult
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	query := "begin\n" + strings.Join(prefixes, "\n") + "\nend\n"
+	if _, err := conn.Write([]byte(query)); err != nil {
+		return nil, errors.New("bgp.tools write: " + err.Error())
+	}
+
+	results := map[string]*Result{}
+	for _, prefix := range prefixes {
+		results[prefix] = &Result{Prefix: prefix}
+	}
+	// Each line is AS | IP | BGP Prefix | CC | Registry | Allocated | AS Name
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 3 {
+			continue
+		}
+		asn, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			continue
+		}
+		query, routed := strings.TrimSpace(fields[1]), strings.TrimSpace(fields[2])
+		result := results[query]
+		// A covering prefix doesn't count as the exact prefix being visible
+		if result == nil || routed != query || asn == 0 {
+			continue
+		}
+		result.Visible = true
+		result.Peers = 1
+		result.Origins = append(result.Origins, asn)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("bgp.tools read: " + err.Error())
+	}
+	return results, nil // nil error
+}
+
+// queryRouteViews gets IPv4 prefix visibility from the RouteViews origin ASN DNS zone
+func queryRouteViews(prefixes []string, timeout time.Duration) (map[string]*Result, error) {
+	results := map[string]*Result{}
+	for _, prefix := range prefixes {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %s: %v", prefix, err)
+		}
+		ip := ipNet.IP.To4()
+		if ip == nil {
+			log.Warnf("[visibility] RouteViews doesn't support IPv6, skipping %s", prefix)
+			continue
+		}
+		result := &Result{Prefix: prefix}
+		results[prefix] = result
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		records, err := lookupTXT(ctx, fmt.Sprintf("%d.%d.%d.%d.%s", ip[3], ip[2], ip[1], ip[0], routeViewsZone))
+		cancel()
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			continue // Not routed
+		} else if err != nil {
+			return nil, errors.New("RouteViews lookup: " + err.Error())
+		}
+
+		// Each record holds the origin ASN, prefix address, and prefix length strings, which are joined when resolved
+		ones, _ := ipNet.Mask.Size()
+		routed := ipNet.IP.String() + strconv.Itoa(ones)
+		for _, record := range records {
+			record = strings.ReplaceAll(record, " ", "")
+			// A covering prefix doesn't count as the exact prefix being visible
+			if !strings.HasSuffix(record, routed) {
+				continue
+			}
+			asn, err := strconv.Atoi(strings.TrimSuffix(record, routed))
+			if err != nil || asn == 0 {
+				continue
+			}
+			result.Visible = true
+			result.Peers = 1
+			result.Origins = append(result.Origins, asn)
+		}
+	}
+	return results, nil // nil error
+}
+
+// Query gets the visibility of a list of prefixes from the configured source
+func Query(prefixes []string, v *config.Visibility) (map[string]*Result, error) {
+	timeout := time.Duration(v.QueryTimeout) * time.Second
+	if v.Source == "bgp.tools" {
+		return queryBGPTools(prefixes, timeout)
+	} else if v.Source == "routeviews" {
+		return queryRouteViews(prefixes, timeout)
+	}
+	results := map[string]*Result{}
+	for _, prefix := range prefixes {
+		r, err := queryRIPEStat(prefix, timeout)
+		if err != nil {
+			return nil, err
+		}
+		results[prefix] = r
+	}
+	return results, nil // nil error
+}
+
+// Compare checks visibility results against the expected origin and the previous results
+func Compare(asn int, minPeers int, results map[string]*Result, previous map[string]*Result) []Problem {
+	var prefixes []string
+	for prefix := range results {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var problems []Problem
+	for _, prefix := range prefixes {
+		r := results[prefix]
+		if !r.Visible {
+			if p := previous[prefix]; p != nil && p.Visible {
+				problems = append(problems, Problem{prefix, "announcement disappeared since the last check"})
+			} else {
+				problems = append(problems, Problem{prefix, "not visible"})
+			}
+			continue
+		}
+
+		ourOrigin := false
+		var otherOrigins []string
+		for _, origin := range r.Origins {
+			if origin == asn {
+				ourOrigin = true
+			} else {
+				otherOrigins = append(otherOrigins, fmt.Sprintf("AS%d", origin))
+			}
+		}
+		if !ourOrigin {
+			problems = append(problems, Problem{prefix, fmt.Sprintf("not originated by AS%d (seen from %s)", asn, strings.Join(otherOrigins, ", "))})
+		} else if len(otherOrigins) > 0 {
+			problems = append(problems, Problem{prefix, "also originated by " + strings.Join(otherOrigins, ", ")})
+		}
+		if minPeers > 0 && r.Peers < minPeers {
+			if p := previous[prefix]; p != nil && p.Peers >= minPeers {
+				problems = append(problems, Problem{prefix, fmt.Sprintf("seen by %d peers, down from %d", r.Peers, p.Peers)})
+			} else {
+				problems = append(problems, Problem{prefix, fmt.Sprintf("seen by %d peers, expected at least %d", r.Peers, minPeers)})
+			}
+		}
+	}
+	return problems
+}
+
+// loadState reads the previous results from a state file
+func loadState(file string) map[string]*Result {
+	previous := map[string]*Result{}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Reading visibility state: %v", err)
+		}
+		return previous
+	}
+	if err := json.Unmarshal(contents, &previous); err != nil {
+		log.Warnf("Parsing visibility state: %v", err)
+	}
+	return previous
+}
+
+// saveState writes results to a state file
+func saveState(file string, results map[string]*Result) error {
+	contents, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
+
+// notify posts problems to a webhook
+func notify(webhookURL string, hostname string, problems []Problem) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"hostname": hostname,
+		"problems": problems,
+	})
+	if err != nil {
+		return err
+	}
+	httpClient := http.Client{Timeout: webhookTimeout}
+	res, err := httpClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", res.StatusCode)
+	}
+	return nil // nil error
+}
+
+// Check queries the visibility of all originated prefixes and alerts on problems
+func Check(c *config.Config) ([]Problem, error) {
+	if len(c.Prefixes) == 0 {
+		return nil, nil
+	}
+	results, err := Query(c.Prefixes, &c.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	// bgp.tools and RouteViews don't report how many peers see a prefix
+	minPeers := c.Visibility.MinPeers
+	if c.Visibility.Source == "bgp.tools" || c.Visibility.Source == "routeviews" {
+		minPeers = 0
+	}
+	previous := loadState(c.Visibility.StateFile)
+	problems := Compare(c.ASN, minPeers, results, previous)
+	if err := saveState(c.Visibility.StateFile, results); err != nil {
+		log.Warnf("Writing visibility state: %v", err)
+	}
+
+	for _, p := range problems {
+		log.Warnf("[visibility] %s: %s", p.Prefix, p.Message)
+	}
+	if len(problems) > 0 && c.Visibility.WebhookURL != "" {
+		if err := notify(c.Visibility.WebhookURL, c.Hostname, problems); err != nil {
+			log.Warnf("Sending visibility webhook: %v", err)
+		}
+	}
+	return problems, nil // nil error
+}
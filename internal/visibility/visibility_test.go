@@ -0,0 +1,134 @@
+package visibility
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/internal/config"
+)
+
+func TestCompare(t *testing.T) {
+	results := map[string]*Result{
+		"192.0.2.0/24":    {Prefix: "192.0.2.0/24", Visible: true, Origins: []int{65530}, Peers: 300},
+		"198.51.100.0/24": {Prefix: "198.51.100.0/24", Visible: false},
+		"203.0.113.0/24":  {Prefix: "203.0.113.0/24", Visible: true, Origins: []int{65510}, Peers: 5},
+		"2001:db8::/48":   {Prefix: "2001:db8::/48", Visible: false},
+	}
+	previous := map[string]*Result{
+		"198.51.100.0/24": {Prefix: "198.51.100.0/24", Visible: true, Origins: []int{65530}, Peers: 300},
+	}
+
+	problems := Compare(65530, 10, results, previous)
+	assert.Equal(t, []Problem{
+		{"198.51.100.0/24", "announcement disappeared since the last check"},
+		{"2001:db8::/48", "not visible"},
+		{"203.0.113.0/24", "not originated by AS65530 (seen from AS65510)"},
+		{"203.0.113.0/24", "seen by 5 peers, expected at least 10"},
+	}, problems)
+}
+
+func TestCheckRIPEStat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/data/routing-status/data.json", r.URL.Path)
+		if r.URL.Query().Get("resource") == "192.0.2.0/24" {
+			fmt.Fprint(w, `{"data": {"visibility": {"v4": {"ris_peers_seeing": 320, "total_ris_peers": 330}, "v6": {"ris_peers_seeing": 0}}, "origins": [{"origin": 65530}]}}`)
+		} else {
+			fmt.Fprint(w, `{"data": {"visibility": {"v4": {"ris_peers_seeing": 0}, "v6": {"ris_peers_seeing": 0}}, "origins": []}}`)
+		}
+	}))
+	defer server.Close()
+	ripeStatURL = server.URL
+
+	var webhook map[string]interface{}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&webhook))
+	}))
+	defer webhookServer.Close()
+
+	c := &config.Config{
+		ASN:      65530,
+		Hostname: "rtr1",
+		Prefixes: []string{"192.0.2.0/24", "2001:db8::/48"},
+		Visibility: config.Visibility{
+			Source:       "ripestat",
+			MinPeers:     10,
+			StateFile:    path.Join(t.TempDir(), "visibility.json"),
+			WebhookURL:   webhookServer.URL,
+			QueryTimeout: 5,
+		},
+	}
+	problems, err := Check(c)
+	assert.Nil(t, err)
+	assert.Equal(t, []Problem{{"2001:db8::/48", "not visible"}}, problems)
+	assert.Equal(t, "rtr1", webhook["hostname"])
+
+	// Results are kept for the next check
+	assert.True(t, loadState(c.Visibility.StateFile)["192.0.2.0/24"].Visible)
+}
+
+func TestQueryBGPTools(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	bgpToolsWhois = listener.Addr().String()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "end":
+				return
+			case line == "192.0.2.0/24":
+				fmt.Fprintln(conn, "65530   | 192.0.2.0/24   | 192.0.2.0/24   | US | ARIN | 2020-01-01 | Example")
+			case strings.Contains(line, "/"):
+				fmt.Fprintf(conn, "65510   | %s | 198.51.0.0/16 | US | ARIN | 2020-01-01 | Covering\n", line)
+			}
+		}
+	}()
+
+	results, err := Query([]string{"192.0.2.0/24", "198.51.100.0/24"}, &config.Visibility{Source: "bgp.tools", QueryTimeout: 5})
+	assert.Nil(t, err)
+	assert.True(t, results["192.0.2.0/24"].Visible)
+	assert.Equal(t, []int{65530}, results["192.0.2.0/24"].Origins)
+	assert.False(t, results["198.51.100.0/24"].Visible)
+}
+
+func TestQueryRouteViews(t *testing.T) {
+	defer func(original func(context.Context, string) ([]string, error)) { lookupTXT = original }(lookupTXT)
+	var queried []string
+	lookupTXT = func(_ context.Context, name string) ([]string, error) {
+		queried = append(queried, name)
+		switch name {
+		case "0.2.0.192.asn.routeviews.org":
+			return []string{"65530192.0.2.024"}, nil
+		case "0.100.51.198.asn.routeviews.org":
+			return []string{"65510198.51.0.016"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	results, err := Query([]string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/48"}, &config.Visibility{Source: "routeviews", QueryTimeout: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0.2.0.192.asn.routeviews.org", "0.100.51.198.asn.routeviews.org", "0.113.0.203.asn.routeviews.org"}, queried)
+	assert.True(t, results["192.0.2.0/24"].Visible)
+	assert.Equal(t, []int{65530}, results["192.0.2.0/24"].Origins)
+	assert.False(t, results["198.51.100.0/24"].Visible)
+	assert.False(t, results["203.0.113.0/24"].Visible)
+	assert.NotContains(t, results, "2001:db8::/48")
+}
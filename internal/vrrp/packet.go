@@ -0,0 +1,149 @@
+package vrrp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// Protocol is the VRRP IP protocol number
+const Protocol = 112
+
+// version is the VRRP version implemented by this package
+const version = 3
+
+// typeAdvertisement is the only VRRPv3 packet type
+const typeAdvertisement = 1
+
+// headerLength is the length of the VRRPv3 header before the addresses
+const headerLength = 8
+
+// Advertisement stores a VRRPv3 advertisement (RFC 5798 section 5.1)
+type Advertisement struct {
+	VRID         uint8
+	Priority     uint8
+	MaxAdvertInt uint16 // Centiseconds
+	Addresses    []net.IP
+}
+
+// is4 checks if an address is IPv4
+func is4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+// checksum computes the VRRPv3 checksum over the IP pseudo-header and packet
+func checksum(b []byte, src net.IP, dst net.IP) uint16 {
+	var pseudo []byte
+	if is4(src) {
+		pseudo = append(pseudo, src.To4()...)
+		pseudo = append(pseudo, dst.To4()...)
+		pseudo = append(pseudo, 0, Protocol, byte(len(b)>>8), byte(len(b)))
+	} else {
+		pseudo = append(pseudo, src.To16()...)
+		pseudo = append(pseudo, dst.To16()...)
+		pseudo = append(pseudo, byte(len(b)>>24), byte(len(b)>>16), byte(len(b)>>8), byte(len(b)), 0, 0, 0, Protocol)
+	}
+
+	var sum uint32
+	data := append(pseudo, b...)
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Marshal encodes an advertisement sent from src to dst
+func (a *Advertisement) Marshal(src net.IP, dst net.IP) ([]byte, error) {
+	if len(a.Addresses) > 255 {
+		return nil, errors.New("too many addresses")
+	}
+	if a.MaxAdvertInt > 0x0fff {
+		return nil, fmt.Errorf("max advertisement interval %d exceeds 4095 centiseconds", a.MaxAdvertInt)
+	}
+	b := make([]byte, headerLength)
+	b[0] = version<<4 | typeAdvertisement
+	b[1] = a.VRID
+	b[2] = a.Priority
+	b[3] = uint8(len(a.Addresses))
+	binary.BigEndian.PutUint16(b[4:6], a.MaxAdvertInt)
+	for _, addr := range a.Addresses {
+		if is4(src) != is4(addr) {
+			return nil, fmt.Errorf("address %s doesn't match the source address family", addr)
+		}
+		if is4(addr) {
+			b = append(b, addr.To4()...)
+		} else {
+			b = append(b, addr.To16()...)
+		}
+	}
+	binary.BigEndian.PutUint16(b[6:8], checksum(b, src, dst))
+	return b, nil // nil error
+}
+
+// Parse decodes and validates an advertisement received from src to dst
+func Parse(b []byte, src net.IP, dst net.IP) (*Advertisement, error) {
+	if len(b) < headerLength {
+		return nil, fmt.Errorf("packet too short (%d bytes)", len(b))
+	}
+	if b[0]>>4 != version {
+		return nil, fmt.Errorf("unsupported VRRP version %d", b[0]>>4)
+	}
+	if b[0]&0x0f != typeAdvertisement {
+		return nil, fmt.Errorf("unsupported VRRP packet type %d", b[0]&0x0f)
+	}
+
+	addrLen := net.IPv6len
+	if is4(src) {
+		addrLen = net.IPv4len
+	}
+	count := int(b[3])
+	if len(b) < headerLength+count*addrLen {
+		return nil, fmt.Errorf("packet too short for %d addresses (%d bytes)", count, len(b))
+	}
+	b = b[:headerLength+count*addrLen]
+	if checksum(b, src, dst) != 0 {
+		return nil, errors.New("invalid checksum")
+	}
+
+	a := &Advertisement{
+		VRID:         b[1],
+		Priority:     b[2],
+		MaxAdvertInt: binary.BigEndian.Uint16(b[4:6]) & 0x0fff,
+	}
+	for i := 0; i < count; i++ {
+		offset := headerLength + i*addrLen
+		a.Addresses = append(a.Addresses, net.IP(append([]byte{}, b[offset:offset+addrLen]...)))
+	}
+	return a, nil // nil error
+}
+
+// allNodes is the IPv6 all-nodes multicast group that unsolicited neighbor advertisements are sent to
+var allNodes = net.ParseIP("ff02::1")
+
+// neighborAdvertisement builds an unsolicited ICMPv6 neighbor advertisement announcing that target is at mac (RFC 4861 section 7.2.6)
+func neighborAdvertisement(target net.IP, mac net.HardwareAddr, src net.IP) ([]byte, error) {
+	if is4(target) {
+		return nil, fmt.Errorf("%s isn't an IPv6 address", target)
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("unsupported link-layer address %s", mac)
+	}
+	body := make([]byte, 4, 28)
+	body[0] = 0x20 // Override flag
+	body = append(body, target.To16()...)
+	// Target link-layer address option, with the length in units of 8 bytes
+	body = append(body, 2, 1)
+	body = append(body, mac...)
+	m := icmp.Message{Type: ipv6.ICMPTypeNeighborAdvertisement, Body: &icmp.RawBody{Data: body}}
+	return m.Marshal(icmp.IPv6PseudoHeader(src, allNodes))
+}
@@ -0,0 +1,288 @@
+package vrrp
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// State is a VRRP router state
+type State int
+
+// VRRP router states (RFC 5798 section 6.4)
+const (
+	Initialize State = iota
+	Backup
+	Master
+)
+
+// String returns the name of a state
+func (s State) String() string {
+	switch s {
+	case Backup:
+		return "backup"
+	case Master:
+		return "primary"
+	}
+	return "initialize"
+}
+
+// Received stores an advertisement and the address it was received from
+type Received struct {
+	Advertisement *Advertisement
+	Source        net.IP
+}
+
+// Transport sends and receives advertisements and manages the virtual addresses for a router
+type Transport interface {
+	// Source returns the router's primary address, used as the advertisement source and to break priority ties
+	Source() net.IP
+	Send(a *Advertisement) error
+	Receive() <-chan Received
+	AddAddresses() error
+	RemoveAddresses() error
+	// Announce sends count gratuitous ARPs or unsolicited neighbor advertisements for the virtual addresses
+	Announce(count int) error
+}
+
+// Router is a single VRRPv3 virtual router
+type Router struct {
+	Name           string
+	VRID           uint8
+	Priority       uint8
+	AdvertInterval time.Duration
+	Preempt        bool
+	Addresses      []net.IP
+
+	// PreemptDelay is the time after startup before a backup preempts a lower priority master
+	PreemptDelay time.Duration
+	// GARPRepeat is the number of announcements sent at a time after becoming master (at least 1)
+	GARPRepeat int
+	// GARPDelay is the time after becoming master to send a second set of announcements (disabled if 0)
+	GARPDelay time.Duration
+	// GARPRefresh is the interval to repeat announcements while master (disabled if 0)
+	GARPRefresh time.Duration
+
+	// OnState is called with the new state on every state transition if set
+	OnState func(State)
+
+	transport           Transport
+	state               State
+	masterAdverInterval time.Duration
+	masterDown          *time.Timer
+	adver               *time.Timer
+	garpDelay           *time.Timer
+	garpRefresh         *time.Timer
+	started             time.Time
+}
+
+// NewRouter creates a new virtual router
+func NewRouter(name string, vrid uint8, priority uint8, advertInterval time.Duration, preempt bool, addresses []net.IP, transport Transport) *Router {
+	return &Router{
+		Name:           name,
+		VRID:           vrid,
+		Priority:       priority,
+		AdvertInterval: advertInterval,
+		Preempt:        preempt,
+		Addresses:      addresses,
+		transport:      transport,
+		state:          Initialize,
+	}
+}
+
+// State returns the current state of the router
+func (r *Router) State() State {
+	return r.state
+}
+
+// skewTime returns the time to wait in addition to the master down interval, so the highest priority backup takes over first
+func (r *Router) skewTime() time.Duration {
+	return time.Duration(256-int(r.Priority)) * r.masterAdverInterval / 256
+}
+
+// masterDownInterval returns the time after which a backup considers the master down
+func (r *Router) masterDownInterval() time.Duration {
+	return 3*r.masterAdverInterval + r.skewTime()
+}
+
+// stopTimer stops a timer and drains its channel so a stale expiry isn't received later
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// resetTimer stops and restarts a timer
+func resetTimer(t *time.Timer, d time.Duration) {
+	stopTimer(t)
+	t.Reset(d)
+}
+
+// centiseconds converts a duration to VRRP centiseconds
+func centiseconds(d time.Duration) uint16 {
+	return uint16(d / (10 * time.Millisecond))
+}
+
+// advertise sends an advertisement with a priority
+func (r *Router) advertise(priority uint8) {
+	err := r.transport.Send(&Advertisement{
+		VRID:         r.VRID,
+		Priority:     priority,
+		MaxAdvertInt: centiseconds(r.AdvertInterval),
+		Addresses:    r.Addresses,
+	})
+	if err != nil {
+		log.Warnf("[VRRP %s] Sending advertisement: %v", r.Name, err)
+	}
+}
+
+// announce sends a set of announcements for the virtual addresses
+func (r *Router) announce() {
+	count := r.GARPRepeat
+	if count < 1 {
+		count = 1
+	}
+	if err := r.transport.Announce(count); err != nil {
+		log.Warnf("[VRRP %s] Announcing virtual addresses: %v", r.Name, err)
+	}
+}
+
+// stopAnnouncing stops the delayed and periodic announcements
+func (r *Router) stopAnnouncing() {
+	stopTimer(r.garpDelay)
+	stopTimer(r.garpRefresh)
+}
+
+// setState transitions the router to a new state
+func (r *Router) setState(state State) {
+	log.Infof("[VRRP %s] Transitioning from %s to %s", r.Name, r.state, state)
+	r.state = state
+	if r.OnState != nil {
+		r.OnState(state)
+	}
+}
+
+// becomeMaster transitions to the master state
+func (r *Router) becomeMaster() {
+	r.advertise(r.Priority)
+	if err := r.transport.AddAddresses(); err != nil {
+		log.Warnf("[VRRP %s] Adding virtual addresses: %v", r.Name, err)
+	}
+	r.announce()
+	if r.GARPDelay > 0 {
+		resetTimer(r.garpDelay, r.GARPDelay)
+	}
+	if r.GARPRefresh > 0 {
+		resetTimer(r.garpRefresh, r.GARPRefresh)
+	}
+	stopTimer(r.masterDown)
+	resetTimer(r.adver, r.AdvertInterval)
+	r.setState(Master)
+}
+
+// becomeBackup transitions to the backup state
+func (r *Router) becomeBackup(masterAdverInterval time.Duration) {
+	if r.state == Master {
+		if err := r.transport.RemoveAddresses(); err != nil {
+			log.Warnf("[VRRP %s] Removing virtual addresses: %v", r.Name, err)
+		}
+	}
+	r.masterAdverInterval = masterAdverInterval
+	stopTimer(r.adver)
+	r.stopAnnouncing()
+	resetTimer(r.masterDown, r.masterDownInterval())
+	r.setState(Backup)
+}
+
+// handle processes a received advertisement
+func (r *Router) handle(rx Received) {
+	a := rx.Advertisement
+	if a.VRID != r.VRID {
+		return
+	}
+	interval := time.Duration(a.MaxAdvertInt) * 10 * time.Millisecond
+
+	switch r.state {
+	case Backup:
+		if a.Priority == 0 {
+			// The master is shutting down
+			resetTimer(r.masterDown, r.skewTime())
+		} else if !r.Preempt || a.Priority >= r.Priority || time.Since(r.started) < r.PreemptDelay {
+			r.masterAdverInterval = interval
+			resetTimer(r.masterDown, r.masterDownInterval())
+		}
+	case Master:
+		if a.Priority == 0 {
+			r.advertise(r.Priority)
+			resetTimer(r.adver, r.AdvertInterval)
+		} else if a.Priority > r.Priority || (a.Priority == r.Priority && bytes.Compare(rx.Source.To16(), r.transport.Source().To16()) > 0) {
+			r.becomeBackup(interval)
+		}
+	}
+}
+
+// Run runs the router until stop is closed, then releases mastership
+func (r *Router) Run(stop <-chan struct{}) {
+	r.masterAdverInterval = r.AdvertInterval
+	r.masterDown = time.NewTimer(time.Hour)
+	stopTimer(r.masterDown)
+	r.adver = time.NewTimer(time.Hour)
+	stopTimer(r.adver)
+	r.garpDelay = time.NewTimer(time.Hour)
+	stopTimer(r.garpDelay)
+	r.garpRefresh = time.NewTimer(time.Hour)
+	stopTimer(r.garpRefresh)
+	r.started = time.Now()
+
+	if r.Priority == 255 {
+		r.becomeMaster()
+	} else {
+		r.becomeBackup(r.AdvertInterval)
+	}
+
+	for {
+		select {
+		case <-stop:
+			stopTimer(r.masterDown)
+			stopTimer(r.adver)
+			r.stopAnnouncing()
+			if r.state == Master {
+				// Advertise priority 0 so a backup takes over without waiting for the master down interval
+				r.advertise(0)
+				if err := r.transport.RemoveAddresses(); err != nil {
+					log.Warnf("[VRRP %s] Removing virtual addresses: %v", r.Name, err)
+				}
+			}
+			r.setState(Initialize)
+			return
+		case <-r.masterDown.C:
+			if r.state == Backup {
+				r.becomeMaster()
+			}
+		case <-r.adver.C:
+			if r.state == Master {
+				r.advertise(r.Priority)
+				resetTimer(r.adver, r.AdvertInterval)
+			}
+		case <-r.garpDelay.C:
+			if r.state == Master {
+				r.announce()
+			}
+		case <-r.garpRefresh.C:
+			if r.state == Master {
+				r.announce()
+				resetTimer(r.garpRefresh, r.GARPRefresh)
+			}
+		case rx, ok := <-r.transport.Receive():
+			if !ok {
+				return
+			}
+			r.handle(rx)
+		}
+	}
+}
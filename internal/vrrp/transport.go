@@ -0,0 +1,325 @@
+package vrrp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// VRRP multicast groups (RFC 5798 section 5.1.1.2 and 5.1.2.2)
+var (
+	group4 = net.IPv4(224, 0, 0, 18)
+	group6 = net.ParseIP("ff02::12")
+)
+
+// packetConn sends and receives VRRP packets in a single address family
+type packetConn interface {
+	read(b []byte) (n int, src net.IP, dst net.IP, hopLimit int, ifIndex int, err error)
+	write(b []byte, src net.IP, dst net.IP) error
+	close() error
+}
+
+// conn4 is an IPv4 VRRP socket
+type conn4 struct {
+	p     *ipv4.PacketConn
+	iface *net.Interface
+}
+
+func (c *conn4) read(b []byte) (int, net.IP, net.IP, int, int, error) {
+	n, cm, src, err := c.p.ReadFrom(b)
+	if err != nil {
+		return 0, nil, nil, 0, 0, err
+	}
+	if cm == nil {
+		return 0, nil, nil, 0, 0, errors.New("missing control message")
+	}
+	return n, src.(*net.IPAddr).IP, cm.Dst, cm.TTL, cm.IfIndex, nil
+}
+
+func (c *conn4) write(b []byte, src net.IP, dst net.IP) error {
+	_, err := c.p.WriteTo(b, &ipv4.ControlMessage{Src: src, IfIndex: c.iface.Index}, &net.IPAddr{IP: dst})
+	return err
+}
+
+func (c *conn4) close() error {
+	return c.p.Close()
+}
+
+// conn6 is an IPv6 VRRP socket
+type conn6 struct {
+	p     *ipv6.PacketConn
+	iface *net.Interface
+}
+
+func (c *conn6) read(b []byte) (int, net.IP, net.IP, int, int, error) {
+	n, cm, src, err := c.p.ReadFrom(b)
+	if err != nil {
+		return 0, nil, nil, 0, 0, err
+	}
+	if cm == nil {
+		return 0, nil, nil, 0, 0, errors.New("missing control message")
+	}
+	return n, src.(*net.IPAddr).IP, cm.Dst, cm.HopLimit, cm.IfIndex, nil
+}
+
+func (c *conn6) write(b []byte, src net.IP, dst net.IP) error {
+	_, err := c.p.WriteTo(b, &ipv6.ControlMessage{Src: src, IfIndex: c.iface.Index, HopLimit: 255}, &net.IPAddr{IP: dst, Zone: c.iface.Name})
+	return err
+}
+
+func (c *conn6) close() error {
+	return c.p.Close()
+}
+
+// listen opens a VRRP socket on an interface and joins the VRRP multicast group
+func listen(iface *net.Interface, v6 bool) (packetConn, error) {
+	if !v6 {
+		c, err := net.ListenPacket(fmt.Sprintf("ip4:%d", Protocol), "0.0.0.0")
+		if err != nil {
+			return nil, err
+		}
+		p := ipv4.NewPacketConn(c)
+		for _, err := range []error{
+			p.JoinGroup(iface, &net.IPAddr{IP: group4}),
+			p.SetMulticastInterface(iface),
+			p.SetMulticastTTL(255),
+			p.SetMulticastLoopback(false),
+			p.SetControlMessage(ipv4.FlagTTL|ipv4.FlagDst|ipv4.FlagInterface, true),
+		} {
+			if err != nil {
+				_ = c.Close()
+				return nil, err
+			}
+		}
+		return &conn4{p, iface}, nil // nil error
+	}
+
+	c, err := net.ListenPacket(fmt.Sprintf("ip6:%d", Protocol), "::")
+	if err != nil {
+		return nil, err
+	}
+	p := ipv6.NewPacketConn(c)
+	for _, err := range []error{
+		p.JoinGroup(iface, &net.IPAddr{IP: group6}),
+		p.SetMulticastInterface(iface),
+		p.SetMulticastHopLimit(255),
+		p.SetMulticastLoopback(false),
+		p.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagDst|ipv6.FlagInterface, true),
+	} {
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return &conn6{p, iface}, nil // nil error
+}
+
+// primaryAddress returns the first IPv4 address, or the link-local IPv6 address of an interface
+func primaryAddress(iface *net.Interface, v6 bool) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if !v6 && is4(ipNet.IP) {
+			return ipNet.IP.To4(), nil
+		}
+		if v6 && !is4(ipNet.IP) && ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP, nil
+		}
+	}
+	if v6 {
+		return nil, fmt.Errorf("%s has no IPv6 link-local address", iface.Name)
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address", iface.Name)
+}
+
+// IPTransport sends and receives advertisements on an interface and adds the virtual addresses with iproute2
+type IPTransport struct {
+	iface  *net.Interface
+	v6     bool
+	vrid   uint8
+	source net.IP
+	vips   []string // CIDR notation
+	conn   packetConn
+	ndp    *ipv6.PacketConn // Sends unsolicited neighbor advertisements for IPv6 transports
+	rx     chan Received
+	done   chan struct{}
+}
+
+// NewIPTransport creates a new transport for a single address family on an interface
+func NewIPTransport(interfaceName string, vrid uint8, vips []string) (*IPTransport, []net.IP, error) {
+	if len(vips) == 0 {
+		return nil, nil, errors.New("no virtual addresses")
+	}
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addresses []net.IP
+	for _, vip := range vips {
+		ip, _, err := net.ParseCIDR(vip)
+		if err != nil {
+			return nil, nil, err
+		}
+		addresses = append(addresses, ip)
+	}
+	v6 := !is4(addresses[0])
+
+	source, err := primaryAddress(iface, v6)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := listen(iface, v6)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &IPTransport{iface: iface, v6: v6, vrid: vrid, source: source, vips: vips, conn: conn, rx: make(chan Received, 16), done: make(chan struct{})}
+	if v6 {
+		c, err := net.ListenPacket("ip6:ipv6-icmp", "::")
+		if err != nil {
+			_ = conn.close()
+			return nil, nil, err
+		}
+		t.ndp = ipv6.NewPacketConn(c)
+		// The socket is only used to send, so don't queue received ICMPv6 messages
+		var filter ipv6.ICMPFilter
+		filter.SetAll(true)
+		for _, err := range []error{
+			t.ndp.SetICMPFilter(&filter),
+			t.ndp.SetMulticastHopLimit(255),
+		} {
+			if err != nil {
+				_ = c.Close()
+				_ = conn.close()
+				return nil, nil, err
+			}
+		}
+	}
+	go t.receive()
+	return t, addresses, nil // nil error
+}
+
+// group returns the VRRP multicast group for the transport's address family
+func (t *IPTransport) group() net.IP {
+	if t.v6 {
+		return group6
+	}
+	return group4
+}
+
+// receive reads and validates advertisements until the socket is closed
+func (t *IPTransport) receive() {
+	defer close(t.rx)
+	buf := make([]byte, 1500)
+	for {
+		n, src, dst, hopLimit, ifIndex, err := t.conn.read(buf)
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				log.Warnf("[VRRP] Reading from %s: %v", t.iface.Name, err)
+			}
+			return
+		}
+		// Advertisements must not have been forwarded (RFC 5798 section 7.1)
+		if ifIndex != t.iface.Index || hopLimit != 255 {
+			continue
+		}
+		a, err := Parse(buf[:n], src, dst)
+		if err != nil {
+			log.Debugf("[VRRP] Discarding packet from %s on %s: %v", src, t.iface.Name, err)
+			continue
+		}
+		if a.VRID == t.vrid {
+			select {
+			case t.rx <- Received{Advertisement: a, Source: src}:
+			case <-t.done:
+				return
+			}
+		}
+	}
+}
+
+// Source returns the transport's source address
+func (t *IPTransport) Source() net.IP {
+	return t.source
+}
+
+// Send sends an advertisement to the VRRP multicast group
+func (t *IPTransport) Send(a *Advertisement) error {
+	b, err := a.Marshal(t.source, t.group())
+	if err != nil {
+		return err
+	}
+	return t.conn.write(b, t.source, t.group())
+}
+
+// Receive returns the channel of received advertisements
+func (t *IPTransport) Receive() <-chan Received {
+	return t.rx
+}
+
+// ip runs an iproute2 address command for each virtual address
+func (t *IPTransport) ip(action string) error {
+	for _, vip := range t.vips {
+		out, err := exec.Command("ip", "addr", action, vip, "dev", t.iface.Name).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("ip addr %s %s: %v: %s", action, vip, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil // nil error
+}
+
+// AddAddresses adds the virtual addresses to the interface
+func (t *IPTransport) AddAddresses() error {
+	return t.ip("add")
+}
+
+// Announce sends count gratuitous ARPs for IPv4 virtual addresses or unsolicited neighbor advertisements for IPv6 virtual addresses
+func (t *IPTransport) Announce(count int) error {
+	for _, vip := range t.vips {
+		ip, _, _ := net.ParseCIDR(vip)
+		if !t.v6 {
+			if out, err := exec.Command("arping", "-U", "-c", strconv.Itoa(count), "-I", t.iface.Name, ip.String()).CombinedOutput(); err != nil {
+				return fmt.Errorf("sending gratuitous ARP for %s: %v: %s", ip, err, strings.TrimSpace(string(out)))
+			}
+			continue
+		}
+		b, err := neighborAdvertisement(ip, t.iface.HardwareAddr, t.source)
+		if err != nil {
+			return fmt.Errorf("building neighbor advertisement for %s: %v", ip, err)
+		}
+		for i := 0; i < count; i++ {
+			if _, err := t.ndp.WriteTo(b, &ipv6.ControlMessage{Src: t.source, IfIndex: t.iface.Index, HopLimit: 255}, &net.IPAddr{IP: allNodes, Zone: t.iface.Name}); err != nil {
+				return fmt.Errorf("sending neighbor advertisement for %s: %v", ip, err)
+			}
+		}
+	}
+	return nil // nil error
+}
+
+// RemoveAddresses removes the virtual addresses from the interface
+func (t *IPTransport) RemoveAddresses() error {
+	return t.ip("del")
+}
+
+// Close closes the transport's sockets
+func (t *IPTransport) Close() error {
+	close(t.done)
+	if t.ndp != nil {
+		_ = t.ndp.Close()
+	}
+	return t.conn.close()
+}
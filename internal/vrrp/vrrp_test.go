@@ -0,0 +1,247 @@
+package vrrp
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdvertisementRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		src       string
+		dst       string
+		addresses []string
+	}{
+		{"192.0.2.1", "224.0.0.18", []string{"192.0.2.10", "192.0.2.11"}},
+		{"fe80::1", "ff02::12", []string{"2001:db8::10"}},
+	} {
+		src, dst := net.ParseIP(tc.src), net.ParseIP(tc.dst)
+		a := &Advertisement{VRID: 7, Priority: 200, MaxAdvertInt: 100}
+		for _, addr := range tc.addresses {
+			a.Addresses = append(a.Addresses, net.ParseIP(addr))
+		}
+		b, err := a.Marshal(src, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := Parse(b, src, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.VRID != 7 || parsed.Priority != 200 || parsed.MaxAdvertInt != 100 || len(parsed.Addresses) != len(tc.addresses) {
+			t.Errorf("unexpected advertisement %+v", parsed)
+		}
+		for i, addr := range parsed.Addresses {
+			if !addr.Equal(a.Addresses[i]) {
+				t.Errorf("expected address %s, got %s", a.Addresses[i], addr)
+			}
+		}
+
+		// Corrupt the priority
+		b[2]++
+		if _, err := Parse(b, src, dst); err == nil {
+			t.Errorf("expected checksum error")
+		}
+	}
+
+	if _, err := (&Advertisement{Addresses: []net.IP{net.ParseIP("2001:db8::1")}}).Marshal(net.ParseIP("192.0.2.1"), group4); err == nil {
+		t.Errorf("expected address family error")
+	}
+}
+
+// fakeTransport is an in-memory transport
+type fakeTransport struct {
+	source net.IP
+	rx     chan Received
+
+	lock      sync.Mutex
+	sent      []*Advertisement
+	added     int
+	removed   int
+	announced []int
+}
+
+func (f *fakeTransport) Source() net.IP { return f.source }
+
+func (f *fakeTransport) Send(a *Advertisement) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sent = append(f.sent, a)
+	return nil // nil error
+}
+
+func (f *fakeTransport) Receive() <-chan Received { return f.rx }
+
+func (f *fakeTransport) AddAddresses() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.added++
+	return nil // nil error
+}
+
+func (f *fakeTransport) RemoveAddresses() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.removed++
+	return nil // nil error
+}
+
+func (f *fakeTransport) Announce(count int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.announced = append(f.announced, count)
+	return nil // nil error
+}
+
+// runRouter runs a router until the test ends, returning a channel of its state transitions
+func runRouter(t *testing.T, r *Router) <-chan State {
+	states := make(chan State, 10)
+	r.OnState = func(s State) { states <- s }
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+	return states
+}
+
+func TestNeighborAdvertisement(t *testing.T) {
+	src, target := net.ParseIP("fe80::1"), net.ParseIP("2001:db8::10")
+	mac := net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x02, 0x07}
+	b, err := neighborAdvertisement(target, mac, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 32 || b[0] != 136 || b[4] != 0x20 || !net.IP(b[8:24]).Equal(target) || b[24] != 2 || b[25] != 1 || net.HardwareAddr(b[26:32]).String() != mac.String() {
+		t.Errorf("unexpected neighbor advertisement %x", b)
+	}
+
+	// The checksum covers the IPv6 pseudo header
+	data := append(append(append([]byte{}, src.To16()...), allNodes.To16()...), 0, 0, 0, byte(len(b)), 0, 0, 0, 58)
+	data = append(data, b...)
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	if sum != 0xffff {
+		t.Errorf("invalid checksum in %x", b)
+	}
+
+	if _, err := neighborAdvertisement(net.ParseIP("192.0.2.10"), mac, src); err == nil {
+		t.Errorf("expected address family error")
+	}
+}
+
+func TestRouterAnnouncements(t *testing.T) {
+	transport := &fakeTransport{source: net.ParseIP("192.0.2.1"), rx: make(chan Received)}
+	r := NewRouter("test", 1, 100, 10*time.Millisecond, true, []net.IP{net.ParseIP("192.0.2.10")}, transport)
+	r.GARPRepeat = 3
+	r.GARPDelay = 20 * time.Millisecond
+	r.GARPRefresh = 30 * time.Millisecond
+	states := runRouter(t, r)
+	<-states // Backup
+	<-states // Master
+
+	// The initial set, the delayed set, and at least one refresh
+	deadline := time.Now().Add(time.Second)
+	for {
+		transport.lock.Lock()
+		announced := append([]int{}, transport.announced...)
+		transport.lock.Unlock()
+		if len(announced) >= 3 {
+			for _, count := range announced {
+				if count != 3 {
+					t.Errorf("expected announcements of 3 messages, got %v", announced)
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected at least 3 announcements, got %v", announced)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRouterPreemptDelay(t *testing.T) {
+	transport := &fakeTransport{source: net.ParseIP("192.0.2.1"), rx: make(chan Received)}
+	r := NewRouter("test", 1, 200, 10*time.Millisecond, true, []net.IP{net.ParseIP("192.0.2.10")}, transport)
+	r.PreemptDelay = time.Hour
+	states := runRouter(t, r)
+	<-states // Backup
+
+	// A lower priority master is accepted until the preempt delay has passed
+	for i := 0; i < 20; i++ {
+		transport.rx <- Received{Advertisement: &Advertisement{VRID: 1, Priority: 100, MaxAdvertInt: 1}, Source: net.ParseIP("192.0.2.2")}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case s := <-states:
+		t.Errorf("expected to stay in backup, got %s", s)
+	default:
+	}
+}
+
+func TestRouterStateMachine(t *testing.T) {
+	transport := &fakeTransport{source: net.ParseIP("192.0.2.1"), rx: make(chan Received)}
+	r := NewRouter("test", 1, 100, 10*time.Millisecond, true, []net.IP{net.ParseIP("192.0.2.10")}, transport)
+	states := make(chan State, 10)
+	r.OnState = func(s State) { states <- s }
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(stop)
+		close(done)
+	}()
+
+	expect := func(state State) {
+		select {
+		case s := <-states:
+			if s != state {
+				t.Fatalf("expected %s, got %s", state, s)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", state)
+		}
+	}
+
+	// No master is advertising, so the router takes over after the master down interval
+	expect(Backup)
+	expect(Master)
+
+	// A higher priority router preempts
+	transport.rx <- Received{Advertisement: &Advertisement{VRID: 1, Priority: 150, MaxAdvertInt: 1}, Source: net.ParseIP("192.0.2.2")}
+	expect(Backup)
+
+	// Advertisements for other VRIDs are ignored, so the router takes over again
+	transport.rx <- Received{Advertisement: &Advertisement{VRID: 2, Priority: 150, MaxAdvertInt: 1}, Source: net.ParseIP("192.0.2.2")}
+	expect(Master)
+
+	// An equal priority router with a higher address preempts
+	transport.rx <- Received{Advertisement: &Advertisement{VRID: 1, Priority: 100, MaxAdvertInt: 1}, Source: net.ParseIP("192.0.2.3")}
+	expect(Backup)
+	expect(Master)
+
+	close(stop)
+	expect(Initialize)
+	<-done
+
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	if transport.added != 3 || transport.removed != 3 {
+		t.Errorf("expected 3 address additions and removals, got %d and %d", transport.added, transport.removed)
+	}
+	if last := transport.sent[len(transport.sent)-1]; last.Priority != 0 {
+		t.Errorf("expected priority 0 advertisement on shutdown, got %d", last.Priority)
+	}
+}
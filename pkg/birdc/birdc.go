@@ -0,0 +1,61 @@
+// Package birdc parses the output of BIRD show protocols and show route commands into structured types
+package birdc
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// replyCodeRegex matches the reply code at the start of a line from the BIRD control socket
+var replyCodeRegex = regexp.MustCompile(`^\d{4}[- ]`)
+
+// lines splits output from the BIRD control socket or birdc into lines without reply codes, keeping indentation
+func lines(output string) []string {
+	split := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	coded := false
+	for _, line := range split {
+		if strings.TrimSpace(line) != "" {
+			coded = replyCodeRegex.MatchString(line)
+			break
+		}
+	}
+
+	var stripped []string
+	for _, line := range split {
+		if coded {
+			if replyCodeRegex.MatchString(line) {
+				line = line[5:]
+			} else if strings.HasPrefix(line, " ") {
+				// Continuation lines replace the reply code with a single space
+				line = line[1:]
+			}
+		}
+		if strings.TrimSpace(line) != "" {
+			stripped = append(stripped, line)
+		}
+	}
+	return stripped
+}
+
+// parseSince parses a timestamp from the start of fields, returning it in RFC3339 if it's in iso long format (otherwise as printed by BIRD) and the number of fields used
+func parseSince(fields []string) (string, int) {
+	if len(fields) == 0 {
+		return "", 0
+	}
+	if len(fields) >= 2 {
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", fields[0]+" "+fields[1], time.Local); err == nil {
+			return t.Format(time.RFC3339), 2
+		}
+	}
+	return fields[0], 1
+}
+
+// keyValue splits a "key: value" detail line
+func keyValue(line string) (string, string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
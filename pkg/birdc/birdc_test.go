@@ -0,0 +1,187 @@
+package birdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProtocols(t *testing.T) {
+	protocols := ParseProtocols(`0001 BIRD 2.0.8 ready.
+2002-Name       Proto      Table      State  Since         Info
+1002-device1    Device     ---        up     2021-06-11 01:59:05
+ EXAMPLEv4  BGP        ---        up     2021-06-11 02:00:00  Established
+ EXAMPLEv6  BGP        ---        start  02:00:00.123  Active        Socket: Connection refused
+0000
+`)
+	assert.Len(t, protocols, 3)
+	assert.Equal(t, "BGP", protocols["EXAMPLEv4"].Proto)
+	assert.Equal(t, "up", protocols["EXAMPLEv4"].State)
+	assert.Contains(t, protocols["EXAMPLEv4"].Since, "2021-06-11T02:00:00")
+	assert.Equal(t, "Established", protocols["EXAMPLEv4"].Info)
+	assert.Equal(t, "02:00:00.123", protocols["EXAMPLEv6"].Since)
+	assert.Equal(t, "Active Socket: Connection refused", protocols["EXAMPLEv6"].Info)
+	assert.Empty(t, protocols["device1"].Info)
+	assert.Empty(t, protocols["EXAMPLEv4"].Channels)
+}
+
+func TestParseProtocolsAll(t *testing.T) {
+	output := `2002-Name       Proto      Table      State  Since         Info
+1002-EXAMPLEv4  BGP        ---        up     2021-06-11 02:00:00  Established
+1006-  Description:    AS65510 EXAMPLE
+   BGP state:          Established
+     Neighbor address: 192.0.2.2
+     Neighbor AS:      65510
+     Local AS:         65530
+     Neighbor ID:      192.0.2.2
+     Local capabilities
+       Multiprotocol
+         AF announced: ipv4
+     Hold timer:       181.043/240
+   Channel ipv4
+     State:          UP
+     Table:          master4
+     Preference:     100
+     Input filter:   (unnamed)
+     Output filter:  (unnamed)
+     Routes:         15 imported, 2 filtered, 4 exported, 10 preferred
+     Route change stats:     received   rejected   filtered    ignored   accepted
+       Import updates:             20          1          2          0         17
+       Import withdraws:            3          0        ---          0          3
+       Export updates:             30          5          0        ---         25
+       Export withdraws:            1        ---        ---        ---          1
+     BGP Next hop:   192.0.2.1
+1002-EXAMPLEv6  BGP        ---        start  2021-06-11 02:00:00  Active        Socket: Connection refused
+1006-  BGP state:          Active
+     Neighbor address: 2001:db8::2
+     Neighbor AS:      65510
+     Local AS:         65530
+     Last error:       Socket: Connection refused
+   Channel ipv6
+     State:          DOWN
+     Routes:         0 imported, 0 exported
+0000
+`
+
+	protocols := ParseProtocols(output)
+	assert.Len(t, protocols, 2)
+
+	v4 := protocols["EXAMPLEv4"]
+	assert.Equal(t, "AS65510 EXAMPLE", v4.Description)
+	assert.Equal(t, "Established", v4.BGPState)
+	assert.Equal(t, "192.0.2.2", v4.NeighborAddress)
+	assert.Equal(t, uint32(65510), v4.NeighborAS)
+	assert.Equal(t, uint32(65530), v4.LocalAS)
+	assert.Equal(t, "192.0.2.2", v4.NeighborID)
+	assert.Equal(t, "181.043/240", v4.Attributes["Hold timer"])
+	assert.Equal(t, "ipv4", v4.Attributes["AF announced"])
+
+	assert.Len(t, v4.Channels, 1)
+	channel := v4.Channels[0]
+	assert.Equal(t, "ipv4", channel.Name)
+	assert.Equal(t, "UP", channel.State)
+	assert.Equal(t, "master4", channel.Table)
+	assert.Equal(t, 100, channel.Preference)
+	assert.Equal(t, "(unnamed)", channel.InputFilter)
+	assert.Equal(t, RouteCounts{Imported: 15, Filtered: 2, Exported: 4, Preferred: 10}, channel.Routes)
+	assert.Equal(t, ChangeStats{Received: 20, Rejected: 1, Filtered: 2, Ignored: 0, Accepted: 17}, channel.ImportUpdates)
+	assert.Equal(t, ChangeStats{Received: 3, Rejected: 0, Filtered: -1, Ignored: 0, Accepted: 3}, channel.ImportWithdraws)
+	assert.Equal(t, ChangeStats{Received: 30, Rejected: 5, Filtered: 0, Ignored: -1, Accepted: 25}, channel.ExportUpdates)
+	assert.Equal(t, ChangeStats{Received: 1, Rejected: -1, Filtered: -1, Ignored: -1, Accepted: 1}, channel.ExportWithdraws)
+	assert.Equal(t, "192.0.2.1", channel.Attributes["BGP Next hop"])
+
+	v6 := protocols["EXAMPLEv6"]
+	assert.Equal(t, "Socket: Connection refused", v6.LastError)
+	assert.Len(t, v6.Channels, 1)
+	assert.Equal(t, RouteCounts{}, v6.Channels[0].Routes)
+	assert.Equal(t, "DOWN", v6.Channels[0].State)
+}
+
+func TestParseProtocolsBirdc(t *testing.T) {
+	// Output from birdc has no reply codes
+	protocols := ParseProtocols(`BIRD 2.0.8 ready.
+Name       Proto      Table      State  Since         Info
+EXAMPLEv4  BGP        ---        up     2021-06-11 02:00:00  Established
+  BGP state:          Established
+    Neighbor AS:      65510
+  Channel ipv4
+    Routes:         15 imported, 4 exported, 10 preferred
+`)
+	assert.Len(t, protocols, 1)
+	assert.Equal(t, uint32(65510), protocols["EXAMPLEv4"].NeighborAS)
+	assert.Equal(t, 15, protocols["EXAMPLEv4"].Channels[0].Routes.Imported)
+	assert.Equal(t, 4, protocols["EXAMPLEv4"].Channels[0].Routes.Exported)
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes := ParseRoutes(`0001 BIRD 2.0.8 ready.
+1007-Table master4:
+ 192.0.2.0/24         unicast [EXAMPLEv4 2021-06-11 02:00:00] * (100) [AS65510i]
+ 	via 192.0.2.2 on eth0
+1008-	Type: BGP univ
+1012-	BGP.origin: IGP
+ 	BGP.as_path: 65510 65520
+ 	BGP.next_hop: 192.0.2.2
+ 	BGP.local_pref: 100
+1007-                     unicast [EXAMPLEv4_1 2021-06-11] (100) [AS65510i]
+ 	via 192.0.2.3 on eth1
+1007-198.51.100.0/24      blackhole [static1 2021-06-11] * (200)
+ 203.0.113.0/25       unicast [ospf1 2021-06-11] * I (150/20) [192.0.2.1]
+ 	dev eth0
+
+1007-Table master6:
+ 2001:db8::/32        unicast [EXAMPLEv6 2021-06-11] * (100) [AS65510i]
+0000
+`)
+	assert.Len(t, routes, 5)
+
+	assert.Equal(t, "master4", routes[0].Table)
+	assert.Equal(t, "192.0.2.0/24", routes[0].Prefix)
+	assert.Equal(t, "unicast", routes[0].Type)
+	assert.Equal(t, "EXAMPLEv4", routes[0].Protocol)
+	assert.Contains(t, routes[0].Since, "2021-06-11T02:00:00")
+	assert.True(t, routes[0].Primary)
+	assert.Equal(t, 100, routes[0].Preference)
+	assert.Equal(t, "[AS65510i]", routes[0].Info)
+	assert.Equal(t, []NextHop{{Gateway: "192.0.2.2", Interface: "eth0"}}, routes[0].NextHops)
+	assert.Equal(t, "BGP univ", routes[0].Attributes["Type"])
+	assert.Equal(t, "65510 65520", routes[0].Attributes["BGP.as_path"])
+	assert.Equal(t, "100", routes[0].Attributes["BGP.local_pref"])
+
+	// Alternate routes inherit the prefix of the route above
+	assert.Equal(t, "192.0.2.0/24", routes[1].Prefix)
+	assert.Equal(t, "EXAMPLEv4_1", routes[1].Protocol)
+	assert.Equal(t, "2021-06-11", routes[1].Since)
+	assert.False(t, routes[1].Primary)
+	assert.Equal(t, "192.0.2.3", routes[1].NextHops[0].Gateway)
+	assert.Empty(t, routes[1].Attributes)
+
+	assert.Equal(t, "blackhole", routes[2].Type)
+	assert.Equal(t, 200, routes[2].Preference)
+	assert.Empty(t, routes[2].Info)
+
+	assert.Equal(t, 150, routes[3].Preference)
+	assert.Equal(t, []NextHop{{Interface: "eth0"}}, routes[3].NextHops)
+
+	assert.Equal(t, "master6", routes[4].Table)
+	assert.Equal(t, "2001:db8::/32", routes[4].Prefix)
+
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/25", "2001:db8::/32"}, Prefixes(routes))
+}
+
+func TestParseStatus(t *testing.T) {
+	status := ParseStatus(`0001 BIRD 2.0.8 ready.
+1000-BIRD 2.0.8
+1011-Router ID is 192.0.2.1
+ Hostname is router1
+ Current server time is 2021-06-11 03:00:00
+ Last reboot on 2021-06-11 01:59:05
+ Last reconfiguration on 2021-06-11 02:30:00
+0013 Daemon is up and running
+`)
+	assert.Equal(t, "2.0.8", status.Version)
+	assert.Equal(t, "192.0.2.1", status.RouterID)
+	assert.Contains(t, status.ServerTime, "2021-06-11T03:00:00")
+	assert.Contains(t, status.LastReboot, "2021-06-11T01:59:05")
+	assert.Contains(t, status.LastReconfiguration, "2021-06-11T02:30:00")
+}
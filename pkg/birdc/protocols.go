@@ -0,0 +1,191 @@
+package birdc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Protocol is a single protocol from the output of show protocols, with details if parsed from show protocols all
+type Protocol struct {
+	Name  string `json:"name"`
+	Proto string `json:"proto"`
+	Table string `json:"table"`
+	State string `json:"state"`
+	Since string `json:"since"` // RFC3339 with timeformat protocol iso long, otherwise as printed by BIRD
+	Info  string `json:"info"`
+
+	Description     string            `json:"description,omitempty"`
+	BGPState        string            `json:"bgp-state,omitempty"`
+	NeighborAddress string            `json:"neighbor-address,omitempty"`
+	NeighborAS      uint32            `json:"neighbor-as,omitempty"`
+	LocalAS         uint32            `json:"local-as,omitempty"`
+	NeighborID      string            `json:"neighbor-id,omitempty"`
+	LastError       string            `json:"last-error,omitempty"`
+	Attributes      map[string]string `json:"attributes,omitempty"` // Every "key: value" protocol detail line
+	Channels        []*Channel        `json:"channels,omitempty"`
+}
+
+// Channel is a protocol channel from the output of show protocols all
+type Channel struct {
+	Name         string            `json:"name"`
+	State        string            `json:"state"`
+	Table        string            `json:"table"`
+	Preference   int               `json:"preference"`
+	InputFilter  string            `json:"input-filter"`
+	OutputFilter string            `json:"output-filter"`
+	Routes       RouteCounts       `json:"routes"`
+	Attributes   map[string]string `json:"attributes,omitempty"` // Every "key: value" channel detail line
+
+	ImportUpdates   ChangeStats `json:"import-updates"`
+	ImportWithdraws ChangeStats `json:"import-withdraws"`
+	ExportUpdates   ChangeStats `json:"export-updates"`
+	ExportWithdraws ChangeStats `json:"export-withdraws"`
+}
+
+// RouteCounts stores the route counts of a channel
+type RouteCounts struct {
+	Imported  int `json:"imported"`
+	Filtered  int `json:"filtered"`
+	Exported  int `json:"exported"`
+	Preferred int `json:"preferred"`
+}
+
+// ChangeStats stores a row of channel route change stats, with -1 for columns BIRD doesn't count
+type ChangeStats struct {
+	Received int `json:"received"`
+	Rejected int `json:"rejected"`
+	Filtered int `json:"filtered"`
+	Ignored  int `json:"ignored"`
+	Accepted int `json:"accepted"`
+}
+
+var routeCountRegex = regexp.MustCompile(`(\d+) (imported|filtered|exported|preferred)`)
+
+// parseChangeStats parses the columns of a route change stats row
+func parseChangeStats(value string) ChangeStats {
+	var columns [5]int
+	for i, field := range strings.Fields(value) {
+		if i >= len(columns) {
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			n = -1
+		}
+		columns[i] = n
+	}
+	return ChangeStats{Received: columns[0], Rejected: columns[1], Filtered: columns[2], Ignored: columns[3], Accepted: columns[4]}
+}
+
+// setChannelDetail sets a channel field from a detail line
+func setChannelDetail(channel *Channel, key string, value string) {
+	channel.Attributes[key] = value
+	switch key {
+	case "State":
+		channel.State = value
+	case "Table":
+		channel.Table = value
+	case "Preference":
+		channel.Preference, _ = strconv.Atoi(value)
+	case "Input filter":
+		channel.InputFilter = value
+	case "Output filter":
+		channel.OutputFilter = value
+	case "Routes":
+		for _, match := range routeCountRegex.FindAllStringSubmatch(value, -1) {
+			n, _ := strconv.Atoi(match[1])
+			switch match[2] {
+			case "imported":
+				channel.Routes.Imported = n
+			case "filtered":
+				channel.Routes.Filtered = n
+			case "exported":
+				channel.Routes.Exported = n
+			case "preferred":
+				channel.Routes.Preferred = n
+			}
+		}
+	case "Import updates":
+		channel.ImportUpdates = parseChangeStats(value)
+	case "Import withdraws":
+		channel.ImportWithdraws = parseChangeStats(value)
+	case "Export updates":
+		channel.ExportUpdates = parseChangeStats(value)
+	case "Export withdraws":
+		channel.ExportWithdraws = parseChangeStats(value)
+	}
+}
+
+// setProtocolDetail sets a protocol field from a detail line
+func setProtocolDetail(protocol *Protocol, key string, value string) {
+	protocol.Attributes[key] = value
+	switch key {
+	case "Description":
+		protocol.Description = value
+	case "BGP state":
+		protocol.BGPState = value
+	case "Neighbor address":
+		protocol.NeighborAddress = value
+	case "Neighbor AS":
+		asn, _ := strconv.ParseUint(value, 10, 32)
+		protocol.NeighborAS = uint32(asn)
+	case "Local AS":
+		asn, _ := strconv.ParseUint(value, 10, 32)
+		protocol.LocalAS = uint32(asn)
+	case "Neighbor ID":
+		protocol.NeighborID = value
+	case "Last error":
+		protocol.LastError = value
+	}
+}
+
+// ParseProtocols parses the output of show protocols or show protocols all into protocols by name
+func ParseProtocols(output string) map[string]*Protocol {
+	protocols := map[string]*Protocol{}
+	var protocol *Protocol
+	var channel *Channel
+	for _, line := range lines(output) {
+		// Protocol summary lines aren't indented, details are
+		if line[0] != ' ' && line[0] != '\t' {
+			protocol, channel = nil, nil
+			// Fields are name, proto, table, state, since date, since time, and info
+			fields := strings.Fields(line)
+			if len(fields) < 5 || fields[0] == "Name" || fields[0] == "BIRD" {
+				continue
+			}
+			since, n := parseSince(fields[4:])
+			protocol = &Protocol{
+				Name:       fields[0],
+				Proto:      fields[1],
+				Table:      fields[2],
+				State:      fields[3],
+				Since:      since,
+				Info:       strings.Join(fields[4+n:], " "),
+				Attributes: map[string]string{},
+			}
+			protocols[protocol.Name] = protocol
+			continue
+		}
+		if protocol == nil {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Channel ") {
+			channel = &Channel{Name: strings.TrimPrefix(trimmed, "Channel "), Attributes: map[string]string{}}
+			protocol.Channels = append(protocol.Channels, channel)
+			continue
+		}
+		key, value, ok := keyValue(trimmed)
+		if !ok {
+			continue
+		}
+		if channel != nil {
+			setChannelDetail(channel, key, value)
+		} else {
+			setProtocolDetail(protocol, key, value)
+		}
+	}
+	return protocols
+}
@@ -0,0 +1,99 @@
+package birdc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Route is a single route from the output of show route, with attributes if parsed from show route all
+type Route struct {
+	Table      string            `json:"table"`
+	Prefix     string            `json:"prefix"`
+	Type       string            `json:"type"` // unicast, blackhole, unreachable, or prohibit
+	Protocol   string            `json:"protocol"`
+	Since      string            `json:"since"` // RFC3339 with timeformat route iso long, otherwise as printed by BIRD
+	Primary    bool              `json:"primary"`
+	Preference int               `json:"preference"`
+	Info       string            `json:"info"` // Protocol specific summary, such as [AS65510i] for BGP
+	NextHops   []NextHop         `json:"next-hops,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"` // Route attributes such as BGP.as_path
+}
+
+// NextHop is a route next hop
+type NextHop struct {
+	Gateway   string `json:"gateway,omitempty"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// routeRegex matches a route line: prefix (empty for alternate routes of the previous prefix), type, protocol and since, primary flag, protocol specific flags, preference, and info
+var routeRegex = regexp.MustCompile(`^(\S*)\s+(?:(unicast|blackhole|unreachable|prohibit)\s+)?\[(\S+)\s*([^\]]*)\]\s*(\*)?\s*(?:[A-Za-z0-9]+\s+)?\((\d+)(?:/[^)]*)?\)\s*(.*)$`)
+
+// ParseRoutes parses the output of show route or show route all
+func ParseRoutes(output string) []*Route {
+	var routes []*Route
+	var route *Route
+	table, prefix := "", ""
+	for _, line := range lines(output) {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Table ") && strings.HasSuffix(trimmed, ":") {
+			table = strings.TrimSuffix(strings.TrimPrefix(trimmed, "Table "), ":")
+			route = nil
+			continue
+		}
+
+		if match := routeRegex.FindStringSubmatch(line); match != nil {
+			if match[1] != "" {
+				prefix = match[1]
+			}
+			since, _ := parseSince(strings.Fields(match[4]))
+			preference, _ := strconv.Atoi(match[6])
+			route = &Route{
+				Table:      table,
+				Prefix:     prefix,
+				Type:       match[2],
+				Protocol:   match[3],
+				Since:      since,
+				Primary:    match[5] != "",
+				Preference: preference,
+				Info:       strings.TrimSpace(match[7]),
+				Attributes: map[string]string{},
+			}
+			routes = append(routes, route)
+			continue
+		}
+		if route == nil {
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+		switch fields[0] {
+		case "via":
+			hop := NextHop{Gateway: fields[1]}
+			if len(fields) >= 4 && fields[2] == "on" {
+				hop.Interface = fields[3]
+			}
+			route.NextHops = append(route.NextHops, hop)
+		case "dev":
+			route.NextHops = append(route.NextHops, NextHop{Interface: fields[1]})
+		default:
+			if key, value, ok := keyValue(trimmed); ok {
+				route.Attributes[key] = value
+			}
+		}
+	}
+	return routes
+}
+
+// Prefixes returns the unique prefixes of a list of routes in order of appearance
+func Prefixes(routes []*Route) []string {
+	var prefixes []string
+	seen := map[string]bool{}
+	for _, route := range routes {
+		if !seen[route.Prefix] {
+			seen[route.Prefix] = true
+			prefixes = append(prefixes, route.Prefix)
+		}
+	}
+	return prefixes
+}
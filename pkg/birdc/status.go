@@ -0,0 +1,35 @@
+package birdc
+
+import (
+	"strings"
+)
+
+// Status is the output of show status
+type Status struct {
+	Version             string `json:"version"`
+	RouterID            string `json:"router-id"`
+	ServerTime          string `json:"server-time"`          // RFC3339 with timeformat base iso long, otherwise as printed by BIRD
+	LastReboot          string `json:"last-reboot"`          // RFC3339 with timeformat base iso long, otherwise as printed by BIRD
+	LastReconfiguration string `json:"last-reconfiguration"` // RFC3339 with timeformat base iso long, otherwise as printed by BIRD
+}
+
+// ParseStatus parses the output of show status
+func ParseStatus(output string) *Status {
+	status := &Status{}
+	for _, line := range lines(output) {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "BIRD ") && !strings.HasSuffix(line, "ready."):
+			status.Version = strings.TrimPrefix(line, "BIRD ")
+		case strings.HasPrefix(line, "Router ID is "):
+			status.RouterID = strings.TrimPrefix(line, "Router ID is ")
+		case strings.HasPrefix(line, "Current server time is "):
+			status.ServerTime, _ = parseSince(strings.Fields(strings.TrimPrefix(line, "Current server time is ")))
+		case strings.HasPrefix(line, "Last reboot on "):
+			status.LastReboot, _ = parseSince(strings.Fields(strings.TrimPrefix(line, "Last reboot on ")))
+		case strings.HasPrefix(line, "Last reconfiguration on "):
+			status.LastReconfiguration, _ = parseSince(strings.Fields(strings.TrimPrefix(line, "Last reconfiguration on ")))
+		}
+	}
+	return status
+}
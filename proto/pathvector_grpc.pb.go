@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: pathvector.proto
+
+package pathvector
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// PathvectorClient is the client API for Pathvector service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PathvectorClient interface {
+	// ApplyConfig loads a config, renders it, and applies it to the routing daemon
+	ApplyConfig(ctx context.Context, in *ApplyConfigRequest, opts ...grpc.CallOption) (*ApplyConfigResponse, error)
+	// GetPeerStatus streams the status of a peer (all peers if empty) every interval
+	GetPeerStatus(ctx context.Context, in *GetPeerStatusRequest, opts ...grpc.CallOption) (Pathvector_GetPeerStatusClient, error)
+	// ReloadDaemon reconfigures the routing daemon with the applied config
+	ReloadDaemon(ctx context.Context, in *ReloadDaemonRequest, opts ...grpc.CallOption) (*ReloadDaemonResponse, error)
+}
+
+type pathvectorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPathvectorClient(cc grpc.ClientConnInterface) PathvectorClient {
+	return &pathvectorClient{cc}
+}
+
+func (c *pathvectorClient) ApplyConfig(ctx context.Context, in *ApplyConfigRequest, opts ...grpc.CallOption) (*ApplyConfigResponse, error) {
+	out := new(ApplyConfigResponse)
+	err := c.cc.Invoke(ctx, "/pathvector.v1.Pathvector/ApplyConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pathvectorClient) GetPeerStatus(ctx context.Context, in *GetPeerStatusRequest, opts ...grpc.CallOption) (Pathvector_GetPeerStatusClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Pathvector_ServiceDesc.Streams[0], "/pathvector.v1.Pathvector/GetPeerStatus", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pathvectorGetPeerStatusClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Pathvector_GetPeerStatusClient interface {
+	Recv() (*PeerStatus, error)
+	grpc.ClientStream
+}
+
+type pathvectorGetPeerStatusClient struct {
+	grpc.ClientStream
+}
+
+func (x *pathvectorGetPeerStatusClient) Recv() (*PeerStatus, error) {
+	m := new(PeerStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pathvectorClient) ReloadDaemon(ctx context.Context, in *ReloadDaemonRequest, opts ...grpc.CallOption) (*ReloadDaemonResponse, error) {
+	out := new(ReloadDaemonResponse)
+	err := c.cc.Invoke(ctx, "/pathvector.v1.Pathvector/ReloadDaemon", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PathvectorServer is the server API for Pathvector service.
+// All implementations must embed UnimplementedPathvectorServer
+// for forward compatibility
+type PathvectorServer interface {
+	// ApplyConfig loads a config, renders it, and applies it to the routing daemon
+	ApplyConfig(context.Context, *ApplyConfigRequest) (*ApplyConfigResponse, error)
+	// GetPeerStatus streams the status of a peer (all peers if empty) every interval
+	GetPeerStatus(*GetPeerStatusRequest, Pathvector_GetPeerStatusServer) error
+	// ReloadDaemon reconfigures the routing daemon with the applied config
+	ReloadDaemon(context.Context, *ReloadDaemonRequest) (*ReloadDaemonResponse, error)
+	mustEmbedUnimplementedPathvectorServer()
+}
+
+// UnimplementedPathvectorServer must be embedded to have forward compatible implementations.
+type UnimplementedPathvectorServer struct {
+}
+
+func (UnimplementedPathvectorServer) ApplyConfig(context.Context, *ApplyConfigRequest) (*ApplyConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyConfig not implemented")
+}
+func (UnimplementedPathvectorServer) GetPeerStatus(*GetPeerStatusRequest, Pathvector_GetPeerStatusServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetPeerStatus not implemented")
+}
+func (UnimplementedPathvectorServer) ReloadDaemon(context.Context, *ReloadDaemonRequest) (*ReloadDaemonResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadDaemon not implemented")
+}
+func (UnimplementedPathvectorServer) mustEmbedUnimplementedPathvectorServer() {}
+
+// UnsafePathvectorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PathvectorServer will
+// result in compilation errors.
+type UnsafePathvectorServer interface {
+	mustEmbedUnimplementedPathvectorServer()
+}
+
+func RegisterPathvectorServer(s grpc.ServiceRegistrar, srv PathvectorServer) {
+	s.RegisterService(&Pathvector_ServiceDesc, srv)
+}
+
+func _Pathvector_ApplyConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApplyConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PathvectorServer).ApplyConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pathvector.v1.Pathvector/ApplyConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PathvectorServer).ApplyConfig(ctx, req.(*ApplyConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pathvector_GetPeerStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetPeerStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PathvectorServer).GetPeerStatus(m, &pathvectorGetPeerStatusServer{stream})
+}
+
+type Pathvector_GetPeerStatusServer interface {
+	Send(*PeerStatus) error
+	grpc.ServerStream
+}
+
+type pathvectorGetPeerStatusServer struct {
+	grpc.ServerStream
+}
+
+func (x *pathvectorGetPeerStatusServer) Send(m *PeerStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Pathvector_ReloadDaemon_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadDaemonRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PathvectorServer).ReloadDaemon(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pathvector.v1.Pathvector/ReloadDaemon",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PathvectorServer).ReloadDaemon(ctx, req.(*ReloadDaemonRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Pathvector_ServiceDesc is the grpc.ServiceDesc for Pathvector service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Pathvector_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pathvector.v1.Pathvector",
+	HandlerType: (*PathvectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ApplyConfig",
+			Handler:    _Pathvector_ApplyConfig_Handler,
+		},
+		{
+			MethodName: "ReloadDaemon",
+			Handler:    _Pathvector_ReloadDaemon_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetPeerStatus",
+			Handler:       _Pathvector_GetPeerStatus_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pathvector.proto",
+}